@@ -3,10 +3,12 @@ package activity
 import (
 	"time"
 	"rva_crm/internal/core"
+	"github.com/google/uuid"
 )
 
 type Activity struct {
 	core.BaseModel
+	CustomerID *uuid.UUID // Who the activity concerns, if anyone
 
 	ActivityType string
 	ActivityDescription string
@@ -1,2 +1,37 @@
 package activity
 
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+type activityRepository struct {
+	db *sql.DB
+}
+
+func NewActivityRepository(db *sql.DB) ActivityRepository {
+	return &activityRepository{db: db}
+}
+
+func (r *activityRepository) CreateActivity(ctx context.Context, activity Activity) (*Activity, error) {
+	if activity.ID == uuid.Nil {
+		activity.ID = uuid.New()
+	}
+	tags, err := json.Marshal(activity.ActivityTags)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := json.Marshal(activity.ActivityMetadata)
+	if err != nil {
+		return nil, err
+	}
+	err = r.db.QueryRowContext(ctx, "INSERT INTO activities (id, customer_id, activity_type, description, activity_date, status, priority, category, tags, metadata) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING created_at, updated_at",
+		activity.ID, activity.CustomerID, activity.ActivityType, activity.ActivityDescription, activity.ActivityDate, activity.ActivityStatus, activity.ActivityPriority, activity.ActivityCategory, tags, metadata).Scan(&activity.CreatedAt, &activity.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &activity, nil
+}
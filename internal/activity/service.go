@@ -1 +1,12 @@
-package activity
\ No newline at end of file
+package activity
+
+import "context"
+
+type ActivityRepository interface {
+	ActivityCreator
+}
+
+// ActivityCreator records an activity, such as an email sent to a customer.
+type ActivityCreator interface {
+	CreateActivity(ctx context.Context, activity Activity) (*Activity, error)
+}
@@ -1,65 +1,346 @@
 package billing
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
 	"time"
 
 	"rva_crm/internal/core"
 	"rva_crm/internal/customers"
+
 	"github.com/google/uuid"
 )
 
+var (
+	ErrOrderNotFound       = errors.New("order not found")
+	ErrInvalidOrder        = errors.New("invalid order")
+	ErrOrderLocked         = errors.New("order can only be edited while pending")
+	ErrInvalidTransition   = errors.New("order status transition is not allowed")
+	ErrOrderStatusConflict = errors.New("order status was changed by another request")
+	ErrPaymentsCaptured    = errors.New("order has captured payments; refund them before cancelling")
+)
+
 type Order struct {
 	core.BaseModel
 
-	OrderNumber string
-	Customer  customers.Customer
-	Status    string
+	OrderNumber string      `json:"order_number"`
+	CustomerID  uuid.UUID   `json:"customer_id"`
+	Status      OrderStatus `json:"status"`
+
+	// Financial Information, computed by the order service
+	Currency  core.Currency `json:"currency"` // The customer's currency when the order was priced
+	SubTotal  core.Money    `json:"subtotal"` // Sum of unit price × quantity before discounts
+	Discount  core.Money    `json:"discount"`
+	TaxAmount core.Money    `json:"tax_amount"`
+	Total     core.Money    `json:"total"` // SubTotal - Discount + TaxAmount
+
+	// Payments applied to the order directly or to its invoice, maintained by
+	// the payment repository
+	AmountPaid core.Money `json:"amount_paid"`
 
-	// Financial Information
-	SubTotal    float64
-	TaxAmount   float64
-	Discount    float64
-	Total       float64
-	
 	// Dates
-    OrderDate    time.Time  `json:"order_date"`
-    ShippedDate  *time.Time `json:"shipped_date"`
-    DeliveredDate *time.Time `json:"delivered_date"`
+	OrderDate     time.Time  `json:"order_date"`
+	ShippedDate   *time.Time `json:"shipped_date"`   // Set on the transition to shipped
+	DeliveredDate *time.Time `json:"delivered_date"` // Set on the transition to delivered
 
 	// Addresses
-    BillingAddressID  *uuid.UUID `json:"billing_address_id"`
-    ShippingAddressID *uuid.UUID `json:"shipping_address_id"`
-    
-    // Relationships
-    OrderCustomer   customers.Customer    `json:"customer"`
-    OrderItems      []OrderItem `json:"order_items"`
-    Payments        []Payment   `json:"payments"`
-    BillingAddress  *customers.Address    `json:"billing_address"`
-    ShippingAddress *customers.Address    `json:"shipping_address"`
-    
-    // Metadata
-    Notes       string                 `json:"notes"`
-    Metadata    map[string]interface{} `json:"metadata"`
+	BillingAddressID  *uuid.UUID `json:"billing_address_id"`
+	ShippingAddressID *uuid.UUID `json:"shipping_address_id"`
+
+	// Relationships
+	OrderItems      []OrderItem        `json:"order_items"`
+	Payments        []Payment          `json:"payments"`
+	BillingAddress  *customers.Address `json:"billing_address"`
+	ShippingAddress *customers.Address `json:"shipping_address"`
+
+	// Stock reserved, released or shipped by the last status transition
+	StockMovements []StockMovement `json:"stock_movements,omitempty"`
+
+	// Coupons redeemed by the order. They are fixed when the order is created.
+	CouponCodes []string `json:"coupon_codes"`
+
+	// Set when a manager approved the order above the customer's credit limit
+	CreditOverride *CreditOverride `json:"credit_override,omitempty"`
+
+	// Set on orders created by accepting a quote
+	QuoteID *uuid.UUID `json:"quote_id"`
+
+	// Metadata
+	Notes    string                 `json:"notes"`
+	Metadata map[string]interface{} `json:"metadata"`
 }
 
+type OrderStatus string
+
+const (
+	OrderStatusPending    OrderStatus = "pending"
+	OrderStatusConfirmed  OrderStatus = "confirmed"
+	OrderStatusProcessing OrderStatus = "processing"
+	OrderStatusShipped    OrderStatus = "shipped"
+	OrderStatusDelivered  OrderStatus = "delivered"
+	OrderStatusCancelled  OrderStatus = "cancelled"
+	OrderStatusRefunded   OrderStatus = "refunded"
+)
+
+// orderTransitions lists the statuses each status may move to.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:    {OrderStatusConfirmed, OrderStatusCancelled},
+	OrderStatusConfirmed:  {OrderStatusProcessing, OrderStatusCancelled},
+	OrderStatusProcessing: {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:    {OrderStatusDelivered, OrderStatusRefunded},
+	OrderStatusDelivered:  {OrderStatusRefunded},
+}
 
+// CanTransitionTo reports whether the workflow allows moving from s to next.
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderStatusChanged is published after an order moves to a new status. Its
+// event name is "order." followed by the new status, e.g. "order.shipped".
+type OrderStatusChanged struct {
+	OrderID     uuid.UUID   `json:"order_id"`
+	OrderNumber string      `json:"order_number"`
+	CustomerID  uuid.UUID   `json:"customer_id"`
+	From        OrderStatus `json:"from"`
+	To          OrderStatus `json:"to"`
+	ChangedAt   time.Time   `json:"changed_at"`
+}
+
+func (e OrderStatusChanged) EventName() string {
+	return OrderStatusEventName(e.To)
+}
+
+// OrderStatusEventName is the event name to subscribe to for orders reaching
+// the given status.
+func OrderStatusEventName(status OrderStatus) string {
+	return "order." + string(status)
+}
+
+// Product is a catalog entry that can be sold on an order.
 type Product struct {
 	core.BaseModel
-	Name  string
-	Price float64
+	SKU         string        `json:"sku"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Category    string        `json:"category"`
+	TaxCategory TaxCategory   `json:"tax_category"` // Decides which tax rate applies; general by default
+	Status      ProductStatus `json:"status"`
+	IsRecurring bool          `json:"is_recurring"` // Billed each cycle rather than once
+	Price       core.Money    `json:"price"`        // List price, used when no price book applies
+
+	// Inventory. The quantities change only through stock movements.
+	TrackInventory   bool `json:"track_inventory"`   // Reserve and ship stock on orders; off for services
+	StockQuantity    int  `json:"stock_quantity"`    // On hand
+	ReservedQuantity int  `json:"reserved_quantity"` // Held for confirmed orders not yet shipped
+	LowStockAlert    int  `json:"low_stock_alert"`   // Alert when available stock falls to this or below
+}
+
+// AvailableQuantity is the stock on hand that no order has reserved.
+func (p Product) AvailableQuantity() int {
+	return p.StockQuantity - p.ReservedQuantity
 }
 
+type ProductStatus string
+
+const (
+	ProductStatusActive       ProductStatus = "active"
+	ProductStatusInactive     ProductStatus = "inactive"
+	ProductStatusDiscontinued ProductStatus = "discontinued"
+)
+
 type OrderItem struct {
 	core.BaseModel
-	Order     Order
-	Product   Product
-	Quantity  int
-	Total     float64
+	OrderID     uuid.UUID  `json:"order_id"`
+	ProductID   uuid.UUID  `json:"product_id"`
+	Description string     `json:"description"` // Product name at the time of ordering
+	Quantity    int        `json:"quantity"`
+	UnitPrice   core.Money `json:"unit_price"` // Resolved from the catalog, never taken from the client
+	Discount    core.Money `json:"discount"`   // Sum of Discounts, never taken from the client
+	TaxAmount   core.Money `json:"tax_amount"`
+	Total       core.Money `json:"total"` // UnitPrice × Quantity - Discount
+
+	// The discount rules that applied to the line, in the order applied
+	Discounts []AppliedDiscount `json:"discounts"`
 }
 
 type Payment struct {
 	core.BaseModel
-	Order     Order
-	Amount    float64
-	Status    string
-}
\ No newline at end of file
+	CustomerID  uuid.UUID     `json:"customer_id"`
+	OrderID     *uuid.UUID    `json:"order_id"` // Set when the payment was taken for a specific order
+	Method      PaymentMethod `json:"payment_method"`
+	Amount      core.Money    `json:"amount"`
+	Currency    core.Currency `json:"currency"` // Amount's currency, which every application, refund and chargeback shares
+	Status      PaymentStatus `json:"status"`
+	PaymentDate time.Time     `json:"payment_date"`
+
+	// Reversals, maintained by the payment repository
+	RefundedAmount    core.Money `json:"refunded_amount"`
+	DisputedAmount    core.Money `json:"disputed_amount"`     // Withheld by open chargebacks
+	ChargedBackAmount core.Money `json:"charged_back_amount"` // Lost chargebacks
+
+	// Set for payments taken through a PaymentGateway
+	TransactionID      string          `json:"transaction_id,omitempty"`
+	ProcessorReference string          `json:"processor_reference,omitempty"` // Reference of the latest gateway operation
+	ProcessedAt        *time.Time      `json:"processed_at,omitempty"`
+	ProcessorData      json.RawMessage `json:"processor_data,omitempty"` // Latest gateway response as received
+
+	// Relationships
+	Applications []PaymentApplication `json:"applications"`
+}
+
+type PaymentMethod string
+
+const (
+	PaymentMethodCreditCard   PaymentMethod = "credit_card"
+	PaymentMethodDebitCard    PaymentMethod = "debit_card"
+	PaymentMethodBankTransfer PaymentMethod = "bank_transfer"
+	PaymentMethodCash         PaymentMethod = "cash"
+	PaymentMethodCheck        PaymentMethod = "check"
+)
+
+type PaymentStatus string
+
+const (
+	PaymentStatusPending   PaymentStatus = "pending"
+	PaymentStatusCompleted PaymentStatus = "completed"
+	PaymentStatusFailed    PaymentStatus = "failed"
+	PaymentStatusRefunded  PaymentStatus = "refunded"
+)
+
+// paymentTransitions lists the statuses each payment status may move to.
+// Failed and refunded payments are final.
+var paymentTransitions = map[PaymentStatus][]PaymentStatus{
+	PaymentStatusPending:   {PaymentStatusCompleted, PaymentStatusFailed},
+	PaymentStatusCompleted: {PaymentStatusRefunded},
+}
+
+// CanTransitionTo reports whether a payment may move from s to next.
+func (s PaymentStatus) CanTransitionTo(next PaymentStatus) bool {
+	for _, allowed := range paymentTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Unapplied is the part of a payment not yet applied to any invoice or order,
+// refunded or lost to a chargeback. It is the customer's credit.
+func (p Payment) Unapplied() (core.Money, error) {
+	remaining, err := p.Amount.Sub(p.RefundedAmount)
+	if err != nil {
+		return core.Money{}, err
+	}
+	if remaining, err = remaining.Sub(p.ChargedBackAmount); err != nil {
+		return core.Money{}, err
+	}
+	for _, application := range p.Applications {
+		if remaining, err = remaining.Sub(application.Amount); err != nil {
+			return core.Money{}, err
+		}
+	}
+	return remaining, nil
+}
+
+// CustomerCredit is money a customer has paid that is not applied to any
+// invoice or order, such as an overpayment.
+type CustomerCredit struct {
+	CustomerID uuid.UUID  `json:"customer_id"`
+	Available  core.Money `json:"available"`
+	Payments   []*Payment `json:"payments"` // Completed payments with an unapplied amount, oldest first
+}
+
+func newCustomerCredit(customerID uuid.UUID, payments []*Payment) (*CustomerCredit, error) {
+	credit := &CustomerCredit{CustomerID: customerID}
+	for _, payment := range payments {
+		if payment.Status != PaymentStatusCompleted {
+			continue
+		}
+		unapplied, err := payment.Unapplied()
+		if err != nil {
+			return nil, err
+		}
+		if !unapplied.IsPositive() {
+			continue
+		}
+		if credit.Available, err = credit.Available.Add(unapplied); err != nil {
+			return nil, err
+		}
+		credit.Payments = append(credit.Payments, payment)
+	}
+	sort.SliceStable(credit.Payments, func(i, j int) bool {
+		return credit.Payments[i].PaymentDate.Before(credit.Payments[j].PaymentDate)
+	})
+	return credit, nil
+}
+
+// Balance is what the customer still owes on the order.
+func (o Order) Balance() (core.Money, error) {
+	return o.Total.Sub(o.AmountPaid)
+}
+
+// ApplyPayment records amount paid against the order itself, before it is
+// invoiced.
+func (o *Order) ApplyPayment(amount core.Money) error {
+	if o.Status == OrderStatusCancelled || o.Status == OrderStatusRefunded {
+		return ErrOrderNotPayable
+	}
+	if !amount.IsPositive() {
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidPayment)
+	}
+	balance, err := o.Balance()
+	if err != nil {
+		return err
+	}
+	if cmp, err := amount.Cmp(balance); err != nil {
+		return err
+	} else if cmp > 0 {
+		return fmt.Errorf("%w: order %s has %s outstanding", ErrOverApplied, o.OrderNumber, balance)
+	}
+	paid, err := o.AmountPaid.Add(amount)
+	if err != nil {
+		return err
+	}
+	o.AmountPaid = paid
+	return nil
+}
+
+// ReversePayment takes back amount previously paid against the order.
+func (o *Order) ReversePayment(amount core.Money) error {
+	paid, err := o.AmountPaid.Sub(amount)
+	if err != nil {
+		return err
+	}
+	if paid.IsNegative() {
+		return fmt.Errorf("%w: order %s has only %s paid", ErrOverApplied, o.OrderNumber, o.AmountPaid)
+	}
+	o.AmountPaid = paid
+	return nil
+}
+
+// CapturedAmount is the total of the order's payments that have been
+// captured, less refunds and lost chargebacks.
+func (o Order) CapturedAmount() (core.Money, error) {
+	var captured core.Money
+	for _, payment := range o.Payments {
+		if payment.Status != PaymentStatusCompleted {
+			continue
+		}
+		kept, err := core.Sum(payment.Amount, payment.RefundedAmount.Neg(), payment.ChargedBackAmount.Neg())
+		if err != nil {
+			return core.Money{}, err
+		}
+		if captured, err = captured.Add(kept); err != nil {
+			return core.Money{}, err
+		}
+	}
+	return captured, nil
+}
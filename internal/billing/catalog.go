@@ -0,0 +1,78 @@
+package billing
+
+import (
+	"errors"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrProductNotFound    = errors.New("product not found")
+	ErrDuplicateSKU       = errors.New("a product with this SKU already exists")
+	ErrInvalidProduct     = errors.New("product requires a SKU and a name")
+	ErrProductUnavailable = errors.New("product is discontinued")
+	ErrPriceBookNotFound  = errors.New("price book not found")
+	ErrInvalidPriceBook   = errors.New("price book must target exactly one customer or one pricing tier")
+	ErrInvalidPriceEntry  = errors.New("price book entry has an invalid price or effective range")
+)
+
+// PriceBook overrides list prices either for a single customer or for every
+// customer on a pricing tier. Exactly one of CustomerID and PricingTier is set.
+type PriceBook struct {
+	core.BaseModel
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	CustomerID  *uuid.UUID       `json:"customer_id"`
+	PricingTier *string          `json:"pricing_tier"`
+	IsActive    bool             `json:"is_active"`
+	Entries     []PriceBookEntry `json:"entries"`
+}
+
+// PriceBookEntry is the price of one product within a price book for the
+// half-open date range [EffectiveFrom, EffectiveTo).
+type PriceBookEntry struct {
+	core.BaseModel
+	PriceBookID   uuid.UUID  `json:"price_book_id"`
+	ProductID     uuid.UUID  `json:"product_id"`
+	Price         core.Money `json:"price"`
+	EffectiveFrom time.Time  `json:"effective_from"`
+	EffectiveTo   *time.Time `json:"effective_to"`
+}
+
+// EffectivePrice is a price book entry joined with the audience of its book,
+// as returned when looking up candidate prices for a product.
+type EffectivePrice struct {
+	PriceBookEntry
+	CustomerID  *uuid.UUID `json:"customer_id"`
+	PricingTier *string    `json:"pricing_tier"`
+}
+
+type PriceSource string
+
+const (
+	PriceSourceCustomer PriceSource = "customer"
+	PriceSourceTier     PriceSource = "tier"
+	PriceSourceList     PriceSource = "list"
+)
+
+// ResolvedPrice answers "what does customer X pay for product Y on date D".
+type ResolvedPrice struct {
+	CustomerID  uuid.UUID   `json:"customer_id"`
+	ProductID   uuid.UUID   `json:"product_id"`
+	Date        time.Time   `json:"date"`
+	Price       core.Money  `json:"price"`
+	Source      PriceSource `json:"source"`
+	PriceBookID *uuid.UUID  `json:"price_book_id,omitempty"`
+	ListedPrice *core.Money `json:"listed_price,omitempty"` // Price before conversion, when the customer pays in another currency
+}
+
+// Covers reports whether the entry is in effect on the given date.
+func (e PriceBookEntry) Covers(on time.Time) bool {
+	if on.Before(e.EffectiveFrom) {
+		return false
+	}
+	return e.EffectiveTo == nil || on.Before(*e.EffectiveTo)
+}
@@ -0,0 +1,118 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+)
+
+var ErrCreditLimitExceeded = errors.New("order would take the customer over their credit limit")
+
+// CreditOverride is a manager's approval to accept an order above the
+// customer's credit limit. Callers supply ApprovedBy and Reason; the order
+// service fills in the figures the decision was made on, and the repository
+// stores the record with the order as an audit trail. Every override given
+// is kept, including those on orders since edited again or deleted, whose
+// OrderID is then nil.
+type CreditOverride struct {
+	core.BaseModel
+	OrderID     *uuid.UUID `json:"order_id"`
+	CustomerID  uuid.UUID  `json:"customer_id"`
+	ApprovedBy  string     `json:"approved_by"` // Name or email of the approving manager
+	Reason      string     `json:"reason"`
+	CreditLimit core.Money `json:"credit_limit"`
+	OpenBalance core.Money `json:"open_balance"` // Open AR before the order
+	OrderTotal  core.Money `json:"order_total"`
+	ApprovedAt  time.Time  `json:"approved_at"`
+}
+
+// CustomerBalanceReader returns a customer's open AR: the balances of sent
+// and partially paid invoices plus the unpaid part of live orders that have
+// not been invoiced yet.
+type CustomerBalanceReader interface {
+	GetCustomerOpenBalance(ctx context.Context, customerID uuid.UUID) (core.Money, error)
+}
+
+// WithCreditLimits checks new and edited orders against the customer's credit limit.
+// Without it orders are never refused for credit.
+func WithCreditLimits(customers customers.CustomerRetriever, balances CustomerBalanceReader) OrderServiceOption {
+	return func(s *orderService) {
+		s.customers = customers
+		s.balances = balances
+	}
+}
+
+// checkCredit refuses a priced order that would take the customer's open AR
+// over their credit limit, unless it carries an override. An override on an
+// order that does not need one is dropped so that only real exceptions are
+// audited. When an existing order is being edited, replacing is its stored
+// version, whose unpaid total is taken out of the open balance so that the
+// order is not counted twice.
+func (s *orderService) checkCredit(ctx context.Context, order *Order, replacing *Order) error {
+	override := order.CreditOverride
+	order.CreditOverride = nil
+	if s.customers == nil {
+		return nil
+	}
+	customer, err := s.customers.GetCustomerByID(ctx, order.CustomerID)
+	if err != nil {
+		return err
+	}
+	if customer.CreditLimit == nil {
+		return nil
+	}
+	open, err := s.balances.GetCustomerOpenBalance(ctx, order.CustomerID)
+	if err != nil {
+		return err
+	}
+	if replacing != nil {
+		counted, err := replacing.Total.Sub(replacing.AmountPaid)
+		if err != nil {
+			return err
+		}
+		if counted.IsPositive() {
+			if open, err = open.Sub(counted); err != nil {
+				return err
+			}
+		}
+	}
+	unpaid, err := order.Total.Sub(order.AmountPaid)
+	if err != nil {
+		return err
+	}
+	exposure, err := open.Add(unpaid)
+	if err != nil {
+		return err
+	}
+	over, err := exposure.Cmp(*customer.CreditLimit)
+	if err != nil {
+		return err
+	}
+	if over <= 0 {
+		return nil
+	}
+	if override == nil {
+		return fmt.Errorf("%w: open balance %s plus order balance %s exceeds limit %s", ErrCreditLimitExceeded, open, unpaid, *customer.CreditLimit)
+	}
+	if strings.TrimSpace(override.ApprovedBy) == "" || strings.TrimSpace(override.Reason) == "" {
+		return fmt.Errorf("%w: a credit override needs an approver and a reason", ErrInvalidOrder)
+	}
+
+	order.CreditOverride = &CreditOverride{
+		CustomerID:  order.CustomerID,
+		ApprovedBy:  strings.TrimSpace(override.ApprovedBy),
+		Reason:      strings.TrimSpace(override.Reason),
+		CreditLimit: *customer.CreditLimit,
+		OpenBalance: open,
+		OrderTotal:  order.Total,
+		ApprovedAt:  s.now(),
+	}
+	return nil
+}
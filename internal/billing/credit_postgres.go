@@ -0,0 +1,116 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+// NewCustomerBalanceReader reads open AR from the orders and invoices tables.
+func NewCustomerBalanceReader(db *sql.DB) CustomerBalanceReader {
+	return &orderRepository{db: db}
+}
+
+const creditOverrideColumns = "id, order_id, customer_id, approved_by, reason, credit_limit, open_balance, order_total, approved_at, created_at, updated_at"
+
+func scanCreditOverride(row rowScanner) (*CreditOverride, error) {
+	var override CreditOverride
+	err := row.Scan(&override.ID, &override.OrderID, &override.CustomerID, &override.ApprovedBy, &override.Reason, &override.CreditLimit, &override.OpenBalance, &override.OrderTotal, &override.ApprovedAt, &override.CreatedAt, &override.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+// GetCustomerOpenBalance counts an order once: through its invoice when it
+// has been invoiced, otherwise by what is still unpaid on the order itself.
+// Orders with only a draft invoice are counted as orders. Documents in
+// different currencies cannot be added up and fail with ErrCurrencyMismatch.
+func (r *orderRepository) GetCustomerOpenBalance(ctx context.Context, customerID uuid.UUID) (core.Money, error) {
+	var balance core.Money
+	queries := []struct {
+		query string
+		args  []any
+	}{
+		{"SELECT currency, SUM(total - amount_paid - amount_credited) FROM invoices WHERE customer_id = $1 AND kind = $2 AND status IN ($3, $4) GROUP BY currency",
+			[]any{customerID, InvoiceKindInvoice, InvoiceStatusSent, InvoiceStatusPartiallyPaid}},
+		{"SELECT o.currency, SUM(o.total - o.amount_paid) FROM orders o WHERE o.customer_id = $1 AND o.status NOT IN ($2, $3) AND o.total > o.amount_paid AND NOT EXISTS (SELECT 1 FROM invoices i WHERE i.order_id = o.id AND i.kind = $4 AND i.status IN ($5, $6, $7)) GROUP BY o.currency",
+			[]any{customerID, OrderStatusCancelled, OrderStatusRefunded, InvoiceKindInvoice, InvoiceStatusSent, InvoiceStatusPartiallyPaid, InvoiceStatusPaid}},
+	}
+	for _, q := range queries {
+		sum, err := r.sumOpenBalance(ctx, q.query, q.args...)
+		if err != nil {
+			return core.Money{}, err
+		}
+		if balance, err = balance.Add(sum); err != nil {
+			return core.Money{}, err
+		}
+	}
+	return balance, nil
+}
+
+// sumOpenBalance adds up the (currency, amount) rows of one open balance
+// query, closing them before it returns.
+func (r *orderRepository) sumOpenBalance(ctx context.Context, query string, args ...any) (core.Money, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return core.Money{}, err
+	}
+	defer rows.Close()
+
+	var balance core.Money
+	for rows.Next() {
+		var currency core.Currency
+		var sum core.Money
+		if err := rows.Scan(&currency, &sum); err != nil {
+			return core.Money{}, err
+		}
+		if err := rereadAmounts(currency, &sum); err != nil {
+			return core.Money{}, err
+		}
+		if balance, err = balance.Add(sum); err != nil {
+			return core.Money{}, err
+		}
+	}
+	return balance, rows.Err()
+}
+
+func insertCreditOverride(ctx context.Context, tx *sql.Tx, orderID uuid.UUID, override CreditOverride) (*CreditOverride, error) {
+	if override.ID == uuid.Nil {
+		override.ID = uuid.New()
+	}
+	return scanCreditOverride(tx.QueryRowContext(ctx, "INSERT INTO credit_overrides (id, order_id, customer_id, approved_by, reason, credit_limit, open_balance, order_total, approved_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING "+creditOverrideColumns,
+		override.ID, orderID, override.CustomerID, override.ApprovedBy, override.Reason, override.CreditLimit, override.OpenBalance, override.OrderTotal, override.ApprovedAt))
+}
+
+// getCreditOverride returns the latest override given on the order, if any.
+func getCreditOverride(ctx context.Context, db *sql.DB, orderID uuid.UUID) (*CreditOverride, error) {
+	override, err := scanCreditOverride(db.QueryRowContext(ctx, "SELECT "+creditOverrideColumns+" FROM credit_overrides WHERE order_id = $1 ORDER BY approved_at DESC, created_at DESC LIMIT 1", orderID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return override, err
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// refreshCustomerStats recomputes the purchase history billing keeps on the
+// customer record. It is recomputed rather than adjusted so that a missed or
+// concurrent update is corrected by the next one. total_spent is in the
+// customer's currency and counts only payments made in it.
+func refreshCustomerStats(ctx context.Context, db execer, customerID uuid.UUID) error {
+	_, err := db.ExecContext(ctx, `UPDATE customers SET
+		total_spent = (SELECT COALESCE(SUM(p.amount - p.refunded_amount - p.charged_back_amount), 0) FROM payments p WHERE p.customer_id = $1 AND p.currency = customers.currency AND p.payment_status IN ($2, $3)),
+		last_purchase_at = (SELECT MAX(order_date) FROM orders WHERE customer_id = $1 AND status IN ($4, $5, $6, $7)),
+		updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		customerID, PaymentStatusCompleted, PaymentStatusRefunded, OrderStatusConfirmed, OrderStatusProcessing, OrderStatusShipped, OrderStatusDelivered)
+	return err
+}
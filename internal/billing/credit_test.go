@@ -0,0 +1,202 @@
+package billing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockCustomerBalanceReader struct {
+	mock.Mock
+}
+
+func (m *MockCustomerBalanceReader) GetCustomerOpenBalance(ctx context.Context, customerID uuid.UUID) (core.Money, error) {
+	args := m.Called(ctx, customerID)
+	return args.Get(0).(core.Money), args.Error(1)
+}
+
+type CreditLimitTestSuite struct {
+	suite.Suite
+	orderRepo   *MockOrderRepository
+	productRepo *MockProductRepository
+	prices      *MockPriceResolver
+	customers   *MockCustomerRetriever
+	balances    *MockCustomerBalanceReader
+	now         time.Time
+	service     OrderService
+
+	customerID, productID uuid.UUID
+	orderDate             time.Time
+}
+
+func (s *CreditLimitTestSuite) SetupTest() {
+	s.orderRepo = new(MockOrderRepository)
+	s.productRepo = new(MockProductRepository)
+	s.prices = new(MockPriceResolver)
+	s.customers = new(MockCustomerRetriever)
+	s.balances = new(MockCustomerBalanceReader)
+	s.now = time.Date(2026, 5, 4, 9, 30, 0, 0, time.UTC)
+	s.service = NewOrderService(s.orderRepo, s.productRepo, s.prices, new(MockAddressRetriever), WithCreditLimits(s.customers, s.balances))
+	s.service.(*orderService).now = func() time.Time { return s.now }
+
+	s.customerID, s.productID = uuid.New(), uuid.New()
+	s.orderDate = time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (s *CreditLimitTestSuite) TearDownTest() {
+	s.orderRepo.AssertExpectations(s.T())
+	s.customers.AssertExpectations(s.T())
+	s.balances.AssertExpectations(s.T())
+}
+
+func TestCreditLimitSuite(t *testing.T) {
+	suite.Run(t, new(CreditLimitTestSuite))
+}
+
+// order arranges a one-line order priced at 400.00 for a customer with the
+// given limit and open balance.
+func (s *CreditLimitTestSuite) order(ctx context.Context, limit *core.Money, open core.Money) Order {
+	s.productRepo.On("GetProductByID", ctx, s.productID).Return(&Product{Name: "Tax Strategy Session"}, nil)
+	s.prices.On("ResolvePrice", ctx, s.customerID, s.productID, s.orderDate).Return(&ResolvedPrice{Price: usd("400.00")}, nil)
+	s.customers.On("GetCustomerByID", ctx, s.customerID).Return(customers.Customer{CreditLimit: limit}, nil)
+	if limit != nil {
+		s.balances.On("GetCustomerOpenBalance", ctx, s.customerID).Return(open, nil)
+	}
+	return Order{
+		CustomerID: s.customerID,
+		OrderDate:  s.orderDate,
+		OrderItems: []OrderItem{{ProductID: s.productID, Quantity: 1}},
+	}
+}
+
+func creditLimit(s string) *core.Money {
+	m := usd(s)
+	return &m
+}
+
+func (s *CreditLimitTestSuite) TestCreateOrder_WithinLimit() {
+	// Arrange
+	ctx := context.Background()
+	input := s.order(ctx, creditLimit("1000.00"), usd("600.00"))
+	input.CreditOverride = &CreditOverride{ApprovedBy: "pat@example.com", Reason: "not needed"}
+
+	var saved Order
+	s.orderRepo.On("CreateOrder", ctx, mock.AnythingOfType("Order")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Order)
+	}).Return(&Order{OrderNumber: "ORD-000001"}, nil)
+
+	// Act
+	result, err := s.service.CreateOrder(ctx, input)
+
+	// Assert
+	s.NoError(err)
+	s.NotNil(result)
+	s.Nil(saved.CreditOverride, "an override is only recorded when it was needed")
+}
+
+func (s *CreditLimitTestSuite) TestCreateOrder_NoLimitSkipsBalance() {
+	// Arrange
+	ctx := context.Background()
+	input := s.order(ctx, nil, core.Money{})
+	s.orderRepo.On("CreateOrder", ctx, mock.AnythingOfType("Order")).Return(&Order{}, nil)
+
+	// Act
+	_, err := s.service.CreateOrder(ctx, input)
+
+	// Assert
+	s.NoError(err)
+	s.balances.AssertNotCalled(s.T(), "GetCustomerOpenBalance", mock.Anything, mock.Anything)
+}
+
+func (s *CreditLimitTestSuite) TestCreateOrder_RefusedOverLimit() {
+	// Arrange
+	ctx := context.Background()
+	input := s.order(ctx, creditLimit("1000.00"), usd("600.01"))
+
+	// Act
+	result, err := s.service.CreateOrder(ctx, input)
+
+	// Assert
+	s.ErrorIs(err, ErrCreditLimitExceeded)
+	s.Nil(result)
+	s.orderRepo.AssertNotCalled(s.T(), "CreateOrder", mock.Anything, mock.Anything)
+}
+
+func (s *CreditLimitTestSuite) TestCreateOrder_OverrideRecordsAudit() {
+	// Arrange
+	ctx := context.Background()
+	input := s.order(ctx, creditLimit("1000.00"), usd("900.00"))
+	input.CreditOverride = &CreditOverride{ApprovedBy: " pat@example.com ", Reason: "Paying by wire on Friday", OpenBalance: usd("0.00")}
+
+	var saved Order
+	s.orderRepo.On("CreateOrder", ctx, mock.AnythingOfType("Order")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Order)
+	}).Return(&Order{}, nil)
+
+	// Act
+	_, err := s.service.CreateOrder(ctx, input)
+
+	// Assert
+	s.NoError(err)
+	s.Require().NotNil(saved.CreditOverride)
+	s.Equal(s.customerID, saved.CreditOverride.CustomerID)
+	s.Equal("pat@example.com", saved.CreditOverride.ApprovedBy)
+	s.Equal(usd("1000.00"), saved.CreditOverride.CreditLimit)
+	s.Equal(usd("900.00"), saved.CreditOverride.OpenBalance)
+	s.Equal(usd("400.00"), saved.CreditOverride.OrderTotal)
+	s.Equal(s.now, saved.CreditOverride.ApprovedAt)
+}
+
+func (s *CreditLimitTestSuite) TestCreateOrder_OverrideNeedsReason() {
+	// Arrange
+	ctx := context.Background()
+	input := s.order(ctx, creditLimit("1000.00"), usd("900.00"))
+	input.CreditOverride = &CreditOverride{ApprovedBy: "pat@example.com"}
+
+	// Act
+	result, err := s.service.CreateOrder(ctx, input)
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidOrder)
+	s.Nil(result)
+}
+
+func (s *CreditLimitTestSuite) TestUpdateOrder_CountsTheEditedTotalOnce() {
+	// Arrange
+	ctx := context.Background()
+	input := s.order(ctx, creditLimit("1000.00"), usd("900.00"))
+	input.ID = uuid.New()
+	s.orderRepo.On("GetOrderByID", ctx, input.ID).Return(&Order{CustomerID: s.customerID, Status: OrderStatusPending, Total: usd("300.00")}, nil)
+	s.orderRepo.On("UpdateOrder", ctx, mock.MatchedBy(func(o Order) bool {
+		return o.Total == usd("400.00") && o.CreditOverride == nil
+	})).Return(&Order{}, nil)
+
+	// Act
+	_, err := s.service.UpdateOrder(ctx, input)
+
+	// Assert
+	s.NoError(err)
+}
+
+func (s *CreditLimitTestSuite) TestUpdateOrder_RefusedWhenEditedOverLimit() {
+	// Arrange
+	ctx := context.Background()
+	input := s.order(ctx, creditLimit("1000.00"), usd("800.00"))
+	input.ID = uuid.New()
+	s.orderRepo.On("GetOrderByID", ctx, input.ID).Return(&Order{CustomerID: s.customerID, Status: OrderStatusPending, Total: usd("100.00")}, nil)
+
+	// Act
+	result, err := s.service.UpdateOrder(ctx, input)
+
+	// Assert
+	s.ErrorIs(err, ErrCreditLimitExceeded)
+	s.Nil(result)
+	s.orderRepo.AssertNotCalled(s.T(), "UpdateOrder", mock.Anything, mock.Anything)
+}
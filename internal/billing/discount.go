@@ -0,0 +1,273 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrDiscountRuleNotFound = errors.New("discount rule not found")
+	ErrInvalidDiscountRule  = errors.New("invalid discount rule")
+	ErrCouponNotFound       = errors.New("coupon not found")
+	ErrInvalidCoupon        = errors.New("coupon requires a code and a discount rule")
+	ErrDuplicateCoupon      = errors.New("a coupon with this code already exists")
+	ErrCouponUnavailable    = errors.New("coupon is not valid for this order")
+)
+
+type DiscountType string
+
+const (
+	DiscountTypePercentage  DiscountType = "percentage"
+	DiscountTypeFixedAmount DiscountType = "fixed_amount"
+)
+
+type DiscountScope string
+
+const (
+	DiscountScopeOrder DiscountScope = "order" // Spread across the lines in proportion to their amounts
+	DiscountScopeLine  DiscountScope = "line"
+)
+
+// DiscountRule is a promotion the order service applies when its conditions
+// hold on the order date. Rules without RequiresCoupon apply automatically;
+// the others only when the order carries one of their coupons.
+type DiscountRule struct {
+	core.BaseModel
+	Name       string        `json:"name"`
+	Type       DiscountType  `json:"type"`
+	Scope      DiscountScope `json:"scope"`
+	Percentage float64       `json:"percentage"` // Percentage rules, e.g. 12.5
+	Amount     core.Money    `json:"amount"`     // Fixed rules: off each unit for line rules, off the order for order rules
+
+	// Conditions
+	ProductID           *uuid.UUID `json:"product_id"`            // Line rules only: restrict to lines of this product
+	FirstEngagementOnly bool       `json:"first_engagement_only"` // Only the customer's first order
+	RequiresCoupon      bool       `json:"requires_coupon"`
+	StartsAt            *time.Time `json:"starts_at"`
+	EndsAt              *time.Time `json:"ends_at"` // Exclusive
+	IsActive            bool       `json:"is_active"`
+
+	// Rules apply in ascending Priority, then by name and ID
+	Priority int `json:"priority"`
+}
+
+func (r DiscountRule) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidDiscountRule)
+	}
+	switch r.Type {
+	case DiscountTypePercentage:
+		if r.Percentage <= 0 || r.Percentage > 100 {
+			return fmt.Errorf("%w: percentage must be above 0 and at most 100", ErrInvalidDiscountRule)
+		}
+		if _, err := core.PercentRate(r.Percentage); err != nil {
+			return fmt.Errorf("%w: percentage must have at most two decimal places", ErrInvalidDiscountRule)
+		}
+	case DiscountTypeFixedAmount:
+		if !r.Amount.IsPositive() {
+			return fmt.Errorf("%w: amount must be positive", ErrInvalidDiscountRule)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidDiscountRule, r.Type)
+	}
+	switch r.Scope {
+	case DiscountScopeLine:
+	case DiscountScopeOrder:
+		if r.ProductID != nil {
+			return fmt.Errorf("%w: only line rules can target a product", ErrInvalidDiscountRule)
+		}
+	default:
+		return fmt.Errorf("%w: unknown scope %q", ErrInvalidDiscountRule, r.Scope)
+	}
+	if r.StartsAt != nil && r.EndsAt != nil && !r.EndsAt.After(*r.StartsAt) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidDiscountRule)
+	}
+	return nil
+}
+
+// activeOn reports whether the rule is switched on and within its dates.
+func (r DiscountRule) activeOn(t time.Time) bool {
+	if !r.IsActive {
+		return false
+	}
+	if r.StartsAt != nil && t.Before(*r.StartsAt) {
+		return false
+	}
+	return r.EndsAt == nil || t.Before(*r.EndsAt)
+}
+
+// Coupon unlocks a discount rule. Orders that are not cancelled count
+// towards MaxRedemptions.
+type Coupon struct {
+	core.BaseModel
+	Code           string     `json:"code"`
+	RuleID         uuid.UUID  `json:"rule_id"`
+	MaxRedemptions *int       `json:"max_redemptions"` // Nil for unlimited
+	Redemptions    int        `json:"redemptions"`     // Maintained by the repository
+	ExpiresAt      *time.Time `json:"expires_at"`
+	IsActive       bool       `json:"is_active"`
+}
+
+func (c Coupon) Validate() error {
+	if c.Code == "" || c.RuleID == uuid.Nil {
+		return ErrInvalidCoupon
+	}
+	if c.MaxRedemptions != nil && *c.MaxRedemptions <= 0 {
+		return fmt.Errorf("%w: max_redemptions must be positive", ErrInvalidCoupon)
+	}
+	return nil
+}
+
+// usableAt reports whether the coupon can be redeemed at t.
+func (c Coupon) usableAt(t time.Time) bool {
+	if !c.IsActive || (c.ExpiresAt != nil && !t.Before(*c.ExpiresAt)) {
+		return false
+	}
+	return c.MaxRedemptions == nil || c.Redemptions < *c.MaxRedemptions
+}
+
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// AppliedDiscount records one rule's share of a line's discount.
+type AppliedDiscount struct {
+	RuleID     uuid.UUID  `json:"rule_id"`
+	RuleName   string     `json:"rule_name"`
+	CouponCode string     `json:"coupon_code,omitempty"`
+	Amount     core.Money `json:"amount"`
+}
+
+// discountLine is what applyDiscounts needs to know about an order line.
+type discountLine struct {
+	ProductID uuid.UUID
+	Quantity  int
+	Gross     core.Money // Unit price × quantity
+}
+
+// eligibleDiscount is a rule that passed its conditions for an order, with
+// the coupon that unlocked it if any.
+type eligibleDiscount struct {
+	rule       DiscountRule
+	couponCode string
+}
+
+// sortDiscounts puts rules in the order they are applied: by priority, line
+// rules before order rules, then by name and ID so that equal priorities
+// never depend on how the rules were loaded.
+func sortDiscounts(discounts []eligibleDiscount) {
+	sort.SliceStable(discounts, func(i, j int) bool {
+		a, b := discounts[i].rule, discounts[j].rule
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		if a.Scope != b.Scope {
+			return a.Scope == DiscountScopeLine
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID.String() < b.ID.String()
+	})
+}
+
+// applyDiscounts works out each line's discounts. Rules apply in turn, each
+// to what is left of the lines after the rules before it, so percentages
+// compound and a line is never discounted below zero. Order rules are
+// rounded once on the order and allocated to the lines in proportion to
+// what is left of them.
+func applyDiscounts(lines []discountLine, discounts []eligibleDiscount) ([][]AppliedDiscount, error) {
+	sortDiscounts(discounts)
+	remaining := make([]core.Money, len(lines))
+	for i, line := range lines {
+		remaining[i] = line.Gross
+	}
+	applied := make([][]AppliedDiscount, len(lines))
+	record := func(i int, discount eligibleDiscount, amount core.Money) error {
+		if !amount.IsPositive() {
+			return nil
+		}
+		var err error
+		if remaining[i], err = remaining[i].Sub(amount); err != nil {
+			return err
+		}
+		applied[i] = append(applied[i], AppliedDiscount{RuleID: discount.rule.ID, RuleName: discount.rule.Name, CouponCode: discount.couponCode, Amount: amount})
+		return nil
+	}
+
+	for _, discount := range discounts {
+		rule := discount.rule
+		if rule.Scope == DiscountScopeLine {
+			for i, line := range lines {
+				if rule.ProductID != nil && *rule.ProductID != line.ProductID {
+					continue
+				}
+				amount, err := ruleAmount(rule, remaining[i], line.Quantity)
+				if err != nil {
+					return nil, err
+				}
+				if err := record(i, discount, amount); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		base, err := core.Sum(remaining...)
+		if err != nil {
+			return nil, err
+		}
+		if !base.IsPositive() {
+			continue
+		}
+		amount, err := ruleAmount(rule, base, 1)
+		if err != nil {
+			return nil, err
+		}
+		ratios := make([]int64, len(remaining))
+		for i, r := range remaining {
+			ratios[i] = r.Minor()
+		}
+		shares, err := amount.Allocate(ratios...)
+		if err != nil {
+			return nil, err
+		}
+		for i, share := range shares {
+			if err := record(i, discount, share); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return applied, nil
+}
+
+// ruleAmount is what a rule takes off base, capped at base. Fixed amounts
+// are per unit.
+func ruleAmount(rule DiscountRule, base core.Money, quantity int) (core.Money, error) {
+	if !base.IsPositive() {
+		return core.Zero(base.Currency()), nil
+	}
+	var amount core.Money
+	var err error
+	switch rule.Type {
+	case DiscountTypePercentage:
+		rate, rateErr := core.PercentRate(rule.Percentage)
+		if rateErr != nil {
+			return core.Money{}, rateErr
+		}
+		amount, err = base.Mul(rate, core.RoundHalfUp)
+	default:
+		amount, err = rule.Amount.Times(int64(quantity))
+	}
+	if err != nil {
+		return core.Money{}, err
+	}
+	return amount.Min(base)
+}
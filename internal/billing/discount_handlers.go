@@ -0,0 +1,195 @@
+package billing
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type discountRuleHandler struct {
+	service DiscountRuleManager
+}
+
+type couponHandler struct {
+	service CouponManager
+}
+
+// NewDiscountRuleHandler serves discount rules: GET by ?id= or all of them,
+// POST to create one, PUT to update one and DELETE ?id=.
+func NewDiscountRuleHandler(service DiscountRuleManager) http.Handler {
+	return &discountRuleHandler{service: service}
+}
+
+// NewCouponHandler serves coupons: GET by ?id=, ?code= or ?rule_id=, POST
+// to create one, PUT to change its limits and DELETE ?id=.
+func NewCouponHandler(service CouponManager) http.Handler {
+	return &couponHandler{service: service}
+}
+
+func (h *discountRuleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getRules(w, r)
+	case http.MethodPost:
+		h.createRule(w, r)
+	case http.MethodPut:
+		h.updateRule(w, r)
+	case http.MethodDelete:
+		h.deleteRule(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *couponHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getCoupons(w, r)
+	case http.MethodPost:
+		h.createCoupon(w, r)
+	case http.MethodPut:
+		h.updateCoupon(w, r)
+	case http.MethodDelete:
+		h.deleteCoupon(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *discountRuleHandler) getRules(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.Query().Has("id") {
+		rules, err := h.service.ListDiscountRules(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(rules)
+		return
+	}
+	id, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	rule, err := h.service.GetDiscountRuleByID(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (h *discountRuleHandler) createRule(w http.ResponseWriter, r *http.Request) {
+	var rule DiscountRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	created, err := h.service.CreateDiscountRule(r.Context(), rule)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *discountRuleHandler) updateRule(w http.ResponseWriter, r *http.Request) {
+	var rule DiscountRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updated, err := h.service.UpdateDiscountRule(r.Context(), rule)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *discountRuleHandler) deleteRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteDiscountRule(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Discount rule deleted successfully"})
+}
+
+func (h *couponHandler) getCoupons(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch {
+	case query.Has("id"):
+		id, ok := queryUUID(w, r, "id")
+		if !ok {
+			return
+		}
+		coupon, err := h.service.GetCouponByID(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(coupon)
+	case query.Has("code"):
+		coupon, err := h.service.GetCouponByCode(r.Context(), query.Get("code"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(coupon)
+	default:
+		ruleID, ok := queryUUID(w, r, "rule_id")
+		if !ok {
+			return
+		}
+		coupons, err := h.service.GetCouponsByRuleID(r.Context(), ruleID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(coupons)
+	}
+}
+
+func (h *couponHandler) createCoupon(w http.ResponseWriter, r *http.Request) {
+	var coupon Coupon
+	if err := json.NewDecoder(r.Body).Decode(&coupon); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	created, err := h.service.CreateCoupon(r.Context(), coupon)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *couponHandler) updateCoupon(w http.ResponseWriter, r *http.Request) {
+	var coupon Coupon
+	if err := json.NewDecoder(r.Body).Decode(&coupon); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updated, err := h.service.UpdateCoupon(r.Context(), coupon)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *couponHandler) deleteCoupon(w http.ResponseWriter, r *http.Request) {
+	id, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteCoupon(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Coupon deleted successfully"})
+}
@@ -0,0 +1,202 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type discountRepository struct {
+	db *sql.DB
+}
+
+func NewDiscountRepository(db *sql.DB) DiscountRepository {
+	return &discountRepository{db: db}
+}
+
+const discountRuleColumns = "id, name, discount_type, scope, percentage, amount, product_id, first_engagement_only, requires_coupon, starts_at, ends_at, is_active, priority, created_at, updated_at"
+
+func scanDiscountRule(row rowScanner) (*DiscountRule, error) {
+	var rule DiscountRule
+	err := row.Scan(&rule.ID, &rule.Name, &rule.Type, &rule.Scope, &rule.Percentage, &rule.Amount, &rule.ProductID, &rule.FirstEngagementOnly, &rule.RequiresCoupon, &rule.StartsAt, &rule.EndsAt, &rule.IsActive, &rule.Priority, &rule.CreatedAt, &rule.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDiscountRuleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// couponColumns counts redemptions by orders that were not cancelled, so a
+// cancelled order gives its redemption back.
+const couponColumns = "c.id, c.code, c.rule_id, c.max_redemptions, (SELECT COUNT(*) FROM coupon_redemptions r JOIN orders o ON o.id = r.order_id WHERE r.coupon_id = c.id AND o.status <> 'cancelled'), c.expires_at, c.is_active, c.created_at, c.updated_at"
+
+func scanCoupon(row rowScanner) (*Coupon, error) {
+	var coupon Coupon
+	err := row.Scan(&coupon.ID, &coupon.Code, &coupon.RuleID, &coupon.MaxRedemptions, &coupon.Redemptions, &coupon.ExpiresAt, &coupon.IsActive, &coupon.CreatedAt, &coupon.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCouponNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+func (r *discountRepository) queryDiscountRules(ctx context.Context, query string, args ...any) ([]*DiscountRule, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*DiscountRule
+	for rows.Next() {
+		rule, err := scanDiscountRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (r *discountRepository) GetDiscountRuleByID(ctx context.Context, id uuid.UUID) (*DiscountRule, error) {
+	return scanDiscountRule(r.db.QueryRowContext(ctx, "SELECT "+discountRuleColumns+" FROM discount_rules WHERE id = $1", id))
+}
+
+func (r *discountRepository) ListDiscountRules(ctx context.Context) ([]*DiscountRule, error) {
+	return r.queryDiscountRules(ctx, "SELECT "+discountRuleColumns+" FROM discount_rules ORDER BY priority, name, id")
+}
+
+func (r *discountRepository) GetAutomaticDiscountRules(ctx context.Context, on time.Time) ([]*DiscountRule, error) {
+	return r.queryDiscountRules(ctx, "SELECT "+discountRuleColumns+" FROM discount_rules WHERE is_active AND NOT requires_coupon AND (starts_at IS NULL OR starts_at <= $1) AND (ends_at IS NULL OR ends_at > $1) ORDER BY priority, name, id", on)
+}
+
+func (r *discountRepository) CreateDiscountRule(ctx context.Context, rule DiscountRule) (*DiscountRule, error) {
+	if rule.ID == uuid.Nil {
+		rule.ID = uuid.New()
+	}
+	return scanDiscountRule(r.db.QueryRowContext(ctx, "INSERT INTO discount_rules (id, name, discount_type, scope, percentage, amount, product_id, first_engagement_only, requires_coupon, starts_at, ends_at, is_active, priority) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING "+discountRuleColumns,
+		rule.ID, rule.Name, rule.Type, rule.Scope, rule.Percentage, rule.Amount, rule.ProductID, rule.FirstEngagementOnly, rule.RequiresCoupon, rule.StartsAt, rule.EndsAt, rule.IsActive, rule.Priority))
+}
+
+func (r *discountRepository) UpdateDiscountRule(ctx context.Context, rule DiscountRule) (*DiscountRule, error) {
+	return scanDiscountRule(r.db.QueryRowContext(ctx, "UPDATE discount_rules SET name = $1, discount_type = $2, scope = $3, percentage = $4, amount = $5, product_id = $6, first_engagement_only = $7, requires_coupon = $8, starts_at = $9, ends_at = $10, is_active = $11, priority = $12, updated_at = CURRENT_TIMESTAMP WHERE id = $13 RETURNING "+discountRuleColumns,
+		rule.Name, rule.Type, rule.Scope, rule.Percentage, rule.Amount, rule.ProductID, rule.FirstEngagementOnly, rule.RequiresCoupon, rule.StartsAt, rule.EndsAt, rule.IsActive, rule.Priority, rule.ID))
+}
+
+func (r *discountRepository) DeleteDiscountRule(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM discount_rules WHERE id = $1", id)
+	return err
+}
+
+func (r *discountRepository) GetCouponByID(ctx context.Context, id uuid.UUID) (*Coupon, error) {
+	return scanCoupon(r.db.QueryRowContext(ctx, "SELECT "+couponColumns+" FROM coupons c WHERE c.id = $1", id))
+}
+
+func (r *discountRepository) GetCouponByCode(ctx context.Context, code string) (*Coupon, error) {
+	return scanCoupon(r.db.QueryRowContext(ctx, "SELECT "+couponColumns+" FROM coupons c WHERE c.code = $1", code))
+}
+
+func (r *discountRepository) GetCouponsByRuleID(ctx context.Context, ruleID uuid.UUID) ([]*Coupon, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+couponColumns+" FROM coupons c WHERE c.rule_id = $1 ORDER BY c.code", ruleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var coupons []*Coupon
+	for rows.Next() {
+		coupon, err := scanCoupon(rows)
+		if err != nil {
+			return nil, err
+		}
+		coupons = append(coupons, coupon)
+	}
+	return coupons, rows.Err()
+}
+
+func (r *discountRepository) CreateCoupon(ctx context.Context, coupon Coupon) (*Coupon, error) {
+	if coupon.ID == uuid.Nil {
+		coupon.ID = uuid.New()
+	}
+	err := r.db.QueryRowContext(ctx, "INSERT INTO coupons (id, code, rule_id, max_redemptions, expires_at, is_active) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (code) DO NOTHING RETURNING id",
+		coupon.ID, coupon.Code, coupon.RuleID, coupon.MaxRedemptions, coupon.ExpiresAt, coupon.IsActive).Scan(&coupon.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDuplicateCoupon
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.GetCouponByID(ctx, coupon.ID)
+}
+
+func (r *discountRepository) UpdateCoupon(ctx context.Context, coupon Coupon) (*Coupon, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE coupons SET max_redemptions = $1, expires_at = $2, is_active = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $4",
+		coupon.MaxRedemptions, coupon.ExpiresAt, coupon.IsActive, coupon.ID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrCouponNotFound
+	}
+	return r.GetCouponByID(ctx, coupon.ID)
+}
+
+func (r *discountRepository) DeleteCoupon(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM coupons WHERE id = $1", id)
+	return err
+}
+
+// redeemCoupon records an order's use of a coupon. The coupon row is locked
+// while its redemptions are counted, so concurrent orders cannot both take
+// the last use.
+func redeemCoupon(ctx context.Context, tx *sql.Tx, orderID uuid.UUID, code string) error {
+	var couponID uuid.UUID
+	var maxRedemptions *int
+	err := tx.QueryRowContext(ctx, "SELECT id, max_redemptions FROM coupons WHERE code = $1 FOR UPDATE", code).Scan(&couponID, &maxRedemptions)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s does not exist", ErrCouponUnavailable, code)
+	}
+	if err != nil {
+		return err
+	}
+	if maxRedemptions != nil {
+		var redemptions int
+		err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM coupon_redemptions r JOIN orders o ON o.id = r.order_id WHERE r.coupon_id = $1 AND o.status <> 'cancelled'", couponID).Scan(&redemptions)
+		if err != nil {
+			return err
+		}
+		if redemptions >= *maxRedemptions {
+			return fmt.Errorf("%w: %s has been used up", ErrCouponUnavailable, code)
+		}
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO coupon_redemptions (coupon_id, order_id) VALUES ($1, $2)", couponID, orderID)
+	return err
+}
+
+func getOrderCouponCodes(ctx context.Context, db *sql.DB, orderID uuid.UUID) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT c.code FROM coupon_redemptions r JOIN coupons c ON c.id = r.coupon_id WHERE r.order_id = $1 ORDER BY c.code", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
@@ -0,0 +1,346 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+type DiscountService interface {
+	DiscountRuleManager
+	CouponManager
+}
+
+type DiscountRepository interface {
+	DiscountRuleManager
+	CouponManager
+	AutomaticDiscountLister
+}
+
+// DiscountSource is what the order service needs to price discounts.
+type DiscountSource interface {
+	AutomaticDiscountLister
+	DiscountRuleRetriever
+	CouponCodeRetriever
+}
+
+type DiscountRuleManager interface {
+	DiscountRuleRetriever
+	DiscountRuleLister
+	DiscountRuleCreator
+	DiscountRuleUpdater
+	DiscountRuleDeleter
+}
+
+type DiscountRuleRetriever interface {
+	GetDiscountRuleByID(ctx context.Context, id uuid.UUID) (*DiscountRule, error)
+}
+
+type DiscountRuleLister interface {
+	ListDiscountRules(ctx context.Context) ([]*DiscountRule, error)
+}
+
+// AutomaticDiscountLister returns the active rules that need no coupon and
+// whose dates include on.
+type AutomaticDiscountLister interface {
+	GetAutomaticDiscountRules(ctx context.Context, on time.Time) ([]*DiscountRule, error)
+}
+
+type DiscountRuleCreator interface {
+	CreateDiscountRule(ctx context.Context, rule DiscountRule) (*DiscountRule, error)
+}
+
+type DiscountRuleUpdater interface {
+	UpdateDiscountRule(ctx context.Context, rule DiscountRule) (*DiscountRule, error)
+}
+
+type DiscountRuleDeleter interface {
+	DeleteDiscountRule(ctx context.Context, id uuid.UUID) error
+}
+
+type CouponManager interface {
+	CouponRetriever
+	CouponCodeRetriever
+	CouponLister
+	CouponCreator
+	CouponUpdater
+	CouponDeleter
+}
+
+type CouponRetriever interface {
+	GetCouponByID(ctx context.Context, id uuid.UUID) (*Coupon, error)
+}
+
+type CouponCodeRetriever interface {
+	GetCouponByCode(ctx context.Context, code string) (*Coupon, error)
+}
+
+type CouponLister interface {
+	GetCouponsByRuleID(ctx context.Context, ruleID uuid.UUID) ([]*Coupon, error)
+}
+
+// CouponCreator returns ErrDuplicateCoupon if the code is taken.
+type CouponCreator interface {
+	CreateCoupon(ctx context.Context, coupon Coupon) (*Coupon, error)
+}
+
+type CouponUpdater interface {
+	UpdateCoupon(ctx context.Context, coupon Coupon) (*Coupon, error)
+}
+
+type CouponDeleter interface {
+	DeleteCoupon(ctx context.Context, id uuid.UUID) error
+}
+
+type discountService struct {
+	repo DiscountRepository
+}
+
+func NewDiscountService(repo DiscountRepository) DiscountService {
+	return &discountService{repo: repo}
+}
+
+func (s *discountService) GetDiscountRuleByID(ctx context.Context, id uuid.UUID) (*DiscountRule, error) {
+	return s.repo.GetDiscountRuleByID(ctx, id)
+}
+
+func (s *discountService) ListDiscountRules(ctx context.Context) ([]*DiscountRule, error) {
+	return s.repo.ListDiscountRules(ctx)
+}
+
+func (s *discountService) CreateDiscountRule(ctx context.Context, rule DiscountRule) (*DiscountRule, error) {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateDiscountRule(ctx, rule)
+}
+
+func (s *discountService) UpdateDiscountRule(ctx context.Context, rule DiscountRule) (*DiscountRule, error) {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateDiscountRule(ctx, rule)
+}
+
+func (s *discountService) DeleteDiscountRule(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteDiscountRule(ctx, id)
+}
+
+func (s *discountService) GetCouponByID(ctx context.Context, id uuid.UUID) (*Coupon, error) {
+	return s.repo.GetCouponByID(ctx, id)
+}
+
+func (s *discountService) GetCouponByCode(ctx context.Context, code string) (*Coupon, error) {
+	return s.repo.GetCouponByCode(ctx, normalizeCouponCode(code))
+}
+
+func (s *discountService) GetCouponsByRuleID(ctx context.Context, ruleID uuid.UUID) ([]*Coupon, error) {
+	return s.repo.GetCouponsByRuleID(ctx, ruleID)
+}
+
+func (s *discountService) CreateCoupon(ctx context.Context, coupon Coupon) (*Coupon, error) {
+	coupon.Code = normalizeCouponCode(coupon.Code)
+	if err := coupon.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetDiscountRuleByID(ctx, coupon.RuleID); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateCoupon(ctx, coupon)
+}
+
+func (s *discountService) UpdateCoupon(ctx context.Context, coupon Coupon) (*Coupon, error) {
+	existing, err := s.repo.GetCouponByID(ctx, coupon.ID)
+	if err != nil {
+		return nil, err
+	}
+	// The code and rule are what past orders refer to, so only the limits
+	// can change.
+	coupon.Code, coupon.RuleID = existing.Code, existing.RuleID
+	if err := coupon.Validate(); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateCoupon(ctx, coupon)
+}
+
+func (s *discountService) DeleteCoupon(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteCoupon(ctx, id)
+}
+
+// WithDiscounts applies discount rules and coupons to orders. Without it
+// orders carry no discounts.
+func WithDiscounts(discounts DiscountSource) OrderServiceOption {
+	return func(s *orderService) {
+		s.discounts = discounts
+	}
+}
+
+// WithDiscountConversion converts fixed discount amounts, which are set in
+// the base currency, into the currency of each order at the rates of the
+// order date. Without it, fixed discounts on orders in another currency fail
+// with ErrNoExchangeRate.
+func WithDiscountConversion(rates CurrencyConverter) OrderServiceOption {
+	return func(s *orderService) {
+		s.rates = rates
+	}
+}
+
+// applyOrderDiscounts replaces the discounts on every line of a priced order
+// with those of the rules that apply to it. Coupons being redeemed must be
+// usable now; coupons already redeemed by the order keep applying for as
+// long as their rule is active on the order date.
+func (s *orderService) applyOrderDiscounts(ctx context.Context, order *Order, redeeming bool) error {
+	for i := range order.OrderItems {
+		order.OrderItems[i].Discount = core.Zero(order.OrderItems[i].UnitPrice.Currency())
+		order.OrderItems[i].Discounts = nil
+	}
+	if s.discounts == nil {
+		if len(order.CouponCodes) > 0 {
+			return fmt.Errorf("%w: coupons are not enabled", ErrCouponUnavailable)
+		}
+		return nil
+	}
+
+	var firstOrder *bool
+	isFirstOrder := func() (bool, error) {
+		if firstOrder == nil {
+			first, err := s.isFirstOrder(ctx, *order)
+			if err != nil {
+				return false, err
+			}
+			firstOrder = &first
+		}
+		return *firstOrder, nil
+	}
+	seen := make(map[uuid.UUID]bool)
+	var eligible []eligibleDiscount
+
+	rules, err := s.discounts.GetAutomaticDiscountRules(ctx, order.OrderDate)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if rule.RequiresCoupon || !rule.activeOn(order.OrderDate) || seen[rule.ID] {
+			continue
+		}
+		if rule.FirstEngagementOnly {
+			if first, err := isFirstOrder(); err != nil {
+				return err
+			} else if !first {
+				continue
+			}
+		}
+		seen[rule.ID] = true
+		eligible = append(eligible, eligibleDiscount{rule: *rule})
+	}
+
+	for _, code := range order.CouponCodes {
+		coupon, err := s.discounts.GetCouponByCode(ctx, code)
+		if errors.Is(err, ErrCouponNotFound) {
+			return fmt.Errorf("%w: %s does not exist", ErrCouponUnavailable, code)
+		}
+		if err != nil {
+			return err
+		}
+		if redeeming && !coupon.usableAt(s.now()) {
+			return fmt.Errorf("%w: %s has expired or been used up", ErrCouponUnavailable, code)
+		}
+		rule, err := s.discounts.GetDiscountRuleByID(ctx, coupon.RuleID)
+		if err != nil {
+			return err
+		}
+		if !rule.activeOn(order.OrderDate) {
+			return fmt.Errorf("%w: the %s promotion is not running", ErrCouponUnavailable, code)
+		}
+		if rule.FirstEngagementOnly {
+			if first, err := isFirstOrder(); err != nil {
+				return err
+			} else if !first {
+				return fmt.Errorf("%w: %s is for first orders only", ErrCouponUnavailable, code)
+			}
+		}
+		if seen[rule.ID] {
+			continue
+		}
+		seen[rule.ID] = true
+		eligible = append(eligible, eligibleDiscount{rule: *rule, couponCode: coupon.Code})
+	}
+
+	currency := currencyOf(order.OrderItems[0].UnitPrice)
+	for i := range eligible {
+		rule := &eligible[i].rule
+		if rule.Type != DiscountTypeFixedAmount || currencyOf(rule.Amount) == currency {
+			continue
+		}
+		if s.rates == nil {
+			return fmt.Errorf("%w: the %s discount is not converted to %s", ErrNoExchangeRate, rule.Name, currency)
+		}
+		if rule.Amount, err = s.rates.Convert(rule.Amount, currency, order.OrderDate); err != nil {
+			return err
+		}
+	}
+
+	lines := make([]discountLine, len(order.OrderItems))
+	for i, item := range order.OrderItems {
+		gross, err := item.UnitPrice.Times(int64(item.Quantity))
+		if err != nil {
+			return err
+		}
+		lines[i] = discountLine{ProductID: item.ProductID, Quantity: item.Quantity, Gross: gross}
+	}
+	applied, err := applyDiscounts(lines, eligible)
+	if err != nil {
+		return err
+	}
+	for i := range order.OrderItems {
+		item := &order.OrderItems[i]
+		item.Discounts = applied[i]
+		for _, discount := range applied[i] {
+			if item.Discount, err = item.Discount.Add(discount.Amount); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isFirstOrder reports whether the customer has no other order that was
+// not cancelled.
+func (s *orderService) isFirstOrder(ctx context.Context, order Order) (bool, error) {
+	orders, err := s.repo.GetOrdersByCustomerID(ctx, order.CustomerID)
+	if err != nil {
+		return false, err
+	}
+	for _, other := range orders {
+		if order.ID != uuid.Nil && other.ID == order.ID {
+			continue
+		}
+		if other.Status != OrderStatusCancelled {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// normalizeCouponCodes uppercases codes and drops blanks and repeats.
+func normalizeCouponCodes(codes []string) []string {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		code = normalizeCouponCode(code)
+		if code == "" || seen[code] {
+			continue
+		}
+		seen[code] = true
+		normalized = append(normalized, code)
+	}
+	return normalized
+}
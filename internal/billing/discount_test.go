@@ -0,0 +1,267 @@
+package billing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockDiscountSource struct {
+	mock.Mock
+}
+
+func (m *MockDiscountSource) GetAutomaticDiscountRules(ctx context.Context, on time.Time) ([]*DiscountRule, error) {
+	args := m.Called(ctx, on)
+	rules, _ := args.Get(0).([]*DiscountRule)
+	return rules, args.Error(1)
+}
+
+func (m *MockDiscountSource) GetDiscountRuleByID(ctx context.Context, id uuid.UUID) (*DiscountRule, error) {
+	args := m.Called(ctx, id)
+	rule, _ := args.Get(0).(*DiscountRule)
+	return rule, args.Error(1)
+}
+
+func (m *MockDiscountSource) GetCouponByCode(ctx context.Context, code string) (*Coupon, error) {
+	args := m.Called(ctx, code)
+	coupon, _ := args.Get(0).(*Coupon)
+	return coupon, args.Error(1)
+}
+
+func discountRule(name string, typ DiscountType, scope DiscountScope, priority int) DiscountRule {
+	rule := DiscountRule{Name: name, Type: typ, Scope: scope, Priority: priority, IsActive: true}
+	rule.ID = uuid.New()
+	return rule
+}
+
+func TestApplyDiscounts_OrderRuleAllocatedByRemainingAmount(t *testing.T) {
+	// Arrange
+	lines := []discountLine{
+		{ProductID: uuid.New(), Quantity: 1, Gross: usd("100.00")},
+		{ProductID: uuid.New(), Quantity: 1, Gross: usd("50.00")},
+		{ProductID: uuid.New(), Quantity: 1, Gross: usd("50.00")},
+	}
+	welcome := discountRule("Welcome", DiscountTypeFixedAmount, DiscountScopeOrder, 0)
+	welcome.Amount = usd("10.00")
+
+	// Act
+	applied, err := applyDiscounts(lines, []eligibleDiscount{{rule: welcome}})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, usd("5.00"), applied[0][0].Amount)
+	assert.Equal(t, usd("2.50"), applied[1][0].Amount)
+	assert.Equal(t, usd("2.50"), applied[2][0].Amount)
+}
+
+func TestApplyDiscounts_RulesCompoundInPriorityOrder(t *testing.T) {
+	// Arrange
+	lines := []discountLine{{ProductID: uuid.New(), Quantity: 2, Gross: usd("200.00")}}
+	perUnit := discountRule("Ten off each", DiscountTypeFixedAmount, DiscountScopeLine, 1)
+	perUnit.Amount = usd("10.00")
+	percent := discountRule("Spring sale", DiscountTypePercentage, DiscountScopeOrder, 2)
+	percent.Percentage = 12.5
+
+	// Act: given in the wrong order, applied by priority
+	applied, err := applyDiscounts(lines, []eligibleDiscount{{rule: percent}, {rule: perUnit, couponCode: "TENOFF"}})
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, applied[0], 2)
+	assert.Equal(t, AppliedDiscount{RuleID: perUnit.ID, RuleName: "Ten off each", CouponCode: "TENOFF", Amount: usd("20.00")}, applied[0][0])
+	assert.Equal(t, usd("22.50"), applied[0][1].Amount) // 12.5% of 180.00
+}
+
+func TestApplyDiscounts_TiesBrokenByScopeThenName(t *testing.T) {
+	// Arrange
+	lines := []discountLine{{ProductID: uuid.New(), Quantity: 1, Gross: usd("100.00")}}
+	order := discountRule("A order rule", DiscountTypePercentage, DiscountScopeOrder, 0)
+	order.Percentage = 10
+	b := discountRule("B line rule", DiscountTypePercentage, DiscountScopeLine, 0)
+	b.Percentage = 10
+	a := discountRule("A line rule", DiscountTypePercentage, DiscountScopeLine, 0)
+	a.Percentage = 50
+
+	// Act
+	applied, err := applyDiscounts(lines, []eligibleDiscount{{rule: order}, {rule: b}, {rule: a}})
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, applied[0], 3)
+	assert.Equal(t, []string{"A line rule", "B line rule", "A order rule"}, []string{applied[0][0].RuleName, applied[0][1].RuleName, applied[0][2].RuleName})
+	assert.Equal(t, usd("50.00"), applied[0][0].Amount)
+	assert.Equal(t, usd("5.00"), applied[0][1].Amount)
+	assert.Equal(t, usd("4.50"), applied[0][2].Amount)
+}
+
+type OrderDiscountTestSuite struct {
+	suite.Suite
+	orderRepo   *MockOrderRepository
+	productRepo *MockProductRepository
+	prices      *MockPriceResolver
+	discounts   *MockDiscountSource
+	now         time.Time
+	service     OrderService
+
+	customerID, productID uuid.UUID
+}
+
+func (s *OrderDiscountTestSuite) SetupTest() {
+	s.orderRepo = new(MockOrderRepository)
+	s.productRepo = new(MockProductRepository)
+	s.prices = new(MockPriceResolver)
+	s.discounts = new(MockDiscountSource)
+	s.now = time.Date(2026, 5, 4, 9, 30, 0, 0, time.UTC)
+	s.service = NewOrderService(s.orderRepo, s.productRepo, s.prices, new(MockAddressRetriever), WithDiscounts(s.discounts))
+	s.service.(*orderService).now = func() time.Time { return s.now }
+	s.customerID, s.productID = uuid.New(), uuid.New()
+}
+
+func (s *OrderDiscountTestSuite) TearDownTest() {
+	s.orderRepo.AssertExpectations(s.T())
+	s.discounts.AssertExpectations(s.T())
+}
+
+func TestOrderDiscountSuite(t *testing.T) {
+	suite.Run(t, new(OrderDiscountTestSuite))
+}
+
+// order arranges a one-line 200.00 order dated now carrying coupons.
+func (s *OrderDiscountTestSuite) order(ctx context.Context, automatic []*DiscountRule, coupons ...string) Order {
+	s.productRepo.On("GetProductByID", ctx, s.productID).Return(&Product{Name: "Due Diligence Review"}, nil)
+	s.prices.On("ResolvePrice", ctx, s.customerID, s.productID, s.now).Return(&ResolvedPrice{Price: usd("200.00")}, nil)
+	s.discounts.On("GetAutomaticDiscountRules", ctx, s.now).Return(automatic, nil)
+	return Order{CustomerID: s.customerID, OrderItems: []OrderItem{{ProductID: s.productID, Quantity: 1}}, CouponCodes: coupons}
+}
+
+func (s *OrderDiscountTestSuite) TestCreateOrder_FirstEngagementOnlyForNewCustomers() {
+	// Arrange
+	ctx := context.Background()
+	first := discountRule("First engagement", DiscountTypePercentage, DiscountScopeOrder, 0)
+	first.Percentage = 15
+	first.FirstEngagementOnly = true
+	input := s.order(ctx, []*DiscountRule{&first})
+	s.orderRepo.On("GetOrdersByCustomerID", ctx, s.customerID).Return([]*Order{{Status: OrderStatusDelivered}}, nil)
+
+	var saved Order
+	s.orderRepo.On("CreateOrder", ctx, mock.AnythingOfType("Order")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Order)
+	}).Return(&Order{}, nil)
+
+	// Act
+	_, err := s.service.CreateOrder(ctx, input)
+
+	// Assert
+	s.NoError(err)
+	s.True(saved.Discount.IsZero())
+	s.Empty(saved.OrderItems[0].Discounts)
+}
+
+func (s *OrderDiscountTestSuite) TestCreateOrder_CouponAppliesItsRule() {
+	// Arrange
+	ctx := context.Background()
+	rule := discountRule("Partner referral", DiscountTypeFixedAmount, DiscountScopeOrder, 0)
+	rule.Amount = usd("25.00")
+	rule.RequiresCoupon = true
+	max := 10
+	input := s.order(ctx, nil, " partner25 ", "PARTNER25")
+	s.discounts.On("GetCouponByCode", ctx, "PARTNER25").Return(&Coupon{Code: "PARTNER25", RuleID: rule.ID, MaxRedemptions: &max, Redemptions: 9, IsActive: true}, nil).Once()
+	s.discounts.On("GetDiscountRuleByID", ctx, rule.ID).Return(&rule, nil).Once()
+
+	var saved Order
+	s.orderRepo.On("CreateOrder", ctx, mock.AnythingOfType("Order")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Order)
+	}).Return(&Order{}, nil)
+
+	// Act
+	_, err := s.service.CreateOrder(ctx, input)
+
+	// Assert
+	s.NoError(err)
+	s.Equal([]string{"PARTNER25"}, saved.CouponCodes)
+	s.Equal(usd("25.00"), saved.Discount)
+	s.Equal(usd("175.00"), saved.Total)
+	s.Equal("PARTNER25", saved.OrderItems[0].Discounts[0].CouponCode)
+}
+
+func (s *OrderDiscountTestSuite) TestCreateOrder_RejectsUsedUpAndExpiredCoupons() {
+	ctx := context.Background()
+	ruleID := uuid.New()
+	max := 10
+	expired := s.now.Add(-time.Minute)
+	cases := map[string]*Coupon{
+		"USEDUP":  {Code: "USEDUP", RuleID: ruleID, MaxRedemptions: &max, Redemptions: 10, IsActive: true},
+		"EXPIRED": {Code: "EXPIRED", RuleID: ruleID, ExpiresAt: &expired, IsActive: true},
+		"OFF":     {Code: "OFF", RuleID: ruleID},
+	}
+	for code, coupon := range cases {
+		s.Run(code, func() {
+			// Arrange
+			input := s.order(ctx, nil, code)
+			s.discounts.On("GetCouponByCode", ctx, code).Return(coupon, nil)
+
+			// Act
+			result, err := s.service.CreateOrder(ctx, input)
+
+			// Assert
+			s.ErrorIs(err, ErrCouponUnavailable)
+			s.Nil(result)
+		})
+	}
+}
+
+func (s *OrderDiscountTestSuite) TestUpdateOrder_KeepsRedeemedCoupon() {
+	// Arrange
+	ctx := context.Background()
+	orderID := uuid.New()
+	rule := discountRule("Partner referral", DiscountTypePercentage, DiscountScopeOrder, 0)
+	rule.Percentage = 10
+	rule.RequiresCoupon = true
+	max := 1
+	input := s.order(ctx, nil)
+	input.ID = orderID
+	input.OrderDate = s.now
+	input.CouponCodes = []string{"SNEAKY"} // ignored on update
+
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(&Order{CustomerID: s.customerID, Status: OrderStatusPending, OrderDate: s.now, CouponCodes: []string{"ONCE"}}, nil)
+	// The order's own redemption uses up the coupon; that must not stop repricing.
+	s.discounts.On("GetCouponByCode", ctx, "ONCE").Return(&Coupon{Code: "ONCE", RuleID: rule.ID, MaxRedemptions: &max, Redemptions: 1, IsActive: true}, nil)
+	s.discounts.On("GetDiscountRuleByID", ctx, rule.ID).Return(&rule, nil)
+	var saved Order
+	s.orderRepo.On("UpdateOrder", ctx, mock.AnythingOfType("Order")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Order)
+	}).Return(&Order{}, nil)
+
+	// Act
+	_, err := s.service.UpdateOrder(ctx, input)
+
+	// Assert
+	s.NoError(err)
+	s.Equal([]string{"ONCE"}, saved.CouponCodes)
+	s.Equal(usd("20.00"), saved.Discount)
+}
+
+func TestDiscountRule_Validate(t *testing.T) {
+	productID := uuid.New()
+	cases := map[string]DiscountRule{
+		"no name":             {Type: DiscountTypePercentage, Scope: DiscountScopeOrder, Percentage: 10},
+		"percentage too high": {Name: "x", Type: DiscountTypePercentage, Scope: DiscountScopeOrder, Percentage: 100.5},
+		"percentage too fine": {Name: "x", Type: DiscountTypePercentage, Scope: DiscountScopeOrder, Percentage: 12.345},
+		"zero amount":         {Name: "x", Type: DiscountTypeFixedAmount, Scope: DiscountScopeLine, Amount: core.Zero(core.USD)},
+		"order rule product":  {Name: "x", Type: DiscountTypePercentage, Scope: DiscountScopeOrder, Percentage: 10, ProductID: &productID},
+		"unknown scope":       {Name: "x", Type: DiscountTypePercentage, Scope: "customer", Percentage: 10},
+	}
+	for name, rule := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, rule.Validate(), ErrInvalidDiscountRule)
+		})
+	}
+}
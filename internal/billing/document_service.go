@@ -0,0 +1,258 @@
+package billing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+)
+
+type DocumentService interface {
+	InvoicePDFRenderer
+	QuotePDFRenderer
+	StatementBuilder
+	StatementPDFRenderer
+}
+
+type InvoicePDFRenderer interface {
+	RenderInvoice(ctx context.Context, invoiceID uuid.UUID) (*RenderedDocument, error)
+}
+
+type QuotePDFRenderer interface {
+	RenderQuote(ctx context.Context, quoteID uuid.UUID) (*RenderedDocument, error)
+}
+
+type StatementBuilder interface {
+	BuildStatement(ctx context.Context, customerID uuid.UUID, from, to time.Time) (*Statement, error)
+}
+
+type StatementPDFRenderer interface {
+	RenderStatement(ctx context.Context, customerID uuid.UUID, from, to time.Time) (*RenderedDocument, error)
+}
+
+// RenderedDocument is a generated file ready to be served.
+type RenderedDocument struct {
+	Filename string
+	Content  []byte
+}
+
+type documentService struct {
+	invoices   InvoiceReader
+	quotes     QuoteRetriever
+	payments   PaymentLister
+	customers  customers.CustomerRetriever
+	addresses  customers.AddressReader
+	letterhead Letterhead
+}
+
+func NewDocumentService(invoices InvoiceReader, quotes QuoteRetriever, payments PaymentLister, customers customers.CustomerRetriever, addresses customers.AddressReader, letterhead Letterhead) DocumentService {
+	return &documentService{
+		invoices:   invoices,
+		quotes:     quotes,
+		payments:   payments,
+		customers:  customers,
+		addresses:  addresses,
+		letterhead: letterhead,
+	}
+}
+
+// RenderInvoice renders an invoice or credit note, billed to the invoice's
+// billing address or, failing that, the customer's default billing address.
+func (s *documentService) RenderInvoice(ctx context.Context, invoiceID uuid.UUID) (*RenderedDocument, error) {
+	invoice, err := s.invoices.GetInvoiceByID(ctx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	customer, err := s.customers.GetCustomerByID(ctx, invoice.CustomerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load customer: %w", err)
+	}
+	billTo, err := s.billingAddress(ctx, invoice.CustomerID, invoice.BillingAddressID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := RenderInvoicePDF(&buf, s.letterhead, InvoiceDocument{Invoice: *invoice, Customer: customer, BillTo: billTo}); err != nil {
+		return nil, err
+	}
+	name := invoice.InvoiceNumber
+	if name == "" {
+		name = "draft-" + invoice.ID.String()
+	}
+	return &RenderedDocument{Filename: name + ".pdf", Content: buf.Bytes()}, nil
+}
+
+// RenderQuote renders one version of a quote, addressed like an invoice.
+func (s *documentService) RenderQuote(ctx context.Context, quoteID uuid.UUID) (*RenderedDocument, error) {
+	quote, err := s.quotes.GetQuoteByID(ctx, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	customer, err := s.customers.GetCustomerByID(ctx, quote.CustomerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load customer: %w", err)
+	}
+	billTo, err := s.billingAddress(ctx, quote.CustomerID, quote.BillingAddressID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := RenderQuotePDF(&buf, s.letterhead, QuoteDocument{Quote: *quote, Customer: customer, BillTo: billTo}); err != nil {
+		return nil, err
+	}
+	return &RenderedDocument{Filename: fmt.Sprintf("%s-v%d.pdf", quote.QuoteNumber, quote.Version), Content: buf.Bytes()}, nil
+}
+
+// BuildStatement collects the customer's invoices still open at the end of
+// the period and the payments received during it. from and to are dates and
+// both are included. Open invoices are restated as they stood at the end of
+// the period, counting only the payments applied and credit notes issued by
+// then, so a statement reads the same however long after the period it is
+// built.
+func (s *documentService) BuildStatement(ctx context.Context, customerID uuid.UUID, from, to time.Time) (*Statement, error) {
+	from, to = dateOnly(from), dateOnly(to)
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: period ends before it starts", ErrInvalidPeriod)
+	}
+	customer, err := s.customers.GetCustomerByID(ctx, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load customer: %w", err)
+	}
+	billTo, err := s.billingAddress(ctx, customerID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &Statement{Customer: customer, BillTo: billTo, From: from, To: to}
+	end := to.AddDate(0, 0, 1)
+
+	invoices, err := s.invoices.GetInvoicesByCustomerID(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := s.payments.GetPaymentsByCustomerID(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	paid := make(map[uuid.UUID]core.Money)
+	for _, payment := range payments {
+		for _, application := range payment.Applications {
+			if application.InvoiceID == nil || !application.CreatedAt.Before(end) {
+				continue
+			}
+			if paid[*application.InvoiceID], err = paid[*application.InvoiceID].Add(application.Amount); err != nil {
+				return nil, err
+			}
+		}
+	}
+	credited := make(map[uuid.UUID]core.Money)
+	for _, note := range invoices {
+		if note.Kind != InvoiceKindCreditNote || note.CreditedInvoiceID == nil || note.IssueDate == nil || !note.IssueDate.Before(end) {
+			continue
+		}
+		if credited[*note.CreditedInvoiceID], err = credited[*note.CreditedInvoiceID].Add(note.Total); err != nil {
+			return nil, err
+		}
+	}
+
+	var balanceDue core.Money
+	for _, invoice := range invoices {
+		if invoice.Kind != InvoiceKindInvoice || invoice.IssueDate == nil || !invoice.IssueDate.Before(end) {
+			continue
+		}
+		if invoice.Status == InvoiceStatusVoid && (invoice.VoidedAt == nil || invoice.VoidedAt.Before(end)) {
+			continue
+		}
+		restated := *invoice
+		zero := core.Zero(invoice.Total.Currency())
+		if restated.AmountPaid, err = zero.Add(paid[invoice.ID]); err != nil {
+			return nil, err
+		}
+		if restated.AmountCredited, err = zero.Add(credited[invoice.ID]); err != nil {
+			return nil, err
+		}
+		balance, err := restated.Balance()
+		if err != nil {
+			return nil, err
+		}
+		if !balance.IsPositive() {
+			continue
+		}
+		restated.Status, restated.PaidAt, restated.VoidedAt = InvoiceStatusSent, nil, nil
+		if restated.AmountPaid.IsPositive() {
+			restated.Status = InvoiceStatusPartiallyPaid
+		}
+		if balanceDue, err = balanceDue.Add(balance); err != nil {
+			return nil, err
+		}
+		statement.OpenInvoices = append(statement.OpenInvoices, &restated)
+	}
+	sort.SliceStable(statement.OpenInvoices, func(i, j int) bool {
+		return statement.OpenInvoices[i].IssueDate.Before(*statement.OpenInvoices[j].IssueDate)
+	})
+	statement.BalanceDue = balanceDue
+
+	for _, payment := range payments {
+		if payment.Status != PaymentStatusCompleted || payment.PaymentDate.Before(from) || !payment.PaymentDate.Before(end) {
+			continue
+		}
+		statement.Payments = append(statement.Payments, payment)
+	}
+	sort.SliceStable(statement.Payments, func(i, j int) bool {
+		return statement.Payments[i].PaymentDate.Before(statement.Payments[j].PaymentDate)
+	})
+	return statement, nil
+}
+
+func (s *documentService) RenderStatement(ctx context.Context, customerID uuid.UUID, from, to time.Time) (*RenderedDocument, error) {
+	statement, err := s.BuildStatement(ctx, customerID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := RenderStatementPDF(&buf, s.letterhead, *statement); err != nil {
+		return nil, err
+	}
+	return &RenderedDocument{
+		Filename: fmt.Sprintf("statement-%s.pdf", statement.To.Format("2006-01")),
+		Content:  buf.Bytes(),
+	}, nil
+}
+
+// billingAddress loads the given address, or the customer's default billing
+// address when id is nil. A customer without one gets no address block.
+func (s *documentService) billingAddress(ctx context.Context, customerID uuid.UUID, id *uuid.UUID) (*customers.Address, error) {
+	if id != nil {
+		address, err := s.addresses.GetAddressByID(ctx, *id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load billing address: %w", err)
+		}
+		return address, nil
+	}
+	addresses, err := s.addresses.GetAddressesByCustomerID(ctx, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load billing address: %w", err)
+	}
+	var fallback *customers.Address
+	for _, address := range addresses {
+		if address.Type != customers.AddressTypeBilling {
+			continue
+		}
+		if address.IsDefault {
+			return address, nil
+		}
+		if fallback == nil {
+			fallback = address
+		}
+	}
+	return fallback, nil
+}
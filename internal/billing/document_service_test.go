@@ -0,0 +1,225 @@
+package billing
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+type DocumentServiceTestSuite struct {
+	suite.Suite
+	invoiceRepo *MockInvoiceRepository
+	quoteRepo   *MockQuoteRepository
+	paymentRepo *MockPaymentRepository
+	customers   *MockCustomerRetriever
+	addresses   *MockAddressRetriever
+	service     DocumentService
+}
+
+func (s *DocumentServiceTestSuite) SetupTest() {
+	s.invoiceRepo = new(MockInvoiceRepository)
+	s.quoteRepo = new(MockQuoteRepository)
+	s.paymentRepo = new(MockPaymentRepository)
+	s.customers = new(MockCustomerRetriever)
+	s.addresses = new(MockAddressRetriever)
+	s.service = NewDocumentService(s.invoiceRepo, s.quoteRepo, s.paymentRepo, s.customers, s.addresses, Letterhead{
+		Name:                "RVA Business Law",
+		AddressLines:        []string{"100 E Main St", "Richmond, VA 23219"},
+		PaymentInstructions: []string{"ACH: routing 000000000, account 0000000"},
+	})
+}
+
+func (s *DocumentServiceTestSuite) TearDownTest() {
+	s.invoiceRepo.AssertExpectations(s.T())
+	s.quoteRepo.AssertExpectations(s.T())
+	s.paymentRepo.AssertExpectations(s.T())
+	s.customers.AssertExpectations(s.T())
+	s.addresses.AssertExpectations(s.T())
+}
+
+func TestDocumentServiceSuite(t *testing.T) {
+	suite.Run(t, new(DocumentServiceTestSuite))
+}
+
+func date(year int, month time.Month, day int) *time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func (s *DocumentServiceTestSuite) TestBuildStatement_ListsOpenInvoicesAndPaymentsInPeriod() {
+	// Arrange
+	ctx := context.Background()
+	customerID := uuid.New()
+	billing := &customers.Address{Type: customers.AddressTypeBilling, IsDefault: true, City: "Richmond"}
+	open := &Invoice{BaseModel: core.BaseModel{ID: uuid.New()}, InvoiceNumber: "INV-000002", Kind: InvoiceKindInvoice, Status: InvoiceStatusPartiallyPaid, IssueDate: date(2026, 5, 20), Total: usd("500.00"), AmountPaid: usd("200.00")}
+	older := &Invoice{BaseModel: core.BaseModel{ID: uuid.New()}, InvoiceNumber: "INV-000001", Kind: InvoiceKindInvoice, Status: InvoiceStatusSent, IssueDate: date(2026, 4, 2), Total: usd("75.00")}
+	future := &Invoice{BaseModel: core.BaseModel{ID: uuid.New()}, InvoiceNumber: "INV-000003", Kind: InvoiceKindInvoice, Status: InvoiceStatusSent, IssueDate: date(2026, 6, 1), Total: usd("90.00")}
+	paid := &Invoice{BaseModel: core.BaseModel{ID: uuid.New()}, InvoiceNumber: "INV-000000", Kind: InvoiceKindInvoice, Status: InvoiceStatusPaid, IssueDate: date(2026, 5, 2), Total: usd("10.00"), AmountPaid: usd("10.00")}
+	inPeriod := &Payment{Status: PaymentStatusCompleted, PaymentDate: time.Date(2026, 5, 31, 18, 0, 0, 0, time.UTC), Amount: usd("200.00"), Applications: []PaymentApplication{
+		{BaseModel: core.BaseModel{CreatedAt: time.Date(2026, 5, 31, 18, 0, 0, 0, time.UTC)}, InvoiceID: &open.ID, Amount: usd("200.00")},
+	}}
+	failed := &Payment{Status: PaymentStatusFailed, PaymentDate: time.Date(2026, 5, 10, 0, 0, 0, 0, time.UTC), Amount: usd("50.00")}
+	earlier := &Payment{Status: PaymentStatusCompleted, PaymentDate: time.Date(2026, 5, 2, 0, 0, 0, 0, time.UTC), Amount: usd("10.00"), Applications: []PaymentApplication{
+		{BaseModel: core.BaseModel{CreatedAt: time.Date(2026, 5, 2, 9, 0, 0, 0, time.UTC)}, InvoiceID: &paid.ID, Amount: usd("10.00")},
+	}}
+	before := &Payment{Status: PaymentStatusCompleted, PaymentDate: time.Date(2026, 4, 30, 0, 0, 0, 0, time.UTC), Amount: usd("10.00")}
+
+	s.customers.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{CompanyName: "Acme LLC"}, nil)
+	s.addresses.On("GetAddressesByCustomerID", ctx, customerID).Return([]*customers.Address{{Type: customers.AddressTypeShipping}, billing}, nil)
+	s.invoiceRepo.On("GetInvoicesByCustomerID", ctx, customerID).Return([]*Invoice{future, open, paid, older}, nil)
+	s.paymentRepo.On("GetPaymentsByCustomerID", ctx, customerID).Return([]*Payment{inPeriod, failed, earlier, before}, nil)
+
+	// Act
+	statement, err := s.service.BuildStatement(ctx, customerID, *date(2026, 5, 1), *date(2026, 5, 31))
+
+	// Assert
+	s.Require().NoError(err)
+	s.Equal(billing, statement.BillTo)
+	s.Require().Len(statement.OpenInvoices, 2)
+	s.Equal("INV-000001", statement.OpenInvoices[0].InvoiceNumber)
+	s.Equal("INV-000002", statement.OpenInvoices[1].InvoiceNumber)
+	s.Equal(usd("200.00"), statement.OpenInvoices[1].AmountPaid)
+	s.Equal([]*Payment{earlier, inPeriod}, statement.Payments)
+	s.Equal(usd("375.00"), statement.BalanceDue)
+}
+
+func (s *DocumentServiceTestSuite) TestBuildStatement_RestatesInvoicesSettledAfterThePeriod() {
+	// Arrange
+	ctx := context.Background()
+	customerID := uuid.New()
+	settled := &Invoice{BaseModel: core.BaseModel{ID: uuid.New()}, InvoiceNumber: "INV-000004", Kind: InvoiceKindInvoice, Status: InvoiceStatusPaid, IssueDate: date(2026, 5, 10), Total: usd("300.00"), AmountPaid: usd("200.00"), AmountCredited: usd("100.00"), PaidAt: &time.Time{}}
+	note := &Invoice{InvoiceNumber: "CN-000001", Kind: InvoiceKindCreditNote, CreditedInvoiceID: &settled.ID, Status: InvoiceStatusSent, IssueDate: date(2026, 5, 28), Total: usd("100.00")}
+	voidedLater := &Invoice{BaseModel: core.BaseModel{ID: uuid.New()}, InvoiceNumber: "INV-000005", Kind: InvoiceKindInvoice, Status: InvoiceStatusVoid, IssueDate: date(2026, 5, 12), Total: usd("40.00"), VoidedAt: date(2026, 6, 3)}
+	voided := &Invoice{BaseModel: core.BaseModel{ID: uuid.New()}, InvoiceNumber: "INV-000006", Kind: InvoiceKindInvoice, Status: InvoiceStatusVoid, IssueDate: date(2026, 5, 12), Total: usd("60.00"), VoidedAt: date(2026, 5, 20)}
+	june := &Payment{Status: PaymentStatusCompleted, PaymentDate: time.Date(2026, 6, 4, 0, 0, 0, 0, time.UTC), Amount: usd("200.00"), Applications: []PaymentApplication{
+		{BaseModel: core.BaseModel{CreatedAt: time.Date(2026, 6, 4, 0, 0, 0, 0, time.UTC)}, InvoiceID: &settled.ID, Amount: usd("200.00")},
+	}}
+
+	s.customers.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{CompanyName: "Acme LLC"}, nil)
+	s.addresses.On("GetAddressesByCustomerID", ctx, customerID).Return([]*customers.Address{}, nil)
+	s.invoiceRepo.On("GetInvoicesByCustomerID", ctx, customerID).Return([]*Invoice{settled, note, voidedLater, voided}, nil)
+	s.paymentRepo.On("GetPaymentsByCustomerID", ctx, customerID).Return([]*Payment{june}, nil)
+
+	// Act
+	statement, err := s.service.BuildStatement(ctx, customerID, *date(2026, 5, 1), *date(2026, 5, 31))
+
+	// Assert
+	s.Require().NoError(err)
+	s.Require().Len(statement.OpenInvoices, 2)
+	restated := statement.OpenInvoices[0]
+	s.Equal("INV-000004", restated.InvoiceNumber)
+	s.Equal(InvoiceStatusSent, restated.Status)
+	s.True(restated.AmountPaid.IsZero())
+	s.Equal(usd("100.00"), restated.AmountCredited)
+	s.Nil(restated.PaidAt)
+	s.Equal(InvoiceStatusPaid, settled.Status, "the stored invoice is left as it is")
+	s.Equal("INV-000005", statement.OpenInvoices[1].InvoiceNumber)
+	s.Empty(statement.Payments)
+	s.Equal(usd("240.00"), statement.BalanceDue)
+}
+
+func (s *DocumentServiceTestSuite) TestBuildStatement_RejectsInvertedPeriod() {
+	// Act
+	statement, err := s.service.BuildStatement(context.Background(), uuid.New(), *date(2026, 5, 31), *date(2026, 5, 1))
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidPeriod)
+	s.Nil(statement)
+}
+
+func (s *DocumentServiceTestSuite) TestRenderInvoice_UsesInvoiceBillingAddress() {
+	// Arrange
+	ctx := context.Background()
+	invoiceID, customerID, addressID := uuid.New(), uuid.New(), uuid.New()
+	invoice := &Invoice{
+		InvoiceNumber:    "INV-000010",
+		Kind:             InvoiceKindInvoice,
+		CustomerID:       customerID,
+		Status:           InvoiceStatusSent,
+		PaymentTerms:     PaymentTermsNet15,
+		IssueDate:        date(2026, 6, 1),
+		DueDate:          date(2026, 6, 16),
+		BillingAddressID: &addressID,
+		SubTotal:         usd("1250.00"),
+		Total:            usd("1250.00"),
+		Items:            []InvoiceItem{{Description: "Entity formation (flat fee)", Quantity: 1, UnitPrice: usd("1250.00"), Total: usd("1250.00")}},
+	}
+
+	s.invoiceRepo.On("GetInvoiceByID", ctx, invoiceID).Return(invoice, nil)
+	s.customers.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{FirstName: "Dana", LastName: "Reyes"}, nil)
+	s.addresses.On("GetAddressByID", ctx, addressID).Return(&customers.Address{Street1: "1 Main St", City: "Richmond", State: "VA", PostalCode: "23219"}, nil)
+
+	// Act
+	document, err := s.service.RenderInvoice(ctx, invoiceID)
+
+	// Assert
+	s.NoError(err)
+	s.Equal("INV-000010.pdf", document.Filename)
+	s.True(bytes.HasPrefix(document.Content, []byte("%PDF-1.4")))
+	s.Contains(string(document.Content), "/Title (INVOICE INV-000010)")
+}
+
+func (s *DocumentServiceTestSuite) TestRenderQuote_NamesFileAfterVersion() {
+	// Arrange
+	ctx := context.Background()
+	quoteID, customerID := uuid.New(), uuid.New()
+	quote := &Quote{
+		QuoteNumber: "QUO-000007",
+		Version:     2,
+		CustomerID:  customerID,
+		Status:      QuoteStatusSent,
+		ValidUntil:  *date(2026, 6, 30),
+		SubTotal:    usd("1500.00"),
+		Total:       usd("1500.00"),
+		Items:       []QuoteItem{{Description: "Due diligence review", Quantity: 1, UnitPrice: usd("1500.00"), Total: usd("1500.00")}},
+	}
+
+	s.quoteRepo.On("GetQuoteByID", ctx, quoteID).Return(quote, nil)
+	s.customers.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{CompanyName: "Acme LLC"}, nil)
+	s.addresses.On("GetAddressesByCustomerID", ctx, customerID).Return(nil, nil)
+
+	// Act
+	document, err := s.service.RenderQuote(ctx, quoteID)
+
+	// Assert
+	s.NoError(err)
+	s.Equal("QUO-000007-v2.pdf", document.Filename)
+	s.True(bytes.HasPrefix(document.Content, []byte("%PDF-1.4")))
+	s.Contains(string(document.Content), "/Title (Quote QUO-000007 v2)")
+}
+
+func (s *DocumentServiceTestSuite) TestRenderStatementPDF_FlowsLongTablesOntoNewPages() {
+	// Arrange
+	statement := Statement{
+		Customer:   customers.Customer{CompanyName: "Acme LLC"},
+		From:       *date(2026, 5, 1),
+		To:         *date(2026, 5, 31),
+		BalanceDue: usd("6000.00"),
+	}
+	for i := 0; i < 60; i++ {
+		statement.OpenInvoices = append(statement.OpenInvoices, &Invoice{InvoiceNumber: "INV", Kind: InvoiceKindInvoice, Status: InvoiceStatusSent, Total: usd("100.00")})
+	}
+	var buf bytes.Buffer
+
+	// Act
+	err := RenderStatementPDF(&buf, Letterhead{Name: "RVA Business Law"}, statement)
+
+	// Assert
+	s.NoError(err)
+	s.Contains(buf.String(), "/Count 2")
+}
+
+func (s *DocumentServiceTestSuite) TestFormatAmount_GroupsThousands() {
+	s.Equal("0.00", formatAmount(usd("0")))
+	s.Equal("999.99", formatAmount(usd("999.99")))
+	s.Equal("1,234,567.50", formatAmount(usd("1234567.5")))
+	s.Equal("-12,000.00", formatAmount(usd("-12000")))
+	s.Equal("USD 1,000.00", formatMoney(usd("1000")))
+}
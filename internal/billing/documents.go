@@ -0,0 +1,543 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+	"rva_crm/internal/pdf"
+)
+
+var ErrInvalidPeriod = errors.New("invalid statement period")
+
+// Letterhead is the firm identity and payment instructions printed on every
+// invoice and statement.
+type Letterhead struct {
+	Name                string   `json:"name"`
+	AddressLines        []string `json:"address_lines"`
+	Phone               string   `json:"phone"`
+	Email               string   `json:"email"`
+	Website             string   `json:"website"`
+	PaymentInstructions []string `json:"payment_instructions"`
+}
+
+// InvoiceDocument is everything printed on an invoice PDF.
+type InvoiceDocument struct {
+	Invoice  Invoice
+	Customer customers.Customer
+	BillTo   *customers.Address
+}
+
+// QuoteDocument is everything printed on a quote PDF.
+type QuoteDocument struct {
+	Quote    Quote
+	Customer customers.Customer
+	BillTo   *customers.Address
+}
+
+// Statement lists a customer's open invoices and the payments received
+// during a period.
+type Statement struct {
+	Customer     customers.Customer `json:"customer"`
+	BillTo       *customers.Address `json:"bill_to"`
+	From         time.Time          `json:"from"`
+	To           time.Time          `json:"to"`
+	OpenInvoices []*Invoice         `json:"open_invoices"`
+	Payments     []*Payment         `json:"payments"`
+	BalanceDue   core.Money         `json:"balance_due"`
+}
+
+const (
+	marginLeft   = 40.0
+	marginRight  = pdf.PageWidth - 40.0
+	pageBottom   = pdf.PageHeight - 72.0
+	rowHeight    = 16.0
+	bodySize     = 10.0
+	smallSize    = 8.5
+	headingSize  = 20.0
+	tableHeadGap = 6.0
+)
+
+// column is one column of a table; right-aligned columns are positioned by
+// their right edge.
+type column struct {
+	title string
+	x     float64
+	width float64
+	right bool
+}
+
+// pageWriter tracks the current page and vertical position so long tables
+// flow onto new pages with their header repeated.
+type pageWriter struct {
+	doc    *pdf.Document
+	page   *pdf.Page
+	y      float64
+	footer string
+	pages  int
+}
+
+func newPageWriter(doc *pdf.Document, footer string) *pageWriter {
+	w := &pageWriter{doc: doc, footer: footer}
+	w.newPage()
+	return w
+}
+
+func (w *pageWriter) newPage() {
+	w.page = w.doc.AddPage()
+	w.pages++
+	w.y = 50
+	w.page.Text(marginLeft, pdf.PageHeight-36, pdf.Helvetica, smallSize, fmt.Sprintf("%s - page %d", w.footer, w.pages))
+}
+
+// ensure starts a new page if height points will not fit above the bottom
+// margin, reporting whether it did.
+func (w *pageWriter) ensure(height float64) bool {
+	if w.y+height <= pageBottom {
+		return false
+	}
+	w.newPage()
+	return true
+}
+
+func (w *pageWriter) tableHeader(columns []column) {
+	w.page.FillRect(marginLeft, w.y, marginRight-marginLeft, rowHeight+2, 0.9)
+	baseline := w.y + rowHeight - 4
+	for _, c := range columns {
+		if c.right {
+			w.page.TextRight(c.x+c.width, baseline, pdf.HelveticaBold, smallSize, c.title)
+		} else {
+			w.page.Text(c.x, baseline, pdf.HelveticaBold, smallSize, c.title)
+		}
+	}
+	w.y += rowHeight + 2 + tableHeadGap
+}
+
+// tableRow writes one row, repeating the header on a fresh page if needed.
+func (w *pageWriter) tableRow(columns []column, cells []string) {
+	if w.ensure(rowHeight) {
+		w.tableHeader(columns)
+	}
+	for i, c := range columns {
+		cell := pdf.Truncate(pdf.Helvetica, bodySize, c.width, cells[i])
+		if c.right {
+			w.page.TextRight(c.x+c.width, w.y, pdf.Helvetica, bodySize, cell)
+		} else {
+			w.page.Text(c.x, w.y, pdf.Helvetica, bodySize, cell)
+		}
+	}
+	w.y += rowHeight
+}
+
+// summaryRow writes a right-aligned label and amount under a table.
+func (w *pageWriter) summaryRow(label, amount string, bold bool) {
+	w.ensure(rowHeight)
+	font := pdf.Helvetica
+	if bold {
+		font = pdf.HelveticaBold
+	}
+	w.page.TextRight(marginRight-110, w.y, font, bodySize, label)
+	w.page.TextRight(marginRight, w.y, font, bodySize, amount)
+	w.y += rowHeight
+}
+
+// lines writes a block of left-aligned text lines.
+func (w *pageWriter) lines(title string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	w.ensure(rowHeight * float64(len(lines)+1))
+	w.page.Text(marginLeft, w.y, pdf.HelveticaBold, smallSize, title)
+	w.y += 14
+	for _, line := range lines {
+		w.page.Text(marginLeft, w.y, pdf.Helvetica, bodySize, line)
+		w.y += 14
+	}
+	w.y += 8
+}
+
+// letterhead writes the firm block on the left and the document title with
+// its key facts on the right, then moves below both.
+func (w *pageWriter) letterhead(firm Letterhead, title string, facts [][2]string) {
+	top := w.y
+	w.page.Text(marginLeft, w.y+12, pdf.HelveticaBold, 16, firm.Name)
+	y := w.y + 30
+	contact := append([]string{}, firm.AddressLines...)
+	for _, extra := range []string{firm.Phone, firm.Email, firm.Website} {
+		if extra != "" {
+			contact = append(contact, extra)
+		}
+	}
+	for _, line := range contact {
+		w.page.Text(marginLeft, y, pdf.Helvetica, smallSize, line)
+		y += 11
+	}
+
+	w.page.TextRight(marginRight, top+16, pdf.HelveticaBold, headingSize, title)
+	factsY := top + 36
+	for _, fact := range facts {
+		w.page.TextRight(marginRight-90, factsY, pdf.HelveticaBold, smallSize, fact[0])
+		w.page.TextRight(marginRight, factsY, pdf.Helvetica, smallSize, fact[1])
+		factsY += 12
+	}
+
+	w.y = max(y, factsY) + 12
+	w.page.Line(marginLeft, w.y, marginRight, w.y, 0.75)
+	w.y += 22
+}
+
+// billTo writes the customer's name and address.
+func (w *pageWriter) billTo(customer customers.Customer, address *customers.Address) {
+	lines := []string{customerDisplayName(customer)}
+	if customer.CompanyName != "" {
+		if name := strings.TrimSpace(customer.FirstName + " " + customer.LastName); name != "" {
+			lines = append(lines, "Attn: "+name)
+		}
+	}
+	lines = append(lines, addressLines(address)...)
+	w.lines("BILL TO", lines)
+	w.y += 6
+}
+
+// RenderInvoicePDF writes an invoice or credit note as a PDF.
+func RenderInvoicePDF(out io.Writer, firm Letterhead, doc InvoiceDocument) error {
+	invoice := doc.Invoice
+	title, number := "INVOICE", invoice.InvoiceNumber
+	if invoice.Kind == InvoiceKindCreditNote {
+		title = "CREDIT NOTE"
+	}
+	if number == "" {
+		number = "DRAFT"
+	}
+
+	facts := [][2]string{{"Number", number}}
+	if invoice.IssueDate != nil {
+		facts = append(facts, [2]string{"Issued", formatDate(*invoice.IssueDate)})
+	}
+	if invoice.Kind == InvoiceKindInvoice {
+		if invoice.DueDate != nil {
+			facts = append(facts, [2]string{"Due", formatDate(*invoice.DueDate)})
+		}
+		facts = append(facts, [2]string{"Terms", paymentTermsLabel(invoice.PaymentTerms)})
+	}
+	facts = append(facts, [2]string{"Currency", string(currencyOf(invoice.Total))})
+
+	document := pdf.NewDocument(title + " " + number)
+	w := newPageWriter(document, firm.Name+" "+strings.ToLower(title)+" "+number)
+	w.letterhead(firm, title, facts)
+	w.billTo(doc.Customer, doc.BillTo)
+
+	columns := []column{
+		{title: "DESCRIPTION", x: marginLeft + 4, width: 220},
+		{title: "QTY", x: 270, width: 34, right: true},
+		{title: "UNIT PRICE", x: 308, width: 66, right: true},
+		{title: "DISCOUNT", x: 378, width: 60, right: true},
+		{title: "TAX", x: 442, width: 54, right: true},
+		{title: "AMOUNT", x: 500, width: marginRight - 4 - 500, right: true},
+	}
+	w.tableHeader(columns)
+	for _, item := range invoice.Items {
+		w.tableRow(columns, []string{
+			item.Description,
+			fmt.Sprint(item.Quantity),
+			formatAmount(item.UnitPrice),
+			formatAmount(item.Discount),
+			formatAmount(item.TaxAmount),
+			formatAmount(item.Total),
+		})
+	}
+	w.page.Line(marginLeft, w.y-8, marginRight, w.y-8, 0.5)
+	w.y += 6
+
+	w.summaryRow("Subtotal", formatAmount(invoice.SubTotal), false)
+	if !invoice.Discount.IsZero() {
+		w.summaryRow("Discount", "-"+formatAmount(invoice.Discount), false)
+	}
+	w.summaryRow("Tax", formatAmount(invoice.TaxAmount), false)
+	w.summaryRow("Total", formatAmount(invoice.Total), true)
+
+	if invoice.Kind == InvoiceKindInvoice {
+		if !invoice.AmountPaid.IsZero() {
+			w.summaryRow("Payments", "-"+formatAmount(invoice.AmountPaid), false)
+		}
+		if !invoice.AmountCredited.IsZero() {
+			w.summaryRow("Credits", "-"+formatAmount(invoice.AmountCredited), false)
+		}
+		balance, err := invoice.Balance()
+		if err != nil {
+			return err
+		}
+		if invoice.Status == InvoiceStatusVoid {
+			balance = core.Zero(balance.Currency())
+		}
+		w.y += 4
+		w.summaryRow("Balance Due", formatMoney(balance), true)
+	}
+	w.y += 16
+
+	if invoice.Notes != "" {
+		w.lines("NOTES", strings.Split(invoice.Notes, "\n"))
+	}
+	if invoice.Kind == InvoiceKindInvoice && invoice.Status != InvoiceStatusVoid {
+		w.lines("PAYMENT INSTRUCTIONS", paymentInstructions(firm, number))
+	}
+	return document.Write(out)
+}
+
+// RenderQuotePDF writes a quote as a PDF. Every version is printed with its
+// number so the customer can tell revisions apart.
+func RenderQuotePDF(out io.Writer, firm Letterhead, doc QuoteDocument) error {
+	quote := doc.Quote
+	number := quoteReference(quote)
+	facts := [][2]string{{"Number", number}}
+	if quote.SentAt != nil {
+		facts = append(facts, [2]string{"Date", formatDate(*quote.SentAt)})
+	}
+	facts = append(facts,
+		[2]string{"Valid Until", formatDate(quote.ValidUntil)},
+		[2]string{"Currency", string(currencyOf(quote.Total))},
+	)
+
+	document := pdf.NewDocument("Quote " + number)
+	w := newPageWriter(document, firm.Name+" quote "+number)
+	w.letterhead(firm, "QUOTE", facts)
+	w.billTo(doc.Customer, doc.BillTo)
+
+	columns := []column{
+		{title: "DESCRIPTION", x: marginLeft + 4, width: 220},
+		{title: "QTY", x: 270, width: 34, right: true},
+		{title: "UNIT PRICE", x: 308, width: 66, right: true},
+		{title: "DISCOUNT", x: 378, width: 60, right: true},
+		{title: "TAX", x: 442, width: 54, right: true},
+		{title: "AMOUNT", x: 500, width: marginRight - 4 - 500, right: true},
+	}
+	w.tableHeader(columns)
+	for _, item := range quote.Items {
+		w.tableRow(columns, []string{
+			item.Description,
+			fmt.Sprint(item.Quantity),
+			formatAmount(item.UnitPrice),
+			formatAmount(item.Discount),
+			formatAmount(item.TaxAmount),
+			formatAmount(item.Total),
+		})
+	}
+	w.page.Line(marginLeft, w.y-8, marginRight, w.y-8, 0.5)
+	w.y += 6
+
+	w.summaryRow("Subtotal", formatAmount(quote.SubTotal), false)
+	if !quote.Discount.IsZero() {
+		w.summaryRow("Discount", "-"+formatAmount(quote.Discount), false)
+	}
+	w.summaryRow("Tax", formatAmount(quote.TaxAmount), false)
+	w.summaryRow("Total", formatMoney(quote.Total), true)
+	w.y += 16
+
+	if quote.Notes != "" {
+		w.lines("NOTES", strings.Split(quote.Notes, "\n"))
+	}
+	w.lines("ACCEPTANCE", []string{
+		"This quote is valid until " + formatDate(quote.ValidUntil) + ".",
+		"Please quote " + number + " when accepting.",
+	})
+	return document.Write(out)
+}
+
+// quoteReference names a quote version, e.g. "QUO-000012 v2".
+func quoteReference(quote Quote) string {
+	return fmt.Sprintf("%s v%d", quote.QuoteNumber, quote.Version)
+}
+
+// RenderStatementPDF writes a customer statement as a PDF.
+func RenderStatementPDF(out io.Writer, firm Letterhead, statement Statement) error {
+	period := formatDate(statement.From) + " to " + formatDate(statement.To)
+	facts := [][2]string{
+		{"Period", period},
+		{"Balance Due", formatMoney(statement.BalanceDue)},
+	}
+
+	document := pdf.NewDocument("Statement " + period)
+	w := newPageWriter(document, firm.Name+" statement for "+customerDisplayName(statement.Customer))
+	w.letterhead(firm, "STATEMENT", facts)
+	w.billTo(statement.Customer, statement.BillTo)
+
+	invoiceColumns := []column{
+		{title: "INVOICE", x: marginLeft + 4, width: 110},
+		{title: "ISSUED", x: 160, width: 80},
+		{title: "DUE", x: 245, width: 80},
+		{title: "TOTAL", x: 330, width: 80, right: true},
+		{title: "PAID / CREDITED", x: 414, width: 80, right: true},
+		{title: "BALANCE", x: 498, width: marginRight - 4 - 498, right: true},
+	}
+	w.page.Text(marginLeft, w.y, pdf.HelveticaBold, bodySize, "Open invoices")
+	w.y += 10
+	w.tableHeader(invoiceColumns)
+	if len(statement.OpenInvoices) == 0 {
+		w.tableRow(invoiceColumns, []string{"No open invoices", "", "", "", "", ""})
+	}
+	for _, invoice := range statement.OpenInvoices {
+		settled, err := invoice.AmountPaid.Add(invoice.AmountCredited)
+		if err != nil {
+			return err
+		}
+		balance, err := invoice.Balance()
+		if err != nil {
+			return err
+		}
+		w.tableRow(invoiceColumns, []string{
+			invoice.InvoiceNumber,
+			formatOptionalDate(invoice.IssueDate),
+			formatOptionalDate(invoice.DueDate),
+			formatAmount(invoice.Total),
+			formatAmount(settled),
+			formatAmount(balance),
+		})
+	}
+	w.y += 6
+	w.summaryRow("Balance Due", formatMoney(statement.BalanceDue), true)
+	w.y += 16
+
+	paymentColumns := []column{
+		{title: "DATE", x: marginLeft + 4, width: 110},
+		{title: "METHOD", x: 160, width: 170},
+		{title: "APPLIED", x: 330, width: 80, right: true},
+		{title: "UNAPPLIED", x: 414, width: 80, right: true},
+		{title: "AMOUNT", x: 498, width: marginRight - 4 - 498, right: true},
+	}
+	w.ensure(rowHeight * 3)
+	w.page.Text(marginLeft, w.y, pdf.HelveticaBold, bodySize, "Payments received")
+	w.y += 10
+	w.tableHeader(paymentColumns)
+	if len(statement.Payments) == 0 {
+		w.tableRow(paymentColumns, []string{"No payments in this period", "", "", "", ""})
+	}
+	for _, payment := range statement.Payments {
+		unapplied, err := payment.Unapplied()
+		if err != nil {
+			return err
+		}
+		applied, err := payment.Amount.Sub(unapplied)
+		if err != nil {
+			return err
+		}
+		w.tableRow(paymentColumns, []string{
+			formatDate(payment.PaymentDate),
+			paymentMethodLabel(payment.Method),
+			formatAmount(applied),
+			formatAmount(unapplied),
+			formatAmount(payment.Amount),
+		})
+	}
+	w.y += 16
+
+	w.lines("PAYMENT INSTRUCTIONS", paymentInstructions(firm, ""))
+	return document.Write(out)
+}
+
+func paymentInstructions(firm Letterhead, reference string) []string {
+	lines := append([]string{}, firm.PaymentInstructions...)
+	if reference != "" && reference != "DRAFT" {
+		lines = append(lines, "Please include "+reference+" with your payment.")
+	}
+	return lines
+}
+
+func customerDisplayName(customer customers.Customer) string {
+	if customer.CompanyName != "" {
+		return customer.CompanyName
+	}
+	return strings.TrimSpace(customer.FirstName + " " + customer.LastName)
+}
+
+func addressLines(address *customers.Address) []string {
+	if address == nil {
+		return nil
+	}
+	var lines []string
+	for _, line := range []string{address.Street1, address.Street2} {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	cityLine := address.City
+	if address.State != "" {
+		if cityLine != "" {
+			cityLine += ", "
+		}
+		cityLine += address.State
+	}
+	if address.PostalCode != "" {
+		cityLine = strings.TrimSpace(cityLine + " " + address.PostalCode)
+	}
+	if cityLine != "" {
+		lines = append(lines, cityLine)
+	}
+	if address.Country != "" {
+		lines = append(lines, address.Country)
+	}
+	return lines
+}
+
+func paymentTermsLabel(terms PaymentTerms) string {
+	switch terms {
+	case PaymentTermsDueOnReceipt:
+		return "Due on receipt"
+	case PaymentTermsNet15:
+		return "Net 15"
+	case PaymentTermsNet30:
+		return "Net 30"
+	}
+	return string(terms)
+}
+
+func paymentMethodLabel(method PaymentMethod) string {
+	return strings.ReplaceAll(string(method), "_", " ")
+}
+
+func formatDate(t time.Time) string {
+	return t.Format("Jan 2, 2006")
+}
+
+func formatOptionalDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return formatDate(*t)
+}
+
+func currencyOf(m core.Money) core.Currency {
+	if m.Currency() == "" {
+		return core.DefaultCurrency
+	}
+	return m.Currency()
+}
+
+// formatAmount writes the amount with thousands separators, e.g. "1,234.50".
+func formatAmount(m core.Money) string {
+	decimal := m.Decimal()
+	sign := ""
+	if strings.HasPrefix(decimal, "-") {
+		sign, decimal = "-", decimal[1:]
+	}
+	whole, fraction, hasFraction := strings.Cut(decimal, ".")
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	if hasFraction {
+		return sign + grouped.String() + "." + fraction
+	}
+	return sign + grouped.String()
+}
+
+// formatMoney is formatAmount prefixed with the currency code.
+func formatMoney(m core.Money) string {
+	return string(currencyOf(m)) + " " + formatAmount(m)
+}
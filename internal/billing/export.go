@@ -0,0 +1,575 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAccountMappingNotFound  = errors.New("account mapping not found")
+	ErrInvalidAccountMapping   = errors.New("invalid account mapping")
+	ErrDuplicateAccountMapping = errors.New("an account mapping for this kind and key already exists")
+	ErrUnmappedAccount         = errors.New("no account is mapped")
+	ErrUnbalancedJournalEntry  = errors.New("journal entry does not balance")
+	ErrExportNotFound          = errors.New("accounting export not found")
+	ErrInvalidExport           = errors.New("invalid accounting export")
+	ErrNothingToExport         = errors.New("no unexported journal entries in the period")
+)
+
+// AccountMapping names the account in the bookkeeper's chart of accounts that
+// billing amounts are posted to. Revenue is mapped per product category, with
+// an empty Key as the fallback for unmapped categories and non-product lines.
+// Exchange gains and losses go to the single fx_gain_loss account.
+type AccountMapping struct {
+	core.BaseModel
+	Kind        AccountMappingKind `json:"kind"`
+	Key         string             `json:"key"`          // Ledger account or product category; empty for sales tax and exchange gain or loss
+	AccountCode string             `json:"account_code"` // Used by Xero and the journal CSV
+	AccountName string             `json:"account_name"` // Used by QuickBooks, which matches accounts by name
+}
+
+type AccountMappingKind string
+
+const (
+	AccountMappingLedger     AccountMappingKind = "ledger"
+	AccountMappingRevenue    AccountMappingKind = "revenue"
+	AccountMappingSalesTax   AccountMappingKind = "sales_tax"
+	AccountMappingFXGainLoss AccountMappingKind = "fx_gain_loss"
+)
+
+func (m AccountMapping) validate() error {
+	switch m.Kind {
+	case AccountMappingLedger:
+		if !LedgerAccount(m.Key).Valid() {
+			return fmt.Errorf("%w: unknown ledger account %q", ErrInvalidAccountMapping, m.Key)
+		}
+	case AccountMappingRevenue:
+	case AccountMappingSalesTax, AccountMappingFXGainLoss:
+		if m.Key != "" {
+			return fmt.Errorf("%w: %s mappings take no key", ErrInvalidAccountMapping, m.Kind)
+		}
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidAccountMapping, m.Kind)
+	}
+	if strings.TrimSpace(m.AccountCode) == "" || strings.TrimSpace(m.AccountName) == "" {
+		return fmt.Errorf("%w: account code and name are required", ErrInvalidAccountMapping)
+	}
+	return nil
+}
+
+// Valid reports whether a is one of the accounts the payment ledger posts to.
+func (a LedgerAccount) Valid() bool {
+	switch a {
+	case LedgerAccountCash, LedgerAccountCustomerCredit, LedgerAccountReceivables, LedgerAccountDisputedFunds:
+		return true
+	}
+	return false
+}
+
+// Account is an account in the bookkeeper's chart of accounts.
+type Account struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// chartOfAccounts resolves billing amounts to mapped accounts.
+type chartOfAccounts struct {
+	ledger   map[LedgerAccount]Account
+	revenue  map[string]Account
+	salesTax *Account
+	fx       *Account
+}
+
+func newChartOfAccounts(mappings []*AccountMapping) chartOfAccounts {
+	chart := chartOfAccounts{
+		ledger:  make(map[LedgerAccount]Account),
+		revenue: make(map[string]Account),
+	}
+	for _, m := range mappings {
+		account := Account{Code: m.AccountCode, Name: m.AccountName}
+		switch m.Kind {
+		case AccountMappingLedger:
+			chart.ledger[LedgerAccount(m.Key)] = account
+		case AccountMappingRevenue:
+			chart.revenue[m.Key] = account
+		case AccountMappingSalesTax:
+			chart.salesTax = &account
+		case AccountMappingFXGainLoss:
+			chart.fx = &account
+		}
+	}
+	return chart
+}
+
+func (c chartOfAccounts) ledgerAccount(account LedgerAccount) (Account, error) {
+	mapped, ok := c.ledger[account]
+	if !ok {
+		return Account{}, fmt.Errorf("%w: ledger account %q", ErrUnmappedAccount, account)
+	}
+	return mapped, nil
+}
+
+// revenueAccount returns the account for category, falling back to the
+// default revenue account.
+func (c chartOfAccounts) revenueAccount(category string) (Account, error) {
+	if mapped, ok := c.revenue[category]; ok {
+		return mapped, nil
+	}
+	if mapped, ok := c.revenue[""]; ok {
+		return mapped, nil
+	}
+	return Account{}, fmt.Errorf("%w: revenue for product category %q and no default revenue account", ErrUnmappedAccount, category)
+}
+
+func (c chartOfAccounts) salesTaxAccount() (Account, error) {
+	if c.salesTax == nil {
+		return Account{}, fmt.Errorf("%w: sales tax", ErrUnmappedAccount)
+	}
+	return *c.salesTax, nil
+}
+
+func (c chartOfAccounts) fxAccount() (Account, error) {
+	if c.fx == nil {
+		return Account{}, fmt.Errorf("%w: exchange gain or loss", ErrUnmappedAccount)
+	}
+	return *c.fx, nil
+}
+
+// JournalSource is the billing event a journal entry was built from.
+type JournalSource string
+
+const (
+	JournalSourceInvoice     JournalSource = "invoice"
+	JournalSourceInvoiceVoid JournalSource = "invoice_void"
+	JournalSourceCreditNote  JournalSource = "credit_note"
+	JournalSourceLedger      JournalSource = "ledger_entry"
+)
+
+// JournalKey identifies a journal entry across exports. An invoice yields
+// one entry when issued and another if it is voided, both keyed by its ID.
+type JournalKey struct {
+	Source   JournalSource `json:"source"`
+	SourceID uuid.UUID     `json:"source_id"`
+}
+
+// JournalEntry is one balanced general-ledger transaction in the base
+// currency.
+type JournalEntry struct {
+	JournalKey
+	Date         time.Time     `json:"date"`
+	Reference    string        `json:"reference"` // Invoice or credit note number, or the payment ID
+	CustomerName string        `json:"customer_name"`
+	Memo         string        `json:"memo"`
+	Lines        []JournalLine `json:"lines"`
+	ExportID     *uuid.UUID    `json:"export_id"` // Set once the entry has been exported
+}
+
+// JournalLine posts either a debit or a credit to one account.
+type JournalLine struct {
+	Account Account    `json:"account"`
+	Debit   core.Money `json:"debit"`
+	Credit  core.Money `json:"credit"`
+}
+
+// Amount is the line's signed amount, positive for debits.
+func (l JournalLine) Amount() (core.Money, error) {
+	return l.Debit.Sub(l.Credit)
+}
+
+func (e JournalEntry) checkBalanced() error {
+	var balance core.Money
+	for _, line := range e.Lines {
+		amount, err := line.Amount()
+		if err != nil {
+			return err
+		}
+		if balance, err = balance.Add(amount); err != nil {
+			return err
+		}
+	}
+	if !balance.IsZero() {
+		return fmt.Errorf("%w: %s %s is off by %s", ErrUnbalancedJournalEntry, e.Source, e.Reference, balance)
+	}
+	return nil
+}
+
+// LedgerPosting is a payment ledger entry with the customer who made the
+// payment and, when the entry concerns an invoice, the invoice's number.
+type LedgerPosting struct {
+	LedgerEntry
+	Currency      core.Currency `json:"currency"` // The payment's
+	PaymentDate   time.Time     `json:"payment_date"`
+	CustomerID    uuid.UUID     `json:"customer_id"`
+	InvoiceNumber string        `json:"invoice_number"`
+}
+
+// JournalSources is the billing activity dated in an export period, as read
+// by the repository.
+type JournalSources struct {
+	// Invoices and credit notes issued or voided in the period, with items
+	Invoices []*Invoice
+	Postings []*LedgerPosting
+
+	// ProductCategories gives the category of each product on the invoices
+	ProductCategories map[uuid.UUID]string
+
+	// Exported gives the export that already contains each journal entry
+	Exported map[JournalKey]uuid.UUID
+}
+
+// ExportFormat is the file layout an export is written in.
+type ExportFormat string
+
+const (
+	ExportFormatQuickBooksIIF ExportFormat = "quickbooks_iif"
+	ExportFormatXeroCSV       ExportFormat = "xero_csv"
+	ExportFormatJournalCSV    ExportFormat = "journal_csv"
+)
+
+func (f ExportFormat) Valid() bool {
+	switch f {
+	case ExportFormatQuickBooksIIF, ExportFormatXeroCSV, ExportFormatJournalCSV:
+		return true
+	}
+	return false
+}
+
+// AccountingExport records a batch of journal entries handed to the
+// bookkeeper. Each entry is exported once; later exports of an overlapping
+// period skip it.
+type AccountingExport struct {
+	core.BaseModel
+	Format     ExportFormat `json:"format"`
+	PeriodFrom time.Time    `json:"period_from"`
+	PeriodTo   time.Time    `json:"period_to"` // Inclusive
+	EntryCount int          `json:"entry_count"`
+}
+
+// buildJournal turns sources into journal entries dated from..to inclusive,
+// ordered by date. Customer names are looked up through name. Amounts in
+// other currencies are converted to the base currency through rates, which
+// may be nil when everything is in the base currency.
+func buildJournal(sources *JournalSources, chart chartOfAccounts, rates CurrencyConverter, from, to time.Time, name func(uuid.UUID) (string, error)) ([]JournalEntry, error) {
+	inPeriod := func(t *time.Time) bool {
+		if t == nil {
+			return false
+		}
+		day := dateOnly(*t)
+		return !day.Before(from) && !day.After(to)
+	}
+
+	var entries []JournalEntry
+	add := func(entry *JournalEntry, customerID uuid.UUID) error {
+		if entry == nil {
+			return nil
+		}
+		if err := entry.checkBalanced(); err != nil {
+			return err
+		}
+		customerName, err := name(customerID)
+		if err != nil {
+			return err
+		}
+		entry.CustomerName = customerName
+		if exportID, ok := sources.Exported[entry.JournalKey]; ok {
+			entry.ExportID = &exportID
+		}
+		entries = append(entries, *entry)
+		return nil
+	}
+
+	for _, invoice := range sources.Invoices {
+		if invoice.SentAt == nil {
+			continue
+		}
+		if inPeriod(invoice.IssueDate) {
+			source := JournalSourceInvoice
+			if invoice.Kind == InvoiceKindCreditNote {
+				source = JournalSourceCreditNote
+			}
+			entry, err := invoiceJournalEntry(*invoice, source, dateOnly(*invoice.IssueDate), chart, rates, sources.ProductCategories)
+			if err != nil {
+				return nil, err
+			}
+			if err := add(entry, invoice.CustomerID); err != nil {
+				return nil, err
+			}
+		}
+		if invoice.Kind == InvoiceKindInvoice && inPeriod(invoice.VoidedAt) {
+			entry, err := invoiceJournalEntry(*invoice, JournalSourceInvoiceVoid, dateOnly(*invoice.VoidedAt), chart, rates, sources.ProductCategories)
+			if err != nil {
+				return nil, err
+			}
+			if err := add(entry, invoice.CustomerID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, posting := range sources.Postings {
+		if !inPeriod(&posting.OccurredAt) {
+			continue
+		}
+		entry, err := ledgerJournalEntry(*posting, chart, rates)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(entry, posting.CustomerID); err != nil {
+			return nil, err
+		}
+	}
+
+	sortJournal(entries)
+	return entries, nil
+}
+
+// invoiceJournalEntry debits receivables with the invoice total and credits
+// revenue, by product category, and sales tax. Credit notes and voids post
+// the same lines the other way round. Invoices with nothing to post yield
+// nil.
+//
+// A foreign-currency invoice is converted at the rate of its issue date, the
+// value receivables were booked at, so a void reverses exactly what the
+// invoice posted.
+func invoiceJournalEntry(invoice Invoice, source JournalSource, date time.Time, chart chartOfAccounts, rates CurrencyConverter, categories map[uuid.UUID]string) (*JournalEntry, error) {
+	if invoice.Total.IsZero() {
+		return nil, nil
+	}
+	receivables, err := chart.ledgerAccount(LedgerAccountReceivables)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &JournalEntry{
+		JournalKey: JournalKey{Source: source, SourceID: invoice.ID},
+		Date:       date,
+		Reference:  invoice.InvoiceNumber,
+	}
+	switch source {
+	case JournalSourceInvoice:
+		entry.Memo = "Invoice " + invoice.InvoiceNumber
+	case JournalSourceInvoiceVoid:
+		entry.Memo = "Void of invoice " + invoice.InvoiceNumber
+	case JournalSourceCreditNote:
+		entry.Memo = "Credit note " + invoice.InvoiceNumber
+	}
+	entry.Lines = append(entry.Lines, JournalLine{Account: receivables, Debit: invoice.Total})
+
+	// Revenue lines are grouped by account in the order the accounts first
+	// appear on the invoice.
+	var order []Account
+	revenue := make(map[Account]core.Money)
+	for _, item := range invoice.Items {
+		category := ""
+		if item.ProductID != nil {
+			category = categories[*item.ProductID]
+		}
+		account, err := chart.revenueAccount(category)
+		if err != nil {
+			return nil, err
+		}
+		total, seen := revenue[account]
+		if !seen {
+			order = append(order, account)
+		}
+		if revenue[account], err = total.Add(item.Total); err != nil {
+			return nil, err
+		}
+	}
+	for _, account := range order {
+		if !revenue[account].IsZero() {
+			entry.Lines = append(entry.Lines, JournalLine{Account: account, Credit: revenue[account]})
+		}
+	}
+	if !invoice.TaxAmount.IsZero() {
+		tax, err := chart.salesTaxAccount()
+		if err != nil {
+			return nil, err
+		}
+		entry.Lines = append(entry.Lines, JournalLine{Account: tax, Credit: invoice.TaxAmount})
+	}
+
+	if source != JournalSourceInvoice {
+		for i := range entry.Lines {
+			entry.Lines[i].Debit, entry.Lines[i].Credit = entry.Lines[i].Credit, entry.Lines[i].Debit
+		}
+	}
+
+	if currency := currencyOf(invoice.Total); currency != BaseCurrency {
+		booked := date
+		if invoice.IssueDate != nil {
+			booked = dateOnly(*invoice.IssueDate)
+		}
+		if err := entry.convertToBase(rates, booked, chart); err != nil {
+			return nil, err
+		}
+		entry.Memo += " (" + invoice.Total.String() + ")"
+	}
+	return entry, nil
+}
+
+// convertToBase restates the entry's lines in the base currency at the rates
+// of on. Each line is converted on its own, so the cent or two of rounding
+// that can leave the entry unbalanced is posted to exchange gain or loss.
+func (e *JournalEntry) convertToBase(rates CurrencyConverter, on time.Time, chart chartOfAccounts) error {
+	var balance core.Money
+	for i := range e.Lines {
+		line := &e.Lines[i]
+		for _, amount := range []*core.Money{&line.Debit, &line.Credit} {
+			if amount.IsZero() {
+				continue
+			}
+			converted, err := journalAmount(rates, *amount, on)
+			if err != nil {
+				return err
+			}
+			*amount = converted
+		}
+		amount, err := line.Amount()
+		if err != nil {
+			return err
+		}
+		if balance, err = balance.Add(amount); err != nil {
+			return err
+		}
+	}
+	if balance.IsZero() {
+		return nil
+	}
+	fx, err := chart.fxAccount()
+	if err != nil {
+		return err
+	}
+	e.Lines = append(e.Lines, signedLine(fx, balance.Neg()))
+	return nil
+}
+
+// journalAmount converts amount to the base currency the books are kept in at
+// the rates of on.
+func journalAmount(rates CurrencyConverter, amount core.Money, on time.Time) (core.Money, error) {
+	if currency := currencyOf(amount); currency != BaseCurrency && rates == nil {
+		return core.Money{}, fmt.Errorf("%w: %s amounts are not converted for the books", ErrNoExchangeRate, currency)
+	}
+	return toBase(rates, amount, on)
+}
+
+// signedLine posts amount to account, as a debit when it is positive and as
+// a credit otherwise.
+func signedLine(account Account, amount core.Money) JournalLine {
+	if amount.IsNegative() {
+		return JournalLine{Account: account, Credit: amount.Neg()}
+	}
+	return JournalLine{Account: account, Debit: amount}
+}
+
+// ledgerEntryMemos describes each payment ledger entry type in a journal.
+var ledgerEntryMemos = map[LedgerEntryType]string{
+	LedgerEntryPaymentReceived:     "Payment received",
+	LedgerEntryPaymentApplied:      "Payment applied",
+	LedgerEntryApplicationReversed: "Payment application reversed",
+	LedgerEntryRefund:              "Refund",
+	LedgerEntryChargeback:          "Chargeback",
+	LedgerEntryChargebackWon:       "Chargeback won",
+	LedgerEntryChargebackLost:      "Chargeback lost",
+}
+
+// ledgerJournalEntry maps a payment ledger entry's two accounts onto the
+// chart of accounts. Entries whose accounts map to the same account, such as
+// applications when customer credit and receivables share an account, move
+// nothing and yield nil.
+//
+// A foreign-currency payment is converted at the rate of its payment date,
+// the rate its realized exchange difference was measured at. Receivables
+// then clear at the value they were booked at, and the realized gain or loss
+// makes up the rest.
+func ledgerJournalEntry(posting LedgerPosting, chart chartOfAccounts, rates CurrencyConverter) (*JournalEntry, error) {
+	debit, err := chart.ledgerAccount(posting.DebitAccount)
+	if err != nil {
+		return nil, err
+	}
+	credit, err := chart.ledgerAccount(posting.CreditAccount)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := journalAmount(rates, posting.Amount, posting.PaymentDate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Amounts are signed, positive for debits, and netted per account in the
+	// order the accounts first appear.
+	var accounts []Account
+	net := make(map[Account]core.Money)
+	post := func(account Account, amount core.Money) error {
+		total, seen := net[account]
+		if !seen {
+			accounts = append(accounts, account)
+		}
+		var err error
+		net[account], err = total.Add(amount)
+		return err
+	}
+	if err := post(debit, amount); err != nil {
+		return nil, err
+	}
+	if err := post(credit, amount.Neg()); err != nil {
+		return nil, err
+	}
+	if !posting.RealizedFX.IsZero() {
+		fx, err := chart.fxAccount()
+		if err != nil {
+			return nil, err
+		}
+		receivables, gain := credit, posting.RealizedFX
+		if posting.DebitAccount == LedgerAccountReceivables {
+			receivables, gain = debit, gain.Neg()
+		}
+		if err := post(receivables, gain); err != nil {
+			return nil, err
+		}
+		if err := post(fx, gain.Neg()); err != nil {
+			return nil, err
+		}
+	}
+	var lines []JournalLine
+	for _, account := range accounts {
+		if !net[account].IsZero() {
+			lines = append(lines, signedLine(account, net[account]))
+		}
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	memo := ledgerEntryMemos[posting.Type]
+	reference := posting.PaymentID.String()
+	if posting.InvoiceNumber != "" {
+		reference = posting.InvoiceNumber
+		memo += " on " + posting.InvoiceNumber
+	}
+	if currencyOf(posting.Amount) != BaseCurrency {
+		memo += " (" + posting.Amount.String() + ")"
+	}
+	return &JournalEntry{
+		JournalKey: JournalKey{Source: JournalSourceLedger, SourceID: posting.ID},
+		Date:       dateOnly(posting.OccurredAt),
+		Reference:  reference,
+		Memo:       memo,
+		Lines:      lines,
+	}, nil
+}
+
+// sortJournal orders entries by date, keeping the order they were built in
+// for entries on the same day.
+func sortJournal(entries []JournalEntry) {
+	slices.SortStableFunc(entries, func(a, b JournalEntry) int {
+		return a.Date.Compare(b.Date)
+	})
+}
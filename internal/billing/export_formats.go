@@ -0,0 +1,171 @@
+package billing
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"rva_crm/internal/core"
+)
+
+// exportFormats gives the file extension, content type and writer of each
+// ExportFormat.
+var exportFormats = map[ExportFormat]struct {
+	extension   string
+	contentType string
+	write       func(io.Writer, []JournalEntry) error
+}{
+	ExportFormatQuickBooksIIF: {"iif", "text/plain; charset=utf-8", writeQuickBooksIIF},
+	ExportFormatXeroCSV:       {"csv", "text/csv; charset=utf-8", writeXeroCSV},
+	ExportFormatJournalCSV:    {"csv", "text/csv; charset=utf-8", writeJournalCSV},
+}
+
+// ExportFile is a rendered accounting export ready to be served.
+type ExportFile struct {
+	Export      *AccountingExport
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+func renderExport(export *AccountingExport, entries []JournalEntry) (*ExportFile, error) {
+	format, ok := exportFormats[export.Format]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidExport, export.Format)
+	}
+	var buf bytes.Buffer
+	if err := format.write(&buf, entries); err != nil {
+		return nil, err
+	}
+	return exportFile(export, buf.Bytes())
+}
+
+// exportFile names content rendered for export in its format.
+func exportFile(export *AccountingExport, content []byte) (*ExportFile, error) {
+	format, ok := exportFormats[export.Format]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidExport, export.Format)
+	}
+	return &ExportFile{
+		Export:      export,
+		Filename:    fmt.Sprintf("journal-%s-%s.%s", export.PeriodFrom.Format("20060102"), export.PeriodTo.Format("20060102"), format.extension),
+		ContentType: format.contentType,
+		Content:     content,
+	}, nil
+}
+
+// writeQuickBooksIIF writes entries as QuickBooks Desktop general journal
+// transactions. The first line of each entry is the TRNS row and the rest
+// are SPL rows; amounts are positive for debits.
+func writeQuickBooksIIF(w io.Writer, entries []JournalEntry) error {
+	header := "!TRNS\tTRNSTYPE\tDATE\tACCNT\tNAME\tAMOUNT\tDOCNUM\tMEMO\r\n" +
+		"!SPL\tTRNSTYPE\tDATE\tACCNT\tNAME\tAMOUNT\tDOCNUM\tMEMO\r\n" +
+		"!ENDTRNS\r\n"
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		for i, line := range entry.Lines {
+			amount, err := baseAmount(line)
+			if err != nil {
+				return err
+			}
+			row := "SPL"
+			if i == 0 {
+				row = "TRNS"
+			}
+			fields := []string{row, "GENERAL JOURNAL", entry.Date.Format("01/02/2006"), iifField(line.Account.Name), iifField(entry.CustomerName), amount.Decimal(), iifField(entry.Reference), iifField(entry.Memo)}
+			if _, err := io.WriteString(w, strings.Join(fields, "\t")+"\r\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, "ENDTRNS\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// baseAmount is the line's signed amount for formats that carry no currency
+// and are imported into the base-currency books as is.
+func baseAmount(line JournalLine) (core.Money, error) {
+	amount, err := line.Amount()
+	if err != nil {
+		return core.Money{}, err
+	}
+	if currency := currencyOf(amount); currency != BaseCurrency {
+		return core.Money{}, fmt.Errorf("%w: %s amount in a %s journal", ErrInvalidExport, currency, BaseCurrency)
+	}
+	return amount, nil
+}
+
+// iifField strips the characters IIF cannot carry inside a field.
+func iifField(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\t', '\r', '\n':
+			return ' '
+		case '"':
+			return '\''
+		}
+		return r
+	}, s)
+}
+
+// writeXeroCSV writes entries in the layout of Xero's manual journal import.
+// Lines sharing a narration and date form one journal; amounts are positive
+// for debits. Tax is posted explicitly, so every line is tax exempt.
+func writeXeroCSV(w io.Writer, entries []JournalEntry) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"*Narration", "*Date", "Description", "*AccountCode", "*TaxRate", "*Amount"})
+	for _, entry := range entries {
+		narration := entry.Memo
+		if entry.CustomerName != "" {
+			narration += " - " + entry.CustomerName
+		}
+		for _, line := range entry.Lines {
+			amount, err := baseAmount(line)
+			if err != nil {
+				return err
+			}
+			out.Write([]string{narration, entry.Date.Format("2006-01-02"), entry.Reference, line.Account.Code, "Tax Exempt", amount.Decimal()})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// writeJournalCSV writes one row per journal line with separate debit and
+// credit columns, for any double-entry system.
+func writeJournalCSV(w io.Writer, entries []JournalEntry) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"date", "source", "source_id", "reference", "customer", "memo", "account_code", "account_name", "debit", "credit", "currency"})
+	for _, entry := range entries {
+		for _, line := range entry.Lines {
+			amount, err := line.Amount()
+			if err != nil {
+				return err
+			}
+			out.Write([]string{entry.Date.Format("2006-01-02"), string(entry.Source), entry.SourceID.String(), entry.Reference, entry.CustomerName, entry.Memo, line.Account.Code, line.Account.Name,
+				nonZeroDecimal(line.Debit), nonZeroDecimal(line.Credit), string(lineCurrency(amount))})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func nonZeroDecimal(m core.Money) string {
+	if m.IsZero() {
+		return ""
+	}
+	return m.Decimal()
+}
+
+func lineCurrency(amount core.Money) core.Currency {
+	if currency := amount.Currency(); currency != "" {
+		return currency
+	}
+	return core.DefaultCurrency
+}
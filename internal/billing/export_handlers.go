@@ -0,0 +1,186 @@
+package billing
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type accountMappingHandler struct {
+	service AccountMappingManager
+}
+
+type journalExportHandler struct {
+	service JournalExporter
+}
+
+// NewAccountMappingHandler serves the chart-of-accounts mapping: GET lists
+// every mapping, POST adds one, PUT changes the account of one and DELETE
+// ?id= removes one.
+func NewAccountMappingHandler(service AccountMappingManager) http.Handler {
+	return &accountMappingHandler{service: service}
+}
+
+// NewJournalExportHandler serves journal exports. GET with ?from= and ?to=
+// (YYYY-MM-DD) previews the entries of the period as JSON; GET ?id=
+// downloads an earlier export again and GET without parameters lists
+// exports. POST {"format": "...", "from": "...", "to": "..."} exports the
+// period's unexported entries and answers 201 with the file.
+func NewJournalExportHandler(service JournalExporter) http.Handler {
+	return &journalExportHandler{service: service}
+}
+
+func (h *accountMappingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getAccountMappings(w, r)
+	case http.MethodPost:
+		h.createAccountMapping(w, r)
+	case http.MethodPut:
+		h.updateAccountMapping(w, r)
+	case http.MethodDelete:
+		h.deleteAccountMapping(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *journalExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getJournal(w, r)
+	case http.MethodPost:
+		h.exportJournal(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *accountMappingHandler) getAccountMappings(w http.ResponseWriter, r *http.Request) {
+	mappings, err := h.service.GetAccountMappings(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(mappings)
+}
+
+func (h *accountMappingHandler) createAccountMapping(w http.ResponseWriter, r *http.Request) {
+	var mapping AccountMapping
+	if err := json.NewDecoder(r.Body).Decode(&mapping); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	created, err := h.service.CreateAccountMapping(r.Context(), mapping)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *accountMappingHandler) updateAccountMapping(w http.ResponseWriter, r *http.Request) {
+	var mapping AccountMapping
+	if err := json.NewDecoder(r.Body).Decode(&mapping); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updated, err := h.service.UpdateAccountMapping(r.Context(), mapping)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *accountMappingHandler) deleteAccountMapping(w http.ResponseWriter, r *http.Request) {
+	mappingID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteAccountMapping(r.Context(), mappingID); err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account mapping deleted successfully"})
+}
+
+func (h *journalExportHandler) getJournal(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch {
+	case query.Has("id"):
+		exportID, ok := queryUUID(w, r, "id")
+		if !ok {
+			return
+		}
+		file, err := h.service.DownloadAccountingExport(r.Context(), exportID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeExportFile(w, file, http.StatusOK)
+	case query.Has("from") || query.Has("to"):
+		from, ok := queryDate(w, r, "from")
+		if !ok {
+			return
+		}
+		to, ok := queryDate(w, r, "to")
+		if !ok {
+			return
+		}
+		entries, err := h.service.PreviewJournal(r.Context(), from, to)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(entries)
+	default:
+		exports, err := h.service.GetAccountingExports(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(exports)
+	}
+}
+
+func (h *journalExportHandler) exportJournal(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Format ExportFormat `json:"format"`
+		From   string       `json:"from"`
+		To     string       `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := time.Parse(time.DateOnly, body.From)
+	if err != nil {
+		http.Error(w, "invalid from, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(time.DateOnly, body.To)
+	if err != nil {
+		http.Error(w, "invalid to, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	file, err := h.service.ExportJournal(r.Context(), body.Format, from, to)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeExportFile(w, file, http.StatusCreated)
+}
+
+// writeExportFile serves file as a download, naming the export in the
+// X-Export-ID header so clients can fetch it again later.
+func writeExportFile(w http.ResponseWriter, file *ExportFile, status int) {
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+file.Filename+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(file.Content)))
+	w.Header().Set("X-Export-ID", file.Export.ID.String())
+	w.WriteHeader(status)
+	w.Write(file.Content)
+}
@@ -0,0 +1,271 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type accountingExportRepository struct {
+	db *sql.DB
+}
+
+func NewAccountingExportRepository(db *sql.DB) AccountingExportRepository {
+	return &accountingExportRepository{db: db}
+}
+
+const accountMappingColumns = "id, kind, key, account_code, account_name, created_at, updated_at"
+
+const accountingExportColumns = "id, format, period_from, period_to, entry_count, created_at, updated_at"
+
+// Journal source queries take the first and last day of the period as $1 and
+// $2, and the day after the period as $3 for timestamp columns.
+const (
+	journalInvoicesInPeriod = "sent_at IS NOT NULL AND (issue_date BETWEEN $1 AND $2 OR (voided_at >= $1 AND voided_at < $3))"
+	journalLedgerInPeriod   = "occurred_at >= $1 AND occurred_at < $3"
+)
+
+func scanAccountMapping(row rowScanner) (*AccountMapping, error) {
+	var mapping AccountMapping
+	err := row.Scan(&mapping.ID, &mapping.Kind, &mapping.Key, &mapping.AccountCode, &mapping.AccountName, &mapping.CreatedAt, &mapping.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAccountMappingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mapping, nil
+}
+
+func scanAccountingExport(row rowScanner) (*AccountingExport, error) {
+	var export AccountingExport
+	err := row.Scan(&export.ID, &export.Format, &export.PeriodFrom, &export.PeriodTo, &export.EntryCount, &export.CreatedAt, &export.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrExportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func scanLedgerPosting(row rowScanner) (*LedgerPosting, error) {
+	var posting LedgerPosting
+	err := row.Scan(&posting.ID, &posting.PaymentID, &posting.Type, &posting.DebitAccount, &posting.CreditAccount, &posting.Amount, &posting.RealizedFX, &posting.InvoiceID, &posting.OrderID, &posting.RefundID, &posting.ChargebackID, &posting.OccurredAt, &posting.CreatedAt, &posting.Currency, &posting.CustomerID, &posting.PaymentDate, &posting.InvoiceNumber)
+	if err != nil {
+		return nil, err
+	}
+	if err := rereadAmounts(posting.Currency, &posting.Amount); err != nil {
+		return nil, err
+	}
+	if err := rereadAmounts(BaseCurrency, &posting.RealizedFX); err != nil {
+		return nil, err
+	}
+	return &posting, nil
+}
+
+func (r *accountingExportRepository) GetAccountMappings(ctx context.Context) ([]*AccountMapping, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+accountMappingColumns+" FROM account_mappings ORDER BY kind, key")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mappings []*AccountMapping
+	for rows.Next() {
+		mapping, err := scanAccountMapping(rows)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, rows.Err()
+}
+
+func (r *accountingExportRepository) CreateAccountMapping(ctx context.Context, mapping AccountMapping) (*AccountMapping, error) {
+	if mapping.ID == uuid.Nil {
+		mapping.ID = uuid.New()
+	}
+	created, err := scanAccountMapping(r.db.QueryRowContext(ctx, "INSERT INTO account_mappings (id, kind, key, account_code, account_name) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (kind, key) DO NOTHING RETURNING "+accountMappingColumns,
+		mapping.ID, mapping.Kind, mapping.Key, mapping.AccountCode, mapping.AccountName))
+	if errors.Is(err, ErrAccountMappingNotFound) {
+		return nil, ErrDuplicateAccountMapping
+	}
+	return created, err
+}
+
+// UpdateAccountMapping changes the account a mapping points to. The kind and
+// key identify what is mapped and are not changed.
+func (r *accountingExportRepository) UpdateAccountMapping(ctx context.Context, mapping AccountMapping) (*AccountMapping, error) {
+	return scanAccountMapping(r.db.QueryRowContext(ctx, "UPDATE account_mappings SET account_code = $1, account_name = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3 RETURNING "+accountMappingColumns,
+		mapping.AccountCode, mapping.AccountName, mapping.ID))
+}
+
+func (r *accountingExportRepository) DeleteAccountMapping(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM account_mappings WHERE id = $1", id)
+	return err
+}
+
+func (r *accountingExportRepository) GetJournalSources(ctx context.Context, from, to time.Time) (*JournalSources, error) {
+	args := []any{from, to, to.AddDate(0, 0, 1)}
+	sources := &JournalSources{
+		ProductCategories: make(map[uuid.UUID]string),
+		Exported:          make(map[JournalKey]uuid.UUID),
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+invoiceColumns+" FROM invoices WHERE "+journalInvoicesInPeriod+" ORDER BY issue_date, invoice_number", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		invoice, err := scanInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		sources.Invoices = append(sources.Invoices, invoice)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, invoice := range sources.Invoices {
+		if invoice.Items, err = queryInvoiceItems(ctx, r.db, invoice.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	categories, err := r.db.QueryContext(ctx, "SELECT p.id, p.category FROM products p WHERE p.id IN (SELECT i.product_id FROM invoice_items i JOIN invoices ON invoices.id = i.invoice_id WHERE "+journalInvoicesInPeriod+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer categories.Close()
+	for categories.Next() {
+		var productID uuid.UUID
+		var category string
+		if err := categories.Scan(&productID, &category); err != nil {
+			return nil, err
+		}
+		sources.ProductCategories[productID] = category
+	}
+	if err := categories.Err(); err != nil {
+		return nil, err
+	}
+
+	postings, err := r.db.QueryContext(ctx, "SELECT le.id, le.payment_id, le.entry_type, le.debit_account, le.credit_account, le.amount, le.realized_fx, le.invoice_id, le.order_id, le.refund_id, le.chargeback_id, le.occurred_at, le.created_at, p.currency, p.customer_id, p.payment_date, COALESCE(i.invoice_number, '') FROM ledger_entries le JOIN payments p ON p.id = le.payment_id LEFT JOIN invoices i ON i.id = le.invoice_id WHERE le."+journalLedgerInPeriod+" ORDER BY le.occurred_at, le.created_at, le.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer postings.Close()
+	for postings.Next() {
+		posting, err := scanLedgerPosting(postings)
+		if err != nil {
+			return nil, err
+		}
+		sources.Postings = append(sources.Postings, posting)
+	}
+	if err := postings.Err(); err != nil {
+		return nil, err
+	}
+
+	exported, err := r.db.QueryContext(ctx, "SELECT source, source_id, export_id FROM exported_journal_entries WHERE (source IN ($4, $5, $6) AND source_id IN (SELECT id FROM invoices WHERE "+journalInvoicesInPeriod+")) OR (source = $7 AND source_id IN (SELECT id FROM ledger_entries WHERE "+journalLedgerInPeriod+"))",
+		append(args, JournalSourceInvoice, JournalSourceInvoiceVoid, JournalSourceCreditNote, JournalSourceLedger)...)
+	if err != nil {
+		return nil, err
+	}
+	defer exported.Close()
+	for exported.Next() {
+		var key JournalKey
+		var exportID uuid.UUID
+		if err := exported.Scan(&key.Source, &key.SourceID, &exportID); err != nil {
+			return nil, err
+		}
+		sources.Exported[key] = exportID
+	}
+	return sources, exported.Err()
+}
+
+// CreateAccountingExport claims each entry with an insert that skips keys
+// already present, so entries raced for by concurrent exports end up in
+// exactly one of them.
+func (r *accountingExportRepository) CreateAccountingExport(ctx context.Context, export AccountingExport, keys []JournalKey, render func(*AccountingExport, []JournalKey) (*ExportFile, error)) (*ExportFile, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if export.ID == uuid.Nil {
+		export.ID = uuid.New()
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO accounting_exports (id, format, period_from, period_to, entry_count) VALUES ($1, $2, $3, $4, 0)",
+		export.ID, export.Format, export.PeriodFrom, export.PeriodTo); err != nil {
+		return nil, err
+	}
+
+	var claimed []JournalKey
+	for _, key := range keys {
+		result, err := tx.ExecContext(ctx, "INSERT INTO exported_journal_entries (source, source_id, export_id) VALUES ($1, $2, $3) ON CONFLICT (source, source_id) DO NOTHING",
+			key.Source, key.SourceID, export.ID)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return nil, err
+		} else if n > 0 {
+			claimed = append(claimed, key)
+		}
+	}
+	if len(claimed) == 0 {
+		return nil, ErrNothingToExport
+	}
+
+	created, err := scanAccountingExport(tx.QueryRowContext(ctx, "UPDATE accounting_exports SET entry_count = $1 WHERE id = $2 RETURNING "+accountingExportColumns, len(claimed), export.ID))
+	if err != nil {
+		return nil, err
+	}
+	file, err := render(created, claimed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE accounting_exports SET content = $1 WHERE id = $2", file.Content, export.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (r *accountingExportRepository) GetAccountingExportByID(ctx context.Context, id uuid.UUID) (*AccountingExport, error) {
+	return scanAccountingExport(r.db.QueryRowContext(ctx, "SELECT "+accountingExportColumns+" FROM accounting_exports WHERE id = $1", id))
+}
+
+func (r *accountingExportRepository) GetAccountingExportContent(ctx context.Context, id uuid.UUID) ([]byte, error) {
+	var content []byte
+	err := r.db.QueryRowContext(ctx, "SELECT content FROM accounting_exports WHERE id = $1", id).Scan(&content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrExportNotFound
+	}
+	return content, err
+}
+
+func (r *accountingExportRepository) GetAccountingExports(ctx context.Context) ([]*AccountingExport, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+accountingExportColumns+" FROM accounting_exports ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exports []*AccountingExport
+	for rows.Next() {
+		export, err := scanAccountingExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, export)
+	}
+	return exports, rows.Err()
+}
@@ -0,0 +1,255 @@
+package billing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+)
+
+type AccountingExportService interface {
+	AccountMappingManager
+	JournalExporter
+}
+
+type AccountingExportRepository interface {
+	AccountMappingManager
+	JournalSourceReader
+	AccountingExportRecorder
+	AccountingExportReader
+	AccountingExportContentReader
+}
+
+type AccountMappingManager interface {
+	AccountMappingLister
+	AccountMappingCreator
+	AccountMappingUpdater
+	AccountMappingDeleter
+}
+
+type AccountMappingLister interface {
+	GetAccountMappings(ctx context.Context) ([]*AccountMapping, error)
+}
+
+// AccountMappingCreator returns ErrDuplicateAccountMapping if the kind and
+// key are already mapped.
+type AccountMappingCreator interface {
+	CreateAccountMapping(ctx context.Context, mapping AccountMapping) (*AccountMapping, error)
+}
+
+type AccountMappingUpdater interface {
+	UpdateAccountMapping(ctx context.Context, mapping AccountMapping) (*AccountMapping, error)
+}
+
+type AccountMappingDeleter interface {
+	DeleteAccountMapping(ctx context.Context, id uuid.UUID) error
+}
+
+// JournalExporter turns billing activity into journal entries for the
+// bookkeeper's accounting software.
+type JournalExporter interface {
+	// PreviewJournal returns every entry dated from..to, exported or not,
+	// without recording anything.
+	PreviewJournal(ctx context.Context, from, to time.Time) ([]JournalEntry, error)
+
+	// ExportJournal writes the entries dated from..to that no earlier export
+	// contains and records them as exported.
+	ExportJournal(ctx context.Context, format ExportFormat, from, to time.Time) (*ExportFile, error)
+
+	AccountingExportReader
+
+	// DownloadAccountingExport returns the file an earlier export handed
+	// over, byte for byte.
+	DownloadAccountingExport(ctx context.Context, id uuid.UUID) (*ExportFile, error)
+}
+
+type JournalSourceReader interface {
+	GetJournalSources(ctx context.Context, from, to time.Time) (*JournalSources, error)
+}
+
+// AccountingExportRecorder saves export and claims the entries in keys for
+// it. Entries another export claimed first are left out. render writes the
+// file for the keys claimed, and its content is stored with the export in the
+// same transaction. It returns ErrNothingToExport if no entries were claimed.
+type AccountingExportRecorder interface {
+	CreateAccountingExport(ctx context.Context, export AccountingExport, keys []JournalKey, render func(*AccountingExport, []JournalKey) (*ExportFile, error)) (*ExportFile, error)
+}
+
+type AccountingExportReader interface {
+	GetAccountingExportByID(ctx context.Context, id uuid.UUID) (*AccountingExport, error)
+	GetAccountingExports(ctx context.Context) ([]*AccountingExport, error)
+}
+
+// AccountingExportContentReader returns the file content stored when an
+// export was made.
+type AccountingExportContentReader interface {
+	GetAccountingExportContent(ctx context.Context, id uuid.UUID) ([]byte, error)
+}
+
+type accountingExportService struct {
+	repo      AccountingExportRepository
+	customers customers.CustomerRetriever
+	rates     CurrencyConverter
+}
+
+type AccountingExportServiceOption func(*accountingExportService)
+
+// WithJournalConversion converts foreign-currency invoices and payments to
+// the base currency the books are kept in, at the rate of each invoice's
+// issue date and each payment's payment date. Without it, journals holding
+// such entries fail with ErrNoExchangeRate.
+func WithJournalConversion(rates CurrencyConverter) AccountingExportServiceOption {
+	return func(s *accountingExportService) {
+		s.rates = rates
+	}
+}
+
+func NewAccountingExportService(repo AccountingExportRepository, customers customers.CustomerRetriever, opts ...AccountingExportServiceOption) AccountingExportService {
+	s := &accountingExportService{repo: repo, customers: customers}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *accountingExportService) GetAccountMappings(ctx context.Context) ([]*AccountMapping, error) {
+	return s.repo.GetAccountMappings(ctx)
+}
+
+func (s *accountingExportService) CreateAccountMapping(ctx context.Context, mapping AccountMapping) (*AccountMapping, error) {
+	normalizeAccountMapping(&mapping)
+	if err := mapping.validate(); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateAccountMapping(ctx, mapping)
+}
+
+func (s *accountingExportService) UpdateAccountMapping(ctx context.Context, mapping AccountMapping) (*AccountMapping, error) {
+	normalizeAccountMapping(&mapping)
+	if err := mapping.validate(); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateAccountMapping(ctx, mapping)
+}
+
+func (s *accountingExportService) DeleteAccountMapping(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteAccountMapping(ctx, id)
+}
+
+func normalizeAccountMapping(mapping *AccountMapping) {
+	mapping.Key = strings.TrimSpace(mapping.Key)
+	mapping.AccountCode = strings.TrimSpace(mapping.AccountCode)
+	mapping.AccountName = strings.TrimSpace(mapping.AccountName)
+}
+
+func (s *accountingExportService) PreviewJournal(ctx context.Context, from, to time.Time) ([]JournalEntry, error) {
+	from, to, err := exportPeriod(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return s.journal(ctx, from, to)
+}
+
+func (s *accountingExportService) ExportJournal(ctx context.Context, format ExportFormat, from, to time.Time) (*ExportFile, error) {
+	if !format.Valid() {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidExport, format)
+	}
+	from, to, err := exportPeriod(from, to)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.journal(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []JournalEntry
+	var keys []JournalKey
+	for _, entry := range entries {
+		if entry.ExportID == nil {
+			pending = append(pending, entry)
+			keys = append(keys, entry.JournalKey)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, ErrNothingToExport
+	}
+
+	return s.repo.CreateAccountingExport(ctx, AccountingExport{Format: format, PeriodFrom: from, PeriodTo: to}, keys, func(export *AccountingExport, claimed []JournalKey) (*ExportFile, error) {
+		// A concurrent export of an overlapping period may have claimed some
+		// of the entries first.
+		isClaimed := make(map[JournalKey]bool, len(claimed))
+		for _, key := range claimed {
+			isClaimed[key] = true
+		}
+		var exported []JournalEntry
+		for _, entry := range pending {
+			if isClaimed[entry.JournalKey] {
+				entry.ExportID = &export.ID
+				exported = append(exported, entry)
+			}
+		}
+		return renderExport(export, exported)
+	})
+}
+
+func (s *accountingExportService) GetAccountingExportByID(ctx context.Context, id uuid.UUID) (*AccountingExport, error) {
+	return s.repo.GetAccountingExportByID(ctx, id)
+}
+
+func (s *accountingExportService) GetAccountingExports(ctx context.Context) ([]*AccountingExport, error) {
+	return s.repo.GetAccountingExports(ctx)
+}
+
+func (s *accountingExportService) DownloadAccountingExport(ctx context.Context, id uuid.UUID) (*ExportFile, error) {
+	export, err := s.repo.GetAccountingExportByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// The stored file, not one rebuilt from today's mappings and data, is
+	// what the bookkeeper imported.
+	content, err := s.repo.GetAccountingExportContent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return exportFile(export, content)
+}
+
+// journal builds the entries dated from..to with the current account
+// mappings.
+func (s *accountingExportService) journal(ctx context.Context, from, to time.Time) ([]JournalEntry, error) {
+	mappings, err := s.repo.GetAccountMappings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := s.repo.GetJournalSources(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[uuid.UUID]string)
+	name := func(customerID uuid.UUID) (string, error) {
+		if cached, ok := names[customerID]; ok {
+			return cached, nil
+		}
+		customer, err := s.customers.GetCustomerByID(ctx, customerID)
+		if err != nil {
+			return "", fmt.Errorf("failed to load customer: %w", err)
+		}
+		names[customerID] = customerDisplayName(customer)
+		return names[customerID], nil
+	}
+	return buildJournal(sources, newChartOfAccounts(mappings), s.rates, from, to, name)
+}
+
+func exportPeriod(from, to time.Time) (time.Time, time.Time, error) {
+	from, to = dateOnly(from), dateOnly(to)
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: period ends before it starts", ErrInvalidExport)
+	}
+	return from, to, nil
+}
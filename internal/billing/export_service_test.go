@@ -0,0 +1,439 @@
+package billing
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockAccountingExportRepository struct {
+	mock.Mock
+}
+
+func (m *MockAccountingExportRepository) GetAccountMappings(ctx context.Context) ([]*AccountMapping, error) {
+	args := m.Called(ctx)
+	mappings, _ := args.Get(0).([]*AccountMapping)
+	return mappings, args.Error(1)
+}
+
+func (m *MockAccountingExportRepository) CreateAccountMapping(ctx context.Context, mapping AccountMapping) (*AccountMapping, error) {
+	args := m.Called(ctx, mapping)
+	created, _ := args.Get(0).(*AccountMapping)
+	return created, args.Error(1)
+}
+
+func (m *MockAccountingExportRepository) UpdateAccountMapping(ctx context.Context, mapping AccountMapping) (*AccountMapping, error) {
+	args := m.Called(ctx, mapping)
+	updated, _ := args.Get(0).(*AccountMapping)
+	return updated, args.Error(1)
+}
+
+func (m *MockAccountingExportRepository) DeleteAccountMapping(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockAccountingExportRepository) GetJournalSources(ctx context.Context, from, to time.Time) (*JournalSources, error) {
+	args := m.Called(ctx, from, to)
+	sources, _ := args.Get(0).(*JournalSources)
+	return sources, args.Error(1)
+}
+
+// CreateAccountingExport returns the export and claimed keys it is set up
+// with, rendered through render as the repository does.
+func (m *MockAccountingExportRepository) CreateAccountingExport(ctx context.Context, export AccountingExport, keys []JournalKey, render func(*AccountingExport, []JournalKey) (*ExportFile, error)) (*ExportFile, error) {
+	args := m.Called(ctx, export, keys)
+	if err := args.Error(2); err != nil {
+		return nil, err
+	}
+	created, _ := args.Get(0).(*AccountingExport)
+	claimed, _ := args.Get(1).([]JournalKey)
+	return render(created, claimed)
+}
+
+func (m *MockAccountingExportRepository) GetAccountingExportByID(ctx context.Context, id uuid.UUID) (*AccountingExport, error) {
+	args := m.Called(ctx, id)
+	export, _ := args.Get(0).(*AccountingExport)
+	return export, args.Error(1)
+}
+
+func (m *MockAccountingExportRepository) GetAccountingExportContent(ctx context.Context, id uuid.UUID) ([]byte, error) {
+	args := m.Called(ctx, id)
+	content, _ := args.Get(0).([]byte)
+	return content, args.Error(1)
+}
+
+func (m *MockAccountingExportRepository) GetAccountingExports(ctx context.Context) ([]*AccountingExport, error) {
+	args := m.Called(ctx)
+	exports, _ := args.Get(0).([]*AccountingExport)
+	return exports, args.Error(1)
+}
+
+type AccountingExportServiceTestSuite struct {
+	suite.Suite
+	repo      *MockAccountingExportRepository
+	customers *MockCustomerRetriever
+	service   AccountingExportService
+	ctx       context.Context
+	acme      uuid.UUID
+	from, to  time.Time
+}
+
+func (s *AccountingExportServiceTestSuite) SetupTest() {
+	s.repo = new(MockAccountingExportRepository)
+	s.customers = new(MockCustomerRetriever)
+	s.service = NewAccountingExportService(s.repo, s.customers)
+	s.ctx = context.Background()
+	s.acme = uuid.New()
+	s.from, s.to = *date(2026, 6, 1), *date(2026, 6, 30)
+	s.customers.On("GetCustomerByID", s.ctx, s.acme).Return(customers.Customer{CompanyName: "Acme LLC"}, nil).Maybe()
+}
+
+func (s *AccountingExportServiceTestSuite) TearDownTest() {
+	s.repo.AssertExpectations(s.T())
+	s.customers.AssertExpectations(s.T())
+}
+
+func TestAccountingExportServiceSuite(t *testing.T) {
+	suite.Run(t, new(AccountingExportServiceTestSuite))
+}
+
+func testAccountMappings() []*AccountMapping {
+	return []*AccountMapping{
+		{Kind: AccountMappingLedger, Key: string(LedgerAccountCash), AccountCode: "1000", AccountName: "Checking"},
+		{Kind: AccountMappingLedger, Key: string(LedgerAccountReceivables), AccountCode: "1200", AccountName: "Accounts Receivable"},
+		{Kind: AccountMappingLedger, Key: string(LedgerAccountCustomerCredit), AccountCode: "2100", AccountName: "Customer Deposits"},
+		{Kind: AccountMappingLedger, Key: string(LedgerAccountDisputedFunds), AccountCode: "1300", AccountName: "Disputed Funds"},
+		{Kind: AccountMappingRevenue, Key: "", AccountCode: "4000", AccountName: "Sales"},
+		{Kind: AccountMappingRevenue, Key: "hardware", AccountCode: "4100", AccountName: "Sales:Hardware"},
+		{Kind: AccountMappingSalesTax, AccountCode: "2200", AccountName: "Sales Tax Payable"},
+		{Kind: AccountMappingFXGainLoss, AccountCode: "7100", AccountName: "Exchange Gain or Loss"},
+	}
+}
+
+// sentInvoice is an invoice issued on issued with a hardware line, a line
+// with no product and tax.
+func sentInvoice(customerID, hardware uuid.UUID, issued *time.Time) *Invoice {
+	invoice := &Invoice{
+		InvoiceNumber: "INV-000010",
+		Kind:          InvoiceKindInvoice,
+		CustomerID:    customerID,
+		Status:        InvoiceStatusSent,
+		TaxAmount:     usd("15.00"),
+		Total:         usd("165.00"),
+		IssueDate:     issued,
+		SentAt:        issued,
+		Items: []InvoiceItem{
+			{ProductID: &hardware, Description: "Router", Quantity: 1, Total: usd("100.00")},
+			{Description: "Setup", Quantity: 1, Total: usd("50.00")},
+		},
+	}
+	invoice.ID = uuid.New()
+	return invoice
+}
+
+func ledgerPosting(customerID uuid.UUID, entryType LedgerEntryType, amount string, at time.Time) *LedgerPosting {
+	return &LedgerPosting{
+		LedgerEntry: newLedgerEntry(uuid.New(), entryType, usd(amount), at),
+		CustomerID:  customerID,
+	}
+}
+
+func (s *AccountingExportServiceTestSuite) TestPreviewJournal_PostsRevenueByProductCategory() {
+	// Arrange
+	hardware := uuid.New()
+	invoice := sentInvoice(s.acme, hardware, date(2026, 6, 3))
+	s.repo.On("GetAccountMappings", s.ctx).Return(testAccountMappings(), nil)
+	s.repo.On("GetJournalSources", s.ctx, s.from, s.to).Return(&JournalSources{
+		Invoices:          []*Invoice{invoice},
+		ProductCategories: map[uuid.UUID]string{hardware: "hardware"},
+	}, nil)
+
+	// Act
+	entries, err := s.service.PreviewJournal(s.ctx, s.from, s.to)
+
+	// Assert
+	s.Require().NoError(err)
+	s.Require().Len(entries, 1)
+	s.Equal(JournalKey{Source: JournalSourceInvoice, SourceID: invoice.ID}, entries[0].JournalKey)
+	s.Equal("Acme LLC", entries[0].CustomerName)
+	s.Equal([]JournalLine{
+		{Account: Account{Code: "1200", Name: "Accounts Receivable"}, Debit: usd("165.00")},
+		{Account: Account{Code: "4100", Name: "Sales:Hardware"}, Credit: usd("100.00")},
+		{Account: Account{Code: "4000", Name: "Sales"}, Credit: usd("50.00")},
+		{Account: Account{Code: "2200", Name: "Sales Tax Payable"}, Credit: usd("15.00")},
+	}, entries[0].Lines)
+}
+
+func (s *AccountingExportServiceTestSuite) TestPreviewJournal_ReversesCreditNotesAndVoids() {
+	// Arrange
+	hardware := uuid.New()
+	voided := sentInvoice(s.acme, hardware, date(2026, 5, 28))
+	voided.Status, voided.VoidedAt = InvoiceStatusVoid, date(2026, 6, 2)
+	note := sentInvoice(s.acme, hardware, date(2026, 6, 5))
+	note.Kind, note.InvoiceNumber = InvoiceKindCreditNote, "INV-000011"
+	s.repo.On("GetAccountMappings", s.ctx).Return(testAccountMappings(), nil)
+	s.repo.On("GetJournalSources", s.ctx, s.from, s.to).Return(&JournalSources{
+		Invoices:          []*Invoice{voided, note},
+		ProductCategories: map[uuid.UUID]string{hardware: "hardware"},
+	}, nil)
+
+	// Act
+	entries, err := s.service.PreviewJournal(s.ctx, s.from, s.to)
+
+	// Assert
+	s.Require().NoError(err)
+	s.Require().Len(entries, 2, "the void falls in the period but the original issue does not")
+	s.Equal(JournalSourceInvoiceVoid, entries[0].Source)
+	s.Equal(*date(2026, 6, 2), entries[0].Date)
+	s.Equal(JournalSourceCreditNote, entries[1].Source)
+	for _, entry := range entries {
+		s.Equal(usd("165.00"), entry.Lines[0].Credit, "receivables are credited")
+		s.Equal(usd("15.00"), entry.Lines[3].Debit, "sales tax is debited")
+	}
+}
+
+func (s *AccountingExportServiceTestSuite) TestPreviewJournal_ConvertsForeignCurrencyAndPostsRealizedFX() {
+	// Arrange
+	rates, err := ReadExchangeRatesCSV(strings.NewReader("currency,rate,effective_date\nEUR,1.08,2026-03-01\nEUR,1.10,2026-06-08\n"))
+	s.Require().NoError(err)
+	s.service = NewAccountingExportService(s.repo, s.customers, WithJournalConversion(rates))
+	eur := func(amount string) core.Money { return core.MustParseMoney(amount, "EUR") }
+	hardware := uuid.New()
+	invoice := &Invoice{
+		InvoiceNumber: "INV-000012",
+		Kind:          InvoiceKindInvoice,
+		CustomerID:    s.acme,
+		Total:         eur("66.66"),
+		IssueDate:     date(2026, 6, 3),
+		SentAt:        date(2026, 6, 3),
+		Items: []InvoiceItem{
+			{ProductID: &hardware, Description: "Router", Quantity: 1, Total: eur("33.33")},
+			{Description: "Setup", Quantity: 1, Total: eur("33.33")},
+		},
+	}
+	invoice.ID = uuid.New()
+	paid := time.Date(2026, 6, 10, 9, 0, 0, 0, time.UTC)
+	applied := &LedgerPosting{LedgerEntry: newLedgerEntry(uuid.New(), LedgerEntryPaymentApplied, eur("66.66"), paid), PaymentDate: paid, CustomerID: s.acme}
+	applied.RealizedFX = usd("1.34")
+	reversed := &LedgerPosting{LedgerEntry: newLedgerEntry(applied.PaymentID, LedgerEntryApplicationReversed, eur("66.66"), paid.AddDate(0, 0, 5)), PaymentDate: paid, CustomerID: s.acme}
+	reversed.RealizedFX = usd("1.34")
+	s.repo.On("GetAccountMappings", s.ctx).Return(testAccountMappings(), nil)
+	s.repo.On("GetJournalSources", s.ctx, s.from, s.to).Return(&JournalSources{
+		Invoices:          []*Invoice{invoice},
+		Postings:          []*LedgerPosting{applied, reversed},
+		ProductCategories: map[uuid.UUID]string{hardware: "hardware"},
+	}, nil)
+
+	// Act
+	entries, err := s.service.PreviewJournal(s.ctx, s.from, s.to)
+
+	// Assert
+	s.Require().NoError(err)
+	s.Require().Len(entries, 3)
+	s.Equal("Invoice INV-000012 (EUR 66.66)", entries[0].Memo)
+	s.Equal([]JournalLine{
+		{Account: Account{Code: "1200", Name: "Accounts Receivable"}, Debit: usd("71.99")},
+		{Account: Account{Code: "4100", Name: "Sales:Hardware"}, Credit: usd("36.00")},
+		{Account: Account{Code: "4000", Name: "Sales"}, Credit: usd("36.00")},
+		{Account: Account{Code: "7100", Name: "Exchange Gain or Loss"}, Debit: usd("0.01")},
+	}, entries[0].Lines, "each line is converted at the issue date's rate and the rounding goes to exchange gain or loss")
+	s.Equal([]JournalLine{
+		{Account: Account{Code: "2100", Name: "Customer Deposits"}, Debit: usd("73.33")},
+		{Account: Account{Code: "1200", Name: "Accounts Receivable"}, Credit: usd("71.99")},
+		{Account: Account{Code: "7100", Name: "Exchange Gain or Loss"}, Credit: usd("1.34")},
+	}, entries[1].Lines, "receivables clear at their booked value")
+	s.Equal([]JournalLine{
+		{Account: Account{Code: "1200", Name: "Accounts Receivable"}, Debit: usd("71.99")},
+		{Account: Account{Code: "2100", Name: "Customer Deposits"}, Credit: usd("73.33")},
+		{Account: Account{Code: "7100", Name: "Exchange Gain or Loss"}, Debit: usd("1.34")},
+	}, entries[2].Lines, "a reversal gives the gain back")
+}
+
+func (s *AccountingExportServiceTestSuite) TestPreviewJournal_RefusesUnconvertedForeignCurrency() {
+	// Arrange
+	posting := &LedgerPosting{
+		LedgerEntry: newLedgerEntry(uuid.New(), LedgerEntryPaymentReceived, core.MustParseMoney("1000.00", "EUR"), time.Date(2026, 6, 4, 9, 0, 0, 0, time.UTC)),
+		CustomerID:  s.acme,
+	}
+	s.repo.On("GetAccountMappings", s.ctx).Return(testAccountMappings(), nil)
+	s.repo.On("GetJournalSources", s.ctx, s.from, s.to).Return(&JournalSources{Postings: []*LedgerPosting{posting}}, nil)
+
+	// Act
+	entries, err := s.service.PreviewJournal(s.ctx, s.from, s.to)
+
+	// Assert
+	s.ErrorIs(err, ErrNoExchangeRate)
+	s.Nil(entries)
+}
+
+func (s *AccountingExportServiceTestSuite) TestPreviewJournal_UnmappedAccount() {
+	// Arrange
+	posting := ledgerPosting(s.acme, LedgerEntryPaymentReceived, "80.00", time.Date(2026, 6, 4, 9, 0, 0, 0, time.UTC))
+	mappings := testAccountMappings()[1:] // no cash account
+	s.repo.On("GetAccountMappings", s.ctx).Return(mappings, nil)
+	s.repo.On("GetJournalSources", s.ctx, s.from, s.to).Return(&JournalSources{Postings: []*LedgerPosting{posting}}, nil)
+
+	// Act
+	entries, err := s.service.PreviewJournal(s.ctx, s.from, s.to)
+
+	// Assert
+	s.ErrorIs(err, ErrUnmappedAccount)
+	s.ErrorContains(err, "cash")
+	s.Nil(entries)
+}
+
+func (s *AccountingExportServiceTestSuite) TestExportJournal_SkipsEntriesAlreadyExported() {
+	// Arrange
+	earlier := uuid.New()
+	received := ledgerPosting(s.acme, LedgerEntryPaymentReceived, "80.00", time.Date(2026, 6, 4, 9, 0, 0, 0, time.UTC))
+	refunded := ledgerPosting(s.acme, LedgerEntryRefund, "30.00", time.Date(2026, 6, 8, 9, 0, 0, 0, time.UTC))
+	s.repo.On("GetAccountMappings", s.ctx).Return(testAccountMappings(), nil)
+	s.repo.On("GetJournalSources", s.ctx, s.from, s.to).Return(&JournalSources{
+		Postings: []*LedgerPosting{received, refunded},
+		Exported: map[JournalKey]uuid.UUID{{Source: JournalSourceLedger, SourceID: received.ID}: earlier},
+	}, nil)
+	export := &AccountingExport{Format: ExportFormatJournalCSV, PeriodFrom: s.from, PeriodTo: s.to, EntryCount: 1}
+	export.ID = uuid.New()
+	keys := []JournalKey{{Source: JournalSourceLedger, SourceID: refunded.ID}}
+	s.repo.On("CreateAccountingExport", s.ctx, AccountingExport{Format: ExportFormatJournalCSV, PeriodFrom: s.from, PeriodTo: s.to}, keys).Return(export, keys, nil)
+
+	// Act
+	file, err := s.service.ExportJournal(s.ctx, ExportFormatJournalCSV, s.from, s.to)
+
+	// Assert
+	s.Require().NoError(err)
+	s.Equal(export, file.Export)
+	s.Equal("journal-20260601-20260630.csv", file.Filename)
+	s.Equal("date,source,source_id,reference,customer,memo,account_code,account_name,debit,credit,currency\n"+
+		"2026-06-08,ledger_entry,"+refunded.ID.String()+","+refunded.PaymentID.String()+",Acme LLC,Refund,2100,Customer Deposits,30.00,,USD\n"+
+		"2026-06-08,ledger_entry,"+refunded.ID.String()+","+refunded.PaymentID.String()+",Acme LLC,Refund,1000,Checking,,30.00,USD\n",
+		string(file.Content))
+}
+
+func (s *AccountingExportServiceTestSuite) TestExportJournal_LeavesOutEntriesClaimedConcurrently() {
+	// Arrange
+	first := ledgerPosting(s.acme, LedgerEntryPaymentReceived, "80.00", time.Date(2026, 6, 4, 9, 0, 0, 0, time.UTC))
+	second := ledgerPosting(s.acme, LedgerEntryPaymentReceived, "20.00", time.Date(2026, 6, 5, 9, 0, 0, 0, time.UTC))
+	s.repo.On("GetAccountMappings", s.ctx).Return(testAccountMappings(), nil)
+	s.repo.On("GetJournalSources", s.ctx, s.from, s.to).Return(&JournalSources{Postings: []*LedgerPosting{first, second}}, nil)
+	export := &AccountingExport{Format: ExportFormatXeroCSV, PeriodFrom: s.from, PeriodTo: s.to, EntryCount: 1}
+	export.ID = uuid.New()
+	s.repo.On("CreateAccountingExport", s.ctx, mock.Anything, mock.Anything).
+		Return(export, []JournalKey{{Source: JournalSourceLedger, SourceID: second.ID}}, nil)
+
+	// Act
+	file, err := s.service.ExportJournal(s.ctx, ExportFormatXeroCSV, s.from, s.to)
+
+	// Assert
+	s.Require().NoError(err)
+	s.Equal("*Narration,*Date,Description,*AccountCode,*TaxRate,*Amount\n"+
+		"Payment received - Acme LLC,2026-06-05,"+second.PaymentID.String()+",1000,Tax Exempt,20.00\n"+
+		"Payment received - Acme LLC,2026-06-05,"+second.PaymentID.String()+",2100,Tax Exempt,-20.00\n",
+		string(file.Content))
+}
+
+func (s *AccountingExportServiceTestSuite) TestExportJournal_NothingToExport() {
+	// Arrange
+	posting := ledgerPosting(s.acme, LedgerEntryPaymentReceived, "80.00", time.Date(2026, 6, 4, 9, 0, 0, 0, time.UTC))
+	s.repo.On("GetAccountMappings", s.ctx).Return(testAccountMappings(), nil)
+	s.repo.On("GetJournalSources", s.ctx, s.from, s.to).Return(&JournalSources{
+		Postings: []*LedgerPosting{posting},
+		Exported: map[JournalKey]uuid.UUID{{Source: JournalSourceLedger, SourceID: posting.ID}: uuid.New()},
+	}, nil)
+
+	// Act
+	file, err := s.service.ExportJournal(s.ctx, ExportFormatQuickBooksIIF, s.from, s.to)
+
+	// Assert
+	s.ErrorIs(err, ErrNothingToExport)
+	s.Nil(file)
+	s.repo.AssertNotCalled(s.T(), "CreateAccountingExport", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *AccountingExportServiceTestSuite) TestExportJournal_RejectsInvalidRequests() {
+	_, err := s.service.ExportJournal(s.ctx, "sage", s.from, s.to)
+	s.ErrorIs(err, ErrInvalidExport)
+
+	_, err = s.service.ExportJournal(s.ctx, ExportFormatXeroCSV, s.to, s.from)
+	s.ErrorIs(err, ErrInvalidExport)
+}
+
+func (s *AccountingExportServiceTestSuite) TestDownloadAccountingExport_ReturnsTheFileHandedOver() {
+	// Arrange
+	posting := ledgerPosting(s.acme, LedgerEntryPaymentReceived, "80.00", time.Date(2026, 6, 4, 9, 0, 0, 0, time.UTC))
+	s.repo.On("GetAccountMappings", s.ctx).Return(testAccountMappings(), nil)
+	s.repo.On("GetJournalSources", s.ctx, s.from, s.to).Return(&JournalSources{Postings: []*LedgerPosting{posting}}, nil).Once()
+	export := &AccountingExport{Format: ExportFormatQuickBooksIIF, PeriodFrom: s.from, PeriodTo: s.to, EntryCount: 1}
+	export.ID = uuid.New()
+	keys := []JournalKey{{Source: JournalSourceLedger, SourceID: posting.ID}}
+	s.repo.On("CreateAccountingExport", s.ctx, mock.Anything, keys).Return(export, keys, nil)
+	exported, err := s.service.ExportJournal(s.ctx, ExportFormatQuickBooksIIF, s.from, s.to)
+	s.Require().NoError(err)
+	s.repo.On("GetAccountingExportByID", s.ctx, export.ID).Return(export, nil)
+	s.repo.On("GetAccountingExportContent", s.ctx, export.ID).Return(exported.Content, nil)
+
+	// Act
+	file, err := s.service.DownloadAccountingExport(s.ctx, export.ID)
+
+	// Assert
+	s.Require().NoError(err)
+	s.Equal("journal-20260601-20260630.iif", file.Filename)
+	s.Equal("!TRNS\tTRNSTYPE\tDATE\tACCNT\tNAME\tAMOUNT\tDOCNUM\tMEMO\r\n"+
+		"!SPL\tTRNSTYPE\tDATE\tACCNT\tNAME\tAMOUNT\tDOCNUM\tMEMO\r\n"+
+		"!ENDTRNS\r\n"+
+		"TRNS\tGENERAL JOURNAL\t06/04/2026\tChecking\tAcme LLC\t80.00\t"+posting.PaymentID.String()+"\tPayment received\r\n"+
+		"SPL\tGENERAL JOURNAL\t06/04/2026\tCustomer Deposits\tAcme LLC\t-80.00\t"+posting.PaymentID.String()+"\tPayment received\r\n"+
+		"ENDTRNS\r\n",
+		string(file.Content))
+	s.repo.AssertNumberOfCalls(s.T(), "GetJournalSources", 1)
+}
+
+func (s *AccountingExportServiceTestSuite) TestCreateAccountMapping_RejectsUnknownLedgerAccount() {
+	// Act
+	created, err := s.service.CreateAccountMapping(s.ctx, AccountMapping{Kind: AccountMappingLedger, Key: "petty_cash", AccountCode: "1010", AccountName: "Petty Cash"})
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidAccountMapping)
+	s.Nil(created)
+}
+
+func TestLedgerJournalEntry_SkipsAccountsMappedTogether(t *testing.T) {
+	mappings := testAccountMappings()
+	mappings[2].AccountCode, mappings[2].AccountName = "1200", "Accounts Receivable" // customer credit shares receivables
+	posting := ledgerPosting(uuid.New(), LedgerEntryPaymentApplied, "50.00", time.Date(2026, 6, 4, 9, 0, 0, 0, time.UTC))
+
+	entry, err := ledgerJournalEntry(*posting, newChartOfAccounts(mappings), nil)
+
+	if err != nil || entry != nil {
+		t.Fatalf("ledgerJournalEntry() = %v, %v; want nil, nil", entry, err)
+	}
+}
+
+func TestIIFField_StripsSeparators(t *testing.T) {
+	var buf bytes.Buffer
+	entry := JournalEntry{
+		Date:         *date(2026, 6, 4),
+		CustomerName: "Acme\tLLC",
+		Memo:         "line one\nline \"two\"",
+		Lines:        []JournalLine{{Account: Account{Name: "Checking"}, Debit: usd("1.00")}},
+	}
+
+	if err := writeQuickBooksIIF(&buf, []JournalEntry{entry}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "TRNS\tGENERAL JOURNAL\t06/04/2026\tChecking\tAcme LLC\t1.00\t\tline one line 'two'\r\n"
+	if !bytes.Contains(buf.Bytes(), []byte(want)) {
+		t.Errorf("IIF output %q does not contain %q", buf.String(), want)
+	}
+}
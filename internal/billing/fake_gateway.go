@@ -0,0 +1,270 @@
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+// Card numbers with a fixed outcome on FakeGateway. Any other number that
+// passes the Luhn check is approved.
+const (
+	TestCardApproved          = "4242424242424242"
+	TestCardDeclined          = "4000000000000002"
+	TestCardInsufficientFunds = "4000000000009995"
+	TestCardExpired           = "4000000000000069"
+	TestCardIncorrectCVC      = "4000000000000127"
+	TestCardProcessingError   = "4000000000000119" // Fails with ErrGatewayUnavailable
+)
+
+// FakeGateway is an in-memory PaymentGateway for development and tests. It
+// behaves like a card processor, driven by the test card numbers above, and
+// never leaves the process.
+type FakeGateway struct {
+	mu           sync.Mutex
+	now          func() time.Time
+	sequence     int
+	transactions map[string]*fakeTransaction
+	byPayment    map[uuid.UUID]string
+}
+
+type fakeTransaction struct {
+	ID          string                   `json:"id"`
+	PaymentID   uuid.UUID                `json:"payment_id"`
+	Status      GatewayTransactionStatus `json:"status"`
+	Amount      core.Money               `json:"amount"`
+	Captured    core.Money               `json:"captured"`
+	Refunded    core.Money               `json:"refunded"`
+	CardLast4   string                   `json:"card_last4"`
+	DeclineCode string                   `json:"decline_code,omitempty"`
+	Operations  []fakeOperation          `json:"operations"`
+}
+
+type fakeOperation struct {
+	Reference string     `json:"reference"`
+	Type      string     `json:"type"`
+	Amount    core.Money `json:"amount"`
+	At        time.Time  `json:"at"`
+}
+
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{
+		now:          time.Now,
+		transactions: make(map[string]*fakeTransaction),
+		byPayment:    make(map[uuid.UUID]string),
+	}
+}
+
+// Authorize is idempotent per PaymentID: repeating a request returns the
+// original transaction.
+func (g *FakeGateway) Authorize(ctx context.Context, request AuthorizationRequest) (*GatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if id, ok := g.byPayment[request.PaymentID]; ok {
+		txn := g.transactions[id]
+		return g.result(txn), declineError(txn)
+	}
+	if !request.Amount.IsPositive() {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidGatewayRequest)
+	}
+
+	declineCode := ""
+	switch request.Card.Number {
+	case TestCardProcessingError:
+		return nil, fmt.Errorf("%w: processing error", ErrGatewayUnavailable)
+	case TestCardDeclined:
+		declineCode = "card_declined"
+	case TestCardInsufficientFunds:
+		declineCode = "insufficient_funds"
+	case TestCardExpired:
+		declineCode = "expired_card"
+	case TestCardIncorrectCVC:
+		declineCode = "incorrect_cvc"
+	default:
+		now := g.now()
+		switch {
+		case !luhnValid(request.Card.Number):
+			declineCode = "invalid_number"
+		case request.Card.ExpYear < now.Year() || (request.Card.ExpYear == now.Year() && request.Card.ExpMonth < int(now.Month())):
+			declineCode = "expired_card"
+		}
+	}
+
+	g.sequence++
+	txn := &fakeTransaction{
+		ID:        fmt.Sprintf("fake_txn_%06d", g.sequence),
+		PaymentID: request.PaymentID,
+		Status:    GatewayStatusAuthorized,
+		Amount:    request.Amount,
+		Captured:  core.Zero(request.Amount.Currency()),
+		Refunded:  core.Zero(request.Amount.Currency()),
+		CardLast4: request.Card.Last4(),
+	}
+	if declineCode != "" {
+		txn.Status, txn.DeclineCode = GatewayStatusDeclined, declineCode
+	}
+	g.transactions[txn.ID] = txn
+	g.byPayment[request.PaymentID] = txn.ID
+	g.record(txn, "auth", request.Amount)
+	return g.result(txn), declineError(txn)
+}
+
+// Capture settles amount, or the whole authorization if amount is zero.
+func (g *FakeGateway) Capture(ctx context.Context, transactionID string, amount core.Money) (*GatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	txn, err := g.transaction(transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if txn.Status != GatewayStatusAuthorized {
+		return nil, fmt.Errorf("%w: cannot capture a %s transaction", ErrInvalidGatewayRequest, txn.Status)
+	}
+	if amount.IsZero() {
+		amount = txn.Amount
+	}
+	if cmp, err := amount.Cmp(txn.Amount); err != nil {
+		return nil, err
+	} else if cmp > 0 || amount.IsNegative() {
+		return nil, fmt.Errorf("%w: capture must be between zero and the authorized %s", ErrInvalidGatewayRequest, txn.Amount)
+	}
+	txn.Status, txn.Captured = GatewayStatusCaptured, amount
+	g.record(txn, "capture", amount)
+	return g.result(txn), nil
+}
+
+func (g *FakeGateway) Void(ctx context.Context, transactionID string) (*GatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	txn, err := g.transaction(transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if txn.Status != GatewayStatusAuthorized {
+		return nil, fmt.Errorf("%w: cannot void a %s transaction", ErrInvalidGatewayRequest, txn.Status)
+	}
+	txn.Status = GatewayStatusVoided
+	g.record(txn, "void", txn.Amount)
+	return g.result(txn), nil
+}
+
+// Refund returns amount, or everything not yet refunded if amount is zero.
+// The transaction stays captured until it is refunded in full.
+func (g *FakeGateway) Refund(ctx context.Context, transactionID string, amount core.Money) (*GatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	txn, err := g.transaction(transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if txn.Status != GatewayStatusCaptured {
+		return nil, fmt.Errorf("%w: cannot refund a %s transaction", ErrInvalidGatewayRequest, txn.Status)
+	}
+	remaining, err := txn.Captured.Sub(txn.Refunded)
+	if err != nil {
+		return nil, err
+	}
+	if amount.IsZero() {
+		amount = remaining
+	}
+	if cmp, err := amount.Cmp(remaining); err != nil {
+		return nil, err
+	} else if cmp > 0 || !amount.IsPositive() {
+		return nil, fmt.Errorf("%w: refund must be between zero and the remaining %s", ErrInvalidGatewayRequest, remaining)
+	}
+	if txn.Refunded, err = txn.Refunded.Add(amount); err != nil {
+		return nil, err
+	}
+	if cmp, _ := txn.Refunded.Cmp(txn.Captured); cmp == 0 {
+		txn.Status = GatewayStatusRefunded
+	}
+	g.record(txn, "refund", amount)
+	return g.result(txn), nil
+}
+
+func (g *FakeGateway) Status(ctx context.Context, transactionID string) (*GatewayResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	txn, err := g.transaction(transactionID)
+	if err != nil {
+		return nil, err
+	}
+	return g.result(txn), nil
+}
+
+func (g *FakeGateway) transaction(id string) (*fakeTransaction, error) {
+	txn, ok := g.transactions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTransactionNotFound, id)
+	}
+	return txn, nil
+}
+
+func (g *FakeGateway) record(txn *fakeTransaction, kind string, amount core.Money) {
+	g.sequence++
+	txn.Operations = append(txn.Operations, fakeOperation{
+		Reference: fmt.Sprintf("fake_%s_%06d", kind, g.sequence),
+		Type:      kind,
+		Amount:    amount,
+		At:        g.now(),
+	})
+}
+
+// result describes txn as of its latest operation.
+func (g *FakeGateway) result(txn *fakeTransaction) *GatewayResult {
+	last := txn.Operations[len(txn.Operations)-1]
+	raw, _ := json.Marshal(txn)
+	return &GatewayResult{
+		TransactionID:      txn.ID,
+		ProcessorReference: last.Reference,
+		Status:             txn.Status,
+		Amount:             txn.Amount,
+		CapturedAmount:     txn.Captured,
+		RefundedAmount:     txn.Refunded,
+		DeclineCode:        txn.DeclineCode,
+		ProcessedAt:        last.At,
+		Raw:                raw,
+	}
+}
+
+func declineError(txn *fakeTransaction) error {
+	if txn.Status != GatewayStatusDeclined {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrPaymentDeclined, txn.DeclineCode)
+}
+
+// luhnValid reports whether number is a plausible card number.
+func luhnValid(number string) bool {
+	if len(number) < 12 || len(number) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
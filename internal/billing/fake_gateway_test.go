@@ -0,0 +1,81 @@
+package billing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGateway() *FakeGateway {
+	gateway := NewFakeGateway()
+	gateway.now = func() time.Time { return time.Date(2026, 6, 10, 14, 0, 0, 0, time.UTC) }
+	return gateway
+}
+
+func TestFakeGateway_AuthorizeIsIdempotentPerPayment(t *testing.T) {
+	gateway := newTestGateway()
+	request := AuthorizationRequest{PaymentID: uuid.New(), Amount: usd("20.00"), Card: PaymentCard{Number: TestCardApproved, ExpMonth: 12, ExpYear: 2030}}
+
+	first, err := gateway.Authorize(context.Background(), request)
+	require.NoError(t, err)
+	second, err := gateway.Authorize(context.Background(), request)
+	require.NoError(t, err)
+
+	assert.Equal(t, first.TransactionID, second.TransactionID)
+	assert.Equal(t, GatewayStatusAuthorized, second.Status)
+}
+
+func TestFakeGateway_DeclinesByCard(t *testing.T) {
+	tests := []struct {
+		name   string
+		card   PaymentCard
+		reason string
+	}{
+		{"declined", PaymentCard{Number: TestCardDeclined, ExpMonth: 12, ExpYear: 2030}, "card_declined"},
+		{"incorrect cvc", PaymentCard{Number: TestCardIncorrectCVC, ExpMonth: 12, ExpYear: 2030}, "incorrect_cvc"},
+		{"fails luhn", PaymentCard{Number: "4242424242424241", ExpMonth: 12, ExpYear: 2030}, "invalid_number"},
+		{"past expiry", PaymentCard{Number: TestCardApproved, ExpMonth: 5, ExpYear: 2026}, "expired_card"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := newTestGateway().Authorize(context.Background(), AuthorizationRequest{PaymentID: uuid.New(), Amount: usd("20.00"), Card: tt.card})
+
+			assert.ErrorIs(t, err, ErrPaymentDeclined)
+			require.NotNil(t, result)
+			assert.Equal(t, GatewayStatusDeclined, result.Status)
+			assert.Equal(t, tt.reason, result.DeclineCode)
+		})
+	}
+}
+
+func TestFakeGateway_ProcessingErrorIsRetryable(t *testing.T) {
+	result, err := newTestGateway().Authorize(context.Background(), AuthorizationRequest{PaymentID: uuid.New(), Amount: usd("20.00"), Card: PaymentCard{Number: TestCardProcessingError}})
+
+	assert.ErrorIs(t, err, ErrGatewayUnavailable)
+	assert.Nil(t, result)
+}
+
+func TestFakeGateway_PartialRefundKeepsTransactionCaptured(t *testing.T) {
+	ctx := context.Background()
+	gateway := newTestGateway()
+	auth, err := gateway.Authorize(ctx, AuthorizationRequest{PaymentID: uuid.New(), Amount: usd("50.00"), Card: PaymentCard{Number: TestCardApproved, ExpMonth: 12, ExpYear: 2030}})
+	require.NoError(t, err)
+	_, err = gateway.Capture(ctx, auth.TransactionID, usd("0"))
+	require.NoError(t, err)
+
+	partial, err := gateway.Refund(ctx, auth.TransactionID, usd("20.00"))
+	require.NoError(t, err)
+	assert.Equal(t, GatewayStatusCaptured, partial.Status)
+
+	rest, err := gateway.Refund(ctx, auth.TransactionID, usd("0"))
+	require.NoError(t, err)
+	assert.Equal(t, GatewayStatusRefunded, rest.Status)
+	assert.Equal(t, usd("50.00"), rest.RefundedAmount)
+
+	_, err = gateway.Refund(ctx, auth.TransactionID, usd("1.00"))
+	assert.ErrorIs(t, err, ErrInvalidGatewayRequest)
+}
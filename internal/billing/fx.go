@@ -0,0 +1,192 @@
+package billing
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"rva_crm/internal/core"
+)
+
+var (
+	ErrInvalidExchangeRate = errors.New("invalid exchange rate")
+	ErrNoExchangeRate      = errors.New("no exchange rate in effect")
+)
+
+// BaseCurrency is the currency the books are kept in. Catalog prices, price
+// books and fixed discounts are set in it, and reports convert to it.
+const BaseCurrency = core.DefaultCurrency
+
+// ExchangeRate is the value of one unit of Currency in the base currency
+// from EffectiveDate until the currency's next rate takes effect.
+type ExchangeRate struct {
+	Currency      core.Currency
+	EffectiveDate time.Time
+	Rate          *big.Rat // Units of the base currency per unit of Currency, e.g. 1083/1000 for EUR
+}
+
+// CurrencyConverter converts amounts between currencies at the rate in effect
+// on a date.
+type CurrencyConverter interface {
+	Convert(amount core.Money, to core.Currency, on time.Time) (core.Money, error)
+}
+
+// ExchangeRateTable holds each currency's rate history. It is read-only
+// once built and safe for concurrent use.
+type ExchangeRateTable struct {
+	rates map[core.Currency][]ExchangeRate // Oldest first
+}
+
+// NewExchangeRateTable indexes rates, rejecting a currency with two rates on
+// the same day so that a typo in a rate file cannot silently shadow another
+// row.
+func NewExchangeRateTable(rates []ExchangeRate) (*ExchangeRateTable, error) {
+	table := &ExchangeRateTable{rates: make(map[core.Currency][]ExchangeRate)}
+	for i, rate := range rates {
+		rate.Currency = core.Currency(strings.ToUpper(strings.TrimSpace(string(rate.Currency))))
+		rate.EffectiveDate = dateOnly(rate.EffectiveDate)
+		switch {
+		case !rate.Currency.Valid():
+			return nil, fmt.Errorf("%w: rate %d: %w %q", ErrInvalidExchangeRate, i+1, core.ErrUnknownCurrency, rate.Currency)
+		case rate.Currency == BaseCurrency:
+			return nil, fmt.Errorf("%w: rate %d is for the base currency", ErrInvalidExchangeRate, i+1)
+		case rate.EffectiveDate.IsZero():
+			return nil, fmt.Errorf("%w: rate %d has no effective date", ErrInvalidExchangeRate, i+1)
+		case rate.Rate == nil || rate.Rate.Sign() <= 0:
+			return nil, fmt.Errorf("%w: rate %d must be positive", ErrInvalidExchangeRate, i+1)
+		}
+		table.rates[rate.Currency] = append(table.rates[rate.Currency], rate)
+	}
+	for currency, history := range table.rates {
+		slices.SortFunc(history, func(a, b ExchangeRate) int {
+			return a.EffectiveDate.Compare(b.EffectiveDate)
+		})
+		for i := 1; i < len(history); i++ {
+			if history[i].EffectiveDate.Equal(history[i-1].EffectiveDate) {
+				return nil, fmt.Errorf("%w: %s has two rates effective %s", ErrInvalidExchangeRate, currency, history[i].EffectiveDate.Format(time.DateOnly))
+			}
+		}
+	}
+	return table, nil
+}
+
+// RateOn returns the units of the base currency one unit of currency was
+// worth on the date: the latest rate effective on or before it. The base
+// currency is always worth 1.
+func (t *ExchangeRateTable) RateOn(currency core.Currency, on time.Time) (*big.Rat, error) {
+	if currency == BaseCurrency {
+		return big.NewRat(1, 1), nil
+	}
+	on = dateOnly(on)
+	history := t.rates[currency]
+	i, _ := slices.BinarySearchFunc(history, on, func(rate ExchangeRate, on time.Time) int {
+		if rate.EffectiveDate.After(on) {
+			return 1
+		}
+		return -1
+	})
+	if i == 0 {
+		return nil, fmt.Errorf("%w: %s on %s", ErrNoExchangeRate, currency, on.Format(time.DateOnly))
+	}
+	return history[i-1].Rate, nil
+}
+
+// Convert returns amount in currency to at the rates in effect on the date,
+// crossing through the base currency and rounding half to even once.
+func (t *ExchangeRateTable) Convert(amount core.Money, to core.Currency, on time.Time) (core.Money, error) {
+	from := currencyOf(amount)
+	if from == to {
+		return amount.WithCurrency(to), nil
+	}
+	fromRate, err := t.RateOn(from, on)
+	if err != nil {
+		return core.Money{}, err
+	}
+	toRate, err := t.RateOn(to, on)
+	if err != nil {
+		return core.Money{}, err
+	}
+	return amount.Convert(new(big.Rat).Quo(fromRate, toRate), to, core.RoundHalfEven)
+}
+
+// ReadExchangeRatesCSV parses a rate table with the header
+// currency,rate,effective_date where rate is the base-currency value of one
+// unit, such as 1.0832, and effective_date is YYYY-MM-DD.
+func ReadExchangeRatesCSV(r io.Reader) (*ExchangeRateTable, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExchangeRate, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidExchangeRate)
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"currency", "rate", "effective_date"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", ErrInvalidExchangeRate, name)
+		}
+	}
+
+	rates := make([]ExchangeRate, 0, len(records)-1)
+	for i, record := range records[1:] {
+		rate, ok := new(big.Rat).SetString(strings.TrimSpace(record[columns["rate"]]))
+		if !ok {
+			return nil, fmt.Errorf("%w: line %d: rate %q is not a number", ErrInvalidExchangeRate, i+2, record[columns["rate"]])
+		}
+		effective, err := time.Parse(time.DateOnly, strings.TrimSpace(record[columns["effective_date"]]))
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: effective_date %q is not YYYY-MM-DD", ErrInvalidExchangeRate, i+2, record[columns["effective_date"]])
+		}
+		rates = append(rates, ExchangeRate{
+			Currency:      core.Currency(record[columns["currency"]]),
+			EffectiveDate: effective,
+			Rate:          rate,
+		})
+	}
+	return NewExchangeRateTable(rates)
+}
+
+// LoadExchangeRatesFile reads a rate table from a local CSV file.
+func LoadExchangeRatesFile(path string) (*ExchangeRateTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadExchangeRatesCSV(f)
+}
+
+// toBase converts amount to the base currency at the rates of the date.
+func toBase(rates CurrencyConverter, amount core.Money, on time.Time) (core.Money, error) {
+	if currencyOf(amount) == BaseCurrency {
+		return amount.WithCurrency(BaseCurrency), nil
+	}
+	return rates.Convert(amount, BaseCurrency, on)
+}
+
+// realizedFX is the exchange gain (positive) or loss, in the base currency,
+// of settling amount of an invoice issued on issued with money received on
+// paid.
+func realizedFX(rates CurrencyConverter, amount core.Money, issued, paid time.Time) (core.Money, error) {
+	if currencyOf(amount) == BaseCurrency {
+		return core.Zero(BaseCurrency), nil
+	}
+	booked, err := toBase(rates, amount, issued)
+	if err != nil {
+		return core.Money{}, err
+	}
+	received, err := toBase(rates, amount, paid)
+	if err != nil {
+		return core.Money{}, err
+	}
+	return received.Sub(booked)
+}
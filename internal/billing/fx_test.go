@@ -0,0 +1,108 @@
+package billing
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testExchangeRates = `currency,rate,effective_date
+EUR,1.10,2026-01-01
+EUR,1.08,2026-03-01
+CAD,0.74,2026-01-01
+JPY,0.0066,2026-01-01
+`
+
+func testRateTable(t *testing.T) *ExchangeRateTable {
+	t.Helper()
+	rates, err := ReadExchangeRatesCSV(strings.NewReader(testExchangeRates))
+	require.NoError(t, err)
+	return rates
+}
+
+func TestExchangeRateTable_RateOnUsesLatestEffectiveRate(t *testing.T) {
+	rates := testRateTable(t)
+
+	rate, err := rates.RateOn(core.EUR, time.Date(2026, 2, 28, 23, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, big.NewRat(11, 10), rate)
+
+	rate, err = rates.RateOn(core.EUR, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, big.NewRat(27, 25), rate)
+
+	rate, err = rates.RateOn(BaseCurrency, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, big.NewRat(1, 1), rate)
+
+	_, err = rates.RateOn(core.EUR, time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC))
+	assert.ErrorIs(t, err, ErrNoExchangeRate)
+	_, err = rates.RateOn(core.GBP, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC))
+	assert.ErrorIs(t, err, ErrNoExchangeRate)
+}
+
+func TestExchangeRateTable_ConvertCrossesThroughBase(t *testing.T) {
+	rates := testRateTable(t)
+	on := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	eur, err := rates.Convert(usd("108.00"), core.EUR, on)
+	require.NoError(t, err)
+	assert.Equal(t, core.MustParseMoney("100.00", core.EUR), eur)
+
+	// 100 CAD = 74 USD = 68.52 EUR at 1.08.
+	eur, err = rates.Convert(core.MustParseMoney("100.00", core.CAD), core.EUR, on)
+	require.NoError(t, err)
+	assert.Equal(t, core.MustParseMoney("68.52", core.EUR), eur)
+
+	yen, err := rates.Convert(usd("99.00"), core.JPY, on)
+	require.NoError(t, err)
+	assert.Equal(t, core.NewMoney(15000, core.JPY), yen)
+}
+
+func TestNewExchangeRateTable_RejectsBadRates(t *testing.T) {
+	day := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := map[string][]ExchangeRate{
+		"unknown currency": {{Currency: "XYZ", EffectiveDate: day, Rate: big.NewRat(1, 1)}},
+		"base currency":    {{Currency: BaseCurrency, EffectiveDate: day, Rate: big.NewRat(1, 1)}},
+		"zero rate":        {{Currency: core.EUR, EffectiveDate: day, Rate: new(big.Rat)}},
+		"no date":          {{Currency: core.EUR, Rate: big.NewRat(1, 1)}},
+		"same day twice": {
+			{Currency: core.EUR, EffectiveDate: day, Rate: big.NewRat(1, 1)},
+			{Currency: "eur", EffectiveDate: day.Add(9 * time.Hour), Rate: big.NewRat(2, 1)},
+		},
+	}
+	for name, rates := range cases {
+		_, err := NewExchangeRateTable(rates)
+		assert.ErrorIs(t, err, ErrInvalidExchangeRate, name)
+	}
+
+	_, err := ReadExchangeRatesCSV(strings.NewReader("currency,rate\nEUR,1.1\n"))
+	assert.ErrorIs(t, err, ErrInvalidExchangeRate)
+	_, err = ReadExchangeRatesCSV(strings.NewReader("currency,rate,effective_date\nEUR,1.1,01/01/2026\n"))
+	assert.ErrorIs(t, err, ErrInvalidExchangeRate)
+}
+
+func TestRealizedFX_GainWhenCurrencyStrengthens(t *testing.T) {
+	rates := testRateTable(t)
+	issued := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	paid := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	// Booked at 1.10 for USD 550.00, received at 1.08 for USD 540.00.
+	loss, err := realizedFX(rates, core.MustParseMoney("500.00", core.EUR), issued, paid)
+	require.NoError(t, err)
+	assert.Equal(t, usd("-10.00"), loss)
+
+	gain, err := realizedFX(rates, core.MustParseMoney("500.00", core.EUR), paid, issued)
+	require.NoError(t, err)
+	assert.Equal(t, usd("10.00"), gain)
+
+	none, err := realizedFX(rates, usd("500.00"), issued, paid)
+	require.NoError(t, err)
+	assert.True(t, none.IsZero())
+}
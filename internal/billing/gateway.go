@@ -0,0 +1,93 @@
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrPaymentDeclined       = errors.New("payment was declined")
+	ErrGatewayUnavailable    = errors.New("payment gateway is unavailable")
+	ErrTransactionNotFound   = errors.New("gateway transaction not found")
+	ErrInvalidGatewayRequest = errors.New("invalid gateway request")
+	ErrNoPaymentGateway      = errors.New("no payment gateway is configured")
+	ErrInvalidPaymentStatus  = errors.New("payment status transition is not allowed")
+	ErrPaymentStatusConflict = errors.New("payment status was changed by another request")
+	ErrPaymentNotAuthorized  = errors.New("payment has no open authorization")
+	ErrUnsupportedMethod     = errors.New("payment method is not processed through the gateway")
+)
+
+// PaymentGateway is a card processor. Authorize reserves funds without
+// moving them; Capture settles all or part of an authorization and Void
+// releases it. Refund returns captured funds. Status reports the processor's
+// current view of a transaction.
+//
+// Implementations return ErrPaymentDeclined, wrapped with the decline
+// reason, alongside a result recording the decline, and ErrGatewayUnavailable
+// for transient failures where the request may be retried.
+type PaymentGateway interface {
+	Authorize(ctx context.Context, request AuthorizationRequest) (*GatewayResult, error)
+	Capture(ctx context.Context, transactionID string, amount core.Money) (*GatewayResult, error)
+	Void(ctx context.Context, transactionID string) (*GatewayResult, error)
+	Refund(ctx context.Context, transactionID string, amount core.Money) (*GatewayResult, error)
+	Status(ctx context.Context, transactionID string) (*GatewayResult, error)
+}
+
+// PaymentCard is the card presented for an authorization. It is passed to
+// the gateway and never stored.
+type PaymentCard struct {
+	Number   string `json:"number"`
+	ExpMonth int    `json:"exp_month"`
+	ExpYear  int    `json:"exp_year"`
+	CVC      string `json:"cvc"`
+}
+
+// Last4 is the part of the card number safe to keep and display.
+func (c PaymentCard) Last4() string {
+	digits := make([]rune, 0, len(c.Number))
+	for _, r := range c.Number {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+	if len(digits) < 4 {
+		return string(digits)
+	}
+	return string(digits[len(digits)-4:])
+}
+
+type AuthorizationRequest struct {
+	PaymentID  uuid.UUID // Used as the idempotency key
+	CustomerID uuid.UUID
+	Amount     core.Money
+	Card       PaymentCard
+}
+
+type GatewayTransactionStatus string
+
+const (
+	GatewayStatusAuthorized GatewayTransactionStatus = "authorized"
+	GatewayStatusCaptured   GatewayTransactionStatus = "captured"
+	GatewayStatusVoided     GatewayTransactionStatus = "voided"
+	GatewayStatusRefunded   GatewayTransactionStatus = "refunded"
+	GatewayStatusDeclined   GatewayTransactionStatus = "declined"
+)
+
+// GatewayResult is the processor's response to one operation.
+type GatewayResult struct {
+	TransactionID      string                   `json:"transaction_id"`
+	ProcessorReference string                   `json:"processor_reference"` // Reference for this operation, e.g. a capture or refund ID
+	Status             GatewayTransactionStatus `json:"status"`
+	Amount             core.Money               `json:"amount"`          // Authorized amount
+	CapturedAmount     core.Money               `json:"captured_amount"` // Settled amount, before refunds
+	RefundedAmount     core.Money               `json:"refunded_amount"`
+	DeclineCode        string                   `json:"decline_code,omitempty"`
+	ProcessedAt        time.Time                `json:"processed_at"`
+	Raw                json.RawMessage          `json:"raw"` // Processor response as received
+}
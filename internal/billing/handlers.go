@@ -1 +1,550 @@
-package billing
\ No newline at end of file
+package billing
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+type productHandler struct {
+	service ProductService
+}
+
+type priceBookHandler struct {
+	service PriceBookService
+}
+
+type priceBookEntryHandler struct {
+	service PriceBookService
+}
+
+type priceHandler struct {
+	service PriceResolver
+}
+
+type orderHandler struct {
+	service OrderService
+}
+
+type orderStatusHandler struct {
+	service OrderStatusTransitioner
+}
+
+func (h *productHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getProduct(w, r)
+	case http.MethodPost:
+		h.createProduct(w, r)
+	case http.MethodPut:
+		h.updateProduct(w, r)
+	case http.MethodDelete:
+		h.deleteProduct(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *priceBookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getPriceBook(w, r)
+	case http.MethodPost:
+		h.createPriceBook(w, r)
+	case http.MethodPut:
+		h.updatePriceBook(w, r)
+	case http.MethodDelete:
+		h.deletePriceBook(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *priceBookEntryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.addPriceBookEntry(w, r)
+	case http.MethodDelete:
+		h.deletePriceBookEntry(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *priceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.resolvePrice(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *orderHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getOrder(w, r)
+	case http.MethodPost:
+		h.createOrder(w, r)
+	case http.MethodPut:
+		h.updateOrder(w, r)
+	case http.MethodDelete:
+		h.deleteOrder(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *orderStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.transitionOrder(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func NewProductHandler(service ProductService) http.Handler {
+	return &productHandler{service: service}
+}
+
+func NewPriceBookHandler(service PriceBookService) http.Handler {
+	return &priceBookHandler{service: service}
+}
+
+func NewPriceBookEntryHandler(service PriceBookService) http.Handler {
+	return &priceBookEntryHandler{service: service}
+}
+
+// NewPriceHandler answers GET ?customer_id=&product_id=&date=YYYY-MM-DD. The
+// date defaults to today.
+func NewPriceHandler(service PriceResolver) http.Handler {
+	return &priceHandler{service: service}
+}
+
+func NewOrderHandler(service OrderService) http.Handler {
+	return &orderHandler{service: service}
+}
+
+// NewOrderStatusHandler moves the order given by ?id= to the status in a
+// {"status": "..."} body.
+func NewOrderStatusHandler(service OrderStatusTransitioner) http.Handler {
+	return &orderStatusHandler{service: service}
+}
+
+// errorStatuses maps billing errors onto HTTP status codes. Errors not
+// listed are reported as 500.
+var errorStatuses = []struct {
+	err    error
+	status int
+}{
+	{ErrProductNotFound, http.StatusNotFound},
+	{ErrPriceBookNotFound, http.StatusNotFound},
+	{ErrOrderNotFound, http.StatusNotFound},
+	{ErrInvoiceNotFound, http.StatusNotFound},
+	{ErrPaymentNotFound, http.StatusNotFound},
+	{ErrRefundNotFound, http.StatusNotFound},
+	{ErrChargebackNotFound, http.StatusNotFound},
+	{ErrSubscriptionNotFound, http.StatusNotFound},
+	{ErrExemptionNotFound, http.StatusNotFound},
+	{ErrDiscountRuleNotFound, http.StatusNotFound},
+	{ErrCouponNotFound, http.StatusNotFound},
+	{ErrQuoteNotFound, http.StatusNotFound},
+	{ErrDuplicateSKU, http.StatusConflict},
+	{ErrInvalidProduct, http.StatusUnprocessableEntity},
+	{ErrInvalidPriceBook, http.StatusUnprocessableEntity},
+	{ErrInvalidPriceEntry, http.StatusUnprocessableEntity},
+	{ErrProductUnavailable, http.StatusUnprocessableEntity},
+	{ErrInvalidOrder, http.StatusUnprocessableEntity},
+	{ErrOrderLocked, http.StatusConflict},
+	{ErrInvalidTransition, http.StatusConflict},
+	{ErrOrderStatusConflict, http.StatusConflict},
+	{ErrPaymentsCaptured, http.StatusConflict},
+	{ErrCreditLimitExceeded, http.StatusUnprocessableEntity},
+	{ErrInvalidTaxCategory, http.StatusUnprocessableEntity},
+	{ErrInvalidExemption, http.StatusUnprocessableEntity},
+	{ErrInvalidDiscountRule, http.StatusUnprocessableEntity},
+	{ErrInvalidCoupon, http.StatusUnprocessableEntity},
+	{ErrDuplicateCoupon, http.StatusConflict},
+	{ErrCouponUnavailable, http.StatusUnprocessableEntity},
+	{ErrInvalidQuote, http.StatusUnprocessableEntity},
+	{ErrQuoteNotDraft, http.StatusConflict},
+	{ErrQuoteNotSent, http.StatusConflict},
+	{ErrQuoteExpired, http.StatusConflict},
+	{ErrQuoteSuperseded, http.StatusConflict},
+	{ErrQuoteNotRevisable, http.StatusConflict},
+	{ErrQuoteStatusConflict, http.StatusConflict},
+	{ErrInvalidInvoice, http.StatusUnprocessableEntity},
+	{ErrInvalidPayment, http.StatusUnprocessableEntity},
+	{ErrOverApplied, http.StatusUnprocessableEntity},
+	{ErrInvoiceNotDraft, http.StatusConflict},
+	{ErrInvoiceNotOpen, http.StatusConflict},
+	{ErrInvoiceHasActivity, http.StatusConflict},
+	{ErrOrderAlreadyInvoiced, http.StatusConflict},
+	{ErrOrderNotInvoiceable, http.StatusConflict},
+	{ErrInvalidPeriod, http.StatusBadRequest},
+	{ErrOrderNotPayable, http.StatusConflict},
+	{ErrInsufficientCredit, http.StatusUnprocessableEntity},
+	{ErrPaymentDeclined, http.StatusPaymentRequired},
+	{ErrUnsupportedMethod, http.StatusUnprocessableEntity},
+	{ErrInvalidGatewayRequest, http.StatusUnprocessableEntity},
+	{ErrInvalidPaymentStatus, http.StatusConflict},
+	{ErrPaymentStatusConflict, http.StatusConflict},
+	{ErrPaymentNotAuthorized, http.StatusConflict},
+	{ErrTransactionNotFound, http.StatusBadGateway},
+	{ErrGatewayUnavailable, http.StatusServiceUnavailable},
+	{ErrNoPaymentGateway, http.StatusServiceUnavailable},
+	{ErrInvalidRefund, http.StatusUnprocessableEntity},
+	{ErrInvalidChargeback, http.StatusUnprocessableEntity},
+	{ErrExceedsReversibleFunds, http.StatusUnprocessableEntity},
+	{ErrInvalidDisputeStatus, http.StatusConflict},
+	{ErrDisputeStatusConflict, http.StatusConflict},
+	{ErrInvalidSubscription, http.StatusUnprocessableEntity},
+	{ErrSubscriptionNotLive, http.StatusConflict},
+	{ErrSubscriptionConflict, http.StatusConflict},
+	{ErrCycleAlreadyBilled, http.StatusConflict},
+	{ErrDunningNoticeExists, http.StatusConflict},
+	{ErrAccountMappingNotFound, http.StatusNotFound},
+	{ErrInvalidAccountMapping, http.StatusUnprocessableEntity},
+	{ErrDuplicateAccountMapping, http.StatusConflict},
+	{ErrUnmappedAccount, http.StatusUnprocessableEntity},
+	{ErrUnbalancedJournalEntry, http.StatusUnprocessableEntity},
+	{ErrExportNotFound, http.StatusNotFound},
+	{ErrInvalidExport, http.StatusUnprocessableEntity},
+	{ErrNothingToExport, http.StatusConflict},
+	{ErrNoExchangeRate, http.StatusUnprocessableEntity},
+	{ErrInvalidStockMovement, http.StatusUnprocessableEntity},
+	{ErrInventoryNotTracked, http.StatusUnprocessableEntity},
+	{ErrInsufficientStock, http.StatusConflict},
+	{core.ErrCurrencyMismatch, http.StatusUnprocessableEntity},
+	{core.ErrUnknownCurrency, http.StatusUnprocessableEntity},
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	for _, e := range errorStatuses {
+		if errors.Is(err, e.err) {
+			status = e.status
+			break
+		}
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// queryUUID parses a required UUID query parameter, writing a 400 if it is
+// missing or malformed.
+func queryUUID(w http.ResponseWriter, r *http.Request, key string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.URL.Query().Get(key))
+	if err != nil {
+		http.Error(w, "invalid "+key, http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// queryDate parses an optional YYYY-MM-DD query parameter, defaulting to
+// today, writing a 400 if it is malformed.
+func queryDate(w http.ResponseWriter, r *http.Request, key string) (time.Time, bool) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return dateOnly(time.Now()), true
+	}
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		http.Error(w, "invalid "+key+", expected YYYY-MM-DD", http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	return parsed, true
+}
+
+func (h *productHandler) getProduct(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch {
+	case query.Has("id"):
+		productID, ok := queryUUID(w, r, "id")
+		if !ok {
+			return
+		}
+		product, err := h.service.GetProductByID(r.Context(), productID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(product)
+	case query.Has("sku"):
+		product, err := h.service.GetProductBySKU(r.Context(), query.Get("sku"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(product)
+	default:
+		products, err := h.service.ListProducts(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(products)
+	}
+}
+
+func (h *productHandler) createProduct(w http.ResponseWriter, r *http.Request) {
+	var product Product
+	err := json.NewDecoder(r.Body).Decode(&product)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	createdProduct, err := h.service.CreateProduct(r.Context(), product)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createdProduct)
+}
+
+func (h *productHandler) updateProduct(w http.ResponseWriter, r *http.Request) {
+	var product Product
+	err := json.NewDecoder(r.Body).Decode(&product)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updatedProduct, err := h.service.UpdateProduct(r.Context(), product)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(updatedProduct)
+}
+
+func (h *productHandler) deleteProduct(w http.ResponseWriter, r *http.Request) {
+	productID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	err := h.service.DeleteProduct(r.Context(), productID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Product deleted successfully"})
+}
+
+func (h *priceBookHandler) getPriceBook(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.Query().Has("id") {
+		books, err := h.service.ListPriceBooks(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(books)
+		return
+	}
+	bookID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	book, err := h.service.GetPriceBookByID(r.Context(), bookID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(book)
+}
+
+func (h *priceBookHandler) createPriceBook(w http.ResponseWriter, r *http.Request) {
+	var book PriceBook
+	err := json.NewDecoder(r.Body).Decode(&book)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	createdBook, err := h.service.CreatePriceBook(r.Context(), book)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createdBook)
+}
+
+func (h *priceBookHandler) updatePriceBook(w http.ResponseWriter, r *http.Request) {
+	var book PriceBook
+	err := json.NewDecoder(r.Body).Decode(&book)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updatedBook, err := h.service.UpdatePriceBook(r.Context(), book)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(updatedBook)
+}
+
+func (h *priceBookHandler) deletePriceBook(w http.ResponseWriter, r *http.Request) {
+	bookID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	err := h.service.DeletePriceBook(r.Context(), bookID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Price book deleted successfully"})
+}
+
+func (h *priceBookEntryHandler) addPriceBookEntry(w http.ResponseWriter, r *http.Request) {
+	var entry PriceBookEntry
+	err := json.NewDecoder(r.Body).Decode(&entry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	createdEntry, err := h.service.AddPriceBookEntry(r.Context(), entry)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createdEntry)
+}
+
+func (h *priceBookEntryHandler) deletePriceBookEntry(w http.ResponseWriter, r *http.Request) {
+	entryID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	err := h.service.DeletePriceBookEntry(r.Context(), entryID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Price book entry deleted successfully"})
+}
+
+func (h *priceHandler) resolvePrice(w http.ResponseWriter, r *http.Request) {
+	customerID, ok := queryUUID(w, r, "customer_id")
+	if !ok {
+		return
+	}
+	productID, ok := queryUUID(w, r, "product_id")
+	if !ok {
+		return
+	}
+	on := time.Now()
+	if date := r.URL.Query().Get("date"); date != "" {
+		parsed, err := time.Parse(time.DateOnly, date)
+		if err != nil {
+			http.Error(w, "invalid date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		on = parsed
+	}
+	price, err := h.service.ResolvePrice(r.Context(), customerID, productID, on)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(price)
+}
+
+func (h *orderHandler) getOrder(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("customer_id") {
+		customerID, ok := queryUUID(w, r, "customer_id")
+		if !ok {
+			return
+		}
+		orders, err := h.service.GetOrdersByCustomerID(r.Context(), customerID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(orders)
+		return
+	}
+	orderID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	order, err := h.service.GetOrderByID(r.Context(), orderID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(order)
+}
+
+func (h *orderHandler) createOrder(w http.ResponseWriter, r *http.Request) {
+	var order Order
+	err := json.NewDecoder(r.Body).Decode(&order)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	createdOrder, err := h.service.CreateOrder(r.Context(), order)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createdOrder)
+}
+
+func (h *orderHandler) updateOrder(w http.ResponseWriter, r *http.Request) {
+	var order Order
+	err := json.NewDecoder(r.Body).Decode(&order)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updatedOrder, err := h.service.UpdateOrder(r.Context(), order)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(updatedOrder)
+}
+
+func (h *orderHandler) deleteOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	err := h.service.DeleteOrder(r.Context(), orderID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Order deleted successfully"})
+}
+
+func (h *orderStatusHandler) transitionOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	var body struct {
+		Status OrderStatus `json:"status"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	order, err := h.service.TransitionOrder(r.Context(), orderID, body.Status)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(order)
+}
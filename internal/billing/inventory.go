@@ -0,0 +1,118 @@
+package billing
+
+import (
+	"errors"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidStockMovement = errors.New("invalid stock movement")
+	ErrInsufficientStock    = errors.New("insufficient stock")
+	ErrInventoryNotTracked  = errors.New("product does not track inventory")
+)
+
+type StockMovementType string
+
+const (
+	StockMovementReceipt     StockMovementType = "receipt"     // Goods received into stock
+	StockMovementReservation StockMovementType = "reservation" // Held for a confirmed order
+	StockMovementRelease     StockMovementType = "release"     // Reservation given back by a cancelled order
+	StockMovementShipment    StockMovementType = "shipment"    // Reserved goods leaving with a shipped order
+	StockMovementAdjustment  StockMovementType = "adjustment"  // Stock count correction, damage or loss
+)
+
+// StockMovement is one change to a product's stock. Quantity is positive
+// except for adjustments, which are negative when stock is written off.
+// Receipts and adjustments are recorded through the inventory service; the
+// order repository records the others as orders are confirmed, cancelled
+// and shipped.
+type StockMovement struct {
+	core.BaseModel
+	ProductID uuid.UUID         `json:"product_id"`
+	Type      StockMovementType `json:"type"`
+	Quantity  int               `json:"quantity"`
+	OrderID   *uuid.UUID        `json:"order_id"` // Reservations, releases and shipments
+	Reason    string            `json:"reason"`   // Required for adjustments, e.g. a delivery note for receipts
+
+	// The product's quantities once the movement was applied
+	StockAfter    int `json:"stock_after"`
+	ReservedAfter int `json:"reserved_after"`
+
+	// Set when the movement took available stock from above the product's
+	// LowStockAlert to at or below it
+	LowStock bool `json:"low_stock"`
+}
+
+// stockChange returns how a movement of quantity changes the stock on hand
+// and the reserved stock.
+func stockChange(kind StockMovementType, quantity int) (onHand, reserved int) {
+	switch kind {
+	case StockMovementReceipt, StockMovementAdjustment:
+		return quantity, 0
+	case StockMovementReservation:
+		return 0, quantity
+	case StockMovementRelease:
+		return 0, -quantity
+	case StockMovementShipment:
+		return -quantity, -quantity
+	}
+	return 0, 0
+}
+
+// applyStockMovement fills the movement's resulting quantities from the
+// product's current stock and returns the product as it will be after it.
+// Available stock may not go negative, so a reservation or write-off larger
+// than what is available fails with ErrInsufficientStock.
+func applyStockMovement(product Product, movement *StockMovement) (Product, error) {
+	onHand, reserved := stockChange(movement.Type, movement.Quantity)
+	after := product
+	after.StockQuantity += onHand
+	after.ReservedQuantity += reserved
+	if after.ReservedQuantity < 0 || after.AvailableQuantity() < 0 {
+		return Product{}, ErrInsufficientStock
+	}
+	movement.StockAfter, movement.ReservedAfter = after.StockQuantity, after.ReservedQuantity
+	movement.LowStock = product.AvailableQuantity() > product.LowStockAlert && after.AvailableQuantity() <= product.LowStockAlert
+	return after, nil
+}
+
+// ProductStockLow is published when a stock movement takes a product's
+// available stock to or below its LowStockAlert threshold. It is raised once
+// per crossing: stock must rise above the threshold again before the next.
+type ProductStockLow struct {
+	ProductID  uuid.UUID  `json:"product_id"`
+	MovementID uuid.UUID  `json:"movement_id"`
+	OrderID    *uuid.UUID `json:"order_id"`
+	Available  int        `json:"available"`
+	OccurredAt time.Time  `json:"occurred_at"`
+}
+
+// ProductStockLowEvent is the event name of ProductStockLow.
+const ProductStockLowEvent = "product.stock_low"
+
+func (e ProductStockLow) EventName() string {
+	return ProductStockLowEvent
+}
+
+// stockLowEvents returns a ProductStockLow for every movement that crossed
+// its product's threshold.
+func stockLowEvents(movements []StockMovement) []ProductStockLow {
+	var events []ProductStockLow
+	for _, movement := range movements {
+		if !movement.LowStock {
+			continue
+		}
+		events = append(events, ProductStockLow{
+			ProductID:  movement.ProductID,
+			MovementID: movement.ID,
+			OrderID:    movement.OrderID,
+			Available:  movement.StockAfter - movement.ReservedAfter,
+			OccurredAt: movement.CreatedAt,
+		})
+	}
+	return events
+}
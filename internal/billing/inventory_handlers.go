@@ -0,0 +1,56 @@
+package billing
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type stockMovementHandler struct {
+	service InventoryService
+}
+
+// NewStockMovementHandler serves stock movements: GET ?product_id= for a
+// product's history, newest first, and POST to record a receipt or an
+// adjustment.
+func NewStockMovementHandler(service InventoryService) http.Handler {
+	return &stockMovementHandler{service: service}
+}
+
+func (h *stockMovementHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getMovements(w, r)
+	case http.MethodPost:
+		h.recordMovement(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *stockMovementHandler) getMovements(w http.ResponseWriter, r *http.Request) {
+	productID, ok := queryUUID(w, r, "product_id")
+	if !ok {
+		return
+	}
+	movements, err := h.service.GetStockMovementsByProductID(r.Context(), productID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(movements)
+}
+
+func (h *stockMovementHandler) recordMovement(w http.ResponseWriter, r *http.Request) {
+	var movement StockMovement
+	if err := json.NewDecoder(r.Body).Decode(&movement); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	recorded, err := h.service.RecordStockMovement(r.Context(), movement)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(recorded)
+}
@@ -0,0 +1,170 @@
+package billing
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+type inventoryRepository struct {
+	db *sql.DB
+}
+
+func NewInventoryRepository(db *sql.DB) InventoryRepository {
+	return &inventoryRepository{db: db}
+}
+
+const stockMovementColumns = "id, product_id, movement_type, quantity, order_id, reason, stock_after, reserved_after, low_stock, created_at, updated_at"
+
+func scanStockMovement(row rowScanner) (*StockMovement, error) {
+	var movement StockMovement
+	err := row.Scan(&movement.ID, &movement.ProductID, &movement.Type, &movement.Quantity, &movement.OrderID, &movement.Reason, &movement.StockAfter, &movement.ReservedAfter, &movement.LowStock, &movement.CreatedAt, &movement.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &movement, nil
+}
+
+func (r *inventoryRepository) GetStockMovementsByProductID(ctx context.Context, productID uuid.UUID) ([]*StockMovement, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+stockMovementColumns+" FROM stock_movements WHERE product_id = $1 ORDER BY created_at DESC, id", productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movements []*StockMovement
+	for rows.Next() {
+		movement, err := scanStockMovement(rows)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, movement)
+	}
+	return movements, rows.Err()
+}
+
+func (r *inventoryRepository) RecordStockMovement(ctx context.Context, movement StockMovement) (*StockMovement, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	recorded, err := moveStock(ctx, tx, movement)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return recorded, nil
+}
+
+// moveStock applies a movement to its product and records it. The product
+// row is locked while its stock is checked and written, so concurrent
+// movements of one product are serialized and two orders cannot both
+// reserve the last unit.
+func moveStock(ctx context.Context, tx *sql.Tx, movement StockMovement) (*StockMovement, error) {
+	var product Product
+	err := tx.QueryRowContext(ctx, "SELECT track_inventory, stock_quantity, reserved_quantity, low_stock_alert FROM products WHERE id = $1 FOR UPDATE", movement.ProductID).
+		Scan(&product.TrackInventory, &product.StockQuantity, &product.ReservedQuantity, &product.LowStockAlert)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !product.TrackInventory {
+		return nil, ErrInventoryNotTracked
+	}
+	after, err := applyStockMovement(product, &movement)
+	if err != nil {
+		return nil, fmt.Errorf("%w: product %s has %d available", err, movement.ProductID, product.AvailableQuantity())
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE products SET stock_quantity = $1, reserved_quantity = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3", after.StockQuantity, after.ReservedQuantity, movement.ProductID); err != nil {
+		return nil, err
+	}
+	if movement.ID == uuid.Nil {
+		movement.ID = uuid.New()
+	}
+	return scanStockMovement(tx.QueryRowContext(ctx, "INSERT INTO stock_movements (id, product_id, movement_type, quantity, order_id, reason, stock_after, reserved_after, low_stock) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING "+stockMovementColumns,
+		movement.ID, movement.ProductID, movement.Type, movement.Quantity, movement.OrderID, movement.Reason, movement.StockAfter, movement.ReservedAfter, movement.LowStock))
+}
+
+// moveOrderStock reserves stock for an order being confirmed, and releases
+// or ships what it reserved when it is cancelled or shipped. Lines for
+// products that do not track inventory are skipped.
+func moveOrderStock(ctx context.Context, tx *sql.Tx, order Order) ([]StockMovement, error) {
+	switch order.Status {
+	case OrderStatusConfirmed:
+		quantities := make(map[uuid.UUID]int)
+		for _, item := range order.OrderItems {
+			quantities[item.ProductID] += item.Quantity
+		}
+		return moveStockForOrder(ctx, tx, order.ID, StockMovementReservation, quantities, "")
+	case OrderStatusCancelled:
+		return settleOrderStock(ctx, tx, order.ID, StockMovementRelease, "")
+	case OrderStatusShipped:
+		return settleOrderStock(ctx, tx, order.ID, StockMovementShipment, "")
+	}
+	return nil, nil
+}
+
+// settleOrderStock releases or ships whatever the order still holds. It works
+// from the order's reservations rather than its lines, so orders confirmed
+// before their products tracked inventory settle nothing.
+func settleOrderStock(ctx context.Context, tx *sql.Tx, orderID uuid.UUID, kind StockMovementType, reason string) ([]StockMovement, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT product_id, SUM(CASE movement_type WHEN 'reservation' THEN quantity ELSE -quantity END) FROM stock_movements WHERE order_id = $1 AND movement_type IN ('reservation', 'release', 'shipment') GROUP BY product_id", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	held := make(map[uuid.UUID]int)
+	for rows.Next() {
+		var productID uuid.UUID
+		var quantity int
+		if err := rows.Scan(&productID, &quantity); err != nil {
+			return nil, err
+		}
+		held[productID] = quantity
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return moveStockForOrder(ctx, tx, orderID, kind, held, reason)
+}
+
+// moveStockForOrder moves each product's quantity, locking the products in
+// ID order so that concurrent orders sharing products cannot deadlock.
+func moveStockForOrder(ctx context.Context, tx *sql.Tx, orderID uuid.UUID, kind StockMovementType, quantities map[uuid.UUID]int, reason string) ([]StockMovement, error) {
+	productIDs := make([]uuid.UUID, 0, len(quantities))
+	for productID, quantity := range quantities {
+		if quantity > 0 {
+			productIDs = append(productIDs, productID)
+		}
+	}
+	slices.SortFunc(productIDs, func(a, b uuid.UUID) int {
+		return bytes.Compare(a[:], b[:])
+	})
+
+	var movements []StockMovement
+	for _, productID := range productIDs {
+		moved, err := moveStock(ctx, tx, StockMovement{ProductID: productID, Type: kind, Quantity: quantities[productID], OrderID: &orderID, Reason: reason})
+		if errors.Is(err, ErrInventoryNotTracked) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, *moved)
+	}
+	return movements, nil
+}
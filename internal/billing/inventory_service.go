@@ -0,0 +1,97 @@
+package billing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+type InventoryService interface {
+	StockMovementLister
+	StockMovementRecorder
+}
+
+type InventoryRepository interface {
+	StockMovementLister
+	StockMovementRecorder
+}
+
+// StockMovementLister returns a product's movements, newest first.
+type StockMovementLister interface {
+	GetStockMovementsByProductID(ctx context.Context, productID uuid.UUID) ([]*StockMovement, error)
+}
+
+// StockMovementRecorder applies a movement to its product's stock and
+// records it in one transaction, returning ErrInventoryNotTracked for
+// products that do not track inventory and ErrInsufficientStock if it would
+// leave less than nothing available.
+type StockMovementRecorder interface {
+	RecordStockMovement(ctx context.Context, movement StockMovement) (*StockMovement, error)
+}
+
+type inventoryService struct {
+	repo   InventoryRepository
+	events core.EventPublisher
+}
+
+// InventoryServiceOption configures optional collaborators of the inventory
+// service.
+type InventoryServiceOption func(*inventoryService)
+
+// WithStockAlerts publishes a ProductStockLow event when a receipt or
+// adjustment takes a product to or below its threshold.
+func WithStockAlerts(events core.EventPublisher) InventoryServiceOption {
+	return func(s *inventoryService) {
+		s.events = events
+	}
+}
+
+func NewInventoryService(repo InventoryRepository, opts ...InventoryServiceOption) InventoryService {
+	s := &inventoryService{repo: repo}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *inventoryService) GetStockMovementsByProductID(ctx context.Context, productID uuid.UUID) ([]*StockMovement, error) {
+	return s.repo.GetStockMovementsByProductID(ctx, productID)
+}
+
+// RecordStockMovement records a receipt or an adjustment. Reservations,
+// releases and shipments belong to orders and only happen as they move
+// through their statuses.
+func (s *inventoryService) RecordStockMovement(ctx context.Context, movement StockMovement) (*StockMovement, error) {
+	movement.Reason = strings.TrimSpace(movement.Reason)
+	movement.OrderID = nil
+	switch {
+	case movement.Type == StockMovementReceipt && movement.Quantity <= 0:
+		return nil, fmt.Errorf("%w: a receipt must add stock", ErrInvalidStockMovement)
+	case movement.Type == StockMovementAdjustment && movement.Quantity == 0:
+		return nil, fmt.Errorf("%w: an adjustment must change stock", ErrInvalidStockMovement)
+	case movement.Type == StockMovementAdjustment && movement.Reason == "":
+		return nil, fmt.Errorf("%w: an adjustment needs a reason", ErrInvalidStockMovement)
+	case movement.Type != StockMovementReceipt && movement.Type != StockMovementAdjustment:
+		return nil, fmt.Errorf("%w: only receipts and adjustments can be recorded, not %q", ErrInvalidStockMovement, movement.Type)
+	}
+
+	recorded, err := s.repo.RecordStockMovement(ctx, movement)
+	if err != nil {
+		return nil, err
+	}
+	if s.events != nil {
+		// The movement is already committed, so subscriber failures are
+		// logged rather than reported to the caller.
+		for _, alert := range stockLowEvents([]StockMovement{*recorded}) {
+			if err := s.events.Publish(ctx, alert); err != nil {
+				slog.ErrorContext(ctx, "low stock subscriber failed", "product_id", alert.ProductID, "error", err)
+			}
+		}
+	}
+	return recorded, nil
+}
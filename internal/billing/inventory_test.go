@@ -0,0 +1,143 @@
+package billing
+
+import (
+	"context"
+	"testing"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockInventoryRepository struct {
+	mock.Mock
+}
+
+func (m *MockInventoryRepository) GetStockMovementsByProductID(ctx context.Context, productID uuid.UUID) ([]*StockMovement, error) {
+	args := m.Called(ctx, productID)
+	movements, _ := args.Get(0).([]*StockMovement)
+	return movements, args.Error(1)
+}
+
+func (m *MockInventoryRepository) RecordStockMovement(ctx context.Context, movement StockMovement) (*StockMovement, error) {
+	args := m.Called(ctx, movement)
+	recorded, _ := args.Get(0).(*StockMovement)
+	return recorded, args.Error(1)
+}
+
+func TestApplyStockMovement_ShipmentTakesStockAndReservation(t *testing.T) {
+	product := Product{TrackInventory: true, StockQuantity: 20, ReservedQuantity: 8, LowStockAlert: 5}
+	movement := StockMovement{Type: StockMovementShipment, Quantity: 8}
+
+	after, err := applyStockMovement(product, &movement)
+
+	require.NoError(t, err)
+	assert.Equal(t, 12, after.StockQuantity)
+	assert.Equal(t, 0, after.ReservedQuantity)
+	assert.Equal(t, 12, movement.StockAfter)
+	assert.Equal(t, 0, movement.ReservedAfter)
+	assert.False(t, movement.LowStock, "shipping reserved stock leaves availability unchanged")
+}
+
+func TestApplyStockMovement_FlagsOnlyTheCrossing(t *testing.T) {
+	product := Product{TrackInventory: true, StockQuantity: 12, LowStockAlert: 10}
+
+	first := StockMovement{Type: StockMovementReservation, Quantity: 2}
+	product, err := applyStockMovement(product, &first)
+	require.NoError(t, err)
+	second := StockMovement{Type: StockMovementReservation, Quantity: 1}
+	product, err = applyStockMovement(product, &second)
+	require.NoError(t, err)
+	release := StockMovement{Type: StockMovementRelease, Quantity: 3}
+	product, err = applyStockMovement(product, &release)
+	require.NoError(t, err)
+	again := StockMovement{Type: StockMovementAdjustment, Quantity: -2}
+	_, err = applyStockMovement(product, &again)
+	require.NoError(t, err)
+
+	assert.True(t, first.LowStock)
+	assert.False(t, second.LowStock, "already at or below the threshold")
+	assert.False(t, release.LowStock)
+	assert.True(t, again.LowStock, "back above the threshold, so the next drop alerts again")
+}
+
+func TestApplyStockMovement_RejectsMoreThanAvailable(t *testing.T) {
+	product := Product{TrackInventory: true, StockQuantity: 10, ReservedQuantity: 7}
+
+	_, err := applyStockMovement(product, &StockMovement{Type: StockMovementReservation, Quantity: 4})
+	assert.ErrorIs(t, err, ErrInsufficientStock)
+
+	_, err = applyStockMovement(product, &StockMovement{Type: StockMovementAdjustment, Quantity: -4})
+	assert.ErrorIs(t, err, ErrInsufficientStock, "reserved stock cannot be written off")
+
+	_, err = applyStockMovement(product, &StockMovement{Type: StockMovementReservation, Quantity: 3})
+	assert.NoError(t, err)
+}
+
+type InventoryServiceTestSuite struct {
+	suite.Suite
+	repo    *MockInventoryRepository
+	events  *core.EventBus
+	service InventoryService
+}
+
+func (s *InventoryServiceTestSuite) SetupTest() {
+	s.repo = new(MockInventoryRepository)
+	s.events = core.NewEventBus()
+	s.service = NewInventoryService(s.repo, WithStockAlerts(s.events))
+}
+
+func (s *InventoryServiceTestSuite) TearDownTest() {
+	s.repo.AssertExpectations(s.T())
+}
+
+func TestInventoryServiceSuite(t *testing.T) {
+	suite.Run(t, new(InventoryServiceTestSuite))
+}
+
+func (s *InventoryServiceTestSuite) TestRecordStockMovement_PublishesLowStock() {
+	// Arrange
+	ctx := context.Background()
+	productID := uuid.New()
+	movement := StockMovement{ProductID: productID, Type: StockMovementAdjustment, Quantity: -3, Reason: "Water damage"}
+	recorded := movement
+	recorded.ID, recorded.StockAfter, recorded.LowStock = uuid.New(), 4, true
+
+	var received []ProductStockLow
+	s.events.Subscribe(ProductStockLowEvent, func(ctx context.Context, event core.Event) error {
+		received = append(received, event.(ProductStockLow))
+		return nil
+	})
+	s.repo.On("RecordStockMovement", ctx, movement).Return(&recorded, nil)
+
+	// Act
+	result, err := s.service.RecordStockMovement(ctx, StockMovement{ProductID: productID, Type: StockMovementAdjustment, Quantity: -3, Reason: " Water damage "})
+
+	// Assert
+	s.NoError(err)
+	s.Equal(&recorded, result)
+	s.Require().Len(received, 1)
+	s.Equal(productID, received[0].ProductID)
+	s.Equal(recorded.ID, received[0].MovementID)
+	s.Equal(4, received[0].Available)
+}
+
+func (s *InventoryServiceTestSuite) TestRecordStockMovement_RejectsOrderMovementsAndBadQuantities() {
+	ctx := context.Background()
+	productID := uuid.New()
+
+	for _, movement := range []StockMovement{
+		{ProductID: productID, Type: StockMovementReservation, Quantity: 1},
+		{ProductID: productID, Type: StockMovementShipment, Quantity: 1},
+		{ProductID: productID, Type: StockMovementReceipt, Quantity: -5},
+		{ProductID: productID, Type: StockMovementAdjustment, Quantity: 0, Reason: "Count"},
+		{ProductID: productID, Type: StockMovementAdjustment, Quantity: 2},
+	} {
+		_, err := s.service.RecordStockMovement(ctx, movement)
+		s.ErrorIs(err, ErrInvalidStockMovement, movement.Type)
+	}
+}
@@ -0,0 +1,249 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvoiceNotFound      = errors.New("invoice not found")
+	ErrInvalidInvoice       = errors.New("invalid invoice")
+	ErrInvoiceNotDraft      = errors.New("invoice can only be changed while in draft")
+	ErrInvoiceNotOpen       = errors.New("invoice is not open for payments or credits")
+	ErrInvoiceHasActivity   = errors.New("invoice has payments or credits applied and cannot be voided")
+	ErrOrderAlreadyInvoiced = errors.New("order already has an invoice")
+	ErrOrderNotInvoiceable  = errors.New("order cannot be invoiced in its current status")
+	ErrOverApplied          = errors.New("amount exceeds the remaining balance")
+	ErrPaymentNotFound      = errors.New("payment not found")
+	ErrInvalidPayment       = errors.New("invalid payment")
+	ErrOrderNotPayable      = errors.New("order cannot take payments in its current status")
+	ErrInsufficientCredit   = errors.New("customer credit balance is too small")
+)
+
+type Invoice struct {
+	core.BaseModel
+
+	InvoiceNumber     string        `json:"invoice_number"` // Assigned when the invoice is sent
+	Kind              InvoiceKind   `json:"kind"`
+	CustomerID        uuid.UUID     `json:"customer_id"`
+	OrderID           *uuid.UUID    `json:"order_id"`
+	CreditedInvoiceID *uuid.UUID    `json:"credited_invoice_id"` // Set on credit notes only
+	Status            InvoiceStatus `json:"status"`
+	PaymentTerms      PaymentTerms  `json:"payment_terms"`
+
+	// Financial Information, computed by the invoice service
+	Currency       core.Currency `json:"currency"`
+	SubTotal       core.Money    `json:"subtotal"`
+	Discount       core.Money    `json:"discount"`
+	TaxAmount      core.Money    `json:"tax_amount"`
+	Total          core.Money    `json:"total"`
+	AmountPaid     core.Money    `json:"amount_paid"`
+	AmountCredited core.Money    `json:"amount_credited"`
+
+	// Dates
+	IssueDate *time.Time `json:"issue_date"`
+	DueDate   *time.Time `json:"due_date"`
+	SentAt    *time.Time `json:"sent_at"`
+	PaidAt    *time.Time `json:"paid_at"`
+	VoidedAt  *time.Time `json:"voided_at"`
+
+	BillingAddressID *uuid.UUID `json:"billing_address_id"`
+	Notes            string     `json:"notes"`
+
+	// Relationships
+	Items []InvoiceItem `json:"items"`
+}
+
+type InvoiceItem struct {
+	core.BaseModel
+	InvoiceID   uuid.UUID  `json:"invoice_id"`
+	ProductID   *uuid.UUID `json:"product_id"`
+	Description string     `json:"description"`
+	Quantity    int        `json:"quantity"`
+	UnitPrice   core.Money `json:"unit_price"`
+	Discount    core.Money `json:"discount"`
+	TaxAmount   core.Money `json:"tax_amount"`
+	Total       core.Money `json:"total"` // UnitPrice × Quantity - Discount
+}
+
+type InvoiceKind string
+
+const (
+	InvoiceKindInvoice    InvoiceKind = "invoice"
+	InvoiceKindCreditNote InvoiceKind = "credit_note"
+)
+
+type InvoiceStatus string
+
+const (
+	InvoiceStatusDraft         InvoiceStatus = "draft"
+	InvoiceStatusSent          InvoiceStatus = "sent"
+	InvoiceStatusPartiallyPaid InvoiceStatus = "partially_paid"
+	InvoiceStatusPaid          InvoiceStatus = "paid"
+	InvoiceStatusVoid          InvoiceStatus = "void"
+)
+
+type PaymentTerms string
+
+const (
+	PaymentTermsDueOnReceipt PaymentTerms = "due_on_receipt"
+	PaymentTermsNet15        PaymentTerms = "net_15"
+	PaymentTermsNet30        PaymentTerms = "net_30"
+)
+
+// Days returns how many days after issue the invoice falls due.
+func (t PaymentTerms) Days() (int, error) {
+	switch t {
+	case PaymentTermsDueOnReceipt:
+		return 0, nil
+	case PaymentTermsNet15:
+		return 15, nil
+	case PaymentTermsNet30:
+		return 30, nil
+	}
+	return 0, fmt.Errorf("%w: unknown payment terms %q", ErrInvalidInvoice, t)
+}
+
+// Balance is what the customer still owes. It is negative when payments and
+// credits exceed the total.
+func (inv Invoice) Balance() (core.Money, error) {
+	settled, err := inv.AmountPaid.Add(inv.AmountCredited)
+	if err != nil {
+		return core.Money{}, err
+	}
+	return inv.Total.Sub(settled)
+}
+
+// IsOpen reports whether payments and credits may be applied.
+func (inv Invoice) IsOpen() bool {
+	return inv.Kind == InvoiceKindInvoice && (inv.Status == InvoiceStatusSent || inv.Status == InvoiceStatusPartiallyPaid)
+}
+
+// ApplyPayment records amount against the invoice and moves it to
+// partially_paid or paid.
+func (inv *Invoice) ApplyPayment(amount core.Money, at time.Time) error {
+	if err := inv.checkApplicable(amount); err != nil {
+		return err
+	}
+	paid, err := inv.AmountPaid.Add(amount)
+	if err != nil {
+		return err
+	}
+	inv.AmountPaid = paid
+	return inv.settle(at)
+}
+
+// ReversePayment takes back amount previously paid, reopening the invoice if
+// it no longer covers the total.
+func (inv *Invoice) ReversePayment(amount core.Money, at time.Time) error {
+	if inv.Kind != InvoiceKindInvoice || inv.Status == InvoiceStatusDraft || inv.Status == InvoiceStatusVoid {
+		return ErrInvoiceNotOpen
+	}
+	paid, err := inv.AmountPaid.Sub(amount)
+	if err != nil {
+		return err
+	}
+	if paid.IsNegative() {
+		return fmt.Errorf("%w: invoice %s has only %s paid", ErrOverApplied, inv.InvoiceNumber, inv.AmountPaid)
+	}
+	inv.AmountPaid = paid
+	if balance, err := inv.Balance(); err != nil {
+		return err
+	} else if balance.IsPositive() {
+		inv.PaidAt = nil
+	}
+	return inv.settle(at)
+}
+
+// ApplyCredit records a credit note against the invoice. Credits may be
+// issued on a paid invoice, leaving a negative balance owed to the customer.
+func (inv *Invoice) ApplyCredit(amount core.Money, at time.Time) error {
+	if inv.Kind != InvoiceKindInvoice || (!inv.IsOpen() && inv.Status != InvoiceStatusPaid) {
+		return ErrInvoiceNotOpen
+	}
+	if !amount.IsPositive() {
+		return fmt.Errorf("%w: credit must be positive", ErrInvalidInvoice)
+	}
+	credited, err := inv.AmountCredited.Add(amount)
+	if err != nil {
+		return err
+	}
+	if cmp, err := credited.Cmp(inv.Total); err != nil {
+		return err
+	} else if cmp > 0 {
+		return fmt.Errorf("%w: credits would exceed the invoice total", ErrOverApplied)
+	}
+	inv.AmountCredited = credited
+	return inv.settle(at)
+}
+
+func (inv Invoice) checkApplicable(amount core.Money) error {
+	if !inv.IsOpen() {
+		return ErrInvoiceNotOpen
+	}
+	if !amount.IsPositive() {
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidPayment)
+	}
+	balance, err := inv.Balance()
+	if err != nil {
+		return err
+	}
+	if cmp, err := amount.Cmp(balance); err != nil {
+		return err
+	} else if cmp > 0 {
+		return fmt.Errorf("%w: invoice %s has %s outstanding", ErrOverApplied, inv.InvoiceNumber, balance)
+	}
+	return nil
+}
+
+func (inv *Invoice) settle(at time.Time) error {
+	balance, err := inv.Balance()
+	if err != nil {
+		return err
+	}
+	switch {
+	case !balance.IsPositive():
+		inv.Status = InvoiceStatusPaid
+		if inv.PaidAt == nil {
+			inv.PaidAt = &at
+		}
+	case inv.AmountPaid.IsPositive() || inv.AmountCredited.IsPositive():
+		inv.Status = InvoiceStatusPartiallyPaid
+	default:
+		inv.Status = InvoiceStatusSent
+	}
+	return nil
+}
+
+// PaymentApplication is the part of a payment applied to one invoice or, for
+// an order not yet invoiced, to the order. Exactly one of InvoiceID and
+// OrderID is set.
+type PaymentApplication struct {
+	core.BaseModel
+	PaymentID uuid.UUID  `json:"payment_id"`
+	InvoiceID *uuid.UUID `json:"invoice_id"`
+	OrderID   *uuid.UUID `json:"order_id"`
+	Amount    core.Money `json:"amount"`
+
+	// RealizedFX is the exchange gain (positive) or loss, in the base
+	// currency, on settling a foreign-currency invoice at the payment date's
+	// rate rather than the rate it was issued at.
+	RealizedFX core.Money `json:"realized_fx"`
+}
+
+// target names what the application pays, for error messages and duplicate
+// checks.
+func (a PaymentApplication) target() (string, error) {
+	switch {
+	case a.InvoiceID != nil && a.OrderID == nil:
+		return "invoice " + a.InvoiceID.String(), nil
+	case a.OrderID != nil && a.InvoiceID == nil:
+		return "order " + a.OrderID.String(), nil
+	}
+	return "", fmt.Errorf("%w: an application names either an invoice or an order", ErrInvalidPayment)
+}
@@ -0,0 +1,304 @@
+package billing
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type invoiceHandler struct {
+	service InvoiceService
+}
+
+type invoiceActionHandler struct {
+	service InvoiceService
+}
+
+type creditNoteHandler struct {
+	service CreditNoteIssuer
+}
+
+func (h *invoiceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getInvoice(w, r)
+	case http.MethodPost:
+		h.createInvoice(w, r)
+	case http.MethodPut:
+		h.updateInvoice(w, r)
+	case http.MethodDelete:
+		h.deleteInvoice(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *invoiceActionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.performAction(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *creditNoteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.issueCreditNote(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func NewInvoiceHandler(service InvoiceService) http.Handler {
+	return &invoiceHandler{service: service}
+}
+
+// NewInvoiceActionHandler runs the workflow action in a {"action": "..."}
+// body against the invoice given by ?id=: "send" or "void". With
+// ?order_id= instead, the only action is "invoice", which drafts an invoice
+// from the order using the body's optional "payment_terms".
+func NewInvoiceActionHandler(service InvoiceService) http.Handler {
+	return &invoiceActionHandler{service: service}
+}
+
+// NewCreditNoteHandler credits the invoice given by ?invoice_id=. The body is
+// {"reason": "...", "items": [...]}; without items the whole invoice is
+// reversed.
+func NewCreditNoteHandler(service CreditNoteIssuer) http.Handler {
+	return &creditNoteHandler{service: service}
+}
+
+func (h *invoiceHandler) getInvoice(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("customer_id") {
+		customerID, ok := queryUUID(w, r, "customer_id")
+		if !ok {
+			return
+		}
+		invoices, err := h.service.GetInvoicesByCustomerID(r.Context(), customerID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(invoices)
+		return
+	}
+	invoiceID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	invoice, err := h.service.GetInvoiceByID(r.Context(), invoiceID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(invoice)
+}
+
+func (h *invoiceHandler) createInvoice(w http.ResponseWriter, r *http.Request) {
+	var invoice Invoice
+	err := json.NewDecoder(r.Body).Decode(&invoice)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	createdInvoice, err := h.service.CreateInvoice(r.Context(), invoice)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createdInvoice)
+}
+
+func (h *invoiceHandler) updateInvoice(w http.ResponseWriter, r *http.Request) {
+	var invoice Invoice
+	err := json.NewDecoder(r.Body).Decode(&invoice)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updatedInvoice, err := h.service.UpdateInvoice(r.Context(), invoice)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(updatedInvoice)
+}
+
+func (h *invoiceHandler) deleteInvoice(w http.ResponseWriter, r *http.Request) {
+	invoiceID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	err := h.service.DeleteInvoice(r.Context(), invoiceID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Invoice deleted successfully"})
+}
+
+func (h *invoiceActionHandler) performAction(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Action       string       `json:"action"`
+		PaymentTerms PaymentTerms `json:"payment_terms"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Has("order_id") {
+		orderID, ok := queryUUID(w, r, "order_id")
+		if !ok {
+			return
+		}
+		if body.Action != "invoice" {
+			http.Error(w, "unknown action", http.StatusBadRequest)
+			return
+		}
+		invoice, err := h.service.CreateInvoiceFromOrder(r.Context(), orderID, body.PaymentTerms)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(invoice)
+		return
+	}
+
+	invoiceID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	var invoice *Invoice
+	switch body.Action {
+	case "send":
+		invoice, err = h.service.SendInvoice(r.Context(), invoiceID)
+	case "void":
+		invoice, err = h.service.VoidInvoice(r.Context(), invoiceID)
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(invoice)
+}
+
+func (h *creditNoteHandler) issueCreditNote(w http.ResponseWriter, r *http.Request) {
+	invoiceID, ok := queryUUID(w, r, "invoice_id")
+	if !ok {
+		return
+	}
+	var body struct {
+		Reason string        `json:"reason"`
+		Items  []InvoiceItem `json:"items"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	note, err := h.service.IssueCreditNote(r.Context(), invoiceID, body.Items, body.Reason)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(note)
+}
+
+type invoicePDFHandler struct {
+	service InvoicePDFRenderer
+}
+
+type statementPDFHandler struct {
+	service StatementPDFRenderer
+}
+
+// NewInvoicePDFHandler serves GET /invoices/{id}.pdf. A ServeMux wildcard
+// must span a whole path segment, so register it as "GET /invoices/{file}";
+// the handler strips the extension itself.
+func NewInvoicePDFHandler(service InvoicePDFRenderer) http.Handler {
+	return &invoicePDFHandler{service: service}
+}
+
+// NewStatementPDFHandler serves GET /customers/{id}/statement.pdf?from=&to=
+// with dates as YYYY-MM-DD. The period defaults to the current month to
+// date.
+func NewStatementPDFHandler(service StatementPDFRenderer) http.Handler {
+	return &statementPDFHandler{service: service}
+}
+
+func (h *invoicePDFHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	file, ok := strings.CutSuffix(r.PathValue("file"), ".pdf")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	invoiceID, err := uuid.Parse(file)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	document, err := h.service.RenderInvoice(r.Context(), invoiceID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writePDF(w, document)
+}
+
+func (h *statementPDFHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	customerID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := dateOnly(now)
+	for key, date := range map[string]*time.Time{"from": &from, "to": &to} {
+		value := r.URL.Query().Get(key)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			http.Error(w, "invalid "+key+", expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		*date = parsed
+	}
+	document, err := h.service.RenderStatement(r.Context(), customerID, from, to)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writePDF(w, document)
+}
+
+func writePDF(w http.ResponseWriter, document *RenderedDocument) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="`+document.Filename+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(document.Content)))
+	w.Write(document.Content)
+}
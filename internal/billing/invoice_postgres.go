@@ -0,0 +1,339 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+type invoiceRepository struct {
+	db *sql.DB
+}
+
+func NewInvoiceRepository(db *sql.DB) InvoiceRepository {
+	return &invoiceRepository{db: db}
+}
+
+const (
+	invoiceNumberSequence    = "invoice"
+	creditNoteNumberSequence = "credit_note"
+)
+
+// invoice_number is NULL until the invoice is sent, so drafts do not collide
+// on the unique constraint.
+const invoiceColumns = "id, COALESCE(invoice_number, ''), kind, customer_id, order_id, credited_invoice_id, status, payment_terms, currency, subtotal, discount, tax_amount, total, amount_paid, amount_credited, issue_date, due_date, sent_at, paid_at, voided_at, billing_address_id, notes, created_at, updated_at"
+
+const invoiceItemColumns = "id, invoice_id, product_id, description, quantity, unit_price, discount, tax_amount, total, created_at, updated_at, (SELECT i.currency FROM invoices i WHERE i.id = invoice_id)"
+
+func scanInvoice(row rowScanner) (*Invoice, error) {
+	var invoice Invoice
+	err := row.Scan(&invoice.ID, &invoice.InvoiceNumber, &invoice.Kind, &invoice.CustomerID, &invoice.OrderID, &invoice.CreditedInvoiceID, &invoice.Status, &invoice.PaymentTerms, &invoice.Currency, &invoice.SubTotal, &invoice.Discount, &invoice.TaxAmount, &invoice.Total, &invoice.AmountPaid, &invoice.AmountCredited, &invoice.IssueDate, &invoice.DueDate, &invoice.SentAt, &invoice.PaidAt, &invoice.VoidedAt, &invoice.BillingAddressID, &invoice.Notes, &invoice.CreatedAt, &invoice.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvoiceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := rereadAmounts(invoice.Currency, &invoice.SubTotal, &invoice.Discount, &invoice.TaxAmount, &invoice.Total, &invoice.AmountPaid, &invoice.AmountCredited); err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+func scanInvoiceItem(row rowScanner) (*InvoiceItem, error) {
+	var item InvoiceItem
+	var currency core.Currency
+	err := row.Scan(&item.ID, &item.InvoiceID, &item.ProductID, &item.Description, &item.Quantity, &item.UnitPrice, &item.Discount, &item.TaxAmount, &item.Total, &item.CreatedAt, &item.UpdatedAt, &currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := rereadAmounts(currency, &item.UnitPrice, &item.Discount, &item.TaxAmount, &item.Total); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// nullableNumber stores an unassigned document number as NULL.
+func nullableNumber(number string) *string {
+	if number == "" {
+		return nil
+	}
+	return &number
+}
+
+func (r *invoiceRepository) GetInvoiceByID(ctx context.Context, id uuid.UUID) (*Invoice, error) {
+	invoice, err := scanInvoice(r.db.QueryRowContext(ctx, "SELECT "+invoiceColumns+" FROM invoices WHERE id = $1", id))
+	if err != nil {
+		return nil, err
+	}
+	if invoice.Items, err = queryInvoiceItems(ctx, r.db, id); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+func (r *invoiceRepository) GetInvoicesByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Invoice, error) {
+	return queryInvoices(ctx, r.db, "SELECT "+invoiceColumns+" FROM invoices WHERE customer_id = $1 ORDER BY created_at DESC", customerID)
+}
+
+func (r *invoiceRepository) GetInvoicesByOrderID(ctx context.Context, orderID uuid.UUID) ([]*Invoice, error) {
+	return queryInvoices(ctx, r.db, "SELECT "+invoiceColumns+" FROM invoices WHERE order_id = $1 ORDER BY created_at DESC", orderID)
+}
+
+func (r *invoiceRepository) CreateInvoice(ctx context.Context, invoice Invoice) (*Invoice, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created, err := insertInvoice(ctx, tx, invoice)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (r *invoiceRepository) UpdateInvoice(ctx context.Context, invoice Invoice) (*Invoice, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	updated, err := scanInvoice(tx.QueryRowContext(ctx, "UPDATE invoices SET payment_terms = $1, currency = $2, subtotal = $3, discount = $4, tax_amount = $5, total = $6, billing_address_id = $7, notes = $8, updated_at = CURRENT_TIMESTAMP WHERE id = $9 AND status = $10 RETURNING "+invoiceColumns,
+		invoice.PaymentTerms, invoice.Currency, invoice.SubTotal, invoice.Discount, invoice.TaxAmount, invoice.Total, invoice.BillingAddressID, invoice.Notes, invoice.ID, InvoiceStatusDraft))
+	if errors.Is(err, ErrInvoiceNotFound) {
+		return nil, ErrInvoiceNotDraft
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM invoice_items WHERE invoice_id = $1", invoice.ID); err != nil {
+		return nil, err
+	}
+	if updated.Items, err = insertInvoiceItems(ctx, tx, updated.ID, invoice.Items); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (r *invoiceRepository) DeleteInvoice(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM invoices WHERE id = $1 AND status = $2", id, InvoiceStatusDraft)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrInvoiceNotDraft
+	}
+	return nil
+}
+
+func (r *invoiceRepository) IssueInvoice(ctx context.Context, invoice Invoice) (*Invoice, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	number, err := nextSequenceValue(ctx, tx, invoiceNumberSequence)
+	if err != nil {
+		return nil, err
+	}
+	invoice.InvoiceNumber = formatDocumentNumber("INV", number)
+
+	issued, err := scanInvoice(tx.QueryRowContext(ctx, "UPDATE invoices SET invoice_number = $1, status = $2, issue_date = $3, due_date = $4, sent_at = $5, updated_at = CURRENT_TIMESTAMP WHERE id = $6 AND status = $7 RETURNING "+invoiceColumns,
+		invoice.InvoiceNumber, invoice.Status, invoice.IssueDate, invoice.DueDate, invoice.SentAt, invoice.ID, InvoiceStatusDraft))
+	if errors.Is(err, ErrInvoiceNotFound) {
+		return nil, ErrInvoiceNotDraft
+	}
+	if err != nil {
+		return nil, err
+	}
+	if issued.OrderID != nil {
+		if err := moveOrderPayments(ctx, tx, issued); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	issued.Items = invoice.Items
+	return issued, nil
+}
+
+// moveOrderPayments carries payments applied to an order before it was
+// invoiced over to the invoice, so it opens with them deducted. The order's
+// AmountPaid already counts them and is left alone.
+func moveOrderPayments(ctx context.Context, tx *sql.Tx, invoice *Invoice) error {
+	if _, err := lockOrder(ctx, tx, *invoice.OrderID); err != nil {
+		return err
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT amount FROM payment_applications WHERE order_id = $1", *invoice.OrderID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	moved := 0
+	for rows.Next() {
+		amount := core.Zero(invoice.Total.Currency())
+		if err := rows.Scan(&amount); err != nil {
+			return err
+		}
+		if err := invoice.ApplyPayment(amount, *invoice.SentAt); err != nil {
+			return err
+		}
+		moved++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if moved == 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE payment_applications SET invoice_id = $1, order_id = NULL, updated_at = CURRENT_TIMESTAMP WHERE order_id = $2", invoice.ID, *invoice.OrderID); err != nil {
+		return err
+	}
+	return updateInvoiceBalance(ctx, tx, *invoice)
+}
+
+func (r *invoiceRepository) UpdateInvoiceStatus(ctx context.Context, invoice Invoice, from InvoiceStatus) (*Invoice, error) {
+	updated, err := scanInvoice(r.db.QueryRowContext(ctx, "UPDATE invoices SET status = $1, paid_at = $2, voided_at = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $4 AND status = $5 RETURNING "+invoiceColumns,
+		invoice.Status, invoice.PaidAt, invoice.VoidedAt, invoice.ID, from))
+	if errors.Is(err, ErrInvoiceNotFound) {
+		return nil, ErrInvoiceNotOpen
+	}
+	if err != nil {
+		return nil, err
+	}
+	updated.Items = invoice.Items
+	return updated, nil
+}
+
+func (r *invoiceRepository) CreateCreditNote(ctx context.Context, note Invoice) (*Invoice, error) {
+	if note.CreditedInvoiceID == nil {
+		return nil, fmt.Errorf("%w: credit note has no credited invoice", ErrInvalidInvoice)
+	}
+	at := time.Now()
+	if note.SentAt != nil {
+		at = *note.SentAt
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	original, err := scanInvoice(tx.QueryRowContext(ctx, "SELECT "+invoiceColumns+" FROM invoices WHERE id = $1 FOR UPDATE", *note.CreditedInvoiceID))
+	if err != nil {
+		return nil, err
+	}
+	if err := original.ApplyCredit(note.Total, at); err != nil {
+		return nil, err
+	}
+	if err := updateInvoiceBalance(ctx, tx, *original); err != nil {
+		return nil, err
+	}
+
+	number, err := nextSequenceValue(ctx, tx, creditNoteNumberSequence)
+	if err != nil {
+		return nil, err
+	}
+	note.InvoiceNumber = formatDocumentNumber("CN", number)
+	created, err := insertInvoice(ctx, tx, note)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func queryInvoices(ctx context.Context, db *sql.DB, query string, args ...any) ([]*Invoice, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invoices []*Invoice
+	for rows.Next() {
+		invoice, err := scanInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, invoice)
+	}
+	return invoices, rows.Err()
+}
+
+func queryInvoiceItems(ctx context.Context, db *sql.DB, invoiceID uuid.UUID) ([]InvoiceItem, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+invoiceItemColumns+" FROM invoice_items WHERE invoice_id = $1 ORDER BY created_at, id", invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []InvoiceItem
+	for rows.Next() {
+		item, err := scanInvoiceItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	return items, rows.Err()
+}
+
+func insertInvoice(ctx context.Context, tx *sql.Tx, invoice Invoice) (*Invoice, error) {
+	if invoice.ID == uuid.Nil {
+		invoice.ID = uuid.New()
+	}
+	created, err := scanInvoice(tx.QueryRowContext(ctx, "INSERT INTO invoices (id, invoice_number, kind, customer_id, order_id, credited_invoice_id, status, payment_terms, currency, subtotal, discount, tax_amount, total, amount_paid, amount_credited, issue_date, due_date, sent_at, paid_at, voided_at, billing_address_id, notes) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22) RETURNING "+invoiceColumns,
+		invoice.ID, nullableNumber(invoice.InvoiceNumber), invoice.Kind, invoice.CustomerID, invoice.OrderID, invoice.CreditedInvoiceID, invoice.Status, invoice.PaymentTerms, invoice.Currency, invoice.SubTotal, invoice.Discount, invoice.TaxAmount, invoice.Total, invoice.AmountPaid, invoice.AmountCredited, invoice.IssueDate, invoice.DueDate, invoice.SentAt, invoice.PaidAt, invoice.VoidedAt, invoice.BillingAddressID, invoice.Notes))
+	if err != nil {
+		return nil, err
+	}
+	if created.Items, err = insertInvoiceItems(ctx, tx, created.ID, invoice.Items); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func insertInvoiceItems(ctx context.Context, tx *sql.Tx, invoiceID uuid.UUID, items []InvoiceItem) ([]InvoiceItem, error) {
+	inserted := make([]InvoiceItem, 0, len(items))
+	for _, item := range items {
+		if item.ID == uuid.Nil {
+			item.ID = uuid.New()
+		}
+		created, err := scanInvoiceItem(tx.QueryRowContext(ctx, "INSERT INTO invoice_items (id, invoice_id, product_id, description, quantity, unit_price, discount, tax_amount, total) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING "+invoiceItemColumns,
+			item.ID, invoiceID, item.ProductID, item.Description, item.Quantity, item.UnitPrice, item.Discount, item.TaxAmount, item.Total))
+		if err != nil {
+			return nil, err
+		}
+		inserted = append(inserted, *created)
+	}
+	return inserted, nil
+}
+
+// updateInvoiceBalance writes the amounts and status changed by
+// Invoice.ApplyPayment or Invoice.ApplyCredit.
+func updateInvoiceBalance(ctx context.Context, tx *sql.Tx, invoice Invoice) error {
+	_, err := tx.ExecContext(ctx, "UPDATE invoices SET amount_paid = $1, amount_credited = $2, status = $3, paid_at = $4, updated_at = CURRENT_TIMESTAMP WHERE id = $5",
+		invoice.AmountPaid, invoice.AmountCredited, invoice.Status, invoice.PaidAt, invoice.ID)
+	return err
+}
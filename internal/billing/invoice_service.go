@@ -0,0 +1,440 @@
+package billing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+type InvoiceService interface {
+	InvoiceManager
+	OrderInvoicer
+	InvoiceSender
+	InvoiceVoider
+	CreditNoteIssuer
+}
+
+type InvoiceRepository interface {
+	InvoiceManager
+	OrderInvoiceLister
+	InvoiceIssuer
+	InvoiceStatusUpdater
+	CreditNoteCreator
+}
+
+type invoiceService struct {
+	repo   InvoiceRepository
+	orders OrderRetriever
+	prices PriceResolver
+	tax    TaxCalculator
+	now    func() time.Time
+}
+
+// InvoiceServiceOption configures optional collaborators of the invoice
+// service.
+type InvoiceServiceOption func(*invoiceService)
+
+// WithInvoiceTaxCalculator sets how tax is computed on invoice lines that are
+// not copied from an order. Without it those lines carry no tax.
+func WithInvoiceTaxCalculator(tax TaxCalculator) InvoiceServiceOption {
+	return func(s *invoiceService) {
+		s.tax = tax
+	}
+}
+
+func NewInvoiceService(repo InvoiceRepository, orders OrderRetriever, prices PriceResolver, opts ...InvoiceServiceOption) InvoiceService {
+	s := &invoiceService{
+		repo:   repo,
+		orders: orders,
+		prices: prices,
+		tax:    noTax{},
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+type InvoiceManager interface {
+	InvoiceReader
+	InvoiceWriter
+}
+
+type InvoiceReader interface {
+	InvoiceRetriever
+	InvoiceLister
+}
+
+type InvoiceWriter interface {
+	InvoiceCreator
+	InvoiceUpdater
+	InvoiceDeleter
+}
+
+type InvoiceRetriever interface {
+	GetInvoiceByID(ctx context.Context, id uuid.UUID) (*Invoice, error)
+}
+
+type InvoiceLister interface {
+	GetInvoicesByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Invoice, error)
+}
+
+type OrderInvoiceLister interface {
+	GetInvoicesByOrderID(ctx context.Context, orderID uuid.UUID) ([]*Invoice, error)
+}
+
+// InvoiceCreator persists a draft invoice and its items in one transaction.
+type InvoiceCreator interface {
+	CreateInvoice(ctx context.Context, invoice Invoice) (*Invoice, error)
+}
+
+// InvoiceUpdater replaces a draft invoice's header and items in one
+// transaction.
+type InvoiceUpdater interface {
+	UpdateInvoice(ctx context.Context, invoice Invoice) (*Invoice, error)
+}
+
+type InvoiceDeleter interface {
+	DeleteInvoice(ctx context.Context, id uuid.UUID) error
+}
+
+type OrderInvoicer interface {
+	CreateInvoiceFromOrder(ctx context.Context, orderID uuid.UUID, terms PaymentTerms) (*Invoice, error)
+}
+
+type InvoiceSender interface {
+	SendInvoice(ctx context.Context, id uuid.UUID) (*Invoice, error)
+}
+
+type InvoiceVoider interface {
+	VoidInvoice(ctx context.Context, id uuid.UUID) (*Invoice, error)
+}
+
+// CreditNoteIssuer reverses all of an invoice when items is empty, or the
+// given items otherwise.
+type CreditNoteIssuer interface {
+	IssueCreditNote(ctx context.Context, invoiceID uuid.UUID, items []InvoiceItem, reason string) (*Invoice, error)
+}
+
+// InvoiceIssuer assigns the next InvoiceNumber and writes the sent status and
+// dates, but only while the invoice is still a draft, returning
+// ErrInvoiceNotDraft otherwise. Payments already applied to the invoiced
+// order move to the invoice in the same transaction.
+type InvoiceIssuer interface {
+	IssueInvoice(ctx context.Context, invoice Invoice) (*Invoice, error)
+}
+
+// InvoiceStatusUpdater writes a new status and its dates, but only if the
+// invoice is still in status from, returning ErrInvoiceNotOpen otherwise.
+type InvoiceStatusUpdater interface {
+	UpdateInvoiceStatus(ctx context.Context, invoice Invoice, from InvoiceStatus) (*Invoice, error)
+}
+
+// CreditNoteCreator numbers and inserts a credit note and applies its total to
+// the credited invoice in one transaction, locking the credited invoice.
+type CreditNoteCreator interface {
+	CreateCreditNote(ctx context.Context, note Invoice) (*Invoice, error)
+}
+
+func (s *invoiceService) GetInvoiceByID(ctx context.Context, id uuid.UUID) (*Invoice, error) {
+	return s.repo.GetInvoiceByID(ctx, id)
+}
+
+func (s *invoiceService) GetInvoicesByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Invoice, error) {
+	return s.repo.GetInvoicesByCustomerID(ctx, customerID)
+}
+
+// CreateInvoice creates a draft invoice from scratch. Product lines are
+// priced from the catalog; free-form lines keep the unit price given.
+func (s *invoiceService) CreateInvoice(ctx context.Context, invoice Invoice) (*Invoice, error) {
+	invoice.InvoiceNumber = ""
+	invoice.Kind = InvoiceKindInvoice
+	invoice.OrderID, invoice.CreditedInvoiceID = nil, nil
+	invoice.Status = InvoiceStatusDraft
+	clearInvoiceActivity(&invoice)
+	if invoice.PaymentTerms == "" {
+		invoice.PaymentTerms = PaymentTermsNet30
+	}
+	if err := s.priceInvoice(ctx, &invoice, true); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateInvoice(ctx, invoice)
+}
+
+// UpdateInvoice changes a draft invoice. A draft raised from an order keeps
+// the order's lines and amounts; only its terms, address and notes change.
+func (s *invoiceService) UpdateInvoice(ctx context.Context, invoice Invoice) (*Invoice, error) {
+	existing, err := s.repo.GetInvoiceByID(ctx, invoice.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Status != InvoiceStatusDraft {
+		return nil, ErrInvoiceNotDraft
+	}
+	invoice.InvoiceNumber = existing.InvoiceNumber
+	invoice.Kind = existing.Kind
+	invoice.CustomerID = existing.CustomerID
+	invoice.OrderID, invoice.CreditedInvoiceID = existing.OrderID, existing.CreditedInvoiceID
+	invoice.Status = existing.Status
+	clearInvoiceActivity(&invoice)
+	if invoice.PaymentTerms == "" {
+		invoice.PaymentTerms = existing.PaymentTerms
+	}
+	if invoice.OrderID != nil {
+		// The lines were copied from the order as sold and are not the
+		// caller's to change.
+		if _, err := invoice.PaymentTerms.Days(); err != nil {
+			return nil, err
+		}
+		invoice.Items, invoice.Currency = existing.Items, existing.Currency
+		invoice.SubTotal, invoice.Discount, invoice.TaxAmount, invoice.Total = existing.SubTotal, existing.Discount, existing.TaxAmount, existing.Total
+		return s.repo.UpdateInvoice(ctx, invoice)
+	}
+	if err := s.priceInvoice(ctx, &invoice, true); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateInvoice(ctx, invoice)
+}
+
+func (s *invoiceService) DeleteInvoice(ctx context.Context, id uuid.UUID) error {
+	existing, err := s.repo.GetInvoiceByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if existing.Status != InvoiceStatusDraft {
+		return ErrInvoiceNotDraft
+	}
+	return s.repo.DeleteInvoice(ctx, id)
+}
+
+// CreateInvoiceFromOrder drafts an invoice copying the order's lines and
+// amounts as they were sold. An order has at most one invoice that is not
+// void.
+func (s *invoiceService) CreateInvoiceFromOrder(ctx context.Context, orderID uuid.UUID, terms PaymentTerms) (*Invoice, error) {
+	order, err := s.orders.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	switch order.Status {
+	case OrderStatusPending, OrderStatusCancelled, OrderStatusRefunded:
+		return nil, fmt.Errorf("%w: order is %s", ErrOrderNotInvoiceable, order.Status)
+	}
+	existing, err := s.repo.GetInvoicesByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	for _, invoice := range existing {
+		if invoice.Kind == InvoiceKindInvoice && invoice.Status != InvoiceStatusVoid {
+			return nil, fmt.Errorf("%w: %s", ErrOrderAlreadyInvoiced, invoice.ID)
+		}
+	}
+	if terms == "" {
+		terms = PaymentTermsNet30
+	}
+	if _, err := terms.Days(); err != nil {
+		return nil, err
+	}
+
+	invoice := Invoice{
+		Kind:             InvoiceKindInvoice,
+		CustomerID:       order.CustomerID,
+		OrderID:          &order.ID,
+		Status:           InvoiceStatusDraft,
+		PaymentTerms:     terms,
+		Currency:         order.Currency,
+		SubTotal:         order.SubTotal,
+		Discount:         order.Discount,
+		TaxAmount:        order.TaxAmount,
+		Total:            order.Total,
+		BillingAddressID: order.BillingAddressID,
+		Notes:            "Order " + order.OrderNumber,
+	}
+	for _, item := range order.OrderItems {
+		productID := item.ProductID
+		invoice.Items = append(invoice.Items, InvoiceItem{
+			ProductID:   &productID,
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Discount:    item.Discount,
+			TaxAmount:   item.TaxAmount,
+			Total:       item.Total,
+		})
+	}
+	return s.repo.CreateInvoice(ctx, invoice)
+}
+
+// SendInvoice numbers a draft invoice and starts its payment terms: the due
+// date is the issue date plus the terms' days.
+func (s *invoiceService) SendInvoice(ctx context.Context, id uuid.UUID) (*Invoice, error) {
+	invoice, err := s.repo.GetInvoiceByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if invoice.Status != InvoiceStatusDraft {
+		return nil, ErrInvoiceNotDraft
+	}
+	if len(invoice.Items) == 0 {
+		return nil, fmt.Errorf("%w: at least one item is required", ErrInvalidInvoice)
+	}
+	days, err := invoice.PaymentTerms.Days()
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	issued := dateOnly(now)
+	due := issued.AddDate(0, 0, days)
+	invoice.Status = InvoiceStatusSent
+	invoice.IssueDate, invoice.DueDate, invoice.SentAt = &issued, &due, &now
+	return s.repo.IssueInvoice(ctx, *invoice)
+}
+
+// VoidInvoice cancels an invoice nothing has been paid or credited against.
+func (s *invoiceService) VoidInvoice(ctx context.Context, id uuid.UUID) (*Invoice, error) {
+	invoice, err := s.repo.GetInvoiceByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if invoice.Kind != InvoiceKindInvoice {
+		return nil, fmt.Errorf("%w: credit notes cannot be voided", ErrInvalidInvoice)
+	}
+	from := invoice.Status
+	switch {
+	case from == InvoiceStatusVoid:
+		return nil, ErrInvoiceNotOpen
+	case from != InvoiceStatusDraft && from != InvoiceStatusSent,
+		invoice.AmountPaid.IsPositive(), invoice.AmountCredited.IsPositive():
+		return nil, ErrInvoiceHasActivity
+	}
+
+	now := s.now()
+	invoice.Status = InvoiceStatusVoid
+	invoice.VoidedAt = &now
+	return s.repo.UpdateInvoiceStatus(ctx, *invoice, from)
+}
+
+// IssueCreditNote issues a numbered credit note against a sent or paid
+// invoice and reduces the invoice's balance by the note's total.
+func (s *invoiceService) IssueCreditNote(ctx context.Context, invoiceID uuid.UUID, items []InvoiceItem, reason string) (*Invoice, error) {
+	original, err := s.repo.GetInvoiceByID(ctx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if original.Kind != InvoiceKindInvoice || (!original.IsOpen() && original.Status != InvoiceStatusPaid) {
+		return nil, ErrInvoiceNotOpen
+	}
+
+	now := s.now()
+	issued := dateOnly(now)
+	note := Invoice{
+		Kind:              InvoiceKindCreditNote,
+		CustomerID:        original.CustomerID,
+		OrderID:           original.OrderID,
+		CreditedInvoiceID: &original.ID,
+		Status:            InvoiceStatusSent,
+		PaymentTerms:      original.PaymentTerms,
+		IssueDate:         &issued,
+		SentAt:            &now,
+		BillingAddressID:  original.BillingAddressID,
+		Notes:             reason,
+	}
+	if len(items) == 0 {
+		for _, item := range original.Items {
+			item.ID, item.InvoiceID = uuid.Nil, uuid.Nil
+			note.Items = append(note.Items, item)
+		}
+		note.Currency, note.SubTotal, note.Discount, note.TaxAmount, note.Total = original.Currency, original.SubTotal, original.Discount, original.TaxAmount, original.Total
+	} else {
+		note.Items = items
+		if err := s.priceInvoice(ctx, &note, false); err != nil {
+			return nil, err
+		}
+	}
+
+	// Check against the loaded invoice for a clear error; the repository
+	// repeats the check under a row lock.
+	check := *original
+	if err := check.ApplyCredit(note.Total, now); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateCreditNote(ctx, note)
+}
+
+// priceInvoice fills every server-side amount on an invoice. When
+// fromCatalog is set, product lines are priced from the catalog; otherwise
+// unit prices are kept as given.
+func (s *invoiceService) priceInvoice(ctx context.Context, invoice *Invoice, fromCatalog bool) error {
+	if invoice.CustomerID == uuid.Nil {
+		return fmt.Errorf("%w: customer is required", ErrInvalidInvoice)
+	}
+	if len(invoice.Items) == 0 {
+		return fmt.Errorf("%w: at least one item is required", ErrInvalidInvoice)
+	}
+	if _, err := invoice.PaymentTerms.Days(); err != nil {
+		return err
+	}
+
+	on := s.now()
+	if invoice.IssueDate != nil {
+		on = *invoice.IssueDate
+	}
+	var totals documentTotals
+	for i := range invoice.Items {
+		item := &invoice.Items[i]
+		if item.Quantity <= 0 {
+			return fmt.Errorf("%w: item %d quantity must be positive", ErrInvalidInvoice, i+1)
+		}
+		if fromCatalog && item.ProductID != nil {
+			price, err := s.prices.ResolvePrice(ctx, invoice.CustomerID, *item.ProductID, on)
+			if err != nil {
+				return err
+			}
+			item.UnitPrice = price.Price
+		}
+		if item.Description == "" {
+			return fmt.Errorf("%w: item %d description is required", ErrInvalidInvoice, i+1)
+		}
+		if item.UnitPrice.IsNegative() {
+			return fmt.Errorf("%w: item %d unit price is negative", ErrInvalidInvoice, i+1)
+		}
+
+		total, err := lineTotal(ErrInvalidInvoice, i+1, item.UnitPrice, item.Quantity, item.Discount)
+		if err != nil {
+			return err
+		}
+		item.Total = total
+		if item.TaxAmount, err = s.tax.LineTax(ctx, TaxableLine{
+			CustomerID: invoice.CustomerID,
+			ProductID:  item.ProductID,
+			AddressID:  invoice.BillingAddressID,
+			Date:       on,
+			Amount:     item.Total,
+		}); err != nil {
+			return fmt.Errorf("failed to calculate tax: %w", err)
+		}
+		if err := totals.addLine(item.UnitPrice, item.Quantity, item.Discount, item.TaxAmount); err != nil {
+			return err
+		}
+	}
+
+	total, err := totals.total()
+	if err != nil {
+		return err
+	}
+	invoice.SubTotal, invoice.Discount, invoice.TaxAmount, invoice.Total = totals.subTotal, totals.discount, totals.tax, total
+	invoice.Currency = currencyOf(total)
+	return nil
+}
+
+// clearInvoiceActivity resets the fields only the service and repository
+// may set, so clients cannot post paid amounts or dates.
+func clearInvoiceActivity(invoice *Invoice) {
+	invoice.AmountPaid, invoice.AmountCredited = core.Money{}, core.Money{}
+	invoice.IssueDate, invoice.DueDate, invoice.SentAt, invoice.PaidAt, invoice.VoidedAt = nil, nil, nil, nil, nil
+}
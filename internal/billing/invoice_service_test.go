@@ -0,0 +1,518 @@
+package billing
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockInvoiceRepository struct {
+	mock.Mock
+}
+
+func (m *MockInvoiceRepository) GetInvoiceByID(ctx context.Context, id uuid.UUID) (*Invoice, error) {
+	args := m.Called(ctx, id)
+	invoice, _ := args.Get(0).(*Invoice)
+	return invoice, args.Error(1)
+}
+
+func (m *MockInvoiceRepository) GetInvoicesByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Invoice, error) {
+	args := m.Called(ctx, customerID)
+	invoices, _ := args.Get(0).([]*Invoice)
+	return invoices, args.Error(1)
+}
+
+func (m *MockInvoiceRepository) GetInvoicesByOrderID(ctx context.Context, orderID uuid.UUID) ([]*Invoice, error) {
+	args := m.Called(ctx, orderID)
+	invoices, _ := args.Get(0).([]*Invoice)
+	return invoices, args.Error(1)
+}
+
+func (m *MockInvoiceRepository) CreateInvoice(ctx context.Context, invoice Invoice) (*Invoice, error) {
+	args := m.Called(ctx, invoice)
+	created, _ := args.Get(0).(*Invoice)
+	return created, args.Error(1)
+}
+
+func (m *MockInvoiceRepository) UpdateInvoice(ctx context.Context, invoice Invoice) (*Invoice, error) {
+	args := m.Called(ctx, invoice)
+	updated, _ := args.Get(0).(*Invoice)
+	return updated, args.Error(1)
+}
+
+func (m *MockInvoiceRepository) DeleteInvoice(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockInvoiceRepository) IssueInvoice(ctx context.Context, invoice Invoice) (*Invoice, error) {
+	args := m.Called(ctx, invoice)
+	issued, _ := args.Get(0).(*Invoice)
+	return issued, args.Error(1)
+}
+
+func (m *MockInvoiceRepository) UpdateInvoiceStatus(ctx context.Context, invoice Invoice, from InvoiceStatus) (*Invoice, error) {
+	args := m.Called(ctx, invoice, from)
+	updated, _ := args.Get(0).(*Invoice)
+	return updated, args.Error(1)
+}
+
+func (m *MockInvoiceRepository) CreateCreditNote(ctx context.Context, note Invoice) (*Invoice, error) {
+	args := m.Called(ctx, note)
+	created, _ := args.Get(0).(*Invoice)
+	return created, args.Error(1)
+}
+
+type MockPaymentRepository struct {
+	mock.Mock
+}
+
+func (m *MockPaymentRepository) GetPaymentByID(ctx context.Context, id uuid.UUID) (*Payment, error) {
+	args := m.Called(ctx, id)
+	payment, _ := args.Get(0).(*Payment)
+	return payment, args.Error(1)
+}
+
+func (m *MockPaymentRepository) GetPaymentsByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Payment, error) {
+	args := m.Called(ctx, customerID)
+	payments, _ := args.Get(0).([]*Payment)
+	return payments, args.Error(1)
+}
+
+func (m *MockPaymentRepository) RecordPayment(ctx context.Context, payment Payment) (*Payment, error) {
+	args := m.Called(ctx, payment)
+	recorded, _ := args.Get(0).(*Payment)
+	return recorded, args.Error(1)
+}
+
+func (m *MockPaymentRepository) ApplyPayments(ctx context.Context, applications []PaymentApplication, at time.Time) ([]*Payment, error) {
+	args := m.Called(ctx, applications, at)
+	payments, _ := args.Get(0).([]*Payment)
+	return payments, args.Error(1)
+}
+
+func (m *MockPaymentRepository) UpdatePaymentStatus(ctx context.Context, payment Payment, from PaymentStatus) (*Payment, error) {
+	args := m.Called(ctx, payment, from)
+	updated, _ := args.Get(0).(*Payment)
+	return updated, args.Error(1)
+}
+
+func (m *MockPaymentRepository) CreateRefund(ctx context.Context, refund Refund) (*Refund, error) {
+	args := m.Called(ctx, refund)
+	created, _ := args.Get(0).(*Refund)
+	return created, args.Error(1)
+}
+
+func (m *MockPaymentRepository) GetRefundsByPaymentID(ctx context.Context, paymentID uuid.UUID) ([]*Refund, error) {
+	args := m.Called(ctx, paymentID)
+	refunds, _ := args.Get(0).([]*Refund)
+	return refunds, args.Error(1)
+}
+
+func (m *MockPaymentRepository) CreateChargeback(ctx context.Context, chargeback Chargeback) (*Chargeback, error) {
+	args := m.Called(ctx, chargeback)
+	created, _ := args.Get(0).(*Chargeback)
+	return created, args.Error(1)
+}
+
+func (m *MockPaymentRepository) ResolveChargeback(ctx context.Context, chargeback Chargeback, from DisputeStatus) (*Chargeback, error) {
+	args := m.Called(ctx, chargeback, from)
+	resolved, _ := args.Get(0).(*Chargeback)
+	return resolved, args.Error(1)
+}
+
+func (m *MockPaymentRepository) GetChargebackByID(ctx context.Context, id uuid.UUID) (*Chargeback, error) {
+	args := m.Called(ctx, id)
+	chargeback, _ := args.Get(0).(*Chargeback)
+	return chargeback, args.Error(1)
+}
+
+func (m *MockPaymentRepository) GetChargebacksByPaymentID(ctx context.Context, paymentID uuid.UUID) ([]*Chargeback, error) {
+	args := m.Called(ctx, paymentID)
+	chargebacks, _ := args.Get(0).([]*Chargeback)
+	return chargebacks, args.Error(1)
+}
+
+func (m *MockPaymentRepository) GetLedgerEntriesByPaymentID(ctx context.Context, paymentID uuid.UUID) ([]*LedgerEntry, error) {
+	args := m.Called(ctx, paymentID)
+	entries, _ := args.Get(0).([]*LedgerEntry)
+	return entries, args.Error(1)
+}
+
+type InvoiceServiceTestSuite struct {
+	suite.Suite
+	invoiceRepo *MockInvoiceRepository
+	paymentRepo *MockPaymentRepository
+	orderRepo   *MockOrderRepository
+	prices      *MockPriceResolver
+	now         time.Time
+	service     InvoiceService
+	payments    PaymentService
+}
+
+func (s *InvoiceServiceTestSuite) SetupTest() {
+	s.invoiceRepo = new(MockInvoiceRepository)
+	s.paymentRepo = new(MockPaymentRepository)
+	s.orderRepo = new(MockOrderRepository)
+	s.prices = new(MockPriceResolver)
+	s.now = time.Date(2026, 6, 10, 14, 0, 0, 0, time.UTC)
+	s.service = NewInvoiceService(s.invoiceRepo, s.orderRepo, s.prices, WithInvoiceTaxCalculator(flatTax{rate: big.NewRat(1, 10)}))
+	s.service.(*invoiceService).now = func() time.Time { return s.now }
+	s.payments = NewPaymentService(s.paymentRepo, s.invoiceRepo, s.orderRepo)
+	s.payments.(*paymentService).now = func() time.Time { return s.now }
+}
+
+func (s *InvoiceServiceTestSuite) TearDownTest() {
+	s.invoiceRepo.AssertExpectations(s.T())
+	s.paymentRepo.AssertExpectations(s.T())
+	s.orderRepo.AssertExpectations(s.T())
+	s.prices.AssertExpectations(s.T())
+}
+
+func TestInvoiceServiceSuite(t *testing.T) {
+	suite.Run(t, new(InvoiceServiceTestSuite))
+}
+
+func (s *InvoiceServiceTestSuite) TestCreateInvoice_PricesProductLinesAndKeepsFreeFormLines() {
+	// Arrange
+	ctx := context.Background()
+	customerID, productID := uuid.New(), uuid.New()
+	input := Invoice{
+		CustomerID: customerID,
+		Status:     InvoiceStatusPaid, // ignored
+		AmountPaid: usd("500.00"),     // ignored
+		Items: []InvoiceItem{
+			{ProductID: &productID, Description: "Operating agreement", Quantity: 1, UnitPrice: usd("0.01")},
+			{Description: "Courier fee", Quantity: 2, UnitPrice: usd("12.50"), Discount: usd("5.00")},
+		},
+	}
+
+	s.prices.On("ResolvePrice", ctx, customerID, productID, s.now).Return(&ResolvedPrice{Price: usd("300.00")}, nil)
+
+	var saved Invoice
+	s.invoiceRepo.On("CreateInvoice", ctx, mock.AnythingOfType("Invoice")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Invoice)
+	}).Return(&Invoice{}, nil)
+
+	// Act
+	_, err := s.service.CreateInvoice(ctx, input)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(InvoiceStatusDraft, saved.Status)
+	s.Equal(PaymentTermsNet30, saved.PaymentTerms)
+	s.True(saved.AmountPaid.IsZero())
+	s.Equal(usd("300.00"), saved.Items[0].UnitPrice)
+	s.Equal(usd("30.00"), saved.Items[0].TaxAmount)
+	s.Equal(usd("20.00"), saved.Items[1].Total)
+	s.Equal(usd("2.00"), saved.Items[1].TaxAmount)
+	s.Equal(usd("325.00"), saved.SubTotal)
+	s.Equal(usd("5.00"), saved.Discount)
+	s.Equal(usd("32.00"), saved.TaxAmount)
+	s.Equal(usd("352.00"), saved.Total)
+}
+
+func (s *InvoiceServiceTestSuite) TestCreateInvoiceFromOrder_CopiesLinesAsSold() {
+	// Arrange
+	ctx := context.Background()
+	orderID, productID := uuid.New(), uuid.New()
+	order := &Order{
+		OrderNumber: "ORD-000042",
+		CustomerID:  uuid.New(),
+		Status:      OrderStatusDelivered,
+		SubTotal:    usd("100.00"),
+		TaxAmount:   usd("6.00"),
+		Total:       usd("106.00"),
+		OrderItems: []OrderItem{
+			{ProductID: productID, Description: "Annual report", Quantity: 1, UnitPrice: usd("100.00"), TaxAmount: usd("6.00"), Total: usd("100.00")},
+		},
+	}
+	order.ID = orderID
+
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(order, nil)
+	s.invoiceRepo.On("GetInvoicesByOrderID", ctx, orderID).Return([]*Invoice{{Kind: InvoiceKindInvoice, Status: InvoiceStatusVoid}}, nil)
+
+	var saved Invoice
+	s.invoiceRepo.On("CreateInvoice", ctx, mock.AnythingOfType("Invoice")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Invoice)
+	}).Return(&Invoice{}, nil)
+
+	// Act
+	_, err := s.service.CreateInvoiceFromOrder(ctx, orderID, PaymentTermsNet15)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(&orderID, saved.OrderID)
+	s.Equal(order.CustomerID, saved.CustomerID)
+	s.Equal(PaymentTermsNet15, saved.PaymentTerms)
+	s.Equal(usd("106.00"), saved.Total)
+	s.Equal(&productID, saved.Items[0].ProductID)
+	s.Equal(usd("6.00"), saved.Items[0].TaxAmount)
+}
+
+func (s *InvoiceServiceTestSuite) TestCreateInvoiceFromOrder_RejectsOrderAlreadyInvoiced() {
+	// Arrange
+	ctx := context.Background()
+	orderID := uuid.New()
+
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(&Order{Status: OrderStatusConfirmed}, nil)
+	s.invoiceRepo.On("GetInvoicesByOrderID", ctx, orderID).Return([]*Invoice{{Kind: InvoiceKindInvoice, Status: InvoiceStatusSent}}, nil)
+
+	// Act
+	result, err := s.service.CreateInvoiceFromOrder(ctx, orderID, PaymentTermsNet30)
+
+	// Assert
+	s.ErrorIs(err, ErrOrderAlreadyInvoiced)
+	s.Nil(result)
+}
+
+func (s *InvoiceServiceTestSuite) TestCreateInvoiceFromOrder_RejectsPendingOrder() {
+	// Arrange
+	ctx := context.Background()
+	orderID := uuid.New()
+
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(&Order{Status: OrderStatusPending}, nil)
+
+	// Act
+	result, err := s.service.CreateInvoiceFromOrder(ctx, orderID, PaymentTermsNet30)
+
+	// Assert
+	s.ErrorIs(err, ErrOrderNotInvoiceable)
+	s.Nil(result)
+}
+
+func (s *InvoiceServiceTestSuite) TestUpdateInvoice_KeepsOrderLinesAsSold() {
+	// Arrange
+	ctx := context.Background()
+	invoiceID, orderID, productID := uuid.New(), uuid.New(), uuid.New()
+	sold := []InvoiceItem{{ProductID: &productID, Description: "Annual report", Quantity: 1, UnitPrice: usd("100.00"), TaxAmount: usd("6.00"), Total: usd("100.00")}}
+	existing := &Invoice{Kind: InvoiceKindInvoice, CustomerID: uuid.New(), OrderID: &orderID, Status: InvoiceStatusDraft, PaymentTerms: PaymentTermsNet30, SubTotal: usd("100.00"), TaxAmount: usd("6.00"), Total: usd("106.00"), Items: sold}
+	existing.ID = invoiceID
+
+	s.invoiceRepo.On("GetInvoiceByID", ctx, invoiceID).Return(existing, nil)
+	var saved Invoice
+	s.invoiceRepo.On("UpdateInvoice", ctx, mock.AnythingOfType("Invoice")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Invoice)
+	}).Return(&Invoice{}, nil)
+
+	// Act
+	_, err := s.service.UpdateInvoice(ctx, Invoice{
+		BaseModel:    existing.BaseModel,
+		PaymentTerms: PaymentTermsNet15,
+		Notes:        "PO 7731",
+		Items:        []InvoiceItem{{ProductID: &productID, Description: "Annual report", Quantity: 1, UnitPrice: usd("1.00"), Discount: usd("1.00")}},
+		Total:        usd("0.00"),
+	})
+
+	// Assert
+	s.NoError(err)
+	s.Equal(PaymentTermsNet15, saved.PaymentTerms)
+	s.Equal("PO 7731", saved.Notes)
+	s.Equal(sold, saved.Items)
+	s.Equal(usd("106.00"), saved.Total)
+}
+
+func (s *InvoiceServiceTestSuite) TestSendInvoice_SetsDueDateFromTerms() {
+	// Arrange
+	ctx := context.Background()
+	invoiceID := uuid.New()
+	draft := &Invoice{Status: InvoiceStatusDraft, PaymentTerms: PaymentTermsNet15, Items: []InvoiceItem{{Description: "Retainer"}}}
+	draft.ID = invoiceID
+
+	s.invoiceRepo.On("GetInvoiceByID", ctx, invoiceID).Return(draft, nil)
+
+	var issued Invoice
+	s.invoiceRepo.On("IssueInvoice", ctx, mock.AnythingOfType("Invoice")).Run(func(args mock.Arguments) {
+		issued = args.Get(1).(Invoice)
+	}).Return(&Invoice{InvoiceNumber: "INV-000007"}, nil)
+
+	// Act
+	result, err := s.service.SendInvoice(ctx, invoiceID)
+
+	// Assert
+	s.NoError(err)
+	s.Equal("INV-000007", result.InvoiceNumber)
+	s.Equal(InvoiceStatusSent, issued.Status)
+	s.Equal(time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC), *issued.IssueDate)
+	s.Equal(time.Date(2026, 6, 25, 0, 0, 0, 0, time.UTC), *issued.DueDate)
+	s.Equal(s.now, *issued.SentAt)
+}
+
+func (s *InvoiceServiceTestSuite) TestSendInvoice_RejectsSentInvoice() {
+	// Arrange
+	ctx := context.Background()
+	invoiceID := uuid.New()
+
+	s.invoiceRepo.On("GetInvoiceByID", ctx, invoiceID).Return(&Invoice{Status: InvoiceStatusSent}, nil)
+
+	// Act
+	result, err := s.service.SendInvoice(ctx, invoiceID)
+
+	// Assert
+	s.ErrorIs(err, ErrInvoiceNotDraft)
+	s.Nil(result)
+}
+
+func (s *InvoiceServiceTestSuite) TestVoidInvoice_RefusedOncePaymentsApplied() {
+	// Arrange
+	ctx := context.Background()
+	invoiceID := uuid.New()
+
+	s.invoiceRepo.On("GetInvoiceByID", ctx, invoiceID).Return(&Invoice{
+		Kind:       InvoiceKindInvoice,
+		Status:     InvoiceStatusPartiallyPaid,
+		Total:      usd("100.00"),
+		AmountPaid: usd("40.00"),
+	}, nil)
+
+	// Act
+	result, err := s.service.VoidInvoice(ctx, invoiceID)
+
+	// Assert
+	s.ErrorIs(err, ErrInvoiceHasActivity)
+	s.Nil(result)
+}
+
+func (s *InvoiceServiceTestSuite) TestIssueCreditNote_FullReversalCopiesInvoice() {
+	// Arrange
+	ctx := context.Background()
+	invoiceID := uuid.New()
+	original := &Invoice{
+		InvoiceNumber: "INV-000003",
+		Kind:          InvoiceKindInvoice,
+		CustomerID:    uuid.New(),
+		Status:        InvoiceStatusSent,
+		SubTotal:      usd("200.00"),
+		TaxAmount:     usd("20.00"),
+		Total:         usd("220.00"),
+		Items:         []InvoiceItem{{Description: "Trademark search", Quantity: 1, UnitPrice: usd("200.00"), TaxAmount: usd("20.00"), Total: usd("200.00")}},
+	}
+	original.ID = invoiceID
+
+	s.invoiceRepo.On("GetInvoiceByID", ctx, invoiceID).Return(original, nil)
+
+	var note Invoice
+	s.invoiceRepo.On("CreateCreditNote", ctx, mock.AnythingOfType("Invoice")).Run(func(args mock.Arguments) {
+		note = args.Get(1).(Invoice)
+	}).Return(&Invoice{InvoiceNumber: "CN-000001"}, nil)
+
+	// Act
+	result, err := s.service.IssueCreditNote(ctx, invoiceID, nil, "Engagement cancelled")
+
+	// Assert
+	s.NoError(err)
+	s.Equal("CN-000001", result.InvoiceNumber)
+	s.Equal(InvoiceKindCreditNote, note.Kind)
+	s.Equal(&invoiceID, note.CreditedInvoiceID)
+	s.Equal(usd("220.00"), note.Total)
+	s.Equal("Engagement cancelled", note.Notes)
+	s.Len(note.Items, 1)
+}
+
+func (s *InvoiceServiceTestSuite) TestIssueCreditNote_RejectsCreditAboveTotal() {
+	// Arrange
+	ctx := context.Background()
+	invoiceID := uuid.New()
+
+	s.invoiceRepo.On("GetInvoiceByID", ctx, invoiceID).Return(&Invoice{
+		Kind:           InvoiceKindInvoice,
+		CustomerID:     uuid.New(),
+		Status:         InvoiceStatusPartiallyPaid,
+		PaymentTerms:   PaymentTermsNet30,
+		Total:          usd("100.00"),
+		AmountCredited: usd("90.00"),
+	}, nil)
+
+	// Act
+	result, err := s.service.IssueCreditNote(ctx, invoiceID, []InvoiceItem{{Description: "Goodwill", Quantity: 1, UnitPrice: usd("20.00")}}, "Goodwill")
+
+	// Assert
+	s.ErrorIs(err, ErrOverApplied)
+	s.Nil(result)
+}
+
+func (s *InvoiceServiceTestSuite) TestApplyPayment_SplitsAcrossInvoices() {
+	// Arrange
+	ctx := context.Background()
+	customerID, paymentID := uuid.New(), uuid.New()
+	first, second := uuid.New(), uuid.New()
+	payment := &Payment{CustomerID: customerID, Amount: usd("150.00"), Status: PaymentStatusCompleted}
+	applications := []PaymentApplication{
+		{InvoiceID: &first, Amount: usd("100.00")},
+		{InvoiceID: &second, Amount: usd("50.00")},
+	}
+
+	s.paymentRepo.On("GetPaymentByID", ctx, paymentID).Return(payment, nil)
+	s.invoiceRepo.On("GetInvoiceByID", ctx, first).Return(&Invoice{Kind: InvoiceKindInvoice, CustomerID: customerID, Status: InvoiceStatusSent, Total: usd("100.00")}, nil)
+	s.invoiceRepo.On("GetInvoiceByID", ctx, second).Return(&Invoice{Kind: InvoiceKindInvoice, CustomerID: customerID, Status: InvoiceStatusSent, Total: usd("80.00")}, nil)
+	s.paymentRepo.On("ApplyPayments", ctx, mock.AnythingOfType("[]billing.PaymentApplication"), s.now).Return([]*Payment{payment}, nil)
+
+	// Act
+	_, err := s.payments.ApplyPayment(ctx, paymentID, applications)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(paymentID, applications[0].PaymentID)
+	s.Equal(paymentID, applications[1].PaymentID)
+}
+
+func (s *InvoiceServiceTestSuite) TestApplyPayment_RejectsMoreThanUnapplied() {
+	// Arrange
+	ctx := context.Background()
+	customerID, paymentID, invoiceID := uuid.New(), uuid.New(), uuid.New()
+	payment := &Payment{
+		CustomerID:   customerID,
+		Amount:       usd("150.00"),
+		Status:       PaymentStatusCompleted,
+		Applications: []PaymentApplication{{Amount: usd("100.00")}},
+	}
+
+	s.paymentRepo.On("GetPaymentByID", ctx, paymentID).Return(payment, nil)
+	s.invoiceRepo.On("GetInvoiceByID", ctx, invoiceID).Return(&Invoice{Kind: InvoiceKindInvoice, CustomerID: customerID, Status: InvoiceStatusSent, Total: usd("80.00")}, nil)
+
+	// Act
+	result, err := s.payments.ApplyPayment(ctx, paymentID, []PaymentApplication{{InvoiceID: &invoiceID, Amount: usd("80.00")}})
+
+	// Assert
+	s.ErrorIs(err, ErrOverApplied)
+	s.Nil(result)
+}
+
+func (s *InvoiceServiceTestSuite) TestApplyPayment_RejectsAnotherCustomersInvoice() {
+	// Arrange
+	ctx := context.Background()
+	paymentID, invoiceID := uuid.New(), uuid.New()
+
+	s.paymentRepo.On("GetPaymentByID", ctx, paymentID).Return(&Payment{CustomerID: uuid.New(), Amount: usd("50.00"), Status: PaymentStatusCompleted}, nil)
+	s.invoiceRepo.On("GetInvoiceByID", ctx, invoiceID).Return(&Invoice{Kind: InvoiceKindInvoice, CustomerID: uuid.New(), Status: InvoiceStatusSent, Total: usd("50.00")}, nil)
+
+	// Act
+	result, err := s.payments.ApplyPayment(ctx, paymentID, []PaymentApplication{{InvoiceID: &invoiceID, Amount: usd("50.00")}})
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidPayment)
+	s.Nil(result)
+}
+
+func (s *InvoiceServiceTestSuite) TestInvoiceApplyPayment_MovesThroughPartiallyPaidToPaid() {
+	// Arrange
+	invoice := Invoice{Kind: InvoiceKindInvoice, Status: InvoiceStatusSent, Total: usd("100.00")}
+
+	// Act & Assert
+	s.NoError(invoice.ApplyPayment(usd("40.00"), s.now))
+	s.Equal(InvoiceStatusPartiallyPaid, invoice.Status)
+	s.Nil(invoice.PaidAt)
+
+	s.ErrorIs(invoice.ApplyPayment(usd("60.01"), s.now), ErrOverApplied)
+
+	s.NoError(invoice.ApplyPayment(usd("60.00"), s.now))
+	s.Equal(InvoiceStatusPaid, invoice.Status)
+	s.Equal(s.now, *invoice.PaidAt)
+
+	s.ErrorIs(invoice.ApplyPayment(usd("1.00"), s.now), ErrInvoiceNotOpen)
+}
@@ -0,0 +1,146 @@
+package billing
+
+import (
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+// LedgerEntry is one double-entry posting for a payment: Amount moves from
+// CreditAccount to DebitAccount. Entries are written in the same transaction
+// as the change they record and are never updated or deleted; corrections
+// are new entries.
+type LedgerEntry struct {
+	ID            uuid.UUID       `json:"id"`
+	PaymentID     uuid.UUID       `json:"payment_id"`
+	Type          LedgerEntryType `json:"type"`
+	DebitAccount  LedgerAccount   `json:"debit_account"`
+	CreditAccount LedgerAccount   `json:"credit_account"`
+	Amount        core.Money      `json:"amount"`
+	RealizedFX    core.Money      `json:"realized_fx"` // Exchange gain or loss, in the base currency, an application realized or a reversal gave back
+	InvoiceID     *uuid.UUID      `json:"invoice_id"`
+	OrderID       *uuid.UUID      `json:"order_id"`
+	RefundID      *uuid.UUID      `json:"refund_id"`
+	ChargebackID  *uuid.UUID      `json:"chargeback_id"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// LedgerAccount is where a payment's money sits. Customer credit is money
+// received but not applied; receivables are reduced by money applied to
+// invoices and orders.
+type LedgerAccount string
+
+const (
+	LedgerAccountCash           LedgerAccount = "cash"
+	LedgerAccountCustomerCredit LedgerAccount = "customer_credit"
+	LedgerAccountReceivables    LedgerAccount = "accounts_receivable"
+	LedgerAccountDisputedFunds  LedgerAccount = "disputed_funds"
+)
+
+type LedgerEntryType string
+
+const (
+	LedgerEntryPaymentReceived     LedgerEntryType = "payment_received"
+	LedgerEntryPaymentApplied      LedgerEntryType = "payment_applied"
+	LedgerEntryApplicationReversed LedgerEntryType = "application_reversed"
+	LedgerEntryRefund              LedgerEntryType = "refund"
+	LedgerEntryChargeback          LedgerEntryType = "chargeback"
+	LedgerEntryChargebackWon       LedgerEntryType = "chargeback_won"
+	LedgerEntryChargebackLost      LedgerEntryType = "chargeback_lost"
+)
+
+// ledgerAccounts gives the accounts each entry type debits and credits.
+var ledgerAccounts = map[LedgerEntryType][2]LedgerAccount{
+	LedgerEntryPaymentReceived:     {LedgerAccountCash, LedgerAccountCustomerCredit},
+	LedgerEntryPaymentApplied:      {LedgerAccountCustomerCredit, LedgerAccountReceivables},
+	LedgerEntryApplicationReversed: {LedgerAccountReceivables, LedgerAccountCustomerCredit},
+	LedgerEntryRefund:              {LedgerAccountCustomerCredit, LedgerAccountCash},
+	LedgerEntryChargeback:          {LedgerAccountDisputedFunds, LedgerAccountCash},
+	LedgerEntryChargebackWon:       {LedgerAccountCash, LedgerAccountDisputedFunds},
+	LedgerEntryChargebackLost:      {LedgerAccountCustomerCredit, LedgerAccountDisputedFunds},
+}
+
+func newLedgerEntry(paymentID uuid.UUID, entryType LedgerEntryType, amount core.Money, at time.Time) LedgerEntry {
+	accounts := ledgerAccounts[entryType]
+	return LedgerEntry{
+		ID:            uuid.New(),
+		PaymentID:     paymentID,
+		Type:          entryType,
+		DebitAccount:  accounts[0],
+		CreditAccount: accounts[1],
+		Amount:        amount,
+		OccurredAt:    at,
+	}
+}
+
+// PaymentReconciliation compares the ledger balance of each account with the
+// balance the payment's own amounts imply. Balances are debits less credits.
+type PaymentReconciliation struct {
+	PaymentID  uuid.UUID                    `json:"payment_id"`
+	Ledger     map[LedgerAccount]core.Money `json:"ledger"`
+	Expected   map[LedgerAccount]core.Money `json:"expected"`
+	Reconciled bool                         `json:"reconciled"`
+}
+
+// reconcilePayment checks entries against payment. A payment that was never
+// completed should have no entries at all.
+func reconcilePayment(payment Payment, entries []*LedgerEntry) (*PaymentReconciliation, error) {
+	currency := payment.Amount.Currency()
+	accounts := []LedgerAccount{LedgerAccountCash, LedgerAccountCustomerCredit, LedgerAccountReceivables, LedgerAccountDisputedFunds}
+	result := &PaymentReconciliation{
+		PaymentID: payment.ID,
+		Ledger:    make(map[LedgerAccount]core.Money, len(accounts)),
+		Expected:  make(map[LedgerAccount]core.Money, len(accounts)),
+	}
+	for _, account := range accounts {
+		result.Ledger[account] = core.Zero(currency)
+		result.Expected[account] = core.Zero(currency)
+	}
+
+	for _, entry := range entries {
+		debit, err := result.Ledger[entry.DebitAccount].Add(entry.Amount)
+		if err != nil {
+			return nil, err
+		}
+		result.Ledger[entry.DebitAccount] = debit
+		credit, err := result.Ledger[entry.CreditAccount].Sub(entry.Amount)
+		if err != nil {
+			return nil, err
+		}
+		result.Ledger[entry.CreditAccount] = credit
+	}
+
+	if payment.Status == PaymentStatusCompleted || payment.Status == PaymentStatusRefunded {
+		cash, err := payment.Reversible()
+		if err != nil {
+			return nil, err
+		}
+		unapplied, err := payment.Unapplied()
+		if err != nil {
+			return nil, err
+		}
+		var applied core.Money
+		for _, application := range payment.Applications {
+			if applied, err = applied.Add(application.Amount); err != nil {
+				return nil, err
+			}
+		}
+		result.Expected[LedgerAccountCash] = cash
+		result.Expected[LedgerAccountCustomerCredit] = unapplied.Neg()
+		result.Expected[LedgerAccountReceivables] = applied.Neg()
+		result.Expected[LedgerAccountDisputedFunds] = payment.DisputedAmount
+	}
+
+	result.Reconciled = true
+	for _, account := range accounts {
+		if cmp, err := result.Ledger[account].Cmp(result.Expected[account]); err != nil {
+			return nil, err
+		} else if cmp != 0 {
+			result.Reconciled = false
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,260 @@
+package billing
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"rva_crm/internal/core"
+)
+
+type paymentHandler struct {
+	service PaymentService
+}
+
+type paymentApplicationHandler struct {
+	service PaymentApplier
+}
+
+type customerCreditHandler struct {
+	service CustomerCreditManager
+}
+
+type cardChargeHandler struct {
+	service CardCharger
+}
+
+type paymentActionHandler struct {
+	service PaymentProcessor
+}
+
+func (h *paymentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getPayment(w, r)
+	case http.MethodPost:
+		h.recordPayment(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *paymentApplicationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.applyPayment(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *customerCreditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getCredit(w, r)
+	case http.MethodPost:
+		h.applyCredit(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *cardChargeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.chargeCard(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *paymentActionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.performAction(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func NewPaymentHandler(service PaymentService) http.Handler {
+	return &paymentHandler{service: service}
+}
+
+// NewPaymentApplicationHandler applies the payment given by ?id= to the
+// invoices and orders in a {"applications": [{"invoice_id": ..., "amount":
+// ...}]} body, each naming an "invoice_id" or an "order_id". With
+// {"auto": true} instead, the payment goes to the customer's open invoices,
+// earliest due first, and any overpayment is left as credit.
+func NewPaymentApplicationHandler(service PaymentApplier) http.Handler {
+	return &paymentApplicationHandler{service: service}
+}
+
+// NewCustomerCreditHandler shows the credit balance of the customer given by
+// ?customer_id= on GET. POST pays an invoice or order from it with an
+// {"invoice_id" or "order_id": ..., "amount": ...} body.
+func NewCustomerCreditHandler(service CustomerCreditManager) http.Handler {
+	return &customerCreditHandler{service: service}
+}
+
+// NewCardChargeHandler takes a card payment through the payment gateway. The
+// card details are passed to the gateway and never stored.
+func NewCardChargeHandler(service CardCharger) http.Handler {
+	return &cardChargeHandler{service: service}
+}
+
+// NewPaymentActionHandler runs the action in a {"action": "..."} body against
+// the payment given by ?id=: "capture" (with an optional "amount" for a
+// partial capture), "void" or "sync". Refunds have their own handler.
+func NewPaymentActionHandler(service PaymentProcessor) http.Handler {
+	return &paymentActionHandler{service: service}
+}
+
+func (h *paymentHandler) getPayment(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("customer_id") {
+		customerID, ok := queryUUID(w, r, "customer_id")
+		if !ok {
+			return
+		}
+		payments, err := h.service.GetPaymentsByCustomerID(r.Context(), customerID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(payments)
+		return
+	}
+	paymentID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	payment, err := h.service.GetPaymentByID(r.Context(), paymentID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (h *paymentHandler) recordPayment(w http.ResponseWriter, r *http.Request) {
+	var payment Payment
+	err := json.NewDecoder(r.Body).Decode(&payment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	recordedPayment, err := h.service.RecordPayment(r.Context(), payment)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(recordedPayment)
+}
+
+func (h *paymentApplicationHandler) applyPayment(w http.ResponseWriter, r *http.Request) {
+	paymentID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	var body struct {
+		Applications []PaymentApplication `json:"applications"`
+		Auto         bool                 `json:"auto"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var payment *Payment
+	if body.Auto {
+		payment, err = h.service.AutoApplyPayment(r.Context(), paymentID)
+	} else {
+		payment, err = h.service.ApplyPayment(r.Context(), paymentID, body.Applications)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (h *customerCreditHandler) getCredit(w http.ResponseWriter, r *http.Request) {
+	customerID, ok := queryUUID(w, r, "customer_id")
+	if !ok {
+		return
+	}
+	credit, err := h.service.GetCustomerCredit(r.Context(), customerID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(credit)
+}
+
+func (h *customerCreditHandler) applyCredit(w http.ResponseWriter, r *http.Request) {
+	customerID, ok := queryUUID(w, r, "customer_id")
+	if !ok {
+		return
+	}
+	var application PaymentApplication
+	err := json.NewDecoder(r.Body).Decode(&application)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	credit, err := h.service.ApplyCustomerCredit(r.Context(), customerID, application)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(credit)
+}
+
+func (h *cardChargeHandler) chargeCard(w http.ResponseWriter, r *http.Request) {
+	var charge CardCharge
+	err := json.NewDecoder(r.Body).Decode(&charge)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payment, err := h.service.ChargeCard(r.Context(), charge)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (h *paymentActionHandler) performAction(w http.ResponseWriter, r *http.Request) {
+	paymentID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	var body struct {
+		Action string     `json:"action"`
+		Amount core.Money `json:"amount"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var payment *Payment
+	switch body.Action {
+	case "capture":
+		payment, err = h.service.CapturePayment(r.Context(), paymentID, body.Amount)
+	case "void":
+		payment, err = h.service.VoidPayment(r.Context(), paymentID)
+	case "sync":
+		payment, err = h.service.SyncPaymentStatus(r.Context(), paymentID)
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(payment)
+}
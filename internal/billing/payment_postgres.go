@@ -0,0 +1,405 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+type paymentRepository struct {
+	db *sql.DB
+}
+
+func NewPaymentRepository(db *sql.DB) PaymentRepository {
+	return &paymentRepository{db: db}
+}
+
+const paymentApplicationColumns = "id, payment_id, invoice_id, order_id, amount, realized_fx, created_at, updated_at, (SELECT p.currency FROM payments p WHERE p.id = payment_id)"
+
+func scanPaymentApplication(row rowScanner) (*PaymentApplication, error) {
+	var application PaymentApplication
+	var currency core.Currency
+	err := row.Scan(&application.ID, &application.PaymentID, &application.InvoiceID, &application.OrderID, &application.Amount, &application.RealizedFX, &application.CreatedAt, &application.UpdatedAt, &currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := rereadAmounts(currency, &application.Amount); err != nil {
+		return nil, err
+	}
+	return &application, nil
+}
+
+func (r *paymentRepository) GetPaymentByID(ctx context.Context, id uuid.UUID) (*Payment, error) {
+	payment, err := scanPayment(r.db.QueryRowContext(ctx, "SELECT "+paymentColumns+" FROM payments WHERE id = $1", id))
+	if err != nil {
+		return nil, err
+	}
+	applications, err := queryPaymentApplications(ctx, r.db, "SELECT "+paymentApplicationColumns+" FROM payment_applications WHERE payment_id = $1 ORDER BY created_at, id", id)
+	if err != nil {
+		return nil, err
+	}
+	for _, application := range applications {
+		payment.Applications = append(payment.Applications, *application)
+	}
+	return payment, nil
+}
+
+func (r *paymentRepository) GetPaymentsByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Payment, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+paymentColumns+" FROM payments WHERE customer_id = $1 ORDER BY payment_date DESC, id", customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []*Payment
+	byID := make(map[uuid.UUID]*Payment)
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+		byID[payment.ID] = payment
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	applications, err := queryPaymentApplications(ctx, r.db, "SELECT pa.id, pa.payment_id, pa.invoice_id, pa.order_id, pa.amount, pa.realized_fx, pa.created_at, pa.updated_at, p.currency FROM payment_applications pa JOIN payments p ON p.id = pa.payment_id WHERE p.customer_id = $1 ORDER BY pa.created_at, pa.id", customerID)
+	if err != nil {
+		return nil, err
+	}
+	for _, application := range applications {
+		if payment, ok := byID[application.PaymentID]; ok {
+			payment.Applications = append(payment.Applications, *application)
+		}
+	}
+	return payments, nil
+}
+
+func (r *paymentRepository) RecordPayment(ctx context.Context, payment Payment) (*Payment, error) {
+	if payment.ID == uuid.Nil {
+		payment.ID = uuid.New()
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	recorded, err := scanPayment(tx.QueryRowContext(ctx, "INSERT INTO payments (id, customer_id, order_id, payment_method, amount, currency, payment_status, payment_date, transaction_id, processor_reference, processed_at, processor_data) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING "+paymentColumns,
+		payment.ID, payment.CustomerID, payment.OrderID, payment.Method, payment.Amount, currencyOf(payment.Amount), payment.Status, payment.PaymentDate, payment.TransactionID, payment.ProcessorReference, payment.ProcessedAt, nullableJSON(payment.ProcessorData)))
+	if err != nil {
+		return nil, err
+	}
+	if recorded.Status == PaymentStatusCompleted {
+		if err := insertLedgerEntries(ctx, tx, newLedgerEntry(recorded.ID, LedgerEntryPaymentReceived, recorded.Amount, recorded.PaymentDate)); err != nil {
+			return nil, err
+		}
+		if err := refreshCustomerStats(ctx, tx, recorded.CustomerID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return recorded, nil
+}
+
+func (r *paymentRepository) UpdatePaymentStatus(ctx context.Context, payment Payment, from PaymentStatus) (*Payment, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	updated, err := scanPayment(tx.QueryRowContext(ctx, "UPDATE payments SET payment_status = $1, amount = $2, transaction_id = $3, processor_reference = $4, processed_at = $5, processor_data = $6, updated_at = CURRENT_TIMESTAMP WHERE id = $7 AND payment_status = $8 RETURNING "+paymentColumns,
+		payment.Status, payment.Amount, payment.TransactionID, payment.ProcessorReference, payment.ProcessedAt, nullableJSON(payment.ProcessorData), payment.ID, from))
+	if errors.Is(err, ErrPaymentNotFound) {
+		return nil, ErrPaymentStatusConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	if updated.Status == PaymentStatusCompleted && from != PaymentStatusCompleted {
+		at := updated.PaymentDate
+		if updated.ProcessedAt != nil {
+			at = *updated.ProcessedAt
+		}
+		if err := insertLedgerEntries(ctx, tx, newLedgerEntry(updated.ID, LedgerEntryPaymentReceived, updated.Amount, at)); err != nil {
+			return nil, err
+		}
+	}
+	if err := refreshCustomerStats(ctx, tx, updated.CustomerID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	updated.Applications = payment.Applications
+	return updated, nil
+}
+
+// nullableJSON stores an absent document as NULL rather than invalid JSON.
+func nullableJSON(data json.RawMessage) any {
+	if len(data) == 0 {
+		return nil
+	}
+	return []byte(data)
+}
+
+func (r *paymentRepository) ApplyPayments(ctx context.Context, applications []PaymentApplication, at time.Time) ([]*Payment, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock payments in ID order so overlapping batches cannot deadlock.
+	var ids []uuid.UUID
+	payments := make(map[uuid.UUID]*Payment)
+	for _, application := range applications {
+		if _, ok := payments[application.PaymentID]; !ok {
+			payments[application.PaymentID] = nil
+			ids = append(ids, application.PaymentID)
+		}
+	}
+	for _, id := range sortedIDs(ids) {
+		if payments[id], err = lockPayment(ctx, tx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	targets := lockedTargets{tx: tx, invoices: make(map[uuid.UUID]*Invoice), orders: make(map[uuid.UUID]*Order)}
+	var invoiceIDs, orderIDs []uuid.UUID
+	for _, application := range applications {
+		if application.InvoiceID != nil {
+			invoiceIDs = append(invoiceIDs, *application.InvoiceID)
+		}
+		if application.OrderID != nil {
+			orderIDs = append(orderIDs, *application.OrderID)
+		}
+	}
+	if err := targets.lock(ctx, invoiceIDs, orderIDs); err != nil {
+		return nil, err
+	}
+	for _, application := range applications {
+		payment := payments[application.PaymentID]
+		unapplied, err := payment.Unapplied()
+		if err != nil {
+			return nil, err
+		}
+		if cmp, err := application.Amount.Cmp(unapplied); err != nil {
+			return nil, err
+		} else if cmp > 0 {
+			return nil, fmt.Errorf("%w: payment has %s unapplied", ErrOverApplied, unapplied)
+		}
+
+		switch {
+		case application.InvoiceID != nil && application.OrderID == nil:
+			err = targets.applyToInvoice(ctx, payment.CustomerID, *application.InvoiceID, application.Amount, at)
+		case application.OrderID != nil && application.InvoiceID == nil:
+			err = targets.applyToOrder(ctx, payment.CustomerID, *application.OrderID, application.Amount)
+		default:
+			_, err = application.target()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if application.ID == uuid.Nil {
+			application.ID = uuid.New()
+		}
+		created, err := scanPaymentApplication(tx.QueryRowContext(ctx, "INSERT INTO payment_applications (id, payment_id, invoice_id, order_id, amount, realized_fx) VALUES ($1, $2, $3, $4, $5, $6) RETURNING "+paymentApplicationColumns,
+			application.ID, payment.ID, application.InvoiceID, application.OrderID, application.Amount, application.RealizedFX))
+		if err != nil {
+			return nil, err
+		}
+		payment.Applications = append(payment.Applications, *created)
+
+		entry := newLedgerEntry(payment.ID, LedgerEntryPaymentApplied, created.Amount, at)
+		entry.InvoiceID, entry.OrderID = created.InvoiceID, created.OrderID
+		entry.RealizedFX = created.RealizedFX
+		if err := insertLedgerEntries(ctx, tx, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	applied := make([]*Payment, 0, len(ids))
+	for _, id := range ids {
+		applied = append(applied, payments[id])
+	}
+	return applied, nil
+}
+
+// lockPayment loads a payment and its applications, locking the payment row.
+func lockPayment(ctx context.Context, tx *sql.Tx, id uuid.UUID) (*Payment, error) {
+	payment, err := scanPayment(tx.QueryRowContext(ctx, "SELECT "+paymentColumns+" FROM payments WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT "+paymentApplicationColumns+" FROM payment_applications WHERE payment_id = $1 ORDER BY created_at, id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		application, err := scanPaymentApplication(rows)
+		if err != nil {
+			return nil, err
+		}
+		payment.Applications = append(payment.Applications, *application)
+	}
+	return payment, rows.Err()
+}
+
+// lockedTargets holds the invoices and orders locked by one transaction, so
+// several applications to the same document each see the ones before.
+type lockedTargets struct {
+	tx       *sql.Tx
+	invoices map[uuid.UUID]*Invoice
+	orders   map[uuid.UUID]*Order
+}
+
+// lock locks the invoices, then the orders they bill along with orderIDs,
+// each in ID order, so transactions touching the same documents cannot
+// deadlock whatever order their applications come in.
+func (t lockedTargets) lock(ctx context.Context, invoiceIDs, orderIDs []uuid.UUID) error {
+	for _, id := range sortedIDs(invoiceIDs) {
+		invoice, err := t.invoice(ctx, id)
+		if err != nil {
+			return err
+		}
+		if invoice.OrderID != nil {
+			orderIDs = append(orderIDs, *invoice.OrderID)
+		}
+	}
+	for _, id := range sortedIDs(orderIDs) {
+		if _, err := t.order(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedIDs returns a sorted copy of ids, the order rows are locked in.
+func sortedIDs(ids []uuid.UUID) []uuid.UUID {
+	sorted := append([]uuid.UUID{}, ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].String() < sorted[j].String() })
+	return sorted
+}
+
+func (t lockedTargets) invoice(ctx context.Context, id uuid.UUID) (*Invoice, error) {
+	if invoice, ok := t.invoices[id]; ok {
+		return invoice, nil
+	}
+	invoice, err := scanInvoice(t.tx.QueryRowContext(ctx, "SELECT "+invoiceColumns+" FROM invoices WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		return nil, err
+	}
+	t.invoices[id] = invoice
+	return invoice, nil
+}
+
+func (t lockedTargets) order(ctx context.Context, id uuid.UUID) (*Order, error) {
+	if order, ok := t.orders[id]; ok {
+		return order, nil
+	}
+	order, err := lockOrder(ctx, t.tx, id)
+	if err != nil {
+		return nil, err
+	}
+	t.orders[id] = order
+	return order, nil
+}
+
+// applyToInvoice pays an invoice and counts the payment towards the order it
+// bills, if any.
+func (t lockedTargets) applyToInvoice(ctx context.Context, customerID, invoiceID uuid.UUID, amount core.Money, at time.Time) error {
+	invoice, err := t.invoice(ctx, invoiceID)
+	if err != nil {
+		return err
+	}
+	if invoice.CustomerID != customerID {
+		return fmt.Errorf("%w: invoice %s belongs to another customer", ErrInvalidPayment, invoice.ID)
+	}
+	if err := invoice.ApplyPayment(amount, at); err != nil {
+		return err
+	}
+	if err := updateInvoiceBalance(ctx, t.tx, *invoice); err != nil {
+		return err
+	}
+	if invoice.OrderID == nil {
+		return nil
+	}
+	order, err := t.order(ctx, *invoice.OrderID)
+	if err != nil {
+		return err
+	}
+	if order.AmountPaid, err = order.AmountPaid.Add(amount); err != nil {
+		return err
+	}
+	return updateOrderAmountPaid(ctx, t.tx, *order)
+}
+
+// applyToOrder pays an order that has not been invoiced yet. Once it has, the
+// payment must go to the invoice instead.
+func (t lockedTargets) applyToOrder(ctx context.Context, customerID, orderID uuid.UUID, amount core.Money) error {
+	order, err := t.order(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if order.CustomerID != customerID {
+		return fmt.Errorf("%w: order %s belongs to another customer", ErrInvalidPayment, order.ID)
+	}
+	var invoiced bool
+	err = t.tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM invoices WHERE order_id = $1 AND kind = $2 AND status <> $3)", orderID, InvoiceKindInvoice, InvoiceStatusVoid).Scan(&invoiced)
+	if err != nil {
+		return err
+	}
+	if invoiced {
+		return fmt.Errorf("%w: apply the payment to the order's invoice", ErrOrderAlreadyInvoiced)
+	}
+	if err := order.ApplyPayment(amount); err != nil {
+		return err
+	}
+	return updateOrderAmountPaid(ctx, t.tx, *order)
+}
+
+func lockOrder(ctx context.Context, tx *sql.Tx, id uuid.UUID) (*Order, error) {
+	return scanOrder(tx.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders WHERE id = $1 FOR UPDATE", id))
+}
+
+func updateOrderAmountPaid(ctx context.Context, tx *sql.Tx, order Order) error {
+	_, err := tx.ExecContext(ctx, "UPDATE orders SET amount_paid = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", order.AmountPaid, order.ID)
+	return err
+}
+
+func queryPaymentApplications(ctx context.Context, db *sql.DB, query string, args ...any) ([]*PaymentApplication, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applications []*PaymentApplication
+	for rows.Next() {
+		application, err := scanPaymentApplication(rows)
+		if err != nil {
+			return nil, err
+		}
+		applications = append(applications, application)
+	}
+	return applications, rows.Err()
+}
@@ -0,0 +1,625 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+type PaymentService interface {
+	PaymentReader
+	PaymentRecorder
+	PaymentApplier
+	CustomerCreditManager
+	PaymentProcessor
+	PaymentReverser
+	PaymentLedger
+}
+
+type PaymentRepository interface {
+	PaymentReader
+	PaymentRecorder
+	PaymentApplicationWriter
+	PaymentStatusUpdater
+	RefundRepository
+	ChargebackRepository
+	LedgerReader
+}
+
+type paymentService struct {
+	repo     PaymentRepository
+	invoices InvoiceReader
+	orders   OrderRetriever
+	gateway  PaymentGateway
+	rates    CurrencyConverter
+	now      func() time.Time
+}
+
+type PaymentServiceOption func(*paymentService)
+
+// WithPaymentGateway processes card payments through gateway. Without one,
+// payments can only be recorded, and processing them fails with
+// ErrNoPaymentGateway.
+func WithPaymentGateway(gateway PaymentGateway) PaymentServiceOption {
+	return func(s *paymentService) {
+		s.gateway = gateway
+	}
+}
+
+// WithRealizedFX records the exchange gain or loss on every application of a
+// foreign-currency payment to an invoice, at the rates of the invoice's issue
+// date and the payment date. Without it, such applications fail with
+// ErrNoExchangeRate.
+func WithRealizedFX(rates CurrencyConverter) PaymentServiceOption {
+	return func(s *paymentService) {
+		s.rates = rates
+	}
+}
+
+func NewPaymentService(repo PaymentRepository, invoices InvoiceReader, orders OrderRetriever, opts ...PaymentServiceOption) PaymentService {
+	s := &paymentService{repo: repo, invoices: invoices, orders: orders, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+type PaymentReader interface {
+	PaymentRetriever
+	PaymentLister
+}
+
+type PaymentRetriever interface {
+	GetPaymentByID(ctx context.Context, id uuid.UUID) (*Payment, error)
+}
+
+type PaymentLister interface {
+	GetPaymentsByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Payment, error)
+}
+
+type PaymentRecorder interface {
+	RecordPayment(ctx context.Context, payment Payment) (*Payment, error)
+}
+
+// PaymentApplier applies payments to invoices and orders. Whatever is left
+// unapplied is the customer's credit.
+type PaymentApplier interface {
+	ApplyPayment(ctx context.Context, paymentID uuid.UUID, applications []PaymentApplication) (*Payment, error)
+	AutoApplyPayment(ctx context.Context, paymentID uuid.UUID) (*Payment, error)
+}
+
+type CustomerCreditManager interface {
+	GetCustomerCredit(ctx context.Context, customerID uuid.UUID) (*CustomerCredit, error)
+	ApplyCustomerCredit(ctx context.Context, customerID uuid.UUID, application PaymentApplication) (*CustomerCredit, error)
+}
+
+// PaymentProcessor takes and settles payments through the PaymentGateway.
+type PaymentProcessor interface {
+	CardCharger
+	PaymentCapturer
+	PaymentVoider
+	PaymentStatusSyncer
+}
+
+type CardCharger interface {
+	ChargeCard(ctx context.Context, charge CardCharge) (*Payment, error)
+}
+
+type PaymentCapturer interface {
+	CapturePayment(ctx context.Context, id uuid.UUID, amount core.Money) (*Payment, error)
+}
+
+type PaymentVoider interface {
+	VoidPayment(ctx context.Context, id uuid.UUID) (*Payment, error)
+}
+
+type PaymentStatusSyncer interface {
+	SyncPaymentStatus(ctx context.Context, id uuid.UUID) (*Payment, error)
+}
+
+// PaymentApplicationWriter applies payments to invoices and orders in one
+// transaction. It locks every payment, invoice and order involved, re-checks
+// unapplied amounts and balances, and fails as a whole if any application
+// does not fit. Payments are returned in the order they first appear.
+type PaymentApplicationWriter interface {
+	ApplyPayments(ctx context.Context, applications []PaymentApplication, at time.Time) ([]*Payment, error)
+}
+
+// PaymentStatusUpdater saves a payment's status, amount and processor fields
+// only if the stored status is still from. Otherwise it returns
+// ErrPaymentStatusConflict, so two requests cannot both settle a payment.
+type PaymentStatusUpdater interface {
+	UpdatePaymentStatus(ctx context.Context, payment Payment, from PaymentStatus) (*Payment, error)
+}
+
+// CardCharge is a request to take a card payment. With CaptureLater the
+// funds are only authorized, and CapturePayment or VoidPayment settles the
+// payment afterwards.
+type CardCharge struct {
+	CustomerID   uuid.UUID     `json:"customer_id"`
+	OrderID      *uuid.UUID    `json:"order_id"`
+	Method       PaymentMethod `json:"payment_method"`
+	Amount       core.Money    `json:"amount"`
+	Card         PaymentCard   `json:"card"`
+	CaptureLater bool          `json:"capture_later"`
+}
+
+func (s *paymentService) GetPaymentByID(ctx context.Context, id uuid.UUID) (*Payment, error) {
+	return s.repo.GetPaymentByID(ctx, id)
+}
+
+func (s *paymentService) GetPaymentsByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Payment, error) {
+	return s.repo.GetPaymentsByCustomerID(ctx, customerID)
+}
+
+// RecordPayment records money received outside a payment processor, such as
+// a check or bank transfer. Payments are recorded unapplied.
+func (s *paymentService) RecordPayment(ctx context.Context, payment Payment) (*Payment, error) {
+	if payment.CustomerID == uuid.Nil {
+		return nil, fmt.Errorf("%w: customer is required", ErrInvalidPayment)
+	}
+	if !payment.Amount.IsPositive() {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidPayment)
+	}
+	switch payment.Method {
+	case PaymentMethodCreditCard, PaymentMethodDebitCard, PaymentMethodBankTransfer, PaymentMethodCash, PaymentMethodCheck:
+	default:
+		return nil, fmt.Errorf("%w: unknown payment method %q", ErrInvalidPayment, payment.Method)
+	}
+	switch payment.Status {
+	case "":
+		payment.Status = PaymentStatusCompleted
+	case PaymentStatusPending, PaymentStatusCompleted:
+	default:
+		return nil, fmt.Errorf("%w: payments are recorded as pending or completed", ErrInvalidPayment)
+	}
+	if payment.PaymentDate.IsZero() {
+		payment.PaymentDate = s.now()
+	}
+	payment.Currency = currencyOf(payment.Amount)
+	payment.TransactionID, payment.ProcessorReference, payment.ProcessedAt, payment.ProcessorData = "", "", nil, nil
+	payment.Applications = nil
+	return s.repo.RecordPayment(ctx, payment)
+}
+
+// ApplyPayment splits a payment across the customer's open invoices and
+// orders not yet invoiced, in whole or in part. Applications are validated
+// against the current payment and documents, then re-checked by the
+// repository under row locks.
+func (s *paymentService) ApplyPayment(ctx context.Context, paymentID uuid.UUID, applications []PaymentApplication) (*Payment, error) {
+	if len(applications) == 0 {
+		return nil, fmt.Errorf("%w: at least one application is required", ErrInvalidPayment)
+	}
+	payment, err := s.repo.GetPaymentByID(ctx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != PaymentStatusCompleted {
+		return nil, fmt.Errorf("%w: only completed payments can be applied", ErrInvalidPayment)
+	}
+
+	now := s.now()
+	var requested core.Money
+	seen := make(map[string]bool, len(applications))
+	for i := range applications {
+		application := &applications[i]
+		target, err := application.target()
+		if err != nil {
+			return nil, err
+		}
+		if seen[target] {
+			return nil, fmt.Errorf("%w: %s is listed more than once", ErrInvalidPayment, target)
+		}
+		seen[target] = true
+		application.PaymentID = paymentID
+
+		if err := s.checkApplication(ctx, payment.CustomerID, *application, now); err != nil {
+			return nil, err
+		}
+		if requested, err = requested.Add(application.Amount); err != nil {
+			return nil, err
+		}
+	}
+
+	unapplied, err := payment.Unapplied()
+	if err != nil {
+		return nil, err
+	}
+	if cmp, err := requested.Cmp(unapplied); err != nil {
+		return nil, err
+	} else if cmp > 0 {
+		return nil, fmt.Errorf("%w: payment has %s unapplied", ErrOverApplied, unapplied)
+	}
+	if err := s.recordRealizedFX(ctx, applications, payment); err != nil {
+		return nil, err
+	}
+	applied, err := s.repo.ApplyPayments(ctx, applications, now)
+	if err != nil {
+		return nil, err
+	}
+	return applied[0], nil
+}
+
+// AutoApplyPayment applies what is left of a payment to the customer's open
+// invoices, earliest due first, paying each in full before moving on. An
+// overpayment stays unapplied as customer credit.
+func (s *paymentService) AutoApplyPayment(ctx context.Context, paymentID uuid.UUID) (*Payment, error) {
+	payment, err := s.repo.GetPaymentByID(ctx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != PaymentStatusCompleted {
+		return nil, fmt.Errorf("%w: only completed payments can be applied", ErrInvalidPayment)
+	}
+	remaining, err := payment.Unapplied()
+	if err != nil {
+		return nil, err
+	}
+	invoices, err := s.invoices.GetInvoicesByCustomerID(ctx, payment.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	var open []*Invoice
+	for _, invoice := range invoices {
+		if invoice.IsOpen() {
+			open = append(open, invoice)
+		}
+	}
+	sort.SliceStable(open, func(i, j int) bool {
+		return dueBefore(open[i], open[j])
+	})
+
+	var applications []PaymentApplication
+	for _, invoice := range open {
+		if !remaining.IsPositive() {
+			break
+		}
+		balance, err := invoice.Balance()
+		if err != nil {
+			return nil, err
+		}
+		amount, err := balance.Min(remaining)
+		if err != nil {
+			return nil, err
+		}
+		if !amount.IsPositive() {
+			continue
+		}
+		applications = append(applications, PaymentApplication{PaymentID: paymentID, InvoiceID: &invoice.ID, Amount: amount})
+		if remaining, err = remaining.Sub(amount); err != nil {
+			return nil, err
+		}
+	}
+	if len(applications) == 0 {
+		return payment, nil
+	}
+	if err := s.recordRealizedFX(ctx, applications, payment); err != nil {
+		return nil, err
+	}
+	applied, err := s.repo.ApplyPayments(ctx, applications, s.now())
+	if err != nil {
+		return nil, err
+	}
+	return applied[0], nil
+}
+
+// GetCustomerCredit totals the unapplied part of the customer's completed
+// payments.
+func (s *paymentService) GetCustomerCredit(ctx context.Context, customerID uuid.UUID) (*CustomerCredit, error) {
+	payments, err := s.repo.GetPaymentsByCustomerID(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	return newCustomerCredit(customerID, payments)
+}
+
+// ApplyCustomerCredit pays the invoice or order named by application out of
+// the customer's credit, drawing on the oldest payments first. The
+// application's PaymentID is ignored.
+func (s *paymentService) ApplyCustomerCredit(ctx context.Context, customerID uuid.UUID, application PaymentApplication) (*CustomerCredit, error) {
+	if _, err := application.target(); err != nil {
+		return nil, err
+	}
+	if !application.Amount.IsPositive() {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidPayment)
+	}
+	credit, err := s.GetCustomerCredit(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if cmp, err := application.Amount.Cmp(credit.Available); err != nil {
+		return nil, err
+	} else if cmp > 0 {
+		return nil, fmt.Errorf("%w: %s available", ErrInsufficientCredit, credit.Available)
+	}
+	now := s.now()
+	if err := s.checkApplication(ctx, customerID, application, now); err != nil {
+		return nil, err
+	}
+
+	var applications []PaymentApplication
+	remaining := application.Amount
+	for _, payment := range credit.Payments {
+		if !remaining.IsPositive() {
+			break
+		}
+		unapplied, err := payment.Unapplied()
+		if err != nil {
+			return nil, err
+		}
+		amount, err := unapplied.Min(remaining)
+		if err != nil {
+			return nil, err
+		}
+		applications = append(applications, PaymentApplication{
+			PaymentID: payment.ID,
+			InvoiceID: application.InvoiceID,
+			OrderID:   application.OrderID,
+			Amount:    amount,
+		})
+		if remaining, err = remaining.Sub(amount); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.recordRealizedFX(ctx, applications, credit.Payments...); err != nil {
+		return nil, err
+	}
+	applied, err := s.repo.ApplyPayments(ctx, applications, now)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uuid.UUID]*Payment, len(applied))
+	for _, payment := range applied {
+		byID[payment.ID] = payment
+	}
+	payments := make([]*Payment, 0, len(credit.Payments))
+	for _, payment := range credit.Payments {
+		if updated, ok := byID[payment.ID]; ok {
+			payment = updated
+		}
+		payments = append(payments, payment)
+	}
+	return newCustomerCredit(customerID, payments)
+}
+
+// checkApplication validates one application against the current invoice or
+// order. The repository repeats the check under lock.
+func (s *paymentService) checkApplication(ctx context.Context, customerID uuid.UUID, application PaymentApplication, at time.Time) error {
+	if application.InvoiceID != nil {
+		invoice, err := s.invoices.GetInvoiceByID(ctx, *application.InvoiceID)
+		if err != nil {
+			return err
+		}
+		if invoice.CustomerID != customerID {
+			return fmt.Errorf("%w: invoice %s belongs to another customer", ErrInvalidPayment, invoice.ID)
+		}
+		return invoice.ApplyPayment(application.Amount, at)
+	}
+	order, err := s.orders.GetOrderByID(ctx, *application.OrderID)
+	if err != nil {
+		return err
+	}
+	if order.CustomerID != customerID {
+		return fmt.Errorf("%w: order %s belongs to another customer", ErrInvalidPayment, order.ID)
+	}
+	return order.ApplyPayment(application.Amount)
+}
+
+// recordRealizedFX sets RealizedFX on each application of a foreign-currency
+// payment to an invoice: the base-currency value of the amount at the
+// payment date's rate less its value at the rate the invoice was issued at.
+func (s *paymentService) recordRealizedFX(ctx context.Context, applications []PaymentApplication, payments ...*Payment) error {
+	for i := range applications {
+		application := &applications[i]
+		if application.InvoiceID == nil || currencyOf(application.Amount) == BaseCurrency {
+			continue
+		}
+		if s.rates == nil {
+			return fmt.Errorf("%w: gains and losses on %s payments are not recorded", ErrNoExchangeRate, currencyOf(application.Amount))
+		}
+		var paid time.Time
+		for _, payment := range payments {
+			if payment.ID == application.PaymentID {
+				paid = payment.PaymentDate
+				break
+			}
+		}
+		invoice, err := s.invoices.GetInvoiceByID(ctx, *application.InvoiceID)
+		if err != nil {
+			return err
+		}
+		issued := invoice.CreatedAt
+		if invoice.IssueDate != nil {
+			issued = *invoice.IssueDate
+		}
+		if application.RealizedFX, err = realizedFX(s.rates, application.Amount, issued, paid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dueBefore orders invoices by due date, then issue date and number, with
+// undated invoices last.
+func dueBefore(a, b *Invoice) bool {
+	switch {
+	case a.DueDate != nil && b.DueDate != nil && !a.DueDate.Equal(*b.DueDate):
+		return a.DueDate.Before(*b.DueDate)
+	case (a.DueDate == nil) != (b.DueDate == nil):
+		return a.DueDate != nil
+	case a.IssueDate != nil && b.IssueDate != nil && !a.IssueDate.Equal(*b.IssueDate):
+		return a.IssueDate.Before(*b.IssueDate)
+	}
+	return a.InvoiceNumber < b.InvoiceNumber
+}
+
+// ChargeCard records a pending payment, authorizes it and, unless the charge
+// asks to capture later, captures it in full. The payment ID is the gateway's
+// idempotency key. A declined card leaves the payment failed and returns
+// ErrPaymentDeclined; a capture the gateway could not complete leaves it
+// pending with its authorization, ready for CapturePayment.
+func (s *paymentService) ChargeCard(ctx context.Context, charge CardCharge) (*Payment, error) {
+	if s.gateway == nil {
+		return nil, ErrNoPaymentGateway
+	}
+	switch charge.Method {
+	case "":
+		charge.Method = PaymentMethodCreditCard
+	case PaymentMethodCreditCard, PaymentMethodDebitCard:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMethod, charge.Method)
+	}
+	if charge.Card.Number == "" {
+		return nil, fmt.Errorf("%w: card number is required", ErrInvalidPayment)
+	}
+
+	payment, err := s.RecordPayment(ctx, Payment{
+		CustomerID: charge.CustomerID,
+		OrderID:    charge.OrderID,
+		Method:     charge.Method,
+		Amount:     charge.Amount,
+		Status:     PaymentStatusPending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.gateway.Authorize(ctx, AuthorizationRequest{
+		PaymentID:  payment.ID,
+		CustomerID: payment.CustomerID,
+		Amount:     payment.Amount,
+		Card:       charge.Card,
+	})
+	if err != nil {
+		if _, failErr := s.transition(ctx, payment, PaymentStatusFailed, result); failErr != nil {
+			return nil, errors.Join(err, failErr)
+		}
+		return nil, fmt.Errorf("payment %s: %w", payment.ID, err)
+	}
+	if payment, err = s.transition(ctx, payment, PaymentStatusPending, result); err != nil {
+		return nil, err
+	}
+	if charge.CaptureLater {
+		return payment, nil
+	}
+	return s.capture(ctx, payment, core.Money{})
+}
+
+// CapturePayment settles an authorized payment. A zero amount captures the
+// whole authorization; a smaller one captures part of it and the payment's
+// amount becomes the amount captured.
+func (s *paymentService) CapturePayment(ctx context.Context, id uuid.UUID, amount core.Money) (*Payment, error) {
+	if s.gateway == nil {
+		return nil, ErrNoPaymentGateway
+	}
+	payment, err := s.repo.GetPaymentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.capture(ctx, payment, amount)
+}
+
+func (s *paymentService) capture(ctx context.Context, payment *Payment, amount core.Money) (*Payment, error) {
+	if payment.Status != PaymentStatusPending || payment.TransactionID == "" {
+		return nil, fmt.Errorf("%w: payment is %s", ErrPaymentNotAuthorized, payment.Status)
+	}
+	if amount.IsNegative() {
+		return nil, fmt.Errorf("%w: capture amount cannot be negative", ErrInvalidPayment)
+	}
+	result, err := s.gateway.Capture(ctx, payment.TransactionID, amount)
+	if err != nil {
+		return nil, fmt.Errorf("payment %s: %w", payment.ID, err)
+	}
+	payment.Amount = result.CapturedAmount
+	return s.transition(ctx, payment, PaymentStatusCompleted, result)
+}
+
+// VoidPayment cancels a pending payment, releasing its authorization if it
+// has one.
+func (s *paymentService) VoidPayment(ctx context.Context, id uuid.UUID) (*Payment, error) {
+	payment, err := s.repo.GetPaymentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != PaymentStatusPending {
+		return nil, fmt.Errorf("%w: only pending payments can be voided", ErrInvalidPaymentStatus)
+	}
+	var result *GatewayResult
+	if payment.TransactionID != "" {
+		if s.gateway == nil {
+			return nil, ErrNoPaymentGateway
+		}
+		if result, err = s.gateway.Void(ctx, payment.TransactionID); err != nil {
+			return nil, fmt.Errorf("payment %s: %w", payment.ID, err)
+		}
+	}
+	return s.transition(ctx, payment, PaymentStatusFailed, result)
+}
+
+// SyncPaymentStatus brings a gateway payment in line with the processor,
+// for example after a capture whose response was lost. Refunds are recorded
+// by RefundPayment, so a refunded transaction only refreshes the processor
+// fields.
+func (s *paymentService) SyncPaymentStatus(ctx context.Context, id uuid.UUID) (*Payment, error) {
+	if s.gateway == nil {
+		return nil, ErrNoPaymentGateway
+	}
+	payment, err := s.repo.GetPaymentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if payment.TransactionID == "" {
+		return nil, fmt.Errorf("%w: payment was not taken through the gateway", ErrPaymentNotAuthorized)
+	}
+	result, err := s.gateway.Status(ctx, payment.TransactionID)
+	if err != nil {
+		return nil, fmt.Errorf("payment %s: %w", payment.ID, err)
+	}
+	var to PaymentStatus
+	switch result.Status {
+	case GatewayStatusAuthorized:
+		to = PaymentStatusPending
+	case GatewayStatusCaptured:
+		to = PaymentStatusCompleted
+		payment.Amount = result.CapturedAmount
+	case GatewayStatusRefunded:
+		to = PaymentStatusCompleted
+		if payment.Status == PaymentStatusRefunded {
+			to = PaymentStatusRefunded
+		}
+	case GatewayStatusVoided, GatewayStatusDeclined:
+		to = PaymentStatusFailed
+	default:
+		return nil, fmt.Errorf("%w: unknown gateway status %q", ErrInvalidGatewayRequest, result.Status)
+	}
+	return s.transition(ctx, payment, to, result)
+}
+
+// transition moves payment to status, recording result if there is one.
+// Staying in the same status only refreshes the processor fields.
+func (s *paymentService) transition(ctx context.Context, payment *Payment, to PaymentStatus, result *GatewayResult) (*Payment, error) {
+	from := payment.Status
+	if to != from && !from.CanTransitionTo(to) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidPaymentStatus, from, to)
+	}
+	updated := *payment
+	updated.Status = to
+	if result != nil {
+		processedAt := result.ProcessedAt
+		updated.TransactionID = result.TransactionID
+		updated.ProcessorReference = result.ProcessorReference
+		updated.ProcessedAt = &processedAt
+		updated.ProcessorData = result.Raw
+	} else {
+		processedAt := s.now()
+		updated.ProcessedAt = &processedAt
+	}
+	return s.repo.UpdatePaymentStatus(ctx, updated, from)
+}
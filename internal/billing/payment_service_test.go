@@ -0,0 +1,459 @@
+package billing
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type PaymentServiceTestSuite struct {
+	suite.Suite
+	paymentRepo *MockPaymentRepository
+	invoiceRepo *MockInvoiceRepository
+	orderRepo   *MockOrderRepository
+	gateway     *FakeGateway
+	now         time.Time
+	service     PaymentService
+}
+
+func (s *PaymentServiceTestSuite) SetupTest() {
+	s.paymentRepo = new(MockPaymentRepository)
+	s.invoiceRepo = new(MockInvoiceRepository)
+	s.orderRepo = new(MockOrderRepository)
+	s.now = time.Date(2026, 6, 10, 14, 0, 0, 0, time.UTC)
+	s.gateway = NewFakeGateway()
+	s.gateway.now = func() time.Time { return s.now }
+	s.service = NewPaymentService(s.paymentRepo, s.invoiceRepo, s.orderRepo, WithPaymentGateway(s.gateway))
+	s.service.(*paymentService).now = func() time.Time { return s.now }
+}
+
+func (s *PaymentServiceTestSuite) TearDownTest() {
+	s.paymentRepo.AssertExpectations(s.T())
+	s.invoiceRepo.AssertExpectations(s.T())
+	s.orderRepo.AssertExpectations(s.T())
+}
+
+func TestPaymentServiceSuite(t *testing.T) {
+	suite.Run(t, new(PaymentServiceTestSuite))
+}
+
+// expectStatusUpdate saves the payment passed to UpdatePaymentStatus from
+// the given status into saved and returns it.
+func (s *PaymentServiceTestSuite) expectStatusUpdate(ctx context.Context, from PaymentStatus, saved *Payment) {
+	s.paymentRepo.On("UpdatePaymentStatus", ctx, mock.AnythingOfType("Payment"), from).Run(func(args mock.Arguments) {
+		*saved = args.Get(1).(Payment)
+	}).Return(saved, nil).Once()
+}
+
+func (s *PaymentServiceTestSuite) TestChargeCard_CapturesApprovedCard() {
+	// Arrange
+	ctx := context.Background()
+	customerID := uuid.New()
+	pending := &Payment{CustomerID: customerID, Method: PaymentMethodCreditCard, Amount: usd("250.00"), Status: PaymentStatusPending, PaymentDate: s.now}
+	pending.ID = uuid.New()
+	var authorized, captured Payment
+
+	s.paymentRepo.On("RecordPayment", ctx, mock.MatchedBy(func(p Payment) bool {
+		return p.Status == PaymentStatusPending && p.TransactionID == ""
+	})).Return(pending, nil)
+	s.expectStatusUpdate(ctx, PaymentStatusPending, &authorized)
+	s.expectStatusUpdate(ctx, PaymentStatusPending, &captured)
+
+	// Act
+	payment, err := s.service.ChargeCard(ctx, CardCharge{
+		CustomerID: customerID,
+		Amount:     usd("250.00"),
+		Card:       PaymentCard{Number: TestCardApproved, ExpMonth: 12, ExpYear: 2030, CVC: "123"},
+	})
+
+	// Assert
+	s.NoError(err)
+	s.Equal(PaymentStatusCompleted, payment.Status)
+	s.Equal(usd("250.00"), payment.Amount)
+	s.Equal("fake_txn_000001", payment.TransactionID)
+	s.Equal(authorized.TransactionID, payment.TransactionID)
+	s.Contains(payment.ProcessorReference, "fake_capture_")
+	s.Equal(s.now, *payment.ProcessedAt)
+	s.Contains(string(payment.ProcessorData), `"card_last4":"4242"`)
+	s.NotContains(string(payment.ProcessorData), TestCardApproved)
+}
+
+func (s *PaymentServiceTestSuite) TestChargeCard_DeclinedCardFailsPayment() {
+	// Arrange
+	ctx := context.Background()
+	pending := &Payment{CustomerID: uuid.New(), Method: PaymentMethodCreditCard, Amount: usd("80.00"), Status: PaymentStatusPending}
+	pending.ID = uuid.New()
+	var failed Payment
+
+	s.paymentRepo.On("RecordPayment", ctx, mock.AnythingOfType("Payment")).Return(pending, nil)
+	s.expectStatusUpdate(ctx, PaymentStatusPending, &failed)
+
+	// Act
+	payment, err := s.service.ChargeCard(ctx, CardCharge{
+		CustomerID: pending.CustomerID,
+		Amount:     usd("80.00"),
+		Card:       PaymentCard{Number: TestCardInsufficientFunds, ExpMonth: 1, ExpYear: 2030},
+	})
+
+	// Assert
+	s.ErrorIs(err, ErrPaymentDeclined)
+	s.ErrorContains(err, pending.ID.String())
+	s.ErrorContains(err, "insufficient_funds")
+	s.Nil(payment)
+	s.Equal(PaymentStatusFailed, failed.Status)
+	s.NotEmpty(failed.TransactionID)
+}
+
+func (s *PaymentServiceTestSuite) TestChargeCard_RejectsMethodsOutsideTheGateway() {
+	// Act
+	payment, err := s.service.ChargeCard(context.Background(), CardCharge{
+		CustomerID: uuid.New(),
+		Method:     PaymentMethodCheck,
+		Amount:     usd("10.00"),
+		Card:       PaymentCard{Number: TestCardApproved},
+	})
+
+	// Assert
+	s.ErrorIs(err, ErrUnsupportedMethod)
+	s.Nil(payment)
+}
+
+func (s *PaymentServiceTestSuite) TestChargeCard_RequiresGateway() {
+	// Arrange
+	service := NewPaymentService(s.paymentRepo, s.invoiceRepo, s.orderRepo)
+
+	// Act
+	payment, err := service.ChargeCard(context.Background(), CardCharge{CustomerID: uuid.New(), Amount: usd("10.00")})
+
+	// Assert
+	s.ErrorIs(err, ErrNoPaymentGateway)
+	s.Nil(payment)
+}
+
+func (s *PaymentServiceTestSuite) TestCapturePayment_PartialCaptureSetsAmount() {
+	// Arrange
+	ctx := context.Background()
+	payment := s.authorizedPayment(ctx, usd("100.00"))
+	var captured Payment
+
+	s.paymentRepo.On("GetPaymentByID", ctx, payment.ID).Return(payment, nil)
+	s.expectStatusUpdate(ctx, PaymentStatusPending, &captured)
+
+	// Act
+	result, err := s.service.CapturePayment(ctx, payment.ID, usd("60.00"))
+
+	// Assert
+	s.NoError(err)
+	s.Equal(PaymentStatusCompleted, result.Status)
+	s.Equal(usd("60.00"), result.Amount)
+}
+
+func (s *PaymentServiceTestSuite) TestCapturePayment_RejectsPaymentWithoutAuthorization() {
+	// Arrange
+	ctx := context.Background()
+	paymentID := uuid.New()
+
+	s.paymentRepo.On("GetPaymentByID", ctx, paymentID).Return(&Payment{Method: PaymentMethodCheck, Status: PaymentStatusPending, Amount: usd("10.00")}, nil)
+
+	// Act
+	result, err := s.service.CapturePayment(ctx, paymentID, usd("0"))
+
+	// Assert
+	s.ErrorIs(err, ErrPaymentNotAuthorized)
+	s.Nil(result)
+}
+
+func (s *PaymentServiceTestSuite) TestVoidPayment_ReleasesAuthorization() {
+	// Arrange
+	ctx := context.Background()
+	payment := s.authorizedPayment(ctx, usd("100.00"))
+	var voided Payment
+
+	s.paymentRepo.On("GetPaymentByID", ctx, payment.ID).Return(payment, nil)
+	s.expectStatusUpdate(ctx, PaymentStatusPending, &voided)
+
+	// Act
+	result, err := s.service.VoidPayment(ctx, payment.ID)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(PaymentStatusFailed, result.Status)
+	status, err := s.gateway.Status(ctx, payment.TransactionID)
+	s.NoError(err)
+	s.Equal(GatewayStatusVoided, status.Status)
+}
+
+func (s *PaymentServiceTestSuite) TestSyncPaymentStatus_PicksUpCaptureMadeAtProcessor() {
+	// Arrange
+	ctx := context.Background()
+	payment := s.authorizedPayment(ctx, usd("100.00"))
+	_, err := s.gateway.Capture(ctx, payment.TransactionID, usd("75.00"))
+	s.Require().NoError(err)
+	var synced Payment
+
+	s.paymentRepo.On("GetPaymentByID", ctx, payment.ID).Return(payment, nil)
+	s.expectStatusUpdate(ctx, PaymentStatusPending, &synced)
+
+	// Act
+	result, err := s.service.SyncPaymentStatus(ctx, payment.ID)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(PaymentStatusCompleted, result.Status)
+	s.Equal(usd("75.00"), result.Amount)
+}
+
+func (s *PaymentServiceTestSuite) TestRecordPayment_DropsProcessorFields() {
+	// Arrange
+	ctx := context.Background()
+	s.paymentRepo.On("RecordPayment", ctx, mock.MatchedBy(func(p Payment) bool {
+		return p.TransactionID == "" && p.ProcessorData == nil && p.Status == PaymentStatusCompleted
+	})).Return(&Payment{}, nil)
+
+	// Act
+	_, err := s.service.RecordPayment(ctx, Payment{
+		CustomerID:    uuid.New(),
+		Method:        PaymentMethodCheck,
+		Amount:        usd("10.00"),
+		TransactionID: "forged",
+		ProcessorData: []byte(`{}`),
+	})
+
+	// Assert
+	s.NoError(err)
+}
+
+func (s *PaymentServiceTestSuite) TestApplyPayment_SplitsOneCheckAcrossOrderAndInvoice() {
+	// Arrange
+	ctx := context.Background()
+	customerID, paymentID, orderID, invoiceID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	payment := &Payment{CustomerID: customerID, Method: PaymentMethodCheck, Amount: usd("300.00"), Status: PaymentStatusCompleted}
+	applications := []PaymentApplication{
+		{OrderID: &orderID, Amount: usd("100.00")},
+		{InvoiceID: &invoiceID, Amount: usd("150.00")},
+	}
+
+	s.paymentRepo.On("GetPaymentByID", ctx, paymentID).Return(payment, nil)
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(&Order{CustomerID: customerID, Status: OrderStatusConfirmed, Total: usd("400.00"), AmountPaid: usd("250.00")}, nil)
+	s.invoiceRepo.On("GetInvoiceByID", ctx, invoiceID).Return(&Invoice{Kind: InvoiceKindInvoice, CustomerID: customerID, Status: InvoiceStatusSent, Total: usd("150.00")}, nil)
+	s.paymentRepo.On("ApplyPayments", ctx, applications, s.now).Return([]*Payment{payment}, nil)
+
+	// Act
+	result, err := s.service.ApplyPayment(ctx, paymentID, applications)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(payment, result)
+	s.Equal(paymentID, applications[0].PaymentID)
+}
+
+func (s *PaymentServiceTestSuite) TestApplyPayment_RecordsRealizedFXOnForeignInvoice() {
+	// Arrange
+	ctx := context.Background()
+	rates, err := NewExchangeRateTable([]ExchangeRate{
+		{Currency: core.EUR, EffectiveDate: *date(2026, 1, 1), Rate: big.NewRat(11, 10)},
+		{Currency: core.EUR, EffectiveDate: *date(2026, 6, 1), Rate: big.NewRat(108, 100)},
+	})
+	s.Require().NoError(err)
+	s.service = NewPaymentService(s.paymentRepo, s.invoiceRepo, s.orderRepo, WithRealizedFX(rates))
+	s.service.(*paymentService).now = func() time.Time { return s.now }
+
+	customerID, paymentID, invoiceID := uuid.New(), uuid.New(), uuid.New()
+	issued := *date(2026, 5, 20)
+	payment := &Payment{CustomerID: customerID, Method: PaymentMethodBankTransfer, Amount: core.MustParseMoney("500.00", core.EUR), Currency: core.EUR, PaymentDate: *date(2026, 6, 9), Status: PaymentStatusCompleted}
+	payment.ID = paymentID
+	applications := []PaymentApplication{{InvoiceID: &invoiceID, Amount: core.MustParseMoney("500.00", core.EUR)}}
+
+	s.paymentRepo.On("GetPaymentByID", ctx, paymentID).Return(payment, nil)
+	s.invoiceRepo.On("GetInvoiceByID", ctx, invoiceID).Return(&Invoice{Kind: InvoiceKindInvoice, CustomerID: customerID, Status: InvoiceStatusSent, Currency: core.EUR, IssueDate: &issued, Total: core.MustParseMoney("500.00", core.EUR)}, nil)
+	s.paymentRepo.On("ApplyPayments", ctx, mock.Anything, s.now).Return([]*Payment{payment}, nil)
+
+	// Act
+	_, err = s.service.ApplyPayment(ctx, paymentID, applications)
+
+	// Assert
+	s.NoError(err)
+	applied := s.paymentRepo.Calls[len(s.paymentRepo.Calls)-1].Arguments.Get(1).([]PaymentApplication)
+	s.Equal(usd("-10.00"), applied[0].RealizedFX)
+}
+
+func (s *PaymentServiceTestSuite) TestApplyPayment_ForeignInvoiceRequiresRates() {
+	// Arrange
+	ctx := context.Background()
+	customerID, paymentID, invoiceID := uuid.New(), uuid.New(), uuid.New()
+	payment := &Payment{CustomerID: customerID, Method: PaymentMethodBankTransfer, Amount: core.MustParseMoney("500.00", core.EUR), Currency: core.EUR, Status: PaymentStatusCompleted}
+	payment.ID = paymentID
+
+	s.paymentRepo.On("GetPaymentByID", ctx, paymentID).Return(payment, nil)
+	s.invoiceRepo.On("GetInvoiceByID", ctx, invoiceID).Return(&Invoice{Kind: InvoiceKindInvoice, CustomerID: customerID, Status: InvoiceStatusSent, Currency: core.EUR, Total: core.MustParseMoney("500.00", core.EUR)}, nil)
+
+	// Act
+	_, err := s.service.ApplyPayment(ctx, paymentID, []PaymentApplication{{InvoiceID: &invoiceID, Amount: core.MustParseMoney("500.00", core.EUR)}})
+
+	// Assert
+	s.ErrorIs(err, ErrNoExchangeRate)
+	s.paymentRepo.AssertNotCalled(s.T(), "ApplyPayments", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *PaymentServiceTestSuite) TestApplyPayment_RejectsMoreThanOrderBalance() {
+	// Arrange
+	ctx := context.Background()
+	customerID, paymentID, orderID := uuid.New(), uuid.New(), uuid.New()
+
+	s.paymentRepo.On("GetPaymentByID", ctx, paymentID).Return(&Payment{CustomerID: customerID, Amount: usd("300.00"), Status: PaymentStatusCompleted}, nil)
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(&Order{OrderNumber: "ORD-000004", CustomerID: customerID, Status: OrderStatusConfirmed, Total: usd("400.00"), AmountPaid: usd("350.00")}, nil)
+
+	// Act
+	result, err := s.service.ApplyPayment(ctx, paymentID, []PaymentApplication{{OrderID: &orderID, Amount: usd("60.00")}})
+
+	// Assert
+	s.ErrorIs(err, ErrOverApplied)
+	s.ErrorContains(err, "ORD-000004 has USD 50.00 outstanding")
+	s.Nil(result)
+}
+
+func (s *PaymentServiceTestSuite) TestApplyPayment_RequiresExactlyOneTarget() {
+	// Arrange
+	ctx := context.Background()
+	paymentID, orderID, invoiceID := uuid.New(), uuid.New(), uuid.New()
+
+	s.paymentRepo.On("GetPaymentByID", ctx, paymentID).Return(&Payment{Amount: usd("300.00"), Status: PaymentStatusCompleted}, nil)
+
+	// Act
+	result, err := s.service.ApplyPayment(ctx, paymentID, []PaymentApplication{{OrderID: &orderID, InvoiceID: &invoiceID, Amount: usd("10.00")}})
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidPayment)
+	s.Nil(result)
+}
+
+func (s *PaymentServiceTestSuite) TestAutoApplyPayment_PaysEarliestDueFirstAndLeavesOverpaymentAsCredit() {
+	// Arrange
+	ctx := context.Background()
+	customerID, paymentID := uuid.New(), uuid.New()
+	payment := &Payment{CustomerID: customerID, Method: PaymentMethodCheck, Amount: usd("200.00"), Status: PaymentStatusCompleted}
+	payment.ID = paymentID
+	later := &Invoice{Kind: InvoiceKindInvoice, CustomerID: customerID, Status: InvoiceStatusSent, DueDate: date(2026, 6, 1), Total: usd("100.00")}
+	later.ID = uuid.New()
+	earlier := &Invoice{Kind: InvoiceKindInvoice, CustomerID: customerID, Status: InvoiceStatusPartiallyPaid, DueDate: date(2026, 5, 1), Total: usd("80.00"), AmountPaid: usd("30.00")}
+	earlier.ID = uuid.New()
+	draft := &Invoice{Kind: InvoiceKindInvoice, CustomerID: customerID, Status: InvoiceStatusDraft, Total: usd("500.00")}
+
+	s.paymentRepo.On("GetPaymentByID", ctx, paymentID).Return(payment, nil)
+	s.invoiceRepo.On("GetInvoicesByCustomerID", ctx, customerID).Return([]*Invoice{later, draft, earlier}, nil)
+	s.paymentRepo.On("ApplyPayments", ctx, []PaymentApplication{
+		{PaymentID: paymentID, InvoiceID: &earlier.ID, Amount: usd("50.00")},
+		{PaymentID: paymentID, InvoiceID: &later.ID, Amount: usd("100.00")},
+	}, s.now).Return([]*Payment{payment}, nil)
+
+	// Act
+	result, err := s.service.AutoApplyPayment(ctx, paymentID)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(payment, result)
+}
+
+func (s *PaymentServiceTestSuite) TestAutoApplyPayment_KeepsEverythingAsCreditWithNothingOpen() {
+	// Arrange
+	ctx := context.Background()
+	customerID, paymentID := uuid.New(), uuid.New()
+	payment := &Payment{CustomerID: customerID, Amount: usd("200.00"), Status: PaymentStatusCompleted}
+
+	s.paymentRepo.On("GetPaymentByID", ctx, paymentID).Return(payment, nil)
+	s.invoiceRepo.On("GetInvoicesByCustomerID", ctx, customerID).Return([]*Invoice{{Kind: InvoiceKindInvoice, Status: InvoiceStatusPaid, Total: usd("10.00"), AmountPaid: usd("10.00")}}, nil)
+
+	// Act
+	result, err := s.service.AutoApplyPayment(ctx, paymentID)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(payment, result)
+}
+
+func (s *PaymentServiceTestSuite) TestGetCustomerCredit_TotalsUnappliedCompletedPayments() {
+	// Arrange
+	ctx := context.Background()
+	customerID := uuid.New()
+	newer := &Payment{Status: PaymentStatusCompleted, PaymentDate: time.Date(2026, 6, 2, 0, 0, 0, 0, time.UTC), Amount: usd("100.00"), Applications: []PaymentApplication{{Amount: usd("60.00")}}}
+	older := &Payment{Status: PaymentStatusCompleted, PaymentDate: time.Date(2026, 5, 2, 0, 0, 0, 0, time.UTC), Amount: usd("25.00")}
+	applied := &Payment{Status: PaymentStatusCompleted, Amount: usd("10.00"), Applications: []PaymentApplication{{Amount: usd("10.00")}}}
+	pending := &Payment{Status: PaymentStatusPending, Amount: usd("500.00")}
+
+	s.paymentRepo.On("GetPaymentsByCustomerID", ctx, customerID).Return([]*Payment{newer, applied, pending, older}, nil)
+
+	// Act
+	credit, err := s.service.GetCustomerCredit(ctx, customerID)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(usd("65.00"), credit.Available)
+	s.Equal([]*Payment{older, newer}, credit.Payments)
+}
+
+func (s *PaymentServiceTestSuite) TestApplyCustomerCredit_DrawsOnOldestPaymentsFirst() {
+	// Arrange
+	ctx := context.Background()
+	customerID, invoiceID := uuid.New(), uuid.New()
+	older := &Payment{CustomerID: customerID, Status: PaymentStatusCompleted, PaymentDate: time.Date(2026, 5, 2, 0, 0, 0, 0, time.UTC), Amount: usd("30.00")}
+	older.ID = uuid.New()
+	newer := &Payment{CustomerID: customerID, Status: PaymentStatusCompleted, PaymentDate: time.Date(2026, 6, 2, 0, 0, 0, 0, time.UTC), Amount: usd("50.00")}
+	newer.ID = uuid.New()
+	newerAfter := *newer
+	newerAfter.Applications = []PaymentApplication{{PaymentID: newer.ID, InvoiceID: &invoiceID, Amount: usd("30.00")}}
+	olderAfter := *older
+	olderAfter.Applications = []PaymentApplication{{PaymentID: older.ID, InvoiceID: &invoiceID, Amount: usd("30.00")}}
+
+	s.paymentRepo.On("GetPaymentsByCustomerID", ctx, customerID).Return([]*Payment{newer, older}, nil)
+	s.invoiceRepo.On("GetInvoiceByID", ctx, invoiceID).Return(&Invoice{Kind: InvoiceKindInvoice, CustomerID: customerID, Status: InvoiceStatusSent, Total: usd("75.00")}, nil)
+	s.paymentRepo.On("ApplyPayments", ctx, []PaymentApplication{
+		{PaymentID: older.ID, InvoiceID: &invoiceID, Amount: usd("30.00")},
+		{PaymentID: newer.ID, InvoiceID: &invoiceID, Amount: usd("30.00")},
+	}, s.now).Return([]*Payment{&olderAfter, &newerAfter}, nil)
+
+	// Act
+	credit, err := s.service.ApplyCustomerCredit(ctx, customerID, PaymentApplication{InvoiceID: &invoiceID, Amount: usd("60.00")})
+
+	// Assert
+	s.NoError(err)
+	s.Equal(usd("20.00"), credit.Available)
+	s.Equal([]*Payment{&newerAfter}, credit.Payments)
+}
+
+func (s *PaymentServiceTestSuite) TestApplyCustomerCredit_RejectsMoreThanAvailable() {
+	// Arrange
+	ctx := context.Background()
+	customerID, orderID := uuid.New(), uuid.New()
+
+	s.paymentRepo.On("GetPaymentsByCustomerID", ctx, customerID).Return([]*Payment{{Status: PaymentStatusCompleted, Amount: usd("40.00")}}, nil)
+
+	// Act
+	credit, err := s.service.ApplyCustomerCredit(ctx, customerID, PaymentApplication{OrderID: &orderID, Amount: usd("60.00")})
+
+	// Assert
+	s.ErrorIs(err, ErrInsufficientCredit)
+	s.Nil(credit)
+}
+
+// authorizedPayment authorizes amount on the fake gateway and returns the
+// pending payment that would have been saved for it.
+func (s *PaymentServiceTestSuite) authorizedPayment(ctx context.Context, amount core.Money) *Payment {
+	payment := &Payment{CustomerID: uuid.New(), Method: PaymentMethodCreditCard, Amount: amount, Status: PaymentStatusPending}
+	payment.ID = uuid.New()
+	result, err := s.gateway.Authorize(ctx, AuthorizationRequest{
+		PaymentID:  payment.ID,
+		CustomerID: payment.CustomerID,
+		Amount:     amount,
+		Card:       PaymentCard{Number: TestCardApproved, ExpMonth: 12, ExpYear: 2030},
+	})
+	s.Require().NoError(err)
+	payment.TransactionID = result.TransactionID
+	return payment
+}
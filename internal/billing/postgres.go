@@ -1 +1,556 @@
-package billing
\ No newline at end of file
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// rereadAmounts rereads amounts scanned before the currency column of their
+// row, which Scan takes to be in DefaultCurrency, in currency.
+func rereadAmounts(currency core.Currency, amounts ...*core.Money) error {
+	for _, amount := range amounts {
+		reread, err := amount.Reread(currency)
+		if err != nil {
+			return err
+		}
+		*amount = reread
+	}
+	return nil
+}
+
+type productRepository struct {
+	db *sql.DB
+}
+
+type priceBookRepository struct {
+	db *sql.DB
+}
+
+func NewProductRepository(db *sql.DB) ProductRepository {
+	return &productRepository{db: db}
+}
+
+func NewPriceBookRepository(db *sql.DB) PriceBookRepository {
+	return &priceBookRepository{db: db}
+}
+
+const productColumns = "id, sku, name, description, category, tax_category, status, is_recurring, price, track_inventory, stock_quantity, reserved_quantity, low_stock_alert, created_at, updated_at"
+
+func scanProduct(row rowScanner) (*Product, error) {
+	var product Product
+	err := row.Scan(&product.ID, &product.SKU, &product.Name, &product.Description, &product.Category, &product.TaxCategory, &product.Status, &product.IsRecurring, &product.Price, &product.TrackInventory, &product.StockQuantity, &product.ReservedQuantity, &product.LowStockAlert, &product.CreatedAt, &product.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r *productRepository) GetProductByID(ctx context.Context, id uuid.UUID) (*Product, error) {
+	return scanProduct(r.db.QueryRowContext(ctx, "SELECT "+productColumns+" FROM products WHERE id = $1", id))
+}
+
+func (r *productRepository) GetProductBySKU(ctx context.Context, sku string) (*Product, error) {
+	return scanProduct(r.db.QueryRowContext(ctx, "SELECT "+productColumns+" FROM products WHERE sku = $1", sku))
+}
+
+func (r *productRepository) ListProducts(ctx context.Context) ([]*Product, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+productColumns+" FROM products ORDER BY sku")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []*Product
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	return products, rows.Err()
+}
+
+func (r *productRepository) CreateProduct(ctx context.Context, product Product) (*Product, error) {
+	if product.ID == uuid.Nil {
+		product.ID = uuid.New()
+	}
+	return scanProduct(r.db.QueryRowContext(ctx, "INSERT INTO products (id, sku, name, description, category, tax_category, status, is_recurring, price, track_inventory, low_stock_alert) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING "+productColumns, product.ID, product.SKU, product.Name, product.Description, product.Category, product.TaxCategory, product.Status, product.IsRecurring, product.Price, product.TrackInventory, product.LowStockAlert))
+}
+
+func (r *productRepository) UpdateProduct(ctx context.Context, product Product) (*Product, error) {
+	return scanProduct(r.db.QueryRowContext(ctx, "UPDATE products SET sku = $1, name = $2, description = $3, category = $4, tax_category = $5, status = $6, is_recurring = $7, price = $8, track_inventory = $9, low_stock_alert = $10, updated_at = CURRENT_TIMESTAMP WHERE id = $11 RETURNING "+productColumns, product.SKU, product.Name, product.Description, product.Category, product.TaxCategory, product.Status, product.IsRecurring, product.Price, product.TrackInventory, product.LowStockAlert, product.ID))
+}
+
+func (r *productRepository) DeleteProduct(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM products WHERE id = $1", id)
+	return err
+}
+
+const priceBookColumns = "id, name, description, customer_id, pricing_tier, is_active, created_at, updated_at"
+
+const priceBookEntryColumns = "id, price_book_id, product_id, price, effective_from, effective_to, created_at, updated_at"
+
+func scanPriceBook(row rowScanner) (*PriceBook, error) {
+	var book PriceBook
+	err := row.Scan(&book.ID, &book.Name, &book.Description, &book.CustomerID, &book.PricingTier, &book.IsActive, &book.CreatedAt, &book.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPriceBookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func scanPriceBookEntry(row rowScanner, extra ...any) (*PriceBookEntry, error) {
+	var entry PriceBookEntry
+	dest := append([]any{&entry.ID, &entry.PriceBookID, &entry.ProductID, &entry.Price, &entry.EffectiveFrom, &entry.EffectiveTo, &entry.CreatedAt, &entry.UpdatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *priceBookRepository) GetPriceBookByID(ctx context.Context, id uuid.UUID) (*PriceBook, error) {
+	book, err := scanPriceBook(r.db.QueryRowContext(ctx, "SELECT "+priceBookColumns+" FROM price_books WHERE id = $1", id))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+priceBookEntryColumns+" FROM price_book_entries WHERE price_book_id = $1 ORDER BY product_id, effective_from", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanPriceBookEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		book.Entries = append(book.Entries, *entry)
+	}
+	return book, rows.Err()
+}
+
+func (r *priceBookRepository) ListPriceBooks(ctx context.Context) ([]*PriceBook, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+priceBookColumns+" FROM price_books ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var books []*PriceBook
+	for rows.Next() {
+		book, err := scanPriceBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+func (r *priceBookRepository) CreatePriceBook(ctx context.Context, book PriceBook) (*PriceBook, error) {
+	if book.ID == uuid.Nil {
+		book.ID = uuid.New()
+	}
+	return scanPriceBook(r.db.QueryRowContext(ctx, "INSERT INTO price_books (id, name, description, customer_id, pricing_tier, is_active) VALUES ($1, $2, $3, $4, $5, $6) RETURNING "+priceBookColumns, book.ID, book.Name, book.Description, book.CustomerID, book.PricingTier, book.IsActive))
+}
+
+func (r *priceBookRepository) UpdatePriceBook(ctx context.Context, book PriceBook) (*PriceBook, error) {
+	return scanPriceBook(r.db.QueryRowContext(ctx, "UPDATE price_books SET name = $1, description = $2, customer_id = $3, pricing_tier = $4, is_active = $5, updated_at = CURRENT_TIMESTAMP WHERE id = $6 RETURNING "+priceBookColumns, book.Name, book.Description, book.CustomerID, book.PricingTier, book.IsActive, book.ID))
+}
+
+func (r *priceBookRepository) DeletePriceBook(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM price_books WHERE id = $1", id)
+	return err
+}
+
+func (r *priceBookRepository) AddPriceBookEntry(ctx context.Context, entry PriceBookEntry) (*PriceBookEntry, error) {
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	return scanPriceBookEntry(r.db.QueryRowContext(ctx, "INSERT INTO price_book_entries (id, price_book_id, product_id, price, effective_from, effective_to) VALUES ($1, $2, $3, $4, $5, $6) RETURNING "+priceBookEntryColumns, entry.ID, entry.PriceBookID, entry.ProductID, entry.Price, entry.EffectiveFrom, entry.EffectiveTo))
+}
+
+func (r *priceBookRepository) DeletePriceBookEntry(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM price_book_entries WHERE id = $1", id)
+	return err
+}
+
+func (r *priceBookRepository) GetEffectivePrices(ctx context.Context, productID uuid.UUID, on time.Time) ([]EffectivePrice, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT e.id, e.price_book_id, e.product_id, e.price, e.effective_from, e.effective_to, e.created_at, e.updated_at, b.customer_id, b.pricing_tier
+		FROM price_book_entries e
+		JOIN price_books b ON b.id = e.price_book_id
+		WHERE e.product_id = $1 AND b.is_active AND e.effective_from <= $2 AND (e.effective_to IS NULL OR e.effective_to > $2)`, productID, on)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []EffectivePrice
+	for rows.Next() {
+		var price EffectivePrice
+		entry, err := scanPriceBookEntry(rows, &price.CustomerID, &price.PricingTier)
+		if err != nil {
+			return nil, err
+		}
+		price.PriceBookEntry = *entry
+		prices = append(prices, price)
+	}
+	return prices, rows.Err()
+}
+
+type orderRepository struct {
+	db *sql.DB
+}
+
+func NewOrderRepository(db *sql.DB) OrderRepository {
+	return &orderRepository{db: db}
+}
+
+const orderNumberSequence = "order"
+
+// nextSequenceValue increments a named counter in document_sequences within
+// tx. The row lock serialises concurrent callers and a rolled back
+// transaction releases its number, so issued numbers never have gaps.
+func nextSequenceValue(ctx context.Context, tx *sql.Tx, name string) (int64, error) {
+	var value int64
+	err := tx.QueryRowContext(ctx, "UPDATE document_sequences SET last_value = last_value + 1 WHERE name = $1 RETURNING last_value", name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("document sequence %q is not configured", name)
+	}
+	return value, err
+}
+
+func formatDocumentNumber(prefix string, value int64) string {
+	return fmt.Sprintf("%s-%06d", prefix, value)
+}
+
+const orderColumns = "id, order_number, customer_id, status, currency, subtotal, discount, tax_amount, total, amount_paid, order_date, shipped_date, delivered_date, billing_address_id, shipping_address_id, quote_id, notes, metadata, created_at, updated_at"
+
+const orderItemColumns = "id, order_id, product_id, description, quantity, unit_price, discount, discounts, tax_amount, total, created_at, updated_at, (SELECT o.currency FROM orders o WHERE o.id = order_id)"
+
+const paymentColumns = "id, customer_id, order_id, payment_method, amount, currency, payment_status, payment_date, refunded_amount, disputed_amount, charged_back_amount, transaction_id, processor_reference, processed_at, processor_data, created_at, updated_at"
+
+func scanOrder(row rowScanner) (*Order, error) {
+	var order Order
+	var metadata []byte
+	err := row.Scan(&order.ID, &order.OrderNumber, &order.CustomerID, &order.Status, &order.Currency, &order.SubTotal, &order.Discount, &order.TaxAmount, &order.Total, &order.AmountPaid, &order.OrderDate, &order.ShippedDate, &order.DeliveredDate, &order.BillingAddressID, &order.ShippingAddressID, &order.QuoteID, &order.Notes, &metadata, &order.CreatedAt, &order.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := rereadAmounts(order.Currency, &order.SubTotal, &order.Discount, &order.TaxAmount, &order.Total, &order.AmountPaid); err != nil {
+		return nil, err
+	}
+	if err := unmarshalMetadata(metadata, &order.Metadata); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func scanOrderItem(row rowScanner) (*OrderItem, error) {
+	var item OrderItem
+	var discounts []byte
+	var currency core.Currency
+	err := row.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.Description, &item.Quantity, &item.UnitPrice, &item.Discount, &discounts, &item.TaxAmount, &item.Total, &item.CreatedAt, &item.UpdatedAt, &currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := rereadAmounts(currency, &item.UnitPrice, &item.Discount, &item.TaxAmount, &item.Total); err != nil {
+		return nil, err
+	}
+	if len(discounts) > 0 {
+		if err := json.Unmarshal(discounts, &item.Discounts); err != nil {
+			return nil, err
+		}
+	}
+	return &item, nil
+}
+
+func scanPayment(row rowScanner) (*Payment, error) {
+	var payment Payment
+	var processorData []byte
+	err := row.Scan(&payment.ID, &payment.CustomerID, &payment.OrderID, &payment.Method, &payment.Amount, &payment.Currency, &payment.Status, &payment.PaymentDate, &payment.RefundedAmount, &payment.DisputedAmount, &payment.ChargedBackAmount, &payment.TransactionID, &payment.ProcessorReference, &payment.ProcessedAt, &processorData, &payment.CreatedAt, &payment.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := rereadAmounts(payment.Currency, &payment.Amount, &payment.RefundedAmount, &payment.DisputedAmount, &payment.ChargedBackAmount); err != nil {
+		return nil, err
+	}
+	if len(processorData) > 0 {
+		payment.ProcessorData = json.RawMessage(processorData)
+	}
+	return &payment, nil
+}
+
+func marshalMetadata(metadata map[string]interface{}) ([]byte, error) {
+	if metadata == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(metadata)
+}
+
+func unmarshalMetadata(data []byte, metadata *map[string]interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, metadata)
+}
+
+func (r *orderRepository) GetOrderByID(ctx context.Context, id uuid.UUID) (*Order, error) {
+	order, err := scanOrder(r.db.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders WHERE id = $1", id))
+	if err != nil {
+		return nil, err
+	}
+
+	itemRows, err := r.db.QueryContext(ctx, "SELECT "+orderItemColumns+" FROM order_items WHERE order_id = $1 ORDER BY created_at, id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+	for itemRows.Next() {
+		item, err := scanOrderItem(itemRows)
+		if err != nil {
+			return nil, err
+		}
+		order.OrderItems = append(order.OrderItems, *item)
+	}
+	if err := itemRows.Err(); err != nil {
+		return nil, err
+	}
+
+	paymentRows, err := r.db.QueryContext(ctx, "SELECT "+paymentColumns+" FROM payments WHERE order_id = $1 ORDER BY created_at, id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer paymentRows.Close()
+	for paymentRows.Next() {
+		payment, err := scanPayment(paymentRows)
+		if err != nil {
+			return nil, err
+		}
+		order.Payments = append(order.Payments, *payment)
+	}
+	if err := paymentRows.Err(); err != nil {
+		return nil, err
+	}
+	if order.CouponCodes, err = getOrderCouponCodes(ctx, r.db, id); err != nil {
+		return nil, err
+	}
+	if order.CreditOverride, err = getCreditOverride(ctx, r.db, id); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (r *orderRepository) GetOrdersByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Order, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+orderColumns+" FROM orders WHERE customer_id = $1 ORDER BY order_date DESC", customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []*Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+func (r *orderRepository) CreateOrder(ctx context.Context, order Order) (*Order, error) {
+	if order.ID == uuid.Nil {
+		order.ID = uuid.New()
+	}
+	metadata, err := marshalMetadata(order.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	number, err := nextSequenceValue(ctx, tx, orderNumberSequence)
+	if err != nil {
+		return nil, err
+	}
+	order.OrderNumber = formatDocumentNumber("ORD", number)
+
+	created, err := scanOrder(tx.QueryRowContext(ctx, "INSERT INTO orders (id, order_number, customer_id, status, currency, subtotal, discount, tax_amount, total, order_date, shipped_date, delivered_date, billing_address_id, shipping_address_id, quote_id, notes, metadata) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17) RETURNING "+orderColumns,
+		order.ID, order.OrderNumber, order.CustomerID, order.Status, order.Currency, order.SubTotal, order.Discount, order.TaxAmount, order.Total, order.OrderDate, order.ShippedDate, order.DeliveredDate, order.BillingAddressID, order.ShippingAddressID, order.QuoteID, order.Notes, metadata))
+	if err != nil {
+		return nil, err
+	}
+	if created.OrderItems, err = insertOrderItems(ctx, tx, created.ID, order.OrderItems); err != nil {
+		return nil, err
+	}
+	for _, code := range order.CouponCodes {
+		if err := redeemCoupon(ctx, tx, created.ID, code); err != nil {
+			return nil, err
+		}
+	}
+	created.CouponCodes = order.CouponCodes
+	if order.CreditOverride != nil {
+		if created.CreditOverride, err = insertCreditOverride(ctx, tx, created.ID, *order.CreditOverride); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdateOrder rewrites a pending order and its lines, returning
+// ErrOrderLocked when the order has moved on or would owe less than it has
+// been paid. The checks are part of the update so an edit racing a confirm
+// cannot swap the lines of an order whose stock is already reserved, nor one
+// racing a payment leave it overpaid.
+func (r *orderRepository) UpdateOrder(ctx context.Context, order Order) (*Order, error) {
+	metadata, err := marshalMetadata(order.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	updated, err := scanOrder(tx.QueryRowContext(ctx, "UPDATE orders SET currency = $1, subtotal = $2, discount = $3, tax_amount = $4, total = $5, order_date = $6, billing_address_id = $7, shipping_address_id = $8, notes = $9, metadata = $10, updated_at = CURRENT_TIMESTAMP WHERE id = $11 AND status = $12 AND (amount_paid = 0 OR (currency = $1 AND amount_paid <= $5)) RETURNING "+orderColumns,
+		order.Currency, order.SubTotal, order.Discount, order.TaxAmount, order.Total, order.OrderDate, order.BillingAddressID, order.ShippingAddressID, order.Notes, metadata, order.ID, OrderStatusPending))
+	if errors.Is(err, ErrOrderNotFound) {
+		return nil, r.orderLockedOrMissing(ctx, order.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM order_items WHERE order_id = $1", order.ID); err != nil {
+		return nil, err
+	}
+	if updated.OrderItems, err = insertOrderItems(ctx, tx, updated.ID, order.OrderItems); err != nil {
+		return nil, err
+	}
+	if order.CreditOverride != nil {
+		if updated.CreditOverride, err = insertCreditOverride(ctx, tx, updated.ID, *order.CreditOverride); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (r *orderRepository) UpdateOrderStatus(ctx context.Context, order Order, from OrderStatus) (*Order, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	updated, err := scanOrder(tx.QueryRowContext(ctx, "UPDATE orders SET status = $1, shipped_date = $2, delivered_date = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $4 AND status = $5 RETURNING "+orderColumns,
+		order.Status, order.ShippedDate, order.DeliveredDate, order.ID, from))
+	if errors.Is(err, ErrOrderNotFound) {
+		return nil, ErrOrderStatusConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	if updated.StockMovements, err = moveOrderStock(ctx, tx, order); err != nil {
+		return nil, err
+	}
+	if err := refreshCustomerStats(ctx, tx, updated.CustomerID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteOrder deletes the order only while it is pending, returning
+// ErrOrderLocked otherwise. Checking the status in the delete itself means an
+// order confirmed concurrently, and so holding stock reservations, is never
+// deleted.
+func (r *orderRepository) DeleteOrder(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM orders WHERE id = $1 AND status = $2", id, OrderStatusPending)
+	if err != nil {
+		return err
+	}
+	if count, err := result.RowsAffected(); err != nil {
+		return err
+	} else if count > 0 {
+		return nil
+	}
+	if err := r.orderLockedOrMissing(ctx, id); !errors.Is(err, ErrOrderNotFound) {
+		return err
+	}
+	return nil
+}
+
+// orderLockedOrMissing explains why a pending-only write matched no row:
+// ErrOrderLocked when the order exists but has moved on, ErrOrderNotFound
+// when it is gone.
+func (r *orderRepository) orderLockedOrMissing(ctx context.Context, id uuid.UUID) error {
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM orders WHERE id = $1)", id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrOrderLocked
+	}
+	return ErrOrderNotFound
+}
+
+func insertOrderItems(ctx context.Context, tx *sql.Tx, orderID uuid.UUID, items []OrderItem) ([]OrderItem, error) {
+	inserted := make([]OrderItem, 0, len(items))
+	for _, item := range items {
+		if item.ID == uuid.Nil {
+			item.ID = uuid.New()
+		}
+		discounts, err := json.Marshal(item.Discounts)
+		if err != nil {
+			return nil, err
+		}
+		created, err := scanOrderItem(tx.QueryRowContext(ctx, "INSERT INTO order_items (id, order_id, product_id, description, quantity, unit_price, discount, discounts, tax_amount, total) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING "+orderItemColumns,
+			item.ID, orderID, item.ProductID, item.Description, item.Quantity, item.UnitPrice, item.Discount, discounts, item.TaxAmount, item.Total))
+		if err != nil {
+			return nil, err
+		}
+		inserted = append(inserted, *created)
+	}
+	return inserted, nil
+}
@@ -0,0 +1,99 @@
+package billing
+
+import (
+	"errors"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrQuoteNotFound       = errors.New("quote not found")
+	ErrInvalidQuote        = errors.New("invalid quote")
+	ErrQuoteNotDraft       = errors.New("quote can only be changed while in draft")
+	ErrQuoteNotSent        = errors.New("quote is not awaiting a response")
+	ErrQuoteExpired        = errors.New("quote is past its validity date")
+	ErrQuoteSuperseded     = errors.New("quote has been replaced by a newer version")
+	ErrQuoteNotRevisable   = errors.New("quote cannot be revised in its current status")
+	ErrQuoteStatusConflict = errors.New("quote status was changed by another request")
+)
+
+// Quote is a fee proposal sent to a customer before an engagement. Revising
+// a quote that has left draft creates a new version under the same
+// QuoteNumber; only the latest version can be sent or accepted.
+type Quote struct {
+	core.BaseModel
+
+	QuoteNumber   string      `json:"quote_number"` // Assigned on creation and shared by every version
+	Version       int         `json:"version"`      // 1 for the original quote
+	CustomerID    uuid.UUID   `json:"customer_id"`
+	OpportunityID *uuid.UUID  `json:"opportunity_id"` // Closed when the quote is accepted
+	Status        QuoteStatus `json:"status"`
+	ValidUntil    time.Time   `json:"valid_until"` // Last day the quote can be accepted
+
+	// Financial Information, computed by the quote service
+	Currency  core.Currency `json:"currency"`
+	SubTotal  core.Money    `json:"subtotal"`
+	Discount  core.Money    `json:"discount"`
+	TaxAmount core.Money    `json:"tax_amount"`
+	Total     core.Money    `json:"total"`
+
+	// Dates
+	SentAt       *time.Time `json:"sent_at"`
+	AcceptedAt   *time.Time `json:"accepted_at"`
+	DeclinedAt   *time.Time `json:"declined_at"`
+	SupersededAt *time.Time `json:"superseded_at"` // Set when a newer version is created
+
+	// Addresses, copied to the order on acceptance
+	BillingAddressID  *uuid.UUID `json:"billing_address_id"`
+	ShippingAddressID *uuid.UUID `json:"shipping_address_id"`
+
+	Notes string `json:"notes"`
+
+	// The order created when the quote was accepted, maintained by the
+	// repository
+	OrderID *uuid.UUID `json:"order_id"`
+
+	// Relationships
+	Items []QuoteItem `json:"items"`
+}
+
+type QuoteItem struct {
+	core.BaseModel
+	QuoteID     uuid.UUID         `json:"quote_id"`
+	ProductID   uuid.UUID         `json:"product_id"`
+	Description string            `json:"description"`
+	Quantity    int               `json:"quantity"`
+	UnitPrice   core.Money        `json:"unit_price"` // Priced like an order line and honoured on acceptance
+	Discount    core.Money        `json:"discount"`
+	Discounts   []AppliedDiscount `json:"discounts"`
+	TaxAmount   core.Money        `json:"tax_amount"`
+	Total       core.Money        `json:"total"` // UnitPrice × Quantity - Discount
+}
+
+type QuoteStatus string
+
+const (
+	QuoteStatusDraft    QuoteStatus = "draft"
+	QuoteStatusSent     QuoteStatus = "sent"
+	QuoteStatusAccepted QuoteStatus = "accepted"
+	QuoteStatusDeclined QuoteStatus = "declined"
+	QuoteStatusExpired  QuoteStatus = "expired"
+)
+
+// defaultQuoteValidityDays is how long a quote stays open when no
+// ValidUntil is given.
+const defaultQuoteValidityDays = 30
+
+// IsLatest reports whether no newer version of the quote exists.
+func (q Quote) IsLatest() bool {
+	return q.SupersededAt == nil
+}
+
+// ExpiredOn reports whether the quote's validity ended before the calendar
+// day of t.
+func (q Quote) ExpiredOn(t time.Time) bool {
+	return dateOnly(t).After(dateOnly(q.ValidUntil))
+}
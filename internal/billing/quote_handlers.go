@@ -0,0 +1,202 @@
+package billing
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type quoteHandler struct {
+	service QuoteService
+}
+
+type quoteActionHandler struct {
+	service QuoteWorkflow
+}
+
+type quotePDFHandler struct {
+	service QuotePDFRenderer
+}
+
+// NewQuoteHandler serves quotes: GET by ?id=, every quote of ?customer_id=
+// or every version of ?quote_number=, POST to create a draft, PUT to edit a
+// draft and DELETE ?id= to discard one.
+func NewQuoteHandler(service QuoteService) http.Handler {
+	return &quoteHandler{service: service}
+}
+
+// NewQuoteActionHandler runs the workflow action in a {"action": "..."} body
+// against the quote given by ?id=: "send", "accept", "decline" or "revise".
+// Revising answers 201 with the new draft version.
+func NewQuoteActionHandler(service QuoteWorkflow) http.Handler {
+	return &quoteActionHandler{service: service}
+}
+
+// NewQuotePDFHandler serves GET /quotes/{id}.pdf. Like the invoice PDF
+// handler, register it as "GET /quotes/{file}".
+func NewQuotePDFHandler(service QuotePDFRenderer) http.Handler {
+	return &quotePDFHandler{service: service}
+}
+
+func (h *quoteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getQuote(w, r)
+	case http.MethodPost:
+		h.createQuote(w, r)
+	case http.MethodPut:
+		h.updateQuote(w, r)
+	case http.MethodDelete:
+		h.deleteQuote(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *quoteActionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.performAction(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *quotePDFHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	file, ok := strings.CutSuffix(r.PathValue("file"), ".pdf")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	quoteID, err := uuid.Parse(file)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	document, err := h.service.RenderQuote(r.Context(), quoteID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writePDF(w, document)
+}
+
+func (h *quoteHandler) getQuote(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch {
+	case query.Has("customer_id"):
+		customerID, ok := queryUUID(w, r, "customer_id")
+		if !ok {
+			return
+		}
+		quotes, err := h.service.GetQuotesByCustomerID(r.Context(), customerID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(quotes)
+	case query.Has("quote_number"):
+		quotes, err := h.service.GetQuoteVersions(r.Context(), query.Get("quote_number"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(quotes)
+	default:
+		quoteID, ok := queryUUID(w, r, "id")
+		if !ok {
+			return
+		}
+		quote, err := h.service.GetQuoteByID(r.Context(), quoteID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(quote)
+	}
+}
+
+func (h *quoteHandler) createQuote(w http.ResponseWriter, r *http.Request) {
+	var quote Quote
+	if err := json.NewDecoder(r.Body).Decode(&quote); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	created, err := h.service.CreateQuote(r.Context(), quote)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *quoteHandler) updateQuote(w http.ResponseWriter, r *http.Request) {
+	var quote Quote
+	if err := json.NewDecoder(r.Body).Decode(&quote); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updated, err := h.service.UpdateQuote(r.Context(), quote)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *quoteHandler) deleteQuote(w http.ResponseWriter, r *http.Request) {
+	quoteID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteQuote(r.Context(), quoteID); err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Quote deleted successfully"})
+}
+
+func (h *quoteActionHandler) performAction(w http.ResponseWriter, r *http.Request) {
+	quoteID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	var body struct {
+		Action string `json:"action"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var quote *Quote
+	var err error
+	status := http.StatusOK
+	switch body.Action {
+	case "send":
+		quote, err = h.service.SendQuote(r.Context(), quoteID)
+	case "accept":
+		quote, err = h.service.AcceptQuote(r.Context(), quoteID)
+	case "decline":
+		quote, err = h.service.DeclineQuote(r.Context(), quoteID)
+	case "revise":
+		quote, err = h.service.ReviseQuote(r.Context(), quoteID)
+		status = http.StatusCreated
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(quote)
+}
@@ -0,0 +1,270 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+type quoteRepository struct {
+	db *sql.DB
+}
+
+func NewQuoteRepository(db *sql.DB) QuoteRepository {
+	return &quoteRepository{db: db}
+}
+
+const quoteNumberSequence = "quote"
+
+// quoteColumns reads the order created on acceptance from orders.quote_id,
+// whose unique constraint allows one order per quote.
+const quoteColumns = "q.id, q.quote_number, q.version, q.customer_id, q.opportunity_id, q.status, q.valid_until, q.currency, q.subtotal, q.discount, q.tax_amount, q.total, q.sent_at, q.accepted_at, q.declined_at, q.superseded_at, q.billing_address_id, q.shipping_address_id, q.notes, (SELECT o.id FROM orders o WHERE o.quote_id = q.id), q.created_at, q.updated_at"
+
+const quoteItemColumns = "id, quote_id, product_id, description, quantity, unit_price, discount, discounts, tax_amount, total, created_at, updated_at, (SELECT q.currency FROM quotes q WHERE q.id = quote_id)"
+
+func scanQuote(row rowScanner) (*Quote, error) {
+	var quote Quote
+	err := row.Scan(&quote.ID, &quote.QuoteNumber, &quote.Version, &quote.CustomerID, &quote.OpportunityID, &quote.Status, &quote.ValidUntil, &quote.Currency, &quote.SubTotal, &quote.Discount, &quote.TaxAmount, &quote.Total, &quote.SentAt, &quote.AcceptedAt, &quote.DeclinedAt, &quote.SupersededAt, &quote.BillingAddressID, &quote.ShippingAddressID, &quote.Notes, &quote.OrderID, &quote.CreatedAt, &quote.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrQuoteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := rereadAmounts(quote.Currency, &quote.SubTotal, &quote.Discount, &quote.TaxAmount, &quote.Total); err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+func scanQuoteItem(row rowScanner) (*QuoteItem, error) {
+	var item QuoteItem
+	var discounts []byte
+	var currency core.Currency
+	err := row.Scan(&item.ID, &item.QuoteID, &item.ProductID, &item.Description, &item.Quantity, &item.UnitPrice, &item.Discount, &discounts, &item.TaxAmount, &item.Total, &item.CreatedAt, &item.UpdatedAt, &currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := rereadAmounts(currency, &item.UnitPrice, &item.Discount, &item.TaxAmount, &item.Total); err != nil {
+		return nil, err
+	}
+	if len(discounts) > 0 {
+		if err := json.Unmarshal(discounts, &item.Discounts); err != nil {
+			return nil, err
+		}
+	}
+	return &item, nil
+}
+
+func (r *quoteRepository) GetQuoteByID(ctx context.Context, id uuid.UUID) (*Quote, error) {
+	quote, err := scanQuote(r.db.QueryRowContext(ctx, "SELECT "+quoteColumns+" FROM quotes q WHERE q.id = $1", id))
+	if err != nil {
+		return nil, err
+	}
+	if quote.Items, err = r.queryQuoteItems(ctx, id); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+func (r *quoteRepository) GetQuotesByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Quote, error) {
+	return r.queryQuotes(ctx, "SELECT "+quoteColumns+" FROM quotes q WHERE q.customer_id = $1 ORDER BY q.created_at DESC", customerID)
+}
+
+func (r *quoteRepository) GetQuoteVersions(ctx context.Context, quoteNumber string) ([]*Quote, error) {
+	return r.queryQuotes(ctx, "SELECT "+quoteColumns+" FROM quotes q WHERE q.quote_number = $1 ORDER BY q.version", quoteNumber)
+}
+
+func (r *quoteRepository) CreateQuote(ctx context.Context, quote Quote) (*Quote, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	number, err := nextSequenceValue(ctx, tx, quoteNumberSequence)
+	if err != nil {
+		return nil, err
+	}
+	quote.QuoteNumber = formatDocumentNumber("QUO", number)
+	quote.Version = 1
+
+	created, err := insertQuote(ctx, tx, quote)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (r *quoteRepository) UpdateQuote(ctx context.Context, quote Quote) (*Quote, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	updated, err := scanQuote(tx.QueryRowContext(ctx, "UPDATE quotes q SET opportunity_id = $1, valid_until = $2, currency = $3, subtotal = $4, discount = $5, tax_amount = $6, total = $7, billing_address_id = $8, shipping_address_id = $9, notes = $10, updated_at = CURRENT_TIMESTAMP WHERE q.id = $11 AND q.status = $12 RETURNING "+quoteColumns,
+		quote.OpportunityID, quote.ValidUntil, quote.Currency, quote.SubTotal, quote.Discount, quote.TaxAmount, quote.Total, quote.BillingAddressID, quote.ShippingAddressID, quote.Notes, quote.ID, QuoteStatusDraft))
+	if errors.Is(err, ErrQuoteNotFound) {
+		return nil, ErrQuoteNotDraft
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM quote_items WHERE quote_id = $1", quote.ID); err != nil {
+		return nil, err
+	}
+	if updated.Items, err = insertQuoteItems(ctx, tx, updated.ID, quote.Items); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (r *quoteRepository) DeleteQuote(ctx context.Context, id uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var number string
+	var version int
+	err = tx.QueryRowContext(ctx, "DELETE FROM quotes WHERE id = $1 AND status = $2 RETURNING quote_number, version", id, QuoteStatusDraft).Scan(&number, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrQuoteNotDraft
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE quotes SET superseded_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE quote_number = $1 AND version = $2", number, version-1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *quoteRepository) CreateQuoteRevision(ctx context.Context, revision Quote, previous Quote) (*Quote, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, "UPDATE quotes SET superseded_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = $2 AND superseded_at IS NULL RETURNING quote_number, version + 1",
+		previous.ID, previous.Status).Scan(&revision.QuoteNumber, &revision.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrQuoteStatusConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	created, err := insertQuote(ctx, tx, revision)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (r *quoteRepository) UpdateQuoteStatus(ctx context.Context, quote Quote, from QuoteStatus) (*Quote, error) {
+	updated, err := scanQuote(r.db.QueryRowContext(ctx, "UPDATE quotes q SET status = $1, sent_at = $2, accepted_at = $3, declined_at = $4, updated_at = CURRENT_TIMESTAMP WHERE q.id = $5 AND q.status = $6 AND q.superseded_at IS NULL RETURNING "+quoteColumns,
+		quote.Status, quote.SentAt, quote.AcceptedAt, quote.DeclinedAt, quote.ID, from))
+	if errors.Is(err, ErrQuoteNotFound) {
+		return nil, ErrQuoteStatusConflict
+	}
+	return updated, err
+}
+
+func (r *quoteRepository) ExpireSentQuotes(ctx context.Context, before time.Time) (int, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE quotes SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE status = $2 AND valid_until < $3",
+		QuoteStatusExpired, QuoteStatusSent, before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (r *quoteRepository) queryQuotes(ctx context.Context, query string, args ...any) ([]*Quote, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var quotes []*Quote
+	for rows.Next() {
+		quote, err := scanQuote(rows)
+		if err != nil {
+			return nil, err
+		}
+		quotes = append(quotes, quote)
+	}
+	return quotes, rows.Err()
+}
+
+func (r *quoteRepository) queryQuoteItems(ctx context.Context, quoteID uuid.UUID) ([]QuoteItem, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+quoteItemColumns+" FROM quote_items WHERE quote_id = $1 ORDER BY created_at, id", quoteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []QuoteItem
+	for rows.Next() {
+		item, err := scanQuoteItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	return items, rows.Err()
+}
+
+func insertQuote(ctx context.Context, tx *sql.Tx, quote Quote) (*Quote, error) {
+	if quote.ID == uuid.Nil {
+		quote.ID = uuid.New()
+	}
+	created, err := scanQuote(tx.QueryRowContext(ctx, "INSERT INTO quotes AS q (id, quote_number, version, customer_id, opportunity_id, status, valid_until, currency, subtotal, discount, tax_amount, total, billing_address_id, shipping_address_id, notes) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING "+quoteColumns,
+		quote.ID, quote.QuoteNumber, quote.Version, quote.CustomerID, quote.OpportunityID, quote.Status, quote.ValidUntil, quote.Currency, quote.SubTotal, quote.Discount, quote.TaxAmount, quote.Total, quote.BillingAddressID, quote.ShippingAddressID, quote.Notes))
+	if err != nil {
+		return nil, err
+	}
+	if created.Items, err = insertQuoteItems(ctx, tx, created.ID, quote.Items); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func insertQuoteItems(ctx context.Context, tx *sql.Tx, quoteID uuid.UUID, items []QuoteItem) ([]QuoteItem, error) {
+	inserted := make([]QuoteItem, 0, len(items))
+	for _, item := range items {
+		if item.ID == uuid.Nil {
+			item.ID = uuid.New()
+		}
+		discounts, err := json.Marshal(item.Discounts)
+		if err != nil {
+			return nil, err
+		}
+		created, err := scanQuoteItem(tx.QueryRowContext(ctx, "INSERT INTO quote_items (id, quote_id, product_id, description, quantity, unit_price, discount, discounts, tax_amount, total) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING "+quoteItemColumns,
+			item.ID, quoteID, item.ProductID, item.Description, item.Quantity, item.UnitPrice, item.Discount, discounts, item.TaxAmount, item.Total))
+		if err != nil {
+			return nil, err
+		}
+		inserted = append(inserted, *created)
+	}
+	return inserted, nil
+}
@@ -0,0 +1,487 @@
+package billing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+)
+
+type QuoteService interface {
+	QuoteReader
+	QuoteWriter
+	QuoteWorkflow
+}
+
+type QuoteRepository interface {
+	QuoteReader
+	QuoteWriter
+	QuoteReviser
+	QuoteStatusUpdater
+	SentQuoteExpirer
+}
+
+type QuoteReader interface {
+	QuoteRetriever
+	QuoteLister
+	QuoteVersionLister
+}
+
+type QuoteWriter interface {
+	QuoteCreator
+	QuoteUpdater
+	QuoteDeleter
+}
+
+type QuoteRetriever interface {
+	GetQuoteByID(ctx context.Context, id uuid.UUID) (*Quote, error)
+}
+
+type QuoteLister interface {
+	GetQuotesByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Quote, error)
+}
+
+// QuoteVersionLister returns every version of a quote, oldest first.
+type QuoteVersionLister interface {
+	GetQuoteVersions(ctx context.Context, quoteNumber string) ([]*Quote, error)
+}
+
+// QuoteCreator assigns the next QuoteNumber and persists the quote and its
+// items in one transaction.
+type QuoteCreator interface {
+	CreateQuote(ctx context.Context, quote Quote) (*Quote, error)
+}
+
+// QuoteUpdater replaces a draft quote's header and items in one transaction,
+// returning ErrQuoteNotDraft if it has left draft.
+type QuoteUpdater interface {
+	UpdateQuote(ctx context.Context, quote Quote) (*Quote, error)
+}
+
+// QuoteDeleter deletes a draft quote. Deleting a draft revision makes the
+// version before it the latest again.
+type QuoteDeleter interface {
+	DeleteQuote(ctx context.Context, id uuid.UUID) error
+}
+
+type QuoteWorkflow interface {
+	SendQuote(ctx context.Context, id uuid.UUID) (*Quote, error)
+	AcceptQuote(ctx context.Context, id uuid.UUID) (*Quote, error)
+	DeclineQuote(ctx context.Context, id uuid.UUID) (*Quote, error)
+	ReviseQuote(ctx context.Context, id uuid.UUID) (*Quote, error)
+	ExpireQuotes(ctx context.Context, asOf time.Time) (int, error)
+}
+
+// QuoteReviser inserts revision as the next version of previous and marks
+// previous superseded in one transaction, but only while previous is still
+// the latest version in the status it was read in, returning
+// ErrQuoteStatusConflict otherwise.
+type QuoteReviser interface {
+	CreateQuoteRevision(ctx context.Context, revision Quote, previous Quote) (*Quote, error)
+}
+
+// QuoteStatusUpdater writes a new status and its dates, but only if the quote
+// is still the latest version and in status from, returning
+// ErrQuoteStatusConflict otherwise.
+type QuoteStatusUpdater interface {
+	UpdateQuoteStatus(ctx context.Context, quote Quote, from QuoteStatus) (*Quote, error)
+}
+
+// SentQuoteExpirer marks sent quotes valid until before the given date as
+// expired and returns how many there were.
+type SentQuoteExpirer interface {
+	ExpireSentQuotes(ctx context.Context, before time.Time) (int, error)
+}
+
+// OrderQuoter is what the quote service needs from the order service.
+type OrderQuoter interface {
+	PriceOrder(ctx context.Context, order Order) (*Order, error)
+	CreateQuotedOrder(ctx context.Context, order Order) (*Order, error)
+}
+
+// OpportunityCloser is what the quote service needs to close an accepted
+// quote's opportunity.
+type OpportunityCloser interface {
+	customers.OpportunityRetriever
+	customers.OpportunityUpdater
+}
+
+type quoteService struct {
+	repo          QuoteRepository
+	orders        OrderQuoter
+	opportunities OpportunityCloser
+	now           func() time.Time
+}
+
+func NewQuoteService(repo QuoteRepository, orders OrderQuoter, opportunities OpportunityCloser) QuoteService {
+	return &quoteService{repo: repo, orders: orders, opportunities: opportunities, now: time.Now}
+}
+
+func (s *quoteService) GetQuoteByID(ctx context.Context, id uuid.UUID) (*Quote, error) {
+	return s.repo.GetQuoteByID(ctx, id)
+}
+
+func (s *quoteService) GetQuotesByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Quote, error) {
+	return s.repo.GetQuotesByCustomerID(ctx, customerID)
+}
+
+func (s *quoteService) GetQuoteVersions(ctx context.Context, quoteNumber string) ([]*Quote, error) {
+	return s.repo.GetQuoteVersions(ctx, quoteNumber)
+}
+
+// CreateQuote creates version 1 of a draft quote. Lines are priced as an
+// order placed today would be, and the quote is valid for 30 days unless
+// ValidUntil says otherwise.
+func (s *quoteService) CreateQuote(ctx context.Context, quote Quote) (*Quote, error) {
+	quote.QuoteNumber, quote.Version = "", 1
+	quote.Status = QuoteStatusDraft
+	clearQuoteActivity(&quote)
+	if quote.ValidUntil.IsZero() {
+		quote.ValidUntil = dateOnly(s.now()).AddDate(0, 0, defaultQuoteValidityDays)
+	}
+	if err := s.checkOpportunity(ctx, quote); err != nil {
+		return nil, err
+	}
+	if err := s.priceQuote(ctx, &quote); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateQuote(ctx, quote)
+}
+
+func (s *quoteService) UpdateQuote(ctx context.Context, quote Quote) (*Quote, error) {
+	existing, err := s.repo.GetQuoteByID(ctx, quote.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Status != QuoteStatusDraft {
+		return nil, ErrQuoteNotDraft
+	}
+	quote.QuoteNumber, quote.Version = existing.QuoteNumber, existing.Version
+	quote.CustomerID = existing.CustomerID
+	quote.Status = existing.Status
+	clearQuoteActivity(&quote)
+	if quote.ValidUntil.IsZero() {
+		quote.ValidUntil = existing.ValidUntil
+	}
+	if err := s.checkOpportunity(ctx, quote); err != nil {
+		return nil, err
+	}
+	if err := s.priceQuote(ctx, &quote); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateQuote(ctx, quote)
+}
+
+func (s *quoteService) DeleteQuote(ctx context.Context, id uuid.UUID) error {
+	existing, err := s.repo.GetQuoteByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if existing.Status != QuoteStatusDraft {
+		return ErrQuoteNotDraft
+	}
+	return s.repo.DeleteQuote(ctx, id)
+}
+
+// SendQuote marks a draft quote as sent to the customer.
+func (s *quoteService) SendQuote(ctx context.Context, id uuid.UUID) (*Quote, error) {
+	quote, err := s.repo.GetQuoteByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if quote.Status != QuoteStatusDraft {
+		return nil, ErrQuoteNotDraft
+	}
+	if len(quote.Items) == 0 {
+		return nil, fmt.Errorf("%w: at least one item is required", ErrInvalidQuote)
+	}
+	now := s.now()
+	if quote.ExpiredOn(now) {
+		return nil, fmt.Errorf("%w: move valid_until before sending", ErrQuoteExpired)
+	}
+	quote.Status = QuoteStatusSent
+	quote.SentAt = &now
+	return s.updateStatus(ctx, *quote, QuoteStatusDraft)
+}
+
+// AcceptQuote records the customer's acceptance of the latest version of a
+// sent quote, creates a pending order at the quoted prices and closes the
+// quote's opportunity. A quote past its validity is marked expired instead.
+func (s *quoteService) AcceptQuote(ctx context.Context, id uuid.UUID) (*Quote, error) {
+	quote, err := s.awaitingResponse(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if quote.ExpiredOn(now) {
+		quote.Status = QuoteStatusExpired
+		if _, err := s.updateStatus(ctx, *quote, QuoteStatusSent); err != nil {
+			return nil, err
+		}
+		return nil, ErrQuoteExpired
+	}
+
+	// Claiming the quote before creating the order means two acceptances
+	// racing each other cannot both create one.
+	quote.Status = QuoteStatusAccepted
+	quote.AcceptedAt = &now
+	accepted, err := s.updateStatus(ctx, *quote, QuoteStatusSent)
+	if err != nil {
+		return nil, err
+	}
+	order, err := s.orders.CreateQuotedOrder(ctx, quotedOrder(*accepted, now))
+	if err != nil {
+		accepted.Status, accepted.AcceptedAt = QuoteStatusSent, nil
+		if _, revertErr := s.repo.UpdateQuoteStatus(ctx, *accepted, QuoteStatusAccepted); revertErr != nil {
+			slog.ErrorContext(ctx, "failed to reopen quote after order creation failed", "quote_id", accepted.ID, "error", revertErr)
+		}
+		return nil, err
+	}
+	accepted.OrderID = &order.ID
+
+	// The acceptance is already committed, so failing to close the
+	// opportunity is logged rather than reported to the caller.
+	if accepted.OpportunityID != nil {
+		if err := s.closeOpportunity(ctx, *accepted.OpportunityID, now); err != nil {
+			slog.ErrorContext(ctx, "failed to close opportunity for accepted quote", "quote_id", accepted.ID, "opportunity_id", *accepted.OpportunityID, "error", err)
+		}
+	}
+	return accepted, nil
+}
+
+// DeclineQuote records that the customer turned the quote down. A declined
+// quote can still be revised.
+func (s *quoteService) DeclineQuote(ctx context.Context, id uuid.UUID) (*Quote, error) {
+	quote, err := s.awaitingResponse(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	quote.Status = QuoteStatusDeclined
+	quote.DeclinedAt = &now
+	return s.updateStatus(ctx, *quote, QuoteStatusSent)
+}
+
+// ReviseQuote starts a new draft version of a sent, declined or expired
+// quote with the same lines repriced as of today. The old version stays on
+// record but can no longer be accepted.
+func (s *quoteService) ReviseQuote(ctx context.Context, id uuid.UUID) (*Quote, error) {
+	previous, err := s.repo.GetQuoteByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !previous.IsLatest() {
+		return nil, ErrQuoteSuperseded
+	}
+	switch previous.Status {
+	case QuoteStatusDraft:
+		return nil, fmt.Errorf("%w: edit the draft instead", ErrQuoteNotRevisable)
+	case QuoteStatusAccepted:
+		return nil, fmt.Errorf("%w: quote has been accepted", ErrQuoteNotRevisable)
+	}
+
+	revision := Quote{
+		CustomerID:        previous.CustomerID,
+		OpportunityID:     previous.OpportunityID,
+		Status:            QuoteStatusDraft,
+		ValidUntil:        previous.ValidUntil,
+		BillingAddressID:  previous.BillingAddressID,
+		ShippingAddressID: previous.ShippingAddressID,
+		Notes:             previous.Notes,
+	}
+	if revision.ExpiredOn(s.now()) {
+		revision.ValidUntil = dateOnly(s.now()).AddDate(0, 0, defaultQuoteValidityDays)
+	}
+	for _, item := range previous.Items {
+		revision.Items = append(revision.Items, QuoteItem{ProductID: item.ProductID, Description: item.Description, Quantity: item.Quantity})
+	}
+	if err := s.priceQuote(ctx, &revision); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateQuoteRevision(ctx, revision, *previous)
+}
+
+// ExpireQuotes marks every sent quote whose validity ended before the day of
+// asOf as expired. It is meant to run daily; AcceptQuote also expires quotes
+// it finds out of date.
+func (s *quoteService) ExpireQuotes(ctx context.Context, asOf time.Time) (int, error) {
+	return s.repo.ExpireSentQuotes(ctx, dateOnly(asOf))
+}
+
+// awaitingResponse loads a quote the customer can still accept or decline.
+func (s *quoteService) awaitingResponse(ctx context.Context, id uuid.UUID) (*Quote, error) {
+	quote, err := s.repo.GetQuoteByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !quote.IsLatest() {
+		return nil, ErrQuoteSuperseded
+	}
+	if quote.Status != QuoteStatusSent {
+		return nil, fmt.Errorf("%w: quote is %s", ErrQuoteNotSent, quote.Status)
+	}
+	return quote, nil
+}
+
+func (s *quoteService) updateStatus(ctx context.Context, quote Quote, from QuoteStatus) (*Quote, error) {
+	updated, err := s.repo.UpdateQuoteStatus(ctx, quote, from)
+	if err != nil {
+		return nil, err
+	}
+	updated.Items = quote.Items
+	return updated, nil
+}
+
+// checkOpportunity makes sure a quote's opportunity belongs to its customer.
+func (s *quoteService) checkOpportunity(ctx context.Context, quote Quote) error {
+	if quote.OpportunityID == nil {
+		return nil
+	}
+	opportunity, err := s.opportunities.GetOpportunityByID(ctx, *quote.OpportunityID)
+	if err != nil {
+		return fmt.Errorf("failed to load opportunity: %w", err)
+	}
+	if opportunity.CustomerID != quote.CustomerID {
+		return fmt.Errorf("%w: opportunity belongs to another customer", ErrInvalidQuote)
+	}
+	return nil
+}
+
+func (s *quoteService) closeOpportunity(ctx context.Context, id uuid.UUID, at time.Time) error {
+	opportunity, err := s.opportunities.GetOpportunityByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if opportunity.Stage == customers.StageClosed {
+		return nil
+	}
+	opportunity.Stage = customers.StageClosed
+	opportunity.ActualCloseDate = at
+	_, err = s.opportunities.UpdateOpportunity(ctx, *opportunity)
+	return err
+}
+
+// priceQuote prices the quote's lines through the order service so a quote
+// costs exactly what the same order would, then rolls up the totals.
+func (s *quoteService) priceQuote(ctx context.Context, quote *Quote) error {
+	if quote.CustomerID == uuid.Nil {
+		return fmt.Errorf("%w: customer is required", ErrInvalidQuote)
+	}
+	if len(quote.Items) == 0 {
+		return fmt.Errorf("%w: at least one item is required", ErrInvalidQuote)
+	}
+	quote.ValidUntil = dateOnly(quote.ValidUntil)
+	if quote.ExpiredOn(s.now()) {
+		return fmt.Errorf("%w: valid_until is in the past", ErrInvalidQuote)
+	}
+
+	draft := Order{
+		CustomerID:        quote.CustomerID,
+		OrderDate:         s.now(),
+		BillingAddressID:  quote.BillingAddressID,
+		ShippingAddressID: quote.ShippingAddressID,
+	}
+	for i, item := range quote.Items {
+		if item.Quantity <= 0 {
+			return fmt.Errorf("%w: item %d quantity must be positive", ErrInvalidQuote, i+1)
+		}
+		draft.OrderItems = append(draft.OrderItems, OrderItem{ProductID: item.ProductID, Description: item.Description, Quantity: item.Quantity})
+	}
+	priced, err := s.orders.PriceOrder(ctx, draft)
+	if err != nil {
+		return err
+	}
+	for i, line := range priced.OrderItems {
+		item := &quote.Items[i]
+		item.Description = line.Description
+		item.UnitPrice, item.Discount, item.Discounts = line.UnitPrice, line.Discount, line.Discounts
+		item.TaxAmount, item.Total = line.TaxAmount, line.Total
+	}
+	quote.Currency, quote.SubTotal, quote.Discount, quote.TaxAmount, quote.Total = priced.Currency, priced.SubTotal, priced.Discount, priced.TaxAmount, priced.Total
+	return nil
+}
+
+// quotedOrder is the order an accepted quote turns into.
+func quotedOrder(quote Quote, at time.Time) Order {
+	order := Order{
+		CustomerID:        quote.CustomerID,
+		QuoteID:           &quote.ID,
+		OrderDate:         at,
+		BillingAddressID:  quote.BillingAddressID,
+		ShippingAddressID: quote.ShippingAddressID,
+		Notes:             fmt.Sprintf("Quote %s version %d", quote.QuoteNumber, quote.Version),
+	}
+	for _, item := range quote.Items {
+		order.OrderItems = append(order.OrderItems, OrderItem{
+			ProductID:   item.ProductID,
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Discount:    item.Discount,
+			Discounts:   item.Discounts,
+			TaxAmount:   item.TaxAmount,
+		})
+	}
+	return order
+}
+
+// clearQuoteActivity resets the fields only the service and repository may
+// set.
+func clearQuoteActivity(quote *Quote) {
+	quote.SentAt, quote.AcceptedAt, quote.DeclinedAt, quote.SupersededAt = nil, nil, nil, nil
+	quote.OrderID = nil
+}
+
+// PriceOrder prices an order the way CreateOrder would without saving it.
+// Automatic discounts apply; coupons do not.
+func (s *orderService) PriceOrder(ctx context.Context, order Order) (*Order, error) {
+	order.CouponCodes = nil
+	if order.OrderDate.IsZero() {
+		order.OrderDate = s.now()
+	}
+	if err := s.priceOrder(ctx, &order, false); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// CreateQuotedOrder creates a pending order for an accepted quote at the
+// quoted unit prices, discounts and tax rather than today's. The credit
+// limit still applies.
+func (s *orderService) CreateQuotedOrder(ctx context.Context, order Order) (*Order, error) {
+	if order.QuoteID == nil {
+		return nil, fmt.Errorf("%w: quote is required", ErrInvalidOrder)
+	}
+	if order.CustomerID == uuid.Nil {
+		return nil, fmt.Errorf("%w: customer is required", ErrInvalidOrder)
+	}
+	if len(order.OrderItems) == 0 {
+		return nil, fmt.Errorf("%w: at least one item is required", ErrInvalidOrder)
+	}
+	order.OrderNumber = ""
+	order.Status = OrderStatusPending
+	order.ShippedDate, order.DeliveredDate = nil, nil
+	order.CouponCodes = nil
+	if order.OrderDate.IsZero() {
+		order.OrderDate = s.now()
+	}
+	for i, item := range order.OrderItems {
+		if item.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: item %d quantity must be positive", ErrInvalidOrder, i+1)
+		}
+	}
+	if err := computeLineTotals(&order); err != nil {
+		return nil, err
+	}
+	if err := computeOrderTotals(&order); err != nil {
+		return nil, err
+	}
+	if err := s.checkCredit(ctx, &order, nil); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateOrder(ctx, order)
+}
@@ -0,0 +1,547 @@
+package billing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockQuoteRepository struct {
+	mock.Mock
+}
+
+func (m *MockQuoteRepository) GetQuoteByID(ctx context.Context, id uuid.UUID) (*Quote, error) {
+	args := m.Called(ctx, id)
+	quote, _ := args.Get(0).(*Quote)
+	return quote, args.Error(1)
+}
+
+func (m *MockQuoteRepository) GetQuotesByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Quote, error) {
+	args := m.Called(ctx, customerID)
+	quotes, _ := args.Get(0).([]*Quote)
+	return quotes, args.Error(1)
+}
+
+func (m *MockQuoteRepository) GetQuoteVersions(ctx context.Context, quoteNumber string) ([]*Quote, error) {
+	args := m.Called(ctx, quoteNumber)
+	quotes, _ := args.Get(0).([]*Quote)
+	return quotes, args.Error(1)
+}
+
+func (m *MockQuoteRepository) CreateQuote(ctx context.Context, quote Quote) (*Quote, error) {
+	args := m.Called(ctx, quote)
+	created, _ := args.Get(0).(*Quote)
+	return created, args.Error(1)
+}
+
+func (m *MockQuoteRepository) UpdateQuote(ctx context.Context, quote Quote) (*Quote, error) {
+	args := m.Called(ctx, quote)
+	updated, _ := args.Get(0).(*Quote)
+	return updated, args.Error(1)
+}
+
+func (m *MockQuoteRepository) DeleteQuote(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockQuoteRepository) CreateQuoteRevision(ctx context.Context, revision Quote, previous Quote) (*Quote, error) {
+	args := m.Called(ctx, revision, previous)
+	created, _ := args.Get(0).(*Quote)
+	return created, args.Error(1)
+}
+
+func (m *MockQuoteRepository) UpdateQuoteStatus(ctx context.Context, quote Quote, from QuoteStatus) (*Quote, error) {
+	args := m.Called(ctx, quote, from)
+	updated, _ := args.Get(0).(*Quote)
+	return updated, args.Error(1)
+}
+
+func (m *MockQuoteRepository) ExpireSentQuotes(ctx context.Context, before time.Time) (int, error) {
+	args := m.Called(ctx, before)
+	return args.Int(0), args.Error(1)
+}
+
+type MockOrderQuoter struct {
+	mock.Mock
+}
+
+func (m *MockOrderQuoter) PriceOrder(ctx context.Context, order Order) (*Order, error) {
+	args := m.Called(ctx, order)
+	priced, _ := args.Get(0).(*Order)
+	return priced, args.Error(1)
+}
+
+func (m *MockOrderQuoter) CreateQuotedOrder(ctx context.Context, order Order) (*Order, error) {
+	args := m.Called(ctx, order)
+	created, _ := args.Get(0).(*Order)
+	return created, args.Error(1)
+}
+
+type MockOpportunityCloser struct {
+	mock.Mock
+}
+
+func (m *MockOpportunityCloser) GetOpportunityByID(ctx context.Context, id uuid.UUID) (*customers.Opportunity, error) {
+	args := m.Called(ctx, id)
+	opportunity, _ := args.Get(0).(*customers.Opportunity)
+	return opportunity, args.Error(1)
+}
+
+func (m *MockOpportunityCloser) UpdateOpportunity(ctx context.Context, opportunity customers.Opportunity) (*customers.Opportunity, error) {
+	args := m.Called(ctx, opportunity)
+	updated, _ := args.Get(0).(*customers.Opportunity)
+	return updated, args.Error(1)
+}
+
+// MockOpportunityRepository backs a real opportunity service so tests can
+// follow a won opportunity from quote acceptance to its event.
+type MockOpportunityRepository struct {
+	MockOpportunityCloser
+}
+
+func (m *MockOpportunityRepository) GetOpportunitiesByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*customers.Opportunity, error) {
+	args := m.Called(ctx, customerID)
+	opportunities, _ := args.Get(0).([]*customers.Opportunity)
+	return opportunities, args.Error(1)
+}
+
+func (m *MockOpportunityRepository) CreateOpportunity(ctx context.Context, opportunity customers.Opportunity) (*customers.Opportunity, error) {
+	args := m.Called(ctx, opportunity)
+	created, _ := args.Get(0).(*customers.Opportunity)
+	return created, args.Error(1)
+}
+
+func (m *MockOpportunityRepository) DeleteOpportunity(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+type QuoteServiceTestSuite struct {
+	suite.Suite
+	repo          *MockQuoteRepository
+	orders        *MockOrderQuoter
+	opportunities *MockOpportunityCloser
+	now           time.Time
+	service       QuoteService
+}
+
+func (s *QuoteServiceTestSuite) SetupTest() {
+	s.repo = new(MockQuoteRepository)
+	s.orders = new(MockOrderQuoter)
+	s.opportunities = new(MockOpportunityCloser)
+	s.now = time.Date(2026, 6, 10, 15, 0, 0, 0, time.UTC)
+	s.service = NewQuoteService(s.repo, s.orders, s.opportunities)
+	s.service.(*quoteService).now = func() time.Time { return s.now }
+}
+
+func (s *QuoteServiceTestSuite) TearDownTest() {
+	s.repo.AssertExpectations(s.T())
+	s.orders.AssertExpectations(s.T())
+	s.opportunities.AssertExpectations(s.T())
+}
+
+func TestQuoteServiceSuite(t *testing.T) {
+	suite.Run(t, new(QuoteServiceTestSuite))
+}
+
+// sentQuote is version 2 of a quote awaiting the customer's answer.
+func (s *QuoteServiceTestSuite) sentQuote(opportunityID *uuid.UUID) *Quote {
+	sentAt := s.now.AddDate(0, 0, -3)
+	quote := &Quote{
+		QuoteNumber:   "QUO-000007",
+		Version:       2,
+		CustomerID:    uuid.New(),
+		OpportunityID: opportunityID,
+		Status:        QuoteStatusSent,
+		ValidUntil:    *date(2026, 6, 30),
+		SentAt:        &sentAt,
+		SubTotal:      usd("1500.00"),
+		Discount:      usd("150.00"),
+		TaxAmount:     usd("135.00"),
+		Total:         usd("1485.00"),
+		Items: []QuoteItem{{
+			ProductID:   uuid.New(),
+			Description: "Due diligence review",
+			Quantity:    1,
+			UnitPrice:   usd("1500.00"),
+			Discount:    usd("150.00"),
+			TaxAmount:   usd("135.00"),
+			Total:       usd("1350.00"),
+		}},
+	}
+	quote.ID = uuid.New()
+	return quote
+}
+
+func (s *QuoteServiceTestSuite) TestCreateQuote_PricesLikeAnOrderAndDefaultsValidity() {
+	// Arrange
+	ctx := context.Background()
+	customerID, opportunityID, productID := uuid.New(), uuid.New(), uuid.New()
+	input := Quote{
+		QuoteNumber:   "QUO-999999", // ignored
+		Status:        QuoteStatusAccepted,
+		CustomerID:    customerID,
+		OpportunityID: &opportunityID,
+		Items:         []QuoteItem{{ProductID: productID, Quantity: 2, UnitPrice: usd("0.01")}},
+	}
+
+	s.opportunities.On("GetOpportunityByID", ctx, opportunityID).Return(&customers.Opportunity{CustomerID: customerID}, nil)
+	s.orders.On("PriceOrder", ctx, Order{
+		CustomerID: customerID,
+		OrderDate:  s.now,
+		OrderItems: []OrderItem{{ProductID: productID, Quantity: 2}},
+	}).Return(&Order{
+		SubTotal:  usd("800.00"),
+		Discount:  usd("80.00"),
+		TaxAmount: usd("72.00"),
+		Total:     usd("792.00"),
+		OrderItems: []OrderItem{{
+			ProductID:   productID,
+			Description: "Entity formation",
+			Quantity:    2,
+			UnitPrice:   usd("400.00"),
+			Discount:    usd("80.00"),
+			TaxAmount:   usd("72.00"),
+			Total:       usd("720.00"),
+		}},
+	}, nil)
+	var saved Quote
+	s.repo.On("CreateQuote", ctx, mock.AnythingOfType("Quote")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Quote)
+	}).Return(&Quote{QuoteNumber: "QUO-000001"}, nil)
+
+	// Act
+	_, err := s.service.CreateQuote(ctx, input)
+
+	// Assert
+	s.NoError(err)
+	s.Empty(saved.QuoteNumber)
+	s.Equal(1, saved.Version)
+	s.Equal(QuoteStatusDraft, saved.Status)
+	s.Equal(*date(2026, 7, 10), saved.ValidUntil)
+	s.Equal("Entity formation", saved.Items[0].Description)
+	s.Equal(usd("400.00"), saved.Items[0].UnitPrice)
+	s.Equal(usd("720.00"), saved.Items[0].Total)
+	s.Equal(usd("792.00"), saved.Total)
+}
+
+func (s *QuoteServiceTestSuite) TestCreateQuote_RejectsOpportunityOfAnotherCustomer() {
+	// Arrange
+	ctx := context.Background()
+	opportunityID := uuid.New()
+	input := Quote{
+		CustomerID:    uuid.New(),
+		OpportunityID: &opportunityID,
+		Items:         []QuoteItem{{ProductID: uuid.New(), Quantity: 1}},
+	}
+
+	s.opportunities.On("GetOpportunityByID", ctx, opportunityID).Return(&customers.Opportunity{CustomerID: uuid.New()}, nil)
+
+	// Act
+	_, err := s.service.CreateQuote(ctx, input)
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidQuote)
+}
+
+func (s *QuoteServiceTestSuite) TestAcceptQuote_CreatesOrderAtQuotedPricesAndClosesOpportunity() {
+	// Arrange
+	ctx := context.Background()
+	opportunityID, orderID := uuid.New(), uuid.New()
+	quote := s.sentQuote(&opportunityID)
+	opportunity := &customers.Opportunity{CustomerID: quote.CustomerID, Name: "Acquisition review", Stage: customers.StageNegotiation}
+	opportunity.ID = opportunityID
+
+	s.repo.On("GetQuoteByID", ctx, quote.ID).Return(quote, nil)
+	s.repo.On("UpdateQuoteStatus", ctx, mock.MatchedBy(func(q Quote) bool {
+		return q.Status == QuoteStatusAccepted && q.AcceptedAt.Equal(s.now)
+	}), QuoteStatusSent).Return(func() *Quote {
+		accepted := *quote
+		accepted.Status, accepted.AcceptedAt = QuoteStatusAccepted, &s.now
+		return &accepted
+	}(), nil)
+	var ordered Order
+	s.orders.On("CreateQuotedOrder", ctx, mock.AnythingOfType("Order")).Run(func(args mock.Arguments) {
+		ordered = args.Get(1).(Order)
+	}).Return(func() *Order {
+		order := &Order{OrderNumber: "ORD-000040"}
+		order.ID = orderID
+		return order
+	}(), nil)
+	s.opportunities.On("GetOpportunityByID", ctx, opportunityID).Return(opportunity, nil)
+	s.opportunities.On("UpdateOpportunity", ctx, mock.MatchedBy(func(o customers.Opportunity) bool {
+		return o.ID == opportunityID && o.Stage == customers.StageClosed && o.ActualCloseDate.Equal(s.now)
+	})).Return(opportunity, nil)
+
+	// Act
+	result, err := s.service.AcceptQuote(ctx, quote.ID)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(QuoteStatusAccepted, result.Status)
+	s.Equal(&orderID, result.OrderID)
+	s.Equal(&quote.ID, ordered.QuoteID)
+	s.Equal(quote.CustomerID, ordered.CustomerID)
+	s.Equal("Quote QUO-000007 version 2", ordered.Notes)
+	s.Equal(usd("1500.00"), ordered.OrderItems[0].UnitPrice)
+	s.Equal(usd("150.00"), ordered.OrderItems[0].Discount)
+	s.Equal(usd("135.00"), ordered.OrderItems[0].TaxAmount)
+}
+
+func (s *QuoteServiceTestSuite) TestAcceptQuote_PublishesWonOpportunityWithItsProducts() {
+	// Arrange
+	ctx := context.Background()
+	opportunityID := uuid.New()
+	quote := s.sentQuote(&opportunityID)
+	stored := &customers.Opportunity{
+		CustomerID: quote.CustomerID,
+		Name:       "Acquisition review",
+		Stage:      customers.StageNegotiation,
+		Products:   []customers.OpportunityProduct{customers.OpportunityProductDueDiligence},
+	}
+	stored.ID = opportunityID
+	closed := *stored
+	closed.Stage, closed.ActualCloseDate = customers.StageClosed, s.now
+
+	repo := new(MockOpportunityRepository)
+	for range 2 { // closing the opportunity and checking it was open each load a copy
+		loaded := *stored
+		repo.On("GetOpportunityByID", ctx, opportunityID).Return(&loaded, nil).Once()
+	}
+	repo.On("UpdateOpportunity", ctx, closed).Return(&closed, nil)
+	bus := core.NewEventBus()
+	var won []customers.OpportunityWon
+	bus.Subscribe(customers.OpportunityWonEvent, func(_ context.Context, event core.Event) error {
+		won = append(won, event.(customers.OpportunityWon))
+		return nil
+	})
+	service := NewQuoteService(s.repo, s.orders, customers.NewOpportunityService(repo, customers.WithOpportunityEvents(bus)))
+	service.(*quoteService).now = func() time.Time { return s.now }
+
+	s.repo.On("GetQuoteByID", ctx, quote.ID).Return(quote, nil)
+	s.repo.On("UpdateQuoteStatus", ctx, mock.AnythingOfType("Quote"), QuoteStatusSent).Return(func() *Quote {
+		accepted := *quote
+		accepted.Status, accepted.AcceptedAt = QuoteStatusAccepted, &s.now
+		return &accepted
+	}(), nil)
+	s.orders.On("CreateQuotedOrder", ctx, mock.AnythingOfType("Order")).Return(&Order{OrderNumber: "ORD-000041"}, nil)
+
+	// Act
+	_, err := service.AcceptQuote(ctx, quote.ID)
+
+	// Assert
+	s.Require().NoError(err)
+	s.Require().Len(won, 1)
+	s.Equal([]customers.OpportunityProduct{customers.OpportunityProductDueDiligence}, won[0].Opportunity.Products)
+	repo.AssertExpectations(s.T())
+}
+
+func (s *QuoteServiceTestSuite) TestAcceptQuote_ReopensQuoteWhenOrderIsRefused() {
+	// Arrange
+	ctx := context.Background()
+	quote := s.sentQuote(nil)
+	accepted := *quote
+	accepted.Status, accepted.AcceptedAt = QuoteStatusAccepted, &s.now
+
+	s.repo.On("GetQuoteByID", ctx, quote.ID).Return(quote, nil)
+	s.repo.On("UpdateQuoteStatus", ctx, mock.MatchedBy(func(q Quote) bool { return q.Status == QuoteStatusAccepted }), QuoteStatusSent).Return(&accepted, nil)
+	s.orders.On("CreateQuotedOrder", ctx, mock.AnythingOfType("Order")).Return(nil, ErrCreditLimitExceeded)
+	s.repo.On("UpdateQuoteStatus", ctx, mock.MatchedBy(func(q Quote) bool {
+		return q.Status == QuoteStatusSent && q.AcceptedAt == nil
+	}), QuoteStatusAccepted).Return(quote, nil)
+
+	// Act
+	_, err := s.service.AcceptQuote(ctx, quote.ID)
+
+	// Assert
+	s.ErrorIs(err, ErrCreditLimitExceeded)
+}
+
+func (s *QuoteServiceTestSuite) TestAcceptQuote_ExpiresQuotePastValidity() {
+	// Arrange
+	ctx := context.Background()
+	quote := s.sentQuote(nil)
+	quote.ValidUntil = *date(2026, 6, 9)
+
+	s.repo.On("GetQuoteByID", ctx, quote.ID).Return(quote, nil)
+	s.repo.On("UpdateQuoteStatus", ctx, mock.MatchedBy(func(q Quote) bool { return q.Status == QuoteStatusExpired }), QuoteStatusSent).Return(quote, nil)
+
+	// Act
+	_, err := s.service.AcceptQuote(ctx, quote.ID)
+
+	// Assert
+	s.ErrorIs(err, ErrQuoteExpired)
+}
+
+func (s *QuoteServiceTestSuite) TestAcceptQuote_AcceptsOnLastValidDay() {
+	// Arrange
+	ctx := context.Background()
+	quote := s.sentQuote(nil)
+	quote.ValidUntil = *date(2026, 6, 10)
+
+	s.repo.On("GetQuoteByID", ctx, quote.ID).Return(quote, nil)
+	s.repo.On("UpdateQuoteStatus", ctx, mock.MatchedBy(func(q Quote) bool { return q.Status == QuoteStatusAccepted }), QuoteStatusSent).Return(quote, nil)
+	s.orders.On("CreateQuotedOrder", ctx, mock.AnythingOfType("Order")).Return(&Order{}, nil)
+
+	// Act
+	_, err := s.service.AcceptQuote(ctx, quote.ID)
+
+	// Assert
+	s.NoError(err)
+}
+
+func (s *QuoteServiceTestSuite) TestAcceptQuote_RejectsSupersededVersion() {
+	// Arrange
+	ctx := context.Background()
+	quote := s.sentQuote(nil)
+	quote.SupersededAt = &s.now
+
+	s.repo.On("GetQuoteByID", ctx, quote.ID).Return(quote, nil)
+
+	// Act
+	_, err := s.service.AcceptQuote(ctx, quote.ID)
+
+	// Assert
+	s.ErrorIs(err, ErrQuoteSuperseded)
+}
+
+func (s *QuoteServiceTestSuite) TestReviseQuote_StartsNextVersionRepriced() {
+	// Arrange
+	ctx := context.Background()
+	previous := s.sentQuote(nil)
+	previous.Status = QuoteStatusDeclined
+	previous.ValidUntil = *date(2026, 6, 1)
+	productID := previous.Items[0].ProductID
+
+	s.repo.On("GetQuoteByID", ctx, previous.ID).Return(previous, nil)
+	s.orders.On("PriceOrder", ctx, mock.AnythingOfType("Order")).Return(&Order{
+		Total:      usd("1200.00"),
+		OrderItems: []OrderItem{{ProductID: productID, Description: "Due diligence review", Quantity: 1, UnitPrice: usd("1200.00"), Total: usd("1200.00")}},
+	}, nil)
+	var revision Quote
+	s.repo.On("CreateQuoteRevision", ctx, mock.AnythingOfType("Quote"), *previous).Run(func(args mock.Arguments) {
+		revision = args.Get(1).(Quote)
+	}).Return(&Quote{QuoteNumber: previous.QuoteNumber, Version: 3}, nil)
+
+	// Act
+	result, err := s.service.ReviseQuote(ctx, previous.ID)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(3, result.Version)
+	s.Equal(QuoteStatusDraft, revision.Status)
+	s.Equal(previous.CustomerID, revision.CustomerID)
+	s.Equal(*date(2026, 7, 10), revision.ValidUntil)
+	s.Equal(usd("1200.00"), revision.Items[0].UnitPrice)
+	s.Equal(usd("1200.00"), revision.Total)
+}
+
+func (s *QuoteServiceTestSuite) TestReviseQuote_RejectsDraftAndAcceptedQuotes() {
+	for _, status := range []QuoteStatus{QuoteStatusDraft, QuoteStatusAccepted} {
+		s.Run(string(status), func() {
+			// Arrange
+			ctx := context.Background()
+			quote := s.sentQuote(nil)
+			quote.Status = status
+			s.repo.On("GetQuoteByID", ctx, quote.ID).Return(quote, nil)
+
+			// Act
+			_, err := s.service.ReviseQuote(ctx, quote.ID)
+
+			// Assert
+			s.ErrorIs(err, ErrQuoteNotRevisable)
+		})
+	}
+}
+
+func (s *QuoteServiceTestSuite) TestSendQuote_RejectsQuoteAlreadyOutOfDate() {
+	// Arrange
+	ctx := context.Background()
+	quote := s.sentQuote(nil)
+	quote.Status, quote.SentAt = QuoteStatusDraft, nil
+	quote.ValidUntil = *date(2026, 6, 9)
+
+	s.repo.On("GetQuoteByID", ctx, quote.ID).Return(quote, nil)
+
+	// Act
+	_, err := s.service.SendQuote(ctx, quote.ID)
+
+	// Assert
+	s.ErrorIs(err, ErrQuoteExpired)
+}
+
+func (s *OrderServiceTestSuite) TestCreateQuotedOrder_KeepsQuotedAmounts() {
+	// Arrange
+	ctx := context.Background()
+	quoteID, productID := uuid.New(), uuid.New()
+	input := Order{
+		CustomerID: uuid.New(),
+		QuoteID:    &quoteID,
+		OrderItems: []OrderItem{{
+			ProductID:   productID,
+			Description: "Due diligence review",
+			Quantity:    2,
+			UnitPrice:   usd("750.00"),
+			Discount:    usd("150.00"),
+			TaxAmount:   usd("135.00"),
+		}},
+	}
+
+	var saved Order
+	s.orderRepo.On("CreateOrder", ctx, mock.AnythingOfType("Order")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Order)
+	}).Return(&Order{OrderNumber: "ORD-000041"}, nil)
+
+	// Act
+	_, err := s.service.CreateQuotedOrder(ctx, input)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(OrderStatusPending, saved.Status)
+	s.Equal(s.now, saved.OrderDate)
+	s.Equal(usd("1350.00"), saved.OrderItems[0].Total)
+	s.Equal(usd("1500.00"), saved.SubTotal)
+	s.Equal(usd("1485.00"), saved.Total)
+}
+
+func (s *OrderServiceTestSuite) TestCreateOrder_IgnoresClientQuoteID() {
+	// Arrange
+	ctx := context.Background()
+	customerID, productID, quoteID := uuid.New(), uuid.New(), uuid.New()
+	input := Order{CustomerID: customerID, QuoteID: &quoteID, OrderItems: []OrderItem{{ProductID: productID, Quantity: 1}}}
+
+	s.productRepo.On("GetProductByID", ctx, productID).Return(&Product{Name: "Consultation"}, nil)
+	s.prices.On("ResolvePrice", ctx, customerID, productID, s.now).Return(&ResolvedPrice{Price: usd("200.00")}, nil)
+	s.discounts.On("GetAutomaticDiscountRules", ctx, s.now).Return(nil, nil)
+	s.orderRepo.On("CreateOrder", ctx, mock.MatchedBy(func(o Order) bool { return o.QuoteID == nil })).Return(&Order{}, nil)
+
+	// Act
+	_, err := s.service.CreateOrder(ctx, input)
+
+	// Assert
+	s.NoError(err)
+}
+
+func TestQuote_ExpiredOnComparesCalendarDays(t *testing.T) {
+	quote := Quote{ValidUntil: time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)}
+	for _, tc := range []struct {
+		at      time.Time
+		expired bool
+	}{
+		{time.Date(2026, 6, 10, 23, 59, 0, 0, time.UTC), false},
+		{time.Date(2026, 6, 11, 0, 0, 0, 0, time.UTC), true},
+		{time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC), false},
+	} {
+		if got := quote.ExpiredOn(tc.at); got != tc.expired {
+			t.Errorf("ExpiredOn(%s) = %v, want %v", tc.at, got, tc.expired)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package billing
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"text/template"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidDunningPolicy = errors.New("invalid dunning policy")
+	ErrDunningNoticeExists  = errors.New("dunning notice has already been sent")
+)
+
+// AgingBucket groups open invoices by how many days past due they are.
+type AgingBucket string
+
+const (
+	AgingBucketCurrent AgingBucket = "current" // Not yet due
+	AgingBucket1To30   AgingBucket = "1_30"
+	AgingBucket31To60  AgingBucket = "31_60"
+	AgingBucket61To90  AgingBucket = "61_90"
+	AgingBucketOver90  AgingBucket = "over_90"
+)
+
+// AgingBuckets lists the buckets from newest to oldest.
+var AgingBuckets = []AgingBucket{AgingBucketCurrent, AgingBucket1To30, AgingBucket31To60, AgingBucket61To90, AgingBucketOver90}
+
+func agingBucketFor(daysOverdue int) AgingBucket {
+	switch {
+	case daysOverdue <= 0:
+		return AgingBucketCurrent
+	case daysOverdue <= 30:
+		return AgingBucket1To30
+	case daysOverdue <= 60:
+		return AgingBucket31To60
+	case daysOverdue <= 90:
+		return AgingBucket61To90
+	}
+	return AgingBucketOver90
+}
+
+// AgingReport is what customers owed on open invoices as of a date, totalled
+// in the base currency.
+type AgingReport struct {
+	AsOf      time.Time       `json:"as_of"`
+	Customers []CustomerAging `json:"customers"`
+	Totals    AgingAmounts    `json:"totals"`
+}
+
+// CustomerAging is one customer's line of the report.
+type CustomerAging struct {
+	CustomerID   uuid.UUID     `json:"customer_id"`
+	CustomerName string        `json:"customer_name"`
+	Amounts      AgingAmounts  `json:"amounts"`
+	Invoices     []AgedInvoice `json:"invoices"`
+}
+
+type AgedInvoice struct {
+	InvoiceID     uuid.UUID   `json:"invoice_id"`
+	InvoiceNumber string      `json:"invoice_number"`
+	DueDate       time.Time   `json:"due_date"`
+	DaysOverdue   int         `json:"days_overdue"`
+	Bucket        AgingBucket `json:"bucket"`
+	Balance       core.Money  `json:"balance"`      // In the invoice's currency
+	BaseBalance   core.Money  `json:"base_balance"` // Balance in the base currency, as totalled by the report
+}
+
+// AgingAmounts holds a balance per bucket and their total.
+type AgingAmounts struct {
+	Current    core.Money `json:"current"`
+	Days1To30  core.Money `json:"1_30"`
+	Days31To60 core.Money `json:"31_60"`
+	Days61To90 core.Money `json:"61_90"`
+	Over90     core.Money `json:"over_90"`
+	Total      core.Money `json:"total"`
+}
+
+func (a *AgingAmounts) add(bucket AgingBucket, amount core.Money) error {
+	var target *core.Money
+	switch bucket {
+	case AgingBucketCurrent:
+		target = &a.Current
+	case AgingBucket1To30:
+		target = &a.Days1To30
+	case AgingBucket31To60:
+		target = &a.Days31To60
+	case AgingBucket61To90:
+		target = &a.Days61To90
+	default:
+		target = &a.Over90
+	}
+	var err error
+	if *target, err = target.Add(amount); err != nil {
+		return err
+	}
+	a.Total, err = a.Total.Add(amount)
+	return err
+}
+
+func (a AgingAmounts) inOrder() []core.Money {
+	return []core.Money{a.Current, a.Days1To30, a.Days31To60, a.Days61To90, a.Over90, a.Total}
+}
+
+// WriteAgingCSV writes one row per customer and a closing totals row.
+func WriteAgingCSV(w io.Writer, report AgingReport) error {
+	out := csv.NewWriter(w)
+	header := []string{"customer_id", "customer_name"}
+	for _, bucket := range AgingBuckets {
+		header = append(header, string(bucket))
+	}
+	if err := out.Write(append(header, "total")); err != nil {
+		return err
+	}
+	row := func(id, name string, amounts AgingAmounts) error {
+		record := []string{id, name}
+		for _, amount := range amounts.inOrder() {
+			record = append(record, amount.Decimal())
+		}
+		return out.Write(record)
+	}
+	for _, customer := range report.Customers {
+		if err := row(customer.CustomerID.String(), customer.CustomerName, customer.Amounts); err != nil {
+			return err
+		}
+	}
+	if err := row("", "Total", report.Totals); err != nil {
+		return err
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// DunningStage is one step of a dunning sequence: the email sent once an
+// invoice is DaysOverdue days past due. Subject and Body are text/template
+// sources executed with DunningEmailData.
+type DunningStage struct {
+	Name        string `json:"name"`
+	DaysOverdue int    `json:"days_overdue"`
+	Subject     string `json:"subject"`
+	Body        string `json:"body"`
+}
+
+// DunningPolicy is a dunning sequence, ordered by DaysOverdue.
+type DunningPolicy []DunningStage
+
+// DefaultDunningPolicy sends a reminder 3 days after the due date, a second
+// notice after 15 and a final notice after 30.
+func DefaultDunningPolicy() DunningPolicy {
+	return DunningPolicy{
+		{
+			Name:        "reminder",
+			DaysOverdue: 3,
+			Subject:     "Reminder: invoice {{.InvoiceNumber}} is past due",
+			Body: `Dear {{.CustomerName}},
+
+This is a friendly reminder that invoice {{.InvoiceNumber}} was due on {{.DueDate}}. The balance of {{.Balance}} is now {{.DaysOverdue}} days past due.
+
+If you have already sent payment, please disregard this message.
+`,
+		},
+		{
+			Name:        "second_notice",
+			DaysOverdue: 15,
+			Subject:     "Second notice: invoice {{.InvoiceNumber}} is {{.DaysOverdue}} days past due",
+			Body: `Dear {{.CustomerName}},
+
+We have not yet received payment of {{.Balance}} for invoice {{.InvoiceNumber}}, which was due on {{.DueDate}}.
+
+Please arrange payment at your earliest convenience, or contact us if there is a problem with the invoice.
+`,
+		},
+		{
+			Name:        "final_notice",
+			DaysOverdue: 30,
+			Subject:     "Final notice: invoice {{.InvoiceNumber}}",
+			Body: `Dear {{.CustomerName}},
+
+Invoice {{.InvoiceNumber}}, due on {{.DueDate}}, remains unpaid with a balance of {{.Balance}}.
+
+This is our final notice. Please pay the balance now to avoid interruption of service.
+`,
+		},
+	}
+}
+
+// Validate checks that stages have unique names, are in ascending order of
+// days overdue and that their templates parse.
+func (p DunningPolicy) Validate() error {
+	if len(p) == 0 {
+		return fmt.Errorf("%w: at least one stage is required", ErrInvalidDunningPolicy)
+	}
+	names := make(map[string]bool, len(p))
+	for i, stage := range p {
+		if stage.Name == "" {
+			return fmt.Errorf("%w: stage %d has no name", ErrInvalidDunningPolicy, i+1)
+		}
+		if names[stage.Name] {
+			return fmt.Errorf("%w: stage %q appears twice", ErrInvalidDunningPolicy, stage.Name)
+		}
+		names[stage.Name] = true
+		if stage.DaysOverdue <= 0 || (i > 0 && stage.DaysOverdue <= p[i-1].DaysOverdue) {
+			return fmt.Errorf("%w: stage %q must come after the previous one", ErrInvalidDunningPolicy, stage.Name)
+		}
+		if _, _, err := stage.render(DunningEmailData{}); err != nil {
+			return fmt.Errorf("%w: stage %q: %v", ErrInvalidDunningPolicy, stage.Name, err)
+		}
+	}
+	return nil
+}
+
+// stageFor returns the index of the latest stage due for an invoice
+// daysOverdue days past due, or -1 if none is.
+func (p DunningPolicy) stageFor(daysOverdue int) int {
+	return sort.Search(len(p), func(i int) bool { return p[i].DaysOverdue > daysOverdue }) - 1
+}
+
+func (p DunningPolicy) stageIndex(name string) int {
+	for i, stage := range p {
+		if stage.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// DunningEmailData is what dunning templates can refer to.
+type DunningEmailData struct {
+	CustomerName  string
+	InvoiceNumber string
+	DueDate       string // YYYY-MM-DD
+	DaysOverdue   int
+	Total         string // e.g. "USD 1234.50"
+	Balance       string
+}
+
+func (s DunningStage) render(data DunningEmailData) (subject, body string, err error) {
+	execute := func(name, source string) (string, error) {
+		tmpl, err := template.New(name).Parse(source)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	if subject, err = execute("subject", s.Subject); err != nil {
+		return "", "", err
+	}
+	if body, err = execute("body", s.Body); err != nil {
+		return "", "", err
+	}
+	return subject, body, nil
+}
+
+// DunningNotice records a dunning email sent for an invoice. An invoice gets
+// each stage at most once.
+type DunningNotice struct {
+	core.BaseModel
+	InvoiceID   uuid.UUID  `json:"invoice_id"`
+	CustomerID  uuid.UUID  `json:"customer_id"`
+	Stage       string     `json:"stage"`
+	DaysOverdue int        `json:"days_overdue"`
+	Balance     core.Money `json:"balance"`
+	Recipient   string     `json:"recipient"`
+	Subject     string     `json:"subject"`
+	Body        string     `json:"body"`
+	SentAt      time.Time  `json:"sent_at"`
+}
+
+// Email is an outgoing plain-text message.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
@@ -0,0 +1,98 @@
+package billing
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type agingReportHandler struct {
+	service AgingReporter
+}
+
+type dunningHandler struct {
+	service ReceivablesService
+}
+
+// NewAgingReportHandler serves GET with an optional ?date=YYYY-MM-DD,
+// today by default, and ?format=csv for a spreadsheet instead of JSON.
+func NewAgingReportHandler(service AgingReporter) http.Handler {
+	return &agingReportHandler{service: service}
+}
+
+// NewDunningHandler lists the notices sent for ?invoice_id= on GET, and on
+// POST sends the dunning emails due as of today or ?date=YYYY-MM-DD.
+func NewDunningHandler(service ReceivablesService) http.Handler {
+	return &dunningHandler{service: service}
+}
+
+func (h *agingReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	asOf, ok := queryDate(w, r, "date")
+	if !ok {
+		return
+	}
+	report, err := h.service.AgingReport(r.Context(), asOf)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		json.NewEncoder(w).Encode(report)
+	case "csv":
+		var buf bytes.Buffer
+		if err := WriteAgingCSV(&buf, *report); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="ar-aging-`+report.AsOf.Format(time.DateOnly)+`.csv"`)
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.Write(buf.Bytes())
+	default:
+		http.Error(w, "invalid format, expected json or csv", http.StatusBadRequest)
+	}
+}
+
+func (h *dunningHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getNotices(w, r)
+	case http.MethodPost:
+		h.runDunning(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *dunningHandler) getNotices(w http.ResponseWriter, r *http.Request) {
+	invoiceID, ok := queryUUID(w, r, "invoice_id")
+	if !ok {
+		return
+	}
+	notices, err := h.service.GetDunningNoticesByInvoiceID(r.Context(), invoiceID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(notices)
+}
+
+func (h *dunningHandler) runDunning(w http.ResponseWriter, r *http.Request) {
+	asOf, ok := queryDate(w, r, "date")
+	if !ok {
+		return
+	}
+	run, err := h.service.RunDunning(r.Context(), asOf)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(run)
+}
@@ -0,0 +1,71 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type receivablesRepository struct {
+	db *sql.DB
+}
+
+func NewReceivablesRepository(db *sql.DB) ReceivablesRepository {
+	return &receivablesRepository{db: db}
+}
+
+const dunningNoticeColumns = "id, invoice_id, customer_id, stage, days_overdue, balance, recipient, subject, body, sent_at, created_at, updated_at"
+
+func scanDunningNotice(row rowScanner) (*DunningNotice, error) {
+	var notice DunningNotice
+	err := row.Scan(&notice.ID, &notice.InvoiceID, &notice.CustomerID, &notice.Stage, &notice.DaysOverdue, &notice.Balance, &notice.Recipient, &notice.Subject, &notice.Body, &notice.SentAt, &notice.CreatedAt, &notice.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &notice, nil
+}
+
+func (r *receivablesRepository) GetOpenInvoices(ctx context.Context, asOf time.Time) ([]*Invoice, error) {
+	return queryInvoices(ctx, r.db, "SELECT "+invoiceColumns+" FROM invoices WHERE kind = $1 AND status IN ($2, $3) AND issue_date <= $4 ORDER BY customer_id, due_date, id",
+		InvoiceKindInvoice, InvoiceStatusSent, InvoiceStatusPartiallyPaid, asOf)
+}
+
+func (r *receivablesRepository) GetDunningNoticesByInvoiceID(ctx context.Context, invoiceID uuid.UUID) ([]*DunningNotice, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+dunningNoticeColumns+" FROM dunning_notices WHERE invoice_id = $1 ORDER BY sent_at, id", invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notices []*DunningNotice
+	for rows.Next() {
+		notice, err := scanDunningNotice(rows)
+		if err != nil {
+			return nil, err
+		}
+		notices = append(notices, notice)
+	}
+	return notices, rows.Err()
+}
+
+// CreateDunningNotice relies on the unique (invoice_id, stage) constraint:
+// when the row already exists nothing is returned.
+func (r *receivablesRepository) CreateDunningNotice(ctx context.Context, notice DunningNotice) (*DunningNotice, error) {
+	if notice.ID == uuid.Nil {
+		notice.ID = uuid.New()
+	}
+	created, err := scanDunningNotice(r.db.QueryRowContext(ctx, "INSERT INTO dunning_notices (id, invoice_id, customer_id, stage, days_overdue, balance, recipient, subject, body, sent_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) ON CONFLICT (invoice_id, stage) DO NOTHING RETURNING "+dunningNoticeColumns,
+		notice.ID, notice.InvoiceID, notice.CustomerID, notice.Stage, notice.DaysOverdue, notice.Balance, notice.Recipient, notice.Subject, notice.Body, notice.SentAt))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDunningNoticeExists
+	}
+	return created, err
+}
+
+func (r *receivablesRepository) DeleteDunningNotice(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM dunning_notices WHERE id = $1", id)
+	return err
+}
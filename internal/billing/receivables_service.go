@@ -0,0 +1,328 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"rva_crm/internal/activity"
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+)
+
+type ReceivablesService interface {
+	AgingReporter
+	DunningRunner
+	DunningNoticeReader
+}
+
+type ReceivablesRepository interface {
+	OpenInvoiceLister
+	DunningNoticeReader
+	DunningNoticeRecorder
+}
+
+type receivablesService struct {
+	repo       ReceivablesRepository
+	customers  customers.CustomerRetriever
+	mailer     Mailer
+	activities activity.ActivityCreator
+	policy     DunningPolicy
+	rates      CurrencyConverter
+	now        func() time.Time
+}
+
+type ReceivablesServiceOption func(*receivablesService)
+
+// WithDunningPolicy replaces DefaultDunningPolicy. The policy is validated
+// at the start of every dunning run.
+func WithDunningPolicy(policy DunningPolicy) ReceivablesServiceOption {
+	return func(s *receivablesService) {
+		s.policy = policy
+	}
+}
+
+// WithReportingConversion converts the balances of foreign-currency invoices
+// to the base currency for the aging report, at the rate of each invoice's
+// issue date. Without it, reporting such invoices fails with
+// ErrNoExchangeRate.
+func WithReportingConversion(rates CurrencyConverter) ReceivablesServiceOption {
+	return func(s *receivablesService) {
+		s.rates = rates
+	}
+}
+
+func NewReceivablesService(repo ReceivablesRepository, customers customers.CustomerRetriever, mailer Mailer, activities activity.ActivityCreator, opts ...ReceivablesServiceOption) ReceivablesService {
+	s := &receivablesService{
+		repo:       repo,
+		customers:  customers,
+		mailer:     mailer,
+		activities: activities,
+		policy:     DefaultDunningPolicy(),
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+type AgingReporter interface {
+	AgingReport(ctx context.Context, asOf time.Time) (*AgingReport, error)
+}
+
+// DunningRunner sends the dunning emails due as of a date. It is meant to run
+// daily and is safe to run more than once for the same date.
+type DunningRunner interface {
+	RunDunning(ctx context.Context, asOf time.Time) (*DunningRun, error)
+}
+
+type DunningNoticeReader interface {
+	GetDunningNoticesByInvoiceID(ctx context.Context, invoiceID uuid.UUID) ([]*DunningNotice, error)
+}
+
+// OpenInvoiceLister returns invoices, not credit notes, that are sent or
+// partially paid and were issued on or before asOf.
+type OpenInvoiceLister interface {
+	GetOpenInvoices(ctx context.Context, asOf time.Time) ([]*Invoice, error)
+}
+
+// DunningNoticeRecorder stores dunning notices. CreateDunningNotice returns
+// ErrDunningNoticeExists if the invoice already has a notice for the stage,
+// which is how concurrent runs avoid emailing twice.
+type DunningNoticeRecorder interface {
+	CreateDunningNotice(ctx context.Context, notice DunningNotice) (*DunningNotice, error)
+	DeleteDunningNotice(ctx context.Context, id uuid.UUID) error
+}
+
+// Mailer delivers email.
+type Mailer interface {
+	SendEmail(ctx context.Context, email Email) error
+}
+
+// DunningRun reports what one RunDunning call did. An invoice that fails
+// does not stop the others.
+type DunningRun struct {
+	AsOf     time.Time        `json:"as_of"`
+	Notices  []*DunningNotice `json:"notices"`
+	Failures []DunningFailure `json:"failures"`
+}
+
+type DunningFailure struct {
+	InvoiceID uuid.UUID `json:"invoice_id"`
+	Error     string    `json:"error"`
+}
+
+// AgingReport buckets each open invoice's balance by days past its due date
+// as of asOf. Balances are those stored now: a report for a past date does
+// not add back payments received since. Amounts are totalled in the base
+// currency, converting each invoice at the rate of its issue date.
+func (s *receivablesService) AgingReport(ctx context.Context, asOf time.Time) (*AgingReport, error) {
+	asOf = dateOnly(asOf)
+	invoices, err := s.repo.GetOpenInvoices(ctx, asOf)
+	if err != nil {
+		return nil, err
+	}
+	report := &AgingReport{AsOf: asOf}
+	byCustomer := make(map[uuid.UUID]*CustomerAging)
+	for _, invoice := range invoices {
+		balance, err := invoice.Balance()
+		if err != nil {
+			return nil, err
+		}
+		if !balance.IsPositive() || invoice.DueDate == nil {
+			continue
+		}
+		days := int(daysBetween(*invoice.DueDate, asOf))
+		bucket := agingBucketFor(days)
+		base, err := s.toBase(balance, invoice)
+		if err != nil {
+			return nil, err
+		}
+
+		customer, ok := byCustomer[invoice.CustomerID]
+		if !ok {
+			loaded, err := s.customers.GetCustomerByID(ctx, invoice.CustomerID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load customer: %w", err)
+			}
+			customer = &CustomerAging{CustomerID: invoice.CustomerID, CustomerName: customerDisplayName(loaded)}
+			byCustomer[invoice.CustomerID] = customer
+		}
+		customer.Invoices = append(customer.Invoices, AgedInvoice{
+			InvoiceID:     invoice.ID,
+			InvoiceNumber: invoice.InvoiceNumber,
+			DueDate:       *invoice.DueDate,
+			DaysOverdue:   max(days, 0),
+			Bucket:        bucket,
+			Balance:       balance,
+			BaseBalance:   base,
+		})
+		if err := customer.Amounts.add(bucket, base); err != nil {
+			return nil, err
+		}
+		if err := report.Totals.add(bucket, base); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, customer := range byCustomer {
+		sort.SliceStable(customer.Invoices, func(i, j int) bool {
+			return customer.Invoices[i].DueDate.Before(customer.Invoices[j].DueDate)
+		})
+		report.Customers = append(report.Customers, *customer)
+	}
+	sort.Slice(report.Customers, func(i, j int) bool {
+		a, b := report.Customers[i], report.Customers[j]
+		if a.CustomerName != b.CustomerName {
+			return a.CustomerName < b.CustomerName
+		}
+		return a.CustomerID.String() < b.CustomerID.String()
+	})
+	return report, nil
+}
+
+// toBase converts an amount owed on invoice to the base currency at the rate
+// of the invoice's issue date.
+func (s *receivablesService) toBase(amount core.Money, invoice *Invoice) (core.Money, error) {
+	if currencyOf(amount) == BaseCurrency {
+		return amount, nil
+	}
+	if s.rates == nil {
+		return core.Money{}, fmt.Errorf("%w: %s balances are not converted for reporting", ErrNoExchangeRate, currencyOf(amount))
+	}
+	issued := invoice.CreatedAt
+	if invoice.IssueDate != nil {
+		issued = *invoice.IssueDate
+	}
+	return toBase(s.rates, amount, issued)
+}
+
+// RunDunning emails each overdue invoice the latest stage it has reached,
+// unless it already got that stage or a later one. A run after missed days
+// therefore sends one notice, not every stage skipped. Paid invoices are no
+// longer open and drop out of the sequence.
+func (s *receivablesService) RunDunning(ctx context.Context, asOf time.Time) (*DunningRun, error) {
+	if err := s.policy.Validate(); err != nil {
+		return nil, err
+	}
+	asOf = dateOnly(asOf)
+	invoices, err := s.repo.GetOpenInvoices(ctx, asOf)
+	if err != nil {
+		return nil, err
+	}
+	run := &DunningRun{AsOf: asOf}
+	for _, invoice := range invoices {
+		notice, err := s.dunInvoice(ctx, invoice, asOf)
+		if notice != nil {
+			run.Notices = append(run.Notices, notice)
+		}
+		if err != nil {
+			run.Failures = append(run.Failures, DunningFailure{InvoiceID: invoice.ID, Error: err.Error()})
+		}
+	}
+	return run, nil
+}
+
+func (s *receivablesService) GetDunningNoticesByInvoiceID(ctx context.Context, invoiceID uuid.UUID) ([]*DunningNotice, error) {
+	return s.repo.GetDunningNoticesByInvoiceID(ctx, invoiceID)
+}
+
+// dunInvoice sends the invoice's due dunning notice, if any. The notice is
+// claimed before the email goes out and released if sending fails, so the
+// next run retries it.
+func (s *receivablesService) dunInvoice(ctx context.Context, invoice *Invoice, asOf time.Time) (*DunningNotice, error) {
+	if invoice.DueDate == nil {
+		return nil, nil
+	}
+	balance, err := invoice.Balance()
+	if err != nil {
+		return nil, err
+	}
+	if !balance.IsPositive() {
+		return nil, nil
+	}
+	days := int(daysBetween(*invoice.DueDate, asOf))
+	index := s.policy.stageFor(days)
+	if index < 0 {
+		return nil, nil
+	}
+	sent, err := s.repo.GetDunningNoticesByInvoiceID(ctx, invoice.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, notice := range sent {
+		if s.policy.stageIndex(notice.Stage) >= index {
+			return nil, nil
+		}
+	}
+
+	customer, err := s.customers.GetCustomerByID(ctx, invoice.CustomerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load customer: %w", err)
+	}
+	if customer.Email == "" {
+		return nil, errors.New("customer has no email address")
+	}
+	stage := s.policy[index]
+	subject, body, err := stage.render(DunningEmailData{
+		CustomerName:  customerDisplayName(customer),
+		InvoiceNumber: invoice.InvoiceNumber,
+		DueDate:       invoice.DueDate.Format(time.DateOnly),
+		DaysOverdue:   days,
+		Total:         invoice.Total.String(),
+		Balance:       balance.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notice, err := s.repo.CreateDunningNotice(ctx, DunningNotice{
+		InvoiceID:   invoice.ID,
+		CustomerID:  invoice.CustomerID,
+		Stage:       stage.Name,
+		DaysOverdue: days,
+		Balance:     balance,
+		Recipient:   customer.Email,
+		Subject:     subject,
+		Body:        body,
+		SentAt:      s.now(),
+	})
+	if errors.Is(err, ErrDunningNoticeExists) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mailer.SendEmail(ctx, Email{To: notice.Recipient, Subject: subject, Body: body}); err != nil {
+		if releaseErr := s.repo.DeleteDunningNotice(ctx, notice.ID); releaseErr != nil {
+			return nil, errors.Join(fmt.Errorf("failed to send email: %w", err), releaseErr)
+		}
+		return nil, fmt.Errorf("failed to send email: %w", err)
+	}
+
+	customerID := invoice.CustomerID
+	_, err = s.activities.CreateActivity(ctx, activity.Activity{
+		CustomerID:          &customerID,
+		ActivityType:        string(activity.ActivityTypeEmail),
+		ActivityDescription: subject,
+		ActivityDate:        notice.SentAt,
+		ActivityStatus:      string(activity.ActivityStatusCompleted),
+		ActivityCategory:    "dunning",
+		ActivityMetadata: map[string]interface{}{
+			"invoice_id":        invoice.ID,
+			"invoice_number":    invoice.InvoiceNumber,
+			"dunning_notice_id": notice.ID,
+			"stage":             stage.Name,
+			"recipient":         notice.Recipient,
+		},
+	})
+	if err != nil {
+		return notice, fmt.Errorf("email sent but failed to record activity: %w", err)
+	}
+	return notice, nil
+}
@@ -0,0 +1,299 @@
+package billing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"rva_crm/internal/activity"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockReceivablesRepository struct {
+	mock.Mock
+}
+
+func (m *MockReceivablesRepository) GetOpenInvoices(ctx context.Context, asOf time.Time) ([]*Invoice, error) {
+	args := m.Called(ctx, asOf)
+	invoices, _ := args.Get(0).([]*Invoice)
+	return invoices, args.Error(1)
+}
+
+func (m *MockReceivablesRepository) GetDunningNoticesByInvoiceID(ctx context.Context, invoiceID uuid.UUID) ([]*DunningNotice, error) {
+	args := m.Called(ctx, invoiceID)
+	notices, _ := args.Get(0).([]*DunningNotice)
+	return notices, args.Error(1)
+}
+
+func (m *MockReceivablesRepository) CreateDunningNotice(ctx context.Context, notice DunningNotice) (*DunningNotice, error) {
+	args := m.Called(ctx, notice)
+	created, _ := args.Get(0).(*DunningNotice)
+	return created, args.Error(1)
+}
+
+func (m *MockReceivablesRepository) DeleteDunningNotice(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+type MockMailer struct {
+	mock.Mock
+}
+
+func (m *MockMailer) SendEmail(ctx context.Context, email Email) error {
+	args := m.Called(ctx, email)
+	return args.Error(0)
+}
+
+type MockActivityCreator struct {
+	mock.Mock
+}
+
+func (m *MockActivityCreator) CreateActivity(ctx context.Context, a activity.Activity) (*activity.Activity, error) {
+	args := m.Called(ctx, a)
+	created, _ := args.Get(0).(*activity.Activity)
+	return created, args.Error(1)
+}
+
+type ReceivablesServiceTestSuite struct {
+	suite.Suite
+	repo       *MockReceivablesRepository
+	customers  *MockCustomerRetriever
+	mailer     *MockMailer
+	activities *MockActivityCreator
+	now        time.Time
+	service    ReceivablesService
+}
+
+func (s *ReceivablesServiceTestSuite) SetupTest() {
+	s.repo = new(MockReceivablesRepository)
+	s.customers = new(MockCustomerRetriever)
+	s.mailer = new(MockMailer)
+	s.activities = new(MockActivityCreator)
+	s.now = time.Date(2026, 6, 10, 7, 0, 0, 0, time.UTC)
+	s.service = NewReceivablesService(s.repo, s.customers, s.mailer, s.activities)
+	s.service.(*receivablesService).now = func() time.Time { return s.now }
+}
+
+func (s *ReceivablesServiceTestSuite) TearDownTest() {
+	s.repo.AssertExpectations(s.T())
+	s.customers.AssertExpectations(s.T())
+	s.mailer.AssertExpectations(s.T())
+	s.activities.AssertExpectations(s.T())
+}
+
+func TestReceivablesServiceSuite(t *testing.T) {
+	suite.Run(t, new(ReceivablesServiceTestSuite))
+}
+
+// openInvoice is a sent invoice for total, due on due, with paid applied.
+func openInvoice(customerID uuid.UUID, number string, due *time.Time, total, paid string) *Invoice {
+	issued := due.AddDate(0, 0, -30)
+	invoice := &Invoice{
+		InvoiceNumber: number,
+		Kind:          InvoiceKindInvoice,
+		CustomerID:    customerID,
+		Status:        InvoiceStatusSent,
+		Total:         usd(total),
+		AmountPaid:    usd(paid),
+		IssueDate:     &issued,
+		DueDate:       due,
+	}
+	invoice.ID = uuid.New()
+	return invoice
+}
+
+func (s *ReceivablesServiceTestSuite) TestAgingReport_BucketsBalancesPerCustomer() {
+	// Arrange
+	ctx := context.Background()
+	acme, zenith := uuid.New(), uuid.New()
+	invoices := []*Invoice{
+		openInvoice(zenith, "INV-000001", date(2026, 6, 20), "100.00", "0"),    // current
+		openInvoice(zenith, "INV-000002", date(2026, 6, 9), "200.00", "50.00"), // 1 day
+		openInvoice(acme, "INV-000003", date(2026, 5, 1), "300.00", "0"),       // 40 days
+		openInvoice(acme, "INV-000004", date(2026, 3, 1), "400.00", "0"),       // 101 days
+		openInvoice(acme, "INV-000005", date(2026, 4, 1), "500.00", "500.00"),  // settled
+		openInvoice(zenith, "INV-000006", date(2026, 3, 12), "600.00", "0"),    // exactly 90 days
+	}
+
+	s.repo.On("GetOpenInvoices", ctx, *date(2026, 6, 10)).Return(invoices, nil)
+	s.customers.On("GetCustomerByID", ctx, acme).Return(customers.Customer{CompanyName: "Acme LLC"}, nil)
+	s.customers.On("GetCustomerByID", ctx, zenith).Return(customers.Customer{FirstName: "Zoe", LastName: "Zenith"}, nil)
+
+	// Act
+	report, err := s.service.AgingReport(ctx, s.now)
+
+	// Assert
+	s.NoError(err)
+	s.Require().Len(report.Customers, 2)
+	acmeLine, zenithLine := report.Customers[0], report.Customers[1]
+	s.Equal("Acme LLC", acmeLine.CustomerName)
+	s.Equal(usd("300.00"), acmeLine.Amounts.Days31To60)
+	s.Equal(usd("400.00"), acmeLine.Amounts.Over90)
+	s.Equal(usd("700.00"), acmeLine.Amounts.Total)
+	s.Len(acmeLine.Invoices, 2)
+	s.Equal("INV-000004", acmeLine.Invoices[0].InvoiceNumber)
+	s.Equal(101, acmeLine.Invoices[0].DaysOverdue)
+
+	s.Equal("Zoe Zenith", zenithLine.CustomerName)
+	s.Equal(usd("100.00"), zenithLine.Amounts.Current)
+	s.Equal(usd("150.00"), zenithLine.Amounts.Days1To30)
+	s.Equal(usd("600.00"), zenithLine.Amounts.Days61To90)
+
+	s.Equal(usd("100.00"), report.Totals.Current)
+	s.Equal(usd("1550.00"), report.Totals.Total)
+}
+
+func (s *ReceivablesServiceTestSuite) TestWriteAgingCSV_WritesCustomerRowsAndTotals() {
+	// Arrange
+	customerID := uuid.MustParse("0b9a3f7e-4a0c-4f41-9d6c-2f4f0a5c1e11")
+	report := AgingReport{
+		AsOf: *date(2026, 6, 10),
+		Customers: []CustomerAging{{
+			CustomerID:   customerID,
+			CustomerName: "Acme, LLC",
+			Amounts:      AgingAmounts{Current: usd("10.00"), Over90: usd("5.50"), Total: usd("15.50")},
+		}},
+		Totals: AgingAmounts{Current: usd("10.00"), Over90: usd("5.50"), Total: usd("15.50")},
+	}
+	var buf bytes.Buffer
+
+	// Act
+	err := WriteAgingCSV(&buf, report)
+
+	// Assert
+	s.NoError(err)
+	s.Equal("customer_id,customer_name,current,1_30,31_60,61_90,over_90,total\n"+
+		"0b9a3f7e-4a0c-4f41-9d6c-2f4f0a5c1e11,\"Acme, LLC\",10.00,0.00,0.00,0.00,5.50,15.50\n"+
+		",Total,10.00,0.00,0.00,0.00,5.50,15.50\n", buf.String())
+}
+
+func (s *ReceivablesServiceTestSuite) TestRunDunning_SendsLatestStageAndRecordsActivity() {
+	// Arrange
+	ctx := context.Background()
+	customerID := uuid.New()
+	invoice := openInvoice(customerID, "INV-000042", date(2026, 5, 20), "250.00", "50.00") // 21 days
+
+	s.repo.On("GetOpenInvoices", ctx, *date(2026, 6, 10)).Return([]*Invoice{invoice}, nil)
+	s.repo.On("GetDunningNoticesByInvoiceID", ctx, invoice.ID).Return([]*DunningNotice{{Stage: "reminder"}}, nil)
+	s.customers.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{CompanyName: "Acme LLC", Email: "ap@acme.test"}, nil)
+	var saved DunningNotice
+	s.repo.On("CreateDunningNotice", ctx, mock.AnythingOfType("DunningNotice")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(DunningNotice)
+		saved.ID = uuid.New()
+	}).Return(&saved, nil)
+	var sent Email
+	s.mailer.On("SendEmail", ctx, mock.AnythingOfType("Email")).Run(func(args mock.Arguments) {
+		sent = args.Get(1).(Email)
+	}).Return(nil)
+	s.activities.On("CreateActivity", ctx, mock.MatchedBy(func(a activity.Activity) bool {
+		return *a.CustomerID == customerID && a.ActivityType == string(activity.ActivityTypeEmail) && a.ActivityMetadata["stage"] == "second_notice"
+	})).Return(&activity.Activity{}, nil)
+
+	// Act
+	run, err := s.service.RunDunning(ctx, s.now)
+
+	// Assert
+	s.NoError(err)
+	s.Empty(run.Failures)
+	s.Len(run.Notices, 1)
+	s.Equal("second_notice", saved.Stage)
+	s.Equal(21, saved.DaysOverdue)
+	s.Equal(usd("200.00"), saved.Balance)
+	s.Equal(s.now, saved.SentAt)
+	s.Equal("ap@acme.test", sent.To)
+	s.Equal("Second notice: invoice INV-000042 is 21 days past due", sent.Subject)
+	s.Contains(sent.Body, "Dear Acme LLC,")
+	s.Contains(sent.Body, "payment of USD 200.00 for invoice INV-000042, which was due on 2026-05-20")
+}
+
+func (s *ReceivablesServiceTestSuite) TestRunDunning_SkipsStagesAlreadySentAndPaidOrNotYetDueInvoices() {
+	// Arrange
+	ctx := context.Background()
+	customerID := uuid.New()
+	finalSent := openInvoice(customerID, "INV-000001", date(2026, 4, 1), "100.00", "0")
+	paid := openInvoice(customerID, "INV-000002", date(2026, 4, 1), "100.00", "100.00")
+	grace := openInvoice(customerID, "INV-000003", date(2026, 6, 8), "100.00", "0") // 2 days
+
+	s.repo.On("GetOpenInvoices", ctx, *date(2026, 6, 10)).Return([]*Invoice{finalSent, paid, grace}, nil)
+	s.repo.On("GetDunningNoticesByInvoiceID", ctx, finalSent.ID).Return([]*DunningNotice{{Stage: "final_notice"}}, nil)
+
+	// Act
+	run, err := s.service.RunDunning(ctx, s.now)
+
+	// Assert
+	s.NoError(err)
+	s.Empty(run.Notices)
+	s.Empty(run.Failures)
+	s.repo.AssertNotCalled(s.T(), "CreateDunningNotice", mock.Anything, mock.Anything)
+}
+
+func (s *ReceivablesServiceTestSuite) TestRunDunning_ReleasesNoticeWhenEmailFails() {
+	// Arrange
+	ctx := context.Background()
+	customerID := uuid.New()
+	invoice := openInvoice(customerID, "INV-000007", date(2026, 6, 5), "80.00", "0")
+	noticeID := uuid.New()
+
+	s.repo.On("GetOpenInvoices", ctx, *date(2026, 6, 10)).Return([]*Invoice{invoice}, nil)
+	s.repo.On("GetDunningNoticesByInvoiceID", ctx, invoice.ID).Return(nil, nil)
+	s.customers.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{FirstName: "Ann", Email: "ann@example.test"}, nil)
+	notice := &DunningNotice{Stage: "reminder", Recipient: "ann@example.test"}
+	notice.ID = noticeID
+	s.repo.On("CreateDunningNotice", ctx, mock.MatchedBy(func(n DunningNotice) bool { return n.Stage == "reminder" })).Return(notice, nil)
+	s.mailer.On("SendEmail", ctx, mock.AnythingOfType("Email")).Return(errors.New("smtp unavailable"))
+	s.repo.On("DeleteDunningNotice", ctx, noticeID).Return(nil)
+
+	// Act
+	run, err := s.service.RunDunning(ctx, s.now)
+
+	// Assert
+	s.NoError(err)
+	s.Empty(run.Notices)
+	s.Require().Len(run.Failures, 1)
+	s.Equal(invoice.ID, run.Failures[0].InvoiceID)
+	s.Contains(run.Failures[0].Error, "smtp unavailable")
+	s.activities.AssertNotCalled(s.T(), "CreateActivity", mock.Anything, mock.Anything)
+}
+
+func (s *ReceivablesServiceTestSuite) TestRunDunning_NoticeClaimedByAnotherRunIsSkipped() {
+	// Arrange
+	ctx := context.Background()
+	customerID := uuid.New()
+	invoice := openInvoice(customerID, "INV-000008", date(2026, 6, 5), "80.00", "0")
+
+	s.repo.On("GetOpenInvoices", ctx, *date(2026, 6, 10)).Return([]*Invoice{invoice}, nil)
+	s.repo.On("GetDunningNoticesByInvoiceID", ctx, invoice.ID).Return(nil, nil)
+	s.customers.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{FirstName: "Ann", Email: "ann@example.test"}, nil)
+	s.repo.On("CreateDunningNotice", ctx, mock.AnythingOfType("DunningNotice")).Return(nil, ErrDunningNoticeExists)
+
+	// Act
+	run, err := s.service.RunDunning(ctx, s.now)
+
+	// Assert
+	s.NoError(err)
+	s.Empty(run.Notices)
+	s.Empty(run.Failures)
+	s.mailer.AssertNotCalled(s.T(), "SendEmail", mock.Anything, mock.Anything)
+}
+
+func (s *ReceivablesServiceTestSuite) TestDunningPolicyValidate_RejectsStagesOutOfOrderAndBadTemplates() {
+	// Arrange
+	outOfOrder := DunningPolicy{{Name: "first", DaysOverdue: 10}, {Name: "second", DaysOverdue: 5}}
+	badField := DunningPolicy{{Name: "first", DaysOverdue: 3, Subject: "{{.Amount}}"}}
+
+	// Act
+	outOfOrderErr := outOfOrder.Validate()
+	badFieldErr := badField.Validate()
+
+	// Assert
+	s.ErrorIs(outOfOrderErr, ErrInvalidDunningPolicy)
+	s.ErrorIs(badFieldErr, ErrInvalidDunningPolicy)
+	s.NoError(DefaultDunningPolicy().Validate())
+}
@@ -0,0 +1,164 @@
+package billing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRefundNotFound         = errors.New("refund not found")
+	ErrInvalidRefund          = errors.New("invalid refund")
+	ErrChargebackNotFound     = errors.New("chargeback not found")
+	ErrInvalidChargeback      = errors.New("invalid chargeback")
+	ErrInvalidDisputeStatus   = errors.New("dispute status transition is not allowed")
+	ErrDisputeStatusConflict  = errors.New("dispute status was changed by another request")
+	ErrExceedsReversibleFunds = errors.New("amount exceeds what is left of the payment")
+)
+
+// Refund returns all or part of a completed payment to the customer. Money
+// applied to invoices or orders is taken back from them, most recent
+// application first, once the payment's unapplied amount is used up.
+type Refund struct {
+	core.BaseModel
+	PaymentID  uuid.UUID    `json:"payment_id"`
+	Amount     core.Money   `json:"amount"`
+	Reason     RefundReason `json:"reason"`
+	Notes      string       `json:"notes"`
+	RefundedAt time.Time    `json:"refunded_at"`
+
+	// Set for refunds made through the PaymentGateway
+	ProcessorReference string          `json:"processor_reference,omitempty"`
+	ProcessedAt        *time.Time      `json:"processed_at,omitempty"`
+	ProcessorData      json.RawMessage `json:"processor_data,omitempty"`
+}
+
+type RefundReason string
+
+const (
+	RefundReasonRequestedByCustomer RefundReason = "requested_by_customer"
+	RefundReasonDuplicate           RefundReason = "duplicate"
+	RefundReasonBillingError        RefundReason = "billing_error"
+	RefundReasonServiceNotRendered  RefundReason = "service_not_rendered"
+	RefundReasonFraudulent          RefundReason = "fraudulent"
+	RefundReasonOther               RefundReason = "other"
+)
+
+func (r RefundReason) Valid() bool {
+	switch r {
+	case RefundReasonRequestedByCustomer, RefundReasonDuplicate, RefundReasonBillingError, RefundReasonServiceNotRendered, RefundReasonFraudulent, RefundReasonOther:
+		return true
+	}
+	return false
+}
+
+// Chargeback is a payment the customer disputed with their card issuer. The
+// disputed funds are withheld while the dispute is open; a won dispute
+// returns them and a lost one takes them from the payment for good.
+type Chargeback struct {
+	core.BaseModel
+	PaymentID     uuid.UUID     `json:"payment_id"`
+	Amount        core.Money    `json:"amount"`
+	ReasonCode    string        `json:"reason_code"` // Card network reason code, e.g. "10.4"
+	Status        DisputeStatus `json:"status"`
+	DisputedAt    time.Time     `json:"disputed_at"`
+	EvidenceDueBy *time.Time    `json:"evidence_due_by"`
+	ResolvedAt    *time.Time    `json:"resolved_at"`
+	Notes         string        `json:"notes"`
+}
+
+type DisputeStatus string
+
+const (
+	DisputeStatusNeedsResponse DisputeStatus = "needs_response"
+	DisputeStatusUnderReview   DisputeStatus = "under_review"
+	DisputeStatusWon           DisputeStatus = "won"
+	DisputeStatusLost          DisputeStatus = "lost"
+)
+
+// disputeTransitions lists the statuses each dispute status may move to. Won
+// and lost disputes are final.
+var disputeTransitions = map[DisputeStatus][]DisputeStatus{
+	DisputeStatusNeedsResponse: {DisputeStatusUnderReview, DisputeStatusWon, DisputeStatusLost},
+	DisputeStatusUnderReview:   {DisputeStatusWon, DisputeStatusLost},
+}
+
+// CanTransitionTo reports whether a dispute may move from s to next.
+func (s DisputeStatus) CanTransitionTo(next DisputeStatus) bool {
+	for _, allowed := range disputeTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOpen reports whether the dispute still withholds funds.
+func (s DisputeStatus) IsOpen() bool {
+	return s == DisputeStatusNeedsResponse || s == DisputeStatusUnderReview
+}
+
+// Reversible is what can still be refunded or disputed: the amount received
+// less refunds, open disputes and lost chargebacks.
+func (p Payment) Reversible() (core.Money, error) {
+	reversed, err := core.Sum(p.RefundedAmount, p.DisputedAmount, p.ChargedBackAmount)
+	if err != nil {
+		return core.Money{}, err
+	}
+	return p.Amount.Sub(reversed)
+}
+
+// checkReversible returns ErrExceedsReversibleFunds if amount cannot be
+// refunded or disputed.
+func (p Payment) checkReversible(amount core.Money) error {
+	reversible, err := p.Reversible()
+	if err != nil {
+		return err
+	}
+	if cmp, err := amount.Cmp(reversible); err != nil {
+		return err
+	} else if cmp > 0 {
+		return fmt.Errorf("%w: %s can still be reversed", ErrExceedsReversibleFunds, reversible)
+	}
+	return nil
+}
+
+// applicationReversal takes Amount back from one payment application.
+type applicationReversal struct {
+	Application PaymentApplication
+	Amount      core.Money
+}
+
+// planRelease picks what to take back from the payment's applications so that
+// amount of it is unapplied, starting with the most recent application.
+func (p Payment) planRelease(amount core.Money) ([]applicationReversal, error) {
+	unapplied, err := p.Unapplied()
+	if err != nil {
+		return nil, err
+	}
+	needed, err := amount.Sub(unapplied)
+	if err != nil {
+		return nil, err
+	}
+	var reversals []applicationReversal
+	for i := len(p.Applications) - 1; i >= 0 && needed.IsPositive(); i-- {
+		application := p.Applications[i]
+		take, err := application.Amount.Min(needed)
+		if err != nil {
+			return nil, err
+		}
+		reversals = append(reversals, applicationReversal{Application: application, Amount: take})
+		if needed, err = needed.Sub(take); err != nil {
+			return nil, err
+		}
+	}
+	if needed.IsPositive() {
+		return nil, fmt.Errorf("%w: %s is not covered by the payment", ErrExceedsReversibleFunds, needed)
+	}
+	return reversals, nil
+}
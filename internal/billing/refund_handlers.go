@@ -0,0 +1,194 @@
+package billing
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type refundHandler struct {
+	service PaymentRefunder
+}
+
+type chargebackHandler struct {
+	service ChargebackManager
+}
+
+type ledgerHandler struct {
+	service PaymentLedger
+}
+
+func (h *refundHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getRefunds(w, r)
+	case http.MethodPost:
+		h.refundPayment(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *chargebackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getChargebacks(w, r)
+	case http.MethodPost:
+		h.recordChargeback(w, r)
+	case http.MethodPut:
+		h.updateChargebackStatus(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *ledgerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getLedger(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// NewRefundHandler lists the refunds of the payment given by ?payment_id= on
+// GET. POST refunds it with a {"amount": ..., "reason": ..., "notes": ...}
+// body; a missing amount refunds everything that is left.
+func NewRefundHandler(service PaymentRefunder) http.Handler {
+	return &refundHandler{service: service}
+}
+
+// NewChargebackHandler records a chargeback against the payment given by
+// ?payment_id= on POST, with a {"amount": ..., "reason_code": ...,
+// "evidence_due_by": ...} body. GET lists a payment's chargebacks, or returns
+// one given by ?id=. PUT moves the chargeback given by ?id= to the
+// {"status": ...} in the body.
+func NewChargebackHandler(service ChargebackManager) http.Handler {
+	return &chargebackHandler{service: service}
+}
+
+// NewLedgerHandler returns the ledger entries of the payment given by
+// ?payment_id=, with the reconciliation of the ledger against the payment.
+func NewLedgerHandler(service PaymentLedger) http.Handler {
+	return &ledgerHandler{service: service}
+}
+
+func (h *refundHandler) getRefunds(w http.ResponseWriter, r *http.Request) {
+	paymentID, ok := queryUUID(w, r, "payment_id")
+	if !ok {
+		return
+	}
+	refunds, err := h.service.GetRefundsByPaymentID(r.Context(), paymentID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(refunds)
+}
+
+func (h *refundHandler) refundPayment(w http.ResponseWriter, r *http.Request) {
+	paymentID, ok := queryUUID(w, r, "payment_id")
+	if !ok {
+		return
+	}
+	var refund Refund
+	err := json.NewDecoder(r.Body).Decode(&refund)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	created, err := h.service.RefundPayment(r.Context(), paymentID, refund)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *chargebackHandler) getChargebacks(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("payment_id") {
+		paymentID, ok := queryUUID(w, r, "payment_id")
+		if !ok {
+			return
+		}
+		chargebacks, err := h.service.GetChargebacksByPaymentID(r.Context(), paymentID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(chargebacks)
+		return
+	}
+	chargebackID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	chargeback, err := h.service.GetChargebackByID(r.Context(), chargebackID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(chargeback)
+}
+
+func (h *chargebackHandler) recordChargeback(w http.ResponseWriter, r *http.Request) {
+	paymentID, ok := queryUUID(w, r, "payment_id")
+	if !ok {
+		return
+	}
+	var chargeback Chargeback
+	err := json.NewDecoder(r.Body).Decode(&chargeback)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	created, err := h.service.RecordChargeback(r.Context(), paymentID, chargeback)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *chargebackHandler) updateChargebackStatus(w http.ResponseWriter, r *http.Request) {
+	chargebackID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	var body struct {
+		Status DisputeStatus `json:"status"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	chargeback, err := h.service.UpdateChargebackStatus(r.Context(), chargebackID, body.Status)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(chargeback)
+}
+
+func (h *ledgerHandler) getLedger(w http.ResponseWriter, r *http.Request) {
+	paymentID, ok := queryUUID(w, r, "payment_id")
+	if !ok {
+		return
+	}
+	entries, err := h.service.GetLedgerEntriesByPaymentID(r.Context(), paymentID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	reconciliation, err := h.service.ReconcilePayment(r.Context(), paymentID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(struct {
+		Entries        []*LedgerEntry         `json:"entries"`
+		Reconciliation *PaymentReconciliation `json:"reconciliation"`
+	}{entries, reconciliation})
+}
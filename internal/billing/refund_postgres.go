@@ -0,0 +1,420 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+const refundColumns = "id, payment_id, amount, reason, notes, refunded_at, processor_reference, processed_at, processor_data, created_at, updated_at, (SELECT p.currency FROM payments p WHERE p.id = payment_id)"
+
+func scanRefund(row rowScanner) (*Refund, error) {
+	var refund Refund
+	var processorData []byte
+	var currency core.Currency
+	err := row.Scan(&refund.ID, &refund.PaymentID, &refund.Amount, &refund.Reason, &refund.Notes, &refund.RefundedAt, &refund.ProcessorReference, &refund.ProcessedAt, &processorData, &refund.CreatedAt, &refund.UpdatedAt, &currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRefundNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := rereadAmounts(currency, &refund.Amount); err != nil {
+		return nil, err
+	}
+	if len(processorData) > 0 {
+		refund.ProcessorData = json.RawMessage(processorData)
+	}
+	return &refund, nil
+}
+
+const chargebackColumns = "id, payment_id, amount, reason_code, status, disputed_at, evidence_due_by, resolved_at, notes, created_at, updated_at, (SELECT p.currency FROM payments p WHERE p.id = payment_id)"
+
+func scanChargeback(row rowScanner) (*Chargeback, error) {
+	var chargeback Chargeback
+	var currency core.Currency
+	err := row.Scan(&chargeback.ID, &chargeback.PaymentID, &chargeback.Amount, &chargeback.ReasonCode, &chargeback.Status, &chargeback.DisputedAt, &chargeback.EvidenceDueBy, &chargeback.ResolvedAt, &chargeback.Notes, &chargeback.CreatedAt, &chargeback.UpdatedAt, &currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrChargebackNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := rereadAmounts(currency, &chargeback.Amount); err != nil {
+		return nil, err
+	}
+	return &chargeback, nil
+}
+
+const ledgerEntryColumns = "id, payment_id, entry_type, debit_account, credit_account, amount, realized_fx, invoice_id, order_id, refund_id, chargeback_id, occurred_at, created_at, (SELECT p.currency FROM payments p WHERE p.id = payment_id)"
+
+func scanLedgerEntry(row rowScanner) (*LedgerEntry, error) {
+	var entry LedgerEntry
+	var currency core.Currency
+	err := row.Scan(&entry.ID, &entry.PaymentID, &entry.Type, &entry.DebitAccount, &entry.CreditAccount, &entry.Amount, &entry.RealizedFX, &entry.InvoiceID, &entry.OrderID, &entry.RefundID, &entry.ChargebackID, &entry.OccurredAt, &entry.CreatedAt, &currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := rereadAmounts(currency, &entry.Amount); err != nil {
+		return nil, err
+	}
+	if err := rereadAmounts(BaseCurrency, &entry.RealizedFX); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// insertLedgerEntries writes entries as part of tx. The table rejects updates
+// and deletes, so this is the only way entries change.
+func insertLedgerEntries(ctx context.Context, tx *sql.Tx, entries ...LedgerEntry) error {
+	for _, entry := range entries {
+		if entry.ID == uuid.Nil {
+			entry.ID = uuid.New()
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO ledger_entries (id, payment_id, entry_type, debit_account, credit_account, amount, realized_fx, invoice_id, order_id, refund_id, chargeback_id, occurred_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)",
+			entry.ID, entry.PaymentID, entry.Type, entry.DebitAccount, entry.CreditAccount, entry.Amount, entry.RealizedFX, entry.InvoiceID, entry.OrderID, entry.RefundID, entry.ChargebackID, entry.OccurredAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *paymentRepository) CreateRefund(ctx context.Context, refund Refund) (*Refund, error) {
+	if refund.ID == uuid.Nil {
+		refund.ID = uuid.New()
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	payment, err := lockPayment(ctx, tx, refund.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != PaymentStatusCompleted {
+		return nil, fmt.Errorf("%w: only completed payments can be refunded", ErrInvalidPaymentStatus)
+	}
+	if err := payment.checkReversible(refund.Amount); err != nil {
+		return nil, err
+	}
+	if err := releaseApplications(ctx, tx, payment, refund.Amount, refund.RefundedAt); err != nil {
+		return nil, err
+	}
+
+	if payment.RefundedAmount, err = payment.RefundedAmount.Add(refund.Amount); err != nil {
+		return nil, err
+	}
+	status := payment.Status
+	if cmp, err := payment.RefundedAmount.Cmp(payment.Amount); err != nil {
+		return nil, err
+	} else if cmp == 0 {
+		status = PaymentStatusRefunded
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE payments SET refunded_amount = $1, payment_status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3", payment.RefundedAmount, status, payment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := scanRefund(tx.QueryRowContext(ctx, "INSERT INTO refunds (id, payment_id, amount, reason, notes, refunded_at, processor_reference, processed_at, processor_data) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING "+refundColumns,
+		refund.ID, refund.PaymentID, refund.Amount, refund.Reason, refund.Notes, refund.RefundedAt, refund.ProcessorReference, refund.ProcessedAt, nullableJSON(refund.ProcessorData)))
+	if err != nil {
+		return nil, err
+	}
+	entry := newLedgerEntry(payment.ID, LedgerEntryRefund, created.Amount, created.RefundedAt)
+	entry.RefundID = &created.ID
+	if err := insertLedgerEntries(ctx, tx, entry); err != nil {
+		return nil, err
+	}
+	if err := refreshCustomerStats(ctx, tx, payment.CustomerID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (r *paymentRepository) GetRefundsByPaymentID(ctx context.Context, paymentID uuid.UUID) ([]*Refund, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+refundColumns+" FROM refunds WHERE payment_id = $1 ORDER BY refunded_at, id", paymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refunds []*Refund
+	for rows.Next() {
+		refund, err := scanRefund(rows)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, refund)
+	}
+	return refunds, rows.Err()
+}
+
+func (r *paymentRepository) CreateChargeback(ctx context.Context, chargeback Chargeback) (*Chargeback, error) {
+	if chargeback.ID == uuid.Nil {
+		chargeback.ID = uuid.New()
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	payment, err := lockPayment(ctx, tx, chargeback.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != PaymentStatusCompleted {
+		return nil, fmt.Errorf("%w: only completed payments can be disputed", ErrInvalidPaymentStatus)
+	}
+	if err := payment.checkReversible(chargeback.Amount); err != nil {
+		return nil, err
+	}
+	if payment.DisputedAmount, err = payment.DisputedAmount.Add(chargeback.Amount); err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE payments SET disputed_amount = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", payment.DisputedAmount, payment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := scanChargeback(tx.QueryRowContext(ctx, "INSERT INTO chargebacks (id, payment_id, amount, reason_code, status, disputed_at, evidence_due_by, notes) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING "+chargebackColumns,
+		chargeback.ID, chargeback.PaymentID, chargeback.Amount, chargeback.ReasonCode, chargeback.Status, chargeback.DisputedAt, chargeback.EvidenceDueBy, chargeback.Notes))
+	if err != nil {
+		return nil, err
+	}
+	entry := newLedgerEntry(payment.ID, LedgerEntryChargeback, created.Amount, created.DisputedAt)
+	entry.ChargebackID = &created.ID
+	if err := insertLedgerEntries(ctx, tx, entry); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// ResolveChargeback moves a chargeback on from status from. A won dispute
+// returns the withheld funds to the payment; a lost one takes them for good,
+// releasing applications as a refund would.
+func (r *paymentRepository) ResolveChargeback(ctx context.Context, chargeback Chargeback, from DisputeStatus) (*Chargeback, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the payment first, as every other payment change does.
+	payment, err := lockPayment(ctx, tx, chargeback.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := scanChargeback(tx.QueryRowContext(ctx, "UPDATE chargebacks SET status = $1, resolved_at = $2, notes = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $4 AND status = $5 RETURNING "+chargebackColumns,
+		chargeback.Status, chargeback.ResolvedAt, chargeback.Notes, chargeback.ID, from))
+	if errors.Is(err, ErrChargebackNotFound) {
+		return nil, ErrDisputeStatusConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if updated.Status.IsOpen() {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return updated, nil
+	}
+
+	at := time.Now()
+	if updated.ResolvedAt != nil {
+		at = *updated.ResolvedAt
+	}
+	entryType := LedgerEntryChargebackWon
+	if payment.DisputedAmount, err = payment.DisputedAmount.Sub(updated.Amount); err != nil {
+		return nil, err
+	}
+	if updated.Status == DisputeStatusLost {
+		entryType = LedgerEntryChargebackLost
+		if err := releaseApplications(ctx, tx, payment, updated.Amount, at); err != nil {
+			return nil, err
+		}
+		if payment.ChargedBackAmount, err = payment.ChargedBackAmount.Add(updated.Amount); err != nil {
+			return nil, err
+		}
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE payments SET disputed_amount = $1, charged_back_amount = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3", payment.DisputedAmount, payment.ChargedBackAmount, payment.ID)
+	if err != nil {
+		return nil, err
+	}
+	entry := newLedgerEntry(payment.ID, entryType, updated.Amount, at)
+	entry.ChargebackID = &updated.ID
+	if err := insertLedgerEntries(ctx, tx, entry); err != nil {
+		return nil, err
+	}
+	if err := refreshCustomerStats(ctx, tx, payment.CustomerID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (r *paymentRepository) GetChargebackByID(ctx context.Context, id uuid.UUID) (*Chargeback, error) {
+	return scanChargeback(r.db.QueryRowContext(ctx, "SELECT "+chargebackColumns+" FROM chargebacks WHERE id = $1", id))
+}
+
+func (r *paymentRepository) GetChargebacksByPaymentID(ctx context.Context, paymentID uuid.UUID) ([]*Chargeback, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+chargebackColumns+" FROM chargebacks WHERE payment_id = $1 ORDER BY disputed_at, id", paymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chargebacks []*Chargeback
+	for rows.Next() {
+		chargeback, err := scanChargeback(rows)
+		if err != nil {
+			return nil, err
+		}
+		chargebacks = append(chargebacks, chargeback)
+	}
+	return chargebacks, rows.Err()
+}
+
+func (r *paymentRepository) GetLedgerEntriesByPaymentID(ctx context.Context, paymentID uuid.UUID) ([]*LedgerEntry, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+ledgerEntryColumns+" FROM ledger_entries WHERE payment_id = $1 ORDER BY occurred_at, created_at, id", paymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*LedgerEntry
+	for rows.Next() {
+		entry, err := scanLedgerEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// releaseApplications takes money back from the locked payment's applications
+// until amount of it is unapplied, reopening the invoices and orders it paid.
+func releaseApplications(ctx context.Context, tx *sql.Tx, payment *Payment, amount core.Money, at time.Time) error {
+	reversals, err := payment.planRelease(amount)
+	if err != nil {
+		return err
+	}
+	targets := lockedTargets{tx: tx, invoices: make(map[uuid.UUID]*Invoice), orders: make(map[uuid.UUID]*Order)}
+	var invoiceIDs, orderIDs []uuid.UUID
+	for _, reversal := range reversals {
+		if reversal.Application.InvoiceID != nil {
+			invoiceIDs = append(invoiceIDs, *reversal.Application.InvoiceID)
+		} else if reversal.Application.OrderID != nil {
+			orderIDs = append(orderIDs, *reversal.Application.OrderID)
+		}
+	}
+	if err := targets.lock(ctx, invoiceIDs, orderIDs); err != nil {
+		return err
+	}
+	for _, reversal := range reversals {
+		application := reversal.Application
+		if application.InvoiceID != nil {
+			err = targets.reverseInvoice(ctx, *application.InvoiceID, reversal.Amount, at)
+		} else if application.OrderID != nil {
+			err = targets.reverseOrder(ctx, *application.OrderID, reversal.Amount)
+		}
+		if err != nil {
+			return err
+		}
+
+		remaining, err := application.Amount.Sub(reversal.Amount)
+		if err != nil {
+			return err
+		}
+		// The exchange difference realized on what stays applied shrinks in
+		// proportion.
+		realized, err := application.RealizedFX.Mul(big.NewRat(remaining.Minor(), application.Amount.Minor()), core.RoundHalfEven)
+		if err != nil {
+			return err
+		}
+		if remaining.IsZero() {
+			_, err = tx.ExecContext(ctx, "DELETE FROM payment_applications WHERE id = $1", application.ID)
+		} else {
+			_, err = tx.ExecContext(ctx, "UPDATE payment_applications SET amount = $1, realized_fx = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3", remaining, realized, application.ID)
+		}
+		if err != nil {
+			return err
+		}
+
+		entry := newLedgerEntry(payment.ID, LedgerEntryApplicationReversed, reversal.Amount, at)
+		entry.InvoiceID, entry.OrderID = application.InvoiceID, application.OrderID
+		if entry.RealizedFX, err = application.RealizedFX.Sub(realized); err != nil {
+			return err
+		}
+		if err := insertLedgerEntries(ctx, tx, entry); err != nil {
+			return err
+		}
+
+		for i := range payment.Applications {
+			if payment.Applications[i].ID != application.ID {
+				continue
+			}
+			if remaining.IsZero() {
+				payment.Applications = append(payment.Applications[:i], payment.Applications[i+1:]...)
+			} else {
+				payment.Applications[i].Amount, payment.Applications[i].RealizedFX = remaining, realized
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// reverseInvoice takes amount back from an invoice and from the order it
+// bills, if any.
+func (t lockedTargets) reverseInvoice(ctx context.Context, invoiceID uuid.UUID, amount core.Money, at time.Time) error {
+	invoice, err := t.invoice(ctx, invoiceID)
+	if err != nil {
+		return err
+	}
+	if err := invoice.ReversePayment(amount, at); err != nil {
+		return err
+	}
+	if err := updateInvoiceBalance(ctx, t.tx, *invoice); err != nil {
+		return err
+	}
+	if invoice.OrderID == nil {
+		return nil
+	}
+	return t.reverseOrder(ctx, *invoice.OrderID, amount)
+}
+
+func (t lockedTargets) reverseOrder(ctx context.Context, orderID uuid.UUID, amount core.Money) error {
+	order, err := t.order(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if err := order.ReversePayment(amount); err != nil {
+		return err
+	}
+	return updateOrderAmountPaid(ctx, t.tx, *order)
+}
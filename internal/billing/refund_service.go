@@ -0,0 +1,209 @@
+package billing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// PaymentReverser gives money back after a payment has completed, either as
+// a refund the business makes or a chargeback the customer's bank makes.
+type PaymentReverser interface {
+	PaymentRefunder
+	ChargebackManager
+}
+
+type PaymentRefunder interface {
+	RefundPayment(ctx context.Context, paymentID uuid.UUID, refund Refund) (*Refund, error)
+	GetRefundsByPaymentID(ctx context.Context, paymentID uuid.UUID) ([]*Refund, error)
+}
+
+type ChargebackManager interface {
+	RecordChargeback(ctx context.Context, paymentID uuid.UUID, chargeback Chargeback) (*Chargeback, error)
+	UpdateChargebackStatus(ctx context.Context, id uuid.UUID, status DisputeStatus) (*Chargeback, error)
+	ChargebackReader
+}
+
+type ChargebackReader interface {
+	GetChargebackByID(ctx context.Context, id uuid.UUID) (*Chargeback, error)
+	GetChargebacksByPaymentID(ctx context.Context, paymentID uuid.UUID) ([]*Chargeback, error)
+}
+
+// PaymentLedger exposes the ledger entries recorded for a payment and checks
+// them against the payment's amounts.
+type PaymentLedger interface {
+	LedgerReader
+	ReconcilePayment(ctx context.Context, paymentID uuid.UUID) (*PaymentReconciliation, error)
+}
+
+type LedgerReader interface {
+	GetLedgerEntriesByPaymentID(ctx context.Context, paymentID uuid.UUID) ([]*LedgerEntry, error)
+}
+
+// RefundRepository records refunds. CreateRefund locks the payment, re-checks
+// the refundable amount, releases applications most recent first, reopening
+// the invoices and orders they paid, and writes the ledger entries in the
+// same transaction. A payment refunded in full becomes refunded.
+type RefundRepository interface {
+	CreateRefund(ctx context.Context, refund Refund) (*Refund, error)
+	GetRefundsByPaymentID(ctx context.Context, paymentID uuid.UUID) ([]*Refund, error)
+}
+
+// ChargebackRepository records chargebacks and their outcome. ResolveChargeback
+// saves the new status only if the stored status is still from; otherwise it
+// returns ErrDisputeStatusConflict.
+type ChargebackRepository interface {
+	CreateChargeback(ctx context.Context, chargeback Chargeback) (*Chargeback, error)
+	ResolveChargeback(ctx context.Context, chargeback Chargeback, from DisputeStatus) (*Chargeback, error)
+	ChargebackReader
+}
+
+// RefundPayment returns all or part of a completed payment. A zero amount
+// refunds everything that can still be reversed. Payments taken through the
+// gateway are refunded there first; others are recorded as refunded by some
+// other means, such as a check.
+func (s *paymentService) RefundPayment(ctx context.Context, paymentID uuid.UUID, refund Refund) (*Refund, error) {
+	if !refund.Reason.Valid() {
+		return nil, fmt.Errorf("%w: unknown reason %q", ErrInvalidRefund, refund.Reason)
+	}
+	if refund.Amount.IsNegative() {
+		return nil, fmt.Errorf("%w: amount cannot be negative", ErrInvalidRefund)
+	}
+	payment, err := s.repo.GetPaymentByID(ctx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != PaymentStatusCompleted {
+		return nil, fmt.Errorf("%w: only completed payments can be refunded", ErrInvalidPaymentStatus)
+	}
+	if refund.Amount.IsZero() {
+		if refund.Amount, err = payment.Reversible(); err != nil {
+			return nil, err
+		}
+		if !refund.Amount.IsPositive() {
+			return nil, fmt.Errorf("%w: nothing is left to refund", ErrExceedsReversibleFunds)
+		}
+	}
+	if err := payment.checkReversible(refund.Amount); err != nil {
+		return nil, err
+	}
+	if _, err := payment.planRelease(refund.Amount); err != nil {
+		return nil, err
+	}
+
+	refund.ID = uuid.Nil
+	refund.PaymentID = paymentID
+	refund.RefundedAt = s.now()
+	refund.ProcessorReference, refund.ProcessedAt, refund.ProcessorData = "", nil, nil
+	if payment.TransactionID != "" {
+		if s.gateway == nil {
+			return nil, ErrNoPaymentGateway
+		}
+		result, err := s.gateway.Refund(ctx, payment.TransactionID, refund.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("payment %s: %w", payment.ID, err)
+		}
+		processedAt := result.ProcessedAt
+		refund.ProcessorReference = result.ProcessorReference
+		refund.ProcessedAt = &processedAt
+		refund.ProcessorData = result.Raw
+	}
+
+	created, err := s.repo.CreateRefund(ctx, refund)
+	if err != nil && refund.ProcessorReference != "" {
+		// The money has already gone back to the card; keep the reference
+		// so the refund can be recorded by hand.
+		return nil, fmt.Errorf("refund %s was processed but not recorded: %w", refund.ProcessorReference, err)
+	}
+	return created, err
+}
+
+func (s *paymentService) GetRefundsByPaymentID(ctx context.Context, paymentID uuid.UUID) ([]*Refund, error) {
+	return s.repo.GetRefundsByPaymentID(ctx, paymentID)
+}
+
+// RecordChargeback records a dispute raised against a completed payment. A
+// zero amount disputes everything that can still be reversed. The disputed
+// funds are withheld until the dispute is won or lost.
+func (s *paymentService) RecordChargeback(ctx context.Context, paymentID uuid.UUID, chargeback Chargeback) (*Chargeback, error) {
+	chargeback.ReasonCode = strings.TrimSpace(chargeback.ReasonCode)
+	if chargeback.ReasonCode == "" {
+		return nil, fmt.Errorf("%w: reason code is required", ErrInvalidChargeback)
+	}
+	if chargeback.Amount.IsNegative() {
+		return nil, fmt.Errorf("%w: amount cannot be negative", ErrInvalidChargeback)
+	}
+	payment, err := s.repo.GetPaymentByID(ctx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != PaymentStatusCompleted {
+		return nil, fmt.Errorf("%w: only completed payments can be disputed", ErrInvalidPaymentStatus)
+	}
+	if chargeback.Amount.IsZero() {
+		if chargeback.Amount, err = payment.Reversible(); err != nil {
+			return nil, err
+		}
+		if !chargeback.Amount.IsPositive() {
+			return nil, fmt.Errorf("%w: nothing is left to dispute", ErrExceedsReversibleFunds)
+		}
+	}
+	if err := payment.checkReversible(chargeback.Amount); err != nil {
+		return nil, err
+	}
+
+	chargeback.ID = uuid.Nil
+	chargeback.PaymentID = paymentID
+	chargeback.Status = DisputeStatusNeedsResponse
+	chargeback.ResolvedAt = nil
+	if chargeback.DisputedAt.IsZero() {
+		chargeback.DisputedAt = s.now()
+	}
+	return s.repo.CreateChargeback(ctx, chargeback)
+}
+
+// UpdateChargebackStatus moves a dispute along. Won and lost are final and
+// settle the withheld funds.
+func (s *paymentService) UpdateChargebackStatus(ctx context.Context, id uuid.UUID, status DisputeStatus) (*Chargeback, error) {
+	chargeback, err := s.repo.GetChargebackByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	from := chargeback.Status
+	if !from.CanTransitionTo(status) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidDisputeStatus, from, status)
+	}
+	chargeback.Status = status
+	if !status.IsOpen() {
+		resolvedAt := s.now()
+		chargeback.ResolvedAt = &resolvedAt
+	}
+	return s.repo.ResolveChargeback(ctx, *chargeback, from)
+}
+
+func (s *paymentService) GetChargebackByID(ctx context.Context, id uuid.UUID) (*Chargeback, error) {
+	return s.repo.GetChargebackByID(ctx, id)
+}
+
+func (s *paymentService) GetChargebacksByPaymentID(ctx context.Context, paymentID uuid.UUID) ([]*Chargeback, error) {
+	return s.repo.GetChargebacksByPaymentID(ctx, paymentID)
+}
+
+func (s *paymentService) GetLedgerEntriesByPaymentID(ctx context.Context, paymentID uuid.UUID) ([]*LedgerEntry, error) {
+	return s.repo.GetLedgerEntriesByPaymentID(ctx, paymentID)
+}
+
+// ReconcilePayment compares a payment's ledger with its recorded amounts.
+func (s *paymentService) ReconcilePayment(ctx context.Context, paymentID uuid.UUID) (*PaymentReconciliation, error) {
+	payment, err := s.repo.GetPaymentByID(ctx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.repo.GetLedgerEntriesByPaymentID(ctx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	return reconcilePayment(*payment, entries)
+}
@@ -0,0 +1,253 @@
+package billing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// capturedPayment is a completed payment of amount taken through the fake
+// gateway.
+func (s *PaymentServiceTestSuite) capturedPayment(ctx context.Context, amount string) *Payment {
+	payment := s.authorizedPayment(ctx, usd(amount))
+	_, err := s.gateway.Capture(ctx, payment.TransactionID, usd("0"))
+	s.Require().NoError(err)
+	payment.Status = PaymentStatusCompleted
+	return payment
+}
+
+func (s *PaymentServiceTestSuite) TestRefundPayment_PartialRefundThroughGateway() {
+	// Arrange
+	ctx := context.Background()
+	payment := s.capturedPayment(ctx, "100.00")
+	var saved Refund
+
+	s.paymentRepo.On("GetPaymentByID", ctx, payment.ID).Return(payment, nil)
+	s.paymentRepo.On("CreateRefund", ctx, mock.AnythingOfType("Refund")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Refund)
+	}).Return(&saved, nil)
+
+	// Act
+	result, err := s.service.RefundPayment(ctx, payment.ID, Refund{Amount: usd("30.00"), Reason: RefundReasonBillingError})
+
+	// Assert
+	s.NoError(err)
+	s.Equal(payment.ID, result.PaymentID)
+	s.Equal(usd("30.00"), result.Amount)
+	s.Equal(s.now, result.RefundedAt)
+	s.Contains(result.ProcessorReference, "fake_refund_")
+	status, err := s.gateway.Status(ctx, payment.TransactionID)
+	s.Require().NoError(err)
+	s.Equal(GatewayStatusCaptured, status.Status)
+	s.Equal(usd("30.00"), status.RefundedAmount)
+}
+
+func (s *PaymentServiceTestSuite) TestRefundPayment_ZeroAmountRefundsWhatIsLeft() {
+	// Arrange
+	ctx := context.Background()
+	payment := s.capturedPayment(ctx, "100.00")
+	_, err := s.gateway.Refund(ctx, payment.TransactionID, usd("25.00"))
+	s.Require().NoError(err)
+	payment.RefundedAmount = usd("25.00")
+
+	s.paymentRepo.On("GetPaymentByID", ctx, payment.ID).Return(payment, nil)
+	s.paymentRepo.On("CreateRefund", ctx, mock.MatchedBy(func(refund Refund) bool {
+		return refund.Amount == usd("75.00")
+	})).Return(&Refund{Amount: usd("75.00")}, nil)
+
+	// Act
+	result, err := s.service.RefundPayment(ctx, payment.ID, Refund{Reason: RefundReasonRequestedByCustomer})
+
+	// Assert
+	s.NoError(err)
+	s.Equal(usd("75.00"), result.Amount)
+	status, err := s.gateway.Status(ctx, payment.TransactionID)
+	s.Require().NoError(err)
+	s.Equal(GatewayStatusRefunded, status.Status)
+}
+
+func (s *PaymentServiceTestSuite) TestRefundPayment_RecordsManualRefundOfAppliedPayment() {
+	// Arrange
+	ctx := context.Background()
+	paymentID := uuid.New()
+	invoiceID := uuid.New()
+
+	s.paymentRepo.On("GetPaymentByID", ctx, paymentID).Return(&Payment{
+		Method:       PaymentMethodCheck,
+		Status:       PaymentStatusCompleted,
+		Amount:       usd("100.00"),
+		Applications: []PaymentApplication{{InvoiceID: &invoiceID, Amount: usd("80.00")}},
+	}, nil)
+	s.paymentRepo.On("CreateRefund", ctx, mock.MatchedBy(func(refund Refund) bool {
+		return refund.Amount == usd("50.00") && refund.ProcessorReference == ""
+	})).Return(&Refund{Amount: usd("50.00")}, nil)
+
+	// Act
+	result, err := s.service.RefundPayment(ctx, paymentID, Refund{Amount: usd("50.00"), Reason: RefundReasonDuplicate})
+
+	// Assert
+	s.NoError(err)
+	s.Equal(usd("50.00"), result.Amount)
+}
+
+func (s *PaymentServiceTestSuite) TestRefundPayment_Rejects() {
+	tests := []struct {
+		name    string
+		payment Payment
+		refund  Refund
+		err     error
+	}{
+		{"unknown reason", Payment{Status: PaymentStatusCompleted, Amount: usd("100.00")}, Refund{Amount: usd("10.00"), Reason: "changed_mind"}, ErrInvalidRefund},
+		{"failed payment", Payment{Status: PaymentStatusFailed, Amount: usd("100.00")}, Refund{Reason: RefundReasonOther}, ErrInvalidPaymentStatus},
+		{"more than is left", Payment{Status: PaymentStatusCompleted, Amount: usd("100.00"), RefundedAmount: usd("60.00")}, Refund{Amount: usd("50.00"), Reason: RefundReasonOther}, ErrExceedsReversibleFunds},
+		{"funds held by a dispute", Payment{Status: PaymentStatusCompleted, Amount: usd("100.00"), DisputedAmount: usd("100.00")}, Refund{Reason: RefundReasonOther}, ErrExceedsReversibleFunds},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			// Arrange
+			ctx := context.Background()
+			paymentID := uuid.New()
+			payment := tt.payment
+			s.paymentRepo.On("GetPaymentByID", ctx, paymentID).Return(&payment, nil).Maybe()
+
+			// Act
+			result, err := s.service.RefundPayment(ctx, paymentID, tt.refund)
+
+			// Assert
+			s.ErrorIs(err, tt.err)
+			s.Nil(result)
+		})
+	}
+}
+
+func (s *PaymentServiceTestSuite) TestRecordChargeback_DisputesWholePaymentByDefault() {
+	// Arrange
+	ctx := context.Background()
+	paymentID := uuid.New()
+
+	s.paymentRepo.On("GetPaymentByID", ctx, paymentID).Return(&Payment{Status: PaymentStatusCompleted, Amount: usd("100.00"), RefundedAmount: usd("10.00")}, nil)
+	s.paymentRepo.On("CreateChargeback", ctx, mock.MatchedBy(func(chargeback Chargeback) bool {
+		return chargeback.Amount == usd("90.00") && chargeback.Status == DisputeStatusNeedsResponse &&
+			chargeback.ReasonCode == "10.4" && chargeback.DisputedAt.Equal(s.now)
+	})).Return(&Chargeback{Amount: usd("90.00"), Status: DisputeStatusNeedsResponse}, nil)
+
+	// Act
+	result, err := s.service.RecordChargeback(ctx, paymentID, Chargeback{ReasonCode: " 10.4 ", Status: DisputeStatusWon})
+
+	// Assert
+	s.NoError(err)
+	s.Equal(DisputeStatusNeedsResponse, result.Status)
+}
+
+func (s *PaymentServiceTestSuite) TestRecordChargeback_RequiresReasonCode() {
+	// Act
+	result, err := s.service.RecordChargeback(context.Background(), uuid.New(), Chargeback{Amount: usd("10.00")})
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidChargeback)
+	s.Nil(result)
+}
+
+func (s *PaymentServiceTestSuite) TestUpdateChargebackStatus_ResolvesOpenDispute() {
+	// Arrange
+	ctx := context.Background()
+	chargeback := &Chargeback{PaymentID: uuid.New(), Amount: usd("40.00"), Status: DisputeStatusUnderReview}
+	chargeback.ID = uuid.New()
+
+	s.paymentRepo.On("GetChargebackByID", ctx, chargeback.ID).Return(chargeback, nil)
+	s.paymentRepo.On("ResolveChargeback", ctx, mock.MatchedBy(func(resolved Chargeback) bool {
+		return resolved.Status == DisputeStatusLost && resolved.ResolvedAt != nil && resolved.ResolvedAt.Equal(s.now)
+	}), DisputeStatusUnderReview).Return(&Chargeback{Status: DisputeStatusLost}, nil)
+
+	// Act
+	result, err := s.service.UpdateChargebackStatus(ctx, chargeback.ID, DisputeStatusLost)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(DisputeStatusLost, result.Status)
+}
+
+func (s *PaymentServiceTestSuite) TestUpdateChargebackStatus_ResolvedDisputeIsFinal() {
+	// Arrange
+	ctx := context.Background()
+	chargebackID := uuid.New()
+
+	s.paymentRepo.On("GetChargebackByID", ctx, chargebackID).Return(&Chargeback{Status: DisputeStatusWon}, nil)
+
+	// Act
+	result, err := s.service.UpdateChargebackStatus(ctx, chargebackID, DisputeStatusLost)
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidDisputeStatus)
+	s.Nil(result)
+}
+
+func TestPlanRelease_TakesFromMostRecentApplicationFirst(t *testing.T) {
+	first, second := uuid.New(), uuid.New()
+	payment := Payment{
+		Amount: usd("100.00"),
+		Applications: []PaymentApplication{
+			{InvoiceID: &first, Amount: usd("50.00")},
+			{InvoiceID: &second, Amount: usd("30.00")},
+		},
+	}
+
+	reversals, err := payment.planRelease(usd("60.00"))
+
+	require.NoError(t, err)
+	require.Len(t, reversals, 2)
+	assert.Equal(t, &second, reversals[0].Application.InvoiceID)
+	assert.Equal(t, usd("30.00"), reversals[0].Amount)
+	assert.Equal(t, &first, reversals[1].Application.InvoiceID)
+	assert.Equal(t, usd("10.00"), reversals[1].Amount)
+}
+
+func TestPlanRelease_UsesUnappliedAmountFirst(t *testing.T) {
+	invoiceID := uuid.New()
+	payment := Payment{Amount: usd("100.00"), Applications: []PaymentApplication{{InvoiceID: &invoiceID, Amount: usd("70.00")}}}
+
+	reversals, err := payment.planRelease(usd("30.00"))
+
+	require.NoError(t, err)
+	assert.Empty(t, reversals)
+}
+
+func TestReconcilePayment(t *testing.T) {
+	invoiceID := uuid.New()
+	payment := Payment{
+		Status:         PaymentStatusCompleted,
+		Amount:         usd("100.00"),
+		RefundedAmount: usd("30.00"),
+		DisputedAmount: usd("20.00"),
+		Applications:   []PaymentApplication{{InvoiceID: &invoiceID, Amount: usd("40.00")}},
+	}
+	payment.ID = uuid.New()
+	entry := func(entryType LedgerEntryType, amount string) *LedgerEntry {
+		e := newLedgerEntry(payment.ID, entryType, usd(amount), payment.PaymentDate)
+		return &e
+	}
+	entries := []*LedgerEntry{
+		entry(LedgerEntryPaymentReceived, "100.00"),
+		entry(LedgerEntryPaymentApplied, "60.00"),
+		entry(LedgerEntryApplicationReversed, "20.00"),
+		entry(LedgerEntryRefund, "30.00"),
+		entry(LedgerEntryChargeback, "20.00"),
+	}
+
+	result, err := reconcilePayment(payment, entries)
+
+	require.NoError(t, err)
+	assert.True(t, result.Reconciled)
+	assert.Equal(t, usd("50.00"), result.Ledger[LedgerAccountCash])
+	assert.Equal(t, usd("-30.00"), result.Ledger[LedgerAccountCustomerCredit])
+	assert.Equal(t, usd("-40.00"), result.Ledger[LedgerAccountReceivables])
+
+	missing, err := reconcilePayment(payment, entries[:4])
+
+	require.NoError(t, err)
+	assert.False(t, missing.Reconciled)
+}
@@ -1 +1,861 @@
-package billing
\ No newline at end of file
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+)
+
+type ProductService interface {
+	ProductManager
+}
+
+type PriceBookService interface {
+	PriceBookManager
+	PriceResolver
+}
+
+type ProductRepository interface {
+	ProductManager
+}
+
+type PriceBookRepository interface {
+	PriceBookManager
+	EffectivePriceLister
+}
+
+type productService struct {
+	repo ProductRepository
+}
+
+type priceBookService struct {
+	repo      PriceBookRepository
+	products  ProductRetriever
+	customers customers.CustomerRetriever
+	rates     CurrencyConverter
+}
+
+type PriceBookServiceOption func(*priceBookService)
+
+// WithPriceConversion converts resolved prices into the customer's currency
+// at the rates of the pricing date. Without it, pricing for a customer whose
+// currency is not the base currency fails with ErrNoExchangeRate.
+func WithPriceConversion(rates CurrencyConverter) PriceBookServiceOption {
+	return func(s *priceBookService) {
+		s.rates = rates
+	}
+}
+
+func NewProductService(repo ProductRepository) ProductService {
+	return &productService{repo: repo}
+}
+
+func NewPriceBookService(repo PriceBookRepository, products ProductRetriever, customers customers.CustomerRetriever, opts ...PriceBookServiceOption) PriceBookService {
+	s := &priceBookService{repo: repo, products: products, customers: customers}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+type ProductManager interface {
+	ProductReader
+	ProductWriter
+}
+
+type ProductReader interface {
+	ProductRetriever
+	ProductSKURetriever
+	ProductLister
+}
+
+type ProductWriter interface {
+	ProductCreator
+	ProductUpdater
+	ProductDeleter
+}
+
+type ProductRetriever interface {
+	GetProductByID(ctx context.Context, id uuid.UUID) (*Product, error)
+}
+
+type ProductSKURetriever interface {
+	GetProductBySKU(ctx context.Context, sku string) (*Product, error)
+}
+
+type ProductLister interface {
+	ListProducts(ctx context.Context) ([]*Product, error)
+}
+
+type ProductCreator interface {
+	CreateProduct(ctx context.Context, product Product) (*Product, error)
+}
+
+type ProductUpdater interface {
+	UpdateProduct(ctx context.Context, product Product) (*Product, error)
+}
+
+type ProductDeleter interface {
+	DeleteProduct(ctx context.Context, id uuid.UUID) error
+}
+
+type PriceBookManager interface {
+	PriceBookReader
+	PriceBookWriter
+	PriceBookEntryWriter
+}
+
+type PriceBookReader interface {
+	PriceBookRetriever
+	PriceBookLister
+}
+
+type PriceBookWriter interface {
+	PriceBookCreator
+	PriceBookUpdater
+	PriceBookDeleter
+}
+
+type PriceBookRetriever interface {
+	GetPriceBookByID(ctx context.Context, id uuid.UUID) (*PriceBook, error)
+}
+
+type PriceBookLister interface {
+	ListPriceBooks(ctx context.Context) ([]*PriceBook, error)
+}
+
+type PriceBookCreator interface {
+	CreatePriceBook(ctx context.Context, book PriceBook) (*PriceBook, error)
+}
+
+type PriceBookUpdater interface {
+	UpdatePriceBook(ctx context.Context, book PriceBook) (*PriceBook, error)
+}
+
+type PriceBookDeleter interface {
+	DeletePriceBook(ctx context.Context, id uuid.UUID) error
+}
+
+type PriceBookEntryWriter interface {
+	AddPriceBookEntry(ctx context.Context, entry PriceBookEntry) (*PriceBookEntry, error)
+	DeletePriceBookEntry(ctx context.Context, id uuid.UUID) error
+}
+
+type EffectivePriceLister interface {
+	GetEffectivePrices(ctx context.Context, productID uuid.UUID, on time.Time) ([]EffectivePrice, error)
+}
+
+type PriceResolver interface {
+	ResolvePrice(ctx context.Context, customerID, productID uuid.UUID, on time.Time) (*ResolvedPrice, error)
+}
+
+func (s *productService) GetProductByID(ctx context.Context, id uuid.UUID) (*Product, error) {
+	return s.repo.GetProductByID(ctx, id)
+}
+
+func (s *productService) GetProductBySKU(ctx context.Context, sku string) (*Product, error) {
+	return s.repo.GetProductBySKU(ctx, normalizeSKU(sku))
+}
+
+func (s *productService) ListProducts(ctx context.Context) ([]*Product, error) {
+	return s.repo.ListProducts(ctx)
+}
+
+func (s *productService) CreateProduct(ctx context.Context, product Product) (*Product, error) {
+	product.SKU = normalizeSKU(product.SKU)
+	if product.SKU == "" || strings.TrimSpace(product.Name) == "" {
+		return nil, ErrInvalidProduct
+	}
+	if product.Status == "" {
+		product.Status = ProductStatusActive
+	}
+	if product.TaxCategory == "" {
+		product.TaxCategory = TaxCategoryGeneral
+	}
+	if !product.TaxCategory.Valid() {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTaxCategory, product.TaxCategory)
+	}
+	if product.LowStockAlert < 0 {
+		return nil, fmt.Errorf("%w: low stock alert cannot be negative", ErrInvalidProduct)
+	}
+	if err := s.ensureSKUAvailable(ctx, product.SKU, uuid.Nil); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateProduct(ctx, product)
+}
+
+func (s *productService) UpdateProduct(ctx context.Context, product Product) (*Product, error) {
+	product.SKU = normalizeSKU(product.SKU)
+	if product.SKU == "" || strings.TrimSpace(product.Name) == "" {
+		return nil, ErrInvalidProduct
+	}
+	if product.TaxCategory == "" {
+		product.TaxCategory = TaxCategoryGeneral
+	}
+	if !product.TaxCategory.Valid() {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTaxCategory, product.TaxCategory)
+	}
+	if product.LowStockAlert < 0 {
+		return nil, fmt.Errorf("%w: low stock alert cannot be negative", ErrInvalidProduct)
+	}
+	if err := s.ensureSKUAvailable(ctx, product.SKU, product.ID); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateProduct(ctx, product)
+}
+
+func (s *productService) DeleteProduct(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteProduct(ctx, id)
+}
+
+// ensureSKUAvailable fails when the SKU belongs to a product other than self.
+// The unique index on products.sku remains the final guard against races.
+func (s *productService) ensureSKUAvailable(ctx context.Context, sku string, self uuid.UUID) error {
+	existing, err := s.repo.GetProductBySKU(ctx, sku)
+	if errors.Is(err, ErrProductNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing.ID != self {
+		return ErrDuplicateSKU
+	}
+	return nil
+}
+
+func normalizeSKU(sku string) string {
+	return strings.ToUpper(strings.TrimSpace(sku))
+}
+
+func (s *priceBookService) GetPriceBookByID(ctx context.Context, id uuid.UUID) (*PriceBook, error) {
+	return s.repo.GetPriceBookByID(ctx, id)
+}
+
+func (s *priceBookService) ListPriceBooks(ctx context.Context) ([]*PriceBook, error) {
+	return s.repo.ListPriceBooks(ctx)
+}
+
+func (s *priceBookService) CreatePriceBook(ctx context.Context, book PriceBook) (*PriceBook, error) {
+	if err := validatePriceBook(book); err != nil {
+		return nil, err
+	}
+	return s.repo.CreatePriceBook(ctx, book)
+}
+
+func (s *priceBookService) UpdatePriceBook(ctx context.Context, book PriceBook) (*PriceBook, error) {
+	if err := validatePriceBook(book); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdatePriceBook(ctx, book)
+}
+
+func (s *priceBookService) DeletePriceBook(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeletePriceBook(ctx, id)
+}
+
+func (s *priceBookService) AddPriceBookEntry(ctx context.Context, entry PriceBookEntry) (*PriceBookEntry, error) {
+	entry.EffectiveFrom = dateOnly(entry.EffectiveFrom)
+	if entry.EffectiveTo != nil {
+		to := dateOnly(*entry.EffectiveTo)
+		entry.EffectiveTo = &to
+	}
+	if entry.Price.IsNegative() || entry.EffectiveFrom.IsZero() || (entry.EffectiveTo != nil && !entry.EffectiveTo.After(entry.EffectiveFrom)) {
+		return nil, ErrInvalidPriceEntry
+	}
+
+	book, err := s.repo.GetPriceBookByID(ctx, entry.PriceBookID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.products.GetProductByID(ctx, entry.ProductID); err != nil {
+		return nil, err
+	}
+	for _, existing := range book.Entries {
+		if existing.ProductID == entry.ProductID && entriesOverlap(existing, entry) {
+			return nil, fmt.Errorf("%w: overlaps entry %s", ErrInvalidPriceEntry, existing.ID)
+		}
+	}
+	return s.repo.AddPriceBookEntry(ctx, entry)
+}
+
+func (s *priceBookService) DeletePriceBookEntry(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeletePriceBookEntry(ctx, id)
+}
+
+// ResolvePrice picks the price a customer pays for a product on a date. A
+// customer-specific price book beats a tier price book, which beats the list
+// price; within one level the most recently effective entry wins. The price
+// is then converted to the customer's currency.
+func (s *priceBookService) ResolvePrice(ctx context.Context, customerID, productID uuid.UUID, on time.Time) (*ResolvedPrice, error) {
+	on = dateOnly(on)
+
+	product, err := s.products.GetProductByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if product.Status == ProductStatusDiscontinued {
+		return nil, ErrProductUnavailable
+	}
+	customer, err := s.customers.GetCustomerByID(ctx, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+	candidates, err := s.repo.GetEffectivePrices(ctx, productID, on)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := &ResolvedPrice{
+		CustomerID: customerID,
+		ProductID:  productID,
+		Date:       on,
+		Price:      product.Price,
+		Source:     PriceSourceList,
+	}
+
+	var customerPrices, tierPrices []EffectivePrice
+	for _, c := range candidates {
+		if !c.Covers(on) {
+			continue
+		}
+		switch {
+		case c.CustomerID != nil && *c.CustomerID == customerID:
+			customerPrices = append(customerPrices, c)
+		case c.PricingTier != nil && customer.PricingTier != "" && *c.PricingTier == customer.PricingTier:
+			tierPrices = append(tierPrices, c)
+		}
+	}
+
+	if best, ok := latestEffective(customerPrices); ok {
+		resolved.Price, resolved.Source, resolved.PriceBookID = best.Price, PriceSourceCustomer, &best.PriceBookID
+	} else if best, ok := latestEffective(tierPrices); ok {
+		resolved.Price, resolved.Source, resolved.PriceBookID = best.Price, PriceSourceTier, &best.PriceBookID
+	}
+
+	currency := customer.Currency
+	if currency == "" {
+		currency = BaseCurrency
+	}
+	if currencyOf(resolved.Price) != currency {
+		if s.rates == nil {
+			return nil, fmt.Errorf("%w: prices are not converted to %s", ErrNoExchangeRate, currency)
+		}
+		listed := resolved.Price
+		if resolved.Price, err = s.rates.Convert(listed, currency, on); err != nil {
+			return nil, err
+		}
+		resolved.ListedPrice = &listed
+	}
+	return resolved, nil
+}
+
+func validatePriceBook(book PriceBook) error {
+	if strings.TrimSpace(book.Name) == "" {
+		return ErrInvalidPriceBook
+	}
+	hasCustomer := book.CustomerID != nil && *book.CustomerID != uuid.Nil
+	hasTier := book.PricingTier != nil && strings.TrimSpace(*book.PricingTier) != ""
+	if hasCustomer == hasTier {
+		return ErrInvalidPriceBook
+	}
+	return nil
+}
+
+func latestEffective(prices []EffectivePrice) (EffectivePrice, bool) {
+	if len(prices) == 0 {
+		return EffectivePrice{}, false
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].EffectiveFrom.After(prices[j].EffectiveFrom)
+	})
+	return prices[0], true
+}
+
+func entriesOverlap(a, b PriceBookEntry) bool {
+	aEndsBeforeB := a.EffectiveTo != nil && !a.EffectiveTo.After(b.EffectiveFrom)
+	bEndsBeforeA := b.EffectiveTo != nil && !b.EffectiveTo.After(a.EffectiveFrom)
+	return !aEndsBeforeB && !bEndsBeforeA
+}
+
+// dateOnly truncates t to midnight UTC of its calendar day, matching the
+// DATE columns prices are stored against.
+func dateOnly(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+type OrderService interface {
+	OrderManager
+	OrderStatusTransitioner
+	OrderQuoter
+}
+
+type OrderRepository interface {
+	OrderManager
+	OrderStatusUpdater
+}
+
+// TaxableLine is what a TaxCalculator needs to know about one order or
+// invoice line.
+type TaxableLine struct {
+	CustomerID uuid.UUID
+	ProductID  *uuid.UUID // Nil for free-form invoice lines
+	AddressID  *uuid.UUID // Shipping address if known, otherwise billing
+	Date       time.Time
+	Amount     core.Money // Line amount after discounts
+}
+
+// TaxCalculator returns the tax owed on one line.
+type TaxCalculator interface {
+	LineTax(ctx context.Context, line TaxableLine) (core.Money, error)
+}
+
+type orderService struct {
+	repo      OrderRepository
+	products  ProductRetriever
+	prices    PriceResolver
+	addresses customers.AddressRetriever
+	tax       TaxCalculator
+	events    core.EventPublisher
+	discounts DiscountSource
+	customers customers.CustomerRetriever
+	balances  CustomerBalanceReader
+	rates     CurrencyConverter
+	now       func() time.Time
+}
+
+// OrderServiceOption configures optional collaborators of the order service.
+type OrderServiceOption func(*orderService)
+
+// WithTaxCalculator sets how line tax is computed. Without it orders carry
+// no tax.
+func WithTaxCalculator(tax TaxCalculator) OrderServiceOption {
+	return func(s *orderService) {
+		s.tax = tax
+	}
+}
+
+// WithEventPublisher publishes an OrderStatusChanged event after every
+// status transition.
+func WithEventPublisher(events core.EventPublisher) OrderServiceOption {
+	return func(s *orderService) {
+		s.events = events
+	}
+}
+
+func NewOrderService(repo OrderRepository, products ProductRetriever, prices PriceResolver, addresses customers.AddressRetriever, opts ...OrderServiceOption) OrderService {
+	s := &orderService{
+		repo:      repo,
+		products:  products,
+		prices:    prices,
+		addresses: addresses,
+		tax:       noTax{},
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+type OrderManager interface {
+	OrderReader
+	OrderWriter
+}
+
+type OrderReader interface {
+	OrderRetriever
+	OrderLister
+}
+
+type OrderWriter interface {
+	OrderCreator
+	OrderUpdater
+	OrderDeleter
+}
+
+type OrderRetriever interface {
+	GetOrderByID(ctx context.Context, id uuid.UUID) (*Order, error)
+}
+
+type OrderLister interface {
+	GetOrdersByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Order, error)
+}
+
+// OrderCreator persists an order, its items and any credit override in one
+// transaction, assigning the next OrderNumber.
+type OrderCreator interface {
+	CreateOrder(ctx context.Context, order Order) (*Order, error)
+}
+
+// OrderUpdater replaces an order's header and items in one transaction,
+// recording any new credit override alongside.
+type OrderUpdater interface {
+	UpdateOrder(ctx context.Context, order Order) (*Order, error)
+}
+
+// OrderDeleter deletes a pending order, returning ErrOrderLocked once it has
+// moved on.
+type OrderDeleter interface {
+	DeleteOrder(ctx context.Context, id uuid.UUID) error
+}
+
+type OrderStatusTransitioner interface {
+	TransitionOrder(ctx context.Context, id uuid.UUID, to OrderStatus) (*Order, error)
+}
+
+// OrderStatusUpdater writes a new status and its dates, but only if the order
+// is still in status from, returning ErrOrderStatusConflict otherwise. In
+// the same transaction it reserves the stock of an order being confirmed,
+// failing with ErrInsufficientStock, and releases or ships the reservations
+// of one being cancelled or shipped, returning the movements on the order.
+type OrderStatusUpdater interface {
+	UpdateOrderStatus(ctx context.Context, order Order, from OrderStatus) (*Order, error)
+}
+
+// GetOrderByID loads the order with its items and payments, then attaches
+// the billing and shipping addresses.
+func (s *orderService) GetOrderByID(ctx context.Context, id uuid.UUID) (*Order, error) {
+	order, err := s.repo.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order.BillingAddressID != nil {
+		if order.BillingAddress, err = s.addresses.GetAddressByID(ctx, *order.BillingAddressID); err != nil {
+			return nil, fmt.Errorf("failed to load billing address: %w", err)
+		}
+	}
+	if order.ShippingAddressID != nil {
+		if order.ShippingAddress, err = s.addresses.GetAddressByID(ctx, *order.ShippingAddressID); err != nil {
+			return nil, fmt.Errorf("failed to load shipping address: %w", err)
+		}
+	}
+	return order, nil
+}
+
+func (s *orderService) GetOrdersByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Order, error) {
+	return s.repo.GetOrdersByCustomerID(ctx, customerID)
+}
+
+func (s *orderService) CreateOrder(ctx context.Context, order Order) (*Order, error) {
+	order.OrderNumber = ""
+	order.Status = OrderStatusPending
+	order.ShippedDate, order.DeliveredDate = nil, nil
+	order.QuoteID = nil
+	if order.OrderDate.IsZero() {
+		order.OrderDate = s.now()
+	}
+	order.CouponCodes = normalizeCouponCodes(order.CouponCodes)
+	if err := s.priceOrder(ctx, &order, true); err != nil {
+		return nil, err
+	}
+	if err := s.checkCredit(ctx, &order, nil); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateOrder(ctx, order)
+}
+
+func (s *orderService) UpdateOrder(ctx context.Context, order Order) (*Order, error) {
+	existing, err := s.repo.GetOrderByID(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Status != OrderStatusPending {
+		return nil, ErrOrderLocked
+	}
+	order.OrderNumber = existing.OrderNumber
+	order.CustomerID = existing.CustomerID
+	order.Status = existing.Status
+	order.ShippedDate, order.DeliveredDate = existing.ShippedDate, existing.DeliveredDate
+	if order.OrderDate.IsZero() {
+		order.OrderDate = existing.OrderDate
+	}
+	order.CouponCodes = existing.CouponCodes
+	order.QuoteID = existing.QuoteID
+	order.AmountPaid = existing.AmountPaid
+	if order.QuoteID != nil {
+		// An order from an accepted quote keeps the quoted lines and amounts.
+		if err := keepQuotedLines(&order, existing); err != nil {
+			return nil, err
+		}
+		order.CreditOverride = nil
+		return s.repo.UpdateOrder(ctx, order)
+	}
+	if err := s.priceOrder(ctx, &order, false); err != nil {
+		return nil, err
+	}
+	if err := coverAmountPaid(order); err != nil {
+		return nil, err
+	}
+	if err := s.checkCredit(ctx, &order, existing); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateOrder(ctx, order)
+}
+
+// coverAmountPaid refuses an edit that would leave the order owing less than
+// it has already taken, or in a currency other than the one it was paid in.
+func coverAmountPaid(order Order) error {
+	if !order.AmountPaid.IsPositive() {
+		return nil
+	}
+	cmp, err := order.Total.Cmp(order.AmountPaid)
+	if err != nil {
+		return fmt.Errorf("%w: the currency of an order that has taken payments cannot be changed", ErrInvalidOrder)
+	}
+	if cmp < 0 {
+		return fmt.Errorf("%w: total %s is less than the %s already paid", ErrInvalidOrder, order.Total, order.AmountPaid)
+	}
+	return nil
+}
+
+// keepQuotedLines restores the stored lines and totals of an order placed
+// from a quote. Sending the lines back unchanged, or not at all, is fine;
+// changing a product or quantity is not.
+func keepQuotedLines(order *Order, existing *Order) error {
+	if len(order.OrderItems) > 0 {
+		if len(order.OrderItems) != len(existing.OrderItems) {
+			return fmt.Errorf("%w: the lines of an order placed from a quote cannot be changed", ErrInvalidOrder)
+		}
+		for i, item := range order.OrderItems {
+			if item.ProductID != existing.OrderItems[i].ProductID || item.Quantity != existing.OrderItems[i].Quantity {
+				return fmt.Errorf("%w: the lines of an order placed from a quote cannot be changed", ErrInvalidOrder)
+			}
+		}
+	}
+	order.OrderItems, order.Currency = existing.OrderItems, existing.Currency
+	order.SubTotal, order.Discount, order.TaxAmount, order.Total = existing.SubTotal, existing.Discount, existing.TaxAmount, existing.Total
+	return nil
+}
+
+// DeleteOrder deletes a pending order that has taken no payments. Anything
+// further along is referenced by payments and the ledger and must be
+// cancelled instead.
+func (s *orderService) DeleteOrder(ctx context.Context, id uuid.UUID) error {
+	order, err := s.repo.GetOrderByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if order.Status != OrderStatusPending || order.AmountPaid.IsPositive() || len(order.Payments) > 0 {
+		return ErrOrderLocked
+	}
+	return s.repo.DeleteOrder(ctx, id)
+}
+
+// TransitionOrder moves an order along the status workflow, stamping the
+// shipped and delivered dates, then publishes OrderStatusChanged and a
+// ProductStockLow for each product it took to or below its threshold.
+func (s *orderService) TransitionOrder(ctx context.Context, id uuid.UUID, to OrderStatus) (*Order, error) {
+	order, err := s.repo.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	from := order.Status
+	if !from.CanTransitionTo(to) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+	}
+	if to == OrderStatusCancelled {
+		captured, err := order.CapturedAmount()
+		if err != nil {
+			return nil, err
+		}
+		if captured.IsPositive() || order.AmountPaid.IsPositive() {
+			return nil, ErrPaymentsCaptured
+		}
+	}
+
+	now := s.now()
+	order.Status = to
+	switch to {
+	case OrderStatusShipped:
+		order.ShippedDate = &now
+	case OrderStatusDelivered:
+		order.DeliveredDate = &now
+	}
+
+	updated, err := s.repo.UpdateOrderStatus(ctx, *order, from)
+	if err != nil {
+		return nil, err
+	}
+	updated.OrderItems, updated.Payments = order.OrderItems, order.Payments
+
+	if s.events != nil {
+		event := OrderStatusChanged{
+			OrderID:     updated.ID,
+			OrderNumber: updated.OrderNumber,
+			CustomerID:  updated.CustomerID,
+			From:        from,
+			To:          to,
+			ChangedAt:   now,
+		}
+		// The transition is already committed, so subscriber failures are
+		// logged rather than reported to the caller.
+		if err := s.events.Publish(ctx, event); err != nil {
+			slog.ErrorContext(ctx, "order status subscriber failed", "order_id", updated.ID, "event", event.EventName(), "error", err)
+		}
+		for _, alert := range stockLowEvents(updated.StockMovements) {
+			if err := s.events.Publish(ctx, alert); err != nil {
+				slog.ErrorContext(ctx, "low stock subscriber failed", "order_id", updated.ID, "product_id", alert.ProductID, "error", err)
+			}
+		}
+	}
+	return updated, nil
+}
+
+// priceOrder fills every server-side amount on the order: unit prices from
+// the catalog, discounts, line totals, tax and the order totals. redeeming
+// is set when the order's coupons are being redeemed rather than reapplied.
+func (s *orderService) priceOrder(ctx context.Context, order *Order, redeeming bool) error {
+	if order.CustomerID == uuid.Nil {
+		return fmt.Errorf("%w: customer is required", ErrInvalidOrder)
+	}
+	if len(order.OrderItems) == 0 {
+		return fmt.Errorf("%w: at least one item is required", ErrInvalidOrder)
+	}
+
+	for i := range order.OrderItems {
+		item := &order.OrderItems[i]
+		if item.Quantity <= 0 {
+			return fmt.Errorf("%w: item %d quantity must be positive", ErrInvalidOrder, i+1)
+		}
+		product, err := s.products.GetProductByID(ctx, item.ProductID)
+		if err != nil {
+			return err
+		}
+		price, err := s.prices.ResolvePrice(ctx, order.CustomerID, item.ProductID, order.OrderDate)
+		if err != nil {
+			return err
+		}
+		item.UnitPrice = price.Price
+		if item.Description == "" {
+			item.Description = product.Name
+		}
+	}
+
+	if err := s.applyOrderDiscounts(ctx, order, redeeming); err != nil {
+		return err
+	}
+	if err := computeLineTotals(order); err != nil {
+		return err
+	}
+	for i := range order.OrderItems {
+		item := &order.OrderItems[i]
+		tax, err := s.tax.LineTax(ctx, TaxableLine{
+			CustomerID: order.CustomerID,
+			ProductID:  &item.ProductID,
+			AddressID:  taxAddress(order.ShippingAddressID, order.BillingAddressID),
+			Date:       order.OrderDate,
+			Amount:     item.Total,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to calculate tax: %w", err)
+		}
+		item.TaxAmount = tax
+	}
+	return computeOrderTotals(order)
+}
+
+// computeLineTotals sets each item's Total to UnitPrice × Quantity less its
+// discount, rejecting discounts that are negative or exceed the line.
+func computeLineTotals(order *Order) error {
+	for i := range order.OrderItems {
+		item := &order.OrderItems[i]
+		total, err := lineTotal(ErrInvalidOrder, i+1, item.UnitPrice, item.Quantity, item.Discount)
+		if err != nil {
+			return err
+		}
+		item.Total = total
+	}
+	return nil
+}
+
+// computeOrderTotals rolls line amounts up into SubTotal, Discount,
+// TaxAmount and Total.
+func computeOrderTotals(order *Order) error {
+	var totals documentTotals
+	for _, item := range order.OrderItems {
+		if err := totals.addLine(item.UnitPrice, item.Quantity, item.Discount, item.TaxAmount); err != nil {
+			return err
+		}
+	}
+	total, err := totals.total()
+	if err != nil {
+		return err
+	}
+	order.SubTotal, order.Discount, order.TaxAmount, order.Total = totals.subTotal, totals.discount, totals.tax, total
+	order.Currency = currencyOf(total)
+	return nil
+}
+
+// lineTotal returns unit × quantity less discount. Validation failures wrap
+// invalid and name the 1-based line number.
+func lineTotal(invalid error, line int, unit core.Money, quantity int, discount core.Money) (core.Money, error) {
+	gross, err := unit.Times(int64(quantity))
+	if err != nil {
+		return core.Money{}, err
+	}
+	if discount.IsNegative() {
+		return core.Money{}, fmt.Errorf("%w: item %d discount is negative", invalid, line)
+	}
+	if cmp, err := discount.Cmp(gross); err != nil {
+		return core.Money{}, err
+	} else if cmp > 0 {
+		return core.Money{}, fmt.Errorf("%w: item %d discount exceeds the line amount", invalid, line)
+	}
+	return gross.Sub(discount)
+}
+
+// documentTotals accumulates line amounts into the header totals shared by
+// orders and invoices.
+type documentTotals struct {
+	subTotal, discount, tax core.Money
+}
+
+func (t *documentTotals) addLine(unit core.Money, quantity int, discount, tax core.Money) error {
+	gross, err := unit.Times(int64(quantity))
+	if err != nil {
+		return err
+	}
+	if t.subTotal, err = t.subTotal.Add(gross); err != nil {
+		return err
+	}
+	if t.discount, err = t.discount.Add(discount); err != nil {
+		return err
+	}
+	t.tax, err = t.tax.Add(tax)
+	return err
+}
+
+// total is subTotal - discount + tax.
+func (t documentTotals) total() (core.Money, error) {
+	total, err := t.subTotal.Sub(t.discount)
+	if err != nil {
+		return core.Money{}, err
+	}
+	return total.Add(t.tax)
+}
+
+// taxAddress picks the address tax is sourced to: shipping if there is one,
+// otherwise billing.
+func taxAddress(shipping, billing *uuid.UUID) *uuid.UUID {
+	if shipping != nil {
+		return shipping
+	}
+	return billing
+}
+
+type noTax struct{}
+
+func (noTax) LineTax(ctx context.Context, line TaxableLine) (core.Money, error) {
+	return core.Zero(line.Amount.Currency()), nil
+}
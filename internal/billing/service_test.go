@@ -0,0 +1,708 @@
+package billing
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockProductRepository struct {
+	mock.Mock
+}
+
+func (m *MockProductRepository) GetProductByID(ctx context.Context, id uuid.UUID) (*Product, error) {
+	args := m.Called(ctx, id)
+	product, _ := args.Get(0).(*Product)
+	return product, args.Error(1)
+}
+
+func (m *MockProductRepository) GetProductBySKU(ctx context.Context, sku string) (*Product, error) {
+	args := m.Called(ctx, sku)
+	product, _ := args.Get(0).(*Product)
+	return product, args.Error(1)
+}
+
+func (m *MockProductRepository) ListProducts(ctx context.Context) ([]*Product, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]*Product), args.Error(1)
+}
+
+func (m *MockProductRepository) CreateProduct(ctx context.Context, product Product) (*Product, error) {
+	args := m.Called(ctx, product)
+	created, _ := args.Get(0).(*Product)
+	return created, args.Error(1)
+}
+
+func (m *MockProductRepository) UpdateProduct(ctx context.Context, product Product) (*Product, error) {
+	args := m.Called(ctx, product)
+	updated, _ := args.Get(0).(*Product)
+	return updated, args.Error(1)
+}
+
+func (m *MockProductRepository) DeleteProduct(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+type MockPriceBookRepository struct {
+	mock.Mock
+}
+
+func (m *MockPriceBookRepository) GetPriceBookByID(ctx context.Context, id uuid.UUID) (*PriceBook, error) {
+	args := m.Called(ctx, id)
+	book, _ := args.Get(0).(*PriceBook)
+	return book, args.Error(1)
+}
+
+func (m *MockPriceBookRepository) ListPriceBooks(ctx context.Context) ([]*PriceBook, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]*PriceBook), args.Error(1)
+}
+
+func (m *MockPriceBookRepository) CreatePriceBook(ctx context.Context, book PriceBook) (*PriceBook, error) {
+	args := m.Called(ctx, book)
+	created, _ := args.Get(0).(*PriceBook)
+	return created, args.Error(1)
+}
+
+func (m *MockPriceBookRepository) UpdatePriceBook(ctx context.Context, book PriceBook) (*PriceBook, error) {
+	args := m.Called(ctx, book)
+	updated, _ := args.Get(0).(*PriceBook)
+	return updated, args.Error(1)
+}
+
+func (m *MockPriceBookRepository) DeletePriceBook(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockPriceBookRepository) AddPriceBookEntry(ctx context.Context, entry PriceBookEntry) (*PriceBookEntry, error) {
+	args := m.Called(ctx, entry)
+	created, _ := args.Get(0).(*PriceBookEntry)
+	return created, args.Error(1)
+}
+
+func (m *MockPriceBookRepository) DeletePriceBookEntry(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockPriceBookRepository) GetEffectivePrices(ctx context.Context, productID uuid.UUID, on time.Time) ([]EffectivePrice, error) {
+	args := m.Called(ctx, productID, on)
+	return args.Get(0).([]EffectivePrice), args.Error(1)
+}
+
+type MockCustomerRetriever struct {
+	mock.Mock
+}
+
+func (m *MockCustomerRetriever) GetCustomerByID(ctx context.Context, id uuid.UUID) (customers.Customer, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(customers.Customer), args.Error(1)
+}
+
+type CatalogServiceTestSuite struct {
+	suite.Suite
+	productRepo   *MockProductRepository
+	priceBookRepo *MockPriceBookRepository
+	customerRepo  *MockCustomerRetriever
+	products      ProductService
+	priceBooks    PriceBookService
+}
+
+func (s *CatalogServiceTestSuite) SetupTest() {
+	s.productRepo = new(MockProductRepository)
+	s.priceBookRepo = new(MockPriceBookRepository)
+	s.customerRepo = new(MockCustomerRetriever)
+	s.products = NewProductService(s.productRepo)
+	s.priceBooks = NewPriceBookService(s.priceBookRepo, s.productRepo, s.customerRepo)
+}
+
+func (s *CatalogServiceTestSuite) TearDownTest() {
+	s.productRepo.AssertExpectations(s.T())
+	s.priceBookRepo.AssertExpectations(s.T())
+	s.customerRepo.AssertExpectations(s.T())
+}
+
+func TestCatalogServiceSuite(t *testing.T) {
+	suite.Run(t, new(CatalogServiceTestSuite))
+}
+
+func (s *CatalogServiceTestSuite) TestCreateProduct_NormalizesSKUAndDefaultsStatus() {
+	// Arrange
+	ctx := context.Background()
+	input := Product{SKU: " ent-llc ", Name: "LLC Formation", Price: core.MustParseMoney("750.00", core.USD)}
+	expected := Product{SKU: "ENT-LLC", Name: "LLC Formation", Price: core.MustParseMoney("750.00", core.USD), Status: ProductStatusActive, TaxCategory: TaxCategoryGeneral}
+
+	s.productRepo.On("GetProductBySKU", ctx, "ENT-LLC").Return(nil, ErrProductNotFound)
+	s.productRepo.On("CreateProduct", ctx, expected).Return(&expected, nil)
+
+	// Act
+	result, err := s.products.CreateProduct(ctx, input)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(&expected, result)
+}
+
+func (s *CatalogServiceTestSuite) TestCreateProduct_DuplicateSKU() {
+	// Arrange
+	ctx := context.Background()
+	existing := &Product{BaseModel: core.BaseModel{ID: uuid.New()}, SKU: "ENT-LLC"}
+
+	s.productRepo.On("GetProductBySKU", ctx, "ENT-LLC").Return(existing, nil)
+
+	// Act
+	result, err := s.products.CreateProduct(ctx, Product{SKU: "ENT-LLC", Name: "LLC Formation"})
+
+	// Assert
+	s.ErrorIs(err, ErrDuplicateSKU)
+	s.Nil(result)
+}
+
+func (s *CatalogServiceTestSuite) TestResolvePrice_CustomerBookBeatsTierBook() {
+	// Arrange
+	ctx := context.Background()
+	customerID, productID := uuid.New(), uuid.New()
+	customerBook, tierBook := uuid.New(), uuid.New()
+	tier := "gold"
+	on := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	s.productRepo.On("GetProductByID", ctx, productID).Return(&Product{Price: core.MustParseMoney("1000.00", core.USD), Status: ProductStatusActive}, nil)
+	s.customerRepo.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{PricingTier: tier}, nil)
+	s.priceBookRepo.On("GetEffectivePrices", ctx, productID, on).Return([]EffectivePrice{
+		{PriceBookEntry: PriceBookEntry{PriceBookID: tierBook, Price: core.MustParseMoney("900.00", core.USD), EffectiveFrom: on.AddDate(0, -1, 0)}, PricingTier: &tier},
+		{PriceBookEntry: PriceBookEntry{PriceBookID: customerBook, Price: core.MustParseMoney("850.00", core.USD), EffectiveFrom: on.AddDate(0, -6, 0)}, CustomerID: &customerID},
+	}, nil)
+
+	// Act
+	result, err := s.priceBooks.ResolvePrice(ctx, customerID, productID, on)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(core.MustParseMoney("850.00", core.USD), result.Price)
+	s.Equal(PriceSourceCustomer, result.Source)
+	s.Equal(&customerBook, result.PriceBookID)
+}
+
+func (s *CatalogServiceTestSuite) TestResolvePrice_LatestTierEntryWins() {
+	// Arrange
+	ctx := context.Background()
+	customerID, productID := uuid.New(), uuid.New()
+	tier := "gold"
+	on := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	s.productRepo.On("GetProductByID", ctx, productID).Return(&Product{Price: core.MustParseMoney("1000.00", core.USD), Status: ProductStatusActive}, nil)
+	s.customerRepo.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{PricingTier: tier}, nil)
+	s.priceBookRepo.On("GetEffectivePrices", ctx, productID, on).Return([]EffectivePrice{
+		{PriceBookEntry: PriceBookEntry{Price: core.MustParseMoney("950.00", core.USD), EffectiveFrom: on.AddDate(-1, 0, 0)}, PricingTier: &tier},
+		{PriceBookEntry: PriceBookEntry{Price: core.MustParseMoney("920.00", core.USD), EffectiveFrom: on.AddDate(0, -1, 0)}, PricingTier: &tier},
+	}, nil)
+
+	// Act
+	result, err := s.priceBooks.ResolvePrice(ctx, customerID, productID, on)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(core.MustParseMoney("920.00", core.USD), result.Price)
+	s.Equal(PriceSourceTier, result.Source)
+}
+
+func (s *CatalogServiceTestSuite) TestResolvePrice_FallsBackToListPrice() {
+	// Arrange
+	ctx := context.Background()
+	customerID, productID := uuid.New(), uuid.New()
+	otherTier := "silver"
+	on := time.Date(2026, 3, 15, 13, 45, 0, 0, time.UTC)
+	day := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	s.productRepo.On("GetProductByID", ctx, productID).Return(&Product{Price: core.MustParseMoney("1000.00", core.USD), Status: ProductStatusActive}, nil)
+	s.customerRepo.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{PricingTier: "gold"}, nil)
+	s.priceBookRepo.On("GetEffectivePrices", ctx, productID, day).Return([]EffectivePrice{
+		{PriceBookEntry: PriceBookEntry{Price: core.MustParseMoney("700.00", core.USD), EffectiveFrom: day}, PricingTier: &otherTier},
+	}, nil)
+
+	// Act
+	result, err := s.priceBooks.ResolvePrice(ctx, customerID, productID, on)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(core.MustParseMoney("1000.00", core.USD), result.Price)
+	s.Equal(PriceSourceList, result.Source)
+	s.Nil(result.PriceBookID)
+}
+
+func (s *CatalogServiceTestSuite) TestResolvePrice_DiscontinuedProduct() {
+	// Arrange
+	ctx := context.Background()
+	productID := uuid.New()
+
+	s.productRepo.On("GetProductByID", ctx, productID).Return(&Product{Status: ProductStatusDiscontinued}, nil)
+
+	// Act
+	result, err := s.priceBooks.ResolvePrice(ctx, uuid.New(), productID, time.Now())
+
+	// Assert
+	s.ErrorIs(err, ErrProductUnavailable)
+	s.Nil(result)
+}
+
+func (s *CatalogServiceTestSuite) TestAddPriceBookEntry_RejectsOverlap() {
+	// Arrange
+	ctx := context.Background()
+	bookID, productID := uuid.New(), uuid.New()
+	jan := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	jul := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	s.priceBookRepo.On("GetPriceBookByID", ctx, bookID).Return(&PriceBook{Entries: []PriceBookEntry{
+		{ProductID: productID, Price: core.MustParseMoney("500.00", core.USD), EffectiveFrom: jan, EffectiveTo: &jul},
+	}}, nil)
+	s.productRepo.On("GetProductByID", ctx, productID).Return(&Product{}, nil)
+
+	// Act
+	result, err := s.priceBooks.AddPriceBookEntry(ctx, PriceBookEntry{PriceBookID: bookID, ProductID: productID, Price: core.MustParseMoney("450.00", core.USD), EffectiveFrom: jan.AddDate(0, 3, 0)})
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidPriceEntry)
+	s.Nil(result)
+}
+
+type MockOrderRepository struct {
+	mock.Mock
+}
+
+func (m *MockOrderRepository) GetOrderByID(ctx context.Context, id uuid.UUID) (*Order, error) {
+	args := m.Called(ctx, id)
+	order, _ := args.Get(0).(*Order)
+	return order, args.Error(1)
+}
+
+func (m *MockOrderRepository) GetOrdersByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Order, error) {
+	args := m.Called(ctx, customerID)
+	return args.Get(0).([]*Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) CreateOrder(ctx context.Context, order Order) (*Order, error) {
+	args := m.Called(ctx, order)
+	created, _ := args.Get(0).(*Order)
+	return created, args.Error(1)
+}
+
+func (m *MockOrderRepository) UpdateOrder(ctx context.Context, order Order) (*Order, error) {
+	args := m.Called(ctx, order)
+	updated, _ := args.Get(0).(*Order)
+	return updated, args.Error(1)
+}
+
+func (m *MockOrderRepository) UpdateOrderStatus(ctx context.Context, order Order, from OrderStatus) (*Order, error) {
+	args := m.Called(ctx, order, from)
+	updated, _ := args.Get(0).(*Order)
+	return updated, args.Error(1)
+}
+
+func (m *MockOrderRepository) DeleteOrder(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+type MockPriceResolver struct {
+	mock.Mock
+}
+
+func (m *MockPriceResolver) ResolvePrice(ctx context.Context, customerID, productID uuid.UUID, on time.Time) (*ResolvedPrice, error) {
+	args := m.Called(ctx, customerID, productID, on)
+	price, _ := args.Get(0).(*ResolvedPrice)
+	return price, args.Error(1)
+}
+
+type MockAddressRetriever struct {
+	mock.Mock
+}
+
+func (m *MockAddressRetriever) GetAddressByID(ctx context.Context, id uuid.UUID) (*customers.Address, error) {
+	args := m.Called(ctx, id)
+	address, _ := args.Get(0).(*customers.Address)
+	return address, args.Error(1)
+}
+
+func (m *MockAddressRetriever) GetAddressesByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*customers.Address, error) {
+	args := m.Called(ctx, customerID)
+	addresses, _ := args.Get(0).([]*customers.Address)
+	return addresses, args.Error(1)
+}
+
+// flatTax charges a fixed rate on each line total, rounding half up.
+type flatTax struct {
+	rate *big.Rat
+}
+
+func (t flatTax) LineTax(ctx context.Context, line TaxableLine) (core.Money, error) {
+	return line.Amount.Mul(t.rate, core.RoundHalfUp)
+}
+
+type OrderServiceTestSuite struct {
+	suite.Suite
+	orderRepo   *MockOrderRepository
+	productRepo *MockProductRepository
+	prices      *MockPriceResolver
+	addresses   *MockAddressRetriever
+	discounts   *MockDiscountSource
+	events      *core.EventBus
+	now         time.Time
+	service     OrderService
+}
+
+func (s *OrderServiceTestSuite) SetupTest() {
+	s.orderRepo = new(MockOrderRepository)
+	s.productRepo = new(MockProductRepository)
+	s.prices = new(MockPriceResolver)
+	s.addresses = new(MockAddressRetriever)
+	s.discounts = new(MockDiscountSource)
+	s.events = core.NewEventBus()
+	s.now = time.Date(2026, 5, 4, 9, 30, 0, 0, time.UTC)
+	s.service = NewOrderService(s.orderRepo, s.productRepo, s.prices, s.addresses, WithTaxCalculator(flatTax{rate: big.NewRat(1, 10)}), WithEventPublisher(s.events), WithDiscounts(s.discounts))
+	s.service.(*orderService).now = func() time.Time { return s.now }
+}
+
+func (s *OrderServiceTestSuite) TearDownTest() {
+	s.orderRepo.AssertExpectations(s.T())
+	s.productRepo.AssertExpectations(s.T())
+	s.prices.AssertExpectations(s.T())
+	s.addresses.AssertExpectations(s.T())
+	s.discounts.AssertExpectations(s.T())
+}
+
+func TestOrderServiceSuite(t *testing.T) {
+	suite.Run(t, new(OrderServiceTestSuite))
+}
+
+func usd(s string) core.Money {
+	return core.MustParseMoney(s, core.USD)
+}
+
+func (s *OrderServiceTestSuite) TestCreateOrder_ComputesTotalsServerSide() {
+	// Arrange
+	ctx := context.Background()
+	customerID, formation, filing := uuid.New(), uuid.New(), uuid.New()
+	orderDate := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	input := Order{
+		CustomerID: customerID,
+		OrderDate:  orderDate,
+		Total:      usd("1.00"), // ignored
+		OrderItems: []OrderItem{
+			{ProductID: formation, Quantity: 3, UnitPrice: usd("0.01"), Discount: usd("99.00")}, // ignored
+			{ProductID: filing, Quantity: 1},
+		},
+	}
+	promo := &DiscountRule{Name: "Formation promo", Type: DiscountTypePercentage, Scope: DiscountScopeLine, Percentage: 10, ProductID: &formation, IsActive: true}
+	promo.ID = uuid.New()
+
+	s.productRepo.On("GetProductByID", ctx, formation).Return(&Product{Name: "LLC Formation"}, nil)
+	s.productRepo.On("GetProductByID", ctx, filing).Return(&Product{Name: "State Filing"}, nil)
+	s.prices.On("ResolvePrice", ctx, customerID, formation, orderDate).Return(&ResolvedPrice{Price: usd("100.00")}, nil)
+	s.prices.On("ResolvePrice", ctx, customerID, filing, orderDate).Return(&ResolvedPrice{Price: usd("49.99")}, nil)
+	s.discounts.On("GetAutomaticDiscountRules", ctx, orderDate).Return([]*DiscountRule{promo}, nil)
+
+	var saved Order
+	s.orderRepo.On("CreateOrder", ctx, mock.AnythingOfType("Order")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Order)
+	}).Return(&Order{OrderNumber: "ORD-000001"}, nil)
+
+	// Act
+	result, err := s.service.CreateOrder(ctx, input)
+
+	// Assert
+	s.NoError(err)
+	s.Equal("ORD-000001", result.OrderNumber)
+	s.Equal(OrderStatusPending, saved.Status)
+	s.Equal("LLC Formation", saved.OrderItems[0].Description)
+	s.Equal(usd("100.00"), saved.OrderItems[0].UnitPrice)
+	s.Equal(usd("270.00"), saved.OrderItems[0].Total)
+	s.Equal([]AppliedDiscount{{RuleID: promo.ID, RuleName: "Formation promo", Amount: usd("30.00")}}, saved.OrderItems[0].Discounts)
+	s.Empty(saved.OrderItems[1].Discounts)
+	s.Equal(usd("27.00"), saved.OrderItems[0].TaxAmount)
+	s.Equal(usd("49.99"), saved.OrderItems[1].Total)
+	s.Equal(usd("5.00"), saved.OrderItems[1].TaxAmount)
+	s.Equal(usd("349.99"), saved.SubTotal)
+	s.Equal(usd("30.00"), saved.Discount)
+	s.Equal(usd("32.00"), saved.TaxAmount)
+	s.Equal(usd("351.99"), saved.Total)
+}
+
+func (s *OrderServiceTestSuite) TestCreateOrder_DiscountNeverExceedsLine() {
+	// Arrange
+	ctx := context.Background()
+	customerID, productID := uuid.New(), uuid.New()
+	orderDate := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	rule := &DiscountRule{Name: "Free consultation", Type: DiscountTypeFixedAmount, Scope: DiscountScopeLine, Amount: usd("200.00"), IsActive: true}
+
+	s.productRepo.On("GetProductByID", ctx, productID).Return(&Product{Name: "Consultation"}, nil)
+	s.prices.On("ResolvePrice", ctx, customerID, productID, orderDate).Return(&ResolvedPrice{Price: usd("150.00")}, nil)
+	s.discounts.On("GetAutomaticDiscountRules", ctx, orderDate).Return([]*DiscountRule{rule}, nil)
+	var saved Order
+	s.orderRepo.On("CreateOrder", ctx, mock.AnythingOfType("Order")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Order)
+	}).Return(&Order{}, nil)
+
+	// Act
+	_, err := s.service.CreateOrder(ctx, Order{
+		CustomerID: customerID,
+		OrderDate:  orderDate,
+		OrderItems: []OrderItem{{ProductID: productID, Quantity: 1, Discount: usd("150.01")}},
+	})
+
+	// Assert
+	s.NoError(err)
+	s.Equal(usd("150.00"), saved.OrderItems[0].Discount)
+	s.True(saved.Total.IsZero())
+}
+
+func (s *OrderServiceTestSuite) TestCreateOrder_RequiresItems() {
+	// Act
+	result, err := s.service.CreateOrder(context.Background(), Order{CustomerID: uuid.New()})
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidOrder)
+	s.Nil(result)
+}
+
+func (s *OrderServiceTestSuite) TestGetOrderByID_AttachesAddresses() {
+	// Arrange
+	ctx := context.Background()
+	orderID, billingID := uuid.New(), uuid.New()
+	billing := &customers.Address{City: "Richmond", State: "VA"}
+
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(&Order{BillingAddressID: &billingID}, nil)
+	s.addresses.On("GetAddressByID", ctx, billingID).Return(billing, nil)
+
+	// Act
+	result, err := s.service.GetOrderByID(ctx, orderID)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(billing, result.BillingAddress)
+	s.Nil(result.ShippingAddress)
+}
+
+func (s *OrderServiceTestSuite) TestUpdateOrder_LockedOnceConfirmed() {
+	// Arrange
+	ctx := context.Background()
+	orderID := uuid.New()
+
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(&Order{Status: OrderStatusConfirmed}, nil)
+
+	// Act
+	result, err := s.service.UpdateOrder(ctx, Order{BaseModel: core.BaseModel{ID: orderID}})
+
+	// Assert
+	s.ErrorIs(err, ErrOrderLocked)
+	s.Nil(result)
+}
+
+func (s *OrderServiceTestSuite) TestUpdateOrder_KeepsQuotedPrices() {
+	// Arrange
+	ctx := context.Background()
+	orderID, quoteID, productID := uuid.New(), uuid.New(), uuid.New()
+	quoted := []OrderItem{{ProductID: productID, Description: "Entity formation", Quantity: 2, UnitPrice: usd("450.00"), Discount: usd("90.00"), TaxAmount: usd("0.00"), Total: usd("810.00")}}
+	existing := &Order{CustomerID: uuid.New(), Status: OrderStatusPending, QuoteID: &quoteID, SubTotal: usd("900.00"), Discount: usd("90.00"), Total: usd("810.00"), OrderItems: quoted}
+
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(existing, nil)
+	s.orderRepo.On("UpdateOrder", ctx, mock.MatchedBy(func(o Order) bool {
+		return o.Notes == "Ship to the registered agent" && o.Total == usd("810.00") && o.OrderItems[0].UnitPrice == usd("450.00")
+	})).Return(&Order{}, nil).Once()
+
+	// Act
+	_, kept := s.service.UpdateOrder(ctx, Order{
+		BaseModel:  core.BaseModel{ID: orderID},
+		Notes:      "Ship to the registered agent",
+		OrderItems: []OrderItem{{ProductID: productID, Quantity: 2, UnitPrice: usd("1.00")}},
+	})
+	_, changed := s.service.UpdateOrder(ctx, Order{
+		BaseModel:  core.BaseModel{ID: orderID},
+		OrderItems: []OrderItem{{ProductID: productID, Quantity: 3}},
+	})
+
+	// Assert
+	s.NoError(kept)
+	s.ErrorIs(changed, ErrInvalidOrder)
+	s.productRepo.AssertNotCalled(s.T(), "GetProductByID", mock.Anything, mock.Anything)
+}
+
+func (s *OrderServiceTestSuite) TestUpdateOrder_RejectsTotalBelowAmountPaid() {
+	// Arrange
+	ctx := context.Background()
+	orderID, customerID, productID := uuid.New(), uuid.New(), uuid.New()
+	orderDate := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	existing := &Order{CustomerID: customerID, Status: OrderStatusPending, OrderDate: orderDate, Total: usd("300.00"), AmountPaid: usd("200.00")}
+
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(existing, nil)
+	s.productRepo.On("GetProductByID", ctx, productID).Return(&Product{Name: "Consultation"}, nil)
+	s.prices.On("ResolvePrice", ctx, customerID, productID, orderDate).Return(&ResolvedPrice{Price: usd("150.00")}, nil)
+	s.discounts.On("GetAutomaticDiscountRules", ctx, orderDate).Return([]*DiscountRule{}, nil)
+
+	// Act
+	result, err := s.service.UpdateOrder(ctx, Order{
+		BaseModel:  core.BaseModel{ID: orderID},
+		OrderItems: []OrderItem{{ProductID: productID, Quantity: 1}},
+	})
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidOrder)
+	s.Nil(result)
+	s.orderRepo.AssertNotCalled(s.T(), "UpdateOrder", mock.Anything, mock.Anything)
+}
+
+func (s *OrderServiceTestSuite) TestDeleteOrder_OnlyUnpaidPending() {
+	// Arrange
+	ctx := context.Background()
+	pending, paid, confirmed := uuid.New(), uuid.New(), uuid.New()
+
+	s.orderRepo.On("GetOrderByID", ctx, pending).Return(&Order{Status: OrderStatusPending}, nil)
+	s.orderRepo.On("GetOrderByID", ctx, paid).Return(&Order{Status: OrderStatusPending, AmountPaid: usd("25.00")}, nil)
+	s.orderRepo.On("GetOrderByID", ctx, confirmed).Return(&Order{Status: OrderStatusConfirmed}, nil)
+	s.orderRepo.On("DeleteOrder", ctx, pending).Return(nil).Once()
+
+	// Act
+	deleted := s.service.DeleteOrder(ctx, pending)
+	withPayment := s.service.DeleteOrder(ctx, paid)
+	afterConfirm := s.service.DeleteOrder(ctx, confirmed)
+
+	// Assert
+	s.NoError(deleted)
+	s.ErrorIs(withPayment, ErrOrderLocked)
+	s.ErrorIs(afterConfirm, ErrOrderLocked)
+}
+
+func (s *OrderServiceTestSuite) TestTransitionOrder_ShippedSetsDateAndPublishes() {
+	// Arrange
+	ctx := context.Background()
+	orderID := uuid.New()
+	current := &Order{BaseModel: core.BaseModel{ID: orderID}, OrderNumber: "ORD-000042", Status: OrderStatusProcessing}
+
+	var received []OrderStatusChanged
+	s.events.Subscribe(OrderStatusEventName(OrderStatusShipped), func(ctx context.Context, event core.Event) error {
+		received = append(received, event.(OrderStatusChanged))
+		return nil
+	})
+
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(current, nil)
+	s.orderRepo.On("UpdateOrderStatus", ctx, mock.MatchedBy(func(o Order) bool {
+		return o.Status == OrderStatusShipped && o.ShippedDate != nil && o.ShippedDate.Equal(s.now) && o.DeliveredDate == nil
+	}), OrderStatusProcessing).Return(&Order{BaseModel: core.BaseModel{ID: orderID}, OrderNumber: "ORD-000042", Status: OrderStatusShipped, ShippedDate: &s.now}, nil)
+
+	// Act
+	result, err := s.service.TransitionOrder(ctx, orderID, OrderStatusShipped)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(OrderStatusShipped, result.Status)
+	s.Require().Len(received, 1)
+	s.Equal(OrderStatusProcessing, received[0].From)
+	s.Equal(OrderStatusShipped, received[0].To)
+	s.Equal("ORD-000042", received[0].OrderNumber)
+}
+
+func (s *OrderServiceTestSuite) TestTransitionOrder_ConfirmPublishesLowStockForReservations() {
+	// Arrange
+	ctx := context.Background()
+	orderID, lowID, plentyID := uuid.New(), uuid.New(), uuid.New()
+	current := &Order{BaseModel: core.BaseModel{ID: orderID}, Status: OrderStatusPending}
+	confirmed := &Order{BaseModel: core.BaseModel{ID: orderID}, Status: OrderStatusConfirmed, StockMovements: []StockMovement{
+		{ProductID: lowID, Type: StockMovementReservation, Quantity: 5, OrderID: &orderID, StockAfter: 12, ReservedAfter: 9, LowStock: true},
+		{ProductID: plentyID, Type: StockMovementReservation, Quantity: 1, OrderID: &orderID, StockAfter: 100, ReservedAfter: 1},
+	}}
+
+	var received []ProductStockLow
+	s.events.Subscribe(ProductStockLowEvent, func(ctx context.Context, event core.Event) error {
+		received = append(received, event.(ProductStockLow))
+		return nil
+	})
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(current, nil)
+	s.orderRepo.On("UpdateOrderStatus", ctx, mock.AnythingOfType("Order"), OrderStatusPending).Return(confirmed, nil)
+
+	// Act
+	result, err := s.service.TransitionOrder(ctx, orderID, OrderStatusConfirmed)
+
+	// Assert
+	s.NoError(err)
+	s.Len(result.StockMovements, 2)
+	s.Require().Len(received, 1)
+	s.Equal(lowID, received[0].ProductID)
+	s.Equal(&orderID, received[0].OrderID)
+	s.Equal(3, received[0].Available)
+}
+
+func (s *OrderServiceTestSuite) TestTransitionOrder_ConfirmFailsWithoutStock() {
+	// Arrange
+	ctx := context.Background()
+	orderID := uuid.New()
+
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(&Order{BaseModel: core.BaseModel{ID: orderID}, Status: OrderStatusPending}, nil)
+	s.orderRepo.On("UpdateOrderStatus", ctx, mock.AnythingOfType("Order"), OrderStatusPending).Return(nil, ErrInsufficientStock)
+
+	// Act
+	result, err := s.service.TransitionOrder(ctx, orderID, OrderStatusConfirmed)
+
+	// Assert
+	s.ErrorIs(err, ErrInsufficientStock)
+	s.Nil(result)
+}
+
+func (s *OrderServiceTestSuite) TestTransitionOrder_RejectsSkippingSteps() {
+	// Arrange
+	ctx := context.Background()
+	orderID := uuid.New()
+
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(&Order{Status: OrderStatusPending}, nil)
+
+	// Act
+	result, err := s.service.TransitionOrder(ctx, orderID, OrderStatusShipped)
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidTransition)
+	s.Nil(result)
+}
+
+func (s *OrderServiceTestSuite) TestTransitionOrder_CancelRefusedWithCapturedPayments() {
+	// Arrange
+	ctx := context.Background()
+	orderID := uuid.New()
+
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(&Order{Status: OrderStatusConfirmed, Payments: []Payment{
+		{Amount: usd("100.00"), Status: PaymentStatusCompleted},
+	}}, nil)
+
+	// Act
+	result, err := s.service.TransitionOrder(ctx, orderID, OrderStatusCancelled)
+
+	// Assert
+	s.ErrorIs(err, ErrPaymentsCaptured)
+	s.Nil(result)
+}
+
+func (s *OrderServiceTestSuite) TestTransitionOrder_CancelAllowedOnceRefunded() {
+	// Arrange
+	ctx := context.Background()
+	orderID := uuid.New()
+
+	s.orderRepo.On("GetOrderByID", ctx, orderID).Return(&Order{Status: OrderStatusConfirmed, Payments: []Payment{
+		{Amount: usd("100.00"), Status: PaymentStatusRefunded},
+		{Amount: usd("25.00"), Status: PaymentStatusFailed},
+	}}, nil)
+	s.orderRepo.On("UpdateOrderStatus", ctx, mock.AnythingOfType("Order"), OrderStatusConfirmed).Return(&Order{Status: OrderStatusCancelled}, nil)
+
+	// Act
+	result, err := s.service.TransitionOrder(ctx, orderID, OrderStatusCancelled)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(OrderStatusCancelled, result.Status)
+}
@@ -0,0 +1,203 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrInvalidSubscription  = errors.New("invalid subscription")
+	ErrSubscriptionNotLive  = errors.New("subscription is cancelled")
+	ErrSubscriptionConflict = errors.New("subscription was changed by another request")
+	ErrCycleAlreadyBilled   = errors.New("billing cycle has already been billed")
+)
+
+// Subscription bills a customer the same lines every cycle, in advance: the
+// invoice for a cycle is issued on its first day. Cycle dates fall on the
+// anchor date's day of the month, or the month's last day when it is
+// shorter.
+type Subscription struct {
+	core.BaseModel
+	CustomerID       uuid.UUID          `json:"customer_id"`
+	Kind             SubscriptionKind   `json:"kind"`
+	Name             string             `json:"name"`
+	Status           SubscriptionStatus `json:"status"`
+	Interval         BillingInterval    `json:"interval"`
+	AnchorDate       time.Time          `json:"anchor_date"`       // First cycle date
+	NextBillingDate  time.Time          `json:"next_billing_date"` // Start of the first cycle not yet billed
+	PaymentTerms     PaymentTerms       `json:"payment_terms"`
+	BillingAddressID *uuid.UUID         `json:"billing_address_id"`
+	Notes            string             `json:"notes"`
+
+	PausedAt    *time.Time `json:"paused_at"`
+	CancelAt    *time.Time `json:"cancel_at"` // Cycle date the subscription ends on, if cancelled at period end
+	CancelledAt *time.Time `json:"cancelled_at"`
+
+	// Relationships
+	Items       []SubscriptionItem       `json:"items"`
+	Adjustments []SubscriptionAdjustment `json:"adjustments"` // Not yet billed
+}
+
+type SubscriptionKind string
+
+const (
+	SubscriptionKindSubscription SubscriptionKind = "subscription"
+	SubscriptionKindRetainer     SubscriptionKind = "retainer"
+)
+
+type SubscriptionStatus string
+
+const (
+	SubscriptionStatusActive    SubscriptionStatus = "active"
+	SubscriptionStatusPaused    SubscriptionStatus = "paused"
+	SubscriptionStatusCancelled SubscriptionStatus = "cancelled"
+)
+
+// SubscriptionItem is a line billed every cycle at a fixed price.
+type SubscriptionItem struct {
+	core.BaseModel
+	SubscriptionID uuid.UUID  `json:"subscription_id"`
+	ProductID      *uuid.UUID `json:"product_id"`
+	Description    string     `json:"description"`
+	Quantity       int        `json:"quantity"`
+	UnitPrice      core.Money `json:"unit_price"`
+	Discount       core.Money `json:"discount"`
+}
+
+// SubscriptionAdjustment is a one-off charge, or a credit when Amount is
+// negative, added to the next cycle's invoice. Proration is recorded this
+// way.
+type SubscriptionAdjustment struct {
+	core.BaseModel
+	SubscriptionID uuid.UUID  `json:"subscription_id"`
+	Description    string     `json:"description"`
+	Amount         core.Money `json:"amount"`
+	EffectiveDate  time.Time  `json:"effective_date"`
+	InvoiceID      *uuid.UUID `json:"invoice_id"` // Set once billed
+}
+
+// SubscriptionCycle records that the period from PeriodStart up to PeriodEnd
+// was billed. A period is billed at most once.
+type SubscriptionCycle struct {
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	PeriodStart    time.Time `json:"period_start"`
+	PeriodEnd      time.Time `json:"period_end"`
+	InvoiceID      uuid.UUID `json:"invoice_id"`
+	BilledAt       time.Time `json:"billed_at"`
+}
+
+type BillingInterval string
+
+const (
+	BillingIntervalMonthly   BillingInterval = "monthly"
+	BillingIntervalQuarterly BillingInterval = "quarterly"
+	BillingIntervalAnnual    BillingInterval = "annual"
+)
+
+// Months is the length of one cycle.
+func (i BillingInterval) Months() (int, error) {
+	switch i {
+	case BillingIntervalMonthly:
+		return 1, nil
+	case BillingIntervalQuarterly:
+		return 3, nil
+	case BillingIntervalAnnual:
+		return 12, nil
+	}
+	return 0, fmt.Errorf("%w: unknown interval %q", ErrInvalidSubscription, i)
+}
+
+// cycleDate is the start of the nth cycle after the anchor date.
+func (s Subscription) cycleDate(n int) (time.Time, error) {
+	months, err := s.Interval.Months()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return addMonths(s.AnchorDate, n*months), nil
+}
+
+// addMonths moves t by months, keeping its day of the month unless the
+// target month is shorter, in which case it lands on the month's last day.
+func addMonths(t time.Time, months int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	if d > last {
+		d = last
+	}
+	return time.Date(first.Year(), first.Month(), d, 0, 0, 0, 0, time.UTC)
+}
+
+// cycleAround returns the cycle dates either side of on: the last one on or
+// before it and the first one after it. Dates before the anchor date have no
+// cycle and return ok false.
+func (s Subscription) cycleAround(on time.Time) (start, end time.Time, ok bool, err error) {
+	on = dateOnly(on)
+	if on.Before(s.AnchorDate) {
+		return time.Time{}, time.Time{}, false, nil
+	}
+	for n := 0; ; n++ {
+		next, err := s.cycleDate(n + 1)
+		if err != nil {
+			return time.Time{}, time.Time{}, false, err
+		}
+		if next.After(on) {
+			start, err := s.cycleDate(n)
+			return start, next, true, err
+		}
+	}
+}
+
+// nextCycleOnOrAfter returns the first cycle date on or after on.
+func (s Subscription) nextCycleOnOrAfter(on time.Time) (time.Time, error) {
+	start, end, ok, err := s.cycleAround(on)
+	switch {
+	case err != nil:
+		return time.Time{}, err
+	case !ok:
+		return s.AnchorDate, nil
+	case start.Equal(dateOnly(on)):
+		return start, nil
+	}
+	return end, nil
+}
+
+// CycleAmount is what one full cycle of the items costs before tax.
+func (s Subscription) CycleAmount() (core.Money, error) {
+	return subscriptionItemsAmount(s.Items)
+}
+
+func subscriptionItemsAmount(items []SubscriptionItem) (core.Money, error) {
+	var amount core.Money
+	for i, item := range items {
+		total, err := lineTotal(ErrInvalidSubscription, i+1, item.UnitPrice, item.Quantity, item.Discount)
+		if err != nil {
+			return core.Money{}, err
+		}
+		if amount, err = amount.Add(total); err != nil {
+			return core.Money{}, err
+		}
+	}
+	return amount, nil
+}
+
+// prorate is the share of amount for the days from from up to the end of the
+// cycle running from start to end, rounded half up.
+func prorate(amount core.Money, from, start, end time.Time) (core.Money, error) {
+	days := daysBetween(start, end)
+	if days <= 0 {
+		return core.Money{}, fmt.Errorf("%w: empty billing cycle", ErrInvalidSubscription)
+	}
+	return amount.Mul(big.NewRat(daysBetween(from, end), days), core.RoundHalfUp)
+}
+
+func daysBetween(from, to time.Time) int64 {
+	return int64(dateOnly(to).Sub(dateOnly(from)).Hours() / 24)
+}
@@ -0,0 +1,210 @@
+package billing
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type subscriptionHandler struct {
+	service SubscriptionService
+}
+
+type subscriptionActionHandler struct {
+	service SubscriptionLifecycle
+}
+
+type subscriptionCycleHandler struct {
+	service SubscriptionReader
+}
+
+type subscriptionBillingHandler struct {
+	service SubscriptionBiller
+}
+
+func (h *subscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getSubscription(w, r)
+	case http.MethodPost:
+		h.createSubscription(w, r)
+	case http.MethodPut:
+		h.changeItems(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *subscriptionActionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.performAction(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *subscriptionCycleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getCycles(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *subscriptionBillingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.billDue(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// NewSubscriptionHandler serves subscriptions: GET by ?id= or ?customer_id=,
+// POST to create one, and PUT ?id= with an {"items": [...]} body to replace
+// its items, prorating the change.
+func NewSubscriptionHandler(service SubscriptionService) http.Handler {
+	return &subscriptionHandler{service: service}
+}
+
+// NewSubscriptionActionHandler runs the action in a {"action": "..."} body
+// against the subscription given by ?id=: "pause", "resume" or "cancel",
+// which takes an optional "at_period_end".
+func NewSubscriptionActionHandler(service SubscriptionLifecycle) http.Handler {
+	return &subscriptionActionHandler{service: service}
+}
+
+// NewSubscriptionCycleHandler lists the billed cycles of the subscription
+// given by ?subscription_id=.
+func NewSubscriptionCycleHandler(service SubscriptionReader) http.Handler {
+	return &subscriptionCycleHandler{service: service}
+}
+
+// NewSubscriptionBillingHandler bills every subscription cycle due as of
+// today, or as of ?date=YYYY-MM-DD, the same way the scheduler does.
+func NewSubscriptionBillingHandler(service SubscriptionBiller) http.Handler {
+	return &subscriptionBillingHandler{service: service}
+}
+
+func (h *subscriptionHandler) getSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("customer_id") {
+		customerID, ok := queryUUID(w, r, "customer_id")
+		if !ok {
+			return
+		}
+		subscriptions, err := h.service.GetSubscriptionsByCustomerID(r.Context(), customerID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(subscriptions)
+		return
+	}
+	subscriptionID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	subscription, err := h.service.GetSubscriptionByID(r.Context(), subscriptionID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(subscription)
+}
+
+func (h *subscriptionHandler) createSubscription(w http.ResponseWriter, r *http.Request) {
+	var subscription Subscription
+	err := json.NewDecoder(r.Body).Decode(&subscription)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	created, err := h.service.CreateSubscription(r.Context(), subscription)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *subscriptionHandler) changeItems(w http.ResponseWriter, r *http.Request) {
+	subscriptionID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	var body struct {
+		Items []SubscriptionItem `json:"items"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	subscription, err := h.service.ChangeSubscriptionItems(r.Context(), subscriptionID, body.Items)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(subscription)
+}
+
+func (h *subscriptionActionHandler) performAction(w http.ResponseWriter, r *http.Request) {
+	subscriptionID, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	var body struct {
+		Action      string `json:"action"`
+		AtPeriodEnd bool   `json:"at_period_end"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var subscription *Subscription
+	switch body.Action {
+	case "pause":
+		subscription, err = h.service.PauseSubscription(r.Context(), subscriptionID)
+	case "resume":
+		subscription, err = h.service.ResumeSubscription(r.Context(), subscriptionID)
+	case "cancel":
+		subscription, err = h.service.CancelSubscription(r.Context(), subscriptionID, body.AtPeriodEnd)
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(subscription)
+}
+
+func (h *subscriptionCycleHandler) getCycles(w http.ResponseWriter, r *http.Request) {
+	subscriptionID, ok := queryUUID(w, r, "subscription_id")
+	if !ok {
+		return
+	}
+	cycles, err := h.service.GetSubscriptionCycles(r.Context(), subscriptionID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(cycles)
+}
+
+func (h *subscriptionBillingHandler) billDue(w http.ResponseWriter, r *http.Request) {
+	asOf, ok := queryDate(w, r, "date")
+	if !ok {
+		return
+	}
+	run, err := h.service.BillDueSubscriptions(r.Context(), asOf)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(run)
+}
@@ -0,0 +1,298 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type subscriptionRepository struct {
+	db *sql.DB
+}
+
+func NewSubscriptionRepository(db *sql.DB) SubscriptionRepository {
+	return &subscriptionRepository{db: db}
+}
+
+const subscriptionColumns = "id, customer_id, kind, name, status, billing_interval, anchor_date, next_billing_date, payment_terms, billing_address_id, notes, paused_at, cancel_at, cancelled_at, created_at, updated_at"
+
+const subscriptionItemColumns = "id, subscription_id, product_id, description, quantity, unit_price, discount, created_at, updated_at"
+
+const subscriptionAdjustmentColumns = "id, subscription_id, description, amount, effective_date, invoice_id, created_at, updated_at"
+
+const subscriptionCycleColumns = "subscription_id, period_start, period_end, invoice_id, billed_at"
+
+func scanSubscription(row rowScanner) (*Subscription, error) {
+	var subscription Subscription
+	err := row.Scan(&subscription.ID, &subscription.CustomerID, &subscription.Kind, &subscription.Name, &subscription.Status, &subscription.Interval, &subscription.AnchorDate, &subscription.NextBillingDate, &subscription.PaymentTerms, &subscription.BillingAddressID, &subscription.Notes, &subscription.PausedAt, &subscription.CancelAt, &subscription.CancelledAt, &subscription.CreatedAt, &subscription.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func scanSubscriptionItem(row rowScanner) (*SubscriptionItem, error) {
+	var item SubscriptionItem
+	err := row.Scan(&item.ID, &item.SubscriptionID, &item.ProductID, &item.Description, &item.Quantity, &item.UnitPrice, &item.Discount, &item.CreatedAt, &item.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func scanSubscriptionAdjustment(row rowScanner) (*SubscriptionAdjustment, error) {
+	var adjustment SubscriptionAdjustment
+	err := row.Scan(&adjustment.ID, &adjustment.SubscriptionID, &adjustment.Description, &adjustment.Amount, &adjustment.EffectiveDate, &adjustment.InvoiceID, &adjustment.CreatedAt, &adjustment.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &adjustment, nil
+}
+
+func scanSubscriptionCycle(row rowScanner) (*SubscriptionCycle, error) {
+	var cycle SubscriptionCycle
+	err := row.Scan(&cycle.SubscriptionID, &cycle.PeriodStart, &cycle.PeriodEnd, &cycle.InvoiceID, &cycle.BilledAt)
+	if err != nil {
+		return nil, err
+	}
+	return &cycle, nil
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func (r *subscriptionRepository) GetSubscriptionByID(ctx context.Context, id uuid.UUID) (*Subscription, error) {
+	subscription, err := scanSubscription(r.db.QueryRowContext(ctx, "SELECT "+subscriptionColumns+" FROM subscriptions WHERE id = $1", id))
+	if err != nil {
+		return nil, err
+	}
+	if err := loadSubscriptionLines(ctx, r.db, subscription); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func (r *subscriptionRepository) GetSubscriptionsByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Subscription, error) {
+	return r.querySubscriptions(ctx, "SELECT "+subscriptionColumns+" FROM subscriptions WHERE customer_id = $1 ORDER BY created_at DESC", customerID)
+}
+
+func (r *subscriptionRepository) GetDueSubscriptions(ctx context.Context, asOf time.Time) ([]*Subscription, error) {
+	subscriptions, err := r.querySubscriptions(ctx, "SELECT "+subscriptionColumns+" FROM subscriptions WHERE status = $1 AND next_billing_date <= $2 ORDER BY next_billing_date, id", SubscriptionStatusActive, asOf)
+	if err != nil {
+		return nil, err
+	}
+	for _, subscription := range subscriptions {
+		if err := loadSubscriptionLines(ctx, r.db, subscription); err != nil {
+			return nil, err
+		}
+	}
+	return subscriptions, nil
+}
+
+func (r *subscriptionRepository) GetSubscriptionCycles(ctx context.Context, subscriptionID uuid.UUID) ([]*SubscriptionCycle, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+subscriptionCycleColumns+" FROM subscription_cycles WHERE subscription_id = $1 ORDER BY period_start", subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cycles []*SubscriptionCycle
+	for rows.Next() {
+		cycle, err := scanSubscriptionCycle(rows)
+		if err != nil {
+			return nil, err
+		}
+		cycles = append(cycles, cycle)
+	}
+	return cycles, rows.Err()
+}
+
+func (r *subscriptionRepository) CreateSubscription(ctx context.Context, subscription Subscription) (*Subscription, error) {
+	if subscription.ID == uuid.Nil {
+		subscription.ID = uuid.New()
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created, err := scanSubscription(tx.QueryRowContext(ctx, "INSERT INTO subscriptions (id, customer_id, kind, name, status, billing_interval, anchor_date, next_billing_date, payment_terms, billing_address_id, notes) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING "+subscriptionColumns,
+		subscription.ID, subscription.CustomerID, subscription.Kind, subscription.Name, subscription.Status, subscription.Interval, subscription.AnchorDate, subscription.NextBillingDate, subscription.PaymentTerms, subscription.BillingAddressID, subscription.Notes))
+	if err != nil {
+		return nil, err
+	}
+	if created.Items, err = insertSubscriptionItems(ctx, tx, created.ID, subscription.Items); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (r *subscriptionRepository) UpdateSubscription(ctx context.Context, subscription Subscription, from Subscription, adjustments []SubscriptionAdjustment) (*Subscription, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	updated, err := scanSubscription(tx.QueryRowContext(ctx, "UPDATE subscriptions SET name = $1, status = $2, next_billing_date = $3, payment_terms = $4, billing_address_id = $5, notes = $6, paused_at = $7, cancel_at = $8, cancelled_at = $9, updated_at = CURRENT_TIMESTAMP WHERE id = $10 AND status = $11 AND next_billing_date = $12 RETURNING "+subscriptionColumns,
+		subscription.Name, subscription.Status, subscription.NextBillingDate, subscription.PaymentTerms, subscription.BillingAddressID, subscription.Notes, subscription.PausedAt, subscription.CancelAt, subscription.CancelledAt, from.ID, from.Status, from.NextBillingDate))
+	if errors.Is(err, ErrSubscriptionNotFound) {
+		return nil, ErrSubscriptionConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM subscription_items WHERE subscription_id = $1", updated.ID); err != nil {
+		return nil, err
+	}
+	if _, err := insertSubscriptionItems(ctx, tx, updated.ID, subscription.Items); err != nil {
+		return nil, err
+	}
+	for _, adjustment := range adjustments {
+		if adjustment.ID == uuid.Nil {
+			adjustment.ID = uuid.New()
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO subscription_adjustments (id, subscription_id, description, amount, effective_date) VALUES ($1, $2, $3, $4, $5)",
+			adjustment.ID, updated.ID, adjustment.Description, adjustment.Amount, adjustment.EffectiveDate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := loadSubscriptionLines(ctx, tx, updated); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (r *subscriptionRepository) BillSubscriptionCycle(ctx context.Context, cycle SubscriptionCycle, invoice Invoice, adjustments []SubscriptionAdjustment) (*Invoice, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	subscription, err := scanSubscription(tx.QueryRowContext(ctx, "SELECT "+subscriptionColumns+" FROM subscriptions WHERE id = $1 FOR UPDATE", cycle.SubscriptionID))
+	if err != nil {
+		return nil, err
+	}
+	if subscription.Status != SubscriptionStatusActive || !subscription.NextBillingDate.Equal(cycle.PeriodStart) {
+		return nil, ErrCycleAlreadyBilled
+	}
+
+	number, err := nextSequenceValue(ctx, tx, invoiceNumberSequence)
+	if err != nil {
+		return nil, err
+	}
+	invoice.InvoiceNumber = formatDocumentNumber("INV", number)
+	created, err := insertInvoice(ctx, tx, invoice)
+	if err != nil {
+		return nil, err
+	}
+	for _, adjustment := range adjustments {
+		result, err := tx.ExecContext(ctx, "UPDATE subscription_adjustments SET invoice_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND invoice_id IS NULL", created.ID, adjustment.ID)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			return nil, ErrCycleAlreadyBilled
+		}
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO subscription_cycles (subscription_id, period_start, period_end, invoice_id, billed_at) VALUES ($1, $2, $3, $4, $5)",
+		cycle.SubscriptionID, cycle.PeriodStart, cycle.PeriodEnd, created.ID, cycle.BilledAt)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE subscriptions SET next_billing_date = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", cycle.PeriodEnd, cycle.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (r *subscriptionRepository) querySubscriptions(ctx context.Context, query string, args ...any) ([]*Subscription, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []*Subscription
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+// loadSubscriptionLines fills in a subscription's items and unbilled
+// adjustments.
+func loadSubscriptionLines(ctx context.Context, db queryer, subscription *Subscription) error {
+	rows, err := db.QueryContext(ctx, "SELECT "+subscriptionItemColumns+" FROM subscription_items WHERE subscription_id = $1 ORDER BY created_at, id", subscription.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	subscription.Items = nil
+	for rows.Next() {
+		item, err := scanSubscriptionItem(rows)
+		if err != nil {
+			return err
+		}
+		subscription.Items = append(subscription.Items, *item)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	adjustmentRows, err := db.QueryContext(ctx, "SELECT "+subscriptionAdjustmentColumns+" FROM subscription_adjustments WHERE subscription_id = $1 AND invoice_id IS NULL ORDER BY effective_date, created_at, id", subscription.ID)
+	if err != nil {
+		return err
+	}
+	defer adjustmentRows.Close()
+	subscription.Adjustments = nil
+	for adjustmentRows.Next() {
+		adjustment, err := scanSubscriptionAdjustment(adjustmentRows)
+		if err != nil {
+			return err
+		}
+		subscription.Adjustments = append(subscription.Adjustments, *adjustment)
+	}
+	return adjustmentRows.Err()
+}
+
+func insertSubscriptionItems(ctx context.Context, tx *sql.Tx, subscriptionID uuid.UUID, items []SubscriptionItem) ([]SubscriptionItem, error) {
+	inserted := make([]SubscriptionItem, 0, len(items))
+	for _, item := range items {
+		if item.ID == uuid.Nil {
+			item.ID = uuid.New()
+		}
+		created, err := scanSubscriptionItem(tx.QueryRowContext(ctx, "INSERT INTO subscription_items (id, subscription_id, product_id, description, quantity, unit_price, discount) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING "+subscriptionItemColumns,
+			item.ID, subscriptionID, item.ProductID, item.Description, item.Quantity, item.UnitPrice, item.Discount))
+		if err != nil {
+			return nil, err
+		}
+		inserted = append(inserted, *created)
+	}
+	return inserted, nil
+}
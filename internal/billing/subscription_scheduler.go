@@ -0,0 +1,49 @@
+package billing
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// SubscriptionScheduler bills due subscriptions on a timer. Billing is
+// idempotent per cycle, so the scheduler may run on several instances at
+// once, and one that was down catches up on its next run.
+type SubscriptionScheduler struct {
+	biller SubscriptionBiller
+	every  time.Duration
+	now    func() time.Time
+}
+
+func NewSubscriptionScheduler(biller SubscriptionBiller, every time.Duration) *SubscriptionScheduler {
+	return &SubscriptionScheduler{biller: biller, every: every, now: time.Now}
+}
+
+// Run bills straight away and then on every tick until ctx is done.
+func (s *SubscriptionScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.every)
+	defer ticker.Stop()
+	for {
+		s.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce bills every cycle due as of now and logs what could not be billed.
+func (s *SubscriptionScheduler) RunOnce(ctx context.Context) {
+	run, err := s.biller.BillDueSubscriptions(ctx, s.now())
+	if err != nil {
+		slog.ErrorContext(ctx, "subscription billing run failed", "error", err)
+		return
+	}
+	for _, failure := range run.Failures {
+		slog.ErrorContext(ctx, "subscription billing failed", "subscription_id", failure.SubscriptionID, "error", failure.Error)
+	}
+	if len(run.Invoices) > 0 || len(run.Cancelled) > 0 {
+		slog.InfoContext(ctx, "subscriptions billed", "as_of", run.AsOf, "invoices", len(run.Invoices), "cancelled", len(run.Cancelled))
+	}
+}
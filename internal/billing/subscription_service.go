@@ -0,0 +1,540 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SubscriptionService interface {
+	SubscriptionReader
+	SubscriptionCreator
+	SubscriptionChanger
+	SubscriptionLifecycle
+	SubscriptionBiller
+}
+
+type SubscriptionRepository interface {
+	SubscriptionReader
+	SubscriptionCreator
+	DueSubscriptionLister
+	SubscriptionUpdater
+	SubscriptionCycleBiller
+}
+
+type subscriptionService struct {
+	repo     SubscriptionRepository
+	products ProductRetriever
+	prices   PriceResolver
+	tax      TaxCalculator
+	now      func() time.Time
+}
+
+type SubscriptionServiceOption func(*subscriptionService)
+
+// WithSubscriptionTaxCalculator sets how tax is computed on cycle invoices.
+// Without it they carry no tax.
+func WithSubscriptionTaxCalculator(tax TaxCalculator) SubscriptionServiceOption {
+	return func(s *subscriptionService) {
+		s.tax = tax
+	}
+}
+
+func NewSubscriptionService(repo SubscriptionRepository, products ProductRetriever, prices PriceResolver, opts ...SubscriptionServiceOption) SubscriptionService {
+	s := &subscriptionService{
+		repo:     repo,
+		products: products,
+		prices:   prices,
+		tax:      noTax{},
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+type SubscriptionReader interface {
+	GetSubscriptionByID(ctx context.Context, id uuid.UUID) (*Subscription, error)
+	GetSubscriptionsByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Subscription, error)
+	GetSubscriptionCycles(ctx context.Context, subscriptionID uuid.UUID) ([]*SubscriptionCycle, error)
+}
+
+type SubscriptionCreator interface {
+	CreateSubscription(ctx context.Context, subscription Subscription) (*Subscription, error)
+}
+
+// SubscriptionChanger replaces a subscription's items. A change part way
+// through a billed cycle is prorated onto the next invoice.
+type SubscriptionChanger interface {
+	ChangeSubscriptionItems(ctx context.Context, id uuid.UUID, items []SubscriptionItem) (*Subscription, error)
+}
+
+type SubscriptionLifecycle interface {
+	PauseSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error)
+	ResumeSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error)
+	CancelSubscription(ctx context.Context, id uuid.UUID, atPeriodEnd bool) (*Subscription, error)
+}
+
+// SubscriptionBiller issues the invoices for every cycle that has started by
+// asOf. It is safe to run more than once for the same date, and a run after
+// missed days catches up on every cycle due since.
+type SubscriptionBiller interface {
+	BillDueSubscriptions(ctx context.Context, asOf time.Time) (*SubscriptionBillingRun, error)
+}
+
+// DueSubscriptionLister returns active subscriptions, with their items and
+// unbilled adjustments, whose next billing date is on or before asOf.
+type DueSubscriptionLister interface {
+	GetDueSubscriptions(ctx context.Context, asOf time.Time) ([]*Subscription, error)
+}
+
+// SubscriptionUpdater saves a subscription's header, replaces its items and
+// adds adjustments in one transaction, but only if its status and next
+// billing date are still those of from. Otherwise it returns
+// ErrSubscriptionConflict.
+type SubscriptionUpdater interface {
+	UpdateSubscription(ctx context.Context, subscription Subscription, from Subscription, adjustments []SubscriptionAdjustment) (*Subscription, error)
+}
+
+// SubscriptionCycleBiller numbers and inserts a cycle's invoice, marks the
+// adjustments on it as billed, records the cycle and moves the next billing
+// date to the cycle's end, all in one transaction. It locks the subscription
+// and returns ErrCycleAlreadyBilled unless the subscription is active and
+// the cycle starts on its next billing date.
+type SubscriptionCycleBiller interface {
+	BillSubscriptionCycle(ctx context.Context, cycle SubscriptionCycle, invoice Invoice, adjustments []SubscriptionAdjustment) (*Invoice, error)
+}
+
+// SubscriptionBillingRun reports what one BillDueSubscriptions call did. A
+// subscription that fails to bill does not stop the others.
+type SubscriptionBillingRun struct {
+	AsOf      time.Time                    `json:"as_of"`
+	Invoices  []*Invoice                   `json:"invoices"`
+	Cancelled []uuid.UUID                  `json:"cancelled"`
+	Failures  []SubscriptionBillingFailure `json:"failures"`
+}
+
+type SubscriptionBillingFailure struct {
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	Error          string    `json:"error"`
+}
+
+func (s *subscriptionService) GetSubscriptionByID(ctx context.Context, id uuid.UUID) (*Subscription, error) {
+	return s.repo.GetSubscriptionByID(ctx, id)
+}
+
+func (s *subscriptionService) GetSubscriptionsByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Subscription, error) {
+	return s.repo.GetSubscriptionsByCustomerID(ctx, customerID)
+}
+
+func (s *subscriptionService) GetSubscriptionCycles(ctx context.Context, subscriptionID uuid.UUID) ([]*SubscriptionCycle, error) {
+	return s.repo.GetSubscriptionCycles(ctx, subscriptionID)
+}
+
+// CreateSubscription starts a subscription whose first cycle begins on the
+// anchor date, today if none is given. Product lines must be recurring
+// products and are priced from the catalog as of the anchor date; the price
+// then holds for the life of the subscription.
+func (s *subscriptionService) CreateSubscription(ctx context.Context, subscription Subscription) (*Subscription, error) {
+	if subscription.CustomerID == uuid.Nil {
+		return nil, fmt.Errorf("%w: customer is required", ErrInvalidSubscription)
+	}
+	subscription.Name = strings.TrimSpace(subscription.Name)
+	if subscription.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidSubscription)
+	}
+	switch subscription.Kind {
+	case "":
+		subscription.Kind = SubscriptionKindSubscription
+	case SubscriptionKindSubscription, SubscriptionKindRetainer:
+	default:
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidSubscription, subscription.Kind)
+	}
+	if _, err := subscription.Interval.Months(); err != nil {
+		return nil, err
+	}
+	if subscription.PaymentTerms == "" {
+		subscription.PaymentTerms = PaymentTermsNet30
+	}
+	if _, err := subscription.PaymentTerms.Days(); err != nil {
+		return nil, err
+	}
+	if subscription.AnchorDate.IsZero() {
+		subscription.AnchorDate = s.now()
+	}
+	subscription.AnchorDate = dateOnly(subscription.AnchorDate)
+
+	subscription.Status = SubscriptionStatusActive
+	subscription.NextBillingDate = subscription.AnchorDate
+	subscription.PausedAt, subscription.CancelAt, subscription.CancelledAt = nil, nil, nil
+	subscription.Adjustments = nil
+	if err := s.priceItems(ctx, subscription.CustomerID, subscription.Items, subscription.AnchorDate); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateSubscription(ctx, subscription)
+}
+
+// ChangeSubscriptionItems replaces the items from today. If today falls in a
+// cycle that has already been billed, the next invoice credits the unused
+// part of the old items and charges the rest of the cycle at the new ones.
+func (s *subscriptionService) ChangeSubscriptionItems(ctx context.Context, id uuid.UUID, items []SubscriptionItem) (*Subscription, error) {
+	existing, err := s.repo.GetSubscriptionByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Status == SubscriptionStatusCancelled {
+		return nil, ErrSubscriptionNotLive
+	}
+	today := dateOnly(s.now())
+	if err := s.priceItems(ctx, existing.CustomerID, items, today); err != nil {
+		return nil, err
+	}
+
+	var adjustments []SubscriptionAdjustment
+	start, end, ok, err := existing.cycleAround(today)
+	if err != nil {
+		return nil, err
+	}
+	if ok && existing.Status == SubscriptionStatusActive && end.Equal(existing.NextBillingDate) {
+		oldAmount, err := existing.CycleAmount()
+		if err != nil {
+			return nil, err
+		}
+		newAmount, err := subscriptionItemsAmount(items)
+		if err != nil {
+			return nil, err
+		}
+		if cmp, err := oldAmount.Cmp(newAmount); err != nil {
+			return nil, err
+		} else if cmp != 0 {
+			unused, err := prorate(oldAmount, today, start, end)
+			if err != nil {
+				return nil, err
+			}
+			remaining, err := prorate(newAmount, today, start, end)
+			if err != nil {
+				return nil, err
+			}
+			period := formatPeriod(today, end)
+			if !unused.IsZero() {
+				adjustments = append(adjustments, SubscriptionAdjustment{Description: "Unused time on previous items, " + period, Amount: unused.Neg(), EffectiveDate: today})
+			}
+			if !remaining.IsZero() {
+				adjustments = append(adjustments, SubscriptionAdjustment{Description: "Remaining time on new items, " + period, Amount: remaining, EffectiveDate: today})
+			}
+		}
+	}
+
+	updated := *existing
+	updated.Items = items
+	return s.repo.UpdateSubscription(ctx, updated, *existing, adjustments)
+}
+
+// PauseSubscription stops billing. The cycle in progress has already been
+// billed and is not credited.
+func (s *subscriptionService) PauseSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error) {
+	existing, err := s.repo.GetSubscriptionByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Status != SubscriptionStatusActive {
+		return nil, fmt.Errorf("%w: only active subscriptions can be paused", ErrInvalidSubscription)
+	}
+	if existing.CancelAt != nil {
+		return nil, fmt.Errorf("%w: subscription is already set to cancel", ErrInvalidSubscription)
+	}
+	now := s.now()
+	updated := *existing
+	updated.Status = SubscriptionStatusPaused
+	updated.PausedAt = &now
+	return s.repo.UpdateSubscription(ctx, updated, *existing, nil)
+}
+
+// ResumeSubscription restarts billing. Cycles that passed while paused are
+// skipped. Resuming part way through a cycle that was not billed charges the
+// rest of it on the next invoice.
+func (s *subscriptionService) ResumeSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error) {
+	existing, err := s.repo.GetSubscriptionByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Status != SubscriptionStatusPaused {
+		return nil, fmt.Errorf("%w: only paused subscriptions can be resumed", ErrInvalidSubscription)
+	}
+	today := dateOnly(s.now())
+	updated := *existing
+	updated.Status = SubscriptionStatusActive
+	updated.PausedAt = nil
+
+	var adjustments []SubscriptionAdjustment
+	if !existing.NextBillingDate.After(today) {
+		next, err := existing.nextCycleOnOrAfter(today)
+		if err != nil {
+			return nil, err
+		}
+		updated.NextBillingDate = next
+		if next.After(today) {
+			start, end, _, err := existing.cycleAround(today)
+			if err != nil {
+				return nil, err
+			}
+			amount, err := existing.CycleAmount()
+			if err != nil {
+				return nil, err
+			}
+			if amount, err = prorate(amount, today, start, end); err != nil {
+				return nil, err
+			}
+			if !amount.IsZero() {
+				adjustments = append(adjustments, SubscriptionAdjustment{Description: "Resumed, " + formatPeriod(today, end), Amount: amount, EffectiveDate: today})
+			}
+		}
+	}
+	return s.repo.UpdateSubscription(ctx, updated, *existing, adjustments)
+}
+
+// CancelSubscription ends a subscription. With atPeriodEnd an active
+// subscription runs to the end of the cycle already billed and is cancelled
+// by the next billing run; otherwise it ends now without a credit for the
+// rest of the cycle.
+func (s *subscriptionService) CancelSubscription(ctx context.Context, id uuid.UUID, atPeriodEnd bool) (*Subscription, error) {
+	existing, err := s.repo.GetSubscriptionByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Status == SubscriptionStatusCancelled {
+		return nil, ErrSubscriptionNotLive
+	}
+	updated := *existing
+	if atPeriodEnd && existing.Status == SubscriptionStatusActive {
+		cancelAt := existing.NextBillingDate
+		updated.CancelAt = &cancelAt
+	} else {
+		now := s.now()
+		updated.Status = SubscriptionStatusCancelled
+		updated.CancelledAt = &now
+		updated.CancelAt = nil
+	}
+	return s.repo.UpdateSubscription(ctx, updated, *existing, nil)
+}
+
+// BillDueSubscriptions issues an invoice for each cycle that starts on or
+// before asOf, oldest first. Invoices are dated on the cycle's first day, so
+// a late run produces the same invoices an on-time one would have.
+func (s *subscriptionService) BillDueSubscriptions(ctx context.Context, asOf time.Time) (*SubscriptionBillingRun, error) {
+	asOf = dateOnly(asOf)
+	due, err := s.repo.GetDueSubscriptions(ctx, asOf)
+	if err != nil {
+		return nil, err
+	}
+	run := &SubscriptionBillingRun{AsOf: asOf}
+	for _, subscription := range due {
+		if err := s.billSubscription(ctx, subscription, asOf, run); err != nil {
+			run.Failures = append(run.Failures, SubscriptionBillingFailure{SubscriptionID: subscription.ID, Error: err.Error()})
+		}
+	}
+	return run, nil
+}
+
+func (s *subscriptionService) billSubscription(ctx context.Context, subscription *Subscription, asOf time.Time, run *SubscriptionBillingRun) error {
+	for subscription.Status == SubscriptionStatusActive && !subscription.NextBillingDate.After(asOf) {
+		if subscription.CancelAt != nil && !subscription.NextBillingDate.Before(*subscription.CancelAt) {
+			cancelled := *subscription
+			cancelled.Status = SubscriptionStatusCancelled
+			cancelledAt := *subscription.CancelAt
+			cancelled.CancelledAt = &cancelledAt
+			if _, err := s.repo.UpdateSubscription(ctx, cancelled, *subscription, nil); err != nil {
+				return err
+			}
+			run.Cancelled = append(run.Cancelled, subscription.ID)
+			return nil
+		}
+
+		cycle, invoice, billed, err := s.cycleInvoice(ctx, *subscription)
+		if err != nil {
+			return err
+		}
+		created, err := s.repo.BillSubscriptionCycle(ctx, cycle, invoice, billed)
+		if errors.Is(err, ErrCycleAlreadyBilled) {
+			// Another run got there first; carry on from where it left off.
+			if subscription, err = s.repo.GetSubscriptionByID(ctx, subscription.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		run.Invoices = append(run.Invoices, created)
+
+		subscription.NextBillingDate = cycle.PeriodEnd
+		subscription.Adjustments = unbilledAdjustments(subscription.Adjustments, billed)
+	}
+	return nil
+}
+
+// cycleInvoice builds the invoice for the cycle starting on the
+// subscription's next billing date, and returns the adjustments it bills.
+// Credits are held back for a later cycle rather than take the invoice below
+// zero.
+func (s *subscriptionService) cycleInvoice(ctx context.Context, subscription Subscription) (SubscriptionCycle, Invoice, []SubscriptionAdjustment, error) {
+	start, end, _, err := subscription.cycleAround(subscription.NextBillingDate)
+	if err != nil {
+		return SubscriptionCycle{}, Invoice{}, nil, err
+	}
+	days, err := subscription.PaymentTerms.Days()
+	if err != nil {
+		return SubscriptionCycle{}, Invoice{}, nil, err
+	}
+	now := s.now()
+	due := start.AddDate(0, 0, days)
+	period := formatPeriod(start, end)
+	invoice := Invoice{
+		Kind:             InvoiceKindInvoice,
+		CustomerID:       subscription.CustomerID,
+		Status:           InvoiceStatusSent,
+		PaymentTerms:     subscription.PaymentTerms,
+		IssueDate:        &start,
+		DueDate:          &due,
+		SentAt:           &now,
+		BillingAddressID: subscription.BillingAddressID,
+		Notes:            subscription.Name + ", " + period,
+	}
+
+	var totals documentTotals
+	// addLine takes item with its Total set.
+	addLine := func(item InvoiceItem) error {
+		var err error
+		if item.TaxAmount, err = s.tax.LineTax(ctx, TaxableLine{
+			CustomerID: subscription.CustomerID,
+			ProductID:  item.ProductID,
+			AddressID:  subscription.BillingAddressID,
+			Date:       start,
+			Amount:     item.Total,
+		}); err != nil {
+			return fmt.Errorf("failed to calculate tax: %w", err)
+		}
+		if err := totals.addLine(item.UnitPrice, item.Quantity, item.Discount, item.TaxAmount); err != nil {
+			return err
+		}
+		invoice.Items = append(invoice.Items, item)
+		return nil
+	}
+	for i, item := range subscription.Items {
+		total, err := lineTotal(ErrInvalidSubscription, i+1, item.UnitPrice, item.Quantity, item.Discount)
+		if err != nil {
+			return SubscriptionCycle{}, Invoice{}, nil, err
+		}
+		if err := addLine(InvoiceItem{
+			ProductID:   item.ProductID,
+			Description: item.Description + ", " + period,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Discount:    item.Discount,
+			Total:       total,
+		}); err != nil {
+			return SubscriptionCycle{}, Invoice{}, nil, err
+		}
+	}
+
+	adjustments := append([]SubscriptionAdjustment(nil), subscription.Adjustments...)
+	sort.SliceStable(adjustments, func(i, j int) bool {
+		return adjustments[i].EffectiveDate.Before(adjustments[j].EffectiveDate)
+	})
+	var billed []SubscriptionAdjustment
+	for _, adjustment := range adjustments {
+		if adjustment.Amount.IsNegative() {
+			total, err := totals.total()
+			if err != nil {
+				return SubscriptionCycle{}, Invoice{}, nil, err
+			}
+			if cmp, err := adjustment.Amount.Abs().Cmp(total); err != nil {
+				return SubscriptionCycle{}, Invoice{}, nil, err
+			} else if cmp > 0 {
+				continue
+			}
+		}
+		// Credits are negative lines, which lineTotal would reject.
+		if err := addLine(InvoiceItem{Description: adjustment.Description, Quantity: 1, UnitPrice: adjustment.Amount, Total: adjustment.Amount}); err != nil {
+			return SubscriptionCycle{}, Invoice{}, nil, err
+		}
+		billed = append(billed, adjustment)
+	}
+
+	total, err := totals.total()
+	if err != nil {
+		return SubscriptionCycle{}, Invoice{}, nil, err
+	}
+	invoice.SubTotal, invoice.Discount, invoice.TaxAmount, invoice.Total = totals.subTotal, totals.discount, totals.tax, total
+	invoice.Currency = currencyOf(total)
+	cycle := SubscriptionCycle{SubscriptionID: subscription.ID, PeriodStart: start, PeriodEnd: end, BilledAt: now}
+	return cycle, invoice, billed, nil
+}
+
+// priceItems validates subscription items and prices product lines from the
+// catalog as of on.
+func (s *subscriptionService) priceItems(ctx context.Context, customerID uuid.UUID, items []SubscriptionItem, on time.Time) error {
+	if len(items) == 0 {
+		return fmt.Errorf("%w: at least one item is required", ErrInvalidSubscription)
+	}
+	for i := range items {
+		item := &items[i]
+		item.ID, item.SubscriptionID = uuid.Nil, uuid.Nil
+		if item.Quantity <= 0 {
+			return fmt.Errorf("%w: item %d quantity must be positive", ErrInvalidSubscription, i+1)
+		}
+		if item.ProductID != nil {
+			product, err := s.products.GetProductByID(ctx, *item.ProductID)
+			if err != nil {
+				return err
+			}
+			if !product.IsRecurring || product.Status != ProductStatusActive {
+				return fmt.Errorf("%w: item %d is not an active recurring product", ErrInvalidSubscription, i+1)
+			}
+			price, err := s.prices.ResolvePrice(ctx, customerID, product.ID, on)
+			if err != nil {
+				return err
+			}
+			item.UnitPrice = price.Price
+			if item.Description == "" {
+				item.Description = product.Name
+			}
+		}
+		if item.Description == "" {
+			return fmt.Errorf("%w: item %d description is required", ErrInvalidSubscription, i+1)
+		}
+		if item.UnitPrice.IsNegative() {
+			return fmt.Errorf("%w: item %d unit price is negative", ErrInvalidSubscription, i+1)
+		}
+		if _, err := lineTotal(ErrInvalidSubscription, i+1, item.UnitPrice, item.Quantity, item.Discount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unbilledAdjustments drops billed from adjustments.
+func unbilledAdjustments(adjustments, billed []SubscriptionAdjustment) []SubscriptionAdjustment {
+	done := make(map[uuid.UUID]bool, len(billed))
+	for _, adjustment := range billed {
+		done[adjustment.ID] = true
+	}
+	var left []SubscriptionAdjustment
+	for _, adjustment := range adjustments {
+		if !done[adjustment.ID] {
+			left = append(left, adjustment)
+		}
+	}
+	return left
+}
+
+// formatPeriod describes the days from start up to, but not including, end.
+func formatPeriod(start, end time.Time) string {
+	return start.Format(time.DateOnly) + " to " + end.AddDate(0, 0, -1).Format(time.DateOnly)
+}
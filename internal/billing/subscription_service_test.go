@@ -0,0 +1,378 @@
+package billing
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockSubscriptionRepository struct {
+	mock.Mock
+}
+
+func (m *MockSubscriptionRepository) GetSubscriptionByID(ctx context.Context, id uuid.UUID) (*Subscription, error) {
+	args := m.Called(ctx, id)
+	subscription, _ := args.Get(0).(*Subscription)
+	return subscription, args.Error(1)
+}
+
+func (m *MockSubscriptionRepository) GetSubscriptionsByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*Subscription, error) {
+	args := m.Called(ctx, customerID)
+	subscriptions, _ := args.Get(0).([]*Subscription)
+	return subscriptions, args.Error(1)
+}
+
+func (m *MockSubscriptionRepository) GetSubscriptionCycles(ctx context.Context, subscriptionID uuid.UUID) ([]*SubscriptionCycle, error) {
+	args := m.Called(ctx, subscriptionID)
+	cycles, _ := args.Get(0).([]*SubscriptionCycle)
+	return cycles, args.Error(1)
+}
+
+func (m *MockSubscriptionRepository) CreateSubscription(ctx context.Context, subscription Subscription) (*Subscription, error) {
+	args := m.Called(ctx, subscription)
+	created, _ := args.Get(0).(*Subscription)
+	return created, args.Error(1)
+}
+
+func (m *MockSubscriptionRepository) GetDueSubscriptions(ctx context.Context, asOf time.Time) ([]*Subscription, error) {
+	args := m.Called(ctx, asOf)
+	subscriptions, _ := args.Get(0).([]*Subscription)
+	return subscriptions, args.Error(1)
+}
+
+func (m *MockSubscriptionRepository) UpdateSubscription(ctx context.Context, subscription Subscription, from Subscription, adjustments []SubscriptionAdjustment) (*Subscription, error) {
+	args := m.Called(ctx, subscription, from, adjustments)
+	updated, _ := args.Get(0).(*Subscription)
+	return updated, args.Error(1)
+}
+
+func (m *MockSubscriptionRepository) BillSubscriptionCycle(ctx context.Context, cycle SubscriptionCycle, invoice Invoice, adjustments []SubscriptionAdjustment) (*Invoice, error) {
+	args := m.Called(ctx, cycle, invoice, adjustments)
+	created, _ := args.Get(0).(*Invoice)
+	return created, args.Error(1)
+}
+
+type SubscriptionServiceTestSuite struct {
+	suite.Suite
+	repo        *MockSubscriptionRepository
+	productRepo *MockProductRepository
+	prices      *MockPriceResolver
+	now         time.Time
+	service     SubscriptionService
+}
+
+func (s *SubscriptionServiceTestSuite) SetupTest() {
+	s.repo = new(MockSubscriptionRepository)
+	s.productRepo = new(MockProductRepository)
+	s.prices = new(MockPriceResolver)
+	s.now = time.Date(2026, 6, 10, 14, 0, 0, 0, time.UTC)
+	s.service = NewSubscriptionService(s.repo, s.productRepo, s.prices, WithSubscriptionTaxCalculator(flatTax{rate: big.NewRat(1, 10)}))
+	s.service.(*subscriptionService).now = func() time.Time { return s.now }
+}
+
+func (s *SubscriptionServiceTestSuite) TearDownTest() {
+	s.repo.AssertExpectations(s.T())
+	s.productRepo.AssertExpectations(s.T())
+	s.prices.AssertExpectations(s.T())
+}
+
+func TestSubscriptionServiceSuite(t *testing.T) {
+	suite.Run(t, new(SubscriptionServiceTestSuite))
+}
+
+// monthly is an active monthly subscription to one line at price, anchored
+// on anchor and billed up to next.
+func monthly(anchor, next *time.Time, price string) *Subscription {
+	subscription := &Subscription{
+		CustomerID:      uuid.New(),
+		Name:            "Registered agent",
+		Status:          SubscriptionStatusActive,
+		Interval:        BillingIntervalMonthly,
+		AnchorDate:      *anchor,
+		NextBillingDate: *next,
+		PaymentTerms:    PaymentTermsNet30,
+		Items:           []SubscriptionItem{{Description: "Registered agent service", Quantity: 1, UnitPrice: usd(price)}},
+	}
+	subscription.ID = uuid.New()
+	return subscription
+}
+
+func (s *SubscriptionServiceTestSuite) TestAddMonths_ClampsToEndOfShorterMonths() {
+	// Act
+	february := addMonths(*date(2026, 1, 31), 1)
+	april := addMonths(*date(2026, 1, 31), 3)
+	nextYear := addMonths(*date(2026, 1, 31), 12)
+
+	// Assert
+	s.Equal(*date(2026, 2, 28), february)
+	s.Equal(*date(2026, 4, 30), april)
+	s.Equal(*date(2027, 1, 31), nextYear)
+}
+
+func (s *SubscriptionServiceTestSuite) TestCycleAround_KeepsAnchorDayAfterShortMonth() {
+	// Arrange
+	subscription := monthly(date(2026, 1, 31), date(2026, 1, 31), "10.00")
+
+	// Act
+	start, end, ok, err := subscription.cycleAround(*date(2026, 3, 15))
+
+	// Assert
+	s.NoError(err)
+	s.True(ok)
+	s.Equal(*date(2026, 2, 28), start)
+	s.Equal(*date(2026, 3, 31), end)
+}
+
+func (s *SubscriptionServiceTestSuite) TestCreateSubscription_DefaultsAndPricesRecurringProducts() {
+	// Arrange
+	ctx := context.Background()
+	customerID, productID := uuid.New(), uuid.New()
+	input := Subscription{
+		CustomerID: customerID,
+		Name:       " Compliance retainer ",
+		Interval:   BillingIntervalQuarterly,
+		Status:     SubscriptionStatusCancelled, // ignored
+		Items:      []SubscriptionItem{{ProductID: &productID, Quantity: 1}},
+	}
+
+	product := &Product{Name: "Annual report filing", Status: ProductStatusActive, IsRecurring: true}
+	product.ID = productID
+	s.productRepo.On("GetProductByID", ctx, productID).Return(product, nil)
+	s.prices.On("ResolvePrice", ctx, customerID, productID, *date(2026, 6, 10)).Return(&ResolvedPrice{Price: usd("150.00")}, nil)
+
+	var saved Subscription
+	s.repo.On("CreateSubscription", ctx, mock.AnythingOfType("Subscription")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Subscription)
+	}).Return(&Subscription{}, nil)
+
+	// Act
+	_, err := s.service.CreateSubscription(ctx, input)
+
+	// Assert
+	s.NoError(err)
+	s.Equal("Compliance retainer", saved.Name)
+	s.Equal(SubscriptionKindSubscription, saved.Kind)
+	s.Equal(SubscriptionStatusActive, saved.Status)
+	s.Equal(PaymentTermsNet30, saved.PaymentTerms)
+	s.Equal(*date(2026, 6, 10), saved.AnchorDate)
+	s.Equal(saved.AnchorDate, saved.NextBillingDate)
+	s.Equal(usd("150.00"), saved.Items[0].UnitPrice)
+	s.Equal("Annual report filing", saved.Items[0].Description)
+}
+
+func (s *SubscriptionServiceTestSuite) TestCreateSubscription_RejectsOneOffProduct() {
+	// Arrange
+	ctx := context.Background()
+	productID := uuid.New()
+
+	product := &Product{Status: ProductStatusActive}
+	product.ID = productID
+	s.productRepo.On("GetProductByID", ctx, productID).Return(product, nil)
+
+	// Act
+	_, err := s.service.CreateSubscription(ctx, Subscription{
+		CustomerID: uuid.New(),
+		Name:       "Formation",
+		Interval:   BillingIntervalMonthly,
+		Items:      []SubscriptionItem{{ProductID: &productID, Quantity: 1}},
+	})
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidSubscription)
+	s.repo.AssertNotCalled(s.T(), "CreateSubscription", mock.Anything, mock.Anything)
+}
+
+func (s *SubscriptionServiceTestSuite) TestChangeSubscriptionItems_ProratesRestOfBilledCycle() {
+	// Arrange
+	ctx := context.Background()
+	existing := monthly(date(2026, 6, 1), date(2026, 7, 1), "300.00")
+	items := []SubscriptionItem{{Description: "Registered agent service, premium", Quantity: 1, UnitPrice: usd("600.00")}}
+
+	s.repo.On("GetSubscriptionByID", ctx, existing.ID).Return(existing, nil)
+	var adjustments []SubscriptionAdjustment
+	s.repo.On("UpdateSubscription", ctx, mock.AnythingOfType("Subscription"), *existing, mock.Anything).Run(func(args mock.Arguments) {
+		adjustments = args.Get(3).([]SubscriptionAdjustment)
+	}).Return(&Subscription{}, nil)
+
+	// Act
+	_, err := s.service.ChangeSubscriptionItems(ctx, existing.ID, items)
+
+	// Assert
+	s.NoError(err)
+	s.Require().Len(adjustments, 2)
+	s.Equal(usd("210.00").Neg(), adjustments[0].Amount) // 21 of 30 days at 300.00
+	s.Equal("Unused time on previous items, 2026-06-10 to 2026-06-30", adjustments[0].Description)
+	s.Equal(usd("420.00"), adjustments[1].Amount)
+	s.Equal(*date(2026, 6, 10), adjustments[1].EffectiveDate)
+}
+
+func (s *SubscriptionServiceTestSuite) TestChangeSubscriptionItems_NoProrationBeforeFirstCycle() {
+	// Arrange
+	ctx := context.Background()
+	existing := monthly(date(2026, 7, 1), date(2026, 7, 1), "300.00")
+	items := []SubscriptionItem{{Description: "Registered agent service", Quantity: 2, UnitPrice: usd("300.00")}}
+
+	s.repo.On("GetSubscriptionByID", ctx, existing.ID).Return(existing, nil)
+	s.repo.On("UpdateSubscription", ctx, mock.MatchedBy(func(updated Subscription) bool {
+		return updated.Items[0].Quantity == 2
+	}), *existing, []SubscriptionAdjustment(nil)).Return(&Subscription{}, nil)
+
+	// Act
+	_, err := s.service.ChangeSubscriptionItems(ctx, existing.ID, items)
+
+	// Assert
+	s.NoError(err)
+}
+
+func (s *SubscriptionServiceTestSuite) TestResumeSubscription_SkipsMissedCyclesAndChargesRestOfCurrent() {
+	// Arrange
+	ctx := context.Background()
+	existing := monthly(date(2026, 3, 5), date(2026, 4, 5), "300.00")
+	existing.Status = SubscriptionStatusPaused
+
+	s.repo.On("GetSubscriptionByID", ctx, existing.ID).Return(existing, nil)
+	var saved Subscription
+	var adjustments []SubscriptionAdjustment
+	s.repo.On("UpdateSubscription", ctx, mock.AnythingOfType("Subscription"), *existing, mock.Anything).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Subscription)
+		adjustments = args.Get(3).([]SubscriptionAdjustment)
+	}).Return(&Subscription{}, nil)
+
+	// Act
+	_, err := s.service.ResumeSubscription(ctx, existing.ID)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(SubscriptionStatusActive, saved.Status)
+	s.Equal(*date(2026, 7, 5), saved.NextBillingDate)
+	s.Require().Len(adjustments, 1)
+	s.Equal(usd("250.00"), adjustments[0].Amount) // 25 of 30 days
+	s.Equal("Resumed, 2026-06-10 to 2026-07-04", adjustments[0].Description)
+}
+
+func (s *SubscriptionServiceTestSuite) TestCancelSubscription_AtPeriodEndKeepsItActive() {
+	// Arrange
+	ctx := context.Background()
+	existing := monthly(date(2026, 6, 1), date(2026, 7, 1), "300.00")
+
+	s.repo.On("GetSubscriptionByID", ctx, existing.ID).Return(existing, nil)
+	var saved Subscription
+	s.repo.On("UpdateSubscription", ctx, mock.AnythingOfType("Subscription"), *existing, []SubscriptionAdjustment(nil)).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(Subscription)
+	}).Return(&Subscription{}, nil)
+
+	// Act
+	_, err := s.service.CancelSubscription(ctx, existing.ID, true)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(SubscriptionStatusActive, saved.Status)
+	s.Equal(date(2026, 7, 1), saved.CancelAt)
+	s.Nil(saved.CancelledAt)
+}
+
+func (s *SubscriptionServiceTestSuite) TestBillDueSubscriptions_CatchesUpOnMissedCycles() {
+	// Arrange
+	ctx := context.Background()
+	subscription := monthly(date(2026, 4, 1), date(2026, 4, 1), "100.00")
+	credit := SubscriptionAdjustment{Description: "Goodwill credit", Amount: usd("30.00").Neg(), EffectiveDate: *date(2026, 3, 20)}
+	credit.ID = uuid.New()
+	subscription.Adjustments = []SubscriptionAdjustment{credit}
+
+	s.repo.On("GetDueSubscriptions", ctx, *date(2026, 6, 10)).Return([]*Subscription{subscription}, nil)
+	var cycles []SubscriptionCycle
+	var invoices []Invoice
+	var billed [][]SubscriptionAdjustment
+	s.repo.On("BillSubscriptionCycle", ctx, mock.AnythingOfType("SubscriptionCycle"), mock.AnythingOfType("Invoice"), mock.Anything).Run(func(args mock.Arguments) {
+		cycles = append(cycles, args.Get(1).(SubscriptionCycle))
+		invoices = append(invoices, args.Get(2).(Invoice))
+		billed = append(billed, args.Get(3).([]SubscriptionAdjustment))
+	}).Return(&Invoice{}, nil)
+
+	// Act
+	run, err := s.service.BillDueSubscriptions(ctx, s.now)
+
+	// Assert
+	s.NoError(err)
+	s.Len(run.Invoices, 3)
+	s.Empty(run.Failures)
+	s.Require().Len(cycles, 3)
+	s.Equal(*date(2026, 4, 1), cycles[0].PeriodStart)
+	s.Equal(*date(2026, 5, 1), cycles[0].PeriodEnd)
+	s.Equal(*date(2026, 6, 1), cycles[2].PeriodStart)
+	s.Equal(date(2026, 4, 1), invoices[0].IssueDate)
+	s.Equal(date(2026, 5, 1), invoices[0].DueDate)
+	s.Equal(InvoiceStatusSent, invoices[0].Status)
+	s.Equal(usd("77.00"), invoices[0].Total) // 100.00 less 30.00, plus 10% tax
+	s.Equal([]SubscriptionAdjustment{credit}, billed[0])
+	s.Equal(usd("110.00"), invoices[1].Total)
+	s.Empty(billed[1])
+	s.Equal("Registered agent service, 2026-05-01 to 2026-05-31", invoices[1].Items[0].Description)
+}
+
+func (s *SubscriptionServiceTestSuite) TestBillDueSubscriptions_SkipsCycleBilledByAnotherRun() {
+	// Arrange
+	ctx := context.Background()
+	subscription := monthly(date(2026, 6, 1), date(2026, 6, 1), "100.00")
+	reloaded := *subscription
+	reloaded.NextBillingDate = *date(2026, 7, 1)
+
+	s.repo.On("GetDueSubscriptions", ctx, *date(2026, 6, 10)).Return([]*Subscription{subscription}, nil)
+	s.repo.On("BillSubscriptionCycle", ctx, mock.AnythingOfType("SubscriptionCycle"), mock.AnythingOfType("Invoice"), mock.Anything).Return(nil, ErrCycleAlreadyBilled).Once()
+	s.repo.On("GetSubscriptionByID", ctx, subscription.ID).Return(&reloaded, nil)
+
+	// Act
+	run, err := s.service.BillDueSubscriptions(ctx, s.now)
+
+	// Assert
+	s.NoError(err)
+	s.Empty(run.Invoices)
+	s.Empty(run.Failures)
+}
+
+func (s *SubscriptionServiceTestSuite) TestBillDueSubscriptions_HoldsBackCreditLargerThanInvoice() {
+	// Arrange
+	ctx := context.Background()
+	subscription := monthly(date(2026, 6, 1), date(2026, 6, 1), "100.00")
+	credit := SubscriptionAdjustment{Description: "Downgrade credit", Amount: usd("150.00").Neg(), EffectiveDate: *date(2026, 5, 20)}
+	credit.ID = uuid.New()
+	subscription.Adjustments = []SubscriptionAdjustment{credit}
+
+	s.repo.On("GetDueSubscriptions", ctx, *date(2026, 6, 10)).Return([]*Subscription{subscription}, nil)
+	s.repo.On("BillSubscriptionCycle", ctx, mock.AnythingOfType("SubscriptionCycle"), mock.MatchedBy(func(invoice Invoice) bool {
+		return invoice.Total == usd("110.00") && len(invoice.Items) == 1
+	}), []SubscriptionAdjustment(nil)).Return(&Invoice{}, nil)
+
+	// Act
+	run, err := s.service.BillDueSubscriptions(ctx, s.now)
+
+	// Assert
+	s.NoError(err)
+	s.Len(run.Invoices, 1)
+}
+
+func (s *SubscriptionServiceTestSuite) TestBillDueSubscriptions_CancelsAtPeriodEnd() {
+	// Arrange
+	ctx := context.Background()
+	subscription := monthly(date(2026, 5, 1), date(2026, 6, 1), "100.00")
+	subscription.CancelAt = date(2026, 6, 1)
+
+	s.repo.On("GetDueSubscriptions", ctx, *date(2026, 6, 10)).Return([]*Subscription{subscription}, nil)
+	s.repo.On("UpdateSubscription", ctx, mock.MatchedBy(func(updated Subscription) bool {
+		return updated.Status == SubscriptionStatusCancelled && updated.CancelledAt.Equal(*date(2026, 6, 1))
+	}), *subscription, []SubscriptionAdjustment(nil)).Return(&Subscription{}, nil)
+
+	// Act
+	run, err := s.service.BillDueSubscriptions(ctx, s.now)
+
+	// Assert
+	s.NoError(err)
+	s.Empty(run.Invoices)
+	s.Equal([]uuid.UUID{subscription.ID}, run.Cancelled)
+	s.repo.AssertNotCalled(s.T(), "BillSubscriptionCycle", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
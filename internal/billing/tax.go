@@ -0,0 +1,201 @@
+package billing
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidTaxCategory = errors.New("unknown tax category")
+	ErrInvalidTaxRate     = errors.New("invalid tax rate")
+	ErrExemptionNotFound  = errors.New("tax exemption certificate not found")
+	ErrInvalidExemption   = errors.New("tax exemption certificate requires a customer, a certificate number and a valid date range")
+)
+
+// TaxCategory is a product's taxability class. Rate tables can set a
+// different rate per category, so a state that exempts professional
+// services lists them at 0.
+type TaxCategory string
+
+const (
+	TaxCategoryGeneral              TaxCategory = "general"
+	TaxCategoryProfessionalServices TaxCategory = "professional_services"
+	TaxCategoryDigital              TaxCategory = "digital"
+	TaxCategoryExempt               TaxCategory = "exempt" // Never taxed, whatever the rate table says
+)
+
+func (c TaxCategory) Valid() bool {
+	switch c {
+	case TaxCategoryGeneral, TaxCategoryProfessionalServices, TaxCategoryDigital, TaxCategoryExempt:
+		return true
+	}
+	return false
+}
+
+// TaxRate is the combined rate for a jurisdiction. An empty PostalCode
+// covers the whole state and an empty Category covers every category;
+// more specific rows win.
+type TaxRate struct {
+	State      string
+	PostalCode string
+	Category   TaxCategory
+	Rate       *big.Rat // Fraction of the line amount, e.g. 53/1000 for 5.3%
+}
+
+type taxRateKey struct {
+	state, postalCode string
+	category          TaxCategory
+}
+
+// TaxRateTable looks up rates by jurisdiction. It is read-only once built
+// and safe for concurrent use.
+type TaxRateTable struct {
+	rates map[taxRateKey]*big.Rat
+}
+
+// NewTaxRateTable indexes rates, rejecting duplicates so that a typo in a
+// rate file cannot silently shadow another row.
+func NewTaxRateTable(rates []TaxRate) (*TaxRateTable, error) {
+	table := &TaxRateTable{rates: make(map[taxRateKey]*big.Rat, len(rates))}
+	for i, rate := range rates {
+		key := taxRateKey{normalizeState(rate.State), normalizePostalCode(rate.PostalCode), rate.Category}
+		switch {
+		case key.state == "":
+			return nil, fmt.Errorf("%w: rate %d has no state", ErrInvalidTaxRate, i+1)
+		case key.category != "" && !key.category.Valid():
+			return nil, fmt.Errorf("%w: rate %d: %w %q", ErrInvalidTaxRate, i+1, ErrInvalidTaxCategory, key.category)
+		case rate.Rate == nil || rate.Rate.Sign() < 0 || rate.Rate.Cmp(big.NewRat(1, 1)) >= 0:
+			return nil, fmt.Errorf("%w: rate %d must be at least 0%% and below 100%%", ErrInvalidTaxRate, i+1)
+		}
+		if _, ok := table.rates[key]; ok {
+			return nil, fmt.Errorf("%w: rate %d repeats %s %s %s", ErrInvalidTaxRate, i+1, key.state, key.postalCode, key.category)
+		}
+		table.rates[key] = rate.Rate
+	}
+	return table, nil
+}
+
+// Lookup returns the rate for a line of the given category shipped to the
+// given state and postal code, preferring postal code over state and a
+// category-specific rate over the default. ok is false when the table has
+// no rate for the state, i.e. it is not a taxing jurisdiction.
+func (t *TaxRateTable) Lookup(state, postalCode string, category TaxCategory) (rate *big.Rat, ok bool) {
+	state, postalCode = normalizeState(state), normalizePostalCode(postalCode)
+	candidates := []taxRateKey{
+		{state, postalCode, category},
+		{state, postalCode, ""},
+		{state, "", category},
+		{state, "", ""},
+	}
+	for _, key := range candidates {
+		if rate, ok := t.rates[key]; ok {
+			return rate, true
+		}
+	}
+	return nil, false
+}
+
+func normalizeState(state string) string {
+	return strings.ToUpper(strings.TrimSpace(state))
+}
+
+// normalizePostalCode keeps the five-digit ZIP of a ZIP+4 code.
+func normalizePostalCode(code string) string {
+	code = strings.TrimSpace(code)
+	if zip, _, ok := strings.Cut(code, "-"); ok {
+		code = zip
+	}
+	return strings.ToUpper(code)
+}
+
+// ReadTaxRatesCSV parses a rate table with the header
+// state,postal_code,category,rate where rate is a percentage such as 5.3.
+// postal_code and category may be left empty.
+func ReadTaxRatesCSV(r io.Reader) (*TaxRateTable, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTaxRate, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidTaxRate)
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"state", "postal_code", "category", "rate"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", ErrInvalidTaxRate, name)
+		}
+	}
+
+	rates := make([]TaxRate, 0, len(records)-1)
+	for i, record := range records[1:] {
+		percent, ok := new(big.Rat).SetString(strings.TrimSpace(record[columns["rate"]]))
+		if !ok {
+			return nil, fmt.Errorf("%w: line %d: rate %q is not a number", ErrInvalidTaxRate, i+2, record[columns["rate"]])
+		}
+		rates = append(rates, TaxRate{
+			State:      record[columns["state"]],
+			PostalCode: record[columns["postal_code"]],
+			Category:   TaxCategory(strings.TrimSpace(record[columns["category"]])),
+			Rate:       percent.Quo(percent, big.NewRat(100, 1)),
+		})
+	}
+	return NewTaxRateTable(rates)
+}
+
+// LoadTaxRatesFile reads a rate table from a local CSV file.
+func LoadTaxRatesFile(path string) (*TaxRateTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTaxRatesCSV(f)
+}
+
+// ExemptionCertificate exempts a customer's purchases from sales tax in a
+// state, or in every state when State is empty, between IssuedOn and
+// ExpiresOn inclusive. A certificate without ExpiresOn does not expire.
+type ExemptionCertificate struct {
+	core.BaseModel
+	CustomerID        uuid.UUID  `json:"customer_id"`
+	CertificateNumber string     `json:"certificate_number"`
+	State             string     `json:"state"`
+	Reason            string     `json:"reason"` // e.g. resale, nonprofit, government
+	IssuedOn          time.Time  `json:"issued_on"`
+	ExpiresOn         *time.Time `json:"expires_on"`
+}
+
+func (c ExemptionCertificate) Validate() error {
+	if c.CustomerID == uuid.Nil || strings.TrimSpace(c.CertificateNumber) == "" || c.IssuedOn.IsZero() {
+		return ErrInvalidExemption
+	}
+	if c.ExpiresOn != nil && c.ExpiresOn.Before(c.IssuedOn) {
+		return ErrInvalidExemption
+	}
+	return nil
+}
+
+// Covers reports whether the certificate exempts a sale into state on date.
+func (c ExemptionCertificate) Covers(state string, on time.Time) bool {
+	if c.State != "" && normalizeState(c.State) != normalizeState(state) {
+		return false
+	}
+	on = dateOnly(on)
+	if on.Before(dateOnly(c.IssuedOn)) {
+		return false
+	}
+	return c.ExpiresOn == nil || !on.After(dateOnly(*c.ExpiresOn))
+}
@@ -0,0 +1,99 @@
+package billing
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type exemptionCertificateHandler struct {
+	service TaxExemptionService
+}
+
+// NewExemptionCertificateHandler serves tax exemption certificates: GET by
+// ?id= or ?customer_id=, POST to create one, PUT to update one and DELETE
+// ?id=.
+func NewExemptionCertificateHandler(service TaxExemptionService) http.Handler {
+	return &exemptionCertificateHandler{service: service}
+}
+
+func (h *exemptionCertificateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getCertificates(w, r)
+	case http.MethodPost:
+		h.createCertificate(w, r)
+	case http.MethodPut:
+		h.updateCertificate(w, r)
+	case http.MethodDelete:
+		h.deleteCertificate(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *exemptionCertificateHandler) getCertificates(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("id") {
+		id, ok := queryUUID(w, r, "id")
+		if !ok {
+			return
+		}
+		certificate, err := h.service.GetExemptionCertificateByID(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(certificate)
+		return
+	}
+	customerID, ok := queryUUID(w, r, "customer_id")
+	if !ok {
+		return
+	}
+	certificates, err := h.service.GetExemptionCertificatesByCustomerID(r.Context(), customerID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(certificates)
+}
+
+func (h *exemptionCertificateHandler) createCertificate(w http.ResponseWriter, r *http.Request) {
+	var certificate ExemptionCertificate
+	if err := json.NewDecoder(r.Body).Decode(&certificate); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	created, err := h.service.CreateExemptionCertificate(r.Context(), certificate)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *exemptionCertificateHandler) updateCertificate(w http.ResponseWriter, r *http.Request) {
+	var certificate ExemptionCertificate
+	if err := json.NewDecoder(r.Body).Decode(&certificate); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updated, err := h.service.UpdateExemptionCertificate(r.Context(), certificate)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *exemptionCertificateHandler) deleteCertificate(w http.ResponseWriter, r *http.Request) {
+	id, ok := queryUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteExemptionCertificate(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Exemption certificate deleted successfully"})
+}
@@ -0,0 +1,71 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+type taxExemptionRepository struct {
+	db *sql.DB
+}
+
+func NewTaxExemptionRepository(db *sql.DB) TaxExemptionRepository {
+	return &taxExemptionRepository{db: db}
+}
+
+const exemptionCertificateColumns = "id, customer_id, certificate_number, state, reason, issued_on, expires_on, created_at, updated_at"
+
+func scanExemptionCertificate(row rowScanner) (*ExemptionCertificate, error) {
+	var certificate ExemptionCertificate
+	err := row.Scan(&certificate.ID, &certificate.CustomerID, &certificate.CertificateNumber, &certificate.State, &certificate.Reason, &certificate.IssuedOn, &certificate.ExpiresOn, &certificate.CreatedAt, &certificate.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrExemptionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+func (r *taxExemptionRepository) GetExemptionCertificateByID(ctx context.Context, id uuid.UUID) (*ExemptionCertificate, error) {
+	return scanExemptionCertificate(r.db.QueryRowContext(ctx, "SELECT "+exemptionCertificateColumns+" FROM tax_exemption_certificates WHERE id = $1", id))
+}
+
+func (r *taxExemptionRepository) GetExemptionCertificatesByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*ExemptionCertificate, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+exemptionCertificateColumns+" FROM tax_exemption_certificates WHERE customer_id = $1 ORDER BY issued_on, id", customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var certificates []*ExemptionCertificate
+	for rows.Next() {
+		certificate, err := scanExemptionCertificate(rows)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	return certificates, rows.Err()
+}
+
+func (r *taxExemptionRepository) CreateExemptionCertificate(ctx context.Context, certificate ExemptionCertificate) (*ExemptionCertificate, error) {
+	if certificate.ID == uuid.Nil {
+		certificate.ID = uuid.New()
+	}
+	return scanExemptionCertificate(r.db.QueryRowContext(ctx, "INSERT INTO tax_exemption_certificates (id, customer_id, certificate_number, state, reason, issued_on, expires_on) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING "+exemptionCertificateColumns,
+		certificate.ID, certificate.CustomerID, certificate.CertificateNumber, certificate.State, certificate.Reason, certificate.IssuedOn, certificate.ExpiresOn))
+}
+
+func (r *taxExemptionRepository) UpdateExemptionCertificate(ctx context.Context, certificate ExemptionCertificate) (*ExemptionCertificate, error) {
+	return scanExemptionCertificate(r.db.QueryRowContext(ctx, "UPDATE tax_exemption_certificates SET certificate_number = $1, state = $2, reason = $3, issued_on = $4, expires_on = $5, updated_at = CURRENT_TIMESTAMP WHERE id = $6 RETURNING "+exemptionCertificateColumns,
+		certificate.CertificateNumber, certificate.State, certificate.Reason, certificate.IssuedOn, certificate.ExpiresOn, certificate.ID))
+}
+
+func (r *taxExemptionRepository) DeleteExemptionCertificate(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM tax_exemption_certificates WHERE id = $1", id)
+	return err
+}
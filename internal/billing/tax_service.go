@@ -0,0 +1,157 @@
+package billing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+)
+
+type TaxExemptionService interface {
+	ExemptionCertificateManager
+}
+
+type TaxExemptionRepository interface {
+	ExemptionCertificateManager
+}
+
+type ExemptionCertificateManager interface {
+	ExemptionCertificateRetriever
+	ExemptionCertificateLister
+	ExemptionCertificateCreator
+	ExemptionCertificateUpdater
+	ExemptionCertificateDeleter
+}
+
+type ExemptionCertificateRetriever interface {
+	GetExemptionCertificateByID(ctx context.Context, id uuid.UUID) (*ExemptionCertificate, error)
+}
+
+type ExemptionCertificateLister interface {
+	GetExemptionCertificatesByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*ExemptionCertificate, error)
+}
+
+type ExemptionCertificateCreator interface {
+	CreateExemptionCertificate(ctx context.Context, certificate ExemptionCertificate) (*ExemptionCertificate, error)
+}
+
+type ExemptionCertificateUpdater interface {
+	UpdateExemptionCertificate(ctx context.Context, certificate ExemptionCertificate) (*ExemptionCertificate, error)
+}
+
+type ExemptionCertificateDeleter interface {
+	DeleteExemptionCertificate(ctx context.Context, id uuid.UUID) error
+}
+
+type taxExemptionService struct {
+	repo TaxExemptionRepository
+}
+
+func NewTaxExemptionService(repo TaxExemptionRepository) TaxExemptionService {
+	return &taxExemptionService{repo: repo}
+}
+
+func (s *taxExemptionService) GetExemptionCertificateByID(ctx context.Context, id uuid.UUID) (*ExemptionCertificate, error) {
+	return s.repo.GetExemptionCertificateByID(ctx, id)
+}
+
+func (s *taxExemptionService) GetExemptionCertificatesByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*ExemptionCertificate, error) {
+	return s.repo.GetExemptionCertificatesByCustomerID(ctx, customerID)
+}
+
+func (s *taxExemptionService) CreateExemptionCertificate(ctx context.Context, certificate ExemptionCertificate) (*ExemptionCertificate, error) {
+	normalizeExemption(&certificate)
+	if err := certificate.Validate(); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateExemptionCertificate(ctx, certificate)
+}
+
+func (s *taxExemptionService) UpdateExemptionCertificate(ctx context.Context, certificate ExemptionCertificate) (*ExemptionCertificate, error) {
+	existing, err := s.repo.GetExemptionCertificateByID(ctx, certificate.ID)
+	if err != nil {
+		return nil, err
+	}
+	certificate.CustomerID = existing.CustomerID
+	normalizeExemption(&certificate)
+	if err := certificate.Validate(); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateExemptionCertificate(ctx, certificate)
+}
+
+func (s *taxExemptionService) DeleteExemptionCertificate(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteExemptionCertificate(ctx, id)
+}
+
+func normalizeExemption(certificate *ExemptionCertificate) {
+	certificate.CertificateNumber = strings.TrimSpace(certificate.CertificateNumber)
+	certificate.State = normalizeState(certificate.State)
+	certificate.IssuedOn = dateOnly(certificate.IssuedOn)
+	if certificate.ExpiresOn != nil {
+		expires := dateOnly(*certificate.ExpiresOn)
+		certificate.ExpiresOn = &expires
+	}
+}
+
+type taxEngine struct {
+	rates      *TaxRateTable
+	products   ProductRetriever
+	addresses  customers.AddressRetriever
+	exemptions ExemptionCertificateLister
+}
+
+// NewTaxEngine returns a TaxCalculator that taxes each line at the rate for
+// its address's state and postal code and its product's tax category. Lines
+// are tax free when they have no address, the state is not in the rate
+// table, the product is exempt or the customer holds an exemption
+// certificate for the state valid on the line date. Tax is rounded half up
+// per line.
+func NewTaxEngine(rates *TaxRateTable, products ProductRetriever, addresses customers.AddressRetriever, exemptions ExemptionCertificateLister) TaxCalculator {
+	return &taxEngine{rates: rates, products: products, addresses: addresses, exemptions: exemptions}
+}
+
+func (e *taxEngine) LineTax(ctx context.Context, line TaxableLine) (core.Money, error) {
+	none := core.Zero(line.Amount.Currency())
+	if line.AddressID == nil || line.Amount.IsZero() {
+		return none, nil
+	}
+
+	category := TaxCategoryGeneral
+	if line.ProductID != nil {
+		product, err := e.products.GetProductByID(ctx, *line.ProductID)
+		if err != nil {
+			return core.Money{}, err
+		}
+		if product.TaxCategory != "" {
+			category = product.TaxCategory
+		}
+	}
+	if category == TaxCategoryExempt {
+		return none, nil
+	}
+
+	address, err := e.addresses.GetAddressByID(ctx, *line.AddressID)
+	if err != nil {
+		return core.Money{}, fmt.Errorf("failed to load tax address: %w", err)
+	}
+	rate, ok := e.rates.Lookup(address.State, address.PostalCode, category)
+	if !ok || rate.Sign() == 0 {
+		return none, nil
+	}
+
+	certificates, err := e.exemptions.GetExemptionCertificatesByCustomerID(ctx, line.CustomerID)
+	if err != nil {
+		return core.Money{}, err
+	}
+	for _, certificate := range certificates {
+		if certificate.Covers(address.State, line.Date) {
+			return none, nil
+		}
+	}
+	return line.Amount.Mul(rate, core.RoundHalfUp)
+}
@@ -0,0 +1,206 @@
+package billing
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockExemptionCertificateLister struct {
+	mock.Mock
+}
+
+func (m *MockExemptionCertificateLister) GetExemptionCertificatesByCustomerID(ctx context.Context, customerID uuid.UUID) ([]*ExemptionCertificate, error) {
+	args := m.Called(ctx, customerID)
+	certificates, _ := args.Get(0).([]*ExemptionCertificate)
+	return certificates, args.Error(1)
+}
+
+const testTaxRates = `state,postal_code,category,rate
+VA,,,5.3
+VA,,professional_services,0
+VA,22314,,6
+NC,,,4.75
+`
+
+type TaxEngineTestSuite struct {
+	suite.Suite
+	products   *MockProductRepository
+	addresses  *MockAddressRetriever
+	exemptions *MockExemptionCertificateLister
+	engine     TaxCalculator
+
+	customerID, productID, addressID uuid.UUID
+	on                               time.Time
+}
+
+func (s *TaxEngineTestSuite) SetupTest() {
+	rates, err := ReadTaxRatesCSV(strings.NewReader(testTaxRates))
+	s.Require().NoError(err)
+	s.products = new(MockProductRepository)
+	s.addresses = new(MockAddressRetriever)
+	s.exemptions = new(MockExemptionCertificateLister)
+	s.engine = NewTaxEngine(rates, s.products, s.addresses, s.exemptions)
+
+	s.customerID, s.productID, s.addressID = uuid.New(), uuid.New(), uuid.New()
+	s.on = time.Date(2026, 6, 15, 14, 0, 0, 0, time.UTC)
+}
+
+func (s *TaxEngineTestSuite) TearDownTest() {
+	s.products.AssertExpectations(s.T())
+	s.addresses.AssertExpectations(s.T())
+	s.exemptions.AssertExpectations(s.T())
+}
+
+func TestTaxEngineSuite(t *testing.T) {
+	suite.Run(t, new(TaxEngineTestSuite))
+}
+
+func (s *TaxEngineTestSuite) line(amount string) TaxableLine {
+	return TaxableLine{CustomerID: s.customerID, ProductID: &s.productID, AddressID: &s.addressID, Date: s.on, Amount: usd(amount)}
+}
+
+// arrange sets up the product's category and the line's address.
+func (s *TaxEngineTestSuite) arrange(ctx context.Context, category TaxCategory, state, postalCode string) {
+	s.products.On("GetProductByID", ctx, s.productID).Return(&Product{TaxCategory: category}, nil)
+	s.addresses.On("GetAddressByID", ctx, s.addressID).Return(&customers.Address{State: state, PostalCode: postalCode}, nil)
+}
+
+func (s *TaxEngineTestSuite) TestLineTax_StateRateRoundsHalfUp() {
+	// Arrange
+	ctx := context.Background()
+	s.arrange(ctx, TaxCategoryGeneral, "va", "23220")
+	s.exemptions.On("GetExemptionCertificatesByCustomerID", ctx, s.customerID).Return(nil, nil)
+
+	// Act
+	tax, err := s.engine.LineTax(ctx, s.line("10.50"))
+
+	// Assert
+	s.NoError(err)
+	s.Equal(usd("0.56"), tax) // 0.5565
+}
+
+func (s *TaxEngineTestSuite) TestLineTax_PostalCodeOverridesState() {
+	// Arrange
+	ctx := context.Background()
+	s.arrange(ctx, TaxCategoryGeneral, "VA", "22314-1234")
+	s.exemptions.On("GetExemptionCertificatesByCustomerID", ctx, s.customerID).Return(nil, nil)
+
+	// Act
+	tax, err := s.engine.LineTax(ctx, s.line("100.00"))
+
+	// Assert
+	s.NoError(err)
+	s.Equal(usd("6.00"), tax)
+}
+
+func (s *TaxEngineTestSuite) TestLineTax_CategoryExemptInState() {
+	// Arrange
+	ctx := context.Background()
+	s.arrange(ctx, TaxCategoryProfessionalServices, "VA", "23220")
+
+	// Act
+	tax, err := s.engine.LineTax(ctx, s.line("1500.00"))
+
+	// Assert
+	s.NoError(err)
+	s.True(tax.IsZero())
+}
+
+func (s *TaxEngineTestSuite) TestLineTax_UnlistedStateIsUntaxed() {
+	// Arrange
+	ctx := context.Background()
+	s.arrange(ctx, TaxCategoryGeneral, "OR", "97201")
+
+	// Act
+	tax, err := s.engine.LineTax(ctx, s.line("100.00"))
+
+	// Assert
+	s.NoError(err)
+	s.True(tax.IsZero())
+}
+
+func (s *TaxEngineTestSuite) TestLineTax_ExemptionCertificateHonouredUntilExpiry() {
+	// Arrange
+	ctx := context.Background()
+	s.arrange(ctx, TaxCategoryGeneral, "NC", "27601")
+	s.exemptions.On("GetExemptionCertificatesByCustomerID", ctx, s.customerID).Return([]*ExemptionCertificate{
+		{CustomerID: s.customerID, CertificateNumber: "VA-1", State: "VA", IssuedOn: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{CustomerID: s.customerID, CertificateNumber: "NC-1", State: "NC", IssuedOn: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), ExpiresOn: date(2026, 6, 15)},
+	}, nil)
+
+	// Act
+	onExpiry, err := s.engine.LineTax(ctx, s.line("100.00"))
+	s.Require().NoError(err)
+	line := s.line("100.00")
+	line.Date = s.on.AddDate(0, 0, 1)
+	afterExpiry, err := s.engine.LineTax(ctx, line)
+
+	// Assert
+	s.NoError(err)
+	s.True(onExpiry.IsZero())
+	s.Equal(usd("4.75"), afterExpiry)
+}
+
+func (s *TaxEngineTestSuite) TestLineTax_NoAddressIsUntaxed() {
+	// Arrange
+	line := s.line("100.00")
+	line.AddressID = nil
+
+	// Act
+	tax, err := s.engine.LineTax(context.Background(), line)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(core.Zero(core.USD), tax)
+}
+
+func TestReadTaxRatesCSV_RejectsBadRows(t *testing.T) {
+	cases := map[string]string{
+		"missing column": "state,rate\nVA,5.3\n",
+		"not a number":   "state,postal_code,category,rate\nVA,,,five\n",
+		"too high":       "state,postal_code,category,rate\nVA,,,100\n",
+		"duplicate":      "state,postal_code,category,rate\nVA,,,5.3\nva,,,5.3\n",
+		"bad category":   "state,postal_code,category,rate\nVA,,groceries,1\n",
+	}
+	for name, input := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ReadTaxRatesCSV(strings.NewReader(input))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestTaxRateTable_Lookup(t *testing.T) {
+	table, err := ReadTaxRatesCSV(strings.NewReader(testTaxRates))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		state, postalCode string
+		category          TaxCategory
+		want              *big.Rat
+	}{
+		{"VA", "23220", TaxCategoryGeneral, big.NewRat(53, 1000)},
+		{"VA", "22314", TaxCategoryProfessionalServices, big.NewRat(6, 100)}, // postal code beats category
+		{"VA", "", TaxCategoryProfessionalServices, new(big.Rat)},
+		{"NC", "27601", TaxCategoryDigital, big.NewRat(475, 10000)},
+	}
+	for _, c := range cases {
+		got, ok := table.Lookup(c.state, c.postalCode, c.category)
+		if !ok || got.Cmp(c.want) != 0 {
+			t.Errorf("Lookup(%s, %s, %s) = %v, %v; want %v", c.state, c.postalCode, c.category, got, ok, c.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// AllEvents subscribes a handler to every published event.
+const AllEvents = "*"
+
+// Event is something that happened in one module that others may react to.
+type Event interface {
+	EventName() string
+}
+
+type EventHandler func(ctx context.Context, event Event) error
+
+type EventPublisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+type EventSubscriber interface {
+	Subscribe(name string, handler EventHandler)
+}
+
+// EventBus delivers events synchronously, in subscription order, to the
+// handlers registered for the event's name and to AllEvents handlers.
+type EventBus struct {
+	mu       sync.RWMutex
+	handlers map[string][]EventHandler
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{handlers: make(map[string][]EventHandler)}
+}
+
+func (b *EventBus) Subscribe(name string, handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[name] = append(b.handlers[name], handler)
+}
+
+// Publish runs every matching handler, even if an earlier one fails, and
+// returns the joined handler errors.
+func (b *EventBus) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	handlers := append(append([]EventHandler{}, b.handlers[event.EventName()]...), b.handlers[AllEvents]...)
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,597 @@
+package core
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("money: currency mismatch")
+	ErrUnknownCurrency  = errors.New("money: unknown currency")
+	ErrInvalidAmount    = errors.New("money: invalid amount")
+	ErrAmountOverflow   = errors.New("money: amount overflows int64 minor units")
+	ErrInvalidRatios    = errors.New("money: allocation ratios must be non-negative and sum to more than zero")
+	ErrInvalidPercent   = errors.New("money: percentages have at most two decimal places")
+)
+
+// Currency is an ISO 4217 alphabetic currency code.
+type Currency string
+
+const (
+	USD Currency = "USD"
+	CAD Currency = "CAD"
+	EUR Currency = "EUR"
+	GBP Currency = "GBP"
+	AUD Currency = "AUD"
+	CHF Currency = "CHF"
+	MXN Currency = "MXN"
+	JPY Currency = "JPY"
+)
+
+// DefaultCurrency is used when an amount arrives without a currency, such as
+// a bare NUMERIC column or a legacy JSON number.
+const DefaultCurrency = USD
+
+// minorUnits is the ISO 4217 exponent of each supported currency.
+var minorUnits = map[Currency]int{
+	USD: 2,
+	CAD: 2,
+	EUR: 2,
+	GBP: 2,
+	AUD: 2,
+	CHF: 2,
+	MXN: 2,
+	JPY: 0,
+}
+
+// MinorUnits returns the number of decimal places the currency uses.
+func (c Currency) MinorUnits() (int, error) {
+	exp, ok := minorUnits[c]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, string(c))
+	}
+	return exp, nil
+}
+
+// Valid reports whether the currency is one we know the exponent of.
+func (c Currency) Valid() bool {
+	_, ok := minorUnits[c]
+	return ok
+}
+
+// RoundingMode decides what happens to a result that falls between two
+// minor units.
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds ties to the nearest even minor unit (banker's
+	// rounding). It is unbiased across many operations.
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds ties away from zero, the way invoices are usually
+	// rounded by hand.
+	RoundHalfUp
+)
+
+// Money is an exact amount held as integer minor units of a currency, e.g.
+// cents for USD. The zero value is zero with no currency and is compatible
+// with any currency in arithmetic, so it can be used as an accumulator.
+type Money struct {
+	amount   int64
+	currency Currency
+}
+
+// NewMoney returns minor units of the given currency.
+func NewMoney(minor int64, currency Currency) Money {
+	return Money{amount: minor, currency: currency}
+}
+
+// Zero returns zero in the given currency.
+func Zero(currency Currency) Money {
+	return Money{currency: currency}
+}
+
+// ParseMoney parses a decimal string such as "-1234.50". It fails if the
+// string carries more precision than the currency allows.
+func ParseMoney(s string, currency Currency) (Money, error) {
+	exp, err := currency.MinorUnits()
+	if err != nil {
+		return Money{}, err
+	}
+	minor, err := parseMinor(s, exp)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{amount: minor, currency: currency}, nil
+}
+
+// MustParseMoney is like ParseMoney but panics on error. It is intended for
+// constants and tests.
+func MustParseMoney(s string, currency Currency) Money {
+	m, err := ParseMoney(s, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// RoundMoney parses a decimal string of any precision and rounds it to the
+// currency's minor unit.
+func RoundMoney(s string, currency Currency, mode RoundingMode) (Money, error) {
+	exp, err := currency.MinorUnits()
+	if err != nil {
+		return Money{}, err
+	}
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	minor, err := roundRat(r.Mul(r, pow10Rat(exp)), mode)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{amount: minor, currency: currency}, nil
+}
+
+// Minor returns the amount in minor units.
+func (m Money) Minor() int64 {
+	return m.amount
+}
+
+// Currency returns the amount's currency, which is empty for the zero value.
+func (m Money) Currency() Currency {
+	return m.currency
+}
+
+// WithCurrency returns the same minor units tagged with another currency. It
+// does not convert; use it when the currency is stored separately from the
+// amount.
+func (m Money) WithCurrency(currency Currency) Money {
+	m.currency = currency
+	return m
+}
+
+// Reread returns the same decimal amount in currency, for amounts scanned
+// before the currency column of their row was known. Unlike WithCurrency it
+// keeps the value when the two currencies use different minor units.
+func (m Money) Reread(currency Currency) (Money, error) {
+	return ParseMoney(m.Decimal(), currency)
+}
+
+func (m Money) IsZero() bool {
+	return m.amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.amount < 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.amount > 0
+}
+
+// SameCurrency reports whether m and other can be combined. An untagged zero
+// is compatible with anything.
+func (m Money) SameCurrency(other Money) bool {
+	return m.currency == other.currency || m.untaggedZero() || other.untaggedZero()
+}
+
+func (m Money) untaggedZero() bool {
+	return m.currency == "" && m.amount == 0
+}
+
+func (m Money) resultCurrency(other Money) (Currency, error) {
+	if !m.SameCurrency(other) {
+		return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currency, other.currency)
+	}
+	if m.currency == "" {
+		return other.currency, nil
+	}
+	return m.currency, nil
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	currency, err := m.resultCurrency(other)
+	if err != nil {
+		return Money{}, err
+	}
+	sum := m.amount + other.amount
+	if (sum > m.amount) != (other.amount > 0) {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{amount: sum, currency: currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(other.Neg())
+}
+
+// Sum adds amounts that must all share a currency.
+func Sum(amounts ...Money) (Money, error) {
+	var total Money
+	for _, amount := range amounts {
+		var err error
+		if total, err = total.Add(amount); err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+func (m Money) Neg() Money {
+	return Money{amount: -m.amount, currency: m.currency}
+}
+
+func (m Money) Abs() Money {
+	if m.amount < 0 {
+		return m.Neg()
+	}
+	return m
+}
+
+// Cmp compares two amounts of the same currency, returning -1, 0 or +1.
+func (m Money) Cmp(other Money) (int, error) {
+	if _, err := m.resultCurrency(other); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.amount < other.amount:
+		return -1, nil
+	case m.amount > other.amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Min returns the smaller of two amounts of the same currency.
+func (m Money) Min(other Money) (Money, error) {
+	cmp, err := m.Cmp(other)
+	if err != nil {
+		return Money{}, err
+	}
+	if cmp <= 0 {
+		return m, nil
+	}
+	return other, nil
+}
+
+// Times multiplies by an integer quantity. It is exact.
+func (m Money) Times(quantity int64) (Money, error) {
+	product := new(big.Int).Mul(big.NewInt(m.amount), big.NewInt(quantity))
+	if !product.IsInt64() {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{amount: product.Int64(), currency: m.currency}, nil
+}
+
+// Mul multiplies by an arbitrary rational factor, such as a tax rate or a
+// discount percentage, and rounds to the minor unit.
+func (m Money) Mul(factor *big.Rat, mode RoundingMode) (Money, error) {
+	r := new(big.Rat).SetInt64(m.amount)
+	minor, err := roundRat(r.Mul(r, factor), mode)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{amount: minor, currency: m.currency}, nil
+}
+
+// PercentRate returns a percentage such as 12.5 as the factor 0.125 for Mul.
+// Percentages are stored as DECIMAL(5, 2), so one with more than two decimal
+// places fails with ErrInvalidPercent rather than being applied at a rate
+// other than the one stored.
+func PercentRate(percent float64) (*big.Rat, error) {
+	rate, ok := new(big.Rat).SetString(strconv.FormatFloat(percent, 'f', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPercent, percent)
+	}
+	if !new(big.Rat).Mul(rate, big.NewRat(100, 1)).IsInt() {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPercent, percent)
+	}
+	return rate.Quo(rate, big.NewRat(100, 1)), nil
+}
+
+// Convert returns the amount in currency to at rate units of to per unit of
+// m's currency, rounded to to's minor unit. The two currencies may use
+// different numbers of decimal places.
+func (m Money) Convert(rate *big.Rat, to Currency, mode RoundingMode) (Money, error) {
+	from := m.currency
+	if from == "" {
+		from = DefaultCurrency
+	}
+	fromExp, err := from.MinorUnits()
+	if err != nil {
+		return Money{}, err
+	}
+	toExp, err := to.MinorUnits()
+	if err != nil {
+		return Money{}, err
+	}
+	r := new(big.Rat).SetInt64(m.amount)
+	r.Mul(r, rate)
+	r.Mul(r, pow10Rat(toExp))
+	r.Quo(r, pow10Rat(fromExp))
+	minor, err := roundRat(r, mode)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{amount: minor, currency: to}, nil
+}
+
+// Allocate splits m in proportion to ratios without creating or losing minor
+// units. Remainders go to the shares with the largest fractional part, ties
+// to the earlier share, so the result is deterministic.
+func (m Money) Allocate(ratios ...int64) ([]Money, error) {
+	var total int64
+	for _, ratio := range ratios {
+		if ratio < 0 {
+			return nil, ErrInvalidRatios
+		}
+		total += ratio
+	}
+	if total <= 0 {
+		return nil, ErrInvalidRatios
+	}
+
+	abs := m.amount
+	if abs < 0 {
+		abs = -abs
+	}
+	bigAbs, bigTotal := big.NewInt(abs), big.NewInt(total)
+
+	shares := make([]Money, len(ratios))
+	remainders := make([]*big.Int, len(ratios))
+	allocated := int64(0)
+	for i, ratio := range ratios {
+		q, r := new(big.Int).QuoRem(new(big.Int).Mul(bigAbs, big.NewInt(ratio)), bigTotal, new(big.Int))
+		shares[i] = Money{amount: q.Int64(), currency: m.currency}
+		remainders[i] = r
+		allocated += q.Int64()
+	}
+
+	for left := abs - allocated; left > 0; left-- {
+		best := -1
+		for i, r := range remainders {
+			if ratios[i] == 0 {
+				continue
+			}
+			if best == -1 || r.Cmp(remainders[best]) > 0 {
+				best = i
+			}
+		}
+		shares[best].amount++
+		remainders[best] = big.NewInt(-1)
+	}
+
+	if m.amount < 0 {
+		for i := range shares {
+			shares[i].amount = -shares[i].amount
+		}
+	}
+	return shares, nil
+}
+
+// Split divides m into n shares that differ by at most one minor unit.
+func (m Money) Split(n int) ([]Money, error) {
+	ratios := make([]int64, n)
+	for i := range ratios {
+		ratios[i] = 1
+	}
+	return m.Allocate(ratios...)
+}
+
+// Decimal formats the amount as a plain decimal string, e.g. "-1234.50".
+func (m Money) Decimal() string {
+	exp := 2
+	if m.currency != "" {
+		if e, err := m.currency.MinorUnits(); err == nil {
+			exp = e
+		}
+	}
+	return formatMinor(m.amount, exp)
+}
+
+// String formats the amount with its currency code, e.g. "USD 1234.50".
+func (m Money) String() string {
+	currency := m.currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return string(currency) + " " + m.Decimal()
+}
+
+type moneyJSON struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency Currency        `json:"currency"`
+}
+
+// MarshalJSON encodes {"amount":"12.34","currency":"USD"}. The amount is a
+// string so clients never parse it as a float.
+func (m Money) MarshalJSON() ([]byte, error) {
+	currency := m.currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return json.Marshal(struct {
+		Amount   string   `json:"amount"`
+		Currency Currency `json:"currency"`
+	}{Amount: m.Decimal(), Currency: currency})
+}
+
+// UnmarshalJSON accepts the object form written by MarshalJSON. For older
+// clients it also accepts a bare number or string in DefaultCurrency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	var raw moneyJSON
+	if len(data) > 0 && data[0] == '{' {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+	} else {
+		raw.Amount = data
+	}
+	if raw.Currency == "" {
+		raw.Currency = DefaultCurrency
+	}
+
+	amount := string(raw.Amount)
+	if unquoted, err := strconv.Unquote(amount); err == nil {
+		amount = unquoted
+	}
+	parsed, err := ParseMoney(amount, raw.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores the amount in a NUMERIC column. The currency, if persisted,
+// lives in its own column.
+func (m Money) Value() (driver.Value, error) {
+	return m.Decimal(), nil
+}
+
+// Scan reads a NUMERIC column. The receiver's currency is kept if already
+// set, otherwise DefaultCurrency is assumed.
+func (m *Money) Scan(src any) error {
+	currency := m.currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*m = Zero(currency)
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case float64:
+		parsed, err := RoundMoney(strconv.FormatFloat(v, 'f', -1, 64), currency, RoundHalfEven)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidAmount, src)
+	}
+
+	parsed, err := ParseMoney(s, currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// parseMinor converts a plain decimal string to minor units with exp decimal
+// places. Extra fractional digits are only allowed if they are zeros, as in a
+// NUMERIC(10,2) column holding a zero-decimal currency.
+func parseMinor(s string, exp int) (int64, error) {
+	s = strings.TrimSpace(s)
+	invalid := fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	if s == "" {
+		return 0, invalid
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, invalid
+	}
+	if len(frac) > exp {
+		if strings.Trim(frac[exp:], "0") != "" {
+			return 0, fmt.Errorf("%w: %q has more than %d decimal places", ErrInvalidAmount, s, exp)
+		}
+		frac = frac[:exp]
+	}
+	digits := whole + frac + strings.Repeat("0", exp-len(frac))
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, invalid
+		}
+	}
+
+	minor, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, ErrAmountOverflow
+	}
+	if negative {
+		minor = -minor
+	}
+	return minor, nil
+}
+
+func formatMinor(minor int64, exp int) string {
+	sign := ""
+	abs := new(big.Int).SetInt64(minor)
+	if minor < 0 {
+		sign = "-"
+		abs.Neg(abs)
+	}
+	digits := abs.String()
+	if exp == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+func pow10Rat(exp int) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil))
+}
+
+func roundRat(r *big.Rat, mode RoundingMode) (int64, error) {
+	num, den := r.Num(), r.Denom()
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() != 0 {
+		twice := new(big.Int).Abs(rem)
+		twice.Lsh(twice, 1)
+		cmp := twice.Cmp(den)
+
+		awayFromZero := cmp > 0
+		if cmp == 0 {
+			switch mode {
+			case RoundHalfUp:
+				awayFromZero = true
+			case RoundHalfEven:
+				awayFromZero = q.Bit(0) == 1
+			}
+		}
+		if awayFromZero {
+			if num.Sign() < 0 {
+				q.Sub(q, big.NewInt(1))
+			} else {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+	}
+	if !q.IsInt64() {
+		return 0, ErrAmountOverflow
+	}
+	return q.Int64(), nil
+}
@@ -0,0 +1,191 @@
+package core
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input    string
+		currency Currency
+		minor    int64
+		wantErr  bool
+	}{
+		{"1234.56", USD, 123456, false},
+		{"-0.05", USD, -5, false},
+		{"12", USD, 1200, false},
+		{"12.5", USD, 1250, false},
+		{".75", USD, 75, false},
+		{"1200.00", JPY, 1200, false},
+		{"12.345", USD, 0, true},
+		{"12.3.4", USD, 0, true},
+		{"abc", USD, 0, true},
+		{"", USD, 0, true},
+		{"1", "XYZ", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			m, err := ParseMoney(tt.input, tt.currency)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.minor, m.Minor())
+			assert.Equal(t, tt.currency, m.Currency())
+		})
+	}
+}
+
+func TestMoney_Decimal(t *testing.T) {
+	assert.Equal(t, "1234.56", NewMoney(123456, USD).Decimal())
+	assert.Equal(t, "-0.05", NewMoney(-5, USD).Decimal())
+	assert.Equal(t, "0.00", Zero(USD).Decimal())
+	assert.Equal(t, "1500", NewMoney(1500, JPY).Decimal())
+	assert.Equal(t, "USD 10.00", NewMoney(1000, USD).String())
+}
+
+func TestMoney_AddRejectsMixedCurrencies(t *testing.T) {
+	_, err := NewMoney(100, USD).Add(NewMoney(100, CAD))
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+
+	_, err = NewMoney(100, USD).Cmp(NewMoney(100, EUR))
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+}
+
+func TestMoney_ZeroValueAccumulates(t *testing.T) {
+	total, err := Sum(NewMoney(10, USD), NewMoney(20, USD), NewMoney(-5, USD))
+	require.NoError(t, err)
+	assert.Equal(t, NewMoney(25, USD), total)
+}
+
+func TestMoney_FloatDriftIsGone(t *testing.T) {
+	var total Money
+	for i := 0; i < 10; i++ {
+		var err error
+		total, err = total.Add(MustParseMoney("0.10", USD))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, MustParseMoney("1.00", USD), total)
+}
+
+func TestMoney_MulRounding(t *testing.T) {
+	half := big.NewRat(1, 2)
+	tests := []struct {
+		name  string
+		minor int64
+		mode  RoundingMode
+		want  int64
+	}{
+		{"half even rounds 0.5 down to even", 1, RoundHalfEven, 0},
+		{"half even rounds 1.5 up to even", 3, RoundHalfEven, 2},
+		{"half up rounds 0.5 away from zero", 1, RoundHalfUp, 1},
+		{"half up rounds -0.5 away from zero", -1, RoundHalfUp, -1},
+		{"half even rounds -2.5 to even", -5, RoundHalfEven, -2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMoney(tt.minor, USD).Mul(half, tt.mode)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, m.Minor())
+		})
+	}
+}
+
+func TestMoney_MulTaxRate(t *testing.T) {
+	rate, _ := new(big.Rat).SetString("0.053")
+	tax, err := MustParseMoney("19.99", USD).Mul(rate, RoundHalfUp)
+	require.NoError(t, err)
+	assert.Equal(t, "1.06", tax.Decimal())
+}
+
+func TestMoney_ConvertAcrossMinorUnits(t *testing.T) {
+	rate, _ := new(big.Rat).SetString("0.7315")
+	usd, err := MustParseMoney("100.00", CAD).Convert(rate, USD, RoundHalfEven)
+	require.NoError(t, err)
+	assert.Equal(t, MustParseMoney("73.15", USD), usd)
+
+	rate, _ = new(big.Rat).SetString("151.275")
+	yen, err := MustParseMoney("10.01", USD).Convert(rate, JPY, RoundHalfEven)
+	require.NoError(t, err)
+	assert.Equal(t, NewMoney(1514, JPY), yen)
+
+	_, err = MustParseMoney("1.00", USD).Convert(rate, "XYZ", RoundHalfEven)
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+}
+
+func TestMoney_RereadKeepsDecimalValue(t *testing.T) {
+	yen, err := MustParseMoney("1500.00", USD).Reread(JPY)
+	require.NoError(t, err)
+	assert.Equal(t, NewMoney(1500, JPY), yen)
+
+	_, err = MustParseMoney("12.50", USD).Reread(JPY)
+	assert.Error(t, err)
+}
+
+func TestMoney_AllocateKeepsEveryPenny(t *testing.T) {
+	shares, err := MustParseMoney("100.00", USD).Split(3)
+	require.NoError(t, err)
+	assert.Equal(t, []Money{NewMoney(3334, USD), NewMoney(3333, USD), NewMoney(3333, USD)}, shares)
+
+	shares, err = NewMoney(5, USD).Allocate(70, 30)
+	require.NoError(t, err)
+	assert.Equal(t, []Money{NewMoney(4, USD), NewMoney(1, USD)}, shares)
+
+	shares, err = NewMoney(-10, USD).Allocate(1, 0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []Money{NewMoney(-3, USD), NewMoney(0, USD), NewMoney(-7, USD)}, shares)
+
+	_, err = NewMoney(10, USD).Allocate(0, 0)
+	assert.ErrorIs(t, err, ErrInvalidRatios)
+}
+
+func TestMoney_JSONRoundTrip(t *testing.T) {
+	data, err := json.Marshal(MustParseMoney("1234.50", CAD))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"amount":"1234.50","currency":"CAD"}`, string(data))
+
+	var decoded Money
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, MustParseMoney("1234.50", CAD), decoded)
+
+	require.NoError(t, json.Unmarshal([]byte(`750.25`), &decoded))
+	assert.Equal(t, MustParseMoney("750.25", USD), decoded)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"amount":"1.234","currency":"USD"}`), &decoded))
+}
+
+func TestMoney_SQLRoundTrip(t *testing.T) {
+	value, err := MustParseMoney("-42.07", USD).Value()
+	require.NoError(t, err)
+	assert.Equal(t, "-42.07", value)
+
+	var scanned Money
+	require.NoError(t, scanned.Scan([]byte("99.90")))
+	assert.Equal(t, MustParseMoney("99.90", USD), scanned)
+
+	eur := Zero(EUR)
+	require.NoError(t, eur.Scan("10.00"))
+	assert.Equal(t, MustParseMoney("10.00", EUR), eur)
+
+	require.NoError(t, scanned.Scan(0.1+0.2))
+	assert.Equal(t, MustParseMoney("0.30", USD), scanned)
+}
+
+func TestPercentRate(t *testing.T) {
+	rate, err := PercentRate(12.5)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewRat(1, 8), rate)
+
+	rate, err = PercentRate(0.07)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewRat(7, 10000), rate)
+
+	_, err = PercentRate(12.345)
+	assert.ErrorIs(t, err, ErrInvalidPercent)
+}
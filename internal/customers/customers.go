@@ -19,6 +19,15 @@ type Customer struct {
     Status       CustomerStatus `json:"status"`
     CustomerType CustomerType   `json:"customer_type"`
     Source       string         `json:"source"` // How they found us
+    PricingTier  string         `json:"pricing_tier"` // Selects tier-specific price books
+    Currency     core.Currency  `json:"currency"`     // Currency the customer is priced, invoiced and paid in
+
+    // Credit, checked by billing when an order is placed; nil means no limit
+    CreditLimit *core.Money `json:"credit_limit"`
+
+    // Purchase history, maintained by billing
+    TotalSpent     core.Money `json:"total_spent"`      // Payments received in Currency less refunds and chargebacks
+    LastPurchaseAt *time.Time `json:"last_purchase_at"` // Date of the latest confirmed order
     
     // Relationships
     Addresses []Address `json:"addresses"`
@@ -28,6 +37,27 @@ type Customer struct {
     CustomFields map[string]interface{} `json:"custom_fields"`
 }
 
+// applyCurrency rereads the customer's stored amounts, which are scanned
+// before the currency column, in the customer's currency.
+func (c *Customer) applyCurrency() error {
+    if c.Currency == "" {
+        c.Currency = core.DefaultCurrency
+    }
+    spent, err := c.TotalSpent.Reread(c.Currency)
+    if err != nil {
+        return err
+    }
+    c.TotalSpent = spent
+    if c.CreditLimit != nil {
+        limit, err := c.CreditLimit.Reread(c.Currency)
+        if err != nil {
+            return err
+        }
+        c.CreditLimit = &limit
+    }
+    return nil
+}
+
 type CustomerStatus string
 const (
     CustomerStatusActive    CustomerStatus = "active"
@@ -77,7 +107,7 @@ type Opportunity struct {
     CustomerID uuid.UUID `json:"customer_id"`
     Name string `json:"name"`
     Description string `json:"description"`
-    Value float64 `json:"value"`
+    Value core.Money `json:"value"`
     Stage OpportunityStage `json:"stage"`
     Probability float64 `json:"probability"`
     ExpectedCloseDate time.Time `json:"expected_close_date"`
@@ -0,0 +1,13 @@
+package customers
+
+const OpportunityWonEvent = "opportunity.won"
+
+// OpportunityWon is published when an opportunity moves to StageClosed,
+// with the products that were sold.
+type OpportunityWon struct {
+	Opportunity Opportunity
+}
+
+func (e OpportunityWon) EventName() string {
+	return OpportunityWonEvent
+}
@@ -3,6 +3,7 @@ package customers
 import (
 	"context"
 	"database/sql"
+	"slices"
 
 	"github.com/google/uuid"
 )
@@ -40,10 +41,13 @@ func (r *customerRepository) GetCustomerByID(ctx context.Context, id uuid.UUID)
 
 	var customer Customer
 	if rows.Next() {
-		err = rows.Scan(&customer.ID, &customer.FirstName, &customer.LastName, &customer.Email, &customer.Phone, &customer.CompanyName, &customer.JobTitle, &customer.Status, &customer.CustomerType, &customer.Source, &customer.CreatedAt, &customer.UpdatedAt)
+		err = rows.Scan(&customer.ID, &customer.FirstName, &customer.LastName, &customer.Email, &customer.Phone, &customer.CompanyName, &customer.JobTitle, &customer.Status, &customer.CustomerType, &customer.Source, &customer.PricingTier, &customer.Currency, &customer.CreditLimit, &customer.TotalSpent, &customer.LastPurchaseAt, &customer.CreatedAt, &customer.UpdatedAt)
 		if err != nil {
 			return Customer{}, err
 		}
+		if err := customer.applyCurrency(); err != nil {
+			return Customer{}, err
+		}
 	}
 	return customer, nil
 }
@@ -58,17 +62,20 @@ func (r *customerRepository) ListCustomers(ctx context.Context) ([]Customer, err
 	var customers []Customer
 	for rows.Next() {
 		var customer Customer
-		err = rows.Scan(&customer.ID, &customer.FirstName, &customer.LastName, &customer.Email, &customer.Phone, &customer.CompanyName, &customer.JobTitle, &customer.Status, &customer.CustomerType, &customer.Source, &customer.CreatedAt, &customer.UpdatedAt)
+		err = rows.Scan(&customer.ID, &customer.FirstName, &customer.LastName, &customer.Email, &customer.Phone, &customer.CompanyName, &customer.JobTitle, &customer.Status, &customer.CustomerType, &customer.Source, &customer.PricingTier, &customer.Currency, &customer.CreditLimit, &customer.TotalSpent, &customer.LastPurchaseAt, &customer.CreatedAt, &customer.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
+		if err := customer.applyCurrency(); err != nil {
+			return nil, err
+		}
 		customers = append(customers, customer)
 	}
 	return customers, nil
 }
 
 func (r *customerRepository) CreateCustomer(ctx context.Context, customer Customer) (*Customer, error) {
-	rows, err := r.db.QueryContext(ctx, "INSERT INTO customers (id, first_name, last_name, email, phone, company_name, job_title, status, customer_type, source) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING *", customer.ID, customer.FirstName, customer.LastName, customer.Email, customer.Phone, customer.CompanyName, customer.JobTitle, customer.Status, customer.CustomerType, customer.Source)
+	rows, err := r.db.QueryContext(ctx, "INSERT INTO customers (id, first_name, last_name, email, phone, company_name, job_title, status, customer_type, source, pricing_tier, currency, credit_limit) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING *", customer.ID, customer.FirstName, customer.LastName, customer.Email, customer.Phone, customer.CompanyName, customer.JobTitle, customer.Status, customer.CustomerType, customer.Source, customer.PricingTier, customer.Currency, customer.CreditLimit)
 	if err != nil {
 		return nil, err
 	}
@@ -76,16 +83,19 @@ func (r *customerRepository) CreateCustomer(ctx context.Context, customer Custom
 	
 	var createdCustomer Customer
 	if rows.Next() {
-		err = rows.Scan(&createdCustomer.ID, &createdCustomer.FirstName, &createdCustomer.LastName, &createdCustomer.Email, &createdCustomer.Phone, &createdCustomer.CompanyName, &createdCustomer.JobTitle, &createdCustomer.Status, &createdCustomer.CustomerType, &createdCustomer.Source, &createdCustomer.CreatedAt, &createdCustomer.UpdatedAt)
+		err = rows.Scan(&createdCustomer.ID, &createdCustomer.FirstName, &createdCustomer.LastName, &createdCustomer.Email, &createdCustomer.Phone, &createdCustomer.CompanyName, &createdCustomer.JobTitle, &createdCustomer.Status, &createdCustomer.CustomerType, &createdCustomer.Source, &createdCustomer.PricingTier, &createdCustomer.Currency, &createdCustomer.CreditLimit, &createdCustomer.TotalSpent, &createdCustomer.LastPurchaseAt, &createdCustomer.CreatedAt, &createdCustomer.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
+		if err := createdCustomer.applyCurrency(); err != nil {
+			return nil, err
+		}
 	}
 	return &createdCustomer, nil
 }
 
 func (r *customerRepository) UpdateCustomer(ctx context.Context, customer Customer) (*Customer, error) {
-	rows, err := r.db.QueryContext(ctx, "UPDATE customers SET first_name = $1, last_name = $2, email = $3, phone = $4, company_name = $5, job_title = $6, status = $7, customer_type = $8, source = $9 WHERE id = $10 RETURNING *", customer.FirstName, customer.LastName, customer.Email, customer.Phone, customer.CompanyName, customer.JobTitle, customer.Status, customer.CustomerType, customer.Source, customer.ID)
+	rows, err := r.db.QueryContext(ctx, "UPDATE customers SET first_name = $1, last_name = $2, email = $3, phone = $4, company_name = $5, job_title = $6, status = $7, customer_type = $8, source = $9, pricing_tier = $10, currency = $11, credit_limit = $12 WHERE id = $13 RETURNING *", customer.FirstName, customer.LastName, customer.Email, customer.Phone, customer.CompanyName, customer.JobTitle, customer.Status, customer.CustomerType, customer.Source, customer.PricingTier, customer.Currency, customer.CreditLimit, customer.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -93,10 +103,13 @@ func (r *customerRepository) UpdateCustomer(ctx context.Context, customer Custom
 	
 	var updatedCustomer Customer
 	if rows.Next() {
-		err = rows.Scan(&updatedCustomer.ID, &updatedCustomer.FirstName, &updatedCustomer.LastName, &updatedCustomer.Email, &updatedCustomer.Phone, &updatedCustomer.CompanyName, &updatedCustomer.JobTitle, &updatedCustomer.Status, &updatedCustomer.CustomerType, &updatedCustomer.Source, &updatedCustomer.CreatedAt, &updatedCustomer.UpdatedAt)
+		err = rows.Scan(&updatedCustomer.ID, &updatedCustomer.FirstName, &updatedCustomer.LastName, &updatedCustomer.Email, &updatedCustomer.Phone, &updatedCustomer.CompanyName, &updatedCustomer.JobTitle, &updatedCustomer.Status, &updatedCustomer.CustomerType, &updatedCustomer.Source, &updatedCustomer.PricingTier, &updatedCustomer.Currency, &updatedCustomer.CreditLimit, &updatedCustomer.TotalSpent, &updatedCustomer.LastPurchaseAt, &updatedCustomer.CreatedAt, &updatedCustomer.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
+		if err := updatedCustomer.applyCurrency(); err != nil {
+			return nil, err
+		}
 	}
 	return &updatedCustomer, nil
 }
@@ -201,6 +214,12 @@ func (r *opportunityRepository) GetOpportunityByID(ctx context.Context, id uuid.
 			return nil, err
 		}
 	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if opportunity.Products, err = queryOpportunityProducts(ctx, r.db, opportunity.ID); err != nil {
+		return nil, err
+	}
 	return &opportunity, nil
 }
 
@@ -220,11 +239,25 @@ func (r *opportunityRepository) GetOpportunitiesByCustomerID(ctx context.Context
 		}
 		opportunities = append(opportunities, &opportunity)
 	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	for _, opportunity := range opportunities {
+		if opportunity.Products, err = queryOpportunityProducts(ctx, r.db, opportunity.ID); err != nil {
+			return nil, err
+		}
+	}
 	return opportunities, nil
 }
 
 func (r *opportunityRepository) CreateOpportunity(ctx context.Context, opportunity Opportunity) (*Opportunity, error) {
-	rows, err := r.db.QueryContext(ctx, "INSERT INTO opportunities (id, customer_id, name, description, value, stage, probability, expected_close_date, actual_close_date, source) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING *", opportunity.ID, opportunity.CustomerID, opportunity.Name, opportunity.Description, opportunity.Value, opportunity.Stage, opportunity.Probability, opportunity.ExpectedCloseDate, opportunity.ActualCloseDate, opportunity.Source)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "INSERT INTO opportunities (id, customer_id, name, description, value, stage, probability, expected_close_date, actual_close_date, source) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING *", opportunity.ID, opportunity.CustomerID, opportunity.Name, opportunity.Description, opportunity.Value, opportunity.Stage, opportunity.Probability, opportunity.ExpectedCloseDate, opportunity.ActualCloseDate, opportunity.Source)
 	if err != nil {
 		return nil, err
 	}
@@ -237,11 +270,26 @@ func (r *opportunityRepository) CreateOpportunity(ctx context.Context, opportuni
 			return nil, err
 		}
 	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if createdOpportunity.Products, err = replaceOpportunityProducts(ctx, tx, createdOpportunity.ID, opportunity.Products); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return &createdOpportunity, nil
 }
 
 func (r *opportunityRepository) UpdateOpportunity(ctx context.Context, opportunity Opportunity) (*Opportunity, error) {
-	rows, err := r.db.QueryContext(ctx, "UPDATE opportunities SET customer_id = $1, name = $2, description = $3, value = $4, stage = $5, probability = $6, expected_close_date = $7, actual_close_date = $8, source = $9 WHERE id = $10 RETURNING *", opportunity.CustomerID, opportunity.Name, opportunity.Description, opportunity.Value, opportunity.Stage, opportunity.Probability, opportunity.ExpectedCloseDate, opportunity.ActualCloseDate, opportunity.Source, opportunity.ID)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "UPDATE opportunities SET customer_id = $1, name = $2, description = $3, value = $4, stage = $5, probability = $6, expected_close_date = $7, actual_close_date = $8, source = $9 WHERE id = $10 RETURNING *", opportunity.CustomerID, opportunity.Name, opportunity.Description, opportunity.Value, opportunity.Stage, opportunity.Probability, opportunity.ExpectedCloseDate, opportunity.ActualCloseDate, opportunity.Source, opportunity.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -254,13 +302,67 @@ func (r *opportunityRepository) UpdateOpportunity(ctx context.Context, opportuni
 			return nil, err
 		}
 	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if updatedOpportunity.Products, err = replaceOpportunityProducts(ctx, tx, opportunity.ID, opportunity.Products); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return &updatedOpportunity, nil
 }
 
 func (r *opportunityRepository) DeleteOpportunity(ctx context.Context, id uuid.UUID) error {
-	_, err := r.db.ExecContext(ctx, "DELETE FROM opportunities WHERE id = $1", id)
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM opportunity_products WHERE opportunity_id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM opportunities WHERE id = $1", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func queryOpportunityProducts(ctx context.Context, db *sql.DB, opportunityID uuid.UUID) ([]OpportunityProduct, error) {
+	rows, err := db.QueryContext(ctx, "SELECT product FROM opportunity_products WHERE opportunity_id = $1 ORDER BY product", opportunityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []OpportunityProduct
+	for rows.Next() {
+		var product OpportunityProduct
+		if err := rows.Scan(&product); err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	return products, rows.Err()
+}
+
+// replaceOpportunityProducts stores products as the opportunity's products,
+// dropping duplicates, and returns what was stored.
+func replaceOpportunityProducts(ctx context.Context, tx *sql.Tx, opportunityID uuid.UUID, products []OpportunityProduct) ([]OpportunityProduct, error) {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM opportunity_products WHERE opportunity_id = $1", opportunityID); err != nil {
+		return nil, err
+	}
+	var stored []OpportunityProduct
+	for _, product := range products {
+		if slices.Contains(stored, product) {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO opportunity_products (opportunity_id, product) VALUES ($1, $2)", opportunityID, product); err != nil {
+			return nil, err
+		}
+		stored = append(stored, product)
+	}
+	return stored, nil
 }
\ No newline at end of file
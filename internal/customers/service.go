@@ -2,6 +2,11 @@ package customers
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"rva_crm/internal/core"
 
 	"github.com/google/uuid"
 )
@@ -39,7 +44,20 @@ type addressService struct {
 }
 
 type opportunityService struct {
-	repo OpportunityRepository
+	repo   OpportunityRepository
+	events core.EventPublisher
+}
+
+// OpportunityServiceOption configures optional collaborators of the
+// opportunity service.
+type OpportunityServiceOption func(*opportunityService)
+
+// WithOpportunityEvents publishes an OpportunityWon event when an
+// opportunity is updated to StageClosed.
+func WithOpportunityEvents(events core.EventPublisher) OpportunityServiceOption {
+	return func(s *opportunityService) {
+		s.events = events
+	}
 }
 
 func NewCustomerService(repo CustomerRepository) CustomerService {
@@ -50,8 +68,12 @@ func NewAddressService(repo AddressRepository) AddressService {
 	return &addressService{repo: repo}
 }
 
-func NewOpportunityService(repo OpportunityRepository) OpportunityService {
-	return &opportunityService{repo: repo}
+func NewOpportunityService(repo OpportunityRepository, opts ...OpportunityServiceOption) OpportunityService {
+	s := &opportunityService{repo: repo}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 type CustomerManager interface {
@@ -171,13 +193,33 @@ func (s *customerService) ListCustomers(ctx context.Context) ([]Customer, error)
 }
 
 func (s *customerService) CreateCustomer(ctx context.Context, customer Customer) (*Customer, error) {
+	if err := normalizeCurrency(&customer); err != nil {
+		return nil, err
+	}
 	return s.repo.CreateCustomer(ctx, customer)
 }
 
 func (s *customerService) UpdateCustomer(ctx context.Context, customer Customer) (*Customer, error) {
+	if err := normalizeCurrency(&customer); err != nil {
+		return nil, err
+	}
 	return s.repo.UpdateCustomer(ctx, customer)
 }
 
+// normalizeCurrency defaults the customer's currency to the base currency.
+// Documents keep the currency they were created in, so a customer's
+// currency can change without touching existing orders and invoices.
+func normalizeCurrency(customer *Customer) error {
+	customer.Currency = core.Currency(strings.ToUpper(strings.TrimSpace(string(customer.Currency))))
+	if customer.Currency == "" {
+		customer.Currency = core.DefaultCurrency
+	}
+	if !customer.Currency.Valid() {
+		return fmt.Errorf("%w: %q", core.ErrUnknownCurrency, customer.Currency)
+	}
+	return nil
+}
+
 func (s *customerService) DeleteCustomer(ctx context.Context, id uuid.UUID) error {
 	return s.repo.DeleteCustomer(ctx, id)
 }
@@ -214,8 +256,26 @@ func (s *opportunityService) CreateOpportunity(ctx context.Context, opportunity
 	return s.repo.CreateOpportunity(ctx, opportunity)
 }
 
+// UpdateOpportunity saves the opportunity and, once it is won, publishes
+// OpportunityWon. The update stands even if a subscriber fails.
 func (s *opportunityService) UpdateOpportunity(ctx context.Context, opportunity Opportunity) (*Opportunity, error) {
-	return s.repo.UpdateOpportunity(ctx, opportunity)
+	if s.events == nil {
+		return s.repo.UpdateOpportunity(ctx, opportunity)
+	}
+	existing, err := s.repo.GetOpportunityByID(ctx, opportunity.ID)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.repo.UpdateOpportunity(ctx, opportunity)
+	if err != nil {
+		return nil, err
+	}
+	if updated.Stage == StageClosed && existing.Stage != StageClosed {
+		if err := s.events.Publish(ctx, OpportunityWon{Opportunity: *updated}); err != nil {
+			slog.ErrorContext(ctx, "opportunity won subscriber failed", "opportunity_id", updated.ID, "error", err)
+		}
+	}
+	return updated, nil
 }
 
 func (s *opportunityService) DeleteOpportunity(ctx context.Context, id uuid.UUID) error {
@@ -10,56 +10,251 @@ UPDATE customers SET first_name = $2, last_name = $3, email = $4, phone = $5, co
 -- name: DeleteCustomer :exec
 DELETE FROM customers WHERE id = $1;
 
+-- name: NextDocumentNumber :one
+UPDATE document_sequences SET last_value = last_value + 1 WHERE name = $1 RETURNING last_value;
+
 -- name: GetOrder :one
 SELECT * FROM orders WHERE id = $1;
 
+-- name: GetOrdersByCustomer :many
+SELECT * FROM orders WHERE customer_id = $1 ORDER BY order_date DESC;
+
 -- name: CreateOrder :one
-INSERT INTO orders (customer_id, total_price, payment_status, order_status, order_type, order_date, delivery_date, delivery_address, delivery_status, delivery_date, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING *;
+INSERT INTO orders (order_number, customer_id, status, subtotal, discount, tax_amount, total, order_date, shipped_date, delivered_date, billing_address_id, shipping_address_id, quote_id, notes, metadata, currency) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) RETURNING *;
 
 -- name: UpdateOrder :one
-UPDATE orders SET customer_id = $2, total_price = $3, payment_status = $4, order_status = $5, order_type = $6, order_date = $7, delivery_date = $8, delivery_address = $9, delivery_status = $10, delivery_date = $11, created_at = $12, updated_at = $13 WHERE id = $1 RETURNING *;
+UPDATE orders SET subtotal = $2, discount = $3, tax_amount = $4, total = $5, order_date = $6, billing_address_id = $7, shipping_address_id = $8, notes = $9, metadata = $10, currency = $11, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = 'pending' AND (amount_paid = 0 OR (currency = $11 AND amount_paid <= $5)) RETURNING *;
+
+-- name: UpdateOrderStatus :one
+UPDATE orders SET status = $2, shipped_date = $3, delivered_date = $4, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = $5 RETURNING *;
 
--- name: DeleteOrder :exec
-DELETE FROM orders WHERE id = $1;
+-- name: DeleteOrder :execrows
+DELETE FROM orders WHERE id = $1 AND status = 'pending';
 
 -- name: GetOrderItems :many
-SELECT * FROM order_items WHERE order_id = $1;
+SELECT * FROM order_items WHERE order_id = $1 ORDER BY created_at, id;
 
 -- name: GetOrderItem :one
 SELECT * FROM order_items WHERE id = $1;
 
 -- name: CreateOrderItem :one
-INSERT INTO order_items (order_id, product_id, quantity, price, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING *;
+INSERT INTO order_items (order_id, product_id, description, quantity, unit_price, discount, discounts, tax_amount, total) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING *;
 
--- name: UpdateOrderItem :one
-UPDATE order_items SET order_id = $2, product_id = $3, quantity = $4, price = $5, created_at = $6, updated_at = $7 WHERE id = $1 RETURNING *;
+-- name: DeleteOrderItems :exec
+DELETE FROM order_items WHERE order_id = $1;
 
--- name: DeleteOrderItem :exec
-DELETE FROM order_items WHERE id = $1;
+-- name: GetOrderPayments :many
+SELECT * FROM payments WHERE order_id = $1 ORDER BY created_at, id;
 
 -- name: GetProduct :one
 SELECT * FROM products WHERE id = $1;
 
+-- name: GetProductBySKU :one
+SELECT * FROM products WHERE sku = $1;
+
+-- name: ListProducts :many
+SELECT * FROM products ORDER BY sku;
+
 -- name: CreateProduct :one
-INSERT INTO products (name, description, price, created_at, updated_at) VALUES ($1, $2, $3, $4, $5) RETURNING *;
+INSERT INTO products (sku, name, description, category, tax_category, status, is_recurring, price, track_inventory, low_stock_alert, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING *;
 
 -- name: UpdateProduct :one
-UPDATE products SET name = $2, description = $3, price = $4, created_at = $5, updated_at = $6 WHERE id = $1 RETURNING *;
+UPDATE products SET sku = $2, name = $3, description = $4, category = $5, tax_category = $6, status = $7, is_recurring = $8, price = $9, track_inventory = $10, low_stock_alert = $11, created_at = $12, updated_at = $13 WHERE id = $1 RETURNING *;
 
 -- name: DeleteProduct :exec
 DELETE FROM products WHERE id = $1;
 
+-- name: GetPriceBook :one
+SELECT * FROM price_books WHERE id = $1;
+
+-- name: ListPriceBooks :many
+SELECT * FROM price_books ORDER BY name;
+
+-- name: CreatePriceBook :one
+INSERT INTO price_books (name, description, customer_id, pricing_tier, is_active) VALUES ($1, $2, $3, $4, $5) RETURNING *;
+
+-- name: UpdatePriceBook :one
+UPDATE price_books SET name = $2, description = $3, customer_id = $4, pricing_tier = $5, is_active = $6 WHERE id = $1 RETURNING *;
+
+-- name: DeletePriceBook :exec
+DELETE FROM price_books WHERE id = $1;
+
+-- name: GetPriceBookEntries :many
+SELECT * FROM price_book_entries WHERE price_book_id = $1 ORDER BY product_id, effective_from;
+
+-- name: CreatePriceBookEntry :one
+INSERT INTO price_book_entries (price_book_id, product_id, price, effective_from, effective_to) VALUES ($1, $2, $3, $4, $5) RETURNING *;
+
+-- name: DeletePriceBookEntry :exec
+DELETE FROM price_book_entries WHERE id = $1;
+
+-- name: GetEffectivePriceBookEntries :many
+SELECT e.*, b.customer_id, b.pricing_tier FROM price_book_entries e JOIN price_books b ON b.id = e.price_book_id WHERE e.product_id = $1 AND b.is_active AND e.effective_from <= $2 AND (e.effective_to IS NULL OR e.effective_to > $2);
+
 -- name: GetProject :one
 SELECT * FROM projects WHERE id = $1;
 
+-- name: GetCustomerProjects :many
+SELECT * FROM projects WHERE customer_id = $1 ORDER BY start_date NULLS LAST, name, id;
+
 -- name: CreateProject :one
-INSERT INTO projects (name, description, customer_id, created_at, updated_at) VALUES ($1, $2, $3, $4, $5) RETURNING *;
+INSERT INTO projects (id, customer_id, name, description, status, start_date, end_date, currency, budget, assigned_to_id, template_id, opportunity_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING *;
 
 -- name: UpdateProject :one
-UPDATE projects SET name = $2, description = $3, customer_id = $4, created_at = $5, updated_at = $6 WHERE id = $1 RETURNING *;
+UPDATE projects SET name = $2, description = $3, status = $4, start_date = $5, end_date = $6, currency = $7, budget = $8, assigned_to_id = $9, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND (currency = $7 OR NOT (EXISTS (SELECT 1 FROM time_entries WHERE project_id = projects.id) OR EXISTS (SELECT 1 FROM project_expenses WHERE project_id = projects.id) OR EXISTS (SELECT 1 FROM project_milestones WHERE project_id = projects.id AND billable))) RETURNING *;
+
+-- name: DeleteProject :execrows
+DELETE FROM projects WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM time_entries WHERE project_id = projects.id AND (invoice_id IS NOT NULL OR billing_claim IS NOT NULL)) AND NOT EXISTS (SELECT 1 FROM project_expenses WHERE project_id = projects.id AND (invoice_id IS NOT NULL OR billing_claim IS NOT NULL)) AND NOT EXISTS (SELECT 1 FROM project_milestones WHERE project_id = projects.id AND (invoice_id IS NOT NULL OR billing_claim IS NOT NULL)) AND NOT EXISTS (SELECT 1 FROM notes WHERE project_id = projects.id);
+
+-- name: LockProject :exec
+SELECT id FROM projects WHERE id = $1 FOR UPDATE;
+
+-- name: GetProjectTask :one
+SELECT * FROM project_tasks WHERE id = $1;
+
+-- name: GetProjectTasks :many
+SELECT * FROM project_tasks WHERE project_id = $1 ORDER BY position, title, id;
+
+-- name: CreateProjectTask :one
+INSERT INTO project_tasks (id, project_id, parent_id, title, description, status, priority, position, duration_days, estimated_hours, due_date, completed_at, assignee_ids) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING *;
+
+-- name: UpdateProjectTask :one
+UPDATE project_tasks SET parent_id = $2, title = $3, description = $4, status = $5, priority = $6, position = $7, duration_days = $8, estimated_hours = $9, due_date = $10, completed_at = $11, assignee_ids = $12, updated_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING *;
+
+-- name: DeleteProjectTask :exec
+DELETE FROM project_tasks WHERE id = $1;
+
+-- name: GetProjectTaskDependencies :many
+SELECT d.task_id, d.depends_on_id FROM project_task_dependencies d JOIN project_tasks t ON t.id = d.task_id WHERE t.project_id = $1;
+
+-- name: DeleteProjectTaskDependencies :exec
+DELETE FROM project_task_dependencies WHERE task_id = $1;
+
+-- name: CreateProjectTaskDependency :exec
+INSERT INTO project_task_dependencies (task_id, depends_on_id) VALUES ($1, $2);
+
+-- name: GetProjectTemplate :one
+SELECT * FROM project_templates WHERE id = $1;
+
+-- name: ListProjectTemplates :many
+SELECT * FROM project_templates ORDER BY name, id;
+
+-- name: ListProjectTemplatesByProduct :many
+SELECT * FROM project_templates WHERE product = $1 ORDER BY name, id;
+
+-- name: CreateProjectTemplate :one
+INSERT INTO project_templates (id, name, description, product, duration_days, role_assignees, tasks, milestones) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING *;
+
+-- name: UpdateProjectTemplate :one
+UPDATE project_templates SET name = $2, description = $3, product = $4, duration_days = $5, role_assignees = $6, tasks = $7, milestones = $8, updated_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING *;
+
+-- name: DeleteProjectTemplate :exec
+DELETE FROM project_templates WHERE id = $1;
+
+-- name: LockProjectTemplate :exec
+SELECT id FROM project_templates WHERE id = $1 FOR UPDATE;
+
+-- name: ProjectExistsForOpportunity :one
+SELECT EXISTS (SELECT 1 FROM projects WHERE template_id = $1 AND opportunity_id = $2);
+
+-- name: GetProjectMilestone :one
+SELECT m.*, p.currency FROM project_milestones m JOIN projects p ON p.id = m.project_id WHERE m.id = $1;
+
+-- name: GetProjectMilestones :many
+SELECT m.*, p.currency FROM project_milestones m JOIN projects p ON p.id = m.project_id WHERE m.project_id = $1 ORDER BY m.due_date, m.title, m.id;
+
+-- name: CreateProjectMilestone :exec
+INSERT INTO project_milestones (id, project_id, title, description, due_date, billable, amount) VALUES ($1, $2, $3, $4, $5, $6, $7);
+
+-- name: UpdateProjectMilestone :exec
+UPDATE project_milestones SET title = $3, description = $4, due_date = $5, billable = $6, amount = $7, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND project_id = $2 AND completed_at IS NULL;
+
+-- name: DeleteProjectMilestone :exec
+DELETE FROM project_milestones WHERE id = $1 AND completed_at IS NULL;
+
+-- name: CompleteProjectMilestone :exec
+UPDATE project_milestones SET completed_at = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND completed_at IS NULL;
+
+-- name: ClaimProjectMilestoneBilling :exec
+UPDATE project_milestones SET billing_claim = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND completed_at IS NOT NULL AND billable AND invoice_id IS NULL AND billing_claim IS NULL;
+
+-- name: AttachProjectMilestoneBillingClaim :exec
+UPDATE project_milestones SET invoice_id = $2, billing_claim = NULL, updated_at = CURRENT_TIMESTAMP WHERE billing_claim = $1;
+
+-- name: ReleaseProjectMilestoneBillingClaim :exec
+UPDATE project_milestones SET billing_claim = NULL, updated_at = CURRENT_TIMESTAMP WHERE billing_claim = $1;
+
+-- name: GetProjectMilestoneTasks :many
+SELECT milestone_id, task_id FROM project_milestone_tasks WHERE milestone_id = $1 ORDER BY task_id;
+
+-- name: DeleteProjectMilestoneTasks :exec
+DELETE FROM project_milestone_tasks WHERE milestone_id = $1;
+
+-- name: CreateProjectMilestoneTask :exec
+INSERT INTO project_milestone_tasks (milestone_id, task_id) VALUES ($1, $2);
 
--- name: DeleteProject :exec
-DELETE FROM projects WHERE id = $1;
+-- name: GetTimeEntry :one
+SELECT e.*, p.currency FROM time_entries e JOIN projects p ON p.id = e.project_id WHERE e.id = $1;
+
+-- name: GetProjectTimeEntries :many
+SELECT e.*, p.currency FROM time_entries e JOIN projects p ON p.id = e.project_id WHERE e.project_id = $1 ORDER BY e.work_date, e.started_at NULLS LAST, e.created_at, e.id;
+
+-- name: GetUserTimeEntries :many
+SELECT e.*, p.currency FROM time_entries e JOIN projects p ON p.id = e.project_id WHERE e.user_id = $1 AND e.work_date >= $2 AND e.work_date <= $3 ORDER BY e.work_date, e.started_at NULLS LAST, e.created_at, e.id;
+
+-- name: GetRunningTimer :one
+SELECT e.*, p.currency FROM time_entries e JOIN projects p ON p.id = e.project_id WHERE e.user_id = $1 AND e.started_at IS NOT NULL AND e.ended_at IS NULL;
+
+-- name: CreateTimeEntry :exec
+INSERT INTO time_entries (id, user_id, project_id, task_id, work_date, started_at, ended_at, minutes, billable, rate, amount, notes) SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12 WHERE NOT EXISTS (SELECT 1 FROM timesheets t WHERE t.user_id = $2 AND t.week_start = date_trunc('week', $5::date)::date AND t.status <> 'open');
+
+-- name: UpdateTimeEntry :exec
+UPDATE time_entries SET task_id = $4, work_date = $5, started_at = $6, ended_at = $7, minutes = $8, billable = $9, rate = $10, amount = $11, notes = $12, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND project_id = $3 AND invoice_id IS NULL AND billing_claim IS NULL AND NOT EXISTS (SELECT 1 FROM timesheets t WHERE t.user_id = $2 AND t.week_start = date_trunc('week', time_entries.work_date)::date AND t.status <> 'open') AND NOT EXISTS (SELECT 1 FROM timesheets t WHERE t.user_id = $2 AND t.week_start = date_trunc('week', $5::date)::date AND t.status <> 'open');
+
+-- name: DeleteTimeEntry :exec
+DELETE FROM time_entries WHERE id = $1 AND invoice_id IS NULL AND billing_claim IS NULL AND NOT EXISTS (SELECT 1 FROM timesheets t WHERE t.user_id = time_entries.user_id AND t.week_start = date_trunc('week', time_entries.work_date)::date AND t.status <> 'open');
+
+-- name: ClaimBillableTime :many
+UPDATE time_entries e SET billing_claim = $2, updated_at = CURRENT_TIMESTAMP FROM projects p, timesheets t WHERE p.id = e.project_id AND e.project_id = $1 AND e.billable AND e.amount > 0 AND e.invoice_id IS NULL AND e.billing_claim IS NULL AND t.user_id = e.user_id AND t.week_start = date_trunc('week', e.work_date)::date AND t.status = 'approved' RETURNING e.*, p.currency;
+
+-- name: AttachTimeBillingClaim :exec
+UPDATE time_entries SET invoice_id = $2, billing_claim = NULL, updated_at = CURRENT_TIMESTAMP WHERE billing_claim = $1;
+
+-- name: ReleaseTimeBillingClaim :exec
+UPDATE time_entries SET billing_claim = NULL, updated_at = CURRENT_TIMESTAMP WHERE billing_claim = $1;
+
+-- name: GetTimesheet :one
+SELECT * FROM timesheets WHERE user_id = $1 AND week_start = $2;
+
+-- name: SetTimesheetStatus :one
+INSERT INTO timesheets (id, user_id, week_start, status, submitted_at, approved_at, approved_by_id) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (user_id, week_start) DO UPDATE SET status = EXCLUDED.status, submitted_at = EXCLUDED.submitted_at, approved_at = EXCLUDED.approved_at, approved_by_id = EXCLUDED.approved_by_id, updated_at = CURRENT_TIMESTAMP WHERE timesheets.status = $8 RETURNING *;
+
+-- name: GetProjectExpense :one
+SELECT x.*, p.currency FROM project_expenses x JOIN projects p ON p.id = x.project_id WHERE x.id = $1;
+
+-- name: GetProjectExpenses :many
+SELECT x.*, p.currency FROM project_expenses x JOIN projects p ON p.id = x.project_id WHERE x.project_id = $1 ORDER BY x.expense_date, x.created_at, x.id;
+
+-- name: GetCustomerExpenses :many
+SELECT x.*, p.currency FROM project_expenses x JOIN projects p ON p.id = x.project_id WHERE p.customer_id = $1 ORDER BY x.expense_date, x.created_at, x.id;
+
+-- name: CreateProjectExpense :exec
+INSERT INTO project_expenses (id, project_id, category, description, expense_date, amount, receipt_ref, reimbursable, markup_percent, billable_amount) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
+
+-- name: UpdateProjectExpense :exec
+UPDATE project_expenses SET category = $3, description = $4, expense_date = $5, amount = $6, receipt_ref = $7, reimbursable = $8, markup_percent = $9, billable_amount = $10, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND project_id = $2 AND invoice_id IS NULL AND billing_claim IS NULL;
+
+-- name: DeleteProjectExpense :exec
+DELETE FROM project_expenses WHERE id = $1 AND invoice_id IS NULL AND billing_claim IS NULL;
+
+-- name: ClaimReimbursableExpenses :many
+UPDATE project_expenses x SET billing_claim = $2, updated_at = CURRENT_TIMESTAMP FROM projects p WHERE p.id = x.project_id AND x.project_id = $1 AND x.reimbursable AND x.billable_amount > 0 AND x.invoice_id IS NULL AND x.billing_claim IS NULL RETURNING x.*, p.currency;
+
+-- name: AttachExpenseBillingClaim :exec
+UPDATE project_expenses SET invoice_id = $2, billing_claim = NULL, updated_at = CURRENT_TIMESTAMP WHERE billing_claim = $1;
+
+-- name: ReleaseExpenseBillingClaim :exec
+UPDATE project_expenses SET billing_claim = NULL, updated_at = CURRENT_TIMESTAMP WHERE billing_claim = $1;
 
 -- name: GetNote :one
 SELECT * FROM notes WHERE id = $1;
@@ -80,8 +275,350 @@ SELECT * FROM payments WHERE id = $1;
 DELETE FROM payments WHERE id = $1;
 
 -- name: CreatePayment :one
-INSERT INTO payments (order_id, amount, payment_method, payment_status, payment_date, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *;
+INSERT INTO payments (customer_id, order_id, amount, payment_method, payment_status, payment_date, transaction_id, processor_reference, processed_at, processor_data, currency) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING *;
 
 -- name: UpdatePayment :one
-UPDATE payments SET order_id = $2, amount = $3, payment_method = $4, payment_status = $5, payment_date = $6, created_at = $7, updated_at = $8 WHERE id = $1 RETURNING *;
+UPDATE payments SET order_id = $2, amount = $3, payment_method = $4, payment_status = $5, payment_date = $6, updated_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING *;
+
+-- name: UpdatePaymentStatus :one
+UPDATE payments SET payment_status = $2, amount = $3, transaction_id = $4, processor_reference = $5, processed_at = $6, processor_data = $7, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND payment_status = $8 RETURNING *;
+
+-- name: GetCustomerPayments :many
+SELECT * FROM payments WHERE customer_id = $1 ORDER BY payment_date DESC, id;
+
+-- name: LockPayment :one
+SELECT * FROM payments WHERE id = $1 FOR UPDATE;
+
+-- name: GetPaymentApplications :many
+SELECT * FROM payment_applications WHERE payment_id = $1 ORDER BY created_at, id;
+
+-- name: CreatePaymentApplication :one
+INSERT INTO payment_applications (payment_id, invoice_id, order_id, amount, realized_fx) VALUES ($1, $2, $3, $4, $5) RETURNING *;
+
+-- name: GetOrderPaymentApplications :many
+SELECT * FROM payment_applications WHERE order_id = $1 ORDER BY created_at, id;
+
+-- name: MoveOrderPaymentApplications :exec
+UPDATE payment_applications SET invoice_id = $1, order_id = NULL, updated_at = CURRENT_TIMESTAMP WHERE order_id = $2;
+
+-- name: UpdatePaymentApplicationAmount :exec
+UPDATE payment_applications SET amount = $2, realized_fx = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $1;
+
+-- name: DeletePaymentApplication :exec
+DELETE FROM payment_applications WHERE id = $1;
+
+-- name: UpdatePaymentRefunded :exec
+UPDATE payments SET refunded_amount = $2, payment_status = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $1;
+
+-- name: UpdatePaymentDisputed :exec
+UPDATE payments SET disputed_amount = $2, charged_back_amount = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $1;
+
+-- name: CreateRefund :one
+INSERT INTO refunds (payment_id, amount, reason, notes, refunded_at, processor_reference, processed_at, processor_data) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING *;
+
+-- name: GetPaymentRefunds :many
+SELECT * FROM refunds WHERE payment_id = $1 ORDER BY refunded_at, id;
+
+-- name: CreateChargeback :one
+INSERT INTO chargebacks (payment_id, amount, reason_code, status, disputed_at, evidence_due_by, notes) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *;
+
+-- name: GetChargeback :one
+SELECT * FROM chargebacks WHERE id = $1;
+
+-- name: GetPaymentChargebacks :many
+SELECT * FROM chargebacks WHERE payment_id = $1 ORDER BY disputed_at, id;
+
+-- name: UpdateChargebackStatus :one
+UPDATE chargebacks SET status = $2, resolved_at = $3, notes = $4, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = $5 RETURNING *;
+
+-- name: CreateLedgerEntry :exec
+INSERT INTO ledger_entries (payment_id, entry_type, debit_account, credit_account, amount, realized_fx, invoice_id, order_id, refund_id, chargeback_id, occurred_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);
+
+-- name: GetPaymentLedgerEntries :many
+SELECT * FROM ledger_entries WHERE payment_id = $1 ORDER BY occurred_at, created_at, id;
+
+-- name: UpdateOrderAmountPaid :exec
+UPDATE orders SET amount_paid = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1;
+
+-- name: LockOrder :one
+SELECT * FROM orders WHERE id = $1 FOR UPDATE;
+
+-- name: GetInvoice :one
+SELECT * FROM invoices WHERE id = $1;
+
+-- name: LockInvoice :one
+SELECT * FROM invoices WHERE id = $1 FOR UPDATE;
+
+-- name: GetCustomerInvoices :many
+SELECT * FROM invoices WHERE customer_id = $1 ORDER BY created_at DESC;
+
+-- name: GetOrderInvoices :many
+SELECT * FROM invoices WHERE order_id = $1 ORDER BY created_at DESC;
+
+-- name: CreateInvoice :one
+INSERT INTO invoices (invoice_number, kind, customer_id, order_id, credited_invoice_id, status, payment_terms, subtotal, discount, tax_amount, total, amount_paid, amount_credited, issue_date, due_date, sent_at, paid_at, voided_at, billing_address_id, notes, currency) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21) RETURNING *;
+
+-- name: UpdateDraftInvoice :one
+UPDATE invoices SET payment_terms = $2, subtotal = $3, discount = $4, tax_amount = $5, total = $6, billing_address_id = $7, notes = $8, currency = $9, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = 'draft' RETURNING *;
+
+-- name: IssueInvoice :one
+UPDATE invoices SET invoice_number = $2, status = 'sent', issue_date = $3, due_date = $4, sent_at = $5, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = 'draft' RETURNING *;
+
+-- name: UpdateInvoiceStatus :one
+UPDATE invoices SET status = $2, paid_at = $3, voided_at = $4, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = $5 RETURNING *;
+
+-- name: UpdateInvoiceBalance :exec
+UPDATE invoices SET amount_paid = $2, amount_credited = $3, status = $4, paid_at = $5, updated_at = CURRENT_TIMESTAMP WHERE id = $1;
+
+-- name: DeleteDraftInvoice :exec
+DELETE FROM invoices WHERE id = $1 AND status = 'draft';
+
+-- name: GetInvoiceItems :many
+SELECT * FROM invoice_items WHERE invoice_id = $1 ORDER BY created_at, id;
+
+-- name: CreateInvoiceItem :one
+INSERT INTO invoice_items (invoice_id, product_id, description, quantity, unit_price, discount, tax_amount, total) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING *;
+
+-- name: DeleteInvoiceItems :exec
+DELETE FROM invoice_items WHERE invoice_id = $1;
+
+
+-- name: CreateSubscription :one
+INSERT INTO subscriptions (id, customer_id, kind, name, status, billing_interval, anchor_date, next_billing_date, payment_terms, billing_address_id, notes) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING *;
+
+-- name: GetSubscription :one
+SELECT * FROM subscriptions WHERE id = $1;
+
+-- name: LockSubscription :one
+SELECT * FROM subscriptions WHERE id = $1 FOR UPDATE;
+
+-- name: GetCustomerSubscriptions :many
+SELECT * FROM subscriptions WHERE customer_id = $1 ORDER BY created_at DESC;
+
+-- name: GetDueSubscriptions :many
+SELECT * FROM subscriptions WHERE status = $1 AND next_billing_date <= $2 ORDER BY next_billing_date, id;
+
+-- name: UpdateSubscription :one
+UPDATE subscriptions SET name = $1, status = $2, next_billing_date = $3, payment_terms = $4, billing_address_id = $5, notes = $6, paused_at = $7, cancel_at = $8, cancelled_at = $9, updated_at = CURRENT_TIMESTAMP WHERE id = $10 AND status = $11 AND next_billing_date = $12 RETURNING *;
+
+-- name: AdvanceSubscription :exec
+UPDATE subscriptions SET next_billing_date = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2;
+
+-- name: CreateSubscriptionItem :one
+INSERT INTO subscription_items (id, subscription_id, product_id, description, quantity, unit_price, discount) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *;
+
+-- name: GetSubscriptionItems :many
+SELECT * FROM subscription_items WHERE subscription_id = $1 ORDER BY created_at, id;
+
+-- name: DeleteSubscriptionItems :exec
+DELETE FROM subscription_items WHERE subscription_id = $1;
+
+-- name: CreateSubscriptionAdjustment :exec
+INSERT INTO subscription_adjustments (id, subscription_id, description, amount, effective_date) VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetUnbilledSubscriptionAdjustments :many
+SELECT * FROM subscription_adjustments WHERE subscription_id = $1 AND invoice_id IS NULL ORDER BY effective_date, created_at, id;
+
+-- name: MarkSubscriptionAdjustmentBilled :execrows
+UPDATE subscription_adjustments SET invoice_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND invoice_id IS NULL;
+
+-- name: CreateSubscriptionCycle :exec
+INSERT INTO subscription_cycles (subscription_id, period_start, period_end, invoice_id, billed_at) VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetSubscriptionCycles :many
+SELECT * FROM subscription_cycles WHERE subscription_id = $1 ORDER BY period_start;
+
+-- name: CreateActivity :one
+INSERT INTO activities (id, customer_id, activity_type, description, activity_date, status, priority, category, tags, metadata) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING created_at, updated_at;
+
+-- name: GetOpenInvoices :many
+SELECT * FROM invoices WHERE kind = $1 AND status IN ($2, $3) AND issue_date <= $4 ORDER BY customer_id, due_date, id;
+
+-- name: CreateDunningNotice :one
+INSERT INTO dunning_notices (id, invoice_id, customer_id, stage, days_overdue, balance, recipient, subject, body, sent_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) ON CONFLICT (invoice_id, stage) DO NOTHING RETURNING *;
+
+-- name: GetInvoiceDunningNotices :many
+SELECT * FROM dunning_notices WHERE invoice_id = $1 ORDER BY sent_at, id;
+
+-- name: DeleteDunningNotice :exec
+DELETE FROM dunning_notices WHERE id = $1;
+
+-- name: GetCustomerInvoicedBalance :one
+SELECT COALESCE(SUM(total - amount_paid - amount_credited), 0) FROM invoices WHERE customer_id = $1 AND kind = $2 AND status IN ($3, $4);
+
+-- name: GetCustomerUninvoicedBalance :one
+SELECT COALESCE(SUM(o.total - o.amount_paid), 0) FROM orders o WHERE o.customer_id = $1 AND o.status NOT IN ($2, $3) AND o.total > o.amount_paid AND NOT EXISTS (SELECT 1 FROM invoices i WHERE i.order_id = o.id AND i.kind = $4 AND i.status IN ($5, $6, $7));
+
+-- name: CreateCreditOverride :one
+INSERT INTO credit_overrides (id, order_id, customer_id, approved_by, reason, credit_limit, open_balance, order_total, approved_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING *;
+
+-- name: GetOrderCreditOverride :one
+SELECT * FROM credit_overrides WHERE order_id = $1 ORDER BY approved_at DESC, created_at DESC LIMIT 1;
+
+-- name: RefreshCustomerStats :exec
+UPDATE customers SET total_spent = (SELECT COALESCE(SUM(p.amount - p.refunded_amount - p.charged_back_amount), 0) FROM payments p WHERE p.customer_id = $1 AND p.currency = customers.currency AND p.payment_status IN ($2, $3)), last_purchase_at = (SELECT MAX(order_date) FROM orders WHERE customer_id = $1 AND status IN ($4, $5, $6, $7)), updated_at = CURRENT_TIMESTAMP WHERE id = $1;
+
+-- name: GetExemptionCertificate :one
+SELECT * FROM tax_exemption_certificates WHERE id = $1;
+
+-- name: GetCustomerExemptionCertificates :many
+SELECT * FROM tax_exemption_certificates WHERE customer_id = $1 ORDER BY issued_on, id;
+
+-- name: CreateExemptionCertificate :one
+INSERT INTO tax_exemption_certificates (id, customer_id, certificate_number, state, reason, issued_on, expires_on) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *;
+
+-- name: UpdateExemptionCertificate :one
+UPDATE tax_exemption_certificates SET certificate_number = $2, state = $3, reason = $4, issued_on = $5, expires_on = $6, updated_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING *;
+
+-- name: DeleteExemptionCertificate :exec
+DELETE FROM tax_exemption_certificates WHERE id = $1;
+
+-- name: GetDiscountRule :one
+SELECT * FROM discount_rules WHERE id = $1;
+
+-- name: ListDiscountRules :many
+SELECT * FROM discount_rules ORDER BY priority, name, id;
+
+-- name: GetAutomaticDiscountRules :many
+SELECT * FROM discount_rules WHERE is_active AND NOT requires_coupon AND (starts_at IS NULL OR starts_at <= $1) AND (ends_at IS NULL OR ends_at > $1) ORDER BY priority, name, id;
+
+-- name: CreateDiscountRule :one
+INSERT INTO discount_rules (id, name, discount_type, scope, percentage, amount, product_id, first_engagement_only, requires_coupon, starts_at, ends_at, is_active, priority) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING *;
+
+-- name: UpdateDiscountRule :one
+UPDATE discount_rules SET name = $2, discount_type = $3, scope = $4, percentage = $5, amount = $6, product_id = $7, first_engagement_only = $8, requires_coupon = $9, starts_at = $10, ends_at = $11, is_active = $12, priority = $13, updated_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING *;
+
+-- name: DeleteDiscountRule :exec
+DELETE FROM discount_rules WHERE id = $1;
+
+-- name: GetCoupon :one
+SELECT * FROM coupons WHERE id = $1;
+
+-- name: GetCouponByCode :one
+SELECT * FROM coupons WHERE code = $1;
+
+-- name: GetRuleCoupons :many
+SELECT * FROM coupons WHERE rule_id = $1 ORDER BY code;
+
+-- name: CreateCoupon :one
+INSERT INTO coupons (id, code, rule_id, max_redemptions, expires_at, is_active) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (code) DO NOTHING RETURNING *;
+
+-- name: UpdateCoupon :one
+UPDATE coupons SET max_redemptions = $2, expires_at = $3, is_active = $4, updated_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING *;
+
+-- name: DeleteCoupon :exec
+DELETE FROM coupons WHERE id = $1;
+
+-- name: LockCouponByCode :one
+SELECT id, max_redemptions FROM coupons WHERE code = $1 FOR UPDATE;
+
+-- name: CountCouponRedemptions :one
+SELECT COUNT(*) FROM coupon_redemptions r JOIN orders o ON o.id = r.order_id WHERE r.coupon_id = $1 AND o.status <> 'cancelled';
+
+-- name: CreateCouponRedemption :exec
+INSERT INTO coupon_redemptions (coupon_id, order_id) VALUES ($1, $2);
+
+-- name: GetOrderCouponCodes :many
+SELECT c.code FROM coupon_redemptions r JOIN coupons c ON c.id = r.coupon_id WHERE r.order_id = $1 ORDER BY c.code;
+
+-- name: GetQuote :one
+SELECT q.*, (SELECT o.id FROM orders o WHERE o.quote_id = q.id) AS order_id FROM quotes q WHERE q.id = $1;
+
+-- name: GetCustomerQuotes :many
+SELECT q.*, (SELECT o.id FROM orders o WHERE o.quote_id = q.id) AS order_id FROM quotes q WHERE q.customer_id = $1 ORDER BY q.created_at DESC;
+
+-- name: GetQuoteVersions :many
+SELECT q.*, (SELECT o.id FROM orders o WHERE o.quote_id = q.id) AS order_id FROM quotes q WHERE q.quote_number = $1 ORDER BY q.version;
+
+-- name: CreateQuote :one
+INSERT INTO quotes (id, quote_number, version, customer_id, opportunity_id, status, valid_until, subtotal, discount, tax_amount, total, billing_address_id, shipping_address_id, notes, currency) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING *;
+
+-- name: UpdateDraftQuote :one
+UPDATE quotes SET opportunity_id = $2, valid_until = $3, subtotal = $4, discount = $5, tax_amount = $6, total = $7, billing_address_id = $8, shipping_address_id = $9, notes = $10, currency = $11, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = 'draft' RETURNING *;
+
+-- name: DeleteDraftQuote :one
+DELETE FROM quotes WHERE id = $1 AND status = 'draft' RETURNING quote_number, version;
+
+-- name: ReinstateQuoteVersion :exec
+UPDATE quotes SET superseded_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE quote_number = $1 AND version = $2;
+
+-- name: SupersedeQuote :one
+UPDATE quotes SET superseded_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = $2 AND superseded_at IS NULL RETURNING quote_number, version + 1;
+
+-- name: UpdateQuoteStatus :one
+UPDATE quotes SET status = $2, sent_at = $3, accepted_at = $4, declined_at = $5, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = $6 AND superseded_at IS NULL RETURNING *;
+
+-- name: ExpireSentQuotes :execrows
+UPDATE quotes SET status = 'expired', updated_at = CURRENT_TIMESTAMP WHERE status = 'sent' AND valid_until < $1;
+
+-- name: GetQuoteItems :many
+SELECT * FROM quote_items WHERE quote_id = $1 ORDER BY created_at, id;
+
+-- name: CreateQuoteItem :one
+INSERT INTO quote_items (id, quote_id, product_id, description, quantity, unit_price, discount, discounts, tax_amount, total) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING *;
+
+-- name: DeleteQuoteItems :exec
+DELETE FROM quote_items WHERE quote_id = $1;
+
+-- name: GetAccountMappings :many
+SELECT * FROM account_mappings ORDER BY kind, key;
+
+-- name: CreateAccountMapping :one
+INSERT INTO account_mappings (id, kind, key, account_code, account_name) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (kind, key) DO NOTHING RETURNING *;
+
+-- name: UpdateAccountMapping :one
+UPDATE account_mappings SET account_code = $1, account_name = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3 RETURNING *;
+
+-- name: DeleteAccountMapping :exec
+DELETE FROM account_mappings WHERE id = $1;
+
+-- name: GetJournalInvoices :many
+SELECT * FROM invoices WHERE sent_at IS NOT NULL AND (issue_date BETWEEN $1 AND $2 OR (voided_at >= $1 AND voided_at < $3)) ORDER BY issue_date, invoice_number;
+
+-- name: GetJournalLedgerEntries :many
+SELECT le.*, p.customer_id, p.payment_date, COALESCE(i.invoice_number, '') AS invoice_number FROM ledger_entries le JOIN payments p ON p.id = le.payment_id LEFT JOIN invoices i ON i.id = le.invoice_id WHERE le.occurred_at >= $1 AND le.occurred_at < $2 ORDER BY le.occurred_at, le.created_at, le.id;
+
+-- name: CreateAccountingExport :exec
+INSERT INTO accounting_exports (id, format, period_from, period_to, entry_count) VALUES ($1, $2, $3, $4, 0);
+
+-- name: ClaimJournalEntry :execrows
+INSERT INTO exported_journal_entries (source, source_id, export_id) VALUES ($1, $2, $3) ON CONFLICT (source, source_id) DO NOTHING;
+
+-- name: SetAccountingExportEntryCount :one
+UPDATE accounting_exports SET entry_count = $1 WHERE id = $2 RETURNING id, format, period_from, period_to, entry_count, created_at, updated_at;
+
+-- name: SetAccountingExportContent :exec
+UPDATE accounting_exports SET content = $1 WHERE id = $2;
+
+-- name: GetAccountingExportContent :one
+SELECT content FROM accounting_exports WHERE id = $1;
+
+-- name: GetAccountingExportByID :one
+SELECT id, format, period_from, period_to, entry_count, created_at, updated_at FROM accounting_exports WHERE id = $1;
+
+-- name: GetAccountingExports :many
+SELECT id, format, period_from, period_to, entry_count, created_at, updated_at FROM accounting_exports ORDER BY created_at DESC;
+
+-- name: LockProductStock :one
+SELECT track_inventory, stock_quantity, reserved_quantity, low_stock_alert FROM products WHERE id = $1 FOR UPDATE;
+
+-- name: SetProductStock :exec
+UPDATE products SET stock_quantity = $1, reserved_quantity = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3;
+
+-- name: CreateStockMovement :one
+INSERT INTO stock_movements (id, product_id, movement_type, quantity, order_id, reason, stock_after, reserved_after, low_stock) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING *;
+
+-- name: GetProductStockMovements :many
+SELECT * FROM stock_movements WHERE product_id = $1 ORDER BY created_at DESC, id;
+
+-- name: GetOrderReservedStock :many
+SELECT product_id, SUM(CASE movement_type WHEN 'reservation' THEN quantity ELSE -quantity END) AS reserved FROM stock_movements WHERE order_id = $1 AND movement_type IN ('reservation', 'release', 'shipment') GROUP BY product_id ORDER BY product_id;
+
+-- name: GetOpportunityProducts :many
+SELECT product FROM opportunity_products WHERE opportunity_id = $1 ORDER BY product;
+
+-- name: DeleteOpportunityProducts :exec
+DELETE FROM opportunity_products WHERE opportunity_id = $1;
 
+-- name: CreateOpportunityProduct :exec
+INSERT INTO opportunity_products (opportunity_id, product) VALUES ($1, $2);
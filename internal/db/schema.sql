@@ -4,44 +4,147 @@ CREATE TABLE customers (
     email VARCHAR(255) NOT NULL UNIQUE,
     phone VARCHAR(255) NOT NULL,
     address VARCHAR(255) NOT NULL,
+    pricing_tier VARCHAR(100) NOT NULL DEFAULT '',
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    credit_limit DECIMAL(10, 2) CHECK (credit_limit >= 0),
+    total_spent DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    last_purchase_at TIMESTAMP WITH TIME ZONE,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Counters behind human-readable document numbers. Rows are locked by the
+-- UPDATE that increments them, so numbers are issued without gaps.
+CREATE TABLE document_sequences (
+    name VARCHAR(50) PRIMARY KEY,
+    last_value BIGINT NOT NULL DEFAULT 0
+);
+
+INSERT INTO document_sequences (name) VALUES ('order'), ('invoice'), ('credit_note'), ('quote');
+
+-- Every version of a quote shares its quote_number. superseded_at is set on a
+-- version once a newer one exists.
+CREATE TABLE quotes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    quote_number VARCHAR(50) NOT NULL,
+    version INT NOT NULL DEFAULT 1 CHECK (version > 0),
+    customer_id UUID NOT NULL REFERENCES customers(id),
+    opportunity_id UUID,
+    status VARCHAR(50) NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'sent', 'accepted', 'declined', 'expired')),
+    valid_until DATE NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    subtotal DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    discount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    tax_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    total DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    sent_at TIMESTAMP WITH TIME ZONE,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+    declined_at TIMESTAMP WITH TIME ZONE,
+    superseded_at TIMESTAMP WITH TIME ZONE,
+    billing_address_id UUID,
+    shipping_address_id UUID,
+    notes TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (quote_number, version)
+);
+
+CREATE INDEX quotes_customer_idx ON quotes (customer_id);
+
 CREATE TABLE orders (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_number VARCHAR(50) NOT NULL UNIQUE,
     customer_id UUID NOT NULL REFERENCES customers(id),
-    total_price DECIMAL(10, 2) NOT NULL,
-    payment_status VARCHAR(255) NOT NULL,
-    order_status VARCHAR(255) NOT NULL,
-    order_type VARCHAR(255) NOT NULL,
-    order_date TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    delivery_date TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    delivery_address VARCHAR(255) NOT NULL,
-    delivery_status VARCHAR(255) NOT NULL,
-    delivery_date TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    status VARCHAR(50) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'confirmed', 'processing', 'shipped', 'delivered', 'cancelled', 'refunded')),
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    subtotal DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    discount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    tax_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    total DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    amount_paid DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    order_date TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    shipped_date TIMESTAMP WITH TIME ZONE,
+    delivered_date TIMESTAMP WITH TIME ZONE,
+    billing_address_id UUID,
+    shipping_address_id UUID,
+    quote_id UUID UNIQUE REFERENCES quotes(id), -- Set when the order was created by accepting a quote
+    notes TEXT NOT NULL DEFAULT '',
+    metadata JSONB NOT NULL DEFAULT '{}',
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE INDEX orders_customer_idx ON orders (customer_id, order_date);
+
 CREATE TABLE products (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    sku VARCHAR(100) NOT NULL UNIQUE,
     name VARCHAR(255) NOT NULL,
     description TEXT NOT NULL,
+    category VARCHAR(100) NOT NULL DEFAULT '',
+    tax_category VARCHAR(50) NOT NULL DEFAULT 'general',
+    status VARCHAR(50) NOT NULL DEFAULT 'active',
+    is_recurring BOOLEAN NOT NULL DEFAULT FALSE,
     price DECIMAL(10, 2) NOT NULL,
+    -- Inventory, changed only through stock_movements. Untracked products,
+    -- such as services, are never reserved or short of stock.
+    track_inventory BOOLEAN NOT NULL DEFAULT FALSE,
+    stock_quantity INT NOT NULL DEFAULT 0, -- On hand
+    reserved_quantity INT NOT NULL DEFAULT 0 CHECK (reserved_quantity >= 0), -- Held for confirmed orders not yet shipped
+    low_stock_alert INT NOT NULL DEFAULT 10 CHECK (low_stock_alert >= 0),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (stock_quantity >= reserved_quantity)
+);
+
+CREATE TABLE price_books (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    customer_id UUID REFERENCES customers(id),
+    pricing_tier VARCHAR(100),
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((customer_id IS NULL) <> (pricing_tier IS NULL))
+);
+
+CREATE TABLE price_book_entries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    price_book_id UUID NOT NULL REFERENCES price_books(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(id),
+    price DECIMAL(10, 2) NOT NULL,
+    effective_from DATE NOT NULL,
+    effective_to DATE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (effective_to IS NULL OR effective_to > effective_from)
 );
 
+CREATE INDEX price_book_entries_product_idx ON price_book_entries (product_id, effective_from);
+
 CREATE TABLE projects (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     name VARCHAR(255) NOT NULL,
     description TEXT NOT NULL,
     customer_id UUID NOT NULL REFERENCES customers(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'planning' CHECK (status IN ('planning', 'active', 'on_hold', 'completed', 'cancelled')),
+    start_date DATE,
+    end_date DATE,
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    budget DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (budget >= 0),
+    assigned_to_id UUID, -- The responsible user
+    template_id UUID, -- The template it was created from, if any
+    opportunity_id UUID, -- The won opportunity it was created for, if any
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (end_date IS NULL OR start_date IS NULL OR end_date >= start_date)
 );
 
+CREATE INDEX projects_customer_idx ON projects (customer_id, start_date);
+CREATE INDEX projects_assigned_to_idx ON projects (assigned_to_id) WHERE assigned_to_id IS NOT NULL;
+CREATE UNIQUE INDEX projects_opportunity_template_idx ON projects (opportunity_id, template_id) WHERE opportunity_id IS NOT NULL AND template_id IS NOT NULL;
+
 CREATE TABLE notes (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     project_id UUID REFERENCES projects(id),
@@ -52,23 +155,554 @@ CREATE TABLE notes (
 
 CREATE TABLE payments (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    order_id UUID NOT NULL REFERENCES orders(id),
-    amount DECIMAL(10, 2) NOT NULL,
+    customer_id UUID NOT NULL REFERENCES customers(id),
+    order_id UUID REFERENCES orders(id),
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
     payment_method VARCHAR(255) NOT NULL,
-    payment_status VARCHAR(255) NOT NULL,
+    payment_status VARCHAR(255) NOT NULL CHECK (payment_status IN ('pending', 'completed', 'failed', 'refunded')),
     payment_date TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    refunded_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    disputed_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    charged_back_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    transaction_id VARCHAR(255) NOT NULL DEFAULT '',
+    processor_reference VARCHAR(255) NOT NULL DEFAULT '',
+    processed_at TIMESTAMP WITH TIME ZONE,
+    processor_data JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (refunded_amount + disputed_amount + charged_back_amount <= amount)
+);
+
+CREATE INDEX payments_customer_idx ON payments (customer_id);
+CREATE UNIQUE INDEX payments_transaction_idx ON payments (transaction_id) WHERE transaction_id <> '';
+
+-- invoice_number stays NULL while the invoice is a draft.
+CREATE TABLE invoices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    invoice_number VARCHAR(50) UNIQUE,
+    kind VARCHAR(50) NOT NULL DEFAULT 'invoice' CHECK (kind IN ('invoice', 'credit_note')),
+    customer_id UUID NOT NULL REFERENCES customers(id),
+    order_id UUID REFERENCES orders(id),
+    credited_invoice_id UUID REFERENCES invoices(id),
+    status VARCHAR(50) NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'sent', 'partially_paid', 'paid', 'void')),
+    payment_terms VARCHAR(50) NOT NULL DEFAULT 'net_30' CHECK (payment_terms IN ('due_on_receipt', 'net_15', 'net_30')),
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    subtotal DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    discount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    tax_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    total DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    amount_paid DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    amount_credited DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    issue_date DATE,
+    due_date DATE,
+    sent_at TIMESTAMP WITH TIME ZONE,
+    paid_at TIMESTAMP WITH TIME ZONE,
+    voided_at TIMESTAMP WITH TIME ZONE,
+    billing_address_id UUID,
+    notes TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((kind = 'credit_note') = (credited_invoice_id IS NOT NULL))
+);
+
+CREATE INDEX invoices_customer_idx ON invoices (customer_id);
+
+-- An order has at most one live invoice.
+CREATE UNIQUE INDEX invoices_order_idx ON invoices (order_id) WHERE order_id IS NOT NULL AND kind = 'invoice' AND status <> 'void';
+
+CREATE TABLE invoice_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    invoice_id UUID NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+    product_id UUID REFERENCES products(id),
+    description VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    unit_price DECIMAL(10, 2) NOT NULL,
+    discount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    tax_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    total DECIMAL(10, 2) NOT NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE payment_applications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    payment_id UUID NOT NULL REFERENCES payments(id),
+    invoice_id UUID REFERENCES invoices(id),
+    order_id UUID REFERENCES orders(id),
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    realized_fx DECIMAL(10, 2) NOT NULL DEFAULT 0, -- Exchange gain or loss in the base currency
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (num_nonnulls(invoice_id, order_id) = 1)
+);
+
+CREATE INDEX payment_applications_payment_idx ON payment_applications (payment_id);
+CREATE INDEX payment_applications_invoice_idx ON payment_applications (invoice_id);
+CREATE INDEX payment_applications_order_idx ON payment_applications (order_id) WHERE order_id IS NOT NULL;
+
+CREATE TABLE refunds (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    payment_id UUID NOT NULL REFERENCES payments(id),
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    reason VARCHAR(50) NOT NULL CHECK (reason IN ('requested_by_customer', 'duplicate', 'billing_error', 'service_not_rendered', 'fraudulent', 'other')),
+    notes TEXT NOT NULL DEFAULT '',
+    refunded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    processor_reference VARCHAR(255) NOT NULL DEFAULT '',
+    processed_at TIMESTAMP WITH TIME ZONE,
+    processor_data JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX refunds_payment_idx ON refunds (payment_id);
+
+CREATE TABLE chargebacks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    payment_id UUID NOT NULL REFERENCES payments(id),
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    reason_code VARCHAR(50) NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'needs_response' CHECK (status IN ('needs_response', 'under_review', 'won', 'lost')),
+    disputed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    evidence_due_by TIMESTAMP WITH TIME ZONE,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    notes TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX chargebacks_payment_idx ON chargebacks (payment_id);
+
+-- ledger_entries is append-only: corrections are new entries.
+CREATE TABLE ledger_entries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    payment_id UUID NOT NULL REFERENCES payments(id),
+    entry_type VARCHAR(50) NOT NULL CHECK (entry_type IN ('payment_received', 'payment_applied', 'application_reversed', 'refund', 'chargeback', 'chargeback_won', 'chargeback_lost')),
+    debit_account VARCHAR(50) NOT NULL,
+    credit_account VARCHAR(50) NOT NULL CHECK (credit_account <> debit_account),
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    realized_fx DECIMAL(10, 2) NOT NULL DEFAULT 0, -- Exchange gain or loss in the base currency; given back by reversals
+    invoice_id UUID REFERENCES invoices(id),
+    order_id UUID REFERENCES orders(id),
+    refund UUID REFERENCES refunds(id),
+    chargeback_id UUID REFERENCES chargebacks(id),
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX ledger_entries_payment_idx ON ledger_entries (payment_id);
+
+CREATE FUNCTION reject_ledger_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger entries cannot be changed';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_entries_immutable BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION reject_ledger_change();
+
 CREATE TABLE order_items (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    order_id UUID NOT NULL REFERENCES orders(id),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
     product_id UUID NOT NULL REFERENCES products(id),
-    quantity INT NOT NULL,
-    price DECIMAL(10, 2) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    quantity INT NOT NULL CHECK (quantity > 0),
+    unit_price DECIMAL(10, 2) NOT NULL,
+    discount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    discounts JSONB, -- The discount rules that make up discount
+    tax_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    total DECIMAL(10, 2) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+
+
+CREATE TABLE subscriptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    customer_id UUID NOT NULL REFERENCES customers(id),
+    kind VARCHAR(50) NOT NULL DEFAULT 'subscription' CHECK (kind IN ('subscription', 'retainer')),
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(50) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'paused', 'cancelled')),
+    billing_interval VARCHAR(50) NOT NULL CHECK (billing_interval IN ('monthly', 'quarterly', 'annual')),
+    anchor_date DATE NOT NULL,
+    next_billing_date DATE NOT NULL,
+    payment_terms VARCHAR(50) NOT NULL DEFAULT 'net_30' CHECK (payment_terms IN ('due_on_receipt', 'net_15', 'net_30')),
+    billing_address_id UUID,
+    notes TEXT NOT NULL DEFAULT '',
+    paused_at TIMESTAMP WITH TIME ZONE,
+    cancel_at DATE,
+    cancelled_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX subscriptions_customer_idx ON subscriptions (customer_id);
+CREATE INDEX subscriptions_due_idx ON subscriptions (status, next_billing_date);
+
+CREATE TABLE subscription_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    product_id UUID REFERENCES products(id),
+    description VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    unit_price DECIMAL(10, 2) NOT NULL,
+    discount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- invoice_id stays NULL until the adjustment is billed on a cycle invoice.
+CREATE TABLE subscription_adjustments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    description VARCHAR(255) NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    effective_date DATE NOT NULL,
+    invoice_id UUID REFERENCES invoices(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX subscription_adjustments_unbilled_idx ON subscription_adjustments (subscription_id) WHERE invoice_id IS NULL;
+
+-- The primary key is what keeps a cycle from being billed twice.
+CREATE TABLE subscription_cycles (
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id),
+    period_start DATE NOT NULL,
+    period_end DATE NOT NULL CHECK (period_end > period_start),
+    invoice_id UUID NOT NULL REFERENCES invoices(id),
+    billed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (subscription_id, period_start)
+);
+
+CREATE TABLE activities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    customer_id UUID REFERENCES customers(id),
+    activity_type VARCHAR(50) NOT NULL CHECK (activity_type IN ('call', 'email', 'meeting', 'task', 'note', 'other')),
+    description TEXT NOT NULL DEFAULT '',
+    activity_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT '',
+    priority VARCHAR(50) NOT NULL DEFAULT '',
+    category VARCHAR(50) NOT NULL DEFAULT '',
+    tags JSONB,
+    metadata JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX activities_customer_idx ON activities (customer_id, activity_date);
+
+-- Each invoice gets each dunning stage once; the unique constraint is what
+-- stops two runs from emailing twice.
+CREATE TABLE dunning_notices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    invoice_id UUID NOT NULL REFERENCES invoices(id),
+    customer_id UUID NOT NULL REFERENCES customers(id),
+    stage VARCHAR(50) NOT NULL,
+    days_overdue INT NOT NULL,
+    balance DECIMAL(10, 2) NOT NULL,
+    recipient VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    sent_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (invoice_id, stage)
+);
+
+CREATE INDEX invoices_open_idx ON invoices (issue_date) WHERE kind = 'invoice' AND status IN ('sent', 'partially_paid');
+
+-- A manager's approval of an order above the customer's credit limit, with
+-- the figures the approval was based on.
+CREATE TABLE credit_overrides (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id UUID REFERENCES orders(id) ON DELETE SET NULL, -- Kept for audit once the order is deleted
+    customer_id UUID NOT NULL REFERENCES customers(id),
+    approved_by VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL,
+    credit_limit DECIMAL(10, 2) NOT NULL,
+    open_balance DECIMAL(10, 2) NOT NULL,
+    order_total DECIMAL(10, 2) NOT NULL,
+    approved_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX credit_overrides_order_idx ON credit_overrides (order_id);
+CREATE INDEX credit_overrides_customer_idx ON credit_overrides (customer_id, approved_at);
+
+CREATE TABLE tax_exemption_certificates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    customer_id UUID NOT NULL REFERENCES customers(id),
+    certificate_number VARCHAR(100) NOT NULL,
+    state VARCHAR(10) NOT NULL DEFAULT '', -- Empty for a multi-state certificate
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    issued_on DATE NOT NULL,
+    expires_on DATE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (expires_on IS NULL OR expires_on >= issued_on)
+);
+
+CREATE INDEX tax_exemption_certificates_customer_idx ON tax_exemption_certificates (customer_id);
+
+CREATE TABLE discount_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    discount_type VARCHAR(50) NOT NULL CHECK (discount_type IN ('percentage', 'fixed_amount')),
+    scope VARCHAR(50) NOT NULL CHECK (scope IN ('order', 'line')),
+    percentage DECIMAL(5, 2) NOT NULL DEFAULT 0,
+    amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    product_id UUID REFERENCES products(id),
+    first_engagement_only BOOLEAN NOT NULL DEFAULT FALSE,
+    requires_coupon BOOLEAN NOT NULL DEFAULT FALSE,
+    starts_at TIMESTAMP WITH TIME ZONE,
+    ends_at TIMESTAMP WITH TIME ZONE,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    priority INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE coupons (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code VARCHAR(100) NOT NULL UNIQUE,
+    rule_id UUID NOT NULL REFERENCES discount_rules(id),
+    max_redemptions INT CHECK (max_redemptions > 0),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Redemptions by cancelled orders do not count towards max_redemptions.
+CREATE TABLE coupon_redemptions (
+    coupon_id UUID NOT NULL REFERENCES coupons(id),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (coupon_id, order_id)
+);
+
+CREATE INDEX coupon_redemptions_order_idx ON coupon_redemptions (order_id);
+
+CREATE TABLE quote_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    quote_id UUID NOT NULL REFERENCES quotes(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(id),
+    description TEXT NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    unit_price DECIMAL(10, 2) NOT NULL,
+    discount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    discounts JSONB,
+    tax_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    total DECIMAL(10, 2) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Revenue mappings are keyed by product category; the empty key is the
+-- default revenue account. Sales tax has a single mapping with an empty key.
+CREATE TABLE account_mappings (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('ledger', 'revenue', 'sales_tax', 'fx_gain_loss')),
+    key VARCHAR(100) NOT NULL DEFAULT '',
+    account_code VARCHAR(50) NOT NULL,
+    account_name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (kind, key)
+);
+
+CREATE TABLE accounting_exports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    format VARCHAR(20) NOT NULL CHECK (format IN ('quickbooks_iif', 'xero_csv', 'journal_csv')),
+    period_from DATE NOT NULL,
+    period_to DATE NOT NULL CHECK (period_to >= period_from),
+    entry_count INT NOT NULL DEFAULT 0,
+    content BYTEA NOT NULL DEFAULT '', -- The file as handed over; downloads return it unchanged
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- One row per journal entry ever exported. source_id is the invoice or
+-- credit note for invoice entries and the ledger entry for payment entries;
+-- the primary key keeps an entry out of every export but the first.
+CREATE TABLE exported_journal_entries (
+    source VARCHAR(20) NOT NULL CHECK (source IN ('invoice', 'invoice_void', 'credit_note', 'ledger_entry')),
+    source_id UUID NOT NULL,
+    export_id UUID NOT NULL REFERENCES accounting_exports(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (source, source_id)
+);
+
+CREATE INDEX exported_journal_entries_export_idx ON exported_journal_entries (export_id);
+
+-- Every change to a product's stock. quantity is positive except for
+-- adjustments, which may go either way; stock_after and reserved_after are
+-- the product's quantities once the movement was applied.
+CREATE TABLE stock_movements (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    movement_type VARCHAR(20) NOT NULL CHECK (movement_type IN ('receipt', 'reservation', 'release', 'shipment', 'adjustment')),
+    quantity INT NOT NULL CHECK (quantity <> 0),
+    order_id UUID REFERENCES orders(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    stock_after INT NOT NULL,
+    reserved_after INT NOT NULL,
+    low_stock BOOLEAN NOT NULL DEFAULT FALSE, -- The movement took available stock to or below the alert threshold
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX stock_movements_product_idx ON stock_movements (product_id, created_at);
+CREATE INDEX stock_movements_order_idx ON stock_movements (order_id) WHERE order_id IS NOT NULL;
+
+-- A task with subtasks is a summary task scheduled around them.
+CREATE TABLE project_tasks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    parent_id UUID REFERENCES project_tasks(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'todo' CHECK (status IN ('todo', 'in_progress', 'review', 'completed', 'cancelled')),
+    priority VARCHAR(20) NOT NULL DEFAULT 'medium' CHECK (priority IN ('low', 'medium', 'high', 'urgent')),
+    position INT NOT NULL DEFAULT 0,
+    duration_days INT NOT NULL DEFAULT 1 CHECK (duration_days >= 0),
+    estimated_hours NUMERIC(8, 2) NOT NULL DEFAULT 0 CHECK (estimated_hours >= 0),
+    due_date DATE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    assignee_ids JSONB NOT NULL DEFAULT '[]', -- User IDs
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (parent_id <> id)
+);
+
+CREATE INDEX project_tasks_project_idx ON project_tasks (project_id, position);
+
+-- Finish-to-start: task_id cannot start until depends_on_id has finished.
+CREATE TABLE project_task_dependencies (
+    task_id UUID NOT NULL REFERENCES project_tasks(id) ON DELETE CASCADE,
+    depends_on_id UUID NOT NULL REFERENCES project_tasks(id) ON DELETE CASCADE,
+    PRIMARY KEY (task_id, depends_on_id),
+    CHECK (task_id <> depends_on_id)
+);
+
+CREATE INDEX project_task_dependencies_depends_on_idx ON project_task_dependencies (depends_on_id);
+
+-- The products an opportunity is for. Winning it instantiates the project
+-- templates of each.
+CREATE TABLE opportunity_products (
+    opportunity_id UUID NOT NULL,
+    product VARCHAR(50) NOT NULL,
+    PRIMARY KEY (opportunity_id, product)
+);
+
+-- Tasks and milestones refer to each other by ref and are dated in days
+-- from the project start.
+CREATE TABLE project_templates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    product VARCHAR(50) NOT NULL DEFAULT '', -- Opportunity product that instantiates it when won
+    duration_days INT NOT NULL DEFAULT 0 CHECK (duration_days >= 0),
+    role_assignees JSONB NOT NULL DEFAULT '{}', -- Role to default user ID
+    tasks JSONB NOT NULL DEFAULT '[]',
+    milestones JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX project_templates_product_idx ON project_templates (product);
+
+-- A milestone with tasks completes when they do. The amount is in the
+-- project's currency and is invoiced once, on completion, when billable.
+-- While the invoice is being raised the milestone carries the billing claim.
+CREATE TABLE project_milestones (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    due_date DATE NOT NULL,
+    billable BOOLEAN NOT NULL DEFAULT FALSE,
+    amount DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (amount >= 0),
+    completed_at TIMESTAMP WITH TIME ZONE,
+    invoice_id UUID REFERENCES invoices(id) ON DELETE SET NULL,
+    billing_claim UUID,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX project_milestones_project_idx ON project_milestones (project_id, due_date);
+
+CREATE TABLE project_milestone_tasks (
+    milestone_id UUID NOT NULL REFERENCES project_milestones(id) ON DELETE CASCADE,
+    task_id UUID NOT NULL REFERENCES project_tasks(id) ON DELETE CASCADE,
+    PRIMARY KEY (milestone_id, task_id)
+);
+
+-- An entry with started_at and no ended_at is its user's running timer.
+-- Amount is minutes at the hourly rate, in the project's currency. While
+-- an invoice is being raised its entries carry the billing claim, so that
+-- they are billed once.
+CREATE TABLE time_entries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    task_id UUID REFERENCES project_tasks(id) ON DELETE SET NULL,
+    work_date DATE NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE,
+    ended_at TIMESTAMP WITH TIME ZONE,
+    minutes INT NOT NULL DEFAULT 0 CHECK (minutes >= 0 AND minutes <= 1440),
+    billable BOOLEAN NOT NULL DEFAULT FALSE,
+    rate DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (rate >= 0),
+    amount DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (amount >= 0),
+    notes TEXT NOT NULL DEFAULT '',
+    invoice_id UUID REFERENCES invoices(id) ON DELETE SET NULL,
+    billing_claim UUID,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ended_at IS NULL OR (started_at IS NOT NULL AND ended_at > started_at))
+);
+
+CREATE INDEX time_entries_project_idx ON time_entries (project_id, work_date);
+CREATE INDEX time_entries_user_idx ON time_entries (user_id, work_date);
+CREATE UNIQUE INDEX time_entries_running_idx ON time_entries (user_id) WHERE started_at IS NOT NULL AND ended_at IS NULL;
+CREATE INDEX time_entries_billing_claim_idx ON time_entries (billing_claim) WHERE billing_claim IS NOT NULL;
+
+-- A week with no row is open.
+CREATE TABLE timesheets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    week_start DATE NOT NULL CHECK (EXTRACT(ISODOW FROM week_start) = 1), -- Monday
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'submitted', 'approved')),
+    submitted_at TIMESTAMP WITH TIME ZONE,
+    approved_at TIMESTAMP WITH TIME ZONE,
+    approved_by_id UUID,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, week_start)
+);
+
+-- Amounts are in the project's currency. A reimbursable expense is billed
+-- at billable_amount, the amount plus markup; the billing claim works as on
+-- time entries.
+CREATE TABLE project_expenses (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    category VARCHAR(20) NOT NULL DEFAULT 'other' CHECK (category IN ('filing_fee', 'travel', 'courier', 'software', 'other')),
+    description VARCHAR(255) NOT NULL,
+    expense_date DATE NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    receipt_ref VARCHAR(255) NOT NULL DEFAULT '', -- Where the receipt is stored
+    reimbursable BOOLEAN NOT NULL DEFAULT FALSE,
+    markup_percent DECIMAL(5, 2) NOT NULL DEFAULT 0 CHECK (markup_percent >= 0 AND markup_percent <= 100),
+    billable_amount DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (billable_amount >= 0),
+    invoice_id UUID REFERENCES invoices(id) ON DELETE SET NULL,
+    billing_claim UUID,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
 
+CREATE INDEX project_expenses_project_idx ON project_expenses (project_id, expense_date);
+CREATE INDEX project_expenses_billing_claim_idx ON project_expenses (billing_claim) WHERE billing_claim IS NOT NULL;
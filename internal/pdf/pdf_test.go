@@ -0,0 +1,72 @@
+package pdf
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite_XrefOffsetsPointAtObjects(t *testing.T) {
+	doc := NewDocument("INV-000001")
+	page := doc.AddPage()
+	page.Text(40, 60, HelveticaBold, 16, "Invoice (copy)")
+	page.Line(40, 70, 572, 70, 0.5)
+	doc.AddPage().Text(40, 60, Helvetica, 10, "Page 2")
+
+	var buf bytes.Buffer
+	require.NoError(t, doc.Write(&buf))
+	out := buf.Bytes()
+
+	assert.True(t, bytes.HasPrefix(out, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(out, []byte("%%EOF\n")))
+	assert.Contains(t, string(out), "/Count 2")
+
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+	require.NotNil(t, startxref)
+	xref, err := strconv.Atoi(string(startxref[1]))
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(out[xref:], []byte("xref\n")))
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[xref:], -1)
+	require.Len(t, entries, 9)
+	for i, entry := range entries {
+		offset, err := strconv.Atoi(string(entry[1]))
+		require.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(out[offset:], []byte(strconv.Itoa(i+1)+" 0 obj")), "object %d", i+1)
+	}
+}
+
+func TestWrite_IsDeterministic(t *testing.T) {
+	render := func() []byte {
+		doc := NewDocument("Statement")
+		doc.AddPage().TextRight(572, 100, Helvetica, 10, "1,234.50")
+		var buf bytes.Buffer
+		require.NoError(t, doc.Write(&buf))
+		return buf.Bytes()
+	}
+
+	assert.Equal(t, render(), render())
+}
+
+func TestEscape(t *testing.T) {
+	assert.Equal(t, `a\(b\)c\\d`, escape(`a(b)c\d`))
+	assert.Equal(t, "Caf\xe9 ?", escape("Café €"))
+}
+
+func TestTextWidth(t *testing.T) {
+	assert.InDelta(t, 5.56, TextWidth(Helvetica, 10, "0"), 0.001)
+	assert.InDelta(t, 6.11, TextWidth(HelveticaBold, 10, "b"), 0.001)
+	assert.InDelta(t, 0, TextWidth(Helvetica, 10, ""), 0.001)
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", Truncate(Helvetica, 10, 100, "short"))
+
+	truncated := Truncate(Helvetica, 10, 60, "Registered agent services for the year")
+	assert.LessOrEqual(t, TextWidth(Helvetica, 10, truncated), 60.0)
+	assert.Regexp(t, `\.\.\.$`, truncated)
+}
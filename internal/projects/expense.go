@@ -0,0 +1,178 @@
+package projects
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrExpenseNotFound        = errors.New("expense not found")
+	ErrInvalidExpense         = errors.New("invalid expense")
+	ErrExpenseInvoiced        = errors.New("expense has been invoiced")
+	ErrNoReimbursableExpenses = errors.New("no reimbursable expenses to invoice")
+)
+
+// Expense is money spent on a project, in the project's currency. A
+// reimbursable expense is passed on to the customer with its markup; every
+// expense counts towards the project's actual cost.
+type Expense struct {
+	core.BaseModel
+	ProjectID   uuid.UUID       `json:"project_id"`
+	Category    ExpenseCategory `json:"category"`
+	Description string          `json:"description"`
+	Date        time.Time       `json:"date"`
+	Amount      core.Money      `json:"amount"`      // What was spent
+	ReceiptRef  string          `json:"receipt_ref"` // Where the receipt is stored, e.g. a document key
+
+	// Rebilling
+	Reimbursable   bool       `json:"reimbursable"`
+	MarkupPercent  float64    `json:"markup_percent"`  // e.g. 10 for 10%
+	BillableAmount core.Money `json:"billable_amount"` // Amount plus markup; zero unless reimbursable
+	InvoiceID      *uuid.UUID `json:"invoice_id"`      // The draft invoice the expense was billed on
+}
+
+type ExpenseCategory string
+
+const (
+	ExpenseCategoryFilingFee ExpenseCategory = "filing_fee"
+	ExpenseCategoryTravel    ExpenseCategory = "travel"
+	ExpenseCategoryCourier   ExpenseCategory = "courier"
+	ExpenseCategorySoftware  ExpenseCategory = "software"
+	ExpenseCategoryOther     ExpenseCategory = "other"
+)
+
+func (c ExpenseCategory) Valid() bool {
+	switch c {
+	case ExpenseCategoryFilingFee, ExpenseCategoryTravel, ExpenseCategoryCourier, ExpenseCategorySoftware, ExpenseCategoryOther:
+		return true
+	}
+	return false
+}
+
+// price sets the billable amount from the amount and markup, rounding half
+// up to the minor unit.
+func (e *Expense) price() error {
+	if !e.Reimbursable {
+		e.BillableAmount = core.Zero(e.Amount.Currency())
+		return nil
+	}
+	factor, err := core.PercentRate(e.MarkupPercent)
+	if err != nil {
+		return fmt.Errorf("%w: the markup must have at most two decimal places", ErrInvalidExpense)
+	}
+	factor.Add(factor, big.NewRat(1, 1))
+	billable, err := e.Amount.Mul(factor, core.RoundHalfUp)
+	if err != nil {
+		return fmt.Errorf("failed to price expense: %w", err)
+	}
+	e.BillableAmount = billable
+	return nil
+}
+
+// ExpenseFilter narrows an expense listing. Zero fields do not filter; From
+// and To are inclusive dates.
+type ExpenseFilter struct {
+	ProjectID  *uuid.UUID      `json:"project_id"`
+	CustomerID *uuid.UUID      `json:"customer_id"`
+	Category   ExpenseCategory `json:"category"`
+	From       *time.Time      `json:"from"`
+	To         *time.Time      `json:"to"`
+}
+
+// ExpenseTotal adds up a set of expenses: their cost and what is billed
+// for them.
+type ExpenseTotal struct {
+	Count    int        `json:"count"`
+	Total    core.Money `json:"total"`
+	Billable core.Money `json:"billable"`
+}
+
+func (t *ExpenseTotal) add(expense *Expense) error {
+	total, err := t.Total.Add(expense.Amount)
+	if err != nil {
+		return err
+	}
+	billable, err := t.Billable.Add(expense.BillableAmount)
+	if err != nil {
+		return err
+	}
+	t.Count, t.Total, t.Billable = t.Count+1, total, billable
+	return nil
+}
+
+// ExpenseReport sums expenses in one currency, split by category and, for
+// a customer, by project.
+type ExpenseReport struct {
+	Currency core.Currency `json:"currency"`
+	ExpenseTotal
+	Reimbursable core.Money                       `json:"reimbursable"` // At cost
+	Invoiced     core.Money                       `json:"invoiced"`     // Billable amount already on invoices
+	Uninvoiced   core.Money                       `json:"uninvoiced"`   // Billable amount still to invoice
+	ByCategory   map[ExpenseCategory]ExpenseTotal `json:"by_category"`
+	ByProject    map[uuid.UUID]ExpenseTotal       `json:"by_project,omitempty"`
+}
+
+func newExpenseReport(currency core.Currency, byProject bool) *ExpenseReport {
+	zero := core.Zero(currency)
+	report := &ExpenseReport{
+		Currency:     currency,
+		ExpenseTotal: ExpenseTotal{Total: zero, Billable: zero},
+		Reimbursable: zero,
+		Invoiced:     zero,
+		Uninvoiced:   zero,
+		ByCategory:   make(map[ExpenseCategory]ExpenseTotal),
+	}
+	if byProject {
+		report.ByProject = make(map[uuid.UUID]ExpenseTotal)
+	}
+	return report
+}
+
+// add counts the expense, which must be in the report's currency.
+func (r *ExpenseReport) add(expense *Expense) error {
+	if expense.Amount.Currency() != r.Currency {
+		return fmt.Errorf("%w: expense %s is in %s, the report in %s", core.ErrCurrencyMismatch, expense.ID, expense.Amount.Currency(), r.Currency)
+	}
+	if err := r.ExpenseTotal.add(expense); err != nil {
+		return err
+	}
+	zero := core.Zero(r.Currency)
+	category := r.ByCategory[expense.Category]
+	if category.Count == 0 {
+		category.Total, category.Billable = zero, zero
+	}
+	if err := category.add(expense); err != nil {
+		return err
+	}
+	r.ByCategory[expense.Category] = category
+	if r.ByProject != nil {
+		project := r.ByProject[expense.ProjectID]
+		if project.Count == 0 {
+			project.Total, project.Billable = zero, zero
+		}
+		if err := project.add(expense); err != nil {
+			return err
+		}
+		r.ByProject[expense.ProjectID] = project
+	}
+
+	if !expense.Reimbursable {
+		return nil
+	}
+	var err error
+	if r.Reimbursable, err = r.Reimbursable.Add(expense.Amount); err != nil {
+		return err
+	}
+	if expense.InvoiceID != nil {
+		r.Invoiced, err = r.Invoiced.Add(expense.BillableAmount)
+	} else {
+		r.Uninvoiced, err = r.Uninvoiced.Add(expense.BillableAmount)
+	}
+	return err
+}
@@ -0,0 +1,163 @@
+package projects
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+type expenseRepository struct {
+	db *sql.DB
+}
+
+func NewExpenseRepository(db *sql.DB) ExpenseRepository {
+	return &expenseRepository{db: db}
+}
+
+const expenseColumns = "x.id, x.project_id, x.category, x.description, x.expense_date, x.amount, p.currency, x.receipt_ref, x.reimbursable, x.markup_percent, x.billable_amount, x.invoice_id, x.created_at, x.updated_at"
+
+const expenseFrom = " FROM project_expenses x JOIN projects p ON p.id = x.project_id"
+
+func scanExpense(row rowScanner) (*Expense, error) {
+	var expense Expense
+	var currency core.Currency
+	err := row.Scan(&expense.ID, &expense.ProjectID, &expense.Category, &expense.Description, &expense.Date, &expense.Amount, &currency, &expense.ReceiptRef, &expense.Reimbursable, &expense.MarkupPercent, &expense.BillableAmount, &expense.InvoiceID, &expense.CreatedAt, &expense.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrExpenseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The amounts were scanned before their currency was known.
+	if expense.Amount, err = expense.Amount.Reread(currency); err != nil {
+		return nil, err
+	}
+	if expense.BillableAmount, err = expense.BillableAmount.Reread(currency); err != nil {
+		return nil, err
+	}
+	return &expense, nil
+}
+
+func scanExpenses(rows *sql.Rows) ([]*Expense, error) {
+	defer rows.Close()
+	var expenses []*Expense
+	for rows.Next() {
+		expense, err := scanExpense(rows)
+		if err != nil {
+			return nil, err
+		}
+		expenses = append(expenses, expense)
+	}
+	return expenses, rows.Err()
+}
+
+func (r *expenseRepository) GetExpenseByID(ctx context.Context, id uuid.UUID) (*Expense, error) {
+	return scanExpense(r.db.QueryRowContext(ctx, "SELECT "+expenseColumns+expenseFrom+" WHERE x.id = $1", id))
+}
+
+func (r *expenseRepository) ListExpenses(ctx context.Context, filter ExpenseFilter) ([]*Expense, error) {
+	var conditions []string
+	var args []any
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", fmt.Sprintf("$%d", len(args))))
+	}
+	if filter.ProjectID != nil {
+		where("x.project_id = ?", *filter.ProjectID)
+	}
+	if filter.CustomerID != nil {
+		where("p.customer_id = ?", *filter.CustomerID)
+	}
+	if filter.Category != "" {
+		where("x.category = ?", filter.Category)
+	}
+	if filter.From != nil {
+		where("x.expense_date >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		where("x.expense_date <= ?", *filter.To)
+	}
+
+	query := "SELECT " + expenseColumns + expenseFrom
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	rows, err := r.db.QueryContext(ctx, query+" ORDER BY x.expense_date, x.created_at, x.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanExpenses(rows)
+}
+
+func (r *expenseRepository) CreateExpense(ctx context.Context, expense Expense) (*Expense, error) {
+	if expense.ID == uuid.Nil {
+		expense.ID = uuid.New()
+	}
+	return r.saveExpense(ctx, expense, "INSERT INTO project_expenses (id, project_id, category, description, expense_date, amount, receipt_ref, reimbursable, markup_percent, billable_amount) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)")
+}
+
+// UpdateExpense changes an expense that is not billed, returning
+// ErrExpenseInvoiced otherwise. The project stays as it is.
+func (r *expenseRepository) UpdateExpense(ctx context.Context, expense Expense) (*Expense, error) {
+	return r.saveExpense(ctx, expense, "UPDATE project_expenses SET category = $3, description = $4, expense_date = $5, amount = $6, receipt_ref = $7, reimbursable = $8, markup_percent = $9, billable_amount = $10, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND project_id = $2 AND "+unbilled)
+}
+
+func (r *expenseRepository) saveExpense(ctx context.Context, expense Expense, query string) (*Expense, error) {
+	result, err := r.db.ExecContext(ctx, query,
+		expense.ID, expense.ProjectID, expense.Category, expense.Description, expense.Date, expense.Amount, expense.ReceiptRef, expense.Reimbursable, expense.MarkupPercent, expense.BillableAmount)
+	if err != nil {
+		return nil, err
+	}
+	if count, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if count == 0 {
+		return nil, ErrExpenseInvoiced
+	}
+	return r.GetExpenseByID(ctx, expense.ID)
+}
+
+func (r *expenseRepository) DeleteExpense(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM project_expenses WHERE id = $1 AND "+unbilled, id)
+	if err != nil {
+		return err
+	}
+	if count, err := result.RowsAffected(); err != nil {
+		return err
+	} else if count == 0 {
+		return ErrExpenseInvoiced
+	}
+	return nil
+}
+
+// ClaimReimbursableExpenses marks the project's unbilled reimbursable
+// expenses with the claim and returns them. A concurrent claim skips the
+// expenses claimed here, so none is billed twice.
+func (r *expenseRepository) ClaimReimbursableExpenses(ctx context.Context, projectID uuid.UUID, claim uuid.UUID) ([]*Expense, error) {
+	rows, err := r.db.QueryContext(ctx, `UPDATE project_expenses x SET billing_claim = $2, updated_at = CURRENT_TIMESTAMP
+		FROM projects p
+		WHERE p.id = x.project_id AND x.project_id = $1 AND x.reimbursable AND x.billable_amount > 0 AND x.invoice_id IS NULL AND x.billing_claim IS NULL
+		RETURNING `+expenseColumns, projectID, claim)
+	if err != nil {
+		return nil, err
+	}
+	return scanExpenses(rows)
+}
+
+// AttachExpenseClaimToInvoice records the invoice the claimed expenses were
+// billed on and lets go of the claim.
+func (r *expenseRepository) AttachExpenseClaimToInvoice(ctx context.Context, claim uuid.UUID, invoiceID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE project_expenses SET invoice_id = $2, billing_claim = NULL, updated_at = CURRENT_TIMESTAMP WHERE billing_claim = $1", claim, invoiceID)
+	return err
+}
+
+// ReleaseExpenseClaim returns the claimed expenses to unbilled.
+func (r *expenseRepository) ReleaseExpenseClaim(ctx context.Context, claim uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE project_expenses SET billing_claim = NULL, updated_at = CURRENT_TIMESTAMP WHERE billing_claim = $1", claim)
+	return err
+}
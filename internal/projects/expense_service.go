@@ -0,0 +1,309 @@
+package projects
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"rva_crm/internal/billing"
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+)
+
+type ExpenseService interface {
+	ExpenseManager
+	ExpenseReporter
+	ExpenseInvoicer
+	CostSource
+}
+
+type ExpenseRepository interface {
+	ExpenseManager
+	ExpenseBillingClaimer
+}
+
+type ExpenseManager interface {
+	ExpenseReader
+	ExpenseWriter
+}
+
+type ExpenseReader interface {
+	ExpenseRetriever
+	ExpenseLister
+}
+
+type ExpenseWriter interface {
+	ExpenseCreator
+	ExpenseUpdater
+	ExpenseDeleter
+}
+
+type ExpenseRetriever interface {
+	GetExpenseByID(ctx context.Context, id uuid.UUID) (*Expense, error)
+}
+
+// ExpenseLister returns expenses matching the filter, by date.
+type ExpenseLister interface {
+	ListExpenses(ctx context.Context, filter ExpenseFilter) ([]*Expense, error)
+}
+
+type ExpenseCreator interface {
+	CreateExpense(ctx context.Context, expense Expense) (*Expense, error)
+}
+
+// ExpenseUpdater changes an expense that is not yet invoiced.
+type ExpenseUpdater interface {
+	UpdateExpense(ctx context.Context, expense Expense) (*Expense, error)
+}
+
+// ExpenseDeleter deletes an expense that is not yet invoiced.
+type ExpenseDeleter interface {
+	DeleteExpense(ctx context.Context, id uuid.UUID) error
+}
+
+// ExpenseReporter sums expenses dated within an optional range. A customer's
+// report has one entry per currency its projects are in.
+type ExpenseReporter interface {
+	GetProjectExpenseReport(ctx context.Context, projectID uuid.UUID, from, to *time.Time) (*ExpenseReport, error)
+	GetCustomerExpenseReport(ctx context.Context, customerID uuid.UUID, from, to *time.Time) ([]*ExpenseReport, error)
+}
+
+// ExpenseBillingClaimer claims unbilled reimbursable expenses for an invoice
+// being raised, so that they are billed once. The claim is either attached
+// to the invoice or released.
+type ExpenseBillingClaimer interface {
+	ClaimReimbursableExpenses(ctx context.Context, projectID uuid.UUID, claim uuid.UUID) ([]*Expense, error)
+	AttachExpenseClaimToInvoice(ctx context.Context, claim uuid.UUID, invoiceID uuid.UUID) error
+	ReleaseExpenseClaim(ctx context.Context, claim uuid.UUID) error
+}
+
+// ExpenseInvoicer raises a draft invoice for the project's reimbursable
+// expenses that have not been invoiced.
+type ExpenseInvoicer interface {
+	InvoiceProjectExpenses(ctx context.Context, projectID uuid.UUID) (*billing.Invoice, error)
+}
+
+type expenseService struct {
+	repo      ExpenseRepository
+	projects  ProjectRetriever
+	customers customers.CustomerRetriever
+	invoices  billing.InvoiceCreator
+}
+
+// NewExpenseService raises draft invoices for reimbursable expenses through
+// invoices.
+func NewExpenseService(repo ExpenseRepository, projects ProjectRetriever, customers customers.CustomerRetriever, invoices billing.InvoiceCreator) ExpenseService {
+	return &expenseService{repo: repo, projects: projects, customers: customers, invoices: invoices}
+}
+
+func (s *expenseService) GetExpenseByID(ctx context.Context, id uuid.UUID) (*Expense, error) {
+	return s.repo.GetExpenseByID(ctx, id)
+}
+
+func (s *expenseService) ListExpenses(ctx context.Context, filter ExpenseFilter) ([]*Expense, error) {
+	if filter.Category != "" && !filter.Category.Valid() {
+		return nil, fmt.Errorf("%w: unknown category %q", ErrInvalidExpense, filter.Category)
+	}
+	if err := normalizeExpenseRange(&filter.From, &filter.To); err != nil {
+		return nil, err
+	}
+	return s.repo.ListExpenses(ctx, filter)
+}
+
+func (s *expenseService) CreateExpense(ctx context.Context, expense Expense) (*Expense, error) {
+	if err := s.normalizeExpense(ctx, &expense); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateExpense(ctx, expense)
+}
+
+// UpdateExpense changes an unbilled expense, keeping its project.
+func (s *expenseService) UpdateExpense(ctx context.Context, expense Expense) (*Expense, error) {
+	existing, err := s.repo.GetExpenseByID(ctx, expense.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.InvoiceID != nil {
+		return nil, ErrExpenseInvoiced
+	}
+	expense.ProjectID = existing.ProjectID
+	if err := s.normalizeExpense(ctx, &expense); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateExpense(ctx, expense)
+}
+
+func (s *expenseService) DeleteExpense(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteExpense(ctx, id)
+}
+
+func (s *expenseService) GetProjectExpenseReport(ctx context.Context, projectID uuid.UUID, from, to *time.Time) (*ExpenseReport, error) {
+	project, err := s.projects.GetProjectByID(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if err := normalizeExpenseRange(&from, &to); err != nil {
+		return nil, err
+	}
+	expenses, err := s.repo.ListExpenses(ctx, ExpenseFilter{ProjectID: &projectID, From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+	report := newExpenseReport(project.Currency, false)
+	for _, expense := range expenses {
+		if err := report.add(expense); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// GetCustomerExpenseReport reports in the customer's currency when there is
+// nothing to report.
+func (s *expenseService) GetCustomerExpenseReport(ctx context.Context, customerID uuid.UUID, from, to *time.Time) ([]*ExpenseReport, error) {
+	customer, err := s.customers.GetCustomerByID(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if customer.ID == uuid.Nil {
+		return nil, ErrCustomerNotFound
+	}
+	if err := normalizeExpenseRange(&from, &to); err != nil {
+		return nil, err
+	}
+	expenses, err := s.repo.ListExpenses(ctx, ExpenseFilter{CustomerID: &customerID, From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+	if len(expenses) == 0 {
+		return []*ExpenseReport{newExpenseReport(customer.Currency, true)}, nil
+	}
+	byCurrency := make(map[core.Currency]*ExpenseReport)
+	var reports []*ExpenseReport
+	for _, expense := range expenses {
+		currency := expense.Amount.Currency()
+		report, ok := byCurrency[currency]
+		if !ok {
+			report = newExpenseReport(currency, true)
+			byCurrency[currency] = report
+			reports = append(reports, report)
+		}
+		if err := report.add(expense); err != nil {
+			return nil, err
+		}
+	}
+	slices.SortFunc(reports, func(a, b *ExpenseReport) int { return strings.Compare(string(a.Currency), string(b.Currency)) })
+	return reports, nil
+}
+
+// InvoiceProjectExpenses claims the project's reimbursable expenses, raises
+// a draft invoice for the customer with a line per expense at its billable
+// amount and records the invoice on the expenses. Should invoicing fail the
+// expenses are released to be billed later; should recording fail they stay
+// claimed, and the invoice is returned along with the error.
+func (s *expenseService) InvoiceProjectExpenses(ctx context.Context, projectID uuid.UUID) (*billing.Invoice, error) {
+	project, err := s.projects.GetProjectByID(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	claim := uuid.New()
+	expenses, err := s.repo.ClaimReimbursableExpenses(ctx, projectID, claim)
+	if err != nil {
+		return nil, err
+	}
+	if len(expenses) == 0 {
+		return nil, ErrNoReimbursableExpenses
+	}
+
+	items := make([]billing.InvoiceItem, 0, len(expenses))
+	for _, expense := range expenses {
+		description := fmt.Sprintf("%s %s: %s", expense.Date.Format(time.DateOnly), strings.ReplaceAll(string(expense.Category), "_", " "), expense.Description)
+		if expense.MarkupPercent > 0 {
+			description += fmt.Sprintf(" (%s plus %g%%)", expense.Amount, expense.MarkupPercent)
+		}
+		items = append(items, billing.InvoiceItem{Description: description, Quantity: 1, UnitPrice: expense.BillableAmount})
+	}
+	invoice, err := s.invoices.CreateInvoice(ctx, billing.Invoice{
+		CustomerID: project.CustomerID,
+		Notes:      "Project " + project.Name + " expenses",
+		Items:      items,
+	})
+	if err != nil {
+		if releaseErr := s.repo.ReleaseExpenseClaim(ctx, claim); releaseErr != nil {
+			slog.ErrorContext(ctx, "failed to release expense billing claim", "claim", claim, "error", releaseErr)
+		}
+		return nil, fmt.Errorf("failed to invoice expenses: %w", err)
+	}
+	if err := s.repo.AttachExpenseClaimToInvoice(ctx, claim, invoice.ID); err != nil {
+		return invoice, err
+	}
+	return invoice, nil
+}
+
+// GetProjectCosts reports every expense on the project at cost, without
+// markup, for the budget rollup.
+func (s *expenseService) GetProjectCosts(ctx context.Context, projectID uuid.UUID) ([]ProjectCost, error) {
+	expenses, err := s.repo.ListExpenses(ctx, ExpenseFilter{ProjectID: &projectID})
+	if err != nil {
+		return nil, err
+	}
+	costs := make([]ProjectCost, 0, len(expenses))
+	for _, expense := range expenses {
+		costs = append(costs, ProjectCost{Kind: CostKindExpense, Amount: expense.Amount})
+	}
+	return costs, nil
+}
+
+// normalizeExpense trims and validates the expense against its project and
+// prices it.
+func (s *expenseService) normalizeExpense(ctx context.Context, expense *Expense) error {
+	project, err := s.projects.GetProjectByID(ctx, expense.ProjectID)
+	if err != nil {
+		return err
+	}
+	expense.Description = strings.TrimSpace(expense.Description)
+	expense.ReceiptRef = strings.TrimSpace(expense.ReceiptRef)
+	expense.InvoiceID = nil
+	if expense.Category == "" {
+		expense.Category = ExpenseCategoryOther
+	}
+	if !expense.Category.Valid() {
+		return fmt.Errorf("%w: unknown category %q", ErrInvalidExpense, expense.Category)
+	}
+	if expense.Description == "" {
+		return fmt.Errorf("%w: a description is required", ErrInvalidExpense)
+	}
+	if expense.Date.IsZero() {
+		return fmt.Errorf("%w: a date is required", ErrInvalidExpense)
+	}
+	expense.Date = *dateOnly(&expense.Date)
+
+	if !expense.Amount.IsPositive() {
+		return fmt.Errorf("%w: the amount must be positive", ErrInvalidExpense)
+	}
+	if expense.Amount.Currency() != project.Currency {
+		return fmt.Errorf("%w: the amount is in %s but the project in %s", core.ErrCurrencyMismatch, expense.Amount.Currency(), project.Currency)
+	}
+	if expense.MarkupPercent < 0 || expense.MarkupPercent > 100 {
+		return fmt.Errorf("%w: the markup must be between 0 and 100 percent", ErrInvalidExpense)
+	}
+	if !expense.Reimbursable {
+		expense.MarkupPercent = 0
+	}
+	return expense.price()
+}
+
+// normalizeExpenseRange truncates an optional date range to days and rejects one
+// that ends before it starts.
+func normalizeExpenseRange(from, to **time.Time) error {
+	*from, *to = dateOnly(*from), dateOnly(*to)
+	if *from != nil && *to != nil && (*to).Before(**from) {
+		return fmt.Errorf("%w: the range ends before it starts", ErrInvalidExpense)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package projects
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"rva_crm/internal/billing"
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockExpenseRepository struct {
+	mock.Mock
+}
+
+func (m *MockExpenseRepository) GetExpenseByID(ctx context.Context, id uuid.UUID) (*Expense, error) {
+	args := m.Called(ctx, id)
+	expense, _ := args.Get(0).(*Expense)
+	return expense, args.Error(1)
+}
+
+func (m *MockExpenseRepository) ListExpenses(ctx context.Context, filter ExpenseFilter) ([]*Expense, error) {
+	args := m.Called(ctx, filter)
+	expenses, _ := args.Get(0).([]*Expense)
+	return expenses, args.Error(1)
+}
+
+func (m *MockExpenseRepository) CreateExpense(ctx context.Context, expense Expense) (*Expense, error) {
+	args := m.Called(ctx, expense)
+	created, _ := args.Get(0).(*Expense)
+	return created, args.Error(1)
+}
+
+func (m *MockExpenseRepository) UpdateExpense(ctx context.Context, expense Expense) (*Expense, error) {
+	args := m.Called(ctx, expense)
+	updated, _ := args.Get(0).(*Expense)
+	return updated, args.Error(1)
+}
+
+func (m *MockExpenseRepository) DeleteExpense(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockExpenseRepository) ClaimReimbursableExpenses(ctx context.Context, projectID uuid.UUID, claim uuid.UUID) ([]*Expense, error) {
+	args := m.Called(ctx, projectID, claim)
+	expenses, _ := args.Get(0).([]*Expense)
+	return expenses, args.Error(1)
+}
+
+func (m *MockExpenseRepository) AttachExpenseClaimToInvoice(ctx context.Context, claim uuid.UUID, invoiceID uuid.UUID) error {
+	args := m.Called(ctx, claim, invoiceID)
+	return args.Error(0)
+}
+
+func (m *MockExpenseRepository) ReleaseExpenseClaim(ctx context.Context, claim uuid.UUID) error {
+	args := m.Called(ctx, claim)
+	return args.Error(0)
+}
+
+// expense prices a dated expense on the project the way the service would.
+// A negative markup makes it not reimbursable.
+func expense(projectID uuid.UUID, category ExpenseCategory, amount core.Money, markup float64) *Expense {
+	e := &Expense{ProjectID: projectID, Category: category, Description: string(category), Date: *date(2026, 7, 2), Amount: amount, Reimbursable: markup >= 0, MarkupPercent: max(markup, 0)}
+	e.ID = uuid.New()
+	if err := e.price(); err != nil {
+		panic(err)
+	}
+	return e
+}
+
+func TestExpensePrice_AddsMarkupRoundingHalfUp(t *testing.T) {
+	fee := Expense{Amount: core.MustParseMoney("101.05", core.USD), Reimbursable: true, MarkupPercent: 12.5}
+	require.NoError(t, fee.price())
+	assert.Equal(t, core.MustParseMoney("113.68", core.USD), fee.BillableAmount)
+
+	fee.Reimbursable = false
+	require.NoError(t, fee.price())
+	assert.Equal(t, core.Zero(core.USD), fee.BillableAmount)
+}
+
+type ExpenseServiceTestSuite struct {
+	suite.Suite
+	repo      *MockExpenseRepository
+	projects  *MockProjectRepository
+	customers *MockCustomerRetriever
+	invoices  *MockInvoiceCreator
+	service   ExpenseService
+	project   *Project
+}
+
+func (s *ExpenseServiceTestSuite) SetupTest() {
+	s.repo = new(MockExpenseRepository)
+	s.projects = new(MockProjectRepository)
+	s.customers = new(MockCustomerRetriever)
+	s.invoices = new(MockInvoiceCreator)
+	s.service = NewExpenseService(s.repo, s.projects, s.customers, s.invoices)
+
+	s.project = &Project{CustomerID: uuid.New(), Name: "Acme formation", Currency: core.USD}
+	s.project.ID = uuid.New()
+}
+
+func (s *ExpenseServiceTestSuite) TearDownTest() {
+	s.repo.AssertExpectations(s.T())
+	s.projects.AssertExpectations(s.T())
+	s.customers.AssertExpectations(s.T())
+	s.invoices.AssertExpectations(s.T())
+}
+
+func TestExpenseServiceSuite(t *testing.T) {
+	suite.Run(t, new(ExpenseServiceTestSuite))
+}
+
+func (s *ExpenseServiceTestSuite) TestCreateExpense_PricesReimbursableMarkup() {
+	// Arrange
+	ctx := context.Background()
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil)
+	s.repo.On("CreateExpense", ctx, mock.MatchedBy(func(e Expense) bool {
+		return e.Category == ExpenseCategoryFilingFee && e.BillableAmount == core.MustParseMoney("330.00", core.USD) && e.ReceiptRef == "receipts/de-filing.pdf"
+	})).Return(&Expense{}, nil)
+
+	// Act
+	_, err := s.service.CreateExpense(ctx, Expense{
+		ProjectID:     s.project.ID,
+		Category:      ExpenseCategoryFilingFee,
+		Description:   " Delaware filing fee ",
+		Date:          *date(2026, 7, 2),
+		Amount:        core.MustParseMoney("300.00", core.USD),
+		ReceiptRef:    "receipts/de-filing.pdf",
+		Reimbursable:  true,
+		MarkupPercent: 10,
+	})
+
+	// Assert
+	s.NoError(err)
+}
+
+func (s *ExpenseServiceTestSuite) TestCreateExpense_RejectsOtherCurrencyAndBadMarkup() {
+	// Arrange
+	ctx := context.Background()
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil)
+	valid := Expense{ProjectID: s.project.ID, Category: ExpenseCategoryTravel, Description: "Train to Dover", Date: *date(2026, 7, 2), Amount: core.MustParseMoney("80.00", core.USD), Reimbursable: true}
+
+	// Act
+	foreign := valid
+	foreign.Amount = core.MustParseMoney("80.00", core.EUR)
+	_, mismatch := s.service.CreateExpense(ctx, foreign)
+	markup := valid
+	markup.MarkupPercent = 150
+	_, invalid := s.service.CreateExpense(ctx, markup)
+	markup.MarkupPercent = 12.345
+	_, fine := s.service.CreateExpense(ctx, markup)
+
+	// Assert
+	s.ErrorIs(mismatch, core.ErrCurrencyMismatch)
+	s.ErrorIs(invalid, ErrInvalidExpense)
+	s.ErrorIs(fine, ErrInvalidExpense)
+}
+
+func (s *ExpenseServiceTestSuite) TestGetProjectExpenseReport_SplitsCategoriesAndInvoicing() {
+	// Arrange
+	ctx := context.Background()
+	fee := expense(s.project.ID, ExpenseCategoryFilingFee, core.MustParseMoney("300.00", core.USD), 10)
+	travel := expense(s.project.ID, ExpenseCategoryTravel, core.MustParseMoney("80.00", core.USD), 0)
+	invoiceID := uuid.New()
+	travel.InvoiceID = &invoiceID
+	software := expense(s.project.ID, ExpenseCategorySoftware, core.MustParseMoney("25.00", core.USD), -1)
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil)
+	s.repo.On("ListExpenses", ctx, ExpenseFilter{ProjectID: &s.project.ID}).Return([]*Expense{fee, travel, software}, nil)
+
+	// Act
+	report, err := s.service.GetProjectExpenseReport(ctx, s.project.ID, nil, nil)
+
+	// Assert
+	s.Require().NoError(err)
+	s.Equal(3, report.Count)
+	s.Equal(core.MustParseMoney("405.00", core.USD), report.Total)
+	s.Equal(core.MustParseMoney("380.00", core.USD), report.Reimbursable)
+	s.Equal(core.MustParseMoney("410.00", core.USD), report.Billable)
+	s.Equal(core.MustParseMoney("80.00", core.USD), report.Invoiced)
+	s.Equal(core.MustParseMoney("330.00", core.USD), report.Uninvoiced)
+	s.Equal(ExpenseTotal{Count: 1, Total: core.MustParseMoney("25.00", core.USD), Billable: core.Zero(core.USD)}, report.ByCategory[ExpenseCategorySoftware])
+	s.Nil(report.ByProject)
+}
+
+func (s *ExpenseServiceTestSuite) TestGetCustomerExpenseReport_OnePerCurrency() {
+	// Arrange
+	ctx := context.Background()
+	customerID := s.project.CustomerID
+	other := uuid.New()
+	s.customers.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{BaseModel: core.BaseModel{ID: customerID}, Currency: core.USD}, nil)
+	s.repo.On("ListExpenses", ctx, ExpenseFilter{CustomerID: &customerID}).Return([]*Expense{
+		expense(s.project.ID, ExpenseCategoryFilingFee, core.MustParseMoney("300.00", core.USD), 0),
+		expense(other, ExpenseCategoryTravel, core.MustParseMoney("120.00", core.EUR), 0),
+		expense(s.project.ID, ExpenseCategoryCourier, core.MustParseMoney("20.00", core.USD), 0),
+	}, nil)
+
+	// Act
+	reports, err := s.service.GetCustomerExpenseReport(ctx, customerID, nil, nil)
+
+	// Assert
+	s.Require().NoError(err)
+	s.Require().Len(reports, 2)
+	s.Equal(core.EUR, reports[0].Currency)
+	s.Equal(core.MustParseMoney("320.00", core.USD), reports[1].Total)
+	s.Equal(2, reports[1].ByProject[s.project.ID].Count)
+}
+
+func (s *ExpenseServiceTestSuite) TestInvoiceProjectExpenses_BillsMarkupAndReleasesOnFailure() {
+	// Arrange
+	ctx := context.Background()
+	fee := expense(s.project.ID, ExpenseCategoryFilingFee, core.MustParseMoney("300.00", core.USD), 10)
+	fee.Description = "Delaware filing fee"
+	invoice := &billing.Invoice{}
+	invoice.ID = uuid.New()
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil)
+	s.repo.On("ClaimReimbursableExpenses", ctx, s.project.ID, mock.Anything).Return([]*Expense{fee}, nil)
+	s.invoices.On("CreateInvoice", ctx, mock.MatchedBy(func(i billing.Invoice) bool {
+		return i.CustomerID == s.project.CustomerID && len(i.Items) == 1 && i.Items[0].UnitPrice == fee.BillableAmount &&
+			i.Items[0].Description == "2026-07-02 filing fee: Delaware filing fee (USD 300.00 plus 10%)"
+	})).Return(invoice, nil).Once()
+	s.repo.On("AttachExpenseClaimToInvoice", ctx, mock.Anything, invoice.ID).Return(nil).Once()
+	s.invoices.On("CreateInvoice", ctx, mock.Anything).Return(nil, errors.New("connection reset")).Once()
+	s.repo.On("ReleaseExpenseClaim", ctx, mock.Anything).Return(nil).Once()
+
+	// Act
+	billed, err := s.service.InvoiceProjectExpenses(ctx, s.project.ID)
+	s.Require().NoError(err)
+	_, failed := s.service.InvoiceProjectExpenses(ctx, s.project.ID)
+
+	// Assert
+	s.Equal(invoice.ID, billed.ID)
+	s.ErrorContains(failed, "connection reset")
+}
+
+func (s *ExpenseServiceTestSuite) TestGetProjectCosts_CountsExpensesAtCost() {
+	// Arrange
+	ctx := context.Background()
+	fee := expense(s.project.ID, ExpenseCategoryFilingFee, core.MustParseMoney("300.00", core.USD), 10)
+	s.repo.On("ListExpenses", ctx, ExpenseFilter{ProjectID: &s.project.ID}).Return([]*Expense{fee}, nil)
+
+	// Act
+	costs, err := s.service.GetProjectCosts(ctx, s.project.ID)
+
+	// Assert
+	s.NoError(err)
+	s.Equal([]ProjectCost{{Kind: CostKindExpense, Amount: core.MustParseMoney("300.00", core.USD)}}, costs)
+}
@@ -1 +1,1061 @@
-package projects
\ No newline at end of file
+package projects
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+)
+
+type customerProjectHandler struct {
+	service ProjectService
+}
+
+type projectHandler struct {
+	service ProjectService
+}
+
+type projectTaskHandler struct {
+	service TaskService
+}
+
+type taskHandler struct {
+	service TaskService
+}
+
+type scheduleHandler struct {
+	service ScheduleBuilder
+}
+
+type rollupHandler struct {
+	service RollupCalculator
+}
+
+type projectTemplatesHandler struct {
+	service TemplateService
+}
+
+type projectTemplateHandler struct {
+	service TemplateService
+}
+
+type templateInstantiationHandler struct {
+	service TemplateInstantiator
+}
+
+type projectMilestoneHandler struct {
+	service MilestoneService
+}
+
+type milestoneHandler struct {
+	service MilestoneService
+}
+
+type milestoneCompletionHandler struct {
+	service MilestoneCompleter
+}
+
+type projectTimeEntryHandler struct {
+	service TimeEntryService
+}
+
+type timeEntryHandler struct {
+	service TimeEntryService
+}
+
+type timerHandler struct {
+	service TimerManager
+}
+
+type timesheetHandler struct {
+	service TimesheetManager
+}
+
+type timeInvoiceHandler struct {
+	service TimeInvoicer
+}
+
+type projectExpenseHandler struct {
+	service ExpenseService
+}
+
+type expenseHandler struct {
+	service ExpenseService
+}
+
+type projectExpenseReportHandler struct {
+	service ExpenseReporter
+}
+
+type customerExpenseReportHandler struct {
+	service ExpenseReporter
+}
+
+type expenseInvoiceHandler struct {
+	service ExpenseInvoicer
+}
+
+// NewCustomerProjectHandler serves /customers/{id}/projects: GET lists the
+// customer's projects, filtered by ?status= (repeatable or comma-separated),
+// ?assigned_to= and a ?from=&to= date range as YYYY-MM-DD, and POST creates
+// one for the customer.
+func NewCustomerProjectHandler(service ProjectService) http.Handler {
+	return &customerProjectHandler{service: service}
+}
+
+// NewProjectHandler serves /projects/{id}: GET, PUT to update it and DELETE.
+func NewProjectHandler(service ProjectService) http.Handler {
+	return &projectHandler{service: service}
+}
+
+// NewProjectTaskHandler serves /projects/{id}/tasks: GET lists the project's
+// tasks and POST adds one to it.
+func NewProjectTaskHandler(service TaskService) http.Handler {
+	return &projectTaskHandler{service: service}
+}
+
+// NewTaskHandler serves /tasks/{id}: GET, PUT to update it and DELETE, which
+// also deletes its subtasks.
+func NewTaskHandler(service TaskService) http.Handler {
+	return &taskHandler{service: service}
+}
+
+// NewScheduleHandler serves GET /projects/{id}/schedule, the project's
+// critical path and the slack of each task.
+func NewScheduleHandler(service ScheduleBuilder) http.Handler {
+	return &scheduleHandler{service: service}
+}
+
+// NewRollupHandler serves GET /projects/{id}/rollup, the project's progress
+// and its budget and schedule variance, recalculated on every request.
+func NewRollupHandler(service RollupCalculator) http.Handler {
+	return &rollupHandler{service: service}
+}
+
+// NewProjectTemplatesHandler serves /project-templates: GET lists them,
+// narrowed to one opportunity product by ?product=, and POST creates one.
+func NewProjectTemplatesHandler(service TemplateService) http.Handler {
+	return &projectTemplatesHandler{service: service}
+}
+
+// NewProjectTemplateHandler serves /project-templates/{id}: GET, PUT to
+// update it and DELETE.
+func NewProjectTemplateHandler(service TemplateService) http.Handler {
+	return &projectTemplateHandler{service: service}
+}
+
+// NewTemplateInstantiationHandler serves POST /project-templates/{id}/projects,
+// creating a project from the template for the customer_id in the body.
+func NewTemplateInstantiationHandler(service TemplateInstantiator) http.Handler {
+	return &templateInstantiationHandler{service: service}
+}
+
+// NewProjectMilestoneHandler serves /projects/{id}/milestones: GET lists the
+// project's milestones and POST adds one to it.
+func NewProjectMilestoneHandler(service MilestoneService) http.Handler {
+	return &projectMilestoneHandler{service: service}
+}
+
+// NewMilestoneHandler serves /milestones/{id}: GET, PUT to update it and
+// DELETE, both refused once it is completed.
+func NewMilestoneHandler(service MilestoneService) http.Handler {
+	return &milestoneHandler{service: service}
+}
+
+// NewMilestoneCompletionHandler serves POST /milestones/{id}/complete, for
+// milestones without tasks.
+func NewMilestoneCompletionHandler(service MilestoneCompleter) http.Handler {
+	return &milestoneCompletionHandler{service: service}
+}
+
+// NewProjectTimeEntryHandler serves /projects/{id}/time-entries: GET lists
+// the time logged on the project, filtered by ?user= and a ?from=&to= date
+// range as YYYY-MM-DD, and POST logs time on it.
+func NewProjectTimeEntryHandler(service TimeEntryService) http.Handler {
+	return &projectTimeEntryHandler{service: service}
+}
+
+// NewTimeEntryHandler serves /time-entries/{id}: GET, PUT to update it and
+// DELETE, both refused once the entry is invoiced or its week submitted.
+func NewTimeEntryHandler(service TimeEntryService) http.Handler {
+	return &timeEntryHandler{service: service}
+}
+
+// NewTimerHandler serves /users/{id}/timer: GET the user's running timer,
+// POST to start one and DELETE to stop it, logging the time.
+func NewTimerHandler(service TimerManager) http.Handler {
+	return &timerHandler{service: service}
+}
+
+// NewTimesheetHandler serves /users/{id}/timesheets/{week}, where week is
+// any of its days as YYYY-MM-DD: GET the timesheet and POST with ?action=
+// submit, approve or reject. Approving takes the approved_by_id in the body.
+func NewTimesheetHandler(service TimesheetManager) http.Handler {
+	return &timesheetHandler{service: service}
+}
+
+// NewTimeInvoiceHandler serves POST /projects/{id}/time-entries/invoice,
+// drafting an invoice for the project's approved billable time.
+func NewTimeInvoiceHandler(service TimeInvoicer) http.Handler {
+	return &timeInvoiceHandler{service: service}
+}
+
+// NewProjectExpenseHandler serves /projects/{id}/expenses: GET lists the
+// project's expenses, filtered by ?category= and a ?from=&to= date range as
+// YYYY-MM-DD, and POST records one.
+func NewProjectExpenseHandler(service ExpenseService) http.Handler {
+	return &projectExpenseHandler{service: service}
+}
+
+// NewExpenseHandler serves /expenses/{id}: GET, PUT to update it and
+// DELETE, both refused once the expense is invoiced.
+func NewExpenseHandler(service ExpenseService) http.Handler {
+	return &expenseHandler{service: service}
+}
+
+// NewProjectExpenseReportHandler serves GET /projects/{id}/expenses/report,
+// the project's expenses summed over an optional ?from=&to= date range.
+func NewProjectExpenseReportHandler(service ExpenseReporter) http.Handler {
+	return &projectExpenseReportHandler{service: service}
+}
+
+// NewCustomerExpenseReportHandler serves GET /customers/{id}/expenses/report,
+// the expenses on all the customer's projects, one report per currency.
+func NewCustomerExpenseReportHandler(service ExpenseReporter) http.Handler {
+	return &customerExpenseReportHandler{service: service}
+}
+
+// NewExpenseInvoiceHandler serves POST /projects/{id}/expenses/invoice,
+// drafting an invoice for the project's reimbursable expenses.
+func NewExpenseInvoiceHandler(service ExpenseInvoicer) http.Handler {
+	return &expenseInvoiceHandler{service: service}
+}
+
+func (h *customerProjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.listProjects(w, r)
+	case http.MethodPost:
+		h.createProject(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *projectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getProject(w, r)
+	case http.MethodPut:
+		h.updateProject(w, r)
+	case http.MethodDelete:
+		h.deleteProject(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *projectTaskHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.listTasks(w, r)
+	case http.MethodPost:
+		h.createTask(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *taskHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getTask(w, r)
+	case http.MethodPut:
+		h.updateTask(w, r)
+	case http.MethodDelete:
+		h.deleteTask(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *scheduleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	projectID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	schedule, err := h.service.GetSchedule(r.Context(), projectID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(schedule)
+}
+
+func (h *rollupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	projectID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	rollup, err := h.service.GetProjectRollup(r.Context(), projectID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(rollup)
+}
+
+func (h *projectTemplatesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		templates, err := h.service.ListTemplates(r.Context(), customers.OpportunityProduct(r.URL.Query().Get("product")))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(templates)
+	case http.MethodPost:
+		var template ProjectTemplate
+		if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		created, err := h.service.CreateTemplate(r.Context(), template)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *projectTemplateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	templateID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		template, err := h.service.GetTemplateByID(r.Context(), templateID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(template)
+	case http.MethodPut:
+		var template ProjectTemplate
+		if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		template.ID = templateID
+		updated, err := h.service.UpdateTemplate(r.Context(), template)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(updated)
+	case http.MethodDelete:
+		if err := h.service.DeleteTemplate(r.Context(), templateID); err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Project template deleted successfully"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *templateInstantiationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	templateID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	var request TemplateInstantiation
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	project, err := h.service.InstantiateTemplate(r.Context(), templateID, request)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(project)
+}
+
+func (h *projectMilestoneHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		milestones, err := h.service.GetMilestonesByProjectID(r.Context(), projectID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(milestones)
+	case http.MethodPost:
+		var milestone Milestone
+		if err := json.NewDecoder(r.Body).Decode(&milestone); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		milestone.ProjectID = projectID
+		created, err := h.service.CreateMilestone(r.Context(), milestone)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *milestoneHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	milestoneID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		milestone, err := h.service.GetMilestoneByID(r.Context(), milestoneID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(milestone)
+	case http.MethodPut:
+		var milestone Milestone
+		if err := json.NewDecoder(r.Body).Decode(&milestone); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		milestone.ID = milestoneID
+		updated, err := h.service.UpdateMilestone(r.Context(), milestone)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(updated)
+	case http.MethodDelete:
+		if err := h.service.DeleteMilestone(r.Context(), milestoneID); err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Milestone deleted successfully"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *milestoneCompletionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	milestoneID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	milestone, err := h.service.CompleteMilestone(r.Context(), milestoneID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(milestone)
+}
+
+func (h *projectTimeEntryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		filter := TimeEntryFilter{ProjectID: &projectID}
+		query := r.URL.Query()
+		if query.Has("user") {
+			userID, err := uuid.Parse(query.Get("user"))
+			if err != nil {
+				http.Error(w, "invalid user", http.StatusBadRequest)
+				return
+			}
+			filter.UserID = &userID
+		}
+		if !queryDateRange(w, r, &filter.From, &filter.To) {
+			return
+		}
+		entries, err := h.service.ListTimeEntries(r.Context(), filter)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(entries)
+	case http.MethodPost:
+		var entry TimeEntry
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entry.ProjectID = projectID
+		created, err := h.service.CreateTimeEntry(r.Context(), entry)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *timeEntryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	entryID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		entry, err := h.service.GetTimeEntryByID(r.Context(), entryID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(entry)
+	case http.MethodPut:
+		var entry TimeEntry
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entry.ID = entryID
+		updated, err := h.service.UpdateTimeEntry(r.Context(), entry)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(updated)
+	case http.MethodDelete:
+		if err := h.service.DeleteTimeEntry(r.Context(), entryID); err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Time entry deleted successfully"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *timerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		entry, err := h.service.GetRunningTimer(r.Context(), userID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(entry)
+	case http.MethodPost:
+		var entry TimeEntry
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entry.UserID = userID
+		started, err := h.service.StartTimer(r.Context(), entry)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(started)
+	case http.MethodDelete:
+		stopped, err := h.service.StopTimer(r.Context(), userID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(stopped)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *timesheetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	week, err := time.Parse(time.DateOnly, r.PathValue("week"))
+	if err != nil {
+		http.Error(w, "invalid week, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	var timesheet *Timesheet
+	switch r.Method {
+	case http.MethodGet:
+		timesheet, err = h.service.GetTimesheet(r.Context(), userID, week)
+	case http.MethodPost:
+		switch action := r.URL.Query().Get("action"); action {
+		case "submit":
+			timesheet, err = h.service.SubmitTimesheet(r.Context(), userID, week)
+		case "approve":
+			var request struct {
+				ApprovedByID uuid.UUID `json:"approved_by_id"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			timesheet, err = h.service.ApproveTimesheet(r.Context(), userID, week, request.ApprovedByID)
+		case "reject":
+			timesheet, err = h.service.RejectTimesheet(r.Context(), userID, week)
+		default:
+			http.Error(w, "invalid action, expected submit, approve or reject", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(timesheet)
+}
+
+func (h *timeInvoiceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	projectID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	invoice, err := h.service.InvoiceProjectTime(r.Context(), projectID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invoice)
+}
+
+func (h *projectExpenseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		filter := ExpenseFilter{ProjectID: &projectID, Category: ExpenseCategory(r.URL.Query().Get("category"))}
+		if !queryDateRange(w, r, &filter.From, &filter.To) {
+			return
+		}
+		expenses, err := h.service.ListExpenses(r.Context(), filter)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(expenses)
+	case http.MethodPost:
+		var expense Expense
+		if err := json.NewDecoder(r.Body).Decode(&expense); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		expense.ProjectID = projectID
+		created, err := h.service.CreateExpense(r.Context(), expense)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *expenseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	expenseID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		expense, err := h.service.GetExpenseByID(r.Context(), expenseID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(expense)
+	case http.MethodPut:
+		var expense Expense
+		if err := json.NewDecoder(r.Body).Decode(&expense); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		expense.ID = expenseID
+		updated, err := h.service.UpdateExpense(r.Context(), expense)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(updated)
+	case http.MethodDelete:
+		if err := h.service.DeleteExpense(r.Context(), expenseID); err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Expense deleted successfully"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *projectExpenseReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	projectID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	var from, to *time.Time
+	if !queryDateRange(w, r, &from, &to) {
+		return
+	}
+	report, err := h.service.GetProjectExpenseReport(r.Context(), projectID, from, to)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+func (h *customerExpenseReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	customerID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	var from, to *time.Time
+	if !queryDateRange(w, r, &from, &to) {
+		return
+	}
+	reports, err := h.service.GetCustomerExpenseReport(r.Context(), customerID, from, to)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(reports)
+}
+
+func (h *expenseInvoiceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	projectID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	invoice, err := h.service.InvoiceProjectExpenses(r.Context(), projectID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invoice)
+}
+
+func (h *customerProjectHandler) listProjects(w http.ResponseWriter, r *http.Request) {
+	customerID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	filter := ProjectFilter{CustomerID: &customerID}
+	query := r.URL.Query()
+	for _, value := range query["status"] {
+		for _, status := range strings.Split(value, ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				filter.Statuses = append(filter.Statuses, ProjectStatus(status))
+			}
+		}
+	}
+	if query.Has("assigned_to") {
+		assignee, err := uuid.Parse(query.Get("assigned_to"))
+		if err != nil {
+			http.Error(w, "invalid assigned_to", http.StatusBadRequest)
+			return
+		}
+		filter.AssignedToID = &assignee
+	}
+	if !queryDateRange(w, r, &filter.From, &filter.To) {
+		return
+	}
+
+	projects, err := h.service.ListProjects(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(projects)
+}
+
+func (h *customerProjectHandler) createProject(w http.ResponseWriter, r *http.Request) {
+	customerID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	var project Project
+	if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	project.CustomerID = customerID
+	created, err := h.service.CreateProject(r.Context(), project)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *projectHandler) getProject(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	project, err := h.service.GetProjectByID(r.Context(), projectID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(project)
+}
+
+func (h *projectHandler) updateProject(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	var project Project
+	if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	project.ID = projectID
+	updated, err := h.service.UpdateProject(r.Context(), project)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *projectHandler) deleteProject(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteProject(r.Context(), projectID); err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Project deleted successfully"})
+}
+
+func (h *projectTaskHandler) listTasks(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	tasks, err := h.service.GetTasksByProjectID(r.Context(), projectID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(tasks)
+}
+
+func (h *projectTaskHandler) createTask(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	var task ProjectTask
+	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	task.ProjectID = projectID
+	created, err := h.service.CreateTask(r.Context(), task)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *taskHandler) getTask(w http.ResponseWriter, r *http.Request) {
+	taskID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	task, err := h.service.GetTaskByID(r.Context(), taskID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(task)
+}
+
+func (h *taskHandler) updateTask(w http.ResponseWriter, r *http.Request) {
+	taskID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	var task ProjectTask
+	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	task.ID = taskID
+	updated, err := h.service.UpdateTask(r.Context(), task)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *taskHandler) deleteTask(w http.ResponseWriter, r *http.Request) {
+	taskID, ok := pathUUID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteTask(r.Context(), taskID); err != nil {
+		writeError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Task deleted successfully"})
+}
+
+// errorStatuses maps project errors onto HTTP status codes. Errors not
+// listed are reported as 500.
+var errorStatuses = []struct {
+	err    error
+	status int
+}{
+	{ErrProjectNotFound, http.StatusNotFound},
+	{ErrCustomerNotFound, http.StatusNotFound},
+	{ErrInvalidProject, http.StatusUnprocessableEntity},
+	{ErrInvalidStatusTransition, http.StatusConflict},
+	{ErrProjectCurrencyLocked, http.StatusConflict},
+	{ErrProjectBilled, http.StatusConflict},
+	{ErrProjectHasNotes, http.StatusConflict},
+	{ErrTaskNotFound, http.StatusNotFound},
+	{ErrInvalidTask, http.StatusUnprocessableEntity},
+	{ErrDependencyCycle, http.StatusConflict},
+	{ErrTemplateNotFound, http.StatusNotFound},
+	{ErrInvalidTemplate, http.StatusUnprocessableEntity},
+	{ErrAlreadyInstantiated, http.StatusConflict},
+	{ErrMilestoneNotFound, http.StatusNotFound},
+	{ErrInvalidMilestone, http.StatusUnprocessableEntity},
+	{ErrMilestoneCompleted, http.StatusConflict},
+	{ErrTimeEntryNotFound, http.StatusNotFound},
+	{ErrInvalidTimeEntry, http.StatusUnprocessableEntity},
+	{ErrTimeEntryInvoiced, http.StatusConflict},
+	{ErrTimerRunning, http.StatusConflict},
+	{ErrNoRunningTimer, http.StatusNotFound},
+	{ErrTimesheetLocked, http.StatusConflict},
+	{ErrInvalidTimesheetTransition, http.StatusConflict},
+	{ErrNoBillableTime, http.StatusUnprocessableEntity},
+	{ErrExpenseNotFound, http.StatusNotFound},
+	{ErrInvalidExpense, http.StatusUnprocessableEntity},
+	{ErrExpenseInvoiced, http.StatusConflict},
+	{ErrNoReimbursableExpenses, http.StatusUnprocessableEntity},
+	{core.ErrUnknownCurrency, http.StatusUnprocessableEntity},
+	{core.ErrCurrencyMismatch, http.StatusUnprocessableEntity},
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	for _, e := range errorStatuses {
+		if errors.Is(err, e.err) {
+			status = e.status
+			break
+		}
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// pathUUID parses a UUID path wildcard, writing a 400 if it is malformed.
+func pathUUID(w http.ResponseWriter, r *http.Request, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue(name))
+	if err != nil {
+		http.Error(w, "invalid "+name, http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// queryDateRange parses the optional ?from= and ?to= dates, writing a 400
+// if either is malformed.
+func queryDateRange(w http.ResponseWriter, r *http.Request, from, to **time.Time) bool {
+	query := r.URL.Query()
+	for key, date := range map[string]**time.Time{"from": from, "to": to} {
+		if !query.Has(key) {
+			continue
+		}
+		parsed, err := time.Parse(time.DateOnly, query.Get(key))
+		if err != nil {
+			http.Error(w, "invalid "+key+", expected YYYY-MM-DD", http.StatusBadRequest)
+			return false
+		}
+		*date = &parsed
+	}
+	return true
+}
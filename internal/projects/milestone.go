@@ -0,0 +1,57 @@
+package projects
+
+import (
+	"errors"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMilestoneNotFound  = errors.New("milestone not found")
+	ErrInvalidMilestone   = errors.New("invalid milestone")
+	ErrMilestoneCompleted = errors.New("milestone is already completed")
+	ErrMilestoneInvoiced  = errors.New("milestone is already invoiced")
+)
+
+// Milestone marks a point in a project. One linked to tasks completes when
+// they are all completed, ignoring cancelled ones; one without tasks is
+// completed by hand. Completion is final, and completing a billable
+// milestone invoices the customer for its amount.
+type Milestone struct {
+	core.BaseModel
+	ProjectID   uuid.UUID   `json:"project_id"`
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	DueDate     time.Time   `json:"due_date"`
+	TaskIDs     []uuid.UUID `json:"task_ids"`
+
+	IsCompleted bool       `json:"is_completed"`
+	CompletedAt *time.Time `json:"completed_at"`
+
+	// Billing, in the project's currency
+	Billable  bool       `json:"billable"`
+	Amount    core.Money `json:"amount"`
+	InvoiceID *uuid.UUID `json:"invoice_id"` // The draft invoice raised on completion
+}
+
+// milestoneReached reports whether every task linked to the milestone is
+// done. The graph holds the project's tasks as scheduled, without cancelled
+// ones; a summary task is done when all its subtasks are.
+func milestoneReached(milestone Milestone, g *taskGraph) bool {
+	linked := 0
+	for _, id := range milestone.TaskIDs {
+		if _, ok := g.tasks[id]; !ok {
+			continue
+		}
+		linked++
+		for _, leaf := range g.leaves[id] {
+			if g.tasks[leaf].Status != TaskStatusCompleted {
+				return false
+			}
+		}
+	}
+	return linked > 0
+}
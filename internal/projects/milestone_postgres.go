@@ -0,0 +1,209 @@
+package projects
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+type milestoneRepository struct {
+	db *sql.DB
+}
+
+func NewMilestoneRepository(db *sql.DB) MilestoneRepository {
+	return &milestoneRepository{db: db}
+}
+
+const milestoneColumns = "m.id, m.project_id, m.title, m.description, m.due_date, m.completed_at, m.billable, m.amount, p.currency, m.invoice_id, m.created_at, m.updated_at"
+
+const milestoneFrom = " FROM project_milestones m JOIN projects p ON p.id = m.project_id"
+
+const insertMilestoneQuery = "INSERT INTO project_milestones (id, project_id, title, description, due_date, billable, amount) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+
+func scanMilestone(row rowScanner) (*Milestone, error) {
+	var milestone Milestone
+	var currency core.Currency
+	err := row.Scan(&milestone.ID, &milestone.ProjectID, &milestone.Title, &milestone.Description, &milestone.DueDate, &milestone.CompletedAt, &milestone.Billable, &milestone.Amount, &currency, &milestone.InvoiceID, &milestone.CreatedAt, &milestone.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMilestoneNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	milestone.IsCompleted = milestone.CompletedAt != nil
+	// The amount was scanned before its currency was known.
+	if milestone.Amount, err = milestone.Amount.Reread(currency); err != nil {
+		return nil, err
+	}
+	return &milestone, nil
+}
+
+func (r *milestoneRepository) GetMilestoneByID(ctx context.Context, id uuid.UUID) (*Milestone, error) {
+	milestone, err := scanMilestone(r.db.QueryRowContext(ctx, "SELECT "+milestoneColumns+milestoneFrom+" WHERE m.id = $1", id))
+	if err != nil {
+		return nil, err
+	}
+	if err := loadMilestoneTasks(ctx, r.db, map[uuid.UUID]*Milestone{id: milestone}, "milestone_id = $1", id); err != nil {
+		return nil, err
+	}
+	return milestone, nil
+}
+
+func (r *milestoneRepository) GetMilestonesByProjectID(ctx context.Context, projectID uuid.UUID) ([]*Milestone, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+milestoneColumns+milestoneFrom+" WHERE m.project_id = $1 ORDER BY m.due_date, m.title, m.id", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var milestones []*Milestone
+	byID := make(map[uuid.UUID]*Milestone)
+	for rows.Next() {
+		milestone, err := scanMilestone(rows)
+		if err != nil {
+			return nil, err
+		}
+		milestones = append(milestones, milestone)
+		byID[milestone.ID] = milestone
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	err = loadMilestoneTasks(ctx, r.db, byID, "milestone_id IN (SELECT id FROM project_milestones WHERE project_id = $1)", projectID)
+	return milestones, err
+}
+
+// loadMilestoneTasks fills in the tasks linked to the milestones, selecting
+// the links by condition.
+func loadMilestoneTasks(ctx context.Context, db queryer, milestones map[uuid.UUID]*Milestone, condition string, arg any) error {
+	rows, err := db.QueryContext(ctx, "SELECT milestone_id, task_id FROM project_milestone_tasks WHERE "+condition+" ORDER BY milestone_id, task_id", arg)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for _, milestone := range milestones {
+		milestone.TaskIDs = []uuid.UUID{}
+	}
+	for rows.Next() {
+		var milestoneID, taskID uuid.UUID
+		if err := rows.Scan(&milestoneID, &taskID); err != nil {
+			return err
+		}
+		if milestone, ok := milestones[milestoneID]; ok {
+			milestone.TaskIDs = append(milestone.TaskIDs, taskID)
+		}
+	}
+	return rows.Err()
+}
+
+func (r *milestoneRepository) CreateMilestone(ctx context.Context, milestone Milestone) (*Milestone, error) {
+	if milestone.ID == uuid.Nil {
+		milestone.ID = uuid.New()
+	}
+	return r.saveMilestone(ctx, milestone, insertMilestoneQuery)
+}
+
+// UpdateMilestone changes a milestone that is not completed, returning
+// ErrMilestoneCompleted otherwise.
+func (r *milestoneRepository) UpdateMilestone(ctx context.Context, milestone Milestone) (*Milestone, error) {
+	return r.saveMilestone(ctx, milestone, "UPDATE project_milestones SET title = $3, description = $4, due_date = $5, billable = $6, amount = $7, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND project_id = $2 AND completed_at IS NULL")
+}
+
+func (r *milestoneRepository) saveMilestone(ctx context.Context, milestone Milestone, query string) (*Milestone, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := writeMilestone(ctx, tx, query, milestone); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetMilestoneByID(ctx, milestone.ID)
+}
+
+// writeMilestone runs the insert or update query for the milestone and
+// replaces its task links.
+func writeMilestone(ctx context.Context, tx *sql.Tx, query string, milestone Milestone) error {
+	result, err := tx.ExecContext(ctx, query, milestone.ID, milestone.ProjectID, milestone.Title, milestone.Description, milestone.DueDate, milestone.Billable, milestone.Amount)
+	if err != nil {
+		return err
+	}
+	if count, err := result.RowsAffected(); err != nil {
+		return err
+	} else if count == 0 {
+		return ErrMilestoneCompleted
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM project_milestone_tasks WHERE milestone_id = $1", milestone.ID); err != nil {
+		return err
+	}
+	for _, taskID := range milestone.TaskIDs {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO project_milestone_tasks (milestone_id, task_id) VALUES ($1, $2)", milestone.ID, taskID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *milestoneRepository) DeleteMilestone(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM project_milestones WHERE id = $1 AND completed_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	if count, err := result.RowsAffected(); err != nil {
+		return err
+	} else if count == 0 {
+		return ErrMilestoneCompleted
+	}
+	return nil
+}
+
+func (r *milestoneRepository) MarkMilestoneCompleted(ctx context.Context, id uuid.UUID, at time.Time) (*Milestone, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE project_milestones SET completed_at = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND completed_at IS NULL", id, at)
+	if err != nil {
+		return nil, err
+	}
+	if count, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if count == 0 {
+		return nil, ErrMilestoneCompleted
+	}
+	return r.GetMilestoneByID(ctx, id)
+}
+
+func (r *milestoneRepository) ClaimMilestoneBilling(ctx context.Context, id uuid.UUID, claim uuid.UUID) (*Milestone, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE project_milestones SET billing_claim = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND completed_at IS NOT NULL AND billable AND invoice_id IS NULL AND billing_claim IS NULL", id, claim)
+	if err != nil {
+		return nil, err
+	}
+	if count, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if count == 0 {
+		return nil, ErrMilestoneInvoiced
+	}
+	return r.GetMilestoneByID(ctx, id)
+}
+
+// AttachMilestoneClaimToInvoice records the invoice the claimed milestone was
+// billed on and lets go of the claim.
+func (r *milestoneRepository) AttachMilestoneClaimToInvoice(ctx context.Context, claim uuid.UUID, invoiceID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE project_milestones SET invoice_id = $2, billing_claim = NULL, updated_at = CURRENT_TIMESTAMP WHERE billing_claim = $1", claim, invoiceID)
+	return err
+}
+
+// ReleaseMilestoneClaim returns the claimed milestone to unbilled.
+func (r *milestoneRepository) ReleaseMilestoneClaim(ctx context.Context, claim uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE project_milestones SET billing_claim = NULL, updated_at = CURRENT_TIMESTAMP WHERE billing_claim = $1", claim)
+	return err
+}
@@ -0,0 +1,327 @@
+package projects
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"rva_crm/internal/billing"
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+type MilestoneService interface {
+	MilestoneManager
+	MilestoneCompleter
+	MilestoneTracker
+}
+
+type MilestoneRepository interface {
+	MilestoneManager
+	MilestoneCompletionMarker
+}
+
+type MilestoneManager interface {
+	MilestoneReader
+	MilestoneWriter
+}
+
+type MilestoneReader interface {
+	MilestoneRetriever
+	MilestoneLister
+}
+
+type MilestoneWriter interface {
+	MilestoneCreator
+	MilestoneUpdater
+	MilestoneDeleter
+}
+
+type MilestoneRetriever interface {
+	GetMilestoneByID(ctx context.Context, id uuid.UUID) (*Milestone, error)
+}
+
+// MilestoneLister returns a project's milestones, earliest due first.
+type MilestoneLister interface {
+	GetMilestonesByProjectID(ctx context.Context, projectID uuid.UUID) ([]*Milestone, error)
+}
+
+type MilestoneCreator interface {
+	CreateMilestone(ctx context.Context, milestone Milestone) (*Milestone, error)
+}
+
+// MilestoneUpdater changes a milestone that is not yet completed.
+type MilestoneUpdater interface {
+	UpdateMilestone(ctx context.Context, milestone Milestone) (*Milestone, error)
+}
+
+// MilestoneDeleter deletes a milestone that is not yet completed.
+type MilestoneDeleter interface {
+	DeleteMilestone(ctx context.Context, id uuid.UUID) error
+}
+
+// MilestoneCompletionMarker records completion and its invoice.
+// MarkMilestoneCompleted returns ErrMilestoneCompleted if the milestone
+// already was, so it is completed only once. ClaimMilestoneBilling claims a
+// completed billable milestone that is not invoiced for an invoice being
+// raised, returning ErrMilestoneInvoiced if it is invoiced or claimed
+// already, so it is billed only once. The claim is either attached to the
+// invoice or released.
+type MilestoneCompletionMarker interface {
+	MarkMilestoneCompleted(ctx context.Context, id uuid.UUID, at time.Time) (*Milestone, error)
+	ClaimMilestoneBilling(ctx context.Context, id uuid.UUID, claim uuid.UUID) (*Milestone, error)
+	AttachMilestoneClaimToInvoice(ctx context.Context, claim uuid.UUID, invoiceID uuid.UUID) error
+	ReleaseMilestoneClaim(ctx context.Context, claim uuid.UUID) error
+}
+
+// MilestoneCompleter completes a milestone without tasks by hand.
+type MilestoneCompleter interface {
+	CompleteMilestone(ctx context.Context, id uuid.UUID) (*Milestone, error)
+}
+
+// MilestoneTracker completes the project's milestones whose tasks are all
+// done and invoices completed billable milestones that are not invoiced yet,
+// returning those it completed or invoiced.
+type MilestoneTracker interface {
+	TrackMilestones(ctx context.Context, projectID uuid.UUID) ([]*Milestone, error)
+}
+
+type milestoneService struct {
+	repo     MilestoneRepository
+	projects ProjectRetriever
+	tasks    TaskLister
+	invoices billing.InvoiceCreator
+	now      func() time.Time
+}
+
+// NewMilestoneService raises draft invoices for billable milestones through
+// invoices.
+func NewMilestoneService(repo MilestoneRepository, projects ProjectRetriever, tasks TaskLister, invoices billing.InvoiceCreator) MilestoneService {
+	return &milestoneService{repo: repo, projects: projects, tasks: tasks, invoices: invoices, now: time.Now}
+}
+
+func (s *milestoneService) GetMilestoneByID(ctx context.Context, id uuid.UUID) (*Milestone, error) {
+	return s.repo.GetMilestoneByID(ctx, id)
+}
+
+func (s *milestoneService) GetMilestonesByProjectID(ctx context.Context, projectID uuid.UUID) ([]*Milestone, error) {
+	if _, err := s.projects.GetProjectByID(ctx, projectID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetMilestonesByProjectID(ctx, projectID)
+}
+
+// CreateMilestone adds the milestone and completes it straight away if its
+// tasks are already done.
+func (s *milestoneService) CreateMilestone(ctx context.Context, milestone Milestone) (*Milestone, error) {
+	if err := s.normalizeMilestone(ctx, &milestone); err != nil {
+		return nil, err
+	}
+	created, err := s.repo.CreateMilestone(ctx, milestone)
+	if err != nil {
+		return nil, err
+	}
+	return s.completeIfReached(ctx, created)
+}
+
+func (s *milestoneService) UpdateMilestone(ctx context.Context, milestone Milestone) (*Milestone, error) {
+	existing, err := s.repo.GetMilestoneByID(ctx, milestone.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.IsCompleted {
+		return nil, ErrMilestoneCompleted
+	}
+	milestone.ProjectID = existing.ProjectID
+	if err := s.normalizeMilestone(ctx, &milestone); err != nil {
+		return nil, err
+	}
+	updated, err := s.repo.UpdateMilestone(ctx, milestone)
+	if err != nil {
+		return nil, err
+	}
+	return s.completeIfReached(ctx, updated)
+}
+
+func (s *milestoneService) DeleteMilestone(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteMilestone(ctx, id)
+}
+
+func (s *milestoneService) CompleteMilestone(ctx context.Context, id uuid.UUID) (*Milestone, error) {
+	milestone, err := s.repo.GetMilestoneByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(milestone.TaskIDs) > 0 {
+		return nil, fmt.Errorf("%w: a milestone with tasks completes with them", ErrInvalidMilestone)
+	}
+	return s.complete(ctx, milestone.ID)
+}
+
+// TrackMilestones carries on past a milestone that fails to complete or
+// bill, and returns the errors joined. A milestone whose invoice failed is
+// billed again on the next pass.
+func (s *milestoneService) TrackMilestones(ctx context.Context, projectID uuid.UUID) ([]*Milestone, error) {
+	milestones, err := s.repo.GetMilestonesByProjectID(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	graph, err := s.projectTasks(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	var completed []*Milestone
+	var errs []error
+	for _, milestone := range milestones {
+		var done *Milestone
+		var err error
+		switch {
+		case milestone.IsCompleted && milestone.Billable && milestone.InvoiceID == nil:
+			done, err = s.bill(ctx, milestone)
+		case !milestone.IsCompleted && milestoneReached(*milestone, graph):
+			done, err = s.complete(ctx, milestone.ID)
+		default:
+			continue
+		}
+		if errors.Is(err, ErrMilestoneCompleted) || errors.Is(err, ErrMilestoneInvoiced) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("milestone %s: %w", milestone.ID, err))
+		}
+		if done != nil {
+			completed = append(completed, done)
+		}
+	}
+	return completed, errors.Join(errs...)
+}
+
+func (s *milestoneService) completeIfReached(ctx context.Context, milestone *Milestone) (*Milestone, error) {
+	graph, err := s.projectTasks(ctx, milestone.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	if !milestoneReached(*milestone, graph) {
+		return milestone, nil
+	}
+	return s.complete(ctx, milestone.ID)
+}
+
+// complete marks the milestone completed and, if it is billable, raises a
+// draft invoice for the customer. Should invoicing fail, the milestone is
+// returned completed along with the error, to be billed by a later
+// TrackMilestones.
+func (s *milestoneService) complete(ctx context.Context, id uuid.UUID) (*Milestone, error) {
+	milestone, err := s.repo.MarkMilestoneCompleted(ctx, id, s.now())
+	if err != nil {
+		return nil, err
+	}
+	if !milestone.Billable {
+		return milestone, nil
+	}
+	billed, err := s.bill(ctx, milestone)
+	if errors.Is(err, ErrMilestoneInvoiced) {
+		return milestone, nil
+	}
+	if err != nil {
+		return milestone, err
+	}
+	return billed, nil
+}
+
+// bill claims the completed milestone, raises its draft invoice and records
+// the invoice on it. Should invoicing fail the claim is released so that the
+// milestone is billed later.
+func (s *milestoneService) bill(ctx context.Context, milestone *Milestone) (*Milestone, error) {
+	claim := uuid.New()
+	milestone, err := s.repo.ClaimMilestoneBilling(ctx, milestone.ID, claim)
+	if err != nil {
+		return nil, err
+	}
+	project, err := s.projects.GetProjectByID(ctx, milestone.ProjectID)
+	if err != nil {
+		s.releaseClaim(ctx, claim)
+		return milestone, err
+	}
+	invoice, err := s.invoices.CreateInvoice(ctx, billing.Invoice{
+		CustomerID: project.CustomerID,
+		Notes:      "Project " + project.Name,
+		Items: []billing.InvoiceItem{{
+			Description: "Milestone: " + milestone.Title,
+			Quantity:    1,
+			UnitPrice:   milestone.Amount,
+		}},
+	})
+	if err != nil {
+		s.releaseClaim(ctx, claim)
+		return milestone, fmt.Errorf("failed to invoice milestone: %w", err)
+	}
+	if err := s.repo.AttachMilestoneClaimToInvoice(ctx, claim, invoice.ID); err != nil {
+		return milestone, err
+	}
+	milestone.InvoiceID = &invoice.ID
+	return milestone, nil
+}
+
+func (s *milestoneService) releaseClaim(ctx context.Context, claim uuid.UUID) {
+	if err := s.repo.ReleaseMilestoneClaim(ctx, claim); err != nil {
+		slog.ErrorContext(ctx, "failed to release milestone billing claim", "claim", claim, "error", err)
+	}
+}
+
+func (s *milestoneService) projectTasks(ctx context.Context, projectID uuid.UUID) (*taskGraph, error) {
+	tasks, err := s.tasks.GetTasksByProjectID(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return buildTaskGraph(tasks, true)
+}
+
+// normalizeMilestone trims and validates the milestone against its project:
+// its tasks must belong to the project and a billable amount must be in the
+// project's currency.
+func (s *milestoneService) normalizeMilestone(ctx context.Context, milestone *Milestone) error {
+	project, err := s.projects.GetProjectByID(ctx, milestone.ProjectID)
+	if err != nil {
+		return err
+	}
+	milestone.Title = strings.TrimSpace(milestone.Title)
+	if milestone.Title == "" {
+		return fmt.Errorf("%w: a title is required", ErrInvalidMilestone)
+	}
+	if milestone.DueDate.IsZero() {
+		return fmt.Errorf("%w: a due date is required", ErrInvalidMilestone)
+	}
+	milestone.DueDate = *dateOnly(&milestone.DueDate)
+	milestone.IsCompleted, milestone.CompletedAt, milestone.InvoiceID = false, nil, nil
+
+	milestone.TaskIDs = uniqueIDs(milestone.TaskIDs)
+	if len(milestone.TaskIDs) > 0 {
+		tasks, err := s.tasks.GetTasksByProjectID(ctx, milestone.ProjectID)
+		if err != nil {
+			return err
+		}
+		for _, id := range milestone.TaskIDs {
+			if !slices.ContainsFunc(tasks, func(t *ProjectTask) bool { return t.ID == id }) {
+				return fmt.Errorf("%w: task %s is not on the project", ErrInvalidMilestone, id)
+			}
+		}
+	}
+
+	if !milestone.Billable {
+		milestone.Amount = core.Zero(project.Currency)
+		return nil
+	}
+	if !milestone.Amount.IsPositive() {
+		return fmt.Errorf("%w: a billable milestone needs an amount", ErrInvalidMilestone)
+	}
+	if milestone.Amount.Currency() != project.Currency {
+		return fmt.Errorf("%w: the amount is in %s but the project in %s", core.ErrCurrencyMismatch, milestone.Amount.Currency(), project.Currency)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package projects
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"rva_crm/internal/billing"
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockMilestoneRepository struct {
+	mock.Mock
+}
+
+func (m *MockMilestoneRepository) GetMilestoneByID(ctx context.Context, id uuid.UUID) (*Milestone, error) {
+	args := m.Called(ctx, id)
+	milestone, _ := args.Get(0).(*Milestone)
+	return milestone, args.Error(1)
+}
+
+func (m *MockMilestoneRepository) GetMilestonesByProjectID(ctx context.Context, projectID uuid.UUID) ([]*Milestone, error) {
+	args := m.Called(ctx, projectID)
+	milestones, _ := args.Get(0).([]*Milestone)
+	return milestones, args.Error(1)
+}
+
+func (m *MockMilestoneRepository) CreateMilestone(ctx context.Context, milestone Milestone) (*Milestone, error) {
+	args := m.Called(ctx, milestone)
+	created, _ := args.Get(0).(*Milestone)
+	return created, args.Error(1)
+}
+
+func (m *MockMilestoneRepository) UpdateMilestone(ctx context.Context, milestone Milestone) (*Milestone, error) {
+	args := m.Called(ctx, milestone)
+	updated, _ := args.Get(0).(*Milestone)
+	return updated, args.Error(1)
+}
+
+func (m *MockMilestoneRepository) DeleteMilestone(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockMilestoneRepository) MarkMilestoneCompleted(ctx context.Context, id uuid.UUID, at time.Time) (*Milestone, error) {
+	args := m.Called(ctx, id, at)
+	milestone, _ := args.Get(0).(*Milestone)
+	return milestone, args.Error(1)
+}
+
+func (m *MockMilestoneRepository) ClaimMilestoneBilling(ctx context.Context, id uuid.UUID, claim uuid.UUID) (*Milestone, error) {
+	args := m.Called(ctx, id, claim)
+	milestone, _ := args.Get(0).(*Milestone)
+	return milestone, args.Error(1)
+}
+
+func (m *MockMilestoneRepository) AttachMilestoneClaimToInvoice(ctx context.Context, claim uuid.UUID, invoiceID uuid.UUID) error {
+	args := m.Called(ctx, claim, invoiceID)
+	return args.Error(0)
+}
+
+func (m *MockMilestoneRepository) ReleaseMilestoneClaim(ctx context.Context, claim uuid.UUID) error {
+	args := m.Called(ctx, claim)
+	return args.Error(0)
+}
+
+type MockInvoiceCreator struct {
+	mock.Mock
+}
+
+func (m *MockInvoiceCreator) CreateInvoice(ctx context.Context, invoice billing.Invoice) (*billing.Invoice, error) {
+	args := m.Called(ctx, invoice)
+	created, _ := args.Get(0).(*billing.Invoice)
+	return created, args.Error(1)
+}
+
+func TestMilestoneReached_WaitsForEverySubtask(t *testing.T) {
+	file := task("File", 0)
+	submit := subtask(file, "Submit", 1)
+	confirm := subtask(file, "Confirm", 1, submit)
+	sign := task("Sign", 1)
+	sign.Status = TaskStatusCancelled
+	submit.Status = TaskStatusCompleted
+	milestone := Milestone{TaskIDs: []uuid.UUID{file.ID, sign.ID}}
+
+	graph, err := buildTaskGraph([]*ProjectTask{file, submit, confirm, sign}, true)
+	require.NoError(t, err)
+	assert.False(t, milestoneReached(milestone, graph))
+
+	confirm.Status = TaskStatusCompleted
+	graph, err = buildTaskGraph([]*ProjectTask{file, submit, confirm, sign}, true)
+	require.NoError(t, err)
+	assert.True(t, milestoneReached(milestone, graph))
+
+	// Only cancelled tasks left means nothing to reach.
+	assert.False(t, milestoneReached(Milestone{TaskIDs: []uuid.UUID{sign.ID}}, graph))
+}
+
+type MilestoneServiceTestSuite struct {
+	suite.Suite
+	repo     *MockMilestoneRepository
+	projects *MockProjectRepository
+	tasks    *MockTaskRepository
+	invoices *MockInvoiceCreator
+	service  *milestoneService
+	project  *Project
+	now      time.Time
+}
+
+func (s *MilestoneServiceTestSuite) SetupTest() {
+	s.repo = new(MockMilestoneRepository)
+	s.projects = new(MockProjectRepository)
+	s.tasks = new(MockTaskRepository)
+	s.invoices = new(MockInvoiceCreator)
+	s.service = NewMilestoneService(s.repo, s.projects, s.tasks, s.invoices).(*milestoneService)
+	s.now = time.Date(2026, 7, 10, 9, 0, 0, 0, time.UTC)
+	s.service.now = func() time.Time { return s.now }
+
+	s.project = &Project{CustomerID: uuid.New(), Name: "Acme formation", Currency: core.USD}
+	s.project.ID = uuid.New()
+}
+
+func (s *MilestoneServiceTestSuite) TearDownTest() {
+	s.repo.AssertExpectations(s.T())
+	s.projects.AssertExpectations(s.T())
+	s.tasks.AssertExpectations(s.T())
+	s.invoices.AssertExpectations(s.T())
+}
+
+func TestMilestoneServiceSuite(t *testing.T) {
+	suite.Run(t, new(MilestoneServiceTestSuite))
+}
+
+func (s *MilestoneServiceTestSuite) TestTrackMilestones_CompletesAndInvoicesOnce() {
+	// Arrange
+	ctx := context.Background()
+	draft := task("Draft", 2)
+	draft.ProjectID = s.project.ID
+	draft.Status = TaskStatusCompleted
+	milestone := &Milestone{ProjectID: s.project.ID, Title: "Articles drafted", TaskIDs: []uuid.UUID{draft.ID}, Billable: true, Amount: core.MustParseMoney("750.00", core.USD)}
+	milestone.ID = uuid.New()
+	completed := *milestone
+	completed.IsCompleted, completed.CompletedAt = true, &s.now
+	invoice := &billing.Invoice{}
+	invoice.ID = uuid.New()
+
+	s.repo.On("GetMilestonesByProjectID", ctx, s.project.ID).Return([]*Milestone{milestone}, nil)
+	s.tasks.On("GetTasksByProjectID", ctx, s.project.ID).Return([]*ProjectTask{draft}, nil)
+	s.repo.On("MarkMilestoneCompleted", ctx, milestone.ID, s.now).Return(&completed, nil).Once()
+	s.repo.On("MarkMilestoneCompleted", ctx, milestone.ID, s.now).Return(nil, ErrMilestoneCompleted).Once()
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil).Once()
+	s.invoices.On("CreateInvoice", ctx, mock.MatchedBy(func(i billing.Invoice) bool {
+		return i.CustomerID == s.project.CustomerID && len(i.Items) == 1 &&
+			i.Items[0].Description == "Milestone: Articles drafted" && i.Items[0].UnitPrice == milestone.Amount
+	})).Return(invoice, nil).Once()
+	s.repo.On("ClaimMilestoneBilling", ctx, milestone.ID, mock.Anything).Return(&completed, nil).Once()
+	s.repo.On("AttachMilestoneClaimToInvoice", ctx, mock.Anything, invoice.ID).Return(nil).Once()
+
+	// Act
+	first, err := s.service.TrackMilestones(ctx, s.project.ID)
+	s.Require().NoError(err)
+	// A second pass racing the first finds it already completed.
+	second, err := s.service.TrackMilestones(ctx, s.project.ID)
+
+	// Assert
+	s.NoError(err)
+	s.Require().Len(first, 1)
+	s.Equal(&invoice.ID, first[0].InvoiceID)
+	s.Empty(second)
+}
+
+func (s *MilestoneServiceTestSuite) TestTrackMilestones_BillsCompletedMilestoneAfterFailedInvoice() {
+	// Arrange
+	ctx := context.Background()
+	milestone := &Milestone{ProjectID: s.project.ID, Title: "Kickoff", Billable: true, Amount: core.MustParseMoney("250.00", core.USD), IsCompleted: true, CompletedAt: &s.now}
+	milestone.ID = uuid.New()
+	invoice := &billing.Invoice{}
+	invoice.ID = uuid.New()
+
+	s.repo.On("GetMilestonesByProjectID", ctx, s.project.ID).Return([]*Milestone{milestone}, nil)
+	s.tasks.On("GetTasksByProjectID", ctx, s.project.ID).Return([]*ProjectTask{}, nil)
+	s.repo.On("ClaimMilestoneBilling", ctx, milestone.ID, mock.Anything).Return(milestone, nil)
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil)
+	s.invoices.On("CreateInvoice", ctx, mock.Anything).Return(nil, errors.New("connection reset")).Once()
+	s.repo.On("ReleaseMilestoneClaim", ctx, mock.Anything).Return(nil).Once()
+	s.invoices.On("CreateInvoice", ctx, mock.Anything).Return(invoice, nil).Once()
+	s.repo.On("AttachMilestoneClaimToInvoice", ctx, mock.Anything, invoice.ID).Return(nil).Once()
+
+	// Act
+	_, failed := s.service.TrackMilestones(ctx, s.project.ID)
+	retried, err := s.service.TrackMilestones(ctx, s.project.ID)
+
+	// Assert
+	s.ErrorContains(failed, "connection reset")
+	s.NoError(err)
+	s.Require().Len(retried, 1)
+	s.Equal(&invoice.ID, retried[0].InvoiceID)
+	s.repo.AssertNotCalled(s.T(), "MarkMilestoneCompleted", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *MilestoneServiceTestSuite) TestCompleteMilestone_OnlyWithoutTasks() {
+	// Arrange
+	ctx := context.Background()
+	milestone := &Milestone{ProjectID: s.project.ID, Title: "Kickoff", TaskIDs: []uuid.UUID{uuid.New()}}
+	milestone.ID = uuid.New()
+	s.repo.On("GetMilestoneByID", ctx, milestone.ID).Return(milestone, nil)
+
+	// Act
+	_, err := s.service.CompleteMilestone(ctx, milestone.ID)
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidMilestone)
+}
+
+func (s *MilestoneServiceTestSuite) TestCreateMilestone_BillsInProjectCurrency() {
+	// Arrange
+	ctx := context.Background()
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil)
+
+	// Act
+	_, mismatch := s.service.CreateMilestone(ctx, Milestone{ProjectID: s.project.ID, Title: "Filed", DueDate: *date(2026, 7, 20), Billable: true, Amount: core.MustParseMoney("500.00", core.EUR)})
+	_, missing := s.service.CreateMilestone(ctx, Milestone{ProjectID: s.project.ID, Title: "Filed", DueDate: *date(2026, 7, 20), Billable: true, Amount: core.Zero(core.USD)})
+
+	// Assert
+	s.ErrorIs(mismatch, core.ErrCurrencyMismatch)
+	s.ErrorIs(missing, ErrInvalidMilestone)
+}
@@ -1 +1,165 @@
-package projects
\ No newline at end of file
+package projects
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+type projectRepository struct {
+	db *sql.DB
+}
+
+func NewProjectRepository(db *sql.DB) ProjectRepository {
+	return &projectRepository{db: db}
+}
+
+const projectColumns = "id, customer_id, name, description, status, start_date, end_date, currency, budget, assigned_to_id, template_id, opportunity_id, created_at, updated_at"
+
+const insertProjectQuery = "INSERT INTO projects (id, customer_id, name, description, status, start_date, end_date, currency, budget, assigned_to_id, template_id, opportunity_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING " + projectColumns
+
+func scanProject(row rowScanner) (*Project, error) {
+	var project Project
+	err := row.Scan(&project.ID, &project.CustomerID, &project.Name, &project.Description, &project.Status, &project.StartDate, &project.EndDate, &project.Currency, &project.Budget, &project.AssignedToID, &project.TemplateID, &project.OpportunityID, &project.CreatedAt, &project.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrProjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The budget was scanned before its currency was known.
+	if project.Budget, err = project.Budget.Reread(project.Currency); err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+func (r *projectRepository) GetProjectByID(ctx context.Context, id uuid.UUID) (*Project, error) {
+	return scanProject(r.db.QueryRowContext(ctx, "SELECT "+projectColumns+" FROM projects WHERE id = $1", id))
+}
+
+// ListProjects returns the projects matching the filter, earliest start
+// first and unscheduled projects last.
+func (r *projectRepository) ListProjects(ctx context.Context, filter ProjectFilter) ([]*Project, error) {
+	var conditions []string
+	var args []any
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", fmt.Sprintf("$%d", len(args))))
+	}
+	if filter.CustomerID != nil {
+		where("customer_id = ?", *filter.CustomerID)
+	}
+	if filter.AssignedToID != nil {
+		where("assigned_to_id = ?", *filter.AssignedToID)
+	}
+	if len(filter.Statuses) > 0 {
+		placeholders := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			args = append(args, status)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		conditions = append(conditions, "status IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if filter.From != nil {
+		where("start_date IS NOT NULL AND (end_date IS NULL OR end_date >= ?)", *filter.From)
+	}
+	if filter.To != nil {
+		where("start_date <= ?", *filter.To)
+	}
+
+	query := "SELECT " + projectColumns + " FROM projects"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	rows, err := r.db.QueryContext(ctx, query+" ORDER BY start_date NULLS LAST, name, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []*Project
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+	return projects, rows.Err()
+}
+
+func (r *projectRepository) CreateProject(ctx context.Context, project Project) (*Project, error) {
+	if project.ID == uuid.Nil {
+		project.ID = uuid.New()
+	}
+	return scanProject(r.db.QueryRowContext(ctx, insertProjectQuery,
+		project.ID, project.CustomerID, project.Name, project.Description, project.Status, project.StartDate, project.EndDate, project.Currency, project.Budget, project.AssignedToID, project.TemplateID, project.OpportunityID))
+}
+
+// UpdateProject leaves the customer and the project's origin as they are; a
+// project does not move between customers. Time entries, expenses and
+// milestones store bare amounts read in the project's currency, so the
+// currency only changes while the project has none of them; otherwise the
+// update returns ErrProjectCurrencyLocked.
+func (r *projectRepository) UpdateProject(ctx context.Context, project Project) (*Project, error) {
+	updated, err := scanProject(r.db.QueryRowContext(ctx, "UPDATE projects SET name = $1, description = $2, status = $3, start_date = $4, end_date = $5, currency = $6, budget = $7, assigned_to_id = $8, updated_at = CURRENT_TIMESTAMP WHERE id = $9 AND (currency = $6 OR NOT ("+projectHasAmounts+")) RETURNING "+projectColumns,
+		project.Name, project.Description, project.Status, project.StartDate, project.EndDate, project.Currency, project.Budget, project.AssignedToID, project.ID))
+	if !errors.Is(err, ErrProjectNotFound) {
+		return updated, err
+	}
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM projects WHERE id = $1)", project.ID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrProjectCurrencyLocked
+	}
+	return nil, ErrProjectNotFound
+}
+
+// projectHasAmounts holds for a project, as projects.id, with time entries,
+// expenses or billable milestones.
+const projectHasAmounts = "EXISTS (SELECT 1 FROM time_entries WHERE project_id = projects.id) OR EXISTS (SELECT 1 FROM project_expenses WHERE project_id = projects.id) OR EXISTS (SELECT 1 FROM project_milestones WHERE project_id = projects.id AND billable)"
+
+// DeleteProject deletes the project with its tasks, milestones, time and
+// expenses. Invoiced work, or work being invoiced, is the only record of
+// what was billed, so such a project is kept and ErrProjectBilled returned.
+// Notes are kept too: a project with notes returns ErrProjectHasNotes.
+func (r *projectRepository) DeleteProject(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM projects WHERE id = $1 AND NOT ("+projectHasBilledWork+") AND NOT ("+projectHasNotes+")", id)
+	if err != nil {
+		return err
+	}
+	if count, err := result.RowsAffected(); err != nil || count > 0 {
+		return err
+	}
+	var billed, noted bool
+	err = r.db.QueryRowContext(ctx, "SELECT "+projectHasBilledWork+", "+projectHasNotes+" FROM projects WHERE id = $1", id).Scan(&billed, &noted)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil
+	case err != nil:
+		return err
+	case billed:
+		return ErrProjectBilled
+	case noted:
+		return ErrProjectHasNotes
+	}
+	return nil
+}
+
+// projectHasBilledWork holds for a project, as projects.id, with time,
+// expenses or milestones that are invoiced or claimed for an invoice.
+const projectHasBilledWork = "(EXISTS (SELECT 1 FROM time_entries WHERE project_id = projects.id AND (invoice_id IS NOT NULL OR billing_claim IS NOT NULL)) OR EXISTS (SELECT 1 FROM project_expenses WHERE project_id = projects.id AND (invoice_id IS NOT NULL OR billing_claim IS NOT NULL)) OR EXISTS (SELECT 1 FROM project_milestones WHERE project_id = projects.id AND (invoice_id IS NOT NULL OR billing_claim IS NOT NULL)))"
+
+const projectHasNotes = "EXISTS (SELECT 1 FROM notes WHERE project_id = projects.id)"
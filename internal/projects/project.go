@@ -1,34 +1,94 @@
 package projects
 
 import (
+	"errors"
 	"time"
+
 	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrProjectNotFound         = errors.New("project not found")
+	ErrCustomerNotFound        = errors.New("customer not found")
+	ErrInvalidProject          = errors.New("invalid project")
+	ErrInvalidStatusTransition = errors.New("project status transition is not allowed")
+	ErrProjectCurrencyLocked   = errors.New("project currency cannot change once time, expenses or billable milestones are recorded")
+	ErrProjectBilled           = errors.New("project has invoiced work and cannot be deleted")
+	ErrProjectHasNotes         = errors.New("project has notes and cannot be deleted")
 )
 
 type Project struct {
 	core.BaseModel
 
-	ProjectName string
-	ProjectDescription string
-	ProjectStatus string
-	ProjectStartDate time.Time
-	ProjectEndDate time.Time
-	ProjectBudget float64
-	ProjectProgress float64
-	ProjectNotes string
-	ProjectTasks []ProjectTask
+	CustomerID  uuid.UUID     `json:"customer_id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Status      ProjectStatus `json:"status"`
+
+	// Timeline, as dates
+	StartDate *time.Time `json:"start_date"`
+	EndDate   *time.Time `json:"end_date"` // Planned finish; on or after StartDate
+
+	// Financial
+	Currency core.Currency `json:"currency"`
+	Budget   core.Money    `json:"budget"`
+
+	// The user responsible for the project
+	AssignedToID *uuid.UUID `json:"assigned_to_id"`
+
+	// Set when the project was created from a template, for a won
+	// opportunity or by hand
+	TemplateID    *uuid.UUID `json:"template_id"`
+	OpportunityID *uuid.UUID `json:"opportunity_id"`
 }
 
-type ProjectTask struct {
-	core.BaseModel
+type ProjectStatus string
 
-	Project Project
-	TaskName string
-	TaskDescription string
-	TaskStatus string
-	TaskStartDate time.Time
-	TaskEndDate time.Time
-    Assignee string
-    TaskType string
-    TaskPriority string
-}
\ No newline at end of file
+const (
+	ProjectStatusPlanning  ProjectStatus = "planning"
+	ProjectStatusActive    ProjectStatus = "active"
+	ProjectStatusOnHold    ProjectStatus = "on_hold"
+	ProjectStatusCompleted ProjectStatus = "completed"
+	ProjectStatusCancelled ProjectStatus = "cancelled"
+)
+
+// projectTransitions lists the statuses each status may move to. Completed
+// and cancelled projects are closed.
+var projectTransitions = map[ProjectStatus][]ProjectStatus{
+	ProjectStatusPlanning: {ProjectStatusActive, ProjectStatusCancelled},
+	ProjectStatusActive:   {ProjectStatusOnHold, ProjectStatusCompleted, ProjectStatusCancelled},
+	ProjectStatusOnHold:   {ProjectStatusActive, ProjectStatusCancelled},
+}
+
+func (s ProjectStatus) Valid() bool {
+	switch s {
+	case ProjectStatusPlanning, ProjectStatusActive, ProjectStatusOnHold, ProjectStatusCompleted, ProjectStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether the lifecycle allows moving from s to next.
+func (s ProjectStatus) CanTransitionTo(next ProjectStatus) bool {
+	for _, allowed := range projectTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ProjectFilter narrows a project listing. Zero fields do not filter.
+type ProjectFilter struct {
+	CustomerID   *uuid.UUID
+	Statuses     []ProjectStatus
+	AssignedToID *uuid.UUID
+
+	// Projects whose timeline overlaps the range. Projects without a start
+	// date are planned but not scheduled and never match a range; those
+	// without an end date run on indefinitely.
+	From *time.Time
+	To   *time.Time
+}
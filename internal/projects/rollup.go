@@ -0,0 +1,129 @@
+package projects
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+type CostKind string
+
+const (
+	CostKindTime    CostKind = "time"    // Logged hours at their rate
+	CostKindExpense CostKind = "expense" // Expenses incurred on the project
+)
+
+// ProjectCost is spending charged against a project's budget, in the
+// project's currency.
+type ProjectCost struct {
+	Kind   CostKind   `json:"kind"`
+	Amount core.Money `json:"amount"`
+}
+
+// ProjectRollup is a project's progress and its budget and schedule against
+// plan. It is calculated from the project's tasks and costs when requested,
+// so it always reflects the latest changes to them.
+type ProjectRollup struct {
+	ProjectID    uuid.UUID `json:"project_id"`
+	CalculatedAt time.Time `json:"calculated_at"`
+
+	// Progress over tasks that are not cancelled, excluding summary tasks.
+	// Each task weighs its estimate; if none are estimated, they weigh the
+	// same.
+	Progress       float64 `json:"progress"` // Percent complete, to one decimal
+	TaskCount      int     `json:"task_count"`
+	CompletedTasks int     `json:"completed_tasks"`
+	EstimatedHours float64 `json:"estimated_hours"`
+	CompletedHours float64 `json:"completed_hours"` // Estimated hours of completed tasks
+
+	// Budget against actual cost
+	Budget         core.Money `json:"budget"`
+	TimeCost       core.Money `json:"time_cost"`
+	ExpenseCost    core.Money `json:"expense_cost"`
+	ActualCost     core.Money `json:"actual_cost"`
+	BudgetVariance core.Money `json:"budget_variance"` // Budget less actual cost; negative when over budget
+	BudgetUsed     *float64   `json:"budget_used"`     // Percent of the budget spent; nil without a budget
+	OverBudget     bool       `json:"over_budget"`
+
+	// Schedule against the planned end date. The forecast needs a start
+	// date and the slip an end date as well.
+	EndDate          *time.Time `json:"end_date"`
+	ForecastFinish   *time.Time `json:"forecast_finish"`    // Last day of work if the rest starts today
+	ScheduleSlipDays int        `json:"schedule_slip_days"` // Days past the end date; negative when ahead
+	BehindSchedule   bool       `json:"behind_schedule"`
+}
+
+// rollUpProgress weighs the scheduled leaf tasks of the graph.
+func (r *ProjectRollup) rollUpProgress(g *taskGraph) {
+	for _, id := range g.order {
+		task := g.tasks[id]
+		r.TaskCount++
+		r.EstimatedHours += task.EstimatedHours
+		if task.Status == TaskStatusCompleted {
+			r.CompletedTasks++
+			r.CompletedHours += task.EstimatedHours
+		}
+	}
+	switch {
+	case r.EstimatedHours > 0:
+		r.Progress = percent(r.CompletedHours, r.EstimatedHours)
+	case r.TaskCount > 0:
+		r.Progress = percent(float64(r.CompletedTasks), float64(r.TaskCount))
+	}
+}
+
+// rollUpCosts totals the costs by kind and compares them with the budget.
+func (r *ProjectRollup) rollUpCosts(costs []ProjectCost) error {
+	for _, cost := range costs {
+		var total *core.Money
+		switch cost.Kind {
+		case CostKindTime:
+			total = &r.TimeCost
+		case CostKindExpense:
+			total = &r.ExpenseCost
+		default:
+			return fmt.Errorf("unknown project cost kind %q", cost.Kind)
+		}
+		sum, err := total.Add(cost.Amount)
+		if err != nil {
+			return err
+		}
+		*total = sum
+	}
+
+	var err error
+	if r.ActualCost, err = r.TimeCost.Add(r.ExpenseCost); err != nil {
+		return err
+	}
+	if r.BudgetVariance, err = r.Budget.Sub(r.ActualCost); err != nil {
+		return err
+	}
+	r.OverBudget = r.BudgetVariance.IsNegative()
+	if r.Budget.IsPositive() {
+		used := percent(float64(r.ActualCost.Minor()), float64(r.Budget.Minor()))
+		r.BudgetUsed = &used
+	}
+	return nil
+}
+
+// rollUpSchedule forecasts the finish from a schedule made as of today.
+func (r *ProjectRollup) rollUpSchedule(schedule Schedule) {
+	if schedule.StartDate == nil {
+		return
+	}
+	finish := schedule.StartDate.AddDate(0, 0, max(schedule.DurationDays-1, 0))
+	r.ForecastFinish = &finish
+	if r.EndDate != nil {
+		r.ScheduleSlipDays = int(finish.Sub(*r.EndDate).Hours() / 24)
+		r.BehindSchedule = r.ScheduleSlipDays > 0
+	}
+}
+
+// percent is part of whole as a percentage, to one decimal.
+func percent(part, whole float64) float64 {
+	return math.Round(part/whole*1000) / 10
+}
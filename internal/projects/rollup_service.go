@@ -0,0 +1,96 @@
+package projects
+
+import (
+	"context"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+type RollupService interface {
+	RollupCalculator
+}
+
+// RollupCalculator calculates a project's progress and its budget and
+// schedule variance.
+type RollupCalculator interface {
+	GetProjectRollup(ctx context.Context, projectID uuid.UUID) (*ProjectRollup, error)
+}
+
+// CostSource reports what has been spent on a project, in the project's
+// currency.
+type CostSource interface {
+	GetProjectCosts(ctx context.Context, projectID uuid.UUID) ([]ProjectCost, error)
+}
+
+type rollupService struct {
+	projects ProjectRetriever
+	tasks    TaskLister
+	costs    []CostSource
+	now      func() time.Time
+}
+
+// RollupServiceOption configures optional collaborators of the rollup
+// service.
+type RollupServiceOption func(*rollupService)
+
+// WithCostSources counts the costs reported by each source, such as logged
+// time and expenses, towards the actual cost.
+func WithCostSources(sources ...CostSource) RollupServiceOption {
+	return func(s *rollupService) {
+		s.costs = append(s.costs, sources...)
+	}
+}
+
+func NewRollupService(projects ProjectRetriever, tasks TaskLister, opts ...RollupServiceOption) RollupService {
+	s := &rollupService{projects: projects, tasks: tasks, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// GetProjectRollup recalculates the rollup from the project's current tasks
+// and costs.
+func (s *rollupService) GetProjectRollup(ctx context.Context, projectID uuid.UUID) (*ProjectRollup, error) {
+	project, err := s.projects.GetProjectByID(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := s.tasks.GetTasksByProjectID(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	graph, err := buildTaskGraph(tasks, true)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	rollup := &ProjectRollup{
+		ProjectID:    project.ID,
+		CalculatedAt: now,
+		Budget:       project.Budget,
+		TimeCost:     core.Zero(project.Currency),
+		ExpenseCost:  core.Zero(project.Currency),
+		EndDate:      project.EndDate,
+	}
+	rollup.rollUpProgress(graph)
+
+	var costs []ProjectCost
+	for _, source := range s.costs {
+		reported, err := source.GetProjectCosts(ctx, projectID)
+		if err != nil {
+			return nil, err
+		}
+		costs = append(costs, reported...)
+	}
+	if err := rollup.rollUpCosts(costs); err != nil {
+		return nil, err
+	}
+
+	rollup.rollUpSchedule(graph.schedule(*project, &now))
+	return rollup, nil
+}
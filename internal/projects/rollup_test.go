@@ -0,0 +1,138 @@
+package projects
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockCostSource struct {
+	mock.Mock
+}
+
+func (m *MockCostSource) GetProjectCosts(ctx context.Context, projectID uuid.UUID) ([]ProjectCost, error) {
+	args := m.Called(ctx, projectID)
+	costs, _ := args.Get(0).([]ProjectCost)
+	return costs, args.Error(1)
+}
+
+type RollupServiceTestSuite struct {
+	suite.Suite
+	projects *MockProjectRepository
+	tasks    *MockTaskRepository
+	time     *MockCostSource
+	expenses *MockCostSource
+	service  *rollupService
+	project  *Project
+}
+
+func (s *RollupServiceTestSuite) SetupTest() {
+	s.projects = new(MockProjectRepository)
+	s.tasks = new(MockTaskRepository)
+	s.time = new(MockCostSource)
+	s.expenses = new(MockCostSource)
+	s.service = NewRollupService(s.projects, s.tasks, WithCostSources(s.time, s.expenses)).(*rollupService)
+	s.service.now = func() time.Time { return time.Date(2026, 7, 6, 14, 0, 0, 0, time.UTC) }
+
+	s.project = &Project{
+		StartDate: date(2026, 7, 1),
+		EndDate:   date(2026, 7, 8),
+		Currency:  core.USD,
+		Budget:    core.MustParseMoney("1000.00", core.USD),
+	}
+	s.project.ID = uuid.New()
+}
+
+func (s *RollupServiceTestSuite) TearDownTest() {
+	s.projects.AssertExpectations(s.T())
+	s.tasks.AssertExpectations(s.T())
+	s.time.AssertExpectations(s.T())
+	s.expenses.AssertExpectations(s.T())
+}
+
+func TestRollupServiceSuite(t *testing.T) {
+	suite.Run(t, new(RollupServiceTestSuite))
+}
+
+func (s *RollupServiceTestSuite) TestGetProjectRollup_WeighsProgressAndTotalsCosts() {
+	// Arrange
+	ctx := context.Background()
+	phase := task("Phase", 0)
+	done := subtask(phase, "Done", 2)
+	done.Status, done.EstimatedHours = TaskStatusCompleted, 30
+	open := subtask(phase, "Open", 2, done)
+	open.EstimatedHours = 10
+	dropped := task("Dropped", 5)
+	dropped.Status, dropped.EstimatedHours = TaskStatusCancelled, 100
+
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil)
+	s.tasks.On("GetTasksByProjectID", ctx, s.project.ID).Return([]*ProjectTask{phase, done, open, dropped}, nil)
+	s.time.On("GetProjectCosts", ctx, s.project.ID).Return([]ProjectCost{
+		{Kind: CostKindTime, Amount: core.MustParseMoney("600.00", core.USD)},
+		{Kind: CostKindTime, Amount: core.MustParseMoney("300.00", core.USD)},
+	}, nil)
+	s.expenses.On("GetProjectCosts", ctx, s.project.ID).Return([]ProjectCost{
+		{Kind: CostKindExpense, Amount: core.MustParseMoney("250.00", core.USD)},
+	}, nil)
+
+	// Act
+	rollup, err := s.service.GetProjectRollup(ctx, s.project.ID)
+
+	// Assert
+	s.Require().NoError(err)
+	s.Equal(2, rollup.TaskCount)
+	s.Equal(1, rollup.CompletedTasks)
+	s.Equal(75.0, rollup.Progress)
+	s.Equal(core.MustParseMoney("900.00", core.USD), rollup.TimeCost)
+	s.Equal(core.MustParseMoney("1150.00", core.USD), rollup.ActualCost)
+	s.Equal(core.MustParseMoney("-150.00", core.USD), rollup.BudgetVariance)
+	s.True(rollup.OverBudget)
+	s.Require().NotNil(rollup.BudgetUsed)
+	s.Equal(115.0, *rollup.BudgetUsed)
+}
+
+func (s *RollupServiceTestSuite) TestGetProjectRollup_ForecastsSlipFromToday() {
+	// Arrange
+	ctx := context.Background()
+	first := task("First", 2)
+	first.Status = TaskStatusCompleted
+	second := task("Second", 4, first)
+
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil)
+	s.tasks.On("GetTasksByProjectID", ctx, s.project.ID).Return([]*ProjectTask{first, second}, nil)
+	s.time.On("GetProjectCosts", ctx, s.project.ID).Return(nil, nil)
+	s.expenses.On("GetProjectCosts", ctx, s.project.ID).Return(nil, nil)
+
+	// Act
+	rollup, err := s.service.GetProjectRollup(ctx, s.project.ID)
+
+	// Assert
+	s.Require().NoError(err)
+	s.Equal(50.0, rollup.Progress)
+	s.Equal(date(2026, 7, 9), rollup.ForecastFinish)
+	s.Equal(1, rollup.ScheduleSlipDays)
+	s.True(rollup.BehindSchedule)
+	s.Equal(core.Zero(core.USD), rollup.ActualCost)
+	s.False(rollup.OverBudget)
+}
+
+func (s *RollupServiceTestSuite) TestGetProjectRollup_RejectsCostsInAnotherCurrency() {
+	// Arrange
+	ctx := context.Background()
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil)
+	s.tasks.On("GetTasksByProjectID", ctx, s.project.ID).Return(nil, nil)
+	s.time.On("GetProjectCosts", ctx, s.project.ID).Return([]ProjectCost{{Kind: CostKindTime, Amount: core.MustParseMoney("10.00", core.EUR)}}, nil)
+	s.expenses.On("GetProjectCosts", ctx, s.project.ID).Return(nil, nil)
+
+	// Act
+	_, err := s.service.GetProjectRollup(ctx, s.project.ID)
+
+	// Assert
+	s.ErrorIs(err, core.ErrCurrencyMismatch)
+}
@@ -1 +1,182 @@
-package projects
\ No newline at end of file
+package projects
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+)
+
+type ProjectService interface {
+	ProjectManager
+}
+
+type ProjectRepository interface {
+	ProjectManager
+}
+
+type ProjectManager interface {
+	ProjectReader
+	ProjectWriter
+}
+
+type ProjectReader interface {
+	ProjectRetriever
+	ProjectLister
+}
+
+type ProjectWriter interface {
+	ProjectCreator
+	ProjectUpdater
+	ProjectDeleter
+}
+
+type ProjectRetriever interface {
+	GetProjectByID(ctx context.Context, id uuid.UUID) (*Project, error)
+}
+
+type ProjectLister interface {
+	ListProjects(ctx context.Context, filter ProjectFilter) ([]*Project, error)
+}
+
+type ProjectCreator interface {
+	CreateProject(ctx context.Context, project Project) (*Project, error)
+}
+
+type ProjectUpdater interface {
+	UpdateProject(ctx context.Context, project Project) (*Project, error)
+}
+
+// ProjectDeleter deletes a project and its unbilled work. It returns
+// ErrProjectBilled if any of the work is invoiced or being invoiced, and
+// ErrProjectHasNotes if notes refer to the project.
+type ProjectDeleter interface {
+	DeleteProject(ctx context.Context, id uuid.UUID) error
+}
+
+type projectService struct {
+	repo      ProjectRepository
+	customers customers.CustomerRetriever
+}
+
+func NewProjectService(repo ProjectRepository, customers customers.CustomerRetriever) ProjectService {
+	return &projectService{repo: repo, customers: customers}
+}
+
+func (s *projectService) GetProjectByID(ctx context.Context, id uuid.UUID) (*Project, error) {
+	return s.repo.GetProjectByID(ctx, id)
+}
+
+func (s *projectService) ListProjects(ctx context.Context, filter ProjectFilter) ([]*Project, error) {
+	for _, status := range filter.Statuses {
+		if !status.Valid() {
+			return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidProject, status)
+		}
+	}
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return nil, fmt.Errorf("%w: the date range ends before it starts", ErrInvalidProject)
+	}
+	return s.repo.ListProjects(ctx, filter)
+}
+
+// CreateProject starts a project for an existing customer, in planning
+// unless it is created active. Its currency defaults to the budget's, then
+// to the customer's.
+func (s *projectService) CreateProject(ctx context.Context, project Project) (*Project, error) {
+	customer, err := s.customers.GetCustomerByID(ctx, project.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	if customer.ID == uuid.Nil {
+		return nil, ErrCustomerNotFound
+	}
+	if project.Status == "" {
+		project.Status = ProjectStatusPlanning
+	}
+	if project.Status != ProjectStatusPlanning && project.Status != ProjectStatusActive {
+		return nil, fmt.Errorf("%w: a new project must be planning or active, not %q", ErrInvalidProject, project.Status)
+	}
+	if err := normalizeProject(&project, customer.Currency); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateProject(ctx, project)
+}
+
+// UpdateProject replaces the project's details. The customer cannot change,
+// the status may only stay as it is or follow the lifecycle, and the
+// currency is fixed once time, expenses or billable milestones are recorded.
+func (s *projectService) UpdateProject(ctx context.Context, project Project) (*Project, error) {
+	existing, err := s.repo.GetProjectByID(ctx, project.ID)
+	if err != nil {
+		return nil, err
+	}
+	project.CustomerID = existing.CustomerID
+	if project.Status == "" {
+		project.Status = existing.Status
+	}
+	if project.Status != existing.Status && !existing.Status.CanTransitionTo(project.Status) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidStatusTransition, existing.Status, project.Status)
+	}
+	if err := normalizeProject(&project, existing.Currency); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateProject(ctx, project)
+}
+
+func (s *projectService) DeleteProject(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteProject(ctx, id)
+}
+
+// normalizeProject trims and validates the project, truncates its dates to
+// days and settles its currency, falling back to fallback.
+func normalizeProject(project *Project, fallback core.Currency) error {
+	project.Name = strings.TrimSpace(project.Name)
+	if project.Name == "" {
+		return fmt.Errorf("%w: a name is required", ErrInvalidProject)
+	}
+	if !project.Status.Valid() {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidProject, project.Status)
+	}
+	project.StartDate, project.EndDate = dateOnly(project.StartDate), dateOnly(project.EndDate)
+	if project.StartDate != nil && project.EndDate != nil && project.EndDate.Before(*project.StartDate) {
+		return fmt.Errorf("%w: the end date is before the start date", ErrInvalidProject)
+	}
+
+	project.Currency = core.Currency(strings.ToUpper(strings.TrimSpace(string(project.Currency))))
+	if project.Currency == "" {
+		project.Currency = project.Budget.Currency()
+	}
+	if project.Currency == "" {
+		project.Currency = fallback
+	}
+	if project.Currency == "" {
+		project.Currency = core.DefaultCurrency
+	}
+	if !project.Currency.Valid() {
+		return fmt.Errorf("%w %q", core.ErrUnknownCurrency, project.Currency)
+	}
+	if project.Budget.Currency() == "" {
+		project.Budget = core.Zero(project.Currency)
+	}
+	if project.Budget.Currency() != project.Currency {
+		return fmt.Errorf("%w: the budget is in %s but the project in %s", core.ErrCurrencyMismatch, project.Budget.Currency(), project.Currency)
+	}
+	if project.Budget.IsNegative() {
+		return fmt.Errorf("%w: the budget cannot be negative", ErrInvalidProject)
+	}
+	return nil
+}
+
+func dateOnly(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return &day
+}
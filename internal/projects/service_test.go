@@ -0,0 +1,175 @@
+package projects
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockProjectRepository struct {
+	mock.Mock
+}
+
+func (m *MockProjectRepository) GetProjectByID(ctx context.Context, id uuid.UUID) (*Project, error) {
+	args := m.Called(ctx, id)
+	project, _ := args.Get(0).(*Project)
+	return project, args.Error(1)
+}
+
+func (m *MockProjectRepository) ListProjects(ctx context.Context, filter ProjectFilter) ([]*Project, error) {
+	args := m.Called(ctx, filter)
+	projects, _ := args.Get(0).([]*Project)
+	return projects, args.Error(1)
+}
+
+func (m *MockProjectRepository) CreateProject(ctx context.Context, project Project) (*Project, error) {
+	args := m.Called(ctx, project)
+	created, _ := args.Get(0).(*Project)
+	return created, args.Error(1)
+}
+
+func (m *MockProjectRepository) UpdateProject(ctx context.Context, project Project) (*Project, error) {
+	args := m.Called(ctx, project)
+	updated, _ := args.Get(0).(*Project)
+	return updated, args.Error(1)
+}
+
+func (m *MockProjectRepository) DeleteProject(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+type MockCustomerRetriever struct {
+	mock.Mock
+}
+
+func (m *MockCustomerRetriever) GetCustomerByID(ctx context.Context, id uuid.UUID) (customers.Customer, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(customers.Customer), args.Error(1)
+}
+
+func date(year int, month time.Month, day int) *time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+type ProjectServiceTestSuite struct {
+	suite.Suite
+	repo      *MockProjectRepository
+	customers *MockCustomerRetriever
+	service   ProjectService
+}
+
+func (s *ProjectServiceTestSuite) SetupTest() {
+	s.repo = new(MockProjectRepository)
+	s.customers = new(MockCustomerRetriever)
+	s.service = NewProjectService(s.repo, s.customers)
+}
+
+func (s *ProjectServiceTestSuite) TearDownTest() {
+	s.repo.AssertExpectations(s.T())
+	s.customers.AssertExpectations(s.T())
+}
+
+func TestProjectServiceSuite(t *testing.T) {
+	suite.Run(t, new(ProjectServiceTestSuite))
+}
+
+func (s *ProjectServiceTestSuite) TestCreateProject_DefaultsToPlanningInCustomerCurrency() {
+	// Arrange
+	ctx := context.Background()
+	customerID := uuid.New()
+	start := time.Date(2026, 7, 1, 15, 30, 0, 0, time.UTC)
+
+	s.customers.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{BaseModel: core.BaseModel{ID: customerID}, Currency: core.EUR}, nil)
+	s.repo.On("CreateProject", ctx, Project{
+		CustomerID: customerID,
+		Name:       "Office fit-out",
+		Status:     ProjectStatusPlanning,
+		StartDate:  date(2026, 7, 1),
+		Currency:   core.EUR,
+		Budget:     core.Zero(core.EUR),
+	}).Return(&Project{}, nil)
+
+	// Act
+	_, err := s.service.CreateProject(ctx, Project{CustomerID: customerID, Name: " Office fit-out ", StartDate: &start})
+
+	// Assert
+	s.NoError(err)
+}
+
+func (s *ProjectServiceTestSuite) TestCreateProject_RequiresExistingCustomer() {
+	// Arrange
+	ctx := context.Background()
+	customerID := uuid.New()
+	s.customers.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{}, nil)
+
+	// Act
+	result, err := s.service.CreateProject(ctx, Project{CustomerID: customerID, Name: "Audit"})
+
+	// Assert
+	s.ErrorIs(err, ErrCustomerNotFound)
+	s.Nil(result)
+}
+
+func (s *ProjectServiceTestSuite) TestCreateProject_RejectsEndBeforeStart() {
+	// Arrange
+	ctx := context.Background()
+	customerID := uuid.New()
+	s.customers.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{BaseModel: core.BaseModel{ID: customerID}}, nil)
+
+	// Act
+	_, err := s.service.CreateProject(ctx, Project{CustomerID: customerID, Name: "Audit", StartDate: date(2026, 7, 10), EndDate: date(2026, 7, 9)})
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidProject)
+}
+
+func (s *ProjectServiceTestSuite) TestUpdateProject_FollowsLifecycleAndKeepsCustomer() {
+	// Arrange
+	ctx := context.Background()
+	projectID, customerID := uuid.New(), uuid.New()
+	existing := &Project{BaseModel: core.BaseModel{ID: projectID}, CustomerID: customerID, Name: "Audit", Status: ProjectStatusActive, Currency: core.USD}
+
+	s.repo.On("GetProjectByID", ctx, projectID).Return(existing, nil)
+	s.repo.On("UpdateProject", ctx, mock.MatchedBy(func(p Project) bool {
+		return p.CustomerID == customerID && p.Status == ProjectStatusOnHold && p.Currency == core.USD
+	})).Return(&Project{}, nil)
+
+	// Act
+	_, err := s.service.UpdateProject(ctx, Project{BaseModel: core.BaseModel{ID: projectID}, CustomerID: uuid.New(), Name: "Audit", Status: ProjectStatusOnHold})
+
+	// Assert
+	s.NoError(err)
+}
+
+func (s *ProjectServiceTestSuite) TestUpdateProject_ClosedProjectsCannotReopen() {
+	// Arrange
+	ctx := context.Background()
+	projectID := uuid.New()
+	s.repo.On("GetProjectByID", ctx, projectID).Return(&Project{BaseModel: core.BaseModel{ID: projectID}, Name: "Audit", Status: ProjectStatusCompleted}, nil)
+
+	// Act
+	result, err := s.service.UpdateProject(ctx, Project{BaseModel: core.BaseModel{ID: projectID}, Name: "Audit", Status: ProjectStatusActive})
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidStatusTransition)
+	s.Nil(result)
+}
+
+func (s *ProjectServiceTestSuite) TestListProjects_RejectsUnknownStatusAndInvertedRange() {
+	ctx := context.Background()
+
+	_, err := s.service.ListProjects(ctx, ProjectFilter{Statuses: []ProjectStatus{"done"}})
+	s.ErrorIs(err, ErrInvalidProject)
+
+	_, err = s.service.ListProjects(ctx, ProjectFilter{From: date(2026, 8, 1), To: date(2026, 7, 1)})
+	s.ErrorIs(err, ErrInvalidProject)
+}
@@ -0,0 +1,374 @@
+package projects
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTaskNotFound    = errors.New("task not found")
+	ErrInvalidTask     = errors.New("invalid task")
+	ErrDependencyCycle = errors.New("task dependencies form a cycle")
+)
+
+// ProjectTask is a unit of work on a project. A task with subtasks is a
+// summary: it is scheduled around its subtasks rather than on its own, and
+// depending on it means depending on all of them.
+type ProjectTask struct {
+	core.BaseModel
+	ProjectID   uuid.UUID  `json:"project_id"`
+	ParentID    *uuid.UUID `json:"parent_id"` // Set on subtasks
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      TaskStatus `json:"status"`
+	Priority    Priority   `json:"priority"`
+	Position    int        `json:"position"` // Order among its siblings
+
+	// Timeline
+	DurationDays   int        `json:"duration_days"`   // Days of work, used to schedule the project
+	EstimatedHours float64    `json:"estimated_hours"` // Effort, used to weight project progress
+	DueDate        *time.Time `json:"due_date"`
+	CompletedAt    *time.Time `json:"completed_at"` // Set when the task is completed
+
+	// Assignment
+	AssigneeIDs []uuid.UUID `json:"assignee_ids"` // Users working on the task
+
+	// Finish-to-start: the tasks that must finish before this one starts
+	DependsOn []uuid.UUID `json:"depends_on"`
+}
+
+type TaskStatus string
+
+const (
+	TaskStatusTodo       TaskStatus = "todo"
+	TaskStatusInProgress TaskStatus = "in_progress"
+	TaskStatusReview     TaskStatus = "review"
+	TaskStatusCompleted  TaskStatus = "completed"
+	TaskStatusCancelled  TaskStatus = "cancelled"
+)
+
+func (s TaskStatus) Valid() bool {
+	switch s {
+	case TaskStatusTodo, TaskStatusInProgress, TaskStatusReview, TaskStatusCompleted, TaskStatusCancelled:
+		return true
+	}
+	return false
+}
+
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityMedium Priority = "medium"
+	PriorityHigh   Priority = "high"
+	PriorityUrgent Priority = "urgent"
+)
+
+func (p Priority) Valid() bool {
+	switch p {
+	case PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent:
+		return true
+	}
+	return false
+}
+
+// Schedule is a project's critical-path analysis. Days are counted from the
+// project start: a task with EarlyStart 0 and duration 3 occupies days 0 to
+// 2 and finishes at 3.
+type Schedule struct {
+	ProjectID    uuid.UUID       `json:"project_id"`
+	DurationDays int             `json:"duration_days"`
+	StartDate    *time.Time      `json:"start_date"`  // The project's, if set
+	FinishDate   *time.Time      `json:"finish_date"` // Earliest finish, if the project has a start date
+	CriticalPath []uuid.UUID     `json:"critical_path"`
+	Tasks        []ScheduledTask `json:"tasks"`
+}
+
+// ScheduledTask is one task's place in the schedule. Slack is how many days
+// the task can slip without delaying the project; tasks without slack are
+// critical.
+type ScheduledTask struct {
+	TaskID      uuid.UUID  `json:"task_id"`
+	ParentID    *uuid.UUID `json:"parent_id"`
+	Title       string     `json:"title"`
+	EarlyStart  int        `json:"early_start"`
+	EarlyFinish int        `json:"early_finish"`
+	LateStart   int        `json:"late_start"`
+	LateFinish  int        `json:"late_finish"`
+	Slack       int        `json:"slack"`
+	Critical    bool       `json:"critical"`
+	StartDate   *time.Time `json:"start_date"`  // Early start, if the project has a start date
+	FinishDate  *time.Time `json:"finish_date"` // Last day of work at the early start
+	DueDate     *time.Time `json:"due_date"`
+	Late        bool       `json:"late"` // Finishes after its due date even if started early
+}
+
+// taskGraph holds the finish-to-start edges between the leaf tasks of a
+// project, with those on summary tasks expanded to their subtasks.
+type taskGraph struct {
+	tasks   map[uuid.UUID]*ProjectTask
+	order   []uuid.UUID // Leaves in topological order, ties in display order
+	leaves  map[uuid.UUID][]uuid.UUID
+	preds   map[uuid.UUID][]uuid.UUID
+	succs   map[uuid.UUID][]uuid.UUID
+	summary []uuid.UUID // Summary tasks, children before parents
+}
+
+// buildTaskGraph checks the project's task hierarchy and dependencies and
+// orders its leaf tasks. Cancelled tasks are dropped when scheduling, so
+// dependencies through them no longer hold, but they still count when
+// looking for cycles.
+func buildTaskGraph(tasks []*ProjectTask, scheduling bool) (*taskGraph, error) {
+	g := &taskGraph{
+		tasks:  make(map[uuid.UUID]*ProjectTask),
+		leaves: make(map[uuid.UUID][]uuid.UUID),
+		preds:  make(map[uuid.UUID][]uuid.UUID),
+		succs:  make(map[uuid.UUID][]uuid.UUID),
+	}
+	sorted := slices.Clone(tasks)
+	slices.SortFunc(sorted, compareTasks)
+	for _, task := range sorted {
+		if scheduling && task.Status == TaskStatusCancelled {
+			continue
+		}
+		g.tasks[task.ID] = task
+	}
+
+	children := make(map[uuid.UUID][]uuid.UUID)
+	for _, task := range sorted {
+		if _, ok := g.tasks[task.ID]; !ok || task.ParentID == nil {
+			continue
+		}
+		if _, ok := g.tasks[*task.ParentID]; !ok {
+			if scheduling {
+				continue // Subtasks of a cancelled task are not scheduled either
+			}
+			return nil, fmt.Errorf("%w: %q is a subtask of a task outside the project", ErrInvalidTask, task.Title)
+		}
+		children[*task.ParentID] = append(children[*task.ParentID], task.ID)
+	}
+
+	// Walk down from the top-level tasks, so that subtasks of dropped
+	// parents and parent loops are never reached.
+	reached := make(map[uuid.UUID]bool)
+	var collect func(id uuid.UUID) []uuid.UUID
+	collect = func(id uuid.UUID) []uuid.UUID {
+		reached[id] = true
+		if len(children[id]) == 0 {
+			g.leaves[id] = []uuid.UUID{id}
+			return g.leaves[id]
+		}
+		var leaves []uuid.UUID
+		for _, child := range children[id] {
+			leaves = append(leaves, collect(child)...)
+		}
+		g.leaves[id] = leaves
+		g.summary = append(g.summary, id)
+		return leaves
+	}
+	for _, task := range sorted {
+		if _, ok := g.tasks[task.ID]; ok && task.ParentID == nil {
+			collect(task.ID)
+		}
+	}
+	for id, task := range g.tasks {
+		if !reached[id] {
+			if scheduling {
+				delete(g.tasks, id)
+				continue
+			}
+			return nil, fmt.Errorf("%w: %q is its own ancestor", ErrInvalidTask, task.Title)
+		}
+	}
+
+	for _, task := range sorted {
+		if _, ok := g.tasks[task.ID]; !ok {
+			continue
+		}
+		for _, dependency := range task.DependsOn {
+			if _, ok := g.tasks[dependency]; !ok {
+				if scheduling {
+					continue
+				}
+				return nil, fmt.Errorf("%w: %q depends on a task outside the project", ErrInvalidTask, task.Title)
+			}
+			for _, leaf := range g.leaves[task.ID] {
+				for _, before := range g.leaves[dependency] {
+					if !slices.Contains(g.preds[leaf], before) {
+						g.preds[leaf] = append(g.preds[leaf], before)
+						g.succs[before] = append(g.succs[before], leaf)
+					}
+				}
+			}
+		}
+	}
+
+	// Kahn's algorithm, taking ready tasks in display order.
+	remaining := make(map[uuid.UUID]int)
+	var ready []uuid.UUID
+	for _, task := range sorted {
+		if _, ok := g.tasks[task.ID]; !ok || len(children[task.ID]) > 0 {
+			continue
+		}
+		remaining[task.ID] = len(g.preds[task.ID])
+		if remaining[task.ID] == 0 {
+			ready = append(ready, task.ID)
+		}
+	}
+	for len(ready) > 0 {
+		id := ready[0]
+		ready = ready[1:]
+		g.order = append(g.order, id)
+		for _, next := range g.succs[id] {
+			if remaining[next]--; remaining[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+	if len(g.order) < len(remaining) {
+		var stuck []string
+		for _, task := range sorted {
+			if count, ok := remaining[task.ID]; ok && count > 0 {
+				stuck = append(stuck, fmt.Sprintf("%q", task.Title))
+			}
+		}
+		return nil, fmt.Errorf("%w between %s", ErrDependencyCycle, strings.Join(stuck, ", "))
+	}
+	return g, nil
+}
+
+// schedule runs the critical-path method over the graph. Given asOf, work
+// not yet completed is forecast to start no earlier than that day, so the
+// finish slips as the project falls behind; otherwise it is the plan.
+func (g *taskGraph) schedule(project Project, asOf *time.Time) Schedule {
+	result := Schedule{ProjectID: project.ID, StartDate: project.StartDate, CriticalPath: []uuid.UUID{}, Tasks: []ScheduledTask{}}
+	scheduled := make(map[uuid.UUID]*ScheduledTask)
+	today := 0
+	if asOf != nil && project.StartDate != nil {
+		today = max(0, int(dateOnly(asOf).Sub(*project.StartDate).Hours()/24))
+	}
+
+	for _, id := range g.order {
+		task := g.tasks[id]
+		entry := &ScheduledTask{TaskID: id, ParentID: task.ParentID, Title: task.Title, DueDate: task.DueDate}
+		if task.Status != TaskStatusCompleted {
+			entry.EarlyStart = today
+		}
+		for _, before := range g.preds[id] {
+			entry.EarlyStart = max(entry.EarlyStart, scheduled[before].EarlyFinish)
+		}
+		entry.EarlyFinish = entry.EarlyStart + task.DurationDays
+		result.DurationDays = max(result.DurationDays, entry.EarlyFinish)
+		scheduled[id] = entry
+	}
+	for i := len(g.order) - 1; i >= 0; i-- {
+		id := g.order[i]
+		entry := scheduled[id]
+		entry.LateFinish = result.DurationDays
+		for _, after := range g.succs[id] {
+			entry.LateFinish = min(entry.LateFinish, scheduled[after].LateStart)
+		}
+		entry.LateStart = entry.LateFinish - g.tasks[id].DurationDays
+		entry.Slack = entry.LateStart - entry.EarlyStart
+		entry.Critical = entry.Slack == 0
+	}
+
+	// Summary tasks span their subtasks; children come first in g.summary.
+	for _, id := range g.summary {
+		task := g.tasks[id]
+		entry := &ScheduledTask{TaskID: id, ParentID: task.ParentID, Title: task.Title, DueDate: task.DueDate, EarlyStart: result.DurationDays, LateStart: result.DurationDays, Slack: result.DurationDays}
+		for _, leaf := range g.leaves[id] {
+			child := scheduled[leaf]
+			entry.EarlyStart = min(entry.EarlyStart, child.EarlyStart)
+			entry.EarlyFinish = max(entry.EarlyFinish, child.EarlyFinish)
+			entry.LateStart = min(entry.LateStart, child.LateStart)
+			entry.LateFinish = max(entry.LateFinish, child.LateFinish)
+			entry.Slack = min(entry.Slack, child.Slack)
+		}
+		entry.Critical = entry.Slack == 0
+		scheduled[id] = entry
+	}
+
+	// Follow critical tasks that start as their predecessor finishes, from
+	// the first critical task that starts the project.
+	for _, id := range g.order {
+		if entry := scheduled[id]; entry.Critical && entry.EarlyStart == 0 {
+			result.CriticalPath = append(result.CriticalPath, id)
+			break
+		}
+	}
+	for len(result.CriticalPath) > 0 {
+		current := scheduled[result.CriticalPath[len(result.CriticalPath)-1]]
+		next := uuid.Nil
+		for _, id := range g.order {
+			entry := scheduled[id]
+			if entry.Critical && entry.EarlyStart == current.EarlyFinish && slices.Contains(g.preds[id], current.TaskID) {
+				next = id
+				break
+			}
+		}
+		if next == uuid.Nil {
+			break
+		}
+		result.CriticalPath = append(result.CriticalPath, next)
+	}
+
+	for _, id := range g.displayOrder() {
+		entry := scheduled[id]
+		if project.StartDate != nil {
+			start := project.StartDate.AddDate(0, 0, entry.EarlyStart)
+			finish := project.StartDate.AddDate(0, 0, max(entry.EarlyFinish-1, entry.EarlyStart))
+			entry.StartDate, entry.FinishDate = &start, &finish
+			entry.Late = entry.DueDate != nil && finish.After(*entry.DueDate)
+		}
+		result.Tasks = append(result.Tasks, *entry)
+	}
+	if project.StartDate != nil {
+		finish := project.StartDate.AddDate(0, 0, result.DurationDays)
+		result.FinishDate = &finish
+	}
+	return result
+}
+
+// displayOrder lists every scheduled task depth first, each summary task
+// before its subtasks.
+func (g *taskGraph) displayOrder() []uuid.UUID {
+	children := make(map[uuid.UUID][]*ProjectTask)
+	var roots []*ProjectTask
+	for _, task := range g.tasks {
+		if task.ParentID == nil {
+			roots = append(roots, task)
+		} else {
+			children[*task.ParentID] = append(children[*task.ParentID], task)
+		}
+	}
+	var order []uuid.UUID
+	var walk func(tasks []*ProjectTask)
+	walk = func(tasks []*ProjectTask) {
+		slices.SortFunc(tasks, compareTasks)
+		for _, task := range tasks {
+			order = append(order, task.ID)
+			walk(children[task.ID])
+		}
+	}
+	walk(roots)
+	return order
+}
+
+// compareTasks orders tasks for display: by position, then title and ID.
+func compareTasks(a, b *ProjectTask) int {
+	if a.Position != b.Position {
+		return a.Position - b.Position
+	}
+	if c := strings.Compare(a.Title, b.Title); c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID.String(), b.ID.String())
+}
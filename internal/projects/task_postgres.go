@@ -0,0 +1,198 @@
+package projects
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+type taskRepository struct {
+	db *sql.DB
+}
+
+func NewTaskRepository(db *sql.DB) TaskRepository {
+	return &taskRepository{db: db}
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+const taskColumns = "id, project_id, parent_id, title, description, status, priority, position, duration_days, estimated_hours, due_date, completed_at, assignee_ids, created_at, updated_at"
+
+const insertTaskQuery = "INSERT INTO project_tasks (id, project_id, parent_id, title, description, status, priority, position, duration_days, estimated_hours, due_date, completed_at, assignee_ids) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING " + taskColumns
+
+func scanTask(row rowScanner) (*ProjectTask, error) {
+	var task ProjectTask
+	var assignees []byte
+	err := row.Scan(&task.ID, &task.ProjectID, &task.ParentID, &task.Title, &task.Description, &task.Status, &task.Priority, &task.Position, &task.DurationDays, &task.EstimatedHours, &task.DueDate, &task.CompletedAt, &assignees, &task.CreatedAt, &task.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTaskNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(assignees, &task.AssigneeIDs); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func (r *taskRepository) GetTaskByID(ctx context.Context, id uuid.UUID) (*ProjectTask, error) {
+	task, err := scanTask(r.db.QueryRowContext(ctx, "SELECT "+taskColumns+" FROM project_tasks WHERE id = $1", id))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, "SELECT depends_on_id FROM project_task_dependencies WHERE task_id = $1 ORDER BY depends_on_id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dependency uuid.UUID
+		if err := rows.Scan(&dependency); err != nil {
+			return nil, err
+		}
+		task.DependsOn = append(task.DependsOn, dependency)
+	}
+	return task, rows.Err()
+}
+
+func (r *taskRepository) GetTasksByProjectID(ctx context.Context, projectID uuid.UUID) ([]*ProjectTask, error) {
+	return getProjectTasks(ctx, r.db, projectID)
+}
+
+// getProjectTasks loads a project's tasks with their dependencies, in display
+// order.
+func getProjectTasks(ctx context.Context, db queryer, projectID uuid.UUID) ([]*ProjectTask, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+taskColumns+" FROM project_tasks WHERE project_id = $1 ORDER BY position, title, id", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []*ProjectTask
+	byID := make(map[uuid.UUID]*ProjectTask)
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+		byID[task.ID] = task
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	dependencies, err := db.QueryContext(ctx, "SELECT d.task_id, d.depends_on_id FROM project_task_dependencies d JOIN project_tasks t ON t.id = d.task_id WHERE t.project_id = $1 ORDER BY d.task_id, d.depends_on_id", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer dependencies.Close()
+
+	for dependencies.Next() {
+		var taskID, dependency uuid.UUID
+		if err := dependencies.Scan(&taskID, &dependency); err != nil {
+			return nil, err
+		}
+		if task, ok := byID[taskID]; ok {
+			task.DependsOn = append(task.DependsOn, dependency)
+		}
+	}
+	return tasks, dependencies.Err()
+}
+
+func (r *taskRepository) CreateTask(ctx context.Context, task ProjectTask) (*ProjectTask, error) {
+	if task.ID == uuid.Nil {
+		task.ID = uuid.New()
+	}
+	return r.saveTask(ctx, task, insertTaskQuery)
+}
+
+// UpdateTask leaves the project as it is; a task does not move between
+// projects.
+func (r *taskRepository) UpdateTask(ctx context.Context, task ProjectTask) (*ProjectTask, error) {
+	return r.saveTask(ctx, task, "UPDATE project_tasks SET parent_id = $3, title = $4, description = $5, status = $6, priority = $7, position = $8, duration_days = $9, estimated_hours = $10, due_date = $11, completed_at = $12, assignee_ids = $13, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND project_id = $2 RETURNING "+taskColumns)
+}
+
+// saveTask writes the task and replaces its dependencies. The project row is
+// locked while the project's tasks are checked with the change applied, so
+// concurrent edits cannot together close a dependency cycle.
+func (r *taskRepository) saveTask(ctx context.Context, task ProjectTask, query string) (*ProjectTask, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var projectID uuid.UUID
+	err = tx.QueryRowContext(ctx, "SELECT id FROM projects WHERE id = $1 FOR UPDATE", task.ProjectID).Scan(&projectID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrProjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := getProjectTasks(ctx, tx, task.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	index := slices.IndexFunc(tasks, func(t *ProjectTask) bool { return t.ID == task.ID })
+	if index < 0 {
+		tasks = append(tasks, &task)
+	} else {
+		tasks[index] = &task
+	}
+	if _, err := buildTaskGraph(tasks, false); err != nil {
+		return nil, err
+	}
+
+	saved, err := writeTask(ctx, tx, query, task)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	saved.DependsOn = task.DependsOn
+	return saved, nil
+}
+
+// writeTask runs the insert or update query for the task and replaces its
+// dependencies, returning the saved row without them.
+func writeTask(ctx context.Context, tx *sql.Tx, query string, task ProjectTask) (*ProjectTask, error) {
+	if task.AssigneeIDs == nil {
+		task.AssigneeIDs = []uuid.UUID{}
+	}
+	assignees, err := json.Marshal(task.AssigneeIDs)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := scanTask(tx.QueryRowContext(ctx, query,
+		task.ID, task.ProjectID, task.ParentID, task.Title, task.Description, task.Status, task.Priority, task.Position, task.DurationDays, task.EstimatedHours, task.DueDate, task.CompletedAt, assignees))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM project_task_dependencies WHERE task_id = $1", task.ID); err != nil {
+		return nil, err
+	}
+	for _, dependency := range task.DependsOn {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO project_task_dependencies (task_id, depends_on_id) VALUES ($1, $2)", task.ID, dependency); err != nil {
+			return nil, err
+		}
+	}
+	return saved, nil
+}
+
+func (r *taskRepository) DeleteTask(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM project_tasks WHERE id = $1", id)
+	return err
+}
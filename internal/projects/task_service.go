@@ -0,0 +1,251 @@
+package projects
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TaskService interface {
+	TaskManager
+	ScheduleBuilder
+}
+
+// TaskRepository saves tasks with their dependencies, returning
+// ErrDependencyCycle or ErrInvalidTask if the change would leave the
+// project's tasks with a cycle or a subtask or dependency outside the
+// project.
+type TaskRepository interface {
+	TaskManager
+}
+
+type TaskManager interface {
+	TaskReader
+	TaskWriter
+}
+
+type TaskReader interface {
+	TaskRetriever
+	TaskLister
+}
+
+type TaskWriter interface {
+	TaskCreator
+	TaskUpdater
+	TaskDeleter
+}
+
+type TaskRetriever interface {
+	GetTaskByID(ctx context.Context, id uuid.UUID) (*ProjectTask, error)
+}
+
+// TaskLister returns a project's tasks, with their dependencies, in display
+// order.
+type TaskLister interface {
+	GetTasksByProjectID(ctx context.Context, projectID uuid.UUID) ([]*ProjectTask, error)
+}
+
+type TaskCreator interface {
+	CreateTask(ctx context.Context, task ProjectTask) (*ProjectTask, error)
+}
+
+type TaskUpdater interface {
+	UpdateTask(ctx context.Context, task ProjectTask) (*ProjectTask, error)
+}
+
+// TaskDeleter deletes a task with its subtasks and dependencies.
+type TaskDeleter interface {
+	DeleteTask(ctx context.Context, id uuid.UUID) error
+}
+
+// ScheduleBuilder computes a project's critical path and the slack of each
+// task.
+type ScheduleBuilder interface {
+	GetSchedule(ctx context.Context, projectID uuid.UUID) (*Schedule, error)
+}
+
+type taskService struct {
+	repo       TaskRepository
+	projects   ProjectRetriever
+	milestones MilestoneTracker
+	now        func() time.Time
+}
+
+// TaskServiceOption configures optional collaborators of the task service.
+type TaskServiceOption func(*taskService)
+
+// WithMilestoneTracking completes the project's milestones whose tasks are
+// all done after every task change.
+func WithMilestoneTracking(milestones MilestoneTracker) TaskServiceOption {
+	return func(s *taskService) {
+		s.milestones = milestones
+	}
+}
+
+func NewTaskService(repo TaskRepository, projects ProjectRetriever, opts ...TaskServiceOption) TaskService {
+	s := &taskService{repo: repo, projects: projects, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *taskService) GetTaskByID(ctx context.Context, id uuid.UUID) (*ProjectTask, error) {
+	return s.repo.GetTaskByID(ctx, id)
+}
+
+func (s *taskService) GetTasksByProjectID(ctx context.Context, projectID uuid.UUID) ([]*ProjectTask, error) {
+	if _, err := s.projects.GetProjectByID(ctx, projectID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTasksByProjectID(ctx, projectID)
+}
+
+func (s *taskService) CreateTask(ctx context.Context, task ProjectTask) (*ProjectTask, error) {
+	if _, err := s.projects.GetProjectByID(ctx, task.ProjectID); err != nil {
+		return nil, err
+	}
+	if task.Status == "" {
+		task.Status = TaskStatusTodo
+	}
+	task.CompletedAt = nil
+	if task.Status == TaskStatusCompleted {
+		now := s.now()
+		task.CompletedAt = &now
+	}
+	if err := normalizeTask(&task); err != nil {
+		return nil, err
+	}
+	created, err := s.repo.CreateTask(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+	s.trackMilestones(ctx, created.ProjectID)
+	return created, nil
+}
+
+// UpdateTask replaces the task's details, dependencies and assignees. It
+// stays on its project, and CompletedAt follows the status.
+func (s *taskService) UpdateTask(ctx context.Context, task ProjectTask) (*ProjectTask, error) {
+	existing, err := s.repo.GetTaskByID(ctx, task.ID)
+	if err != nil {
+		return nil, err
+	}
+	task.ProjectID = existing.ProjectID
+	if task.Status == "" {
+		task.Status = existing.Status
+	}
+	switch {
+	case task.Status != TaskStatusCompleted:
+		task.CompletedAt = nil
+	case existing.Status == TaskStatusCompleted:
+		task.CompletedAt = existing.CompletedAt
+	default:
+		now := s.now()
+		task.CompletedAt = &now
+	}
+	if err := normalizeTask(&task); err != nil {
+		return nil, err
+	}
+	updated, err := s.repo.UpdateTask(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+	s.trackMilestones(ctx, updated.ProjectID)
+	return updated, nil
+}
+
+func (s *taskService) DeleteTask(ctx context.Context, id uuid.UUID) error {
+	if s.milestones == nil {
+		return s.repo.DeleteTask(ctx, id)
+	}
+	existing, err := s.repo.GetTaskByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteTask(ctx, id); err != nil {
+		return err
+	}
+	s.trackMilestones(ctx, existing.ProjectID)
+	return nil
+}
+
+// trackMilestones brings the project's milestones up to date after a task
+// change. The change stands even if that fails.
+func (s *taskService) trackMilestones(ctx context.Context, projectID uuid.UUID) {
+	if s.milestones == nil {
+		return
+	}
+	if _, err := s.milestones.TrackMilestones(ctx, projectID); err != nil {
+		slog.ErrorContext(ctx, "milestone tracking failed", "project_id", projectID, "error", err)
+	}
+}
+
+// GetSchedule schedules every task that is not cancelled as early as its
+// dependencies allow, counting days from the project start.
+func (s *taskService) GetSchedule(ctx context.Context, projectID uuid.UUID) (*Schedule, error) {
+	project, err := s.projects.GetProjectByID(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := s.repo.GetTasksByProjectID(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	graph, err := buildTaskGraph(tasks, true)
+	if err != nil {
+		return nil, err
+	}
+	schedule := graph.schedule(*project, nil)
+	return &schedule, nil
+}
+
+// normalizeTask trims and validates the task's own fields and removes
+// repeated dependencies and assignees. Checks that span the project's tasks,
+// such as cycles, are left to the repository.
+func normalizeTask(task *ProjectTask) error {
+	task.Title = strings.TrimSpace(task.Title)
+	if task.Title == "" {
+		return fmt.Errorf("%w: a title is required", ErrInvalidTask)
+	}
+	if !task.Status.Valid() {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidTask, task.Status)
+	}
+	if task.Priority == "" {
+		task.Priority = PriorityMedium
+	}
+	if !task.Priority.Valid() {
+		return fmt.Errorf("%w: unknown priority %q", ErrInvalidTask, task.Priority)
+	}
+	if task.DurationDays < 0 {
+		return fmt.Errorf("%w: the duration cannot be negative", ErrInvalidTask)
+	}
+	if task.EstimatedHours < 0 {
+		return fmt.Errorf("%w: the estimate cannot be negative", ErrInvalidTask)
+	}
+	if task.ParentID != nil && *task.ParentID == task.ID {
+		return fmt.Errorf("%w: a task cannot be its own subtask", ErrInvalidTask)
+	}
+	task.DependsOn = uniqueIDs(task.DependsOn)
+	if slices.Contains(task.DependsOn, task.ID) {
+		return fmt.Errorf("%w: %q depends on itself", ErrDependencyCycle, task.Title)
+	}
+	task.AssigneeIDs = uniqueIDs(task.AssigneeIDs)
+	task.DueDate = dateOnly(task.DueDate)
+	return nil
+}
+
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	unique := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if id != uuid.Nil && !slices.Contains(unique, id) {
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
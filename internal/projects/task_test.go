@@ -0,0 +1,285 @@
+package projects
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockTaskRepository struct {
+	mock.Mock
+}
+
+func (m *MockTaskRepository) GetTaskByID(ctx context.Context, id uuid.UUID) (*ProjectTask, error) {
+	args := m.Called(ctx, id)
+	task, _ := args.Get(0).(*ProjectTask)
+	return task, args.Error(1)
+}
+
+func (m *MockTaskRepository) GetTasksByProjectID(ctx context.Context, projectID uuid.UUID) ([]*ProjectTask, error) {
+	args := m.Called(ctx, projectID)
+	tasks, _ := args.Get(0).([]*ProjectTask)
+	return tasks, args.Error(1)
+}
+
+func (m *MockTaskRepository) CreateTask(ctx context.Context, task ProjectTask) (*ProjectTask, error) {
+	args := m.Called(ctx, task)
+	created, _ := args.Get(0).(*ProjectTask)
+	return created, args.Error(1)
+}
+
+func (m *MockTaskRepository) UpdateTask(ctx context.Context, task ProjectTask) (*ProjectTask, error) {
+	args := m.Called(ctx, task)
+	updated, _ := args.Get(0).(*ProjectTask)
+	return updated, args.Error(1)
+}
+
+func (m *MockTaskRepository) DeleteTask(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func task(title string, days int, dependsOn ...*ProjectTask) *ProjectTask {
+	t := &ProjectTask{Title: title, Status: TaskStatusTodo, DurationDays: days}
+	t.ID = uuid.New()
+	for _, dependency := range dependsOn {
+		t.DependsOn = append(t.DependsOn, dependency.ID)
+	}
+	return t
+}
+
+func subtask(parent *ProjectTask, title string, days int, dependsOn ...*ProjectTask) *ProjectTask {
+	t := task(title, days, dependsOn...)
+	t.ParentID = &parent.ID
+	return t
+}
+
+func scheduledTask(schedule Schedule, id uuid.UUID) ScheduledTask {
+	for _, entry := range schedule.Tasks {
+		if entry.TaskID == id {
+			return entry
+		}
+	}
+	return ScheduledTask{}
+}
+
+func TestBuildTaskGraph_DetectsCycles(t *testing.T) {
+	design := task("Design", 2)
+	build := task("Build", 3, design)
+	test := task("Test", 1, build)
+	design.DependsOn = []uuid.UUID{test.ID}
+
+	_, err := buildTaskGraph([]*ProjectTask{design, build, test}, false)
+
+	assert.ErrorIs(t, err, ErrDependencyCycle)
+	assert.ErrorContains(t, err, `"Build", "Design", "Test"`)
+}
+
+func TestBuildTaskGraph_SummaryCannotDependOnItsSubtask(t *testing.T) {
+	phase := task("Phase", 0)
+	step := subtask(phase, "Step", 2)
+	phase.DependsOn = []uuid.UUID{step.ID}
+
+	_, err := buildTaskGraph([]*ProjectTask{phase, step}, false)
+
+	assert.ErrorIs(t, err, ErrDependencyCycle)
+}
+
+func TestBuildTaskGraph_RejectsParentLoopsAndOutsideTasks(t *testing.T) {
+	a, b := task("A", 1), task("B", 1)
+	a.ParentID, b.ParentID = &b.ID, &a.ID
+
+	_, err := buildTaskGraph([]*ProjectTask{a, b}, false)
+	assert.ErrorIs(t, err, ErrInvalidTask)
+
+	c := task("C", 1, task("Elsewhere", 1))
+	_, err = buildTaskGraph([]*ProjectTask{c}, false)
+	assert.ErrorIs(t, err, ErrInvalidTask)
+}
+
+func TestSchedule_CriticalPathAndSlack(t *testing.T) {
+	// Arrange
+	design := task("Design", 2)
+	build := task("Build", 5, design)
+	docs := task("Docs", 1, design)
+	release := task("Release", 1, build, docs)
+	project := Project{StartDate: date(2026, 7, 1)}
+	project.ID = uuid.New()
+
+	graph, err := buildTaskGraph([]*ProjectTask{release, docs, build, design}, true)
+	require.NoError(t, err)
+
+	// Act
+	schedule := graph.schedule(project, nil)
+
+	// Assert
+	assert.Equal(t, 8, schedule.DurationDays)
+	assert.Equal(t, []uuid.UUID{design.ID, build.ID, release.ID}, schedule.CriticalPath)
+	assert.Equal(t, 4, scheduledTask(schedule, docs.ID).Slack)
+	assert.False(t, scheduledTask(schedule, docs.ID).Critical)
+	assert.Equal(t, 7, scheduledTask(schedule, release.ID).EarlyStart)
+	assert.Equal(t, date(2026, 7, 8), scheduledTask(schedule, release.ID).StartDate)
+	assert.Equal(t, date(2026, 7, 9), schedule.FinishDate)
+}
+
+func TestSchedule_SummaryTasksSpanSubtasks(t *testing.T) {
+	// Arrange
+	phase := task("Phase", 0)
+	first := subtask(phase, "First", 2)
+	second := subtask(phase, "Second", 3, first)
+	second.Position = 1
+	after := task("After", 1, phase)
+	after.Position = 1
+	after.DueDate = date(2026, 7, 5)
+	dropped := task("Dropped", 10)
+	dropped.Status = TaskStatusCancelled
+	project := Project{StartDate: date(2026, 7, 1)}
+
+	graph, err := buildTaskGraph([]*ProjectTask{phase, first, second, after, dropped}, true)
+	require.NoError(t, err)
+
+	// Act
+	schedule := graph.schedule(project, nil)
+
+	// Assert
+	assert.Equal(t, 6, schedule.DurationDays)
+	require.Len(t, schedule.Tasks, 4)
+	assert.Equal(t, []uuid.UUID{phase.ID, first.ID, second.ID, after.ID}, []uuid.UUID{schedule.Tasks[0].TaskID, schedule.Tasks[1].TaskID, schedule.Tasks[2].TaskID, schedule.Tasks[3].TaskID})
+	summary := scheduledTask(schedule, phase.ID)
+	assert.Equal(t, 0, summary.EarlyStart)
+	assert.Equal(t, 5, summary.EarlyFinish)
+	assert.True(t, summary.Critical)
+	assert.Equal(t, 5, scheduledTask(schedule, after.ID).EarlyStart)
+	assert.True(t, scheduledTask(schedule, after.ID).Late)
+}
+
+type TaskServiceTestSuite struct {
+	suite.Suite
+	repo     *MockTaskRepository
+	projects *MockProjectRepository
+	service  *taskService
+	now      time.Time
+}
+
+func (s *TaskServiceTestSuite) SetupTest() {
+	s.repo = new(MockTaskRepository)
+	s.projects = new(MockProjectRepository)
+	s.now = time.Date(2026, 7, 3, 9, 0, 0, 0, time.UTC)
+	s.service = NewTaskService(s.repo, s.projects).(*taskService)
+	s.service.now = func() time.Time { return s.now }
+}
+
+func (s *TaskServiceTestSuite) TearDownTest() {
+	s.repo.AssertExpectations(s.T())
+	s.projects.AssertExpectations(s.T())
+}
+
+func TestTaskServiceSuite(t *testing.T) {
+	suite.Run(t, new(TaskServiceTestSuite))
+}
+
+func (s *TaskServiceTestSuite) TestCreateTask_DefaultsAndDeduplicates() {
+	// Arrange
+	ctx := context.Background()
+	projectID, userID, dependency := uuid.New(), uuid.New(), uuid.New()
+	due := time.Date(2026, 7, 10, 17, 0, 0, 0, time.UTC)
+
+	s.projects.On("GetProjectByID", ctx, projectID).Return(&Project{}, nil)
+	s.repo.On("CreateTask", ctx, ProjectTask{
+		ProjectID:   projectID,
+		Title:       "Survey site",
+		Status:      TaskStatusTodo,
+		Priority:    PriorityMedium,
+		DueDate:     date(2026, 7, 10),
+		AssigneeIDs: []uuid.UUID{userID},
+		DependsOn:   []uuid.UUID{dependency},
+	}).Return(&ProjectTask{}, nil)
+
+	// Act
+	_, err := s.service.CreateTask(ctx, ProjectTask{
+		ProjectID:   projectID,
+		Title:       " Survey site ",
+		DueDate:     &due,
+		AssigneeIDs: []uuid.UUID{userID, userID},
+		DependsOn:   []uuid.UUID{dependency, dependency},
+	})
+
+	// Assert
+	s.NoError(err)
+}
+
+func (s *TaskServiceTestSuite) TestCreateTask_RequiresExistingProject() {
+	// Arrange
+	ctx := context.Background()
+	projectID := uuid.New()
+	s.projects.On("GetProjectByID", ctx, projectID).Return(nil, ErrProjectNotFound)
+
+	// Act
+	result, err := s.service.CreateTask(ctx, ProjectTask{ProjectID: projectID, Title: "Survey site"})
+
+	// Assert
+	s.ErrorIs(err, ErrProjectNotFound)
+	s.Nil(result)
+}
+
+func (s *TaskServiceTestSuite) TestUpdateTask_RejectsSelfDependency() {
+	// Arrange
+	ctx := context.Background()
+	taskID := uuid.New()
+	s.repo.On("GetTaskByID", ctx, taskID).Return(&ProjectTask{ProjectID: uuid.New(), Status: TaskStatusTodo}, nil)
+
+	update := ProjectTask{Title: "Survey site", DependsOn: []uuid.UUID{taskID}}
+	update.ID = taskID
+
+	// Act
+	_, err := s.service.UpdateTask(ctx, update)
+
+	// Assert
+	s.ErrorIs(err, ErrDependencyCycle)
+}
+
+func (s *TaskServiceTestSuite) TestUpdateTask_StampsCompletionAndKeepsProject() {
+	// Arrange
+	ctx := context.Background()
+	taskID, projectID := uuid.New(), uuid.New()
+	s.repo.On("GetTaskByID", ctx, taskID).Return(&ProjectTask{ProjectID: projectID, Status: TaskStatusInProgress}, nil)
+	s.repo.On("UpdateTask", ctx, mock.MatchedBy(func(t ProjectTask) bool {
+		return t.ProjectID == projectID && t.CompletedAt != nil && t.CompletedAt.Equal(s.now)
+	})).Return(&ProjectTask{}, nil)
+
+	update := ProjectTask{ProjectID: uuid.New(), Title: "Survey site", Status: TaskStatusCompleted}
+	update.ID = taskID
+
+	// Act
+	_, err := s.service.UpdateTask(ctx, update)
+
+	// Assert
+	s.NoError(err)
+}
+
+func (s *TaskServiceTestSuite) TestGetSchedule_UsesProjectStart() {
+	// Arrange
+	ctx := context.Background()
+	project := &Project{StartDate: date(2026, 7, 1), Currency: core.USD}
+	project.ID = uuid.New()
+	only := task("Only", 3)
+
+	s.projects.On("GetProjectByID", ctx, project.ID).Return(project, nil)
+	s.repo.On("GetTasksByProjectID", ctx, project.ID).Return([]*ProjectTask{only}, nil)
+
+	// Act
+	schedule, err := s.service.GetSchedule(ctx, project.ID)
+
+	// Assert
+	s.Require().NoError(err)
+	s.Equal([]uuid.UUID{only.ID}, schedule.CriticalPath)
+	s.Equal(date(2026, 7, 3), schedule.Tasks[0].FinishDate)
+}
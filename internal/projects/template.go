@@ -0,0 +1,245 @@
+package projects
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTemplateNotFound    = errors.New("project template not found")
+	ErrInvalidTemplate     = errors.New("invalid project template")
+	ErrAlreadyInstantiated = errors.New("template already instantiated for the opportunity")
+)
+
+// ProjectTemplate is the plan of a standard engagement. Its tasks and
+// milestones refer to each other by Ref and are dated in days from the
+// project start, so the same template serves every customer.
+type ProjectTemplate struct {
+	core.BaseModel
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Winning an opportunity for this product instantiates the template
+	// for the customer. Templates without a product are only used by hand.
+	Product customers.OpportunityProduct `json:"product"`
+
+	DurationDays  int                  `json:"duration_days"`  // Planned length, setting the project's end date
+	RoleAssignees map[string]uuid.UUID `json:"role_assignees"` // Default user for each role
+
+	Tasks      []TemplateTask      `json:"tasks"`
+	Milestones []TemplateMilestone `json:"milestones"`
+}
+
+// TemplateTask becomes a ProjectTask. Tasks are positioned among their
+// siblings in the order they are listed.
+type TemplateTask struct {
+	Ref            string   `json:"ref"`        // Unique within the template
+	ParentRef      string   `json:"parent_ref"` // Set on subtasks
+	Title          string   `json:"title"`
+	Description    string   `json:"description"`
+	Priority       Priority `json:"priority"`
+	DurationDays   int      `json:"duration_days"`
+	EstimatedHours float64  `json:"estimated_hours"`
+	DueOffsetDays  *int     `json:"due_offset_days"` // Due this many days after the start; none if nil
+	Roles          []string `json:"roles"`           // Assigned to the users filling these roles
+	DependsOn      []string `json:"depends_on"`      // Refs of tasks that must finish first
+}
+
+// TemplateMilestone marks a point in the engagement, reached when the tasks
+// it lists are done.
+type TemplateMilestone struct {
+	Title         string   `json:"title"`
+	Description   string   `json:"description"`
+	DueOffsetDays int      `json:"due_offset_days"`
+	TaskRefs      []string `json:"task_refs"`
+}
+
+// TemplateInstantiation says whom a project is created for from a template.
+type TemplateInstantiation struct {
+	CustomerID    uuid.UUID            `json:"customer_id"`
+	Name          string               `json:"name"`           // Defaults to the template's
+	StartDate     *time.Time           `json:"start_date"`     // Defaults to today
+	AssignedToID  *uuid.UUID           `json:"assigned_to_id"` // The user responsible for the project
+	RoleAssignees map[string]uuid.UUID `json:"role_assignees"` // Overrides the template's defaults
+	OpportunityID *uuid.UUID           `json:"opportunity_id"` // The won opportunity, if any
+}
+
+// validateTemplate trims the template and checks that its references
+// resolve and its dependencies hold no cycle.
+func validateTemplate(template *ProjectTemplate) error {
+	template.Name = strings.TrimSpace(template.Name)
+	if template.Name == "" {
+		return fmt.Errorf("%w: a name is required", ErrInvalidTemplate)
+	}
+	template.Product = customers.OpportunityProduct(strings.TrimSpace(string(template.Product)))
+	if template.DurationDays < 0 {
+		return fmt.Errorf("%w: the duration cannot be negative", ErrInvalidTemplate)
+	}
+	for role, user := range template.RoleAssignees {
+		if strings.TrimSpace(role) == "" || user == uuid.Nil {
+			return fmt.Errorf("%w: role assignees need a role and a user", ErrInvalidTemplate)
+		}
+	}
+
+	refs := make(map[string]bool)
+	for i := range template.Tasks {
+		task := &template.Tasks[i]
+		task.Ref, task.ParentRef = strings.TrimSpace(task.Ref), strings.TrimSpace(task.ParentRef)
+		task.Title = strings.TrimSpace(task.Title)
+		switch {
+		case task.Ref == "":
+			return fmt.Errorf("%w: task %d needs a ref", ErrInvalidTemplate, i+1)
+		case refs[task.Ref]:
+			return fmt.Errorf("%w: ref %q is used twice", ErrInvalidTemplate, task.Ref)
+		case task.Title == "":
+			return fmt.Errorf("%w: task %q needs a title", ErrInvalidTemplate, task.Ref)
+		case task.DurationDays < 0 || task.EstimatedHours < 0:
+			return fmt.Errorf("%w: task %q cannot have a negative duration or estimate", ErrInvalidTemplate, task.Ref)
+		case task.DueOffsetDays != nil && *task.DueOffsetDays < 0:
+			return fmt.Errorf("%w: task %q cannot be due before the start", ErrInvalidTemplate, task.Ref)
+		}
+		if task.Priority == "" {
+			task.Priority = PriorityMedium
+		}
+		if !task.Priority.Valid() {
+			return fmt.Errorf("%w: task %q has unknown priority %q", ErrInvalidTemplate, task.Ref, task.Priority)
+		}
+		refs[task.Ref] = true
+	}
+	for _, task := range template.Tasks {
+		if task.ParentRef != "" && !refs[task.ParentRef] {
+			return fmt.Errorf("%w: task %q is a subtask of unknown ref %q", ErrInvalidTemplate, task.Ref, task.ParentRef)
+		}
+		for _, ref := range task.DependsOn {
+			if !refs[ref] {
+				return fmt.Errorf("%w: task %q depends on unknown ref %q", ErrInvalidTemplate, task.Ref, ref)
+			}
+		}
+	}
+	for i := range template.Milestones {
+		milestone := &template.Milestones[i]
+		milestone.Title = strings.TrimSpace(milestone.Title)
+		if milestone.Title == "" {
+			return fmt.Errorf("%w: milestone %d needs a title", ErrInvalidTemplate, i+1)
+		}
+		if milestone.DueOffsetDays < 0 {
+			return fmt.Errorf("%w: milestone %q cannot be due before the start", ErrInvalidTemplate, milestone.Title)
+		}
+		for _, ref := range milestone.TaskRefs {
+			if !refs[ref] {
+				return fmt.Errorf("%w: milestone %q lists unknown ref %q", ErrInvalidTemplate, milestone.Title, ref)
+			}
+		}
+	}
+
+	_, planned, _ := template.plan(TemplateInstantiation{StartDate: &time.Time{}})
+	if len(planned) < len(template.Tasks) {
+		return fmt.Errorf("%w: subtasks are nested in a loop", ErrInvalidTemplate)
+	}
+	tasks := make([]*ProjectTask, len(planned))
+	for i := range planned {
+		tasks[i] = &planned[i]
+	}
+	if _, err := buildTaskGraph(tasks, false); err != nil {
+		return err
+	}
+	return nil
+}
+
+// plan lays out a validated template as a new project with its tasks and
+// milestones. Tasks come parents first, so they can be inserted in order.
+func (t ProjectTemplate) plan(request TemplateInstantiation) (Project, []ProjectTask, []Milestone) {
+	start := *request.StartDate
+	project := Project{
+		CustomerID:    request.CustomerID,
+		Name:          request.Name,
+		Description:   t.Description,
+		Status:        ProjectStatusPlanning,
+		StartDate:     &start,
+		AssignedToID:  request.AssignedToID,
+		TemplateID:    &t.ID,
+		OpportunityID: request.OpportunityID,
+	}
+	if project.Name == "" {
+		project.Name = t.Name
+	}
+	if t.DurationDays > 0 {
+		end := start.AddDate(0, 0, t.DurationDays-1)
+		project.EndDate = &end
+	}
+	project.ID = uuid.New()
+
+	ids := make(map[string]uuid.UUID, len(t.Tasks))
+	children := make(map[string][]TemplateTask)
+	for _, task := range t.Tasks {
+		ids[task.Ref] = uuid.New()
+		children[task.ParentRef] = append(children[task.ParentRef], task)
+	}
+	var tasks []ProjectTask
+	var add func(parentRef string)
+	add = func(parentRef string) {
+		for position, template := range children[parentRef] {
+			task := ProjectTask{
+				ProjectID:      project.ID,
+				Title:          template.Title,
+				Description:    template.Description,
+				Status:         TaskStatusTodo,
+				Priority:       template.Priority,
+				Position:       position,
+				DurationDays:   template.DurationDays,
+				EstimatedHours: template.EstimatedHours,
+				AssigneeIDs:    []uuid.UUID{},
+				DependsOn:      []uuid.UUID{},
+			}
+			task.ID = ids[template.Ref]
+			if template.ParentRef != "" {
+				parent := ids[template.ParentRef]
+				task.ParentID = &parent
+			}
+			if template.DueOffsetDays != nil {
+				due := start.AddDate(0, 0, *template.DueOffsetDays)
+				task.DueDate = &due
+			}
+			for _, role := range template.Roles {
+				user, ok := request.RoleAssignees[role]
+				if !ok {
+					user, ok = t.RoleAssignees[role]
+				}
+				if ok && !slices.Contains(task.AssigneeIDs, user) {
+					task.AssigneeIDs = append(task.AssigneeIDs, user)
+				}
+			}
+			for _, ref := range template.DependsOn {
+				task.DependsOn = append(task.DependsOn, ids[ref])
+			}
+			tasks = append(tasks, task)
+			add(template.Ref)
+		}
+	}
+	add("")
+
+	milestones := make([]Milestone, 0, len(t.Milestones))
+	for _, template := range t.Milestones {
+		milestone := Milestone{
+			ProjectID:   project.ID,
+			Title:       template.Title,
+			Description: template.Description,
+			DueDate:     start.AddDate(0, 0, template.DueOffsetDays),
+			TaskIDs:     []uuid.UUID{},
+		}
+		milestone.ID = uuid.New()
+		for _, ref := range template.TaskRefs {
+			milestone.TaskIDs = append(milestone.TaskIDs, ids[ref])
+		}
+		milestones = append(milestones, milestone)
+	}
+	return project, tasks, milestones
+}
@@ -0,0 +1,175 @@
+package projects
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+)
+
+type templateRepository struct {
+	db *sql.DB
+}
+
+func NewTemplateRepository(db *sql.DB) TemplateRepository {
+	return &templateRepository{db: db}
+}
+
+const templateColumns = "id, name, description, product, duration_days, role_assignees, tasks, milestones, created_at, updated_at"
+
+func scanTemplate(row rowScanner) (*ProjectTemplate, error) {
+	var template ProjectTemplate
+	var roles, tasks, milestones []byte
+	err := row.Scan(&template.ID, &template.Name, &template.Description, &template.Product, &template.DurationDays, &roles, &tasks, &milestones, &template.CreatedAt, &template.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range []struct {
+		data []byte
+		into any
+	}{{roles, &template.RoleAssignees}, {tasks, &template.Tasks}, {milestones, &template.Milestones}} {
+		if err := json.Unmarshal(field.data, field.into); err != nil {
+			return nil, err
+		}
+	}
+	return &template, nil
+}
+
+func (r *templateRepository) GetTemplateByID(ctx context.Context, id uuid.UUID) (*ProjectTemplate, error) {
+	return scanTemplate(r.db.QueryRowContext(ctx, "SELECT "+templateColumns+" FROM project_templates WHERE id = $1", id))
+}
+
+func (r *templateRepository) ListTemplates(ctx context.Context, product customers.OpportunityProduct) ([]*ProjectTemplate, error) {
+	query, args := "SELECT "+templateColumns+" FROM project_templates", []any{}
+	if product != "" {
+		query, args = query+" WHERE product = $1", append(args, product)
+	}
+	rows, err := r.db.QueryContext(ctx, query+" ORDER BY name, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []*ProjectTemplate
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+func (r *templateRepository) CreateTemplate(ctx context.Context, template ProjectTemplate) (*ProjectTemplate, error) {
+	if template.ID == uuid.Nil {
+		template.ID = uuid.New()
+	}
+	return r.saveTemplate(ctx, template, "INSERT INTO project_templates (id, name, description, product, duration_days, role_assignees, tasks, milestones) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING "+templateColumns)
+}
+
+// UpdateTemplate changes only projects instantiated from then on.
+func (r *templateRepository) UpdateTemplate(ctx context.Context, template ProjectTemplate) (*ProjectTemplate, error) {
+	return r.saveTemplate(ctx, template, "UPDATE project_templates SET name = $2, description = $3, product = $4, duration_days = $5, role_assignees = $6, tasks = $7, milestones = $8, updated_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING "+templateColumns)
+}
+
+func (r *templateRepository) saveTemplate(ctx context.Context, template ProjectTemplate, query string) (*ProjectTemplate, error) {
+	if template.RoleAssignees == nil {
+		template.RoleAssignees = map[string]uuid.UUID{}
+	}
+	if template.Tasks == nil {
+		template.Tasks = []TemplateTask{}
+	}
+	if template.Milestones == nil {
+		template.Milestones = []TemplateMilestone{}
+	}
+	roles, err := json.Marshal(template.RoleAssignees)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := json.Marshal(template.Tasks)
+	if err != nil {
+		return nil, err
+	}
+	milestones, err := json.Marshal(template.Milestones)
+	if err != nil {
+		return nil, err
+	}
+	return scanTemplate(r.db.QueryRowContext(ctx, query,
+		template.ID, template.Name, template.Description, template.Product, template.DurationDays, roles, tasks, milestones))
+}
+
+// DeleteTemplate leaves the projects made from the template in place.
+func (r *templateRepository) DeleteTemplate(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM project_templates WHERE id = $1", id)
+	return err
+}
+
+// CreateProjectFromPlan inserts the project with its tasks and milestones in
+// one transaction. The template row is locked so that one opportunity cannot be
+// instantiated twice from the same template.
+func (r *templateRepository) CreateProjectFromPlan(ctx context.Context, project Project, tasks []ProjectTask, milestones []Milestone) (*Project, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if project.TemplateID != nil {
+		var templateID uuid.UUID
+		err := tx.QueryRowContext(ctx, "SELECT id FROM project_templates WHERE id = $1 FOR UPDATE", *project.TemplateID).Scan(&templateID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTemplateNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if project.TemplateID != nil && project.OpportunityID != nil {
+		var exists bool
+		err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM projects WHERE template_id = $1 AND opportunity_id = $2)", *project.TemplateID, *project.OpportunityID).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, ErrAlreadyInstantiated
+		}
+	}
+
+	created, err := scanProject(tx.QueryRowContext(ctx, insertProjectQuery,
+		project.ID, project.CustomerID, project.Name, project.Description, project.Status, project.StartDate, project.EndDate, project.Currency, project.Budget, project.AssignedToID, project.TemplateID, project.OpportunityID))
+	if err != nil {
+		return nil, err
+	}
+	// Dependencies are added once every task exists; tasks come parents
+	// first.
+	for _, task := range tasks {
+		task.DependsOn = nil
+		if _, err := writeTask(ctx, tx, insertTaskQuery, task); err != nil {
+			return nil, err
+		}
+	}
+	for _, task := range tasks {
+		for _, dependency := range task.DependsOn {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO project_task_dependencies (task_id, depends_on_id) VALUES ($1, $2)", task.ID, dependency); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, milestone := range milestones {
+		if err := writeMilestone(ctx, tx, insertMilestoneQuery, milestone); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
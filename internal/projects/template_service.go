@@ -0,0 +1,207 @@
+package projects
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+)
+
+type TemplateService interface {
+	TemplateManager
+	TemplateInstantiator
+	OpportunityInstantiator
+}
+
+type TemplateRepository interface {
+	TemplateManager
+	ProjectPlanCreator
+}
+
+type TemplateManager interface {
+	TemplateReader
+	TemplateWriter
+}
+
+type TemplateReader interface {
+	TemplateRetriever
+	TemplateLister
+}
+
+type TemplateWriter interface {
+	TemplateCreator
+	TemplateUpdater
+	TemplateDeleter
+}
+
+type TemplateRetriever interface {
+	GetTemplateByID(ctx context.Context, id uuid.UUID) (*ProjectTemplate, error)
+}
+
+// TemplateLister lists the templates for a product, or all of them if the
+// product is empty.
+type TemplateLister interface {
+	ListTemplates(ctx context.Context, product customers.OpportunityProduct) ([]*ProjectTemplate, error)
+}
+
+type TemplateCreator interface {
+	CreateTemplate(ctx context.Context, template ProjectTemplate) (*ProjectTemplate, error)
+}
+
+type TemplateUpdater interface {
+	UpdateTemplate(ctx context.Context, template ProjectTemplate) (*ProjectTemplate, error)
+}
+
+type TemplateDeleter interface {
+	DeleteTemplate(ctx context.Context, id uuid.UUID) error
+}
+
+// ProjectPlanCreator saves a project with its tasks and milestones in one
+// go, returning
+// ErrAlreadyInstantiated if its template was already used for its
+// opportunity.
+type ProjectPlanCreator interface {
+	CreateProjectFromPlan(ctx context.Context, project Project, tasks []ProjectTask, milestones []Milestone) (*Project, error)
+}
+
+// TemplateInstantiator creates a project for a customer from a template.
+type TemplateInstantiator interface {
+	InstantiateTemplate(ctx context.Context, templateID uuid.UUID, request TemplateInstantiation) (*Project, error)
+}
+
+// OpportunityInstantiator creates a project from each template for the
+// products of a won opportunity.
+type OpportunityInstantiator interface {
+	InstantiateForOpportunity(ctx context.Context, opportunity customers.Opportunity) ([]*Project, error)
+}
+
+type templateService struct {
+	repo      TemplateRepository
+	customers customers.CustomerRetriever
+	now       func() time.Time
+}
+
+func NewTemplateService(repo TemplateRepository, customers customers.CustomerRetriever) TemplateService {
+	return &templateService{repo: repo, customers: customers, now: time.Now}
+}
+
+func (s *templateService) GetTemplateByID(ctx context.Context, id uuid.UUID) (*ProjectTemplate, error) {
+	return s.repo.GetTemplateByID(ctx, id)
+}
+
+func (s *templateService) ListTemplates(ctx context.Context, product customers.OpportunityProduct) ([]*ProjectTemplate, error) {
+	return s.repo.ListTemplates(ctx, product)
+}
+
+func (s *templateService) CreateTemplate(ctx context.Context, template ProjectTemplate) (*ProjectTemplate, error) {
+	if err := validateTemplate(&template); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateTemplate(ctx, template)
+}
+
+func (s *templateService) UpdateTemplate(ctx context.Context, template ProjectTemplate) (*ProjectTemplate, error) {
+	if _, err := s.repo.GetTemplateByID(ctx, template.ID); err != nil {
+		return nil, err
+	}
+	if err := validateTemplate(&template); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateTemplate(ctx, template)
+}
+
+func (s *templateService) DeleteTemplate(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteTemplate(ctx, id)
+}
+
+// InstantiateTemplate creates a planning project for the customer, in the
+// customer's currency, with the template's tasks and milestones dated from
+// the start.
+func (s *templateService) InstantiateTemplate(ctx context.Context, templateID uuid.UUID, request TemplateInstantiation) (*Project, error) {
+	template, err := s.repo.GetTemplateByID(ctx, templateID)
+	if err != nil {
+		return nil, err
+	}
+	customer, err := s.customers.GetCustomerByID(ctx, request.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	if customer.ID == uuid.Nil {
+		return nil, ErrCustomerNotFound
+	}
+	if request.StartDate == nil {
+		today := s.now()
+		request.StartDate = &today
+	}
+	request.StartDate = dateOnly(request.StartDate)
+	request.Name = strings.TrimSpace(request.Name)
+
+	project, tasks, milestones := template.plan(request)
+	if err := normalizeProject(&project, customer.Currency); err != nil {
+		return nil, err
+	}
+	for i := range tasks {
+		if err := normalizeTask(&tasks[i]); err != nil {
+			return nil, err
+		}
+	}
+	for i := range milestones {
+		milestones[i].Amount = core.Zero(project.Currency)
+	}
+	return s.repo.CreateProjectFromPlan(ctx, project, tasks, milestones)
+}
+
+// InstantiateForOpportunity starts today a project from every template for
+// one of the opportunity's products, skipping templates already used for
+// it. It carries on past a failing template and returns the errors joined.
+func (s *templateService) InstantiateForOpportunity(ctx context.Context, opportunity customers.Opportunity) ([]*Project, error) {
+	var created []*Project
+	var errs []error
+	seen := make(map[uuid.UUID]bool)
+	for _, product := range opportunity.Products {
+		templates, err := s.repo.ListTemplates(ctx, product)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, template := range templates {
+			if seen[template.ID] {
+				continue
+			}
+			seen[template.ID] = true
+			request := TemplateInstantiation{CustomerID: opportunity.CustomerID, OpportunityID: &opportunity.ID}
+			if opportunity.Name != "" {
+				request.Name = fmt.Sprintf("%s: %s", template.Name, opportunity.Name)
+			}
+			project, err := s.InstantiateTemplate(ctx, template.ID, request)
+			if errors.Is(err, ErrAlreadyInstantiated) {
+				continue
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("template %s: %w", template.ID, err))
+				continue
+			}
+			created = append(created, project)
+		}
+	}
+	return created, errors.Join(errs...)
+}
+
+// OnOpportunityWon instantiates templates for opportunities as they are
+// won. Subscribe it to customers.OpportunityWonEvent.
+func OnOpportunityWon(service OpportunityInstantiator) core.EventHandler {
+	return func(ctx context.Context, event core.Event) error {
+		won, ok := event.(customers.OpportunityWon)
+		if !ok {
+			return nil
+		}
+		_, err := service.InstantiateForOpportunity(ctx, won.Opportunity)
+		return err
+	}
+}
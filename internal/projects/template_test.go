@@ -0,0 +1,234 @@
+package projects
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rva_crm/internal/core"
+	"rva_crm/internal/customers"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockTemplateRepository struct {
+	mock.Mock
+}
+
+func (m *MockTemplateRepository) GetTemplateByID(ctx context.Context, id uuid.UUID) (*ProjectTemplate, error) {
+	args := m.Called(ctx, id)
+	template, _ := args.Get(0).(*ProjectTemplate)
+	return template, args.Error(1)
+}
+
+func (m *MockTemplateRepository) ListTemplates(ctx context.Context, product customers.OpportunityProduct) ([]*ProjectTemplate, error) {
+	args := m.Called(ctx, product)
+	templates, _ := args.Get(0).([]*ProjectTemplate)
+	return templates, args.Error(1)
+}
+
+func (m *MockTemplateRepository) CreateTemplate(ctx context.Context, template ProjectTemplate) (*ProjectTemplate, error) {
+	args := m.Called(ctx, template)
+	created, _ := args.Get(0).(*ProjectTemplate)
+	return created, args.Error(1)
+}
+
+func (m *MockTemplateRepository) UpdateTemplate(ctx context.Context, template ProjectTemplate) (*ProjectTemplate, error) {
+	args := m.Called(ctx, template)
+	updated, _ := args.Get(0).(*ProjectTemplate)
+	return updated, args.Error(1)
+}
+
+func (m *MockTemplateRepository) DeleteTemplate(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockTemplateRepository) CreateProjectFromPlan(ctx context.Context, project Project, tasks []ProjectTask, milestones []Milestone) (*Project, error) {
+	args := m.Called(ctx, project, tasks, milestones)
+	created, _ := args.Get(0).(*Project)
+	return created, args.Error(1)
+}
+
+func offset(days int) *int {
+	return &days
+}
+
+// formationTemplate files the articles after drafting them, with the
+// filing split into two subtasks.
+func formationTemplate() ProjectTemplate {
+	template := ProjectTemplate{
+		Name:          "Entity formation",
+		Product:       customers.OpportunityProductEntityFormation,
+		DurationDays:  14,
+		RoleAssignees: map[string]uuid.UUID{"paralegal": uuid.New(), "attorney": uuid.New()},
+		Tasks: []TemplateTask{
+			{Ref: "submit", ParentRef: "file", Title: "Submit to the state", DurationDays: 1, DependsOn: []string{"draft"}},
+			{Ref: "draft", Title: "Draft articles", DurationDays: 3, DueOffsetDays: offset(3), Roles: []string{"attorney", "paralegal"}},
+			{Ref: "file", Title: "File", Roles: []string{"paralegal"}},
+			{Ref: "confirm", ParentRef: "file", Title: "Confirm filing", DurationDays: 2, DependsOn: []string{"submit"}},
+		},
+		Milestones: []TemplateMilestone{{Title: "Entity formed", DueOffsetDays: 10, TaskRefs: []string{"confirm"}}},
+	}
+	template.ID = uuid.New()
+	return template
+}
+
+func TestValidateTemplate_ChecksReferencesAndCycles(t *testing.T) {
+	valid := formationTemplate()
+	assert.NoError(t, validateTemplate(&valid))
+	assert.Equal(t, PriorityMedium, valid.Tasks[0].Priority)
+
+	unknown := formationTemplate()
+	unknown.Tasks[0].DependsOn = []string{"sign"}
+	assert.ErrorIs(t, validateTemplate(&unknown), ErrInvalidTemplate)
+
+	milestone := formationTemplate()
+	milestone.Milestones[0].TaskRefs = []string{"sign"}
+	assert.ErrorIs(t, validateTemplate(&milestone), ErrInvalidTemplate)
+
+	nested := formationTemplate()
+	nested.Tasks[2].ParentRef = "confirm"
+	assert.ErrorIs(t, validateTemplate(&nested), ErrInvalidTemplate)
+
+	cyclic := formationTemplate()
+	cyclic.Tasks[1].DependsOn = []string{"confirm"}
+	assert.ErrorIs(t, validateTemplate(&cyclic), ErrDependencyCycle)
+}
+
+func TestPlan_DatesTasksAndAssignsRoles(t *testing.T) {
+	// Arrange
+	template := formationTemplate()
+	require.NoError(t, validateTemplate(&template))
+	attorney := uuid.New()
+
+	// Act
+	project, tasks, milestones := template.plan(TemplateInstantiation{
+		CustomerID:    uuid.New(),
+		StartDate:     date(2026, 7, 1),
+		RoleAssignees: map[string]uuid.UUID{"attorney": attorney},
+	})
+
+	// Assert
+	assert.Equal(t, "Entity formation", project.Name)
+	assert.Equal(t, date(2026, 7, 14), project.EndDate)
+	assert.Equal(t, &template.ID, project.TemplateID)
+	require.Len(t, tasks, 4)
+	titles := []string{tasks[0].Title, tasks[1].Title, tasks[2].Title, tasks[3].Title}
+	assert.Equal(t, []string{"Draft articles", "File", "Submit to the state", "Confirm filing"}, titles)
+
+	draft, file, submit, confirm := tasks[0], tasks[1], tasks[2], tasks[3]
+	assert.Equal(t, date(2026, 7, 4), draft.DueDate)
+	assert.Equal(t, []uuid.UUID{attorney, template.RoleAssignees["paralegal"]}, draft.AssigneeIDs)
+	assert.Equal(t, &file.ID, submit.ParentID)
+	assert.Equal(t, []uuid.UUID{draft.ID}, submit.DependsOn)
+	assert.Equal(t, []uuid.UUID{submit.ID}, confirm.DependsOn)
+	assert.Equal(t, 1, confirm.Position)
+	for _, task := range tasks {
+		assert.Equal(t, project.ID, task.ProjectID)
+	}
+	require.Len(t, milestones, 1)
+	assert.Equal(t, time.Date(2026, 7, 11, 0, 0, 0, 0, time.UTC), milestones[0].DueDate)
+	assert.Equal(t, []uuid.UUID{confirm.ID}, milestones[0].TaskIDs)
+}
+
+type TemplateServiceTestSuite struct {
+	suite.Suite
+	repo      *MockTemplateRepository
+	customers *MockCustomerRetriever
+	service   *templateService
+	template  ProjectTemplate
+}
+
+func (s *TemplateServiceTestSuite) SetupTest() {
+	s.repo = new(MockTemplateRepository)
+	s.customers = new(MockCustomerRetriever)
+	s.service = NewTemplateService(s.repo, s.customers).(*templateService)
+	s.service.now = func() time.Time { return time.Date(2026, 7, 1, 16, 0, 0, 0, time.UTC) }
+	s.template = formationTemplate()
+	s.Require().NoError(validateTemplate(&s.template))
+}
+
+func (s *TemplateServiceTestSuite) TearDownTest() {
+	s.repo.AssertExpectations(s.T())
+	s.customers.AssertExpectations(s.T())
+}
+
+func TestTemplateServiceSuite(t *testing.T) {
+	suite.Run(t, new(TemplateServiceTestSuite))
+}
+
+func (s *TemplateServiceTestSuite) TestInstantiateTemplate_StartsTodayInCustomerCurrency() {
+	// Arrange
+	ctx := context.Background()
+	customerID := uuid.New()
+	s.repo.On("GetTemplateByID", ctx, s.template.ID).Return(&s.template, nil)
+	s.customers.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{BaseModel: core.BaseModel{ID: customerID}, Currency: core.EUR}, nil)
+	s.repo.On("CreateProjectFromPlan", ctx, mock.MatchedBy(func(p Project) bool {
+		return p.CustomerID == customerID && p.Currency == core.EUR && p.Status == ProjectStatusPlanning && p.StartDate.Equal(*date(2026, 7, 1))
+	}), mock.MatchedBy(func(tasks []ProjectTask) bool {
+		return len(tasks) == 4 && tasks[0].Status == TaskStatusTodo
+	}), mock.MatchedBy(func(milestones []Milestone) bool {
+		return len(milestones) == 1 && milestones[0].Amount == core.Zero(core.EUR)
+	})).Return(&Project{}, nil)
+
+	// Act
+	_, err := s.service.InstantiateTemplate(ctx, s.template.ID, TemplateInstantiation{CustomerID: customerID})
+
+	// Assert
+	s.NoError(err)
+}
+
+func (s *TemplateServiceTestSuite) TestInstantiateTemplate_RequiresExistingCustomer() {
+	// Arrange
+	ctx := context.Background()
+	customerID := uuid.New()
+	s.repo.On("GetTemplateByID", ctx, s.template.ID).Return(&s.template, nil)
+	s.customers.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{}, nil)
+
+	// Act
+	_, err := s.service.InstantiateTemplate(ctx, s.template.ID, TemplateInstantiation{CustomerID: customerID})
+
+	// Assert
+	s.ErrorIs(err, ErrCustomerNotFound)
+}
+
+func (s *TemplateServiceTestSuite) TestOnOpportunityWon_InstantiatesMatchingTemplatesOnce() {
+	// Arrange
+	ctx := context.Background()
+	customerID := uuid.New()
+	opportunity := customers.Opportunity{
+		CustomerID: customerID,
+		Name:       "Acme LLC",
+		Stage:      customers.StageClosed,
+		Products:   []customers.OpportunityProduct{customers.OpportunityProductEntityFormation, customers.OpportunityProductTaxStrategy},
+	}
+	opportunity.ID = uuid.New()
+	tax := ProjectTemplate{Name: "Tax strategy"}
+	tax.ID = uuid.New()
+
+	s.repo.On("ListTemplates", ctx, customers.OpportunityProductEntityFormation).Return([]*ProjectTemplate{&s.template}, nil)
+	s.repo.On("ListTemplates", ctx, customers.OpportunityProductTaxStrategy).Return([]*ProjectTemplate{&tax}, nil)
+	s.repo.On("GetTemplateByID", ctx, s.template.ID).Return(&s.template, nil)
+	s.repo.On("GetTemplateByID", ctx, tax.ID).Return(&tax, nil)
+	s.customers.On("GetCustomerByID", ctx, customerID).Return(customers.Customer{BaseModel: core.BaseModel{ID: customerID}}, nil)
+	s.repo.On("CreateProjectFromPlan", ctx, mock.MatchedBy(func(p Project) bool {
+		return *p.TemplateID == s.template.ID && *p.OpportunityID == opportunity.ID && p.Name == "Entity formation: Acme LLC"
+	}), mock.Anything, mock.Anything).Return(&Project{}, nil).Once()
+	s.repo.On("CreateProjectFromPlan", ctx, mock.MatchedBy(func(p Project) bool {
+		return *p.TemplateID == tax.ID
+	}), mock.Anything, mock.Anything).Return(nil, ErrAlreadyInstantiated).Once()
+
+	bus := core.NewEventBus()
+	bus.Subscribe(customers.OpportunityWonEvent, OnOpportunityWon(s.service))
+
+	// Act
+	err := bus.Publish(ctx, customers.OpportunityWon{Opportunity: opportunity})
+
+	// Assert
+	s.NoError(err)
+}
@@ -0,0 +1,144 @@
+package projects
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTimeEntryNotFound          = errors.New("time entry not found")
+	ErrInvalidTimeEntry           = errors.New("invalid time entry")
+	ErrTimeEntryInvoiced          = errors.New("time entry has been invoiced")
+	ErrTimerRunning               = errors.New("a timer is already running")
+	ErrNoRunningTimer             = errors.New("no timer is running")
+	ErrTimesheetLocked            = errors.New("timesheet is submitted or approved")
+	ErrInvalidTimesheetTransition = errors.New("timesheet status transition is not allowed")
+	ErrNoBillableTime             = errors.New("no approved billable time to invoice")
+)
+
+// maxEntryMinutes caps a single entry at a day.
+const maxEntryMinutes = 24 * 60
+
+// TimeEntry is time a user spent on a project. It is logged either as a
+// start and end, or as a number of minutes on a date; an entry with a start
+// and no end is the user's running timer.
+type TimeEntry struct {
+	core.BaseModel
+	UserID    uuid.UUID  `json:"user_id"`
+	ProjectID uuid.UUID  `json:"project_id"`
+	TaskID    *uuid.UUID `json:"task_id"`
+
+	// Timing. Date is the day worked, which places the entry on a timesheet.
+	Date      time.Time  `json:"date"`
+	StartedAt *time.Time `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	Minutes   int        `json:"minutes"`
+
+	// Value, in the project's currency: Rate per hour and Amount for the
+	// minutes logged. Only billable entries are invoiced.
+	Billable bool       `json:"billable"`
+	Rate     core.Money `json:"rate"`
+	Amount   core.Money `json:"amount"`
+
+	Notes     string     `json:"notes"`
+	InvoiceID *uuid.UUID `json:"invoice_id"` // The draft invoice the entry was billed on
+}
+
+// Running reports whether the entry is a timer that has not been stopped.
+func (e TimeEntry) Running() bool {
+	return e.StartedAt != nil && e.EndedAt == nil
+}
+
+// Hours is the logged time in hours.
+func (e TimeEntry) Hours() float64 {
+	return float64(e.Minutes) / 60
+}
+
+// price sets the entry's amount from its rate and minutes, rounding half up
+// to the minor unit.
+func (e *TimeEntry) price() error {
+	amount, err := e.Rate.Mul(big.NewRat(int64(e.Minutes), 60), core.RoundHalfUp)
+	if err != nil {
+		return fmt.Errorf("failed to price time entry: %w", err)
+	}
+	e.Amount = amount
+	return nil
+}
+
+// TimeEntryFilter narrows a time entry listing. Zero fields do not filter;
+// From and To are inclusive dates.
+type TimeEntryFilter struct {
+	UserID    *uuid.UUID `json:"user_id"`
+	ProjectID *uuid.UUID `json:"project_id"`
+	From      *time.Time `json:"from"`
+	To        *time.Time `json:"to"`
+}
+
+// Timesheet is a user's time for a week, Monday to Sunday. Its entries can
+// be changed while it is open; once submitted they wait for approval, and
+// only approved billable time is invoiced. A rejected timesheet goes back to
+// open.
+type Timesheet struct {
+	core.BaseModel
+	UserID       uuid.UUID       `json:"user_id"`
+	WeekStart    time.Time       `json:"week_start"`
+	Status       TimesheetStatus `json:"status"`
+	SubmittedAt  *time.Time      `json:"submitted_at"`
+	ApprovedAt   *time.Time      `json:"approved_at"`
+	ApprovedByID *uuid.UUID      `json:"approved_by_id"`
+
+	// Computed from the week's entries
+	Entries         []*TimeEntry `json:"entries"`
+	TotalMinutes    int          `json:"total_minutes"`
+	BillableMinutes int          `json:"billable_minutes"`
+}
+
+type TimesheetStatus string
+
+const (
+	TimesheetStatusOpen      TimesheetStatus = "open"
+	TimesheetStatusSubmitted TimesheetStatus = "submitted"
+	TimesheetStatusApproved  TimesheetStatus = "approved"
+)
+
+// timesheetTransitions lists the statuses each status may move to. Approval
+// is final.
+var timesheetTransitions = map[TimesheetStatus][]TimesheetStatus{
+	TimesheetStatusOpen:      {TimesheetStatusSubmitted},
+	TimesheetStatusSubmitted: {TimesheetStatusApproved, TimesheetStatusOpen},
+}
+
+// CanTransitionTo reports whether the timesheet flow allows moving from s
+// to next.
+func (s TimesheetStatus) CanTransitionTo(next TimesheetStatus) bool {
+	for _, allowed := range timesheetTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// weekStart returns the Monday of the week containing t, as a date.
+func weekStart(t time.Time) time.Time {
+	day := *dateOnly(&t)
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// total adds up the entries' minutes.
+func (t *Timesheet) total() {
+	t.TotalMinutes, t.BillableMinutes = 0, 0
+	for _, entry := range t.Entries {
+		t.TotalMinutes += entry.Minutes
+		if entry.Billable {
+			t.BillableMinutes += entry.Minutes
+		}
+	}
+}
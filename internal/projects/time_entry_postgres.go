@@ -0,0 +1,253 @@
+package projects
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+type timeEntryRepository struct {
+	db *sql.DB
+}
+
+func NewTimeEntryRepository(db *sql.DB) TimeEntryRepository {
+	return &timeEntryRepository{db: db}
+}
+
+const timeEntryColumns = "e.id, e.user_id, e.project_id, e.task_id, e.work_date, e.started_at, e.ended_at, e.minutes, e.billable, e.rate, e.amount, p.currency, e.notes, e.invoice_id, e.created_at, e.updated_at"
+
+const timeEntryFrom = " FROM time_entries e JOIN projects p ON p.id = e.project_id"
+
+const timesheetColumns = "id, user_id, week_start, status, submitted_at, approved_at, approved_by_id, created_at, updated_at"
+
+// unbilled holds while a time entry or expense is neither invoiced nor
+// claimed for an invoice being raised.
+const unbilled = "invoice_id IS NULL AND billing_claim IS NULL"
+
+// openWeek holds while the user's timesheet for the week of date is open,
+// which it is until a row says otherwise. Writes check it in the same
+// statement, so time cannot change on a week submitted or approved
+// concurrently.
+func openWeek(user, date string) string {
+	return "NOT EXISTS (SELECT 1 FROM timesheets t WHERE t.user_id = " + user + " AND t.week_start = date_trunc('week', " + date + ")::date AND t.status <> 'open')"
+}
+
+func scanTimeEntry(row rowScanner) (*TimeEntry, error) {
+	var entry TimeEntry
+	var currency core.Currency
+	err := row.Scan(&entry.ID, &entry.UserID, &entry.ProjectID, &entry.TaskID, &entry.Date, &entry.StartedAt, &entry.EndedAt, &entry.Minutes, &entry.Billable, &entry.Rate, &entry.Amount, &currency, &entry.Notes, &entry.InvoiceID, &entry.CreatedAt, &entry.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTimeEntryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The rate and amount were scanned before their currency was known.
+	if entry.Rate, err = entry.Rate.Reread(currency); err != nil {
+		return nil, err
+	}
+	if entry.Amount, err = entry.Amount.Reread(currency); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func scanTimeEntries(rows *sql.Rows) ([]*TimeEntry, error) {
+	defer rows.Close()
+	var entries []*TimeEntry
+	for rows.Next() {
+		entry, err := scanTimeEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (r *timeEntryRepository) GetTimeEntryByID(ctx context.Context, id uuid.UUID) (*TimeEntry, error) {
+	return scanTimeEntry(r.db.QueryRowContext(ctx, "SELECT "+timeEntryColumns+timeEntryFrom+" WHERE e.id = $1", id))
+}
+
+func (r *timeEntryRepository) ListTimeEntries(ctx context.Context, filter TimeEntryFilter) ([]*TimeEntry, error) {
+	var conditions []string
+	var args []any
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", fmt.Sprintf("$%d", len(args))))
+	}
+	if filter.UserID != nil {
+		where("e.user_id = ?", *filter.UserID)
+	}
+	if filter.ProjectID != nil {
+		where("e.project_id = ?", *filter.ProjectID)
+	}
+	if filter.From != nil {
+		where("e.work_date >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		where("e.work_date <= ?", *filter.To)
+	}
+
+	query := "SELECT " + timeEntryColumns + timeEntryFrom
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	rows, err := r.db.QueryContext(ctx, query+" ORDER BY e.work_date, e.started_at NULLS LAST, e.created_at, e.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanTimeEntries(rows)
+}
+
+func (r *timeEntryRepository) GetRunningTimer(ctx context.Context, userID uuid.UUID) (*TimeEntry, error) {
+	entry, err := scanTimeEntry(r.db.QueryRowContext(ctx, "SELECT "+timeEntryColumns+timeEntryFrom+" WHERE e.user_id = $1 AND e.started_at IS NOT NULL AND e.ended_at IS NULL", userID))
+	if errors.Is(err, ErrTimeEntryNotFound) {
+		return nil, ErrNoRunningTimer
+	}
+	return entry, err
+}
+
+// CreateTimeEntry inserts entry unless its week is submitted or approved, in
+// which case it returns ErrTimesheetLocked.
+func (r *timeEntryRepository) CreateTimeEntry(ctx context.Context, entry TimeEntry) (*TimeEntry, error) {
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	return r.saveTimeEntry(ctx, entry, "INSERT INTO time_entries (id, user_id, project_id, task_id, work_date, started_at, ended_at, minutes, billable, rate, amount, notes) SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12 WHERE "+openWeek("$2", "$5::date"))
+}
+
+// UpdateTimeEntry changes an entry that is not billed, returning
+// ErrTimeEntryInvoiced otherwise, and ErrTimesheetLocked unless both the week
+// it is on and the week it moves to are open. The user and project stay as
+// they are.
+func (r *timeEntryRepository) UpdateTimeEntry(ctx context.Context, entry TimeEntry) (*TimeEntry, error) {
+	return r.saveTimeEntry(ctx, entry, "UPDATE time_entries SET task_id = $4, work_date = $5, started_at = $6, ended_at = $7, minutes = $8, billable = $9, rate = $10, amount = $11, notes = $12, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND project_id = $3 AND "+unbilled+" AND "+openWeek("$2", "time_entries.work_date")+" AND "+openWeek("$2", "$5::date"))
+}
+
+func (r *timeEntryRepository) saveTimeEntry(ctx context.Context, entry TimeEntry, query string) (*TimeEntry, error) {
+	result, err := r.db.ExecContext(ctx, query,
+		entry.ID, entry.UserID, entry.ProjectID, entry.TaskID, entry.Date, entry.StartedAt, entry.EndedAt, entry.Minutes, entry.Billable, entry.Rate, entry.Amount, entry.Notes)
+	if err != nil {
+		return nil, err
+	}
+	if count, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if count == 0 {
+		return nil, r.unsavedReason(ctx, entry.ID, entry.UserID, &entry.Date)
+	}
+	return r.GetTimeEntryByID(ctx, entry.ID)
+}
+
+// DeleteTimeEntry deletes an entry that is not billed and on an open week,
+// returning ErrTimeEntryInvoiced or ErrTimesheetLocked otherwise.
+func (r *timeEntryRepository) DeleteTimeEntry(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM time_entries WHERE id = $1 AND "+unbilled+" AND "+openWeek("time_entries.user_id", "time_entries.work_date"), id)
+	if err != nil {
+		return err
+	}
+	if count, err := result.RowsAffected(); err != nil {
+		return err
+	} else if count == 0 {
+		var userID uuid.UUID
+		if err := r.db.QueryRowContext(ctx, "SELECT user_id FROM time_entries WHERE id = $1", id).Scan(&userID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return r.unsavedReason(ctx, id, userID, nil)
+	}
+	return nil
+}
+
+// unsavedReason tells why a guarded write to entry id matched no row:
+// ErrTimesheetLocked if the week the entry is on, or the week of date, is
+// submitted or approved, and ErrTimeEntryInvoiced otherwise.
+func (r *timeEntryRepository) unsavedReason(ctx context.Context, id, userID uuid.UUID, date *time.Time) error {
+	var locked bool
+	err := r.db.QueryRowContext(ctx, "SELECT NOT "+openWeek("$1", "$2::date")+" OR EXISTS (SELECT 1 FROM time_entries e WHERE e.id = $3 AND NOT "+openWeek("$1", "e.work_date")+")", userID, date, id).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return ErrTimesheetLocked
+	}
+	return ErrTimeEntryInvoiced
+}
+
+func scanTimesheet(row rowScanner) (*Timesheet, error) {
+	var timesheet Timesheet
+	err := row.Scan(&timesheet.ID, &timesheet.UserID, &timesheet.WeekStart, &timesheet.Status, &timesheet.SubmittedAt, &timesheet.ApprovedAt, &timesheet.ApprovedByID, &timesheet.CreatedAt, &timesheet.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &timesheet, nil
+}
+
+// GetTimesheet returns the user's timesheet for the week with its entries.
+// A week that was never submitted has an open timesheet that is not stored.
+func (r *timeEntryRepository) GetTimesheet(ctx context.Context, userID uuid.UUID, weekStart time.Time) (*Timesheet, error) {
+	timesheet, err := scanTimesheet(r.db.QueryRowContext(ctx, "SELECT "+timesheetColumns+" FROM timesheets WHERE user_id = $1 AND week_start = $2", userID, weekStart))
+	if errors.Is(err, sql.ErrNoRows) {
+		timesheet, err = &Timesheet{UserID: userID, WeekStart: weekStart, Status: TimesheetStatusOpen}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	weekEnd := weekStart.AddDate(0, 0, 6)
+	timesheet.Entries, err = r.ListTimeEntries(ctx, TimeEntryFilter{UserID: &userID, From: &weekStart, To: &weekEnd})
+	if err != nil {
+		return nil, err
+	}
+	return timesheet, nil
+}
+
+// SetTimesheetStatus stores the timesheet's status and dates provided it is
+// still in the from status, returning ErrInvalidTimesheetTransition
+// otherwise. The entries are not returned.
+func (r *timeEntryRepository) SetTimesheetStatus(ctx context.Context, timesheet Timesheet, from TimesheetStatus) (*Timesheet, error) {
+	if timesheet.ID == uuid.Nil {
+		timesheet.ID = uuid.New()
+	}
+	saved, err := scanTimesheet(r.db.QueryRowContext(ctx, `INSERT INTO timesheets (id, user_id, week_start, status, submitted_at, approved_at, approved_by_id) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id, week_start) DO UPDATE SET status = EXCLUDED.status, submitted_at = EXCLUDED.submitted_at, approved_at = EXCLUDED.approved_at, approved_by_id = EXCLUDED.approved_by_id, updated_at = CURRENT_TIMESTAMP
+		WHERE timesheets.status = $8 RETURNING `+timesheetColumns,
+		timesheet.ID, timesheet.UserID, timesheet.WeekStart, timesheet.Status, timesheet.SubmittedAt, timesheet.ApprovedAt, timesheet.ApprovedByID, from))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidTimesheetTransition
+	}
+	return saved, err
+}
+
+// ClaimBillableTime marks the project's unbilled billable time on approved
+// timesheets with the claim and returns it. A concurrent claim skips the
+// entries claimed here, so no entry is billed twice.
+func (r *timeEntryRepository) ClaimBillableTime(ctx context.Context, projectID uuid.UUID, claim uuid.UUID) ([]*TimeEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `UPDATE time_entries e SET billing_claim = $2, updated_at = CURRENT_TIMESTAMP
+		FROM projects p, timesheets t
+		WHERE p.id = e.project_id AND e.project_id = $1 AND e.billable AND e.amount > 0 AND e.invoice_id IS NULL AND e.billing_claim IS NULL
+		AND t.user_id = e.user_id AND t.week_start = date_trunc('week', e.work_date)::date AND t.status = 'approved'
+		RETURNING `+timeEntryColumns, projectID, claim)
+	if err != nil {
+		return nil, err
+	}
+	return scanTimeEntries(rows)
+}
+
+// AttachClaimToInvoice records the invoice the claimed entries were billed
+// on and lets go of the claim.
+func (r *timeEntryRepository) AttachClaimToInvoice(ctx context.Context, claim uuid.UUID, invoiceID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE time_entries SET invoice_id = $2, billing_claim = NULL, updated_at = CURRENT_TIMESTAMP WHERE billing_claim = $1", claim, invoiceID)
+	return err
+}
+
+// ReleaseBillingClaim returns the claimed entries to unbilled.
+func (r *timeEntryRepository) ReleaseBillingClaim(ctx context.Context, claim uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE time_entries SET billing_claim = NULL, updated_at = CURRENT_TIMESTAMP WHERE billing_claim = $1", claim)
+	return err
+}
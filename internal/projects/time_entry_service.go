@@ -0,0 +1,455 @@
+package projects
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"rva_crm/internal/billing"
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+)
+
+type TimeEntryService interface {
+	TimeEntryManager
+	TimerManager
+	TimesheetManager
+	TimeInvoicer
+	CostSource
+}
+
+type TimeEntryRepository interface {
+	TimeEntryManager
+	RunningTimerRetriever
+	TimesheetRetriever
+	TimesheetStatusSetter
+	TimeBillingClaimer
+}
+
+type TimeEntryManager interface {
+	TimeEntryReader
+	TimeEntryWriter
+}
+
+type TimeEntryReader interface {
+	TimeEntryRetriever
+	TimeEntryLister
+}
+
+type TimeEntryWriter interface {
+	TimeEntryCreator
+	TimeEntryUpdater
+	TimeEntryDeleter
+}
+
+type TimeEntryRetriever interface {
+	GetTimeEntryByID(ctx context.Context, id uuid.UUID) (*TimeEntry, error)
+}
+
+// TimeEntryLister returns entries matching the filter, by date.
+type TimeEntryLister interface {
+	ListTimeEntries(ctx context.Context, filter TimeEntryFilter) ([]*TimeEntry, error)
+}
+
+// TimeEntryCreator logs an entry on a week that is open, checked as it
+// writes.
+type TimeEntryCreator interface {
+	CreateTimeEntry(ctx context.Context, entry TimeEntry) (*TimeEntry, error)
+}
+
+// TimeEntryUpdater changes an entry that is not yet invoiced, on and to a
+// week that is open.
+type TimeEntryUpdater interface {
+	UpdateTimeEntry(ctx context.Context, entry TimeEntry) (*TimeEntry, error)
+}
+
+// TimeEntryDeleter deletes an entry that is not yet invoiced, on a week
+// that is open.
+type TimeEntryDeleter interface {
+	DeleteTimeEntry(ctx context.Context, id uuid.UUID) error
+}
+
+// RunningTimerRetriever returns the user's running timer, or
+// ErrNoRunningTimer.
+type RunningTimerRetriever interface {
+	GetRunningTimer(ctx context.Context, userID uuid.UUID) (*TimeEntry, error)
+}
+
+// TimerManager runs at most one timer per user. StartTimer takes the
+// project, task, billing and notes from the entry; StopTimer logs the time
+// since it started, up to a day for a timer left running.
+type TimerManager interface {
+	RunningTimerRetriever
+	StartTimer(ctx context.Context, entry TimeEntry) (*TimeEntry, error)
+	StopTimer(ctx context.Context, userID uuid.UUID) (*TimeEntry, error)
+}
+
+// TimesheetRetriever returns the user's timesheet for the week starting on
+// the given Monday.
+type TimesheetRetriever interface {
+	GetTimesheet(ctx context.Context, userID uuid.UUID, weekStart time.Time) (*Timesheet, error)
+}
+
+type TimesheetStatusSetter interface {
+	SetTimesheetStatus(ctx context.Context, timesheet Timesheet, from TimesheetStatus) (*Timesheet, error)
+}
+
+// TimesheetManager moves timesheets through submission and approval. The
+// week may be given by any of its days.
+type TimesheetManager interface {
+	TimesheetRetriever
+	SubmitTimesheet(ctx context.Context, userID uuid.UUID, week time.Time) (*Timesheet, error)
+	ApproveTimesheet(ctx context.Context, userID uuid.UUID, week time.Time, approverID uuid.UUID) (*Timesheet, error)
+	RejectTimesheet(ctx context.Context, userID uuid.UUID, week time.Time) (*Timesheet, error)
+}
+
+// TimeBillingClaimer claims unbilled time for an invoice being raised, so
+// that it is billed once. The claim is either attached to the invoice or
+// released.
+type TimeBillingClaimer interface {
+	ClaimBillableTime(ctx context.Context, projectID uuid.UUID, claim uuid.UUID) ([]*TimeEntry, error)
+	AttachClaimToInvoice(ctx context.Context, claim uuid.UUID, invoiceID uuid.UUID) error
+	ReleaseBillingClaim(ctx context.Context, claim uuid.UUID) error
+}
+
+// TimeInvoicer raises a draft invoice for the project's approved billable
+// time that has not been invoiced.
+type TimeInvoicer interface {
+	InvoiceProjectTime(ctx context.Context, projectID uuid.UUID) (*billing.Invoice, error)
+}
+
+type timeEntryService struct {
+	repo     TimeEntryRepository
+	projects ProjectRetriever
+	tasks    TaskRetriever
+	invoices billing.InvoiceCreator
+	now      func() time.Time
+}
+
+// NewTimeEntryService raises draft invoices for approved billable time
+// through invoices.
+func NewTimeEntryService(repo TimeEntryRepository, projects ProjectRetriever, tasks TaskRetriever, invoices billing.InvoiceCreator) TimeEntryService {
+	return &timeEntryService{repo: repo, projects: projects, tasks: tasks, invoices: invoices, now: time.Now}
+}
+
+func (s *timeEntryService) GetTimeEntryByID(ctx context.Context, id uuid.UUID) (*TimeEntry, error) {
+	return s.repo.GetTimeEntryByID(ctx, id)
+}
+
+func (s *timeEntryService) ListTimeEntries(ctx context.Context, filter TimeEntryFilter) ([]*TimeEntry, error) {
+	filter.From, filter.To = dateOnly(filter.From), dateOnly(filter.To)
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return nil, fmt.Errorf("%w: the range ends before it starts", ErrInvalidTimeEntry)
+	}
+	return s.repo.ListTimeEntries(ctx, filter)
+}
+
+// CreateTimeEntry logs finished time on an open timesheet. Timers are
+// started with StartTimer.
+func (s *timeEntryService) CreateTimeEntry(ctx context.Context, entry TimeEntry) (*TimeEntry, error) {
+	if err := s.normalizeTimeEntry(ctx, &entry); err != nil {
+		return nil, err
+	}
+	if err := s.requireOpenWeek(ctx, entry.UserID, entry.Date); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateTimeEntry(ctx, entry)
+}
+
+// UpdateTimeEntry changes an unbilled entry, keeping its user and project.
+// Both the week it was on and the week it moves to must be open.
+func (s *timeEntryService) UpdateTimeEntry(ctx context.Context, entry TimeEntry) (*TimeEntry, error) {
+	existing, err := s.repo.GetTimeEntryByID(ctx, entry.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.InvoiceID != nil {
+		return nil, ErrTimeEntryInvoiced
+	}
+	if existing.Running() {
+		return nil, fmt.Errorf("%w: stop the timer before changing it", ErrInvalidTimeEntry)
+	}
+	entry.UserID, entry.ProjectID = existing.UserID, existing.ProjectID
+	if err := s.normalizeTimeEntry(ctx, &entry); err != nil {
+		return nil, err
+	}
+	if err := s.requireOpenWeek(ctx, existing.UserID, existing.Date); err != nil {
+		return nil, err
+	}
+	if err := s.requireOpenWeek(ctx, entry.UserID, entry.Date); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateTimeEntry(ctx, entry)
+}
+
+// DeleteTimeEntry deletes an unbilled entry on an open timesheet, which
+// also discards a running timer.
+func (s *timeEntryService) DeleteTimeEntry(ctx context.Context, id uuid.UUID) error {
+	existing, err := s.repo.GetTimeEntryByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if existing.InvoiceID != nil {
+		return ErrTimeEntryInvoiced
+	}
+	if err := s.requireOpenWeek(ctx, existing.UserID, existing.Date); err != nil {
+		return err
+	}
+	return s.repo.DeleteTimeEntry(ctx, id)
+}
+
+func (s *timeEntryService) GetRunningTimer(ctx context.Context, userID uuid.UUID) (*TimeEntry, error) {
+	return s.repo.GetRunningTimer(ctx, userID)
+}
+
+func (s *timeEntryService) StartTimer(ctx context.Context, entry TimeEntry) (*TimeEntry, error) {
+	running, err := s.repo.GetRunningTimer(ctx, entry.UserID)
+	if err != nil && !errors.Is(err, ErrNoRunningTimer) {
+		return nil, err
+	}
+	if running != nil {
+		return nil, fmt.Errorf("%w: on project %s since %s", ErrTimerRunning, running.ProjectID, running.StartedAt.Format(time.RFC3339))
+	}
+	now := s.now().Truncate(time.Second)
+	entry.StartedAt, entry.EndedAt = &now, nil
+	if err := s.normalizeTimeEntry(ctx, &entry); err != nil {
+		return nil, err
+	}
+	if err := s.requireOpenWeek(ctx, entry.UserID, entry.Date); err != nil {
+		return nil, err
+	}
+	return s.repo.CreateTimeEntry(ctx, entry)
+}
+
+func (s *timeEntryService) StopTimer(ctx context.Context, userID uuid.UUID) (*TimeEntry, error) {
+	entry, err := s.repo.GetRunningTimer(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// A timer forgotten overnight stops a day after it started, so it can
+	// still be stopped and then corrected like any other entry.
+	end := s.now().Truncate(time.Second)
+	if latest := entry.StartedAt.Add(maxEntryMinutes * time.Minute); end.After(latest) {
+		end = latest
+	}
+	entry.EndedAt = &end
+	if err := s.normalizeTimeEntry(ctx, entry); err != nil {
+		return nil, err
+	}
+	return s.repo.UpdateTimeEntry(ctx, *entry)
+}
+
+func (s *timeEntryService) GetTimesheet(ctx context.Context, userID uuid.UUID, week time.Time) (*Timesheet, error) {
+	timesheet, err := s.repo.GetTimesheet(ctx, userID, weekStart(week))
+	if err != nil {
+		return nil, err
+	}
+	timesheet.total()
+	return timesheet, nil
+}
+
+// SubmitTimesheet sends the week for approval, after which its entries are
+// locked. A week with a timer still running cannot be submitted.
+func (s *timeEntryService) SubmitTimesheet(ctx context.Context, userID uuid.UUID, week time.Time) (*Timesheet, error) {
+	return s.transition(ctx, userID, week, TimesheetStatusSubmitted, func(timesheet *Timesheet) error {
+		for _, entry := range timesheet.Entries {
+			if entry.Running() {
+				return fmt.Errorf("%w: stop the running timer first", ErrInvalidTimesheetTransition)
+			}
+		}
+		now := s.now()
+		timesheet.SubmittedAt = &now
+		return nil
+	})
+}
+
+// ApproveTimesheet approves a submitted week on behalf of approverID, who
+// may not be the timesheet's own user. Its billable time can then be
+// invoiced.
+func (s *timeEntryService) ApproveTimesheet(ctx context.Context, userID uuid.UUID, week time.Time, approverID uuid.UUID) (*Timesheet, error) {
+	return s.transition(ctx, userID, week, TimesheetStatusApproved, func(timesheet *Timesheet) error {
+		if approverID == uuid.Nil {
+			return fmt.Errorf("%w: an approver is required", ErrInvalidTimesheetTransition)
+		}
+		if approverID == userID {
+			return fmt.Errorf("%w: users cannot approve their own timesheets", ErrInvalidTimesheetTransition)
+		}
+		now := s.now()
+		timesheet.ApprovedAt, timesheet.ApprovedByID = &now, &approverID
+		return nil
+	})
+}
+
+// RejectTimesheet reopens a submitted week for changes.
+func (s *timeEntryService) RejectTimesheet(ctx context.Context, userID uuid.UUID, week time.Time) (*Timesheet, error) {
+	return s.transition(ctx, userID, week, TimesheetStatusOpen, func(timesheet *Timesheet) error {
+		timesheet.SubmittedAt = nil
+		return nil
+	})
+}
+
+// transition moves the week's timesheet to next once prepare has checked it
+// and set its dates.
+func (s *timeEntryService) transition(ctx context.Context, userID uuid.UUID, week time.Time, next TimesheetStatus, prepare func(*Timesheet) error) (*Timesheet, error) {
+	timesheet, err := s.repo.GetTimesheet(ctx, userID, weekStart(week))
+	if err != nil {
+		return nil, err
+	}
+	from := timesheet.Status
+	if !from.CanTransitionTo(next) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTimesheetTransition, from, next)
+	}
+	if err := prepare(timesheet); err != nil {
+		return nil, err
+	}
+	timesheet.Status = next
+	saved, err := s.repo.SetTimesheetStatus(ctx, *timesheet, from)
+	if err != nil {
+		return nil, err
+	}
+	saved.Entries = timesheet.Entries
+	saved.total()
+	return saved, nil
+}
+
+// InvoiceProjectTime claims the project's approved billable time, raises a
+// draft invoice for the customer with a line per entry and records the
+// invoice on the entries. Should invoicing fail the time is released to be
+// billed later; should recording fail it stays claimed, and the invoice is
+// returned along with the error.
+func (s *timeEntryService) InvoiceProjectTime(ctx context.Context, projectID uuid.UUID) (*billing.Invoice, error) {
+	project, err := s.projects.GetProjectByID(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	claim := uuid.New()
+	entries, err := s.repo.ClaimBillableTime(ctx, projectID, claim)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrNoBillableTime
+	}
+
+	items := make([]billing.InvoiceItem, 0, len(entries))
+	for _, entry := range entries {
+		description := fmt.Sprintf("%s: %.2f h at %s/h", entry.Date.Format(time.DateOnly), entry.Hours(), entry.Rate)
+		if entry.Notes != "" {
+			description += ", " + entry.Notes
+		}
+		items = append(items, billing.InvoiceItem{Description: description, Quantity: 1, UnitPrice: entry.Amount})
+	}
+	invoice, err := s.invoices.CreateInvoice(ctx, billing.Invoice{
+		CustomerID: project.CustomerID,
+		Notes:      "Project " + project.Name + " time",
+		Items:      items,
+	})
+	if err != nil {
+		if releaseErr := s.repo.ReleaseBillingClaim(ctx, claim); releaseErr != nil {
+			slog.ErrorContext(ctx, "failed to release time billing claim", "claim", claim, "error", releaseErr)
+		}
+		return nil, fmt.Errorf("failed to invoice time: %w", err)
+	}
+	if err := s.repo.AttachClaimToInvoice(ctx, claim, invoice.ID); err != nil {
+		return invoice, err
+	}
+	return invoice, nil
+}
+
+// GetProjectCosts reports the value of the time logged on the project, billable
+// or not, for the budget rollup.
+func (s *timeEntryService) GetProjectCosts(ctx context.Context, projectID uuid.UUID) ([]ProjectCost, error) {
+	entries, err := s.repo.ListTimeEntries(ctx, TimeEntryFilter{ProjectID: &projectID})
+	if err != nil {
+		return nil, err
+	}
+	costs := make([]ProjectCost, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Amount.IsPositive() {
+			costs = append(costs, ProjectCost{Kind: CostKindTime, Amount: entry.Amount})
+		}
+	}
+	return costs, nil
+}
+
+func (s *timeEntryService) requireOpenWeek(ctx context.Context, userID uuid.UUID, date time.Time) error {
+	timesheet, err := s.repo.GetTimesheet(ctx, userID, weekStart(date))
+	if err != nil {
+		return err
+	}
+	if timesheet.Status != TimesheetStatusOpen {
+		return fmt.Errorf("%w: week of %s", ErrTimesheetLocked, timesheet.WeekStart.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// normalizeTimeEntry trims and validates the entry against its project and
+// prices it. The time is either a start and end, from which the minutes and
+// date follow, or minutes on a date; a start without an end is a running
+// timer, which only StartTimer creates.
+func (s *timeEntryService) normalizeTimeEntry(ctx context.Context, entry *TimeEntry) error {
+	if entry.UserID == uuid.Nil {
+		return fmt.Errorf("%w: a user is required", ErrInvalidTimeEntry)
+	}
+	project, err := s.projects.GetProjectByID(ctx, entry.ProjectID)
+	if err != nil {
+		return err
+	}
+	if entry.TaskID != nil {
+		task, err := s.tasks.GetTaskByID(ctx, *entry.TaskID)
+		if errors.Is(err, ErrTaskNotFound) {
+			return fmt.Errorf("%w: task %s does not exist", ErrInvalidTimeEntry, *entry.TaskID)
+		}
+		if err != nil {
+			return err
+		}
+		if task.ProjectID != entry.ProjectID {
+			return fmt.Errorf("%w: task %s is not on the project", ErrInvalidTimeEntry, task.ID)
+		}
+	}
+	entry.Notes = strings.TrimSpace(entry.Notes)
+	entry.InvoiceID = nil
+
+	switch {
+	case entry.StartedAt != nil && entry.EndedAt == nil:
+		entry.Minutes = 0
+		entry.Date = *dateOnly(entry.StartedAt)
+	case entry.StartedAt != nil:
+		if !entry.EndedAt.After(*entry.StartedAt) {
+			return fmt.Errorf("%w: the entry ends before it starts", ErrInvalidTimeEntry)
+		}
+		entry.Minutes = int(entry.EndedAt.Sub(*entry.StartedAt).Round(time.Minute) / time.Minute)
+		entry.Date = *dateOnly(entry.StartedAt)
+	case entry.EndedAt != nil:
+		return fmt.Errorf("%w: an end needs a start", ErrInvalidTimeEntry)
+	default:
+		if entry.Date.IsZero() {
+			return fmt.Errorf("%w: a date is required", ErrInvalidTimeEntry)
+		}
+		entry.Date = *dateOnly(&entry.Date)
+	}
+	if !entry.Running() && entry.Minutes <= 0 {
+		return fmt.Errorf("%w: at least a minute must be logged", ErrInvalidTimeEntry)
+	}
+	if entry.Minutes > maxEntryMinutes {
+		return fmt.Errorf("%w: an entry cannot be longer than a day", ErrInvalidTimeEntry)
+	}
+
+	if entry.Rate.IsZero() {
+		entry.Rate = core.Zero(project.Currency)
+	}
+	if entry.Rate.Currency() != project.Currency {
+		return fmt.Errorf("%w: the rate is in %s but the project in %s", core.ErrCurrencyMismatch, entry.Rate.Currency(), project.Currency)
+	}
+	if entry.Rate.IsNegative() {
+		return fmt.Errorf("%w: the rate cannot be negative", ErrInvalidTimeEntry)
+	}
+	if entry.Billable && !entry.Rate.IsPositive() {
+		return fmt.Errorf("%w: billable time needs a rate", ErrInvalidTimeEntry)
+	}
+	return entry.price()
+}
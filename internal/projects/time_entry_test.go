@@ -0,0 +1,300 @@
+package projects
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"rva_crm/internal/billing"
+	"rva_crm/internal/core"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockTimeEntryRepository struct {
+	mock.Mock
+}
+
+func (m *MockTimeEntryRepository) GetTimeEntryByID(ctx context.Context, id uuid.UUID) (*TimeEntry, error) {
+	args := m.Called(ctx, id)
+	entry, _ := args.Get(0).(*TimeEntry)
+	return entry, args.Error(1)
+}
+
+func (m *MockTimeEntryRepository) ListTimeEntries(ctx context.Context, filter TimeEntryFilter) ([]*TimeEntry, error) {
+	args := m.Called(ctx, filter)
+	entries, _ := args.Get(0).([]*TimeEntry)
+	return entries, args.Error(1)
+}
+
+func (m *MockTimeEntryRepository) CreateTimeEntry(ctx context.Context, entry TimeEntry) (*TimeEntry, error) {
+	args := m.Called(ctx, entry)
+	created, _ := args.Get(0).(*TimeEntry)
+	return created, args.Error(1)
+}
+
+func (m *MockTimeEntryRepository) UpdateTimeEntry(ctx context.Context, entry TimeEntry) (*TimeEntry, error) {
+	args := m.Called(ctx, entry)
+	updated, _ := args.Get(0).(*TimeEntry)
+	return updated, args.Error(1)
+}
+
+func (m *MockTimeEntryRepository) DeleteTimeEntry(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockTimeEntryRepository) GetRunningTimer(ctx context.Context, userID uuid.UUID) (*TimeEntry, error) {
+	args := m.Called(ctx, userID)
+	entry, _ := args.Get(0).(*TimeEntry)
+	return entry, args.Error(1)
+}
+
+func (m *MockTimeEntryRepository) GetTimesheet(ctx context.Context, userID uuid.UUID, weekStart time.Time) (*Timesheet, error) {
+	args := m.Called(ctx, userID, weekStart)
+	timesheet, _ := args.Get(0).(*Timesheet)
+	return timesheet, args.Error(1)
+}
+
+func (m *MockTimeEntryRepository) SetTimesheetStatus(ctx context.Context, timesheet Timesheet, from TimesheetStatus) (*Timesheet, error) {
+	args := m.Called(ctx, timesheet, from)
+	saved, _ := args.Get(0).(*Timesheet)
+	return saved, args.Error(1)
+}
+
+func (m *MockTimeEntryRepository) ClaimBillableTime(ctx context.Context, projectID uuid.UUID, claim uuid.UUID) ([]*TimeEntry, error) {
+	args := m.Called(ctx, projectID, claim)
+	entries, _ := args.Get(0).([]*TimeEntry)
+	return entries, args.Error(1)
+}
+
+func (m *MockTimeEntryRepository) AttachClaimToInvoice(ctx context.Context, claim uuid.UUID, invoiceID uuid.UUID) error {
+	args := m.Called(ctx, claim, invoiceID)
+	return args.Error(0)
+}
+
+func (m *MockTimeEntryRepository) ReleaseBillingClaim(ctx context.Context, claim uuid.UUID) error {
+	args := m.Called(ctx, claim)
+	return args.Error(0)
+}
+
+func TestWeekStart_IsMonday(t *testing.T) {
+	assert.Equal(t, *date(2026, 7, 6), weekStart(time.Date(2026, 7, 6, 23, 0, 0, 0, time.UTC)))
+	assert.Equal(t, *date(2026, 7, 6), weekStart(time.Date(2026, 7, 12, 8, 0, 0, 0, time.UTC)))
+	assert.Equal(t, *date(2026, 7, 13), weekStart(time.Date(2026, 7, 13, 0, 0, 0, 0, time.UTC)))
+}
+
+type TimeEntryServiceTestSuite struct {
+	suite.Suite
+	repo     *MockTimeEntryRepository
+	projects *MockProjectRepository
+	tasks    *MockTaskRepository
+	invoices *MockInvoiceCreator
+	service  *timeEntryService
+	project  *Project
+	userID   uuid.UUID
+	now      time.Time
+}
+
+func (s *TimeEntryServiceTestSuite) SetupTest() {
+	s.repo = new(MockTimeEntryRepository)
+	s.projects = new(MockProjectRepository)
+	s.tasks = new(MockTaskRepository)
+	s.invoices = new(MockInvoiceCreator)
+	s.service = NewTimeEntryService(s.repo, s.projects, s.tasks, s.invoices).(*timeEntryService)
+	s.now = time.Date(2026, 7, 8, 10, 20, 0, 0, time.UTC)
+	s.service.now = func() time.Time { return s.now }
+
+	s.project = &Project{CustomerID: uuid.New(), Name: "Acme advisory", Currency: core.USD}
+	s.project.ID = uuid.New()
+	s.userID = uuid.New()
+}
+
+func (s *TimeEntryServiceTestSuite) TearDownTest() {
+	s.repo.AssertExpectations(s.T())
+	s.projects.AssertExpectations(s.T())
+	s.tasks.AssertExpectations(s.T())
+	s.invoices.AssertExpectations(s.T())
+}
+
+func TestTimeEntryServiceSuite(t *testing.T) {
+	suite.Run(t, new(TimeEntryServiceTestSuite))
+}
+
+func (s *TimeEntryServiceTestSuite) timesheet(status TimesheetStatus, entries ...*TimeEntry) *Timesheet {
+	return &Timesheet{UserID: s.userID, WeekStart: *date(2026, 7, 6), Status: status, Entries: entries}
+}
+
+func (s *TimeEntryServiceTestSuite) TestCreateTimeEntry_PricesTimeFromStartAndEnd() {
+	// Arrange
+	ctx := context.Background()
+	started := time.Date(2026, 7, 7, 9, 0, 0, 0, time.UTC)
+	ended := started.Add(2*time.Hour + 30*time.Minute)
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil)
+	s.repo.On("GetTimesheet", ctx, s.userID, *date(2026, 7, 6)).Return(s.timesheet(TimesheetStatusOpen), nil)
+	s.repo.On("CreateTimeEntry", ctx, mock.MatchedBy(func(e TimeEntry) bool {
+		return e.Minutes == 150 && e.Date.Equal(*date(2026, 7, 7)) && e.Amount == core.MustParseMoney("375.00", core.USD)
+	})).Return(&TimeEntry{}, nil)
+
+	// Act
+	_, err := s.service.CreateTimeEntry(ctx, TimeEntry{
+		UserID:    s.userID,
+		ProjectID: s.project.ID,
+		StartedAt: &started,
+		EndedAt:   &ended,
+		Billable:  true,
+		Rate:      core.MustParseMoney("150.00", core.USD),
+	})
+
+	// Assert
+	s.NoError(err)
+}
+
+func (s *TimeEntryServiceTestSuite) TestCreateTimeEntry_RejectsSubmittedWeekAndUnratedBillableTime() {
+	// Arrange
+	ctx := context.Background()
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil)
+	s.repo.On("GetTimesheet", ctx, s.userID, *date(2026, 7, 6)).Return(s.timesheet(TimesheetStatusSubmitted), nil)
+	entry := TimeEntry{UserID: s.userID, ProjectID: s.project.ID, Date: *date(2026, 7, 9), Minutes: 45}
+
+	// Act
+	_, locked := s.service.CreateTimeEntry(ctx, entry)
+	entry.Billable = true
+	_, unrated := s.service.CreateTimeEntry(ctx, entry)
+
+	// Assert
+	s.ErrorIs(locked, ErrTimesheetLocked)
+	s.ErrorIs(unrated, ErrInvalidTimeEntry)
+}
+
+func (s *TimeEntryServiceTestSuite) TestStartTimer_OnePerUser() {
+	// Arrange
+	ctx := context.Background()
+	started := s.now.Add(-time.Hour)
+	s.repo.On("GetRunningTimer", ctx, s.userID).Return(&TimeEntry{UserID: s.userID, StartedAt: &started}, nil)
+
+	// Act
+	_, err := s.service.StartTimer(ctx, TimeEntry{UserID: s.userID, ProjectID: s.project.ID})
+
+	// Assert
+	s.ErrorIs(err, ErrTimerRunning)
+}
+
+func (s *TimeEntryServiceTestSuite) TestStopTimer_LogsElapsedTime() {
+	// Arrange
+	ctx := context.Background()
+	started := time.Date(2026, 7, 8, 9, 0, 0, 0, time.UTC)
+	running := &TimeEntry{UserID: s.userID, ProjectID: s.project.ID, StartedAt: &started, Billable: true, Rate: core.MustParseMoney("90.00", core.USD)}
+	running.ID = uuid.New()
+	s.repo.On("GetRunningTimer", ctx, s.userID).Return(running, nil)
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil)
+	s.repo.On("UpdateTimeEntry", ctx, mock.MatchedBy(func(e TimeEntry) bool {
+		return e.EndedAt.Equal(s.now) && e.Minutes == 80 && e.Amount == core.MustParseMoney("120.00", core.USD)
+	})).Return(&TimeEntry{}, nil)
+
+	// Act
+	_, err := s.service.StopTimer(ctx, s.userID)
+
+	// Assert
+	s.NoError(err)
+}
+
+func (s *TimeEntryServiceTestSuite) TestStopTimer_CapsForgottenTimerAtADay() {
+	// Arrange
+	ctx := context.Background()
+	started := s.now.Add(-30 * time.Hour)
+	running := &TimeEntry{UserID: s.userID, ProjectID: s.project.ID, StartedAt: &started, Billable: true, Rate: core.MustParseMoney("90.00", core.USD)}
+	running.ID = uuid.New()
+	s.repo.On("GetRunningTimer", ctx, s.userID).Return(running, nil)
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil)
+	s.repo.On("UpdateTimeEntry", ctx, mock.MatchedBy(func(e TimeEntry) bool {
+		return e.EndedAt.Equal(started.Add(24*time.Hour)) && e.Minutes == maxEntryMinutes
+	})).Return(&TimeEntry{}, nil)
+
+	// Act
+	_, err := s.service.StopTimer(ctx, s.userID)
+
+	// Assert
+	s.NoError(err)
+}
+
+func (s *TimeEntryServiceTestSuite) TestSubmitTimesheet_RefusesRunningTimer() {
+	// Arrange
+	ctx := context.Background()
+	started := s.now.Add(-time.Hour)
+	s.repo.On("GetTimesheet", ctx, s.userID, *date(2026, 7, 6)).Return(s.timesheet(TimesheetStatusOpen, &TimeEntry{StartedAt: &started}), nil)
+
+	// Act
+	_, err := s.service.SubmitTimesheet(ctx, s.userID, s.now)
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidTimesheetTransition)
+}
+
+func (s *TimeEntryServiceTestSuite) TestApproveTimesheet_ByAnotherUserOnceSubmitted() {
+	// Arrange
+	ctx := context.Background()
+	approver := uuid.New()
+	entry := &TimeEntry{Minutes: 90, Billable: true}
+	s.repo.On("GetTimesheet", ctx, s.userID, *date(2026, 7, 6)).Return(s.timesheet(TimesheetStatusSubmitted, entry), nil)
+	s.repo.On("SetTimesheetStatus", ctx, mock.MatchedBy(func(t Timesheet) bool {
+		return t.Status == TimesheetStatusApproved && *t.ApprovedByID == approver && t.ApprovedAt.Equal(s.now)
+	}), TimesheetStatusSubmitted).Return(s.timesheet(TimesheetStatusApproved), nil)
+
+	// Act
+	_, own := s.service.ApproveTimesheet(ctx, s.userID, s.now, s.userID)
+	approved, err := s.service.ApproveTimesheet(ctx, s.userID, s.now, approver)
+
+	// Assert
+	s.ErrorIs(own, ErrInvalidTimesheetTransition)
+	s.Require().NoError(err)
+	s.Equal(90, approved.BillableMinutes)
+}
+
+func (s *TimeEntryServiceTestSuite) TestInvoiceProjectTime_BillsClaimedTimeOnce() {
+	// Arrange
+	ctx := context.Background()
+	entry := &TimeEntry{Date: *date(2026, 7, 7), Minutes: 150, Billable: true, Rate: core.MustParseMoney("150.00", core.USD), Amount: core.MustParseMoney("375.00", core.USD), Notes: "Operating agreement review"}
+	invoice := &billing.Invoice{}
+	invoice.ID = uuid.New()
+	var claim uuid.UUID
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil)
+	s.repo.On("ClaimBillableTime", ctx, s.project.ID, mock.Anything).Run(func(args mock.Arguments) {
+		claim = args.Get(2).(uuid.UUID)
+	}).Return([]*TimeEntry{entry}, nil).Once()
+	s.repo.On("ClaimBillableTime", ctx, s.project.ID, mock.Anything).Return([]*TimeEntry{}, nil).Once()
+	s.invoices.On("CreateInvoice", ctx, mock.MatchedBy(func(i billing.Invoice) bool {
+		return i.CustomerID == s.project.CustomerID && len(i.Items) == 1 && i.Items[0].UnitPrice == entry.Amount &&
+			i.Items[0].Description == "2026-07-07: 2.50 h at USD 150.00/h, Operating agreement review"
+	})).Return(invoice, nil).Once()
+	s.repo.On("AttachClaimToInvoice", ctx, mock.MatchedBy(func(id uuid.UUID) bool { return id == claim }), invoice.ID).Return(nil).Once()
+
+	// Act
+	first, err := s.service.InvoiceProjectTime(ctx, s.project.ID)
+	s.Require().NoError(err)
+	_, again := s.service.InvoiceProjectTime(ctx, s.project.ID)
+
+	// Assert
+	s.Equal(invoice.ID, first.ID)
+	s.ErrorIs(again, ErrNoBillableTime)
+}
+
+func (s *TimeEntryServiceTestSuite) TestInvoiceProjectTime_ReleasesClaimWhenInvoicingFails() {
+	// Arrange
+	ctx := context.Background()
+	entry := &TimeEntry{Date: *date(2026, 7, 7), Minutes: 60, Billable: true, Rate: core.MustParseMoney("100.00", core.USD), Amount: core.MustParseMoney("100.00", core.USD)}
+	s.projects.On("GetProjectByID", ctx, s.project.ID).Return(s.project, nil)
+	s.repo.On("ClaimBillableTime", ctx, s.project.ID, mock.Anything).Return([]*TimeEntry{entry}, nil)
+	s.invoices.On("CreateInvoice", ctx, mock.Anything).Return(nil, errors.New("connection reset"))
+	s.repo.On("ReleaseBillingClaim", ctx, mock.Anything).Return(nil)
+
+	// Act
+	_, err := s.service.InvoiceProjectTime(ctx, s.project.ID)
+
+	// Assert
+	s.ErrorContains(err, "connection reset")
+}